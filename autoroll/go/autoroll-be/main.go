@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/user"
 	"path"
@@ -32,7 +33,9 @@ import (
 	"go.skia.org/infra/go/gcs/gcsclient"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/gitauth"
+	"go.skia.org/infra/go/gitea"
 	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/gitlab"
 	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/metadata"
 	"go.skia.org/infra/go/skiaversion"
@@ -193,6 +196,7 @@ func main() {
 	// so that we can get rid of these vars and the various conditionals.
 	var g *gerrit.Gerrit
 	var githubClient *github.GitHub
+	var crClient *http.Client
 	s, err := storage.NewClient(ctx)
 	if err != nil {
 		sklog.Fatal(err)
@@ -254,6 +258,22 @@ func main() {
 		if err != nil {
 			sklog.Fatalf("Could not create Github client: %s", err)
 		}
+	} else if cfg.GitLab != nil || cfg.Gitea != nil {
+		tokenFilename, tokenServerPath := gitlab.TOKEN_FILENAME, gitlab.TOKEN_SERVER_PATH
+		if cfg.Gitea != nil {
+			tokenFilename, tokenServerPath = gitea.TOKEN_FILENAME, gitea.TOKEN_SERVER_PATH
+		}
+		pathToToken := path.Join(user.HomeDir, tokenFilename)
+		if !*local {
+			pathToToken = path.Join(tokenServerPath, tokenFilename)
+		}
+		// Instantiate the code review client using the token secret.
+		tBody, err := ioutil.ReadFile(pathToToken)
+		if err != nil {
+			sklog.Fatalf("Couldn't find code review token in %s: %s.", pathToToken, err)
+		}
+		token := strings.TrimSpace(string(tBody))
+		crClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
 	}
 
 	sklog.Info("Creating manual roll DB.")
@@ -271,7 +291,7 @@ func main() {
 		sklog.Fatal(err)
 	}
 
-	arb, err := roller.NewAutoRoller(ctx, cfg, emailer, chatBotConfigReader, g, githubClient, *workdir, *recipesCfgFile, serverURL, gcsClient, client, rollerName, *local, manualRolls)
+	arb, err := roller.NewAutoRoller(ctx, cfg, emailer, chatBotConfigReader, g, githubClient, crClient, *workdir, *recipesCfgFile, serverURL, gcsClient, client, rollerName, *local, manualRolls)
 	if err != nil {
 		sklog.Fatal(err)
 	}
@@ -23,6 +23,8 @@ import (
 	"cloud.google.com/go/datastore"
 	"github.com/flynn/json5"
 	"github.com/gorilla/mux"
+	"go.skia.org/infra/autoroll/go/freeze"
+	"go.skia.org/infra/autoroll/go/group"
 	"go.skia.org/infra/autoroll/go/manual"
 	"go.skia.org/infra/autoroll/go/modes"
 	"go.skia.org/infra/autoroll/go/roller"
@@ -67,25 +69,30 @@ var (
 	mainTemplate   *template.Template = nil
 	rollerTemplate *template.Template = nil
 
-	manualRollDB manual.DB              = nil
-	rollerNames  []string               = nil
-	rollers      map[string]*autoroller = nil
+	groupModes   map[string]*modes.ModeHistory = nil
+	manualRollDB manual.DB                     = nil
+	rollerNames  []string                      = nil
+	rollers      map[string]*autoroller        = nil
 )
 
 // Struct used for organizing information about a roller.
 type autoroller struct {
 	Cfg *roller.AutoRollerConfig
 
-	// Interactions with the roller through the DB.
-	Mode     *modes.ModeHistory
-	Status   *status.AutoRollStatusCache
-	Strategy *strategy.StrategyHistory
+	// Interactions with the roller through the DB. GroupMode is nil if the
+	// roller does not belong to a group.
+	GroupMode *modes.ModeHistory
+	Mode      *modes.ModeHistory
+	Status    *status.AutoRollStatusCache
+	Strategy  *strategy.StrategyHistory
 }
 
 // Union types for combining roller status with modes and strategies.
 type autoRollStatus struct {
 	*status.AutoRollStatus
 	Config         *roller.AutoRollerConfig    `json:"config"`
+	GroupMode      *modes.ModeChange           `json:"groupMode,omitempty"`
+	ManualQueue    []*manual.ManualRollRequest `json:"manualQueue"`
 	ManualRequests []*manual.ManualRollRequest `json:"manualRequests"`
 	Mode           *modes.ModeChange           `json:"mode"`
 	Strategy       *strategy.StrategyChange    `json:"strategy"`
@@ -203,10 +210,14 @@ func statusJsonHandler(w http.ResponseWriter, r *http.Request) {
 		status.Error = ""
 	}
 	mode := roller.Mode.CurrentMode()
+	var groupMode *modes.ModeChange
+	if roller.GroupMode != nil {
+		groupMode = roller.GroupMode.CurrentMode()
+	}
 	strategy := roller.Strategy.CurrentStrategy()
 
 	// Obtain manual roll requests, if supported by the roller.
-	var manualRequests []*manual.ManualRollRequest
+	var manualRequests, manualQueue []*manual.ManualRollRequest
 	if roller.Cfg.SupportsManualRolls {
 		var err error
 		manualRequests, err = manualRollDB.GetRecent(roller.Cfg.RollerName, len(status.NotRolledRevisions))
@@ -214,6 +225,11 @@ func statusJsonHandler(w http.ResponseWriter, r *http.Request) {
 			httputils.ReportError(w, err, "Failed to obtain manual roll requests.", http.StatusInternalServerError)
 			return
 		}
+		manualQueue, err = getManualQueue(roller.Cfg.RollerName)
+		if err != nil {
+			httputils.ReportError(w, err, "Failed to obtain manual roll queue.", http.StatusInternalServerError)
+			return
+		}
 	} else {
 		// NotRolledRevisions can take up a lot of space, and they aren't needed
 		// if the roller doesn't support manual rolls.
@@ -224,6 +240,8 @@ func statusJsonHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(&autoRollStatus{
 		AutoRollStatus: status,
 		Config:         roller.Cfg,
+		GroupMode:      groupMode,
+		ManualQueue:    manualQueue,
 		ManualRequests: manualRequests,
 		Mode:           mode,
 		Strategy:       strategy,
@@ -252,6 +270,25 @@ func miniStatusJsonHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func healthJsonHandler(w http.ResponseWriter, r *http.Request) {
+	roller := getRoller(w, r)
+	if roller == nil {
+		// Errors are handled by getRoller().
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	health := roller.Status.Get().Health
+	if health == nil {
+		// The roller has not reported its health yet.
+		health = &status.Health{}
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func unthrottleHandler(w http.ResponseWriter, r *http.Request) {
 	roller := getRoller(w, r)
 	if roller == nil {
@@ -265,6 +302,124 @@ func unthrottleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getGroup returns the name of the roller group in the request path, which
+// must be the group of at least one roller.
+func getGroup(w http.ResponseWriter, r *http.Request) string {
+	group, ok := mux.Vars(r)["group"]
+	if !ok {
+		http.Error(w, "Unable to find group name in request path.", http.StatusBadRequest)
+		return ""
+	}
+	for _, roller := range rollers {
+		if roller.Cfg.Group == group {
+			return group
+		}
+	}
+	http.Error(w, "No such group", http.StatusNotFound)
+	return ""
+}
+
+func freezeJsonHandler(w http.ResponseWriter, r *http.Request) {
+	group := getGroup(w, r)
+	if group == "" {
+		// Errors are handled by getGroup().
+		return
+	}
+
+	ctx := context.Background()
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Message string    `json:"message"`
+			Until   time.Time `json:"until"`
+		}
+		defer util.Close(r.Body)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputils.ReportError(w, err, "Failed to decode request body.", http.StatusBadRequest)
+			return
+		}
+		if !req.Until.After(time.Now()) {
+			http.Error(w, "Freeze must end in the future.", http.StatusBadRequest)
+			return
+		}
+		if err := freeze.Set(ctx, group, req.Until, login.LoggedInAs(r), req.Message); err != nil {
+			httputils.ReportError(w, err, "Failed to freeze group.", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if err := freeze.Clear(ctx, group); err != nil {
+			httputils.ReportError(w, err, "Failed to unfreeze group.", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Return the current freeze, if any.
+	f, err := freeze.Get(ctx, group)
+	if err != nil {
+		httputils.ReportError(w, err, "Failed to obtain freeze.", http.StatusInternalServerError)
+		return
+	}
+	if !f.Active(time.Now()) {
+		f = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func groupModeJsonHandler(w http.ResponseWriter, r *http.Request) {
+	groupName := getGroup(w, r)
+	if groupName == "" {
+		// Errors are handled by getGroup().
+		return
+	}
+
+	mh := groupModes[groupName]
+	if r.Method == http.MethodPost {
+		var mode struct {
+			Message string `json:"message"`
+			Mode    string `json:"mode"`
+		}
+		defer util.Close(r.Body)
+		if err := json.NewDecoder(r.Body).Decode(&mode); err != nil {
+			httputils.ReportError(w, err, "Failed to decode request body.", http.StatusBadRequest)
+			return
+		}
+		if err := mh.Add(context.Background(), mode.Mode, login.LoggedInAs(r), mode.Message); err != nil {
+			httputils.ReportError(w, err, "Failed to set group mode.", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Return the current mode, if any.
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mh.CurrentMode()); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func atomicRollJsonHandler(w http.ResponseWriter, r *http.Request) {
+	groupName := getGroup(w, r)
+	if groupName == "" {
+		// Errors are handled by getGroup().
+		return
+	}
+
+	a, err := group.GetAtomicRoll(context.Background(), groupName)
+	if err != nil {
+		httputils.ReportError(w, err, "Failed to obtain atomic roll.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func rollerHandler(w http.ResponseWriter, r *http.Request) {
 	roller := getRoller(w, r)
 	if roller == nil {
@@ -329,6 +484,19 @@ func newManualRollHandler(w http.ResponseWriter, r *http.Request) {
 	req.RollerName = roller.Cfg.RollerName
 	req.Status = manual.STATUS_PENDING
 	req.Timestamp = firestore.FixTimestamp(time.Now())
+	if !util.TimeIsZero(req.ScheduledTime) {
+		req.ScheduledTime = firestore.FixTimestamp(req.ScheduledTime)
+	}
+	if req.DependsOn != "" {
+		dep, err := manualRollDB.Get(req.DependsOn)
+		if err == manual.ErrNotFound || (err == nil && dep.RollerName != req.RollerName) {
+			http.Error(w, fmt.Sprintf("Unknown manual roll request %q.", req.DependsOn), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			httputils.ReportError(w, err, "Failed to retrieve manual roll request.", http.StatusInternalServerError)
+			return
+		}
+	}
 	if err := manualRollDB.Put(&req); err != nil {
 		httputils.ReportError(w, err, "Failed to insert manual roll request.", http.StatusInternalServerError)
 		return
@@ -339,6 +507,74 @@ func newManualRollHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func cancelManualRollHandler(w http.ResponseWriter, r *http.Request) {
+	roller := getRoller(w, r)
+	if roller == nil {
+		// Errors are handled by getRoller().
+		return
+	}
+	req, err := manualRollDB.Get(mux.Vars(r)["id"])
+	if err == manual.ErrNotFound || (err == nil && req.RollerName != roller.Cfg.RollerName) {
+		http.Error(w, "Unknown manual roll request.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		httputils.ReportError(w, err, "Failed to retrieve manual roll request.", http.StatusInternalServerError)
+		return
+	}
+	if req.Status != manual.STATUS_PENDING {
+		http.Error(w, "Only pending requests may be canceled.", http.StatusBadRequest)
+		return
+	}
+	sklog.Infof("Manual roll request %s canceled by %s", req.Id, login.LoggedInAs(r))
+	req.Status = manual.STATUS_COMPLETE
+	req.Result = manual.RESULT_CANCELED
+	if err := manualRollDB.Put(req); err == manual.ErrConcurrentUpdate {
+		http.Error(w, "The request was modified concurrently; please try again.", http.StatusConflict)
+		return
+	} else if err != nil {
+		httputils.ReportError(w, err, "Failed to update manual roll request.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func manualQueueJsonHandler(w http.ResponseWriter, r *http.Request) {
+	roller := getRoller(w, r)
+	if roller == nil {
+		// Errors are handled by getRoller().
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	queue := []*manual.ManualRollRequest{}
+	if roller.Cfg.SupportsManualRolls {
+		var err error
+		queue, err = getManualQueue(roller.Cfg.RollerName)
+		if err != nil {
+			httputils.ReportError(w, err, "Failed to obtain manual roll queue.", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := json.NewEncoder(w).Encode(queue); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
+// getManualQueue returns the incomplete manual roll requests for the given
+// roller, in the order in which they will be processed.
+func getManualQueue(rollerName string) ([]*manual.ManualRollRequest, error) {
+	reqs, err := manualRollDB.GetIncomplete(rollerName)
+	if err != nil {
+		return nil, err
+	}
+	return manual.Queue(reqs), nil
+}
+
 func mainHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
@@ -377,12 +613,22 @@ func runServer(ctx context.Context, serverURL string) {
 
 	rollerRouter := r.PathPrefix("/r/{roller}").Subrouter()
 	rollerRouter.HandleFunc("", rollerHandler)
+	rollerRouter.HandleFunc("/json/health", httputils.CorsHandler(healthJsonHandler))
 	rollerRouter.HandleFunc("/json/ministatus", httputils.CorsHandler(miniStatusJsonHandler))
 	rollerRouter.HandleFunc("/json/status", httputils.CorsHandler(statusJsonHandler))
 	rollerRouter.Handle("/json/mode", login.RestrictEditorFn(modeJsonHandler)).Methods("POST")
 	rollerRouter.Handle("/json/manual", login.RestrictEditorFn(newManualRollHandler)).Methods("POST")
+	rollerRouter.HandleFunc("/json/manual/queue", httputils.CorsHandler(manualQueueJsonHandler))
+	rollerRouter.Handle("/json/manual/{id}/cancel", login.RestrictEditorFn(cancelManualRollHandler)).Methods("POST")
 	rollerRouter.Handle("/json/strategy", login.RestrictEditorFn(strategyJsonHandler)).Methods("POST")
 	rollerRouter.Handle("/json/unthrottle", login.RestrictEditorFn(unthrottleHandler)).Methods("POST")
+
+	groupRouter := r.PathPrefix("/g/{group}").Subrouter()
+	groupRouter.HandleFunc("/json/freeze", httputils.CorsHandler(freezeJsonHandler)).Methods("GET")
+	groupRouter.Handle("/json/freeze", login.RestrictEditorFn(freezeJsonHandler)).Methods("POST", "DELETE")
+	groupRouter.HandleFunc("/json/atomic", httputils.CorsHandler(atomicRollJsonHandler)).Methods("GET")
+	groupRouter.HandleFunc("/json/mode", httputils.CorsHandler(groupModeJsonHandler)).Methods("GET")
+	groupRouter.Handle("/json/mode", login.RestrictEditorFn(groupModeJsonHandler)).Methods("POST")
 	h := httputils.LoggingGzipRequestResponse(r)
 	if !*local {
 		if viewAllow != nil {
@@ -459,6 +705,10 @@ func main() {
 	}
 
 	// Process the configs.
+	if err := roller.ValidateGroups(cfgs); err != nil {
+		sklog.Fatal(err)
+	}
+	groupModes = map[string]*modes.ModeHistory{}
 	rollerNames = []string{}
 	rollers = map[string]*autoroller{}
 	for _, cfg := range cfgs {
@@ -481,6 +731,22 @@ func main() {
 				sklog.Error(err)
 			}
 		})
+		var groupMode *modes.ModeHistory
+		if cfg.Group != "" {
+			groupMode = groupModes[cfg.Group]
+			if groupMode == nil {
+				groupMode, err = modes.NewModeHistory(ctx, group.ModeKey(cfg.Group))
+				if err != nil {
+					sklog.Fatal(err)
+				}
+				go util.RepeatCtx(10*time.Second, ctx, func(ctx context.Context) {
+					if err := groupMode.Update(ctx); err != nil {
+						sklog.Error(err)
+					}
+				})
+				groupModes[cfg.Group] = groupMode
+			}
+		}
 		arbStatus, err := status.NewCache(ctx, cfg.RollerName)
 		if err != nil {
 			sklog.Fatal(err)
@@ -501,10 +767,11 @@ func main() {
 		})
 		rollerNames = append(rollerNames, cfg.RollerName)
 		rollers[cfg.RollerName] = &autoroller{
-			Cfg:      cfg,
-			Mode:     arbMode,
-			Status:   arbStatus,
-			Strategy: arbStrategy,
+			Cfg:       cfg,
+			GroupMode: groupMode,
+			Mode:      arbMode,
+			Status:    arbStatus,
+			Strategy:  arbStrategy,
 		}
 	}
 	sort.Strings(rollerNames)
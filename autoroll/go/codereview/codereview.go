@@ -3,13 +3,17 @@ package codereview
 import (
 	"context"
 	"errors"
+	"net/http"
 	"strings"
 
 	"go.skia.org/infra/autoroll/go/recent_rolls"
 	"go.skia.org/infra/autoroll/go/revision"
 	"go.skia.org/infra/go/autoroll"
 	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/gitea"
 	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/gitlab"
+	"go.skia.org/infra/go/sklog"
 )
 
 type CodeReview interface {
@@ -38,6 +42,40 @@ type CodeReview interface {
 	UserName() string
 }
 
+// RollUploader is implemented by CodeReviews which create rolls via the code
+// review service's API, rather than via "git cl upload". RepoManagers which
+// support these CodeReviews push the roll to a branch of the parent repo and
+// then call UploadRoll.
+type RollUploader interface {
+	// UploadRoll creates a roll which merges sourceBranch into
+	// targetBranch, using the first line of commitMsg as the title and the
+	// remainder as the description, and returns its issue number.
+	UploadRoll(ctx context.Context, sourceBranch, targetBranch, commitMsg string, dryRun bool) (int64, error)
+}
+
+// splitCommitMsg splits the commit message into a title and description.
+func splitCommitMsg(commitMsg string) (string, string) {
+	split := strings.SplitN(strings.TrimSpace(commitMsg), "\n", 2)
+	desc := ""
+	if len(split) > 1 {
+		desc = strings.TrimSpace(split[1])
+	}
+	return split[0], desc
+}
+
+// rollLabel returns the label which should be applied to a roll, given the
+// configured labels.
+func rollLabel(commitLabel, dryRunLabel string, dryRun bool) []string {
+	label := commitLabel
+	if dryRun {
+		label = dryRunLabel
+	}
+	if label == "" {
+		return nil
+	}
+	return []string{label}
+}
+
 // gerritCodeReview is a CodeReview backed by Gerrit.
 type gerritCodeReview struct {
 	cfg            *GerritConfig
@@ -158,3 +196,163 @@ func (c *githubCodeReview) UserEmail() string {
 func (c *githubCodeReview) UserName() string {
 	return c.userName
 }
+
+// gitlabCodeReview is a CodeReview backed by GitLab.
+type gitlabCodeReview struct {
+	cfg            *GitLabConfig
+	fullHistoryUrl string
+	gitlabClient   *gitlab.GitLab
+	issueUrlBase   string
+	userEmail      string
+	userName       string
+}
+
+// Return a gitlabCodeReview instance.
+func newGitLabCodeReview(cfg *GitLabConfig, client *http.Client) (CodeReview, error) {
+	gitlabClient, err := gitlab.NewGitLab(cfg.URL, cfg.Project, client)
+	if err != nil {
+		return nil, err
+	}
+	user, err := gitlabClient.GetCurrentUser(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	if user.Email == "" {
+		return nil, errors.New("Found no email address for gitlab user.")
+	}
+	if user.Username == "" {
+		return nil, errors.New("Found no username for gitlab user.")
+	}
+	return &gitlabCodeReview{
+		cfg:            cfg,
+		fullHistoryUrl: gitlabClient.GetFullHistoryUrl(user.Username),
+		gitlabClient:   gitlabClient,
+		issueUrlBase:   gitlabClient.GetIssueUrlBase(),
+		userEmail:      user.Email,
+		userName:       user.Username,
+	}, nil
+}
+
+// See documentation for CodeReview interface.
+func (c *gitlabCodeReview) Config() CodeReviewConfig {
+	return c.cfg
+}
+
+// See documentation for CodeReview interface.
+func (c *gitlabCodeReview) GetIssueUrlBase() string {
+	return c.issueUrlBase
+}
+
+// See documentation for CodeReview interface.
+func (c *gitlabCodeReview) GetFullHistoryUrl() string {
+	return c.fullHistoryUrl
+}
+
+// See documentation for CodeReview interface.
+func (c *gitlabCodeReview) RetrieveRoll(ctx context.Context, issue *autoroll.AutoRollIssue, recent *recent_rolls.RecentRolls, rollingTo *revision.Revision, finishedCallback func(context.Context, RollImpl) error) (RollImpl, error) {
+	return newGitLabRoll(ctx, c.cfg, issue, c.gitlabClient, recent, c.issueUrlBase, rollingTo, finishedCallback)
+}
+
+// See documentation for CodeReview interface.
+func (c *gitlabCodeReview) UserEmail() string {
+	return c.userEmail
+}
+
+// See documentation for CodeReview interface.
+func (c *gitlabCodeReview) UserName() string {
+	return c.userName
+}
+
+// See documentation for RollUploader interface.
+func (c *gitlabCodeReview) UploadRoll(ctx context.Context, sourceBranch, targetBranch, commitMsg string, dryRun bool) (int64, error) {
+	title, desc := splitCommitMsg(commitMsg)
+	mr, err := c.gitlabClient.CreateMergeRequest(ctx, sourceBranch, targetBranch, title, desc, rollLabel(c.cfg.CommitLabel, c.cfg.DryRunLabel, dryRun))
+	if err != nil {
+		return 0, err
+	}
+	if c.cfg.TriggerPipeline {
+		// The merge request exists at this point, so report it even if
+		// we fail to trigger the pipeline; the pipeline may be triggered
+		// again by retrying the CQ.
+		if _, err := c.gitlabClient.CreateMergeRequestPipeline(ctx, mr.IID); err != nil {
+			sklog.Errorf("Failed to trigger pipeline for merge request %d: %s", mr.IID, err)
+		}
+	}
+	return mr.IID, nil
+}
+
+// giteaCodeReview is a CodeReview backed by Gitea.
+type giteaCodeReview struct {
+	cfg            *GiteaConfig
+	fullHistoryUrl string
+	giteaClient    *gitea.Gitea
+	issueUrlBase   string
+	userEmail      string
+	userName       string
+}
+
+// Return a giteaCodeReview instance.
+func newGiteaCodeReview(cfg *GiteaConfig, client *http.Client) (CodeReview, error) {
+	giteaClient, err := gitea.NewGitea(cfg.URL, cfg.RepoOwner, cfg.RepoName, client)
+	if err != nil {
+		return nil, err
+	}
+	user, err := giteaClient.GetAuthenticatedUser(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	if user.Email == "" {
+		return nil, errors.New("Found no email address for gitea user.")
+	}
+	if user.Login == "" {
+		return nil, errors.New("Found no login for gitea user.")
+	}
+	return &giteaCodeReview{
+		cfg:            cfg,
+		fullHistoryUrl: giteaClient.GetFullHistoryUrl(user.ID),
+		giteaClient:    giteaClient,
+		issueUrlBase:   giteaClient.GetIssueUrlBase(),
+		userEmail:      user.Email,
+		userName:       user.Login,
+	}, nil
+}
+
+// See documentation for CodeReview interface.
+func (c *giteaCodeReview) Config() CodeReviewConfig {
+	return c.cfg
+}
+
+// See documentation for CodeReview interface.
+func (c *giteaCodeReview) GetIssueUrlBase() string {
+	return c.issueUrlBase
+}
+
+// See documentation for CodeReview interface.
+func (c *giteaCodeReview) GetFullHistoryUrl() string {
+	return c.fullHistoryUrl
+}
+
+// See documentation for CodeReview interface.
+func (c *giteaCodeReview) RetrieveRoll(ctx context.Context, issue *autoroll.AutoRollIssue, recent *recent_rolls.RecentRolls, rollingTo *revision.Revision, finishedCallback func(context.Context, RollImpl) error) (RollImpl, error) {
+	return newGiteaRoll(ctx, c.cfg, issue, c.giteaClient, recent, c.issueUrlBase, rollingTo, finishedCallback)
+}
+
+// See documentation for CodeReview interface.
+func (c *giteaCodeReview) UserEmail() string {
+	return c.userEmail
+}
+
+// See documentation for CodeReview interface.
+func (c *giteaCodeReview) UserName() string {
+	return c.userName
+}
+
+// See documentation for RollUploader interface.
+func (c *giteaCodeReview) UploadRoll(ctx context.Context, sourceBranch, targetBranch, commitMsg string, dryRun bool) (int64, error) {
+	title, desc := splitCommitMsg(commitMsg)
+	pr, err := c.giteaClient.CreatePullRequest(ctx, sourceBranch, targetBranch, title, desc, rollLabel(c.cfg.CommitLabel, c.cfg.DryRunLabel, dryRun))
+	if err != nil {
+		return 0, err
+	}
+	return pr.Number, nil
+}
@@ -0,0 +1,129 @@
+package codereview
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	gitea_testutils "go.skia.org/infra/go/gitea/testutils"
+	gitlab_testutils "go.skia.org/infra/go/gitlab/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestSplitCommitMsg(t *testing.T) {
+	unittest.SmallTest(t)
+
+	title, desc := splitCommitMsg("Roll child\n\nblah blah\nmore\n")
+	require.Equal(t, "Roll child", title)
+	require.Equal(t, "blah blah\nmore", desc)
+	title, desc = splitCommitMsg("Roll child")
+	require.Equal(t, "Roll child", title)
+	require.Equal(t, "", desc)
+}
+
+func TestGitLabCodeReview(t *testing.T) {
+	unittest.SmallTest(t)
+
+	cfg := &GitLabConfig{
+		URL:     "https://gitlab.example.com",
+		Project: "my-group/my-project",
+	}
+	require.NoError(t, cfg.Validate())
+	cfg.CommitLabel = "label"
+	cfg.DryRunLabel = "label"
+	require.EqualError(t, cfg.Validate(), "CommitLabel and DryRunLabel must be different.")
+	cfg.Project = ""
+	require.EqualError(t, cfg.Validate(), "Project is required.")
+	cfg.URL = ""
+	require.EqualError(t, cfg.Validate(), "URL is required.")
+
+	f := gitlab_testutils.NewFakeGitLab(t, "my-group/my-project")
+	defer f.Close()
+	cfg = &GitLabConfig{
+		URL:         f.Server.URL,
+		Project:     "my-group/my-project",
+		CommitLabel: "autoroller: commit",
+	}
+	cr, err := cfg.Init(nil, nil, http.DefaultClient)
+	require.NoError(t, err)
+	require.Equal(t, cfg, cr.Config())
+	require.Equal(t, "roller", cr.UserName())
+	require.Equal(t, "roller@example.com", cr.UserEmail())
+	require.Equal(t, f.Server.URL+"/my-group/my-project/-/merge_requests/", cr.GetIssueUrlBase())
+	require.Equal(t, f.Server.URL+"/my-group/my-project/-/merge_requests?scope=all&state=all&author_username=roller", cr.GetFullHistoryUrl())
+
+	// Labels are only applied if configured. No pipeline is triggered
+	// unless requested.
+	num, err := cr.(RollUploader).UploadRoll(context.Background(), "roll_branch", "master", "Roll child", true)
+	require.NoError(t, err)
+	mr := f.MergeRequest(num)
+	require.Equal(t, "Roll child", mr.Title)
+	require.Empty(t, mr.Labels)
+	require.Nil(t, mr.HeadPipeline)
+
+	// The merge request is still reported if we fail to trigger the
+	// pipeline.
+	cfg.TriggerPipeline = true
+	f.SetPipelinesFail(true)
+	num, err = cr.(RollUploader).UploadRoll(context.Background(), "roll_branch_2", "master", "Roll child", false)
+	require.NoError(t, err)
+	mr = f.MergeRequest(num)
+	require.Equal(t, "Roll child", mr.Title)
+	require.Nil(t, mr.HeadPipeline)
+
+	// The pipeline is triggered if requested.
+	f.SetPipelinesFail(false)
+	num, err = cr.(RollUploader).UploadRoll(context.Background(), "roll_branch_3", "master", "Roll child", false)
+	require.NoError(t, err)
+	require.NotNil(t, f.MergeRequest(num).HeadPipeline)
+}
+
+func TestGiteaCodeReview(t *testing.T) {
+	unittest.SmallTest(t)
+
+	cfg := &GiteaConfig{
+		URL:       "https://gitea.example.com",
+		RepoOwner: "me",
+		RepoName:  "my-repo",
+	}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, "squash", cfg.GetMergeMethod())
+	cfg.MergeMethod = "bogus"
+	require.EqualError(t, cfg.Validate(), "MergeMethod must be one of: [merge, rebase, squash]")
+	cfg.MergeMethod = "rebase"
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, "rebase", cfg.GetMergeMethod())
+	cfg.RepoName = ""
+	require.EqualError(t, cfg.Validate(), "RepoName is required.")
+	cfg.RepoOwner = ""
+	require.EqualError(t, cfg.Validate(), "RepoOwner is required.")
+	cfg.URL = ""
+	require.EqualError(t, cfg.Validate(), "URL is required.")
+
+	f := gitea_testutils.NewFakeGitea(t, "me", "my-repo", "autoroller: commit", "autoroller: dryrun")
+	defer f.Close()
+	cfg = &GiteaConfig{
+		URL:         f.Server.URL,
+		RepoOwner:   "me",
+		RepoName:    "my-repo",
+		CommitLabel: "autoroller: commit",
+		DryRunLabel: "autoroller: dryrun",
+	}
+	cr, err := cfg.Init(nil, nil, http.DefaultClient)
+	require.NoError(t, err)
+	require.Equal(t, "roller", cr.UserName())
+	require.Equal(t, "roller@example.com", cr.UserEmail())
+	require.Equal(t, f.Server.URL+"/me/my-repo/pulls/", cr.GetIssueUrlBase())
+	require.Equal(t, f.Server.URL+"/me/my-repo/pulls?state=all&poster=7", cr.GetFullHistoryUrl())
+
+	num, err := cr.(RollUploader).UploadRoll(context.Background(), "roll_branch", "master", "Roll child\n\nblah blah", true)
+	require.NoError(t, err)
+	pr := f.PullRequest(num)
+	require.Equal(t, "Roll child", pr.Title)
+	require.Equal(t, "blah blah", pr.Body)
+	require.Equal(t, "roll_branch", pr.Head.Ref)
+	require.Equal(t, "master", pr.Base.Ref)
+	require.True(t, pr.HasLabel("autoroller: dryrun"))
+	require.False(t, pr.HasLabel("autoroller: commit"))
+}
@@ -3,10 +3,12 @@ package codereview
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"sort"
 	"strings"
 
 	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/gitea"
 	"go.skia.org/infra/go/github"
 	"go.skia.org/infra/go/skerr"
 	"go.skia.org/infra/go/util"
@@ -49,8 +51,10 @@ var (
 type CodeReviewConfig interface {
 	util.Validator
 
-	// Init creates a CodeReview object based on this CodeReviewConfig.
-	Init(gerrit.GerritInterface, *github.GitHub) (CodeReview, error)
+	// Init creates a CodeReview object based on this CodeReviewConfig. The
+	// http.Client is authenticated for code review services which are
+	// accessed directly via their REST APIs, ie. GitLab and Gitea.
+	Init(gerrit.GerritInterface, *github.GitHub, *http.Client) (CodeReview, error)
 }
 
 // GerritConfig provides configuration for Gerrit.
@@ -87,7 +91,7 @@ func (c *GerritConfig) Validate() error {
 }
 
 // See documentation for CodeReviewConfig interface.
-func (c *GerritConfig) Init(gerritClient gerrit.GerritInterface, githubClient *github.GitHub) (CodeReview, error) {
+func (c *GerritConfig) Init(gerritClient gerrit.GerritInterface, githubClient *github.GitHub, client *http.Client) (CodeReview, error) {
 	return newGerritCodeReview(c, gerritClient)
 }
 
@@ -129,7 +133,7 @@ func (c *GithubConfig) Validate() error {
 }
 
 // See documentation for CodeReviewConfig interface.
-func (c *GithubConfig) Init(gerritClient gerrit.GerritInterface, githubClient *github.GitHub) (CodeReview, error) {
+func (c *GithubConfig) Init(gerritClient gerrit.GerritInterface, githubClient *github.GitHub, client *http.Client) (CodeReview, error) {
 	return newGithubCodeReview(c, githubClient)
 }
 
@@ -142,6 +146,112 @@ func (c *Google3Config) Validate() error {
 }
 
 // See documentation for CodeReviewConfig interface.
-func (c *Google3Config) Init(gerrit.GerritInterface, *github.GitHub) (CodeReview, error) {
+func (c *Google3Config) Init(gerrit.GerritInterface, *github.GitHub, *http.Client) (CodeReview, error) {
 	return nil, errors.New("Init not implemented for Google3Config.")
 }
+
+// GitLabConfig provides configuration for GitLab merge requests.
+type GitLabConfig struct {
+	// GitLab host URL, eg. "https://gitlab.com".
+	URL string `json:"url"`
+
+	// Path of the project, eg. "my-group/my-project".
+	Project string `json:"project"`
+
+	// Optional fields.
+
+	// Labels which are applied to merge requests in normal and dry run
+	// mode, respectively, for projects whose CI acts on labels.
+	CommitLabel string `json:"commitLabel,omitempty"`
+	DryRunLabel string `json:"dryRunLabel,omitempty"`
+
+	// If true, squash the commits of each merge request when merging.
+	Squash bool `json:"squash,omitempty"`
+
+	// If true, trigger a merge request pipeline when uploading a roll.
+	// Otherwise, rely on the project's CI configuration to run a pipeline
+	// when the roll is pushed. Pipelines are always triggered when the CQ
+	// or dry run is retried.
+	TriggerPipeline bool `json:"triggerPipeline,omitempty"`
+}
+
+// See documentation for util.Validator interface.
+func (c *GitLabConfig) Validate() error {
+	if c.URL == "" {
+		return errors.New("URL is required.")
+	}
+	if c.Project == "" {
+		return errors.New("Project is required.")
+	}
+	if c.CommitLabel != "" && c.CommitLabel == c.DryRunLabel {
+		return errors.New("CommitLabel and DryRunLabel must be different.")
+	}
+	return nil
+}
+
+// See documentation for CodeReviewConfig interface.
+func (c *GitLabConfig) Init(gerritClient gerrit.GerritInterface, githubClient *github.GitHub, client *http.Client) (CodeReview, error) {
+	return newGitLabCodeReview(c, client)
+}
+
+// GiteaConfig provides configuration for Gitea pull requests.
+type GiteaConfig struct {
+	// Gitea host URL, eg. "https://gitea.com".
+	URL string `json:"url"`
+
+	// Owner and name of the repo.
+	RepoOwner string `json:"repoOwner"`
+	RepoName  string `json:"repoName"`
+
+	// Optional fields.
+
+	// Labels which are applied to pull requests in normal and dry run
+	// mode, respectively, for repos whose CI acts on labels. The labels
+	// must already exist in the repo.
+	CommitLabel string `json:"commitLabel,omitempty"`
+	DryRunLabel string `json:"dryRunLabel,omitempty"`
+
+	// Commit status contexts which must succeed before a pull request is
+	// merged. If not provided, at least one status is required, and all
+	// statuses must succeed.
+	RequiredChecks []string `json:"requiredChecks,omitempty"`
+
+	// How pull requests are merged: "merge", "rebase", or "squash".
+	// Defaults to "squash".
+	MergeMethod string `json:"mergeMethod,omitempty"`
+}
+
+// See documentation for util.Validator interface.
+func (c *GiteaConfig) Validate() error {
+	if c.URL == "" {
+		return errors.New("URL is required.")
+	}
+	if c.RepoOwner == "" {
+		return errors.New("RepoOwner is required.")
+	}
+	if c.RepoName == "" {
+		return errors.New("RepoName is required.")
+	}
+	if c.CommitLabel != "" && c.CommitLabel == c.DryRunLabel {
+		return errors.New("CommitLabel and DryRunLabel must be different.")
+	}
+	switch c.MergeMethod {
+	case "", gitea.MERGE_METHOD_MERGE, gitea.MERGE_METHOD_REBASE, gitea.MERGE_METHOD_SQUASH:
+	default:
+		return fmt.Errorf("MergeMethod must be one of: [%s, %s, %s]", gitea.MERGE_METHOD_MERGE, gitea.MERGE_METHOD_REBASE, gitea.MERGE_METHOD_SQUASH)
+	}
+	return nil
+}
+
+// See documentation for CodeReviewConfig interface.
+func (c *GiteaConfig) Init(gerritClient gerrit.GerritInterface, githubClient *github.GitHub, client *http.Client) (CodeReview, error) {
+	return newGiteaCodeReview(c, client)
+}
+
+// GetMergeMethod returns the method used to merge pull requests.
+func (c *GiteaConfig) GetMergeMethod() string {
+	if c.MergeMethod == "" {
+		return gitea.MERGE_METHOD_SQUASH
+	}
+	return c.MergeMethod
+}
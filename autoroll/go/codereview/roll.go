@@ -14,7 +14,9 @@ import (
 	"go.skia.org/infra/autoroll/go/state_machine"
 	"go.skia.org/infra/go/autoroll"
 	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/gitea"
 	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/gitlab"
 	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/go/travisci"
@@ -61,6 +63,19 @@ func updateIssueFromGerrit(ctx context.Context, cfg *GerritConfig, a *autoroll.A
 	if err := updateIssueFromGerritChangeInfo(a, info, g.Config()); err != nil {
 		return nil, fmt.Errorf("Failed to convert issue format: %s", err)
 	}
+	if info.IsMerged() && a.LandedRevision == "" {
+		// Depending on the submit type, the change may have landed as
+		// its current patchset or as a merge commit, so we have to ask
+		// Gerrit which commit landed.
+		landed, err := g.GetMergedRevision(ctx, info)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve landed revision: %s", err)
+		}
+		if landed == "" {
+			sklog.Warningf("Unable to find the landed revision of issue %d.", a.Issue)
+		}
+		a.LandedRevision = landed
+	}
 	return info, nil
 }
 
@@ -81,6 +96,10 @@ func updateIssueFromGerritChangeInfo(i *autoroll.AutoRollIssue, ci *gerrit.Chang
 	}
 	i.Closed = ci.IsClosed()
 	i.Committed = ci.Committed
+	if !ci.Committed {
+		// LandedRevision is filled in by updateIssueFromGerrit.
+		i.LandedRevision = ""
+	}
 	i.Created = ci.Created
 	i.Modified = ci.Updated
 	i.Patchsets = ps
@@ -470,6 +489,10 @@ func updateIssueFromGitHubPullRequest(i *autoroll.AutoRollIssue, pullRequest *gi
 	}
 	i.Closed = pullRequest.GetState() == github.CLOSED_STATE
 	i.Committed = pullRequest.GetMerged()
+	i.LandedRevision = ""
+	if i.Committed {
+		i.LandedRevision = pullRequest.GetMergeCommitSHA()
+	}
 	i.Created = pullRequest.GetCreatedAt()
 	i.Modified = pullRequest.GetUpdatedAt()
 	i.Patchsets = ps
@@ -652,3 +675,598 @@ func (r *githubRoll) IssueID() string {
 func (r *githubRoll) IssueURL() string {
 	return r.issueUrl
 }
+
+// gitlabRoll is an implementation of RollImpl.
+type gitlabRoll struct {
+	cfg              *GitLabConfig
+	finishedCallback func(context.Context, RollImpl) error
+	g                *gitlab.GitLab
+	issue            *autoroll.AutoRollIssue
+	issueUrl         string
+	mr               *gitlab.MergeRequest
+	recent           *recent_rolls.RecentRolls
+	result           string
+	retrieveRoll     func(context.Context) (*gitlab.MergeRequest, error)
+	rollingTo        *revision.Revision
+}
+
+// gitlabJobTryResult converts the given gitlab.Job to a TryResult.
+func gitlabJobTryResult(job *gitlab.Job) *autoroll.TryResult {
+	tryResult := &autoroll.TryResult{
+		Builder:  fmt.Sprintf("%s #%d", job.Name, job.ID),
+		Category: autoroll.TRYBOT_CATEGORY_CQ,
+		Created:  job.CreatedAt,
+		Status:   autoroll.TRYBOT_STATUS_STARTED,
+		Url:      job.WebURL,
+	}
+	switch job.Status {
+	case gitlab.PIPELINE_STATUS_CREATED, gitlab.PIPELINE_STATUS_PENDING:
+		tryResult.Status = autoroll.TRYBOT_STATUS_SCHEDULED
+	case gitlab.PIPELINE_STATUS_SUCCESS, gitlab.PIPELINE_STATUS_SKIPPED, gitlab.PIPELINE_STATUS_MANUAL:
+		// Skipped and manual jobs don't block the pipeline.
+		tryResult.Status = autoroll.TRYBOT_STATUS_COMPLETED
+		tryResult.Result = autoroll.TRYBOT_RESULT_SUCCESS
+	case gitlab.PIPELINE_STATUS_FAILED:
+		tryResult.Status = autoroll.TRYBOT_STATUS_COMPLETED
+		tryResult.Result = autoroll.TRYBOT_RESULT_FAILURE
+	case gitlab.PIPELINE_STATUS_CANCELED:
+		tryResult.Status = autoroll.TRYBOT_STATUS_COMPLETED
+		tryResult.Result = autoroll.TRYBOT_RESULT_CANCELED
+	}
+	return tryResult
+}
+
+// updateIssueFromGitLab loads details about the merge request from the GitLab
+// API and updates the AutoRollIssue accordingly. If the roll is not a dry run
+// and its pipeline has succeeded, the merge request is merged.
+func updateIssueFromGitLab(ctx context.Context, cfg *GitLabConfig, a *autoroll.AutoRollIssue, g *gitlab.GitLab) (*gitlab.MergeRequest, error) {
+	mr, err := g.GetMergeRequest(ctx, a.Issue)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get merge request %d: %s", a.Issue, err)
+	}
+	tryResults := []*autoroll.TryResult{}
+	if mr.HeadPipeline != nil {
+		jobs, err := g.GetPipelineJobs(ctx, mr.HeadPipeline.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get jobs for pipeline %d: %s", mr.HeadPipeline.ID, err)
+		}
+		for _, job := range jobs {
+			tryResults = append(tryResults, gitlabJobTryResult(job))
+		}
+	}
+	a.TryResults = tryResults
+	if err := updateIssueFromGitLabMergeRequest(a, mr); err != nil {
+		return nil, fmt.Errorf("Failed to convert issue format: %s", err)
+	}
+
+	// GitLab pipelines are not a commit queue, so we merge the roll via
+	// the API once the pipeline succeeds.
+	if !a.IsDryRun && !a.Closed && mr.HeadPipeline != nil && mr.HeadPipeline.Status == gitlab.PIPELINE_STATUS_SUCCESS && mr.MergeStatus == gitlab.MERGE_STATUS_CAN_BE_MERGED {
+		sklog.Infof("Pipeline %d succeeded for merge request %d; merging.", mr.HeadPipeline.ID, a.Issue)
+		merged, err := g.MergeMergeRequest(ctx, a.Issue, mr.SHA, cfg.Squash)
+		if err != nil {
+			return nil, fmt.Errorf("Could not merge merge request %d: %s", a.Issue, err)
+		}
+		merged.HeadPipeline = mr.HeadPipeline
+		mr = merged
+		if err := updateIssueFromGitLabMergeRequest(a, mr); err != nil {
+			return nil, fmt.Errorf("Failed to convert issue format: %s", err)
+		}
+	}
+	return mr, nil
+}
+
+// updateIssueFromGitLabMergeRequest updates the AutoRollIssue instance based
+// on the given MergeRequest.
+func updateIssueFromGitLabMergeRequest(i *autoroll.AutoRollIssue, mr *gitlab.MergeRequest) error {
+	if i.Issue != mr.IID {
+		return fmt.Errorf("Merge request IID %d differs from existing issue number %d!", mr.IID, i.Issue)
+	}
+	merged := mr.State == gitlab.MERGE_REQUEST_STATE_MERGED
+	closed := merged || mr.State == gitlab.MERGE_REQUEST_STATE_CLOSED
+	conflict := mr.HasConflicts || mr.MergeStatus == gitlab.MERGE_STATUS_CANNOT_BE_MERGED
+	pipelineFinished := mr.HeadPipeline != nil && mr.HeadPipeline.Finished()
+	pipelineSuccess := mr.HeadPipeline != nil && mr.HeadPipeline.Status == gitlab.PIPELINE_STATUS_SUCCESS
+	if i.IsDryRun {
+		i.CqFinished = false
+		i.CqSuccess = false
+		i.DryRunFinished = closed || conflict || pipelineFinished
+		i.DryRunSuccess = merged || (!closed && !conflict && pipelineSuccess)
+	} else {
+		i.CqFinished = closed || conflict || (pipelineFinished && !pipelineSuccess)
+		i.CqSuccess = merged
+		i.DryRunFinished = false
+		i.DryRunSuccess = false
+	}
+	i.Closed = closed
+	i.Committed = merged
+	i.Created = mr.CreatedAt
+	i.Modified = mr.UpdatedAt
+	i.Subject = mr.Title
+	i.Result = autoroll.RollResult(i)
+	return i.Validate()
+}
+
+// newGitLabRoll obtains a gitlabRoll instance from the given merge request
+// IID.
+func newGitLabRoll(ctx context.Context, cfg *GitLabConfig, issue *autoroll.AutoRollIssue, g *gitlab.GitLab, recent *recent_rolls.RecentRolls, issueUrlBase string, rollingTo *revision.Revision, cb func(context.Context, RollImpl) error) (RollImpl, error) {
+	mr, err := updateIssueFromGitLab(ctx, cfg, issue, g)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabRoll{
+		cfg:              cfg,
+		finishedCallback: cb,
+		g:                g,
+		issue:            issue,
+		issueUrl:         fmt.Sprintf("%s%d", issueUrlBase, issue.Issue),
+		mr:               mr,
+		recent:           recent,
+		retrieveRoll: func(ctx context.Context) (*gitlab.MergeRequest, error) {
+			return updateIssueFromGitLab(ctx, cfg, issue, g)
+		},
+		rollingTo: rollingTo,
+	}, nil
+}
+
+// See documentation for RollImpl interface.
+func (r *gitlabRoll) InsertIntoDB(ctx context.Context) error {
+	return r.recent.Add(ctx, r.issue)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) AddComment(ctx context.Context, msg string) error {
+	return r.g.AddComment(ctx, r.mr.IID, msg)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) Close(ctx context.Context, result, msg string) error {
+	sklog.Infof("Closing merge request %d (result %q) with message: %s", r.mr.IID, result, msg)
+	r.result = result
+	return r.withModify(ctx, "close the merge request", func() error {
+		if err := r.g.AddComment(ctx, r.mr.IID, msg); err != nil {
+			return err
+		}
+		_, err := r.g.CloseMergeRequest(ctx, r.mr.IID)
+		return err
+	})
+}
+
+// Helper function for modifying a roll CL which might fail due to the CL being
+// closed by a human or some other process, in which case we don't want to error
+// out.
+func (r *gitlabRoll) withModify(ctx context.Context, action string, fn func() error) error {
+	if err := fn(); err != nil {
+		// It's possible that somebody closed the merge request (or it
+		// landed) while we were working. If that's the case, log an
+		// error and move on.
+		if err2 := r.Update(ctx); err2 != nil {
+			return fmt.Errorf("Failed to %s with error:\n%s\nAnd failed to update it with error:\n%s", action, err, err2)
+		}
+		if r.mr.State != gitlab.MERGE_REQUEST_STATE_OPENED {
+			sklog.Errorf("Attempted to %s but it is already closed! Error: %s", action, err)
+			return nil
+		}
+		return err
+	}
+	return r.Update(ctx)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) Update(ctx context.Context) error {
+	alreadyFinished := r.IsFinished()
+	mr, err := r.retrieveRoll(ctx)
+	if err != nil {
+		return err
+	}
+	r.mr = mr
+	if r.result != "" {
+		r.issue.Result = r.result
+	}
+	if err := r.recent.Update(ctx, r.issue); err != nil {
+		return err
+	}
+	if r.IsFinished() && !alreadyFinished && r.finishedCallback != nil {
+		return r.finishedCallback(ctx, r)
+	}
+	return nil
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IsClosed() bool {
+	return r.issue.Closed
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IsFinished() bool {
+	return r.issue.CqFinished
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IsSuccess() bool {
+	return r.issue.CqSuccess
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IsDryRunFinished() bool {
+	return r.issue.DryRunFinished
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IsDryRunSuccess() bool {
+	return r.issue.DryRunSuccess
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) RollingTo() *revision.Revision {
+	return r.rollingTo
+}
+
+// setMode updates the labels of the merge request to reflect the given mode
+// and, if requested, triggers a new pipeline.
+func (r *gitlabRoll) setMode(ctx context.Context, action string, dryRun, triggerPipeline bool) error {
+	return r.withModify(ctx, action, func() error {
+		oldLabel, newLabel := r.cfg.DryRunLabel, r.cfg.CommitLabel
+		if dryRun {
+			oldLabel, newLabel = newLabel, oldLabel
+		}
+		if err := r.g.ReplaceLabel(ctx, r.mr.IID, oldLabel, newLabel); err != nil {
+			return err
+		}
+		if triggerPipeline {
+			if _, err := r.g.CreateMergeRequestPipeline(ctx, r.mr.IID); err != nil {
+				return err
+			}
+		}
+		r.issue.IsDryRun = dryRun
+		return nil
+	})
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) SwitchToDryRun(ctx context.Context) error {
+	return r.setMode(ctx, "switch the merge request to dry run", true, false)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) SwitchToNormal(ctx context.Context) error {
+	return r.setMode(ctx, "switch the merge request out of dry run", false, false)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) RetryCQ(ctx context.Context) error {
+	return r.setMode(ctx, "retry the pipeline", false, true)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) RetryDryRun(ctx context.Context) error {
+	return r.setMode(ctx, "retry the pipeline (dry run)", true, true)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IssueID() string {
+	return fmt.Sprintf("%d", r.issue.Issue)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *gitlabRoll) IssueURL() string {
+	return r.issueUrl
+}
+
+// Gitea checks whether a pull request can be merged asynchronously, and
+// reports it as not mergeable until the check finishes. A pull request which
+// is reported as not mergeable within this period after it was last updated is
+// assumed to still be checked, rather than to have a merge conflict. This is
+// able to be overridden for testing.
+var giteaMergeableCheckPeriod = 5 * time.Minute
+
+// giteaRoll is an implementation of RollImpl.
+type giteaRoll struct {
+	cfg              *GiteaConfig
+	finishedCallback func(context.Context, RollImpl) error
+	g                *gitea.Gitea
+	issue            *autoroll.AutoRollIssue
+	issueUrl         string
+	pr               *gitea.PullRequest
+	recent           *recent_rolls.RecentRolls
+	result           string
+	retrieveRoll     func(context.Context) (*gitea.PullRequest, error)
+	rollingTo        *revision.Revision
+}
+
+// giteaStatusTryResult converts the given gitea.Status to a TryResult.
+func giteaStatusTryResult(s *gitea.Status) *autoroll.TryResult {
+	tryResult := &autoroll.TryResult{
+		Builder:  s.Context,
+		Category: autoroll.TRYBOT_CATEGORY_CQ,
+		Created:  s.CreatedAt,
+		Status:   autoroll.TRYBOT_STATUS_STARTED,
+		Url:      s.TargetURL,
+	}
+	switch s.Status {
+	case gitea.STATUS_SUCCESS, gitea.STATUS_WARNING:
+		tryResult.Status = autoroll.TRYBOT_STATUS_COMPLETED
+		tryResult.Result = autoroll.TRYBOT_RESULT_SUCCESS
+	case gitea.STATUS_FAILURE, gitea.STATUS_ERROR:
+		tryResult.Status = autoroll.TRYBOT_STATUS_COMPLETED
+		tryResult.Result = autoroll.TRYBOT_RESULT_FAILURE
+	}
+	return tryResult
+}
+
+// giteaChecksResult returns whether the checks for a pull request have finished
+// and whether they succeeded, given its TryResults and the required checks. If
+// no checks are required, at least one is expected.
+func giteaChecksResult(tryResults []*autoroll.TryResult, requiredChecks []string) (bool, bool) {
+	for _, t := range tryResults {
+		if t.Finished() && !t.Succeeded() {
+			return true, false
+		}
+	}
+	if len(tryResults) == 0 {
+		return false, false
+	}
+	for _, check := range requiredChecks {
+		found := false
+		for _, t := range tryResults {
+			if t.Builder == check {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, false
+		}
+	}
+	for _, t := range tryResults {
+		if !t.Finished() {
+			return false, false
+		}
+	}
+	return true, true
+}
+
+// updateIssueFromGitea loads details about the pull request from the Gitea API
+// and updates the AutoRollIssue accordingly. If the roll is not a dry run and
+// its checks have succeeded, the pull request is merged.
+func updateIssueFromGitea(ctx context.Context, cfg *GiteaConfig, a *autoroll.AutoRollIssue, g *gitea.Gitea) (*gitea.PullRequest, error) {
+	pr, err := g.GetPullRequest(ctx, a.Issue)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get pull request %d: %s", a.Issue, err)
+	}
+	status, err := g.GetCombinedStatus(ctx, pr.Head.SHA)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get statuses for pull request %d: %s", a.Issue, err)
+	}
+	tryResults := make([]*autoroll.TryResult, 0, len(status.Statuses))
+	for _, s := range status.Statuses {
+		tryResults = append(tryResults, giteaStatusTryResult(s))
+	}
+	a.TryResults = tryResults
+	checksFinished, checksSuccess := giteaChecksResult(tryResults, cfg.RequiredChecks)
+	if err := updateIssueFromGiteaPullRequest(a, pr, checksFinished, checksSuccess); err != nil {
+		return nil, fmt.Errorf("Failed to convert issue format: %s", err)
+	}
+
+	// Gitea does not have a commit queue, so we merge the roll via the API
+	// once the checks succeed.
+	if !a.IsDryRun && !a.Closed && checksSuccess && pr.Mergeable {
+		sklog.Infof("Checks succeeded for pull request %d; merging.", a.Issue)
+		if err := g.MergePullRequest(ctx, a.Issue, cfg.GetMergeMethod(), pr.Title, pr.Body); err != nil {
+			return nil, fmt.Errorf("Could not merge pull request %d: %s", a.Issue, err)
+		}
+		pr, err = g.GetPullRequest(ctx, a.Issue)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get pull request %d: %s", a.Issue, err)
+		}
+		if err := updateIssueFromGiteaPullRequest(a, pr, checksFinished, checksSuccess); err != nil {
+			return nil, fmt.Errorf("Failed to convert issue format: %s", err)
+		}
+	}
+	return pr, nil
+}
+
+// updateIssueFromGiteaPullRequest updates the AutoRollIssue instance based on
+// the given PullRequest and the results of its checks.
+func updateIssueFromGiteaPullRequest(i *autoroll.AutoRollIssue, pr *gitea.PullRequest, checksFinished, checksSuccess bool) error {
+	if i.Issue != pr.Number {
+		return fmt.Errorf("Pull request number %d differs from existing issue number %d!", pr.Number, i.Issue)
+	}
+	closed := pr.Merged || pr.State == gitea.PULL_REQUEST_STATE_CLOSED
+	// If we don't know yet whether the pull request can be merged, we'll
+	// find out on a later update.
+	conflict := !closed && !pr.Mergeable && time.Since(pr.UpdatedAt) >= giteaMergeableCheckPeriod
+	if i.IsDryRun {
+		i.CqFinished = false
+		i.CqSuccess = false
+		i.DryRunFinished = closed || conflict || checksFinished
+		i.DryRunSuccess = pr.Merged || (!closed && !conflict && checksSuccess)
+	} else {
+		i.CqFinished = closed || conflict || (checksFinished && !checksSuccess)
+		i.CqSuccess = pr.Merged
+		i.DryRunFinished = false
+		i.DryRunSuccess = false
+	}
+	i.Closed = closed
+	i.Committed = pr.Merged
+	i.Created = pr.CreatedAt
+	i.Modified = pr.UpdatedAt
+	i.Subject = pr.Title
+	i.Result = autoroll.RollResult(i)
+	return i.Validate()
+}
+
+// newGiteaRoll obtains a giteaRoll instance from the given pull request number.
+func newGiteaRoll(ctx context.Context, cfg *GiteaConfig, issue *autoroll.AutoRollIssue, g *gitea.Gitea, recent *recent_rolls.RecentRolls, issueUrlBase string, rollingTo *revision.Revision, cb func(context.Context, RollImpl) error) (RollImpl, error) {
+	pr, err := updateIssueFromGitea(ctx, cfg, issue, g)
+	if err != nil {
+		return nil, err
+	}
+	return &giteaRoll{
+		cfg:              cfg,
+		finishedCallback: cb,
+		g:                g,
+		issue:            issue,
+		issueUrl:         fmt.Sprintf("%s%d", issueUrlBase, issue.Issue),
+		pr:               pr,
+		recent:           recent,
+		retrieveRoll: func(ctx context.Context) (*gitea.PullRequest, error) {
+			return updateIssueFromGitea(ctx, cfg, issue, g)
+		},
+		rollingTo: rollingTo,
+	}, nil
+}
+
+// See documentation for RollImpl interface.
+func (r *giteaRoll) InsertIntoDB(ctx context.Context) error {
+	return r.recent.Add(ctx, r.issue)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) AddComment(ctx context.Context, msg string) error {
+	return r.g.AddComment(ctx, r.pr.Number, msg)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) Close(ctx context.Context, result, msg string) error {
+	sklog.Infof("Closing pull request %d (result %q) with message: %s", r.pr.Number, result, msg)
+	r.result = result
+	return r.withModify(ctx, "close the pull request", func() error {
+		if err := r.g.AddComment(ctx, r.pr.Number, msg); err != nil {
+			return err
+		}
+		_, err := r.g.ClosePullRequest(ctx, r.pr.Number)
+		return err
+	})
+}
+
+// Helper function for modifying a roll CL which might fail due to the CL being
+// closed by a human or some other process, in which case we don't want to error
+// out.
+func (r *giteaRoll) withModify(ctx context.Context, action string, fn func() error) error {
+	if err := fn(); err != nil {
+		// It's possible that somebody closed the pull request (or it
+		// landed) while we were working. If that's the case, log an
+		// error and move on.
+		if err2 := r.Update(ctx); err2 != nil {
+			return fmt.Errorf("Failed to %s with error:\n%s\nAnd failed to update it with error:\n%s", action, err, err2)
+		}
+		if r.pr.State != gitea.PULL_REQUEST_STATE_OPEN {
+			sklog.Errorf("Attempted to %s but it is already closed! Error: %s", action, err)
+			return nil
+		}
+		return err
+	}
+	return r.Update(ctx)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) Update(ctx context.Context) error {
+	alreadyFinished := r.IsFinished()
+	pr, err := r.retrieveRoll(ctx)
+	if err != nil {
+		return err
+	}
+	r.pr = pr
+	if r.result != "" {
+		r.issue.Result = r.result
+	}
+	if err := r.recent.Update(ctx, r.issue); err != nil {
+		return err
+	}
+	if r.IsFinished() && !alreadyFinished && r.finishedCallback != nil {
+		return r.finishedCallback(ctx, r)
+	}
+	return nil
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IsClosed() bool {
+	return r.issue.Closed
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IsFinished() bool {
+	return r.issue.CqFinished
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IsSuccess() bool {
+	return r.issue.CqSuccess
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IsDryRunFinished() bool {
+	return r.issue.DryRunFinished
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IsDryRunSuccess() bool {
+	return r.issue.DryRunSuccess
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) RollingTo() *revision.Revision {
+	return r.rollingTo
+}
+
+// setMode updates the labels of the pull request to reflect the given mode. If
+// retry is true, the label for the new mode is removed and re-added, so that CI
+// systems which act on labels run again.
+func (r *giteaRoll) setMode(ctx context.Context, action string, dryRun, retry bool) error {
+	return r.withModify(ctx, action, func() error {
+		oldLabel, newLabel := r.cfg.DryRunLabel, r.cfg.CommitLabel
+		if dryRun {
+			oldLabel, newLabel = newLabel, oldLabel
+		}
+		if newLabel == "" {
+			if retry {
+				sklog.Warningf("No label is configured for pull request %d; unable to retry its checks.", r.pr.Number)
+			}
+		} else if r.pr.HasLabel(newLabel) {
+			if !retry {
+				newLabel = ""
+			} else if err := r.g.ReplaceLabel(ctx, r.pr.Number, newLabel, ""); err != nil {
+				return err
+			}
+		}
+		if !r.pr.HasLabel(oldLabel) {
+			oldLabel = ""
+		}
+		if err := r.g.ReplaceLabel(ctx, r.pr.Number, oldLabel, newLabel); err != nil {
+			return err
+		}
+		r.issue.IsDryRun = dryRun
+		return nil
+	})
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) SwitchToDryRun(ctx context.Context) error {
+	return r.setMode(ctx, "switch the pull request to dry run", true, false)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) SwitchToNormal(ctx context.Context) error {
+	return r.setMode(ctx, "switch the pull request out of dry run", false, false)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) RetryCQ(ctx context.Context) error {
+	return r.setMode(ctx, "retry the checks", false, true)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) RetryDryRun(ctx context.Context) error {
+	return r.setMode(ctx, "retry the checks (dry run)", true, true)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IssueID() string {
+	return fmt.Sprintf("%d", r.issue.Issue)
+}
+
+// See documentation for state_machine.RollCLImpl interface.
+func (r *giteaRoll) IssueURL() string {
+	return r.issueUrl
+}
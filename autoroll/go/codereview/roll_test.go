@@ -20,7 +20,11 @@ import (
 	"go.skia.org/infra/go/ds/testutil"
 	"go.skia.org/infra/go/gerrit"
 	gerrit_testutils "go.skia.org/infra/go/gerrit/testutils"
+	"go.skia.org/infra/go/gitea"
+	gitea_testutils "go.skia.org/infra/go/gitea/testutils"
 	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/gitlab"
+	gitlab_testutils "go.skia.org/infra/go/gitlab/testutils"
 	"go.skia.org/infra/go/mockhttpclient"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/testutils/unittest"
@@ -50,6 +54,7 @@ Tbr: some-sheriff
 		Owner: &gerrit.Owner{
 			Email: "fake-deps-roller@chromium.org",
 		},
+		Branch:  "master",
 		Project: "skia",
 		Revisions: map[string]*gerrit.Revision{
 			"1": rev,
@@ -184,7 +189,17 @@ func testGerritRoll(t *testing.T, cfg *GerritConfig) {
 	if cfg.CanQueryTrybots() {
 		g.MockGetTrybotResults(ci, 1, nil)
 	}
+	// The change landed as a merge commit.
+	g.MockGetMergedRevision(ci, &gerrit.CommitInfo{
+		Commit: "merged",
+		Parents: []*gerrit.CommitInfo{
+			{Commit: "base"},
+			{Commit: "2"},
+		},
+	})
 	require.NoError(t, gr.Update(ctx))
+	g.AssertEmpty()
+	require.Equal(t, "merged", issue.LandedRevision)
 	require.False(t, issue.IsDryRun)
 	require.True(t, gr.IsFinished())
 	require.True(t, gr.IsSuccess())
@@ -473,6 +488,7 @@ func testUpdateFromGerritChangeInfo(t *testing.T, cfg *gerrit.Config) {
 	expect.Committed = false
 	expect.CqFinished = true // Not really, but the CL is finished.
 	expect.CqSuccess = false
+	expect.LandedRevision = ""
 	expect.Result = autoroll.ROLL_RESULT_FAILURE
 	require.NoError(t, updateIssueFromGerritChangeInfo(a, ci, cfg))
 	deepequal.AssertDeepEqual(t, expect, a)
@@ -548,6 +564,7 @@ func testUpdateFromGerritChangeInfo(t *testing.T, cfg *gerrit.Config) {
 	expect.CqFinished = false
 	expect.CqSuccess = false
 	expect.DryRunSuccess = true
+	expect.LandedRevision = ""
 	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_SUCCESS
 	expect.TryResults[0].Result = autoroll.TRYBOT_RESULT_SUCCESS
 	expect.TryResults[0].Status = autoroll.TRYBOT_STATUS_COMPLETED
@@ -627,9 +644,11 @@ func TestUpdateFromGitHubPullRequest(t *testing.T) {
 
 	// CQ succeeded.
 	pr.Merged = boolPtr(true)
+	pr.MergeCommitSHA = stringPtr("abc123merged")
 	expect.Closed = true
 	expect.Committed = true
 	expect.CqSuccess = true
+	expect.LandedRevision = "abc123merged"
 	expect.Result = autoroll.ROLL_RESULT_SUCCESS
 	require.NoError(t, updateIssueFromGitHubPullRequest(a, pr))
 	deepequal.AssertDeepEqual(t, expect, a)
@@ -639,6 +658,7 @@ func TestUpdateFromGitHubPullRequest(t *testing.T) {
 
 	// Dry run active.
 	pr.Merged = boolPtr(false)
+	pr.MergeCommitSHA = nil
 	pr.State = stringPtr("")
 	expect.TryResults = []*autoroll.TryResult{
 		{
@@ -649,6 +669,7 @@ func TestUpdateFromGitHubPullRequest(t *testing.T) {
 	}
 	expect.Closed = false
 	expect.Committed = false
+	expect.LandedRevision = ""
 	expect.CqFinished = false
 	expect.CqSuccess = false
 	expect.IsDryRun = true
@@ -699,3 +720,528 @@ func TestUpdateFromGitHubPullRequest(t *testing.T) {
 	require.NoError(t, updateIssueFromGitHubPullRequest(a, pr))
 	deepequal.AssertDeepEqual(t, expect, a)
 }
+
+func TestUpdateFromGitLabMergeRequest(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Now()
+	a := &autoroll.AutoRollIssue{
+		Issue:       123,
+		RollingFrom: "abc123",
+		RollingTo:   "def456",
+	}
+
+	// Ensure that we don't overwrite the issue number.
+	require.EqualError(t, updateIssueFromGitLabMergeRequest(a, &gitlab.MergeRequest{}), "Merge request IID 0 differs from existing issue number 123!")
+
+	// Normal, in-progress roll with no pipeline yet.
+	mr := &gitlab.MergeRequest{
+		IID:         123,
+		Title:       "roll the deps",
+		State:       gitlab.MERGE_REQUEST_STATE_OPENED,
+		MergeStatus: gitlab.MERGE_STATUS_CAN_BE_MERGED,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	expect := &autoroll.AutoRollIssue{
+		Created:     now,
+		Issue:       123,
+		Modified:    now,
+		Result:      autoroll.ROLL_RESULT_IN_PROGRESS,
+		RollingFrom: "abc123",
+		RollingTo:   "def456",
+		Subject:     "roll the deps",
+	}
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Pipeline running.
+	mr.HeadPipeline = &gitlab.Pipeline{
+		ID:     1,
+		Status: gitlab.PIPELINE_STATUS_RUNNING,
+	}
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Pipeline succeeded; the roll isn't finished until it's merged.
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_SUCCESS
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Pipeline failed.
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_FAILED
+	expect.CqFinished = true
+	expect.Result = autoroll.ROLL_RESULT_FAILURE
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Merge conflict.
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_RUNNING
+	mr.MergeStatus = gitlab.MERGE_STATUS_CANNOT_BE_MERGED
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Merged.
+	mr.MergeStatus = gitlab.MERGE_STATUS_CAN_BE_MERGED
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_SUCCESS
+	mr.State = gitlab.MERGE_REQUEST_STATE_MERGED
+	expect.Closed = true
+	expect.Committed = true
+	expect.CqSuccess = true
+	expect.Result = autoroll.ROLL_RESULT_SUCCESS
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Closed.
+	mr.State = gitlab.MERGE_REQUEST_STATE_CLOSED
+	expect.Committed = false
+	expect.CqSuccess = false
+	expect.Result = autoroll.ROLL_RESULT_FAILURE
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Dry run active.
+	a.IsDryRun = true
+	mr.State = gitlab.MERGE_REQUEST_STATE_OPENED
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_RUNNING
+	expect.IsDryRun = true
+	expect.Closed = false
+	expect.CqFinished = false
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_IN_PROGRESS
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Dry run failed.
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_CANCELED
+	expect.DryRunFinished = true
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_FAILURE
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Dry run succeeded.
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_SUCCESS
+	expect.DryRunSuccess = true
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_SUCCESS
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Roll was closed while the dry run was still running.
+	mr.HeadPipeline.Status = gitlab.PIPELINE_STATUS_RUNNING
+	mr.State = gitlab.MERGE_REQUEST_STATE_CLOSED
+	expect.Closed = true
+	expect.DryRunSuccess = false
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_FAILURE
+	require.NoError(t, updateIssueFromGitLabMergeRequest(a, mr))
+	deepequal.AssertDeepEqual(t, expect, a)
+}
+
+func TestGiteaChecksResult(t *testing.T) {
+	unittest.SmallTest(t)
+
+	tr := func(builder, status, result string) *autoroll.TryResult {
+		return &autoroll.TryResult{
+			Builder:  builder,
+			Category: autoroll.TRYBOT_CATEGORY_CQ,
+			Status:   status,
+			Result:   result,
+		}
+	}
+	test := func(tryResults []*autoroll.TryResult, required []string, expectFinished, expectSuccess bool) {
+		finished, success := giteaChecksResult(tryResults, required)
+		require.Equal(t, expectFinished, finished)
+		require.Equal(t, expectSuccess, success)
+	}
+	running := tr("a", autoroll.TRYBOT_STATUS_STARTED, "")
+	succeeded := tr("b", autoroll.TRYBOT_STATUS_COMPLETED, autoroll.TRYBOT_RESULT_SUCCESS)
+	failed := tr("c", autoroll.TRYBOT_STATUS_COMPLETED, autoroll.TRYBOT_RESULT_FAILURE)
+
+	// At least one check is required.
+	test(nil, nil, false, false)
+	test([]*autoroll.TryResult{running}, nil, false, false)
+	test([]*autoroll.TryResult{running, succeeded}, nil, false, false)
+	test([]*autoroll.TryResult{succeeded}, nil, true, true)
+
+	// Any failure fails the checks immediately.
+	test([]*autoroll.TryResult{running, failed}, nil, true, false)
+	test([]*autoroll.TryResult{failed}, []string{"a"}, true, false)
+
+	// Wait for required checks.
+	test([]*autoroll.TryResult{succeeded}, []string{"a", "b"}, false, false)
+	test([]*autoroll.TryResult{succeeded}, []string{"b"}, true, true)
+}
+
+func TestUpdateFromGiteaPullRequest(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Now()
+	a := &autoroll.AutoRollIssue{
+		Issue:       123,
+		RollingFrom: "abc123",
+		RollingTo:   "def456",
+	}
+
+	// Ensure that we don't overwrite the issue number.
+	require.EqualError(t, updateIssueFromGiteaPullRequest(a, &gitea.PullRequest{}, false, false), "Pull request number 0 differs from existing issue number 123!")
+
+	// Normal, in-progress roll.
+	pr := &gitea.PullRequest{
+		Number:    123,
+		Title:     "roll the deps",
+		State:     gitea.PULL_REQUEST_STATE_OPEN,
+		Mergeable: true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, false, false))
+	expect := &autoroll.AutoRollIssue{
+		Created:     now,
+		Issue:       123,
+		Modified:    now,
+		Result:      autoroll.ROLL_RESULT_IN_PROGRESS,
+		RollingFrom: "abc123",
+		RollingTo:   "def456",
+		Subject:     "roll the deps",
+	}
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Checks succeeded; the roll isn't finished until it's merged.
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, true, true))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Checks failed.
+	expect.CqFinished = true
+	expect.Result = autoroll.ROLL_RESULT_FAILURE
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, true, false))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Gitea hasn't finished checking whether the pull request can be
+	// merged.
+	pr.Mergeable = false
+	expect.CqFinished = false
+	expect.Result = autoroll.ROLL_RESULT_IN_PROGRESS
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, false, false))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Merge conflict.
+	pr.UpdatedAt = now.Add(-giteaMergeableCheckPeriod)
+	expect.CqFinished = true
+	expect.Modified = pr.UpdatedAt
+	expect.Result = autoroll.ROLL_RESULT_FAILURE
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, false, false))
+	deepequal.AssertDeepEqual(t, expect, a)
+	pr.UpdatedAt = now
+	expect.Modified = now
+
+	// Merged.
+	pr.Merged = true
+	pr.State = gitea.PULL_REQUEST_STATE_CLOSED
+	expect.Closed = true
+	expect.Committed = true
+	expect.CqSuccess = true
+	expect.Result = autoroll.ROLL_RESULT_SUCCESS
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, true, true))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Dry run active.
+	a.IsDryRun = true
+	pr.Merged = false
+	pr.Mergeable = true
+	pr.State = gitea.PULL_REQUEST_STATE_OPEN
+	expect.IsDryRun = true
+	expect.Closed = false
+	expect.Committed = false
+	expect.CqFinished = false
+	expect.CqSuccess = false
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_IN_PROGRESS
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, false, false))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Dry run failed.
+	expect.DryRunFinished = true
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_FAILURE
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, true, false))
+	deepequal.AssertDeepEqual(t, expect, a)
+
+	// Dry run succeeded.
+	expect.DryRunSuccess = true
+	expect.Result = autoroll.ROLL_RESULT_DRY_RUN_SUCCESS
+	require.NoError(t, updateIssueFromGiteaPullRequest(a, pr, true, true))
+	deepequal.AssertDeepEqual(t, expect, a)
+}
+
+func TestGitLabRoll(t *testing.T) {
+	unittest.LargeTest(t)
+
+	testutil.InitDatastore(t, ds.KIND_AUTOROLL_ROLL)
+	ctx := context.Background()
+	recent, err := recent_rolls.NewRecentRolls(ctx, "test-roller")
+	require.NoError(t, err)
+
+	f := gitlab_testutils.NewFakeGitLab(t, "my-group/my-project")
+	defer f.Close()
+	cfg := &GitLabConfig{
+		URL:             f.Server.URL,
+		Project:         "my-group/my-project",
+		CommitLabel:     "autoroller: commit",
+		DryRunLabel:     "autoroller: dryrun",
+		TriggerPipeline: true,
+	}
+	cr, err := cfg.Init(nil, nil, http.DefaultClient)
+	require.NoError(t, err)
+
+	// Upload a dry run.
+	toRev := &revision.Revision{
+		Id: "fghij67890fghij67890fghij67890fghij67890",
+	}
+	num, err := cr.(RollUploader).UploadRoll(ctx, "roll_branch", "master", "Roll child\n\nblah blah", true)
+	require.NoError(t, err)
+	issue := &autoroll.AutoRollIssue{
+		IsDryRun:    true,
+		Issue:       num,
+		RollingFrom: "abcde12345abcde12345abcde12345abcde12345",
+		RollingTo:   toRev.Id,
+	}
+	roll, err := cr.RetrieveRoll(ctx, issue, recent, toRev, nil)
+	require.NoError(t, err)
+	require.NoError(t, roll.InsertIntoDB(ctx))
+	require.Equal(t, fmt.Sprintf("%s/my-group/my-project/-/merge_requests/%d", f.Server.URL, num), roll.IssueURL())
+	require.False(t, roll.IsDryRunFinished())
+	require.Equal(t, "Roll child", issue.Subject)
+	mr := f.MergeRequest(num)
+	require.Equal(t, []string{"autoroller: dryrun"}, mr.Labels)
+	require.Equal(t, "blah blah", mr.Description)
+	require.Equal(t, gitlab.PIPELINE_STATUS_CREATED, mr.HeadPipeline.Status)
+
+	// The dry run succeeds.
+	f.SetPipelineStatus(num, gitlab.PIPELINE_STATUS_SUCCESS, &gitlab.Job{
+		ID:     5,
+		Name:   "build",
+		Status: gitlab.PIPELINE_STATUS_SUCCESS,
+		WebURL: "http://job/5",
+	})
+	require.NoError(t, roll.Update(ctx))
+	require.True(t, roll.IsDryRunFinished())
+	require.True(t, roll.IsDryRunSuccess())
+	require.Len(t, issue.TryResults, 1)
+	require.Equal(t, "build #5", issue.TryResults[0].Builder)
+	require.True(t, issue.TryResults[0].Succeeded())
+	require.Equal(t, gitlab.MERGE_REQUEST_STATE_OPENED, f.MergeRequest(num).State)
+
+	// Switch to normal mode; the roll lands because its pipeline has
+	// already succeeded.
+	require.NoError(t, roll.SwitchToNormal(ctx))
+	require.Equal(t, []string{"autoroller: commit"}, f.MergeRequest(num).Labels)
+	require.True(t, roll.IsFinished())
+	require.True(t, roll.IsSuccess())
+	require.True(t, roll.IsClosed())
+	require.Equal(t, gitlab.MERGE_REQUEST_STATE_MERGED, f.MergeRequest(num).State)
+	r, err := recent.Get(ctx, num)
+	require.NoError(t, err)
+	require.Equal(t, autoroll.ROLL_RESULT_SUCCESS, r.Result)
+
+	// Upload a second roll, which fails its pipeline.
+	num, err = cr.(RollUploader).UploadRoll(ctx, "roll_branch", "master", "Roll child again", false)
+	require.NoError(t, err)
+	issue = &autoroll.AutoRollIssue{
+		Issue:       num,
+		RollingFrom: toRev.Id,
+		RollingTo:   toRev.Id,
+	}
+	roll, err = cr.RetrieveRoll(ctx, issue, recent, toRev, nil)
+	require.NoError(t, err)
+	require.NoError(t, roll.InsertIntoDB(ctx))
+	require.False(t, roll.IsFinished())
+	f.SetPipelineStatus(num, gitlab.PIPELINE_STATUS_FAILED)
+	require.NoError(t, roll.Update(ctx))
+	require.True(t, roll.IsFinished())
+	require.False(t, roll.IsSuccess())
+	require.False(t, roll.IsClosed())
+
+	// Retrying the CQ triggers a new pipeline.
+	failedPipeline := f.MergeRequest(num).HeadPipeline.ID
+	require.NoError(t, roll.RetryCQ(ctx))
+	require.NotEqual(t, failedPipeline, f.MergeRequest(num).HeadPipeline.ID)
+	require.False(t, roll.IsFinished())
+
+	// Close the roll.
+	require.NoError(t, roll.AddComment(ctx, "hello"))
+	require.NoError(t, roll.Close(ctx, autoroll.ROLL_RESULT_FAILURE, "Closing"))
+	require.True(t, roll.IsClosed())
+	require.Equal(t, gitlab.MERGE_REQUEST_STATE_CLOSED, f.MergeRequest(num).State)
+	require.Equal(t, []string{"hello", "Closing"}, f.Notes(num))
+	r, err = recent.Get(ctx, num)
+	require.NoError(t, err)
+	require.Equal(t, autoroll.ROLL_RESULT_FAILURE, r.Result)
+}
+
+func TestUpdateIssueFromGiteaNewPullRequest(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	f := gitea_testutils.NewFakeGitea(t, "me", "my-repo")
+	defer f.Close()
+	cfg := &GiteaConfig{
+		URL:            f.Server.URL,
+		RepoOwner:      "me",
+		RepoName:       "my-repo",
+		CommitLabel:    "autoroller: commit",
+		DryRunLabel:    "autoroller: dryrun",
+		RequiredChecks: []string{"ci/build"},
+	}
+	newPullRequest := func() *autoroll.AutoRollIssue {
+		pr, err := f.Gitea.CreatePullRequest(ctx, fmt.Sprintf("roll_%d", time.Now().UnixNano()), "master", "Roll child", "", nil)
+		require.NoError(t, err)
+		f.SetStatuses(pr.Number, &gitea.Status{
+			ID:      1,
+			Context: "ci/build",
+			Status:  gitea.STATUS_SUCCESS,
+		})
+		// Gitea hasn't checked whether the new pull request can be
+		// merged yet.
+		f.SetMergeable(pr.Number, false)
+		return &autoroll.AutoRollIssue{
+			Issue:       pr.Number,
+			RollingFrom: "abc123",
+			RollingTo:   "def456",
+		}
+	}
+
+	// The checks passed, but the pull request isn't merged until Gitea
+	// finds that it can be.
+	a := newPullRequest()
+	_, err := updateIssueFromGitea(ctx, cfg, a, f.Gitea)
+	require.NoError(t, err)
+	require.False(t, a.CqFinished)
+	require.False(t, a.Closed)
+	require.Equal(t, autoroll.ROLL_RESULT_IN_PROGRESS, a.Result)
+	require.False(t, f.PullRequest(a.Issue).Merged)
+	f.SetMergeable(a.Issue, true)
+	_, err = updateIssueFromGitea(ctx, cfg, a, f.Gitea)
+	require.NoError(t, err)
+	require.True(t, f.PullRequest(a.Issue).Merged)
+	require.True(t, a.CqSuccess)
+	require.Equal(t, autoroll.ROLL_RESULT_SUCCESS, a.Result)
+
+	// If the pull request still can't be merged after the check period,
+	// it has a conflict.
+	oldPeriod := giteaMergeableCheckPeriod
+	defer func() {
+		giteaMergeableCheckPeriod = oldPeriod
+	}()
+	giteaMergeableCheckPeriod = 0
+	a = newPullRequest()
+	_, err = updateIssueFromGitea(ctx, cfg, a, f.Gitea)
+	require.NoError(t, err)
+	require.True(t, a.CqFinished)
+	require.False(t, a.CqSuccess)
+	require.Equal(t, autoroll.ROLL_RESULT_FAILURE, a.Result)
+}
+
+func TestGiteaRoll(t *testing.T) {
+	unittest.LargeTest(t)
+
+	testutil.InitDatastore(t, ds.KIND_AUTOROLL_ROLL)
+	ctx := context.Background()
+	recent, err := recent_rolls.NewRecentRolls(ctx, "test-roller")
+	require.NoError(t, err)
+
+	f := gitea_testutils.NewFakeGitea(t, "me", "my-repo", "autoroller: commit", "autoroller: dryrun")
+	defer f.Close()
+	cfg := &GiteaConfig{
+		URL:            f.Server.URL,
+		RepoOwner:      "me",
+		RepoName:       "my-repo",
+		CommitLabel:    "autoroller: commit",
+		DryRunLabel:    "autoroller: dryrun",
+		RequiredChecks: []string{"ci/build", "ci/test"},
+	}
+	cr, err := cfg.Init(nil, nil, http.DefaultClient)
+	require.NoError(t, err)
+
+	// Upload a roll.
+	toRev := &revision.Revision{
+		Id: "fghij67890fghij67890fghij67890fghij67890",
+	}
+	num, err := cr.(RollUploader).UploadRoll(ctx, "roll_branch", "master", "Roll child\n\nblah blah", false)
+	require.NoError(t, err)
+	issue := &autoroll.AutoRollIssue{
+		Issue:       num,
+		RollingFrom: "abcde12345abcde12345abcde12345abcde12345",
+		RollingTo:   toRev.Id,
+	}
+	roll, err := cr.RetrieveRoll(ctx, issue, recent, toRev, nil)
+	require.NoError(t, err)
+	require.NoError(t, roll.InsertIntoDB(ctx))
+	require.Equal(t, fmt.Sprintf("%s/me/my-repo/pulls/%d", f.Server.URL, num), roll.IssueURL())
+	require.True(t, f.PullRequest(num).HasLabel("autoroller: commit"))
+	require.False(t, roll.IsFinished())
+
+	// One required check hasn't reported yet.
+	f.SetStatuses(num, &gitea.Status{
+		ID:      1,
+		Context: "ci/build",
+		Status:  gitea.STATUS_SUCCESS,
+	})
+	require.NoError(t, roll.Update(ctx))
+	require.False(t, roll.IsFinished())
+
+	// A check fails.
+	f.SetStatuses(num, &gitea.Status{
+		ID:      1,
+		Context: "ci/build",
+		Status:  gitea.STATUS_SUCCESS,
+	}, &gitea.Status{
+		ID:      2,
+		Context: "ci/test",
+		Status:  gitea.STATUS_FAILURE,
+	})
+	require.NoError(t, roll.Update(ctx))
+	require.True(t, roll.IsFinished())
+	require.False(t, roll.IsSuccess())
+	require.False(t, roll.IsClosed())
+
+	// Switch to dry run and retry; the dry run succeeds.
+	require.NoError(t, roll.SwitchToDryRun(ctx))
+	pr := f.PullRequest(num)
+	require.True(t, pr.HasLabel("autoroller: dryrun"))
+	require.False(t, pr.HasLabel("autoroller: commit"))
+	f.SetStatuses(num, &gitea.Status{
+		ID:      1,
+		Context: "ci/build",
+		Status:  gitea.STATUS_SUCCESS,
+	}, &gitea.Status{
+		ID:      3,
+		Context: "ci/test",
+		Status:  gitea.STATUS_SUCCESS,
+	})
+	require.NoError(t, roll.RetryDryRun(ctx))
+	require.True(t, roll.IsDryRunFinished())
+	require.True(t, roll.IsDryRunSuccess())
+	require.False(t, f.PullRequest(num).Merged)
+
+	// Switch back to normal mode; the roll lands.
+	require.NoError(t, roll.SwitchToNormal(ctx))
+	require.True(t, roll.IsFinished())
+	require.True(t, roll.IsSuccess())
+	require.True(t, f.PullRequest(num).Merged)
+	r, err := recent.Get(ctx, num)
+	require.NoError(t, err)
+	require.Equal(t, autoroll.ROLL_RESULT_SUCCESS, r.Result)
+
+	// Upload and close a second roll.
+	num, err = cr.(RollUploader).UploadRoll(ctx, "roll_branch", "master", "Roll child again", true)
+	require.NoError(t, err)
+	issue = &autoroll.AutoRollIssue{
+		IsDryRun:    true,
+		Issue:       num,
+		RollingFrom: toRev.Id,
+		RollingTo:   toRev.Id,
+	}
+	roll, err = cr.RetrieveRoll(ctx, issue, recent, toRev, nil)
+	require.NoError(t, err)
+	require.NoError(t, roll.InsertIntoDB(ctx))
+	require.NoError(t, roll.Close(ctx, autoroll.ROLL_RESULT_DRY_RUN_FAILURE, "Closing"))
+	require.True(t, roll.IsClosed())
+	require.Equal(t, gitea.PULL_REQUEST_STATE_CLOSED, f.PullRequest(num).State)
+	require.Equal(t, []string{"Closing"}, f.Comments(num))
+}
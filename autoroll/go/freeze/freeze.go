@@ -0,0 +1,95 @@
+package freeze
+
+/*
+	Freezes block all rollers in a group from uploading rolls until a given
+	time, eg. during a release or an outage of the parent repo's CQ.
+*/
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"go.skia.org/infra/go/ds"
+)
+
+// Freeze is a struct representing a freeze of a group of rollers.
+type Freeze struct {
+	Group   string    `datastore:"group" json:"group"`
+	Message string    `datastore:"message,noindex" json:"message"`
+	Time    time.Time `datastore:"time,noindex" json:"time"`
+	Until   time.Time `datastore:"until,noindex" json:"until"`
+	User    string    `datastore:"user,noindex" json:"user"`
+}
+
+// Active returns true iff the Freeze is in effect at the given time.
+func (f *Freeze) Active(now time.Time) bool {
+	return f != nil && now.Before(f.Until)
+}
+
+// Fake ancestor we supply for all Freezes, to force consistency.
+// We lose some performance this way but it keeps our tests from
+// flaking.
+func fakeAncestor() *datastore.Key {
+	rv := ds.NewKey(ds.KIND_AUTOROLL_FREEZE_ANCESTOR)
+	rv.ID = 13 // Bogus ID.
+	return rv
+}
+
+// Return a datastore key for the given group.
+func key(group string) *datastore.Key {
+	k := ds.NewKey(ds.KIND_AUTOROLL_FREEZE)
+	k.Parent = fakeAncestor()
+	k.Name = group
+	return k
+}
+
+// Set freezes all rollers in the given group until the given time, replacing
+// any existing Freeze of the group.
+func Set(ctx context.Context, group string, until time.Time, user, message string) error {
+	if group == "" {
+		return errors.New("Group is required.")
+	}
+	if message == "" {
+		return errors.New("Message is required.")
+	}
+	f := &Freeze{
+		Group:   group,
+		Message: message,
+		Time:    time.Now(),
+		Until:   until,
+		User:    user,
+	}
+	_, err := ds.DS.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		_, err := tx.Put(key(group), f)
+		return err
+	})
+	return err
+}
+
+// Clear removes any Freeze of the given group.
+func Clear(ctx context.Context, group string) error {
+	_, err := ds.DS.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return tx.Delete(key(group))
+	})
+	return err
+}
+
+// Get returns the Freeze of the given group, or nil if the group is not frozen.
+// The returned Freeze may have expired; use Active to check.
+func Get(ctx context.Context, group string) (*Freeze, error) {
+	if group == "" {
+		return nil, nil
+	}
+	var f Freeze
+	_, err := ds.DS.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return tx.Get(key(group), &f)
+	})
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,51 @@
+package freeze
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/ds"
+	"go.skia.org/infra/go/ds/testutil"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestFreeze(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx := context.Background()
+	testutil.InitDatastore(t, ds.KIND_AUTOROLL_FREEZE)
+
+	// No entry exists; ensure that we return nil and no error.
+	f, err := Get(ctx, "chromium")
+	require.NoError(t, err)
+	require.Nil(t, f)
+	require.False(t, f.Active(time.Now()))
+
+	// Freeze the group.
+	until := time.Now().Add(time.Hour).Round(time.Second).UTC()
+	require.NoError(t, Set(ctx, "chromium", until, "me@google.com", "Branch day"))
+	f, err = Get(ctx, "chromium")
+	require.NoError(t, err)
+	require.Equal(t, "chromium", f.Group)
+	require.Equal(t, "Branch day", f.Message)
+	require.Equal(t, "me@google.com", f.User)
+	require.True(t, until.Equal(f.Until))
+	require.True(t, f.Active(time.Now()))
+	require.False(t, f.Active(until))
+
+	// Other groups are not frozen.
+	f, err = Get(ctx, "android")
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	// Unfreeze.
+	require.NoError(t, Clear(ctx, "chromium"))
+	f, err = Get(ctx, "chromium")
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	require.EqualError(t, Set(ctx, "", until, "me@google.com", "Branch day"), "Group is required.")
+	require.EqualError(t, Set(ctx, "chromium", until, "me@google.com", ""), "Message is required.")
+}
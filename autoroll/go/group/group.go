@@ -0,0 +1,274 @@
+package group
+
+/*
+	Roller groups share a mode and a time window, and may optionally roll
+	atomically: each roller in the group uploads a roll to the same child
+	revision, and the rolls are only submitted once all of their dry runs
+	have passed.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"go.skia.org/infra/autoroll/go/time_window"
+	"go.skia.org/infra/go/ds"
+	"go.skia.org/infra/go/human"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// Prefix used to store the shared mode of a group alongside the modes
+	// of individual rollers.
+	MODE_KEY_PREFIX = "group:"
+
+	// Default period after which an atomic roll which has not landed in
+	// every roller is abandoned.
+	DEFAULT_ATOMIC_TIMEOUT = 24 * time.Hour
+)
+
+// Config provides configuration for a group of rollers. Each roller in the
+// group must have an identical Config.
+type Config struct {
+	// Names of all of the rollers in the group.
+	Rollers []string `json:"rollers"`
+	// If true, the rollers in the group roll atomically: rolls to the same
+	// child revision are uploaded by all of the rollers as dry runs, and
+	// they are only submitted once all of the dry runs have passed. The
+	// rollers in an atomic group must roll the same child repo. Note that
+	// the parent repos are distinct, so a roll which fails in the commit
+	// queue after the others have landed cannot be undone automatically.
+	Atomic bool `json:"atomic,omitempty"`
+	// How long an atomic roll may remain unfinished before it is abandoned
+	// and the group chooses a new revision, eg. "12h". Defaults to
+	// DEFAULT_ATOMIC_TIMEOUT.
+	AtomicTimeout string `json:"atomicTimeout,omitempty"`
+	// Time window shared by all rollers in the group, in addition to each
+	// roller's own TimeWindow. See time_window.Parse for the format.
+	TimeWindow string `json:"timeWindow,omitempty"`
+	// Timezone in which TimeWindow is interpreted, eg.
+	// "America/Los_Angeles". Defaults to UTC.
+	TimeWindowTimezone string `json:"timeWindowTimezone,omitempty"`
+}
+
+// Validate the Config.
+func (c *Config) Validate() error {
+	if len(c.Rollers) == 0 {
+		return errors.New("At least one roller is required.")
+	}
+	seen := make(map[string]bool, len(c.Rollers))
+	for _, r := range c.Rollers {
+		if r == "" {
+			return errors.New("Roller names must not be empty.")
+		}
+		if seen[r] {
+			return fmt.Errorf("Roller %q is listed more than once.", r)
+		}
+		seen[r] = true
+	}
+	if c.AtomicTimeout != "" {
+		if !c.Atomic {
+			return errors.New("AtomicTimeout is only valid for atomic groups.")
+		}
+		if _, err := human.ParseDuration(c.AtomicTimeout); err != nil {
+			return fmt.Errorf("Invalid AtomicTimeout: %s", err)
+		}
+	}
+	loc, err := c.TimeWindowLocation()
+	if err != nil {
+		return err
+	}
+	_, err = time_window.ParseInLocation(c.TimeWindow, loc)
+	return err
+}
+
+// GetAtomicTimeout returns the AtomicTimeout as a time.Duration.
+func (c *Config) GetAtomicTimeout() time.Duration {
+	if c.AtomicTimeout == "" {
+		return DEFAULT_ATOMIC_TIMEOUT
+	}
+	// Validate ensures that this succeeds.
+	rv, _ := human.ParseDuration(c.AtomicTimeout)
+	return rv
+}
+
+// TimeWindowLocation returns the location in which the TimeWindow is
+// interpreted.
+func (c *Config) TimeWindowLocation() (*time.Location, error) {
+	if c.TimeWindowTimezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.TimeWindowTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid TimeWindowTimezone %q: %s", c.TimeWindowTimezone, err)
+	}
+	return loc, nil
+}
+
+// ModeKey returns the name under which the shared mode of the given group is
+// stored by the modes package. Modes for the group are obtained using
+// modes.NewModeHistory(ctx, ModeKey(group)).
+func ModeKey(group string) string {
+	return MODE_KEY_PREFIX + group
+}
+
+// AtomicRoll tracks the progress of an atomic roll of a group of rollers to a
+// single child revision.
+type AtomicRoll struct {
+	Group string `datastore:"group" json:"group"`
+	// Child revision to which all rollers in the group are rolling, and
+	// its timestamp.
+	Revision     string    `datastore:"revision,noindex" json:"revision"`
+	RevisionTime time.Time `datastore:"revisionTime,noindex" json:"revisionTime"`
+	// Rollers whose dry run of the roll to Revision has passed.
+	Ready []string `datastore:"ready,noindex" json:"ready"`
+	// Rollers which have rolled to or past Revision.
+	Landed []string `datastore:"landed,noindex" json:"landed"`
+	// Time at which Revision was chosen.
+	Time time.Time `datastore:"time,noindex" json:"time"`
+}
+
+// Copy returns a copy of the AtomicRoll.
+func (a *AtomicRoll) Copy() *AtomicRoll {
+	return &AtomicRoll{
+		Group:        a.Group,
+		Revision:     a.Revision,
+		RevisionTime: a.RevisionTime,
+		Ready:        util.CopyStringSlice(a.Ready),
+		Landed:       util.CopyStringSlice(a.Landed),
+		Time:         a.Time,
+	}
+}
+
+// SetReady records that the given roller's dry run has passed.
+func (a *AtomicRoll) SetReady(roller string) {
+	if !util.In(roller, a.Ready) {
+		a.Ready = append(a.Ready, roller)
+	}
+}
+
+// UnsetReady records that the given roller is no longer ready to submit its
+// roll, eg. because its dry run failed or it is rolling to another revision.
+func (a *AtomicRoll) UnsetReady(roller string) {
+	if !util.In(roller, a.Ready) {
+		return
+	}
+	ready := make([]string, 0, len(a.Ready))
+	for _, r := range a.Ready {
+		if r != roller {
+			ready = append(ready, r)
+		}
+	}
+	a.Ready = ready
+}
+
+// SetLanded records that the given roller has rolled to or past Revision.
+func (a *AtomicRoll) SetLanded(roller string) {
+	if !util.In(roller, a.Landed) {
+		a.Landed = append(a.Landed, roller)
+	}
+}
+
+// CanSubmit returns true iff each of the given rollers is either ready to
+// submit its roll to Revision or has already landed it.
+func (a *AtomicRoll) CanSubmit(rollers []string) bool {
+	if a == nil {
+		return false
+	}
+	for _, r := range rollers {
+		if !util.In(r, a.Ready) && !util.In(r, a.Landed) {
+			return false
+		}
+	}
+	return true
+}
+
+// Expired returns true iff the AtomicRoll was started more than the given
+// timeout before the given time.
+func (a *AtomicRoll) Expired(timeout time.Duration, now time.Time) bool {
+	return a != nil && now.Sub(a.Time) > timeout
+}
+
+// Done returns true iff each of the given rollers has rolled to or past
+// Revision.
+func (a *AtomicRoll) Done(rollers []string) bool {
+	if a == nil {
+		return true
+	}
+	for _, r := range rollers {
+		if !util.In(r, a.Landed) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fake ancestor we supply for all AtomicRolls, to force consistency.
+// We lose some performance this way but it keeps our tests from
+// flaking.
+func fakeAncestor() *datastore.Key {
+	rv := ds.NewKey(ds.KIND_AUTOROLL_ATOMIC_ROLL_ANCESTOR)
+	rv.ID = 13 // Bogus ID.
+	return rv
+}
+
+// Return a datastore key for the given group.
+func key(group string) *datastore.Key {
+	k := ds.NewKey(ds.KIND_AUTOROLL_ATOMIC_ROLL)
+	k.Parent = fakeAncestor()
+	k.Name = group
+	return k
+}
+
+// GetAtomicRoll returns the AtomicRoll of the given group, or nil if there is
+// none.
+func GetAtomicRoll(ctx context.Context, group string) (*AtomicRoll, error) {
+	var a AtomicRoll
+	if err := ds.DS.Get(ctx, key(group), &a); err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// UpdateAtomicRoll atomically updates the AtomicRoll of the given group. The
+// given function is passed a copy of the current AtomicRoll, or nil if there is
+// none, and returns the AtomicRoll to store. If it returns nil, nothing is
+// stored. Returns the resulting AtomicRoll.
+func UpdateAtomicRoll(ctx context.Context, group string, fn func(*AtomicRoll) *AtomicRoll) (*AtomicRoll, error) {
+	if group == "" {
+		return nil, errors.New("Group is required.")
+	}
+	var rv *AtomicRoll
+	_, err := ds.DS.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var current *AtomicRoll
+		var a AtomicRoll
+		if err := tx.Get(key(group), &a); err == nil {
+			current = &a
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		rv = current
+		if current != nil {
+			current = current.Copy()
+		}
+		updated := fn(current)
+		if updated == nil {
+			return nil
+		}
+		updated.Group = group
+		if _, err := tx.Put(key(group), updated); err != nil {
+			return err
+		}
+		rv = updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
@@ -0,0 +1,140 @@
+package group
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/deepequal"
+	"go.skia.org/infra/go/ds"
+	"go.skia.org/infra/go/ds/testutil"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestConfigValidate(t *testing.T) {
+	unittest.SmallTest(t)
+
+	c := &Config{
+		Rollers: []string{"a", "b"},
+	}
+	require.NoError(t, c.Validate())
+	c.TimeWindow = "M-F 09:00-17:00"
+	c.TimeWindowTimezone = "America/New_York"
+	require.NoError(t, c.Validate())
+
+	c.TimeWindow = "bogus"
+	require.Error(t, c.Validate())
+	c.TimeWindow = ""
+	c.TimeWindowTimezone = "Nowhere/Bogus"
+	require.EqualError(t, c.Validate(), "Invalid TimeWindowTimezone \"Nowhere/Bogus\": unknown time zone Nowhere/Bogus")
+	c.TimeWindowTimezone = ""
+
+	c.AtomicTimeout = "12h"
+	require.EqualError(t, c.Validate(), "AtomicTimeout is only valid for atomic groups.")
+	c.Atomic = true
+	require.NoError(t, c.Validate())
+	require.Equal(t, 12*time.Hour, c.GetAtomicTimeout())
+	c.AtomicTimeout = "bogus"
+	require.Error(t, c.Validate())
+	c.AtomicTimeout = ""
+	require.Equal(t, DEFAULT_ATOMIC_TIMEOUT, c.GetAtomicTimeout())
+
+	c.Rollers = []string{"a", "a"}
+	require.EqualError(t, c.Validate(), "Roller \"a\" is listed more than once.")
+	c.Rollers = []string{"a", ""}
+	require.EqualError(t, c.Validate(), "Roller names must not be empty.")
+	c.Rollers = nil
+	require.EqualError(t, c.Validate(), "At least one roller is required.")
+}
+
+func TestAtomicRollStatus(t *testing.T) {
+	unittest.SmallTest(t)
+
+	rollers := []string{"a", "b", "c"}
+	var a *AtomicRoll
+	require.False(t, a.CanSubmit(rollers))
+	require.True(t, a.Done(rollers))
+
+	a = &AtomicRoll{
+		Group:    "g",
+		Revision: "abc123",
+		Time:     time.Now(),
+	}
+	a.SetReady("a")
+	a.SetReady("a")
+	a.SetLanded("b")
+	require.Equal(t, []string{"a"}, a.Ready)
+	require.False(t, a.CanSubmit(rollers))
+	require.False(t, a.Done(rollers))
+	a.SetReady("c")
+	require.True(t, a.CanSubmit(rollers))
+	require.False(t, a.Done(rollers))
+	a.UnsetReady("c")
+	a.UnsetReady("c")
+	require.Equal(t, []string{"a"}, a.Ready)
+	require.False(t, a.CanSubmit(rollers))
+	a.SetReady("c")
+	a.SetLanded("a")
+	a.SetLanded("c")
+	require.True(t, a.Done(rollers))
+
+	a.RevisionTime = time.Now()
+	deepequal.AssertCopy(t, a, a.Copy())
+}
+
+func TestAtomicRollDB(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx := context.Background()
+	testutil.InitDatastore(t, ds.KIND_AUTOROLL_ATOMIC_ROLL)
+
+	// No entry exists; ensure that we return nil and no error.
+	a, err := GetAtomicRoll(ctx, "g")
+	require.NoError(t, err)
+	require.Nil(t, a)
+
+	// Create the AtomicRoll.
+	now := time.Now().Round(time.Second).UTC()
+	a, err = UpdateAtomicRoll(ctx, "g", func(a *AtomicRoll) *AtomicRoll {
+		require.Nil(t, a)
+		return &AtomicRoll{
+			Revision: "abc123",
+			Time:     now,
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, "g", a.Group)
+
+	// Update it.
+	a, err = UpdateAtomicRoll(ctx, "g", func(a *AtomicRoll) *AtomicRoll {
+		require.Equal(t, "abc123", a.Revision)
+		a.SetReady("a")
+		return a
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, a.Ready)
+
+	// Returning nil leaves the AtomicRoll unchanged.
+	a, err = UpdateAtomicRoll(ctx, "g", func(a *AtomicRoll) *AtomicRoll {
+		a.SetReady("b")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, a.Ready)
+	a, err = GetAtomicRoll(ctx, "g")
+	require.NoError(t, err)
+	require.Equal(t, "abc123", a.Revision)
+	require.Equal(t, []string{"a"}, a.Ready)
+	require.True(t, now.Equal(a.Time))
+
+	// Other groups are unaffected.
+	a, err = GetAtomicRoll(ctx, "other")
+	require.NoError(t, err)
+	require.Nil(t, a)
+
+	_, err = UpdateAtomicRoll(ctx, "", func(a *AtomicRoll) *AtomicRoll {
+		return a
+	})
+	require.EqualError(t, err, "Group is required.")
+}
@@ -25,9 +25,10 @@ const (
 	FS_APP = "autoroll"
 
 	// Possible values for ManualRollResult.
-	RESULT_UNKNOWN = ManualRollResult("")
-	RESULT_FAILURE = ManualRollResult("FAILURE")
-	RESULT_SUCCESS = ManualRollResult("SUCCESS")
+	RESULT_UNKNOWN  = ManualRollResult("")
+	RESULT_CANCELED = ManualRollResult("CANCELED")
+	RESULT_FAILURE  = ManualRollResult("FAILURE")
+	RESULT_SUCCESS  = ManualRollResult("SUCCESS")
 
 	// Possible values for ManualRollStatus.
 	STATUS_PENDING  = ManualRollStatus("PENDING")
@@ -49,6 +50,7 @@ var (
 	// All valid results.
 	VALID_RESULTS = []ManualRollResult{
 		RESULT_UNKNOWN,
+		RESULT_CANCELED,
 		RESULT_FAILURE,
 		RESULT_SUCCESS,
 	}
@@ -92,32 +94,63 @@ func (r ManualRollStatus) Validate() error {
 
 // ManualRollRequest represents a request for a manual roll.
 type ManualRollRequest struct {
-	Id         string           `json:"id"`
-	DbModified time.Time        `json:"-"`
+	Id         string    `json:"id"`
+	DbModified time.Time `json:"-"`
+	// ID of another request for the same roller which must complete
+	// successfully before this request is started. If the other request
+	// fails or is canceled, this request is canceled.
+	DependsOn string `json:"dependsOn,omitempty"`
+	// If true, the roll only runs the commit queue dry run and is closed
+	// once the dry run finishes.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Owner of the request, who is added as a reviewer on the roll. If
+	// empty, the Requester is added instead.
+	Owner      string           `json:"owner,omitempty"`
 	Requester  string           `json:"requester"`
 	Result     ManualRollResult `json:"result,omitempty"`
 	Revision   string           `json:"revision"`
 	RollerName string           `json:"rollerName"`
-	Status     ManualRollStatus `json:"status"`
-	Timestamp  time.Time        `json:"timestamp"`
-	Url        string           `json:"url,omitempty"`
+	// If set, the roll is not created before this time.
+	ScheduledTime time.Time        `json:"scheduledTime"`
+	Status        ManualRollStatus `json:"status"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Url           string           `json:"url,omitempty"`
 }
 
 // Return a copy of the ManualRollRequest.
 func (r *ManualRollRequest) Copy() *ManualRollRequest {
 	return &ManualRollRequest{
-		Id:         r.Id,
-		DbModified: r.DbModified,
-		Requester:  r.Requester,
-		Result:     r.Result,
-		Revision:   r.Revision,
-		RollerName: r.RollerName,
-		Status:     r.Status,
-		Timestamp:  r.Timestamp,
-		Url:        r.Url,
+		Id:            r.Id,
+		DbModified:    r.DbModified,
+		DependsOn:     r.DependsOn,
+		DryRun:        r.DryRun,
+		Owner:         r.Owner,
+		Requester:     r.Requester,
+		Result:        r.Result,
+		Revision:      r.Revision,
+		RollerName:    r.RollerName,
+		ScheduledTime: r.ScheduledTime,
+		Status:        r.Status,
+		Timestamp:     r.Timestamp,
+		Url:           r.Url,
 	}
 }
 
+// Reviewer returns the email address which should be added as a reviewer on
+// the roll for this request.
+func (r *ManualRollRequest) Reviewer() string {
+	if r.Owner != "" {
+		return r.Owner
+	}
+	return r.Requester
+}
+
+// IsReady returns true iff the request is pending and its scheduled time, if
+// any, has passed. It does not take DependsOn into account.
+func (r *ManualRollRequest) IsReady(now time.Time) bool {
+	return r.Status == STATUS_PENDING && !now.Before(r.ScheduledTime)
+}
+
 // Validate the ManualRollRequest.
 func (r *ManualRollRequest) Validate() error {
 	if r.Requester == "" {
@@ -139,6 +172,12 @@ func (r *ManualRollRequest) Validate() error {
 	if r.DbModified != firestore.FixTimestamp(r.DbModified) {
 		return errors.New("DbModified must be in UTC and truncated to microsecond precision.")
 	}
+	if r.ScheduledTime != firestore.FixTimestamp(r.ScheduledTime) {
+		return errors.New("ScheduledTime must be in UTC and truncated to microsecond precision.")
+	}
+	if r.DependsOn != "" && r.DependsOn == r.Id {
+		return errors.New("Request cannot depend on itself.")
+	}
 	if r.Status == STATUS_PENDING {
 		if r.Url != "" {
 			return errors.New("Url is invalid for pending requests.")
@@ -147,7 +186,8 @@ func (r *ManualRollRequest) Validate() error {
 			return errors.New("Result is invalid for pending requests.")
 		}
 	} else {
-		if r.Url == "" {
+		// Requests which are canceled before they start have no URL.
+		if r.Url == "" && r.Result != RESULT_CANCELED {
 			return errors.New("Url is required for non-pending requests.")
 		}
 		if r.Status == STATUS_STARTED && r.Result != RESULT_UNKNOWN {
@@ -176,6 +216,10 @@ type DB interface {
 	// Return all incomplete ManualRollRequests for the given roller.
 	GetIncomplete(rollerName string) ([]*ManualRollRequest, error)
 
+	// Return the ManualRollRequest with the given ID, or ErrNotFound if no
+	// such request exists.
+	Get(id string) (*ManualRollRequest, error)
+
 	// Insert the given ManualRollRequest. The DB implementation is
 	// responsible for calling req.Validate(). If the request has an ID,
 	// the existing entry in the DB is updated. Otherwise, a new entry is
@@ -254,6 +298,22 @@ func (d *firestoreDB) GetIncomplete(rollerName string) ([]*ManualRollRequest, er
 	return rv, nil
 }
 
+// See documentation for DB interface.
+func (d *firestoreDB) Get(id string) (*ManualRollRequest, error) {
+	doc, err := d.client.Get(context.TODO(), d.coll.Doc(id), DEFAULT_ATTEMPTS, QUERY_TIMEOUT)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var req ManualRollRequest
+	if err := doc.DataTo(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
 // See documentation for DB interface.
 func (d *firestoreDB) Put(req *ManualRollRequest) (rvErr error) {
 	if err := req.Validate(); err != nil {
@@ -349,6 +409,20 @@ func (d *memoryDB) GetIncomplete(rollerName string) ([]*ManualRollRequest, error
 	return rv, nil
 }
 
+// See documentation for DB interface.
+func (d *memoryDB) Get(id string) (*ManualRollRequest, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	for _, reqs := range d.data {
+		for _, r := range reqs {
+			if r.Id == id {
+				return r.Copy(), nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
 // See documentation for DB interface.
 func (d *memoryDB) Put(req *ManualRollRequest) (rvErr error) {
 	if err := req.Validate(); err != nil {
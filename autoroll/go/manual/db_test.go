@@ -35,6 +35,10 @@ func TestCopyManualRollRequest(t *testing.T) {
 	v := req()
 	v.Id = "abc123"
 	v.DbModified = time.Now()
+	v.DependsOn = "def456"
+	v.DryRun = true
+	v.Owner = "owner@google.com"
+	v.ScheduledTime = time.Now()
 	deepequal.AssertCopy(t, v, v.Copy())
 }
 
@@ -86,6 +90,28 @@ func TestRequestValidation(t *testing.T) {
 	check(r, "Invalid result.")
 	r.Result = RESULT_FAILURE
 
+	// Scheduling and chaining.
+	r.ScheduledTime = firestore.FixTimestamp(time.Now()).Add(time.Nanosecond)
+	check(r, "ScheduledTime must be in UTC and truncated to microsecond precision.")
+	r.ScheduledTime = firestore.FixTimestamp(r.ScheduledTime)
+	check(r, "")
+	r.Id = "abc123"
+	r.DbModified = firestore.FixTimestamp(time.Now())
+	r.DependsOn = r.Id
+	check(r, "Request cannot depend on itself.")
+	r.DependsOn = "def456"
+	check(r, "")
+	r.Id = ""
+	r.DbModified = time.Time{}
+
+	// Canceled requests may not have a URL.
+	r.Url = ""
+	check(r, "Url is required for non-pending requests.")
+	r.Result = RESULT_CANCELED
+	check(r, "")
+	r.Url = "http://my-roll.com"
+	r.Result = RESULT_FAILURE
+
 	// Pending requests have no result or URL.
 	r.Result = RESULT_UNKNOWN
 	r.Status = STATUS_PENDING
@@ -201,6 +227,14 @@ func testDB(t *testing.T, db DB) {
 	require.Equal(t, RESULT_SUCCESS, reqs[3].Result)
 	require.Equal(t, STATUS_COMPLETE, reqs[3].Status)
 
+	// Retrieve a request by ID.
+	got, err := db.Get(id)
+	require.NoError(t, err)
+	require.Equal(t, RESULT_SUCCESS, got.Result)
+	require.Equal(t, reqs[3].DbModified, got.DbModified)
+	_, err = db.Get("bogus")
+	require.EqualError(t, err, ErrNotFound.Error())
+
 	// Test concurrent update.
 	reqs[0].DbModified = now.Add(-10 * time.Minute)
 	oldDbModified = reqs[0].DbModified
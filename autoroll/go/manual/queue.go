@@ -0,0 +1,78 @@
+package manual
+
+import (
+	"sort"
+	"time"
+)
+
+// startTime returns the earliest time at which the request may start.
+func (r *ManualRollRequest) startTime() time.Time {
+	if r.ScheduledTime.After(r.Timestamp) {
+		return r.ScheduledTime
+	}
+	return r.Timestamp
+}
+
+// Queue returns the given incomplete ManualRollRequests in the order in which
+// they will be processed: started requests first, followed by pending requests
+// ordered by the time at which they may start, with each request following the
+// request it depends on. Completed requests are omitted. The given slice is not
+// modified.
+func Queue(reqs []*ManualRollRequest) []*ManualRollRequest {
+	sorted := make([]*ManualRollRequest, 0, len(reqs))
+	byId := make(map[string]*ManualRollRequest, len(reqs))
+	for _, req := range reqs {
+		if req.Status == STATUS_COMPLETE {
+			continue
+		}
+		sorted = append(sorted, req)
+		byId[req.Id] = req
+	}
+
+	// A request may not start before the request it depends on.
+	startTimes := make(map[string]time.Time, len(sorted))
+	var startTime func(*ManualRollRequest, int) time.Time
+	startTime = func(req *ManualRollRequest, depth int) time.Time {
+		if ts, ok := startTimes[req.Id]; ok {
+			return ts
+		}
+		ts := req.startTime()
+		if dep, ok := byId[req.DependsOn]; ok && depth < len(sorted) {
+			if depTs := startTime(dep, depth+1); depTs.After(ts) {
+				ts = depTs
+			}
+		}
+		startTimes[req.Id] = ts
+		return ts
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Status != b.Status {
+			return a.Status == STATUS_STARTED
+		}
+		if tsA, tsB := startTime(a, 0), startTime(b, 0); !tsA.Equal(tsB) {
+			return tsA.Before(tsB)
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	})
+
+	rv := make([]*ManualRollRequest, 0, len(sorted))
+	added := make(map[string]bool, len(sorted))
+	var add func(*ManualRollRequest)
+	add = func(req *ManualRollRequest) {
+		if added[req.Id] {
+			return
+		}
+		// Mark the request before adding its dependency, in case of
+		// cycles.
+		added[req.Id] = true
+		if dep, ok := byId[req.DependsOn]; ok {
+			add(dep)
+		}
+		rv = append(rv, req)
+	}
+	for _, req := range sorted {
+		add(req)
+	}
+	return rv
+}
@@ -0,0 +1,71 @@
+package manual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestQueue(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1574000000, 0).UTC()
+	mk := func(id string, status ManualRollStatus, ts, scheduled time.Time, dependsOn string) *ManualRollRequest {
+		return &ManualRollRequest{
+			Id:            id,
+			DependsOn:     dependsOn,
+			ScheduledTime: scheduled,
+			Status:        status,
+			Timestamp:     ts,
+		}
+	}
+	reqs := []*ManualRollRequest{
+		// Scheduled for later.
+		mk("a", STATUS_PENDING, now, now.Add(time.Hour), ""),
+		// Chained after a request which is scheduled even later.
+		mk("b", STATUS_PENDING, now.Add(time.Minute), time.Time{}, "c"),
+		mk("c", STATUS_PENDING, now.Add(2*time.Minute), now.Add(2*time.Hour), ""),
+		// Ready now.
+		mk("d", STATUS_PENDING, now.Add(3*time.Minute), time.Time{}, ""),
+		mk("e", STATUS_STARTED, now.Add(4*time.Minute), time.Time{}, ""),
+		mk("f", STATUS_COMPLETE, now.Add(-time.Hour), time.Time{}, ""),
+		// Depends on a request which is no longer in the queue.
+		mk("g", STATUS_PENDING, now.Add(-time.Minute), time.Time{}, "f"),
+	}
+	ids := func(reqs []*ManualRollRequest) []string {
+		rv := make([]string, 0, len(reqs))
+		for _, req := range reqs {
+			rv = append(rv, req.Id)
+		}
+		return rv
+	}
+	require.Equal(t, []string{"e", "g", "d", "a", "c", "b"}, ids(Queue(reqs)))
+
+	// The input is not modified.
+	require.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g"}, ids(reqs))
+
+	// Cycles don't cause infinite recursion.
+	reqs = []*ManualRollRequest{
+		mk("a", STATUS_PENDING, now, time.Time{}, "b"),
+		mk("b", STATUS_PENDING, now.Add(time.Minute), time.Time{}, "a"),
+	}
+	require.Equal(t, []string{"b", "a"}, ids(Queue(reqs)))
+
+	require.Empty(t, Queue(nil))
+}
+
+func TestIsReady(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1574000000, 0).UTC()
+	r := req()
+	r.Status = STATUS_PENDING
+	require.True(t, r.IsReady(now))
+	r.ScheduledTime = now.Add(time.Minute)
+	require.False(t, r.IsReady(now))
+	require.True(t, r.IsReady(now.Add(time.Minute)))
+	r.Status = STATUS_STARTED
+	require.False(t, r.IsReady(now.Add(time.Minute)))
+}
@@ -27,6 +27,25 @@ var (
 	}
 )
 
+// MostRestrictive returns the most restrictive of the given modes, where
+// MODE_STOPPED is more restrictive than MODE_DRY_RUN, which is more
+// restrictive than MODE_RUNNING. Empty modes are ignored. Returns the empty
+// string if no non-empty modes are given.
+func MostRestrictive(modes ...string) string {
+	rank := map[string]int{
+		MODE_RUNNING: 1,
+		MODE_DRY_RUN: 2,
+		MODE_STOPPED: 3,
+	}
+	rv := ""
+	for _, m := range modes {
+		if rank[m] > rank[rv] {
+			rv = m
+		}
+	}
+	return rv
+}
+
 // Fake ancestor we supply for all ModeChanges, to force consistency.
 // We lose some performance this way but it keeps our tests from
 // flaking.
@@ -10,6 +10,16 @@ import (
 	"go.skia.org/infra/go/testutils/unittest"
 )
 
+func TestMostRestrictive(t *testing.T) {
+	unittest.SmallTest(t)
+	require.Equal(t, "", MostRestrictive())
+	require.Equal(t, "", MostRestrictive("", "bogus"))
+	require.Equal(t, MODE_RUNNING, MostRestrictive(MODE_RUNNING, ""))
+	require.Equal(t, MODE_DRY_RUN, MostRestrictive(MODE_RUNNING, MODE_DRY_RUN))
+	require.Equal(t, MODE_STOPPED, MostRestrictive(MODE_STOPPED, MODE_DRY_RUN))
+	require.Equal(t, MODE_STOPPED, MostRestrictive(MODE_RUNNING, MODE_STOPPED, MODE_DRY_RUN))
+}
+
 // TestModeHistory verifies that we correctly track mode history.
 func TestModeHistory(t *testing.T) {
 	unittest.LargeTest(t)
@@ -16,6 +16,7 @@ import (
 const (
 	// Types of notification message sent by the roller. These can be
 	// whitelisted in the notifier configs.
+	MSG_TYPE_AUTO_REVERT          = "auto revert"
 	MSG_TYPE_ISSUE_UPDATE         = "issue update"
 	MSG_TYPE_LAST_N_FAILED        = "last n failed"
 	MSG_TYPE_MODE_CHANGE          = "mode change"
@@ -27,6 +28,9 @@ const (
 	MSG_TYPE_SUCCESS_THROTTLE     = "success throttle"
 
 	// Templates for messages sent by the roller.
+	subjectAutoRevert = "The {{.ChildName}} into {{.ParentName}} AutoRoller is reverting a roll (issue {{.IssueID}})"
+	bodyAutoRevert    = "The parent tree was closed after {{.RevertedURL}} landed, with message: {{.Message}}\n\nThe roller uploaded a revert ({{.IssueURL}}) and has been stopped. Resume the roller once the breakage is fixed.\n\nFailing builds:\n{{.Builds}}\n\nSuspected culprits:\n{{.Culprits}}"
+
 	subjectIssueUpdate = "The {{.ChildName}} into {{.ParentName}} AutoRoller has uploaded issue {{.IssueID}}"
 
 	bodyModeChange    = "{{.User}} changed the mode to \"{{.Mode}}\" with message: {{.Message}}"
@@ -55,6 +59,9 @@ const (
 )
 
 var (
+	subjectTmplAutoRevert = template.Must(template.New("subjectAutoRevert").Parse(subjectAutoRevert))
+	bodyTmplAutoRevert    = template.Must(template.New("bodyAutoRevert").Parse(bodyAutoRevert))
+
 	subjectTmplIssueUpdate = template.Must(template.New("subjectIssueUpdate").Parse(subjectIssueUpdate))
 
 	subjectTmplModeChange = template.Must(template.New("subjectModeChange").Parse(subjectModeChange))
@@ -85,13 +92,16 @@ var (
 // tmplVars is a struct which contains information used to fill
 // text templates in the Subject and Body fields of messages.
 type tmplVars struct {
+	Builds         string
 	ChildName      string
+	Culprits       string
 	IssueID        string
 	IssueURL       string
 	Mode           string
 	Message        string
 	N              int
 	ParentName     string
+	RevertedURL    string
 	ServerURL      string
 	Strategy       string
 	ThrottledUntil string
@@ -173,6 +183,19 @@ func (a *AutoRollNotifier) send(ctx context.Context, vars *tmplVars, subjectTmpl
 	}
 }
 
+// Send a notification that the roller uploaded a revert of a roll which is
+// suspected of breaking the parent tree.
+func (a *AutoRollNotifier) SendAutoRevert(ctx context.Context, id, url, revertedURL, treeMessage, culprits, builds string) {
+	a.send(ctx, &tmplVars{
+		Builds:      builds,
+		Culprits:    culprits,
+		IssueID:     id,
+		IssueURL:    url,
+		Message:     treeMessage,
+		RevertedURL: revertedURL,
+	}, subjectTmplAutoRevert, bodyTmplAutoRevert, notifier.SEVERITY_ERROR, MSG_TYPE_AUTO_REVERT)
+}
+
 // Send an issue update message.
 func (a *AutoRollNotifier) SendIssueUpdate(ctx context.Context, id, url, msg string) {
 	bodyTmpl, err := template.New("body").Parse(msg)
@@ -64,4 +64,11 @@ func TestNotifier(t *testing.T) {
 	require.Equal(t, fmt.Sprintf("The roller is throttled because it attempted to upload too many CLs in too short a time.  The roller will unthrottle at %s."+footer, now.Format(time.RFC1123)), t1.msgs[2].m.Body)
 	require.Equal(t, notifier.SEVERITY_ERROR, t1.msgs[2].m.Severity)
 	require.Equal(t, 1, len(t2.msgs))
+
+	n.SendAutoRevert(ctx, "124", "https://codereview/124", "https://codereview/123", "Tree is closed", "abc123 me@google.com Break things", "Test-Blamed https://build/2")
+	require.Equal(t, 4, len(t1.msgs))
+	require.Equal(t, "The childRepo into parentRepo AutoRoller is reverting a roll (issue 124)", t1.msgs[3].subject)
+	require.Equal(t, "The parent tree was closed after https://codereview/123 landed, with message: Tree is closed\n\nThe roller uploaded a revert (https://codereview/124) and has been stopped. Resume the roller once the breakage is fixed.\n\nFailing builds:\nTest-Blamed https://build/2\n\nSuspected culprits:\nabc123 me@google.com Break things"+footer, t1.msgs[3].m.Body)
+	require.Equal(t, notifier.SEVERITY_ERROR, t1.msgs[3].m.Severity)
+	require.Equal(t, 1, len(t2.msgs))
 }
@@ -248,6 +248,50 @@ func (r *androidRepoManager) setTopic(changeNum int64) error {
 	return r.g.SetTopic(context.TODO(), topic, changeNum)
 }
 
+// rollEmails returns the reviewers for a roll of the given revisions. If the
+// parent branch is not master then all authors of merged changes are added to
+// the email list. We do not do this for the master branch because developers
+// would get spammed due to multiple rolls a day. Release branch rolls run
+// rarely and developers should be aware that their changes are being rolled
+// there.
+func (r *androidRepoManager) rollEmails(emails []string, rolling []*revision.Revision) []string {
+	if r.parentBranch == "master" {
+		return emails
+	}
+	rv := make([]string, 0, len(emails)+len(rolling))
+	for _, c := range rolling {
+		// Extract out the email if it is a Googler.
+		if strings.HasSuffix(c.Author, "@google.com") {
+			rv = append(rv, c.Author)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// rollCommitMsg builds the commit message for a roll.
+func (r *androidRepoManager) rollCommitMsg(from, to *revision.Revision, rolling []*revision.Revision, emails []string) (string, error) {
+	commitMsg, err := r.buildCommitMsg(&CommitMsgVars{
+		ChildPath:   r.childPath,
+		ChildRepo:   common.REPO_SKIA, // TODO(borenet): Don't hard-code.
+		Reviewers:   emails,
+		Revisions:   rolling,
+		RollingFrom: from,
+		RollingTo:   to,
+		ServerURL:   r.serverURL,
+	})
+	if err != nil {
+		return "", err
+	}
+	// Temporary hack to substitute P4 for "Pixel4". See skbug.com/9595.
+	return strings.Replace(commitMsg, "Pixel4", "P4", -1), nil
+}
+
+// See documentation for RepoManager interface.
+func (r *androidRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return r.rollCommitMsg(from, to, rolling, r.rollEmails(emails, rolling))
+}
+
 // See documentation for RepoManager interface.
 func (r *androidRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
 	r.repoMtx.Lock()
@@ -336,39 +380,13 @@ func (r *androidRepoManager) CreateNewRoll(ctx context.Context, from, to *revisi
 		return 0, fmt.Errorf("Failed to create repo branch: %s", repoBranchErr)
 	}
 
-	// If the parent branch is not master then:
-	// Add all authors of merged changes to the email list. We do not do this
-	// for the master branch because developers would get spammed due to multiple
-	// rolls a day. Release branch rolls run rarely and developers should be
-	// aware that their changes are being rolled there.
-	if r.parentBranch != "master" {
-		emails = make([]string, 0, len(emails)+len(rolling))
-		for _, c := range rolling {
-			// Extract out the email if it is a Googler.
-			if strings.HasSuffix(c.Author, "@google.com") {
-				emails = append(emails, c.Author)
-			}
-		}
-		sort.Strings(emails)
-	}
-
 	// Create commit message.
-	commitMsg, err := r.buildCommitMsg(&CommitMsgVars{
-		ChildPath:   r.childPath,
-		ChildRepo:   common.REPO_SKIA, // TODO(borenet): Don't hard-code.
-		Reviewers:   emails,
-		Revisions:   rolling,
-		RollingFrom: from,
-		RollingTo:   to,
-		ServerURL:   r.serverURL,
-	})
+	emails = r.rollEmails(emails, rolling)
+	commitMsg, err := r.rollCommitMsg(from, to, rolling, emails)
 	if err != nil {
 		return 0, err
 	}
 
-	// Temporary hack to substitute P4 for "Pixel4". See skbug.com/9595.
-	commitMsg = strings.Replace(commitMsg, "Pixel4", "P4", -1)
-
 	// Commit the change with the above message.
 	if _, commitErr := r.childRepo.Git(ctx, "commit", "-m", commitMsg); commitErr != nil {
 		util.LogErr(r.abandonRepoBranch(ctx))
@@ -7,6 +7,7 @@ import (
 	"text/template"
 
 	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/sensitive"
 )
 
 const (
@@ -19,6 +20,9 @@ const (
 {{end}}{{end}}{{if len .TransitiveDeps}}
 Also rolling transitive DEPS:
 {{range .TransitiveDeps}}  {{.ParentPath}} {{substr .RollingFrom 0 12}}..{{substr .RollingTo 0 12}}
+{{end}}{{end}}{{if .SensitiveChanges}}
+Sensitive changes{{if .ReviewRequired}} (human review required){{end}}:
+{{range .SensitiveChanges}}  {{.Rule}}: {{range $i, $rev := .Revisions}}{{if $i}}, {{end}}{{$rev.String}}{{end}}
 {{end}}{{end}}
 Created with:
   gclient setdep -r {{.ChildPath}}@{{.RollingTo}}
@@ -54,6 +58,12 @@ type CommitMsgVars struct {
 	ServerURL      string
 	Tests          []string
 	TransitiveDeps []*TransitiveDep
+
+	// SensitiveChanges lists the Revisions which matched each sensitive
+	// change rule. ReviewRequired is true if the roll must be reviewed and
+	// landed by a human because of them.
+	ReviewRequired   bool
+	SensitiveChanges []*sensitive.Match
 }
 
 // TransitiveDep represents one transitive dependency roll.
@@ -108,12 +118,19 @@ func ValidateCommitMsgTemplate(tmpl string) error {
 		ChildRepo:      "https://child-repo.git",
 		CqExtraTrybots: "extra-bot",
 		IncludeLog:     true,
+		ReviewRequired: true,
 		Reviewers:      []string{"me@google.com"},
 		Revisions:      []*revision.Revision{b, c},
 		RollingFrom:    a,
 		RollingTo:      c,
-		ServerURL:      "https://fake.server.url",
-		Tests:          []string{"some-test"},
+		SensitiveChanges: []*sensitive.Match{
+			{
+				Rule:      "third_party",
+				Revisions: []*revision.Revision{b, c},
+			},
+		},
+		ServerURL: "https://fake.server.url",
+		Tests:     []string{"some-test"},
 		TransitiveDeps: []*TransitiveDep{
 			{
 				ParentPath:  "path/to/other",
@@ -135,6 +135,20 @@ func (rm *copyRepoManager) Update(ctx context.Context) (*revision.Revision, *rev
 	return lastRollRev, tipRev, notRolledRevs, nil
 }
 
+// See documentation for RepoManager interface.
+func (rm *copyRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return rm.buildCommitMsg(&CommitMsgVars{
+		ChildPath:      rm.childPath,
+		ChildRepo:      rm.childRepoUrl,
+		CqExtraTrybots: cqExtraTrybots,
+		Reviewers:      emails,
+		Revisions:      rolling,
+		RollingFrom:    from,
+		RollingTo:      to,
+		ServerURL:      rm.serverURL,
+	})
+}
+
 // See documentation for RepoManager interface.
 func (rm *copyRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
 	rm.repoMtx.Lock()
@@ -206,16 +220,7 @@ func (rm *copyRepoManager) CreateNewRoll(ctx context.Context, from, to *revision
 	}
 
 	// Build the commit message.
-	commitMsg, err := rm.buildCommitMsg(&CommitMsgVars{
-		ChildPath:      rm.childPath,
-		ChildRepo:      rm.childRepoUrl,
-		CqExtraTrybots: cqExtraTrybots,
-		Reviewers:      emails,
-		Revisions:      rolling,
-		RollingFrom:    from,
-		RollingTo:      to,
-		ServerURL:      rm.serverURL,
-	})
+	commitMsg, err := rm.PreviewRoll(ctx, from, to, rolling, emails, cqExtraTrybots)
 	if err != nil {
 		return 0, err
 	}
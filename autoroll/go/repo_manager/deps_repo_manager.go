@@ -123,6 +123,20 @@ func (dr *depsRepoManager) getLastRollRev(ctx context.Context) (*revision.Revisi
 	return revision.FromLongCommit(dr.childRevLinkTmpl, details), nil
 }
 
+// See documentation for RepoManager interface.
+func (dr *depsRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return dr.buildCommitMsg(&CommitMsgVars{
+		ChildPath:      dr.childPath,
+		ChildRepo:      dr.childRepoUrl,
+		CqExtraTrybots: cqExtraTrybots,
+		Reviewers:      emails,
+		Revisions:      rolling,
+		RollingFrom:    from,
+		RollingTo:      to,
+		ServerURL:      dr.serverURL,
+	})
+}
+
 // See documentation for RepoManager interface.
 func (dr *depsRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
 	dr.repoMtx.Lock()
@@ -177,16 +191,7 @@ func (dr *depsRepoManager) CreateNewRoll(ctx context.Context, from, to *revision
 	}
 
 	// Build the commit message.
-	commitMsg, err := dr.buildCommitMsg(&CommitMsgVars{
-		ChildPath:      dr.childPath,
-		ChildRepo:      dr.childRepoUrl,
-		CqExtraTrybots: cqExtraTrybots,
-		Reviewers:      emails,
-		Revisions:      rolling,
-		RollingFrom:    from,
-		RollingTo:      to,
-		ServerURL:      dr.serverURL,
-	})
+	commitMsg, err := dr.PreviewRoll(ctx, from, to, rolling, emails, cqExtraTrybots)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,584 @@
+package repo_manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/git"
+	"go.skia.org/infra/go/go_install"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
+)
+
+const (
+	// Sources of child revisions for the file-pin RepoManager.
+	FILE_PIN_CHILD_REVISIONS_BRANCH = "branch"
+	FILE_PIN_CHILD_REVISIONS_SEMVER = "semver"
+	FILE_PIN_CHILD_REVISIONS_TAGS   = "tags"
+)
+
+var (
+	// Use this function to instantiate a RepoManager. This is able to be
+	// overridden for testing.
+	NewFilePinRepoManager func(context.Context, *FilePinRepoManagerConfig, string, *gerrit.Gerrit, string, string, *http.Client, codereview.CodeReview, bool) (RepoManager, error) = newFilePinRepoManager
+
+	// goModTidy runs "go mod tidy" in the given directory, so that go.sum
+	// matches the updated go.mod. This is able to be overridden for
+	// testing.
+	goModTidy = func(ctx context.Context, client *http.Client, dir string) error {
+		goExc, goEnv, err := go_install.EnsureGo(ctx, client, cipdRoot)
+		if err != nil {
+			return err
+		}
+		envSlice := make([]string, 0, len(goEnv))
+		for k, v := range goEnv {
+			if k == "PATH" {
+				v = v + ":" + os.Getenv("PATH")
+			}
+			envSlice = append(envSlice, fmt.Sprintf("%s=%s", k, v))
+		}
+		_, err = exec.RunCommand(ctx, &exec.Command{
+			Name: goExc,
+			Args: []string{"mod", "tidy"},
+			Dir:  dir,
+			Env:  envSlice,
+		})
+		return err
+	}
+
+	// pseudoVersionRegex matches Go module pseudo-versions, eg.
+	// "v0.0.0-20191002192127-34f69633bfdc", capturing the commit hash.
+	pseudoVersionRegex = regexp.MustCompile(`^v\d+\.\d+\.\d+-(?:[^+]*\.)?\d{14}-([0-9a-f]{12})(?:\+incompatible)?$`)
+)
+
+// FilePinRepoManagerConfig provides configuration for the file-pin
+// RepoManager, which rolls a dependency whose version is pinned in an
+// arbitrary file in the parent repo, eg. go.mod or package.json.
+type FilePinRepoManagerConfig struct {
+	DepotToolsRepoManagerConfig
+
+	// ChildRepo is the URL of the child repo.
+	ChildRepo string `json:"childRepo"`
+
+	// VersionFile is the path of the file containing the pinned version,
+	// relative to the root of the parent repo.
+	VersionFile string `json:"versionFile"`
+
+	// Exactly one of VersionKey or VersionRegex is required.
+
+	// VersionKey is the path of the version within VersionFile, eg.
+	// "dependencies.my-package" for package.json, or the module path for
+	// go.mod. Since module versions must be tags, go.mod requires
+	// ChildRevisions of "tags" or "semver". If go.mod pins a
+	// pseudo-version, the next roll is to the newest tag created after
+	// the pinned commit. go.sum is regenerated with each roll. Some forms
+	// of JSON, TOML, and YAML can't be updated; see keyVersionFile.
+	VersionKey string `json:"versionKey,omitempty"`
+
+	// VersionRegex is a regular expression with exactly one capture
+	// group, which matches the version within VersionFile.
+	VersionRegex string `json:"versionRegex,omitempty"`
+
+	// Optional fields.
+
+	// ChildRevisions indicates where the child revisions come from:
+	// "branch" (the default) uses commit hashes on ChildBranch, "tags"
+	// uses git tags ordered by commit time, and "semver" uses git tags
+	// ordered by semantic version.
+	ChildRevisions string `json:"childRevisions,omitempty"`
+
+	// SemVerRegex is a regular expression containing one or more integer
+	// capture groups, which are compared in order when comparing tags.
+	// Tags which don't match are ignored. Required for "semver".
+	SemVerRegex string `json:"semVerRegex,omitempty"`
+
+	// TagRegex is a regular expression which tags must match in order to
+	// be rolled. Only valid with "tags".
+	TagRegex string `json:"tagRegex,omitempty"`
+
+	// VersionFileFormat is the format of VersionFile when VersionKey is
+	// used: "go.mod", "json", "toml", or "yaml". If not provided, it is
+	// inferred from the name of VersionFile.
+	VersionFileFormat string `json:"versionFileFormat,omitempty"`
+}
+
+// Validate the config.
+func (c *FilePinRepoManagerConfig) Validate() error {
+	if c.ChildRepo == "" {
+		return errors.New("ChildRepo is required.")
+	}
+	if c.VersionFile == "" {
+		return errors.New("VersionFile is required.")
+	}
+	if _, err := newVersionFile(c.VersionFile, c.VersionFileFormat, c.VersionKey, c.VersionRegex); err != nil {
+		return err
+	}
+	if c.isGoMod() && (c.ChildRevisions == "" || c.ChildRevisions == FILE_PIN_CHILD_REVISIONS_BRANCH) {
+		return errors.New("Commit hashes are not valid module versions; go.mod requires ChildRevisions of \"tags\" or \"semver\".")
+	}
+	switch c.ChildRevisions {
+	case "", FILE_PIN_CHILD_REVISIONS_BRANCH:
+		if c.SemVerRegex != "" || c.TagRegex != "" {
+			return errors.New("SemVerRegex and TagRegex are not valid when rolling a branch.")
+		}
+	case FILE_PIN_CHILD_REVISIONS_SEMVER:
+		if c.SemVerRegex == "" {
+			return errors.New("SemVerRegex is required when rolling semantic version tags.")
+		}
+		if _, err := regexp.Compile(c.SemVerRegex); err != nil {
+			return fmt.Errorf("Invalid SemVerRegex: %s", err)
+		}
+		if c.TagRegex != "" {
+			return errors.New("TagRegex is not valid when rolling semantic version tags; use SemVerRegex.")
+		}
+	case FILE_PIN_CHILD_REVISIONS_TAGS:
+		if c.SemVerRegex != "" {
+			return errors.New("SemVerRegex is not valid when rolling tags; use \"semver\".")
+		}
+		if _, err := regexp.Compile(c.TagRegex); err != nil {
+			return fmt.Errorf("Invalid TagRegex: %s", err)
+		}
+	default:
+		return fmt.Errorf("Invalid ChildRevisions %q; expected one of %q, %q or %q", c.ChildRevisions, FILE_PIN_CHILD_REVISIONS_BRANCH, FILE_PIN_CHILD_REVISIONS_SEMVER, FILE_PIN_CHILD_REVISIONS_TAGS)
+	}
+	return c.DepotToolsRepoManagerConfig.Validate()
+}
+
+// See documentation for RepoManagerConfig interface. Changed files are only
+// known when rolling a branch; tags may be rolled across unrelated histories.
+func (c *FilePinRepoManagerConfig) ProvidesChangedFiles() bool {
+	return c.ChildRevisions == "" || c.ChildRevisions == FILE_PIN_CHILD_REVISIONS_BRANCH
+}
+
+// isGoMod returns true iff the version is pinned in a go.mod file.
+func (c *FilePinRepoManagerConfig) isGoMod() bool {
+	if c.VersionKey == "" {
+		return false
+	}
+	format, err := versionFileFormat(c.VersionFile, c.VersionFileFormat)
+	return err == nil && format == VERSION_FILE_FORMAT_GO_MOD
+}
+
+// filePinRepoManager is a RepoManager which rolls a dependency by updating a
+// version pinned in a file in the parent repo.
+type filePinRepoManager struct {
+	*depotToolsRepoManager
+	childRepoUrl   string
+	childRevisions string
+	goMod          bool
+	semVerRegex    *regexp.Regexp
+	tagRegex       *regexp.Regexp
+	versionFile    versionFile
+	versionPath    string
+
+	// Details of child commits, keyed by hash, so that each tagged commit
+	// is only loaded once.
+	commits    map[string]*vcsinfo.LongCommit
+	commitsMtx sync.Mutex
+}
+
+// newFilePinRepoManager returns a RepoManager instance which rolls a
+// dependency whose version is pinned in a file in the parent repo.
+func newFilePinRepoManager(ctx context.Context, c *FilePinRepoManagerConfig, workdir string, g *gerrit.Gerrit, recipeCfgFile, serverURL string, client *http.Client, cr codereview.CodeReview, local bool) (RepoManager, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	vf, err := newVersionFile(c.VersionFile, c.VersionFileFormat, c.VersionKey, c.VersionRegex)
+	if err != nil {
+		return nil, err
+	}
+	wd := path.Join(workdir, "repo_manager")
+	drm, err := newDepotToolsRepoManager(ctx, c.DepotToolsRepoManagerConfig, wd, recipeCfgFile, serverURL, g, client, cr, local)
+	if err != nil {
+		return nil, err
+	}
+	childRepo, err := git.NewCheckout(ctx, c.ChildRepo, wd)
+	if err != nil {
+		return nil, err
+	}
+	drm.childRepo = childRepo
+	rm := &filePinRepoManager{
+		depotToolsRepoManager: drm,
+		childRepoUrl:          c.ChildRepo,
+		childRevisions:        c.ChildRevisions,
+		commits:               map[string]*vcsinfo.LongCommit{},
+		goMod:                 c.isGoMod(),
+		versionFile:           vf,
+		versionPath:           path.Join(drm.parentDir, c.VersionFile),
+	}
+	if rm.childRevisions == "" {
+		rm.childRevisions = FILE_PIN_CHILD_REVISIONS_BRANCH
+	}
+	// The regular expressions were checked by Validate.
+	if c.SemVerRegex != "" {
+		rm.semVerRegex = regexp.MustCompile(c.SemVerRegex)
+	}
+	if c.TagRegex != "" {
+		rm.tagRegex = regexp.MustCompile(c.TagRegex)
+	}
+	return rm, nil
+}
+
+// getCommit returns the details of the given commit in the child repo.
+func (rm *filePinRepoManager) getCommit(ctx context.Context, hash string) (*vcsinfo.LongCommit, error) {
+	rm.commitsMtx.Lock()
+	defer rm.commitsMtx.Unlock()
+	if details, ok := rm.commits[hash]; ok {
+		return details, nil
+	}
+	details, err := rm.childRepo.Details(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	rm.commits[hash] = details
+	return details, nil
+}
+
+// tagRevision returns a Revision for the given tag or pseudo-version, which
+// points to the given commit in the child repo.
+func (rm *filePinRepoManager) tagRevision(ctx context.Context, tag, hash string) (*revision.Revision, error) {
+	details, err := rm.getCommit(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	rev := revision.FromLongCommit(rm.childRevLinkTmpl, details)
+	rev.Id = tag
+	rev.Display = tag
+	return rev, nil
+}
+
+// getTagRevision returns a Revision for the given tag in the child repo.
+func (rm *filePinRepoManager) getTagRevision(ctx context.Context, tag string) (*revision.Revision, error) {
+	hash, err := rm.childRepo.RevParse(ctx, "--verify", "refs/tags/"+tag+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	return rm.tagRevision(ctx, tag, hash)
+}
+
+// getPinnedRevision returns a Revision for the given pinned version, which is
+// either a tag or a Go module pseudo-version, in the child repo.
+func (rm *filePinRepoManager) getPinnedRevision(ctx context.Context, version string) (*revision.Revision, error) {
+	m := pseudoVersionRegex.FindStringSubmatch(version)
+	if m == nil {
+		return rm.getTagRevision(ctx, version)
+	}
+	hash, err := rm.childRepo.RevParse(ctx, "--verify", m[1]+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	return rm.tagRevision(ctx, version, hash)
+}
+
+// getTagRevisions returns Revisions for all of the tags in the child repo which
+// may be rolled, newest first.
+func (rm *filePinRepoManager) getTagRevisions(ctx context.Context) ([]*revision.Revision, error) {
+	// Annotated tags are peeled to the commits they point to.
+	output, err := rm.childRepo.Git(ctx, "for-each-ref", "--format=%(refname) %(objectname) %(*objectname)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	var revs []*revision.Revision
+	versions := map[string][]int{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		tag := strings.TrimPrefix(fields[0], "refs/tags/")
+		hash := fields[len(fields)-1]
+		if rm.semVerRegex != nil {
+			ver, err := parseSemanticVersion(rm.semVerRegex, tag)
+			if err != nil {
+				continue
+			}
+			versions[tag] = ver
+		} else if rm.tagRegex != nil && !rm.tagRegex.MatchString(tag) {
+			continue
+		}
+		rev, err := rm.tagRevision(ctx, tag, hash)
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	sort.SliceStable(revs, func(i, j int) bool {
+		if rm.semVerRegex != nil {
+			return compareSemanticVersions(versions[revs[i].Id], versions[revs[j].Id]) < 0
+		}
+		return revs[i].Timestamp.After(revs[j].Timestamp)
+	})
+	return revs, nil
+}
+
+// See documentation for RepoManager interface.
+func (rm *filePinRepoManager) Update(ctx context.Context) (*revision.Revision, *revision.Revision, []*revision.Revision, error) {
+	// Sync the projects.
+	rm.repoMtx.Lock()
+	defer rm.repoMtx.Unlock()
+	if err := rm.createAndSyncParent(ctx); err != nil {
+		return nil, nil, nil, fmt.Errorf("Could not create and sync parent repo: %s", err)
+	}
+
+	// In this type of repo manager, the child repo is managed separately
+	// from the parent.
+	if err := rm.childRepo.Update(ctx); err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to update child repo: %s", err)
+	}
+
+	// Get the last roll revision.
+	contents, err := ioutil.ReadFile(rm.versionPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to read %s: %s", rm.versionPath, err)
+	}
+	lastVersion, err := rm.versionFile.Get(string(contents))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to find the pinned version in %s: %s", rm.versionPath, err)
+	}
+
+	if rm.childRevisions == FILE_PIN_CHILD_REVISIONS_BRANCH {
+		details, err := rm.childRepo.Details(ctx, lastVersion)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		lastRollRev := revision.FromLongCommit(rm.childRevLinkTmpl, details)
+		tipRev, err := rm.getTipRev(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		notRolledRevs, err := rm.getCommitsNotRolled(ctx, lastRollRev, tipRev)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return lastRollRev, tipRev, notRolledRevs, nil
+	}
+
+	// Tags are fetched separately.
+	if _, err := rm.childRepo.Git(ctx, "fetch", "--tags", "--force"); err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to fetch child repo tags: %s", err)
+	}
+	revs, err := rm.getTagRevisions(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lastRollRev, err := rm.getPinnedRevision(ctx, lastVersion)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Pinned version %q is not a tag in the child repo: %s", lastVersion, err)
+	}
+	// Pseudo-versions are compared with tags by commit time.
+	var lastSemVer []int
+	if rm.semVerRegex != nil && !pseudoVersionRegex.MatchString(lastVersion) {
+		lastSemVer, err = parseSemanticVersion(rm.semVerRegex, lastVersion)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Pinned version %q does not match SemVerRegex: %s", lastVersion, err)
+		}
+	}
+	notRolledRevs := []*revision.Revision{}
+	for _, rev := range revs {
+		if rev.Id == lastVersion {
+			break
+		}
+		if lastSemVer != nil {
+			ver, err := parseSemanticVersion(rm.semVerRegex, rev.Id)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if compareSemanticVersions(lastSemVer, ver) <= 0 {
+				break
+			}
+		} else if !rev.Timestamp.After(lastRollRev.Timestamp) {
+			// Semantic version tags aren't necessarily in
+			// chronological order.
+			continue
+		}
+		notRolledRevs = append(notRolledRevs, rev)
+	}
+	tipRev := lastRollRev
+	if len(notRolledRevs) > 0 {
+		tipRev = notRolledRevs[0]
+	}
+	return lastRollRev, tipRev, notRolledRevs, nil
+}
+
+// See documentation for RepoManager interface.
+func (rm *filePinRepoManager) GetRevision(ctx context.Context, id string) (*revision.Revision, error) {
+	if rm.childRevisions == FILE_PIN_CHILD_REVISIONS_BRANCH {
+		return rm.commonRepoManager.GetRevision(ctx, id)
+	}
+	rm.repoMtx.RLock()
+	defer rm.repoMtx.RUnlock()
+	return rm.getPinnedRevision(ctx, id)
+}
+
+// See documentation for RepoManager interface.
+func (rm *filePinRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return rm.buildCommitMsg(&CommitMsgVars{
+		ChildPath:      rm.childPath,
+		ChildRepo:      rm.childRepoUrl,
+		CqExtraTrybots: cqExtraTrybots,
+		Reviewers:      emails,
+		Revisions:      rolling,
+		RollingFrom:    from,
+		RollingTo:      to,
+		ServerURL:      rm.serverURL,
+	})
+}
+
+// See documentation for RepoManager interface.
+func (rm *filePinRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
+	rm.repoMtx.Lock()
+	defer rm.repoMtx.Unlock()
+
+	// Clean the checkout, get onto a fresh branch.
+	if err := rm.cleanParent(ctx); err != nil {
+		return 0, err
+	}
+	parentRepo := git.GitDir(rm.parentDir)
+	if _, err := parentRepo.Git(ctx, "checkout", "-b", ROLL_BRANCH, "-t", fmt.Sprintf("origin/%s", rm.parentBranch), "-f"); err != nil {
+		return 0, err
+	}
+
+	// Defer some more cleanup.
+	defer func() {
+		util.LogErr(rm.cleanParent(ctx))
+	}()
+
+	if !rm.local {
+		if _, err := parentRepo.Git(ctx, "config", "user.name", rm.codereview.UserName()); err != nil {
+			return 0, err
+		}
+		if _, err := parentRepo.Git(ctx, "config", "user.email", rm.codereview.UserEmail()); err != nil {
+			return 0, err
+		}
+	}
+
+	// Roll the dependency.
+	fi, err := os.Stat(rm.versionPath)
+	if err != nil {
+		return 0, err
+	}
+	contents, err := ioutil.ReadFile(rm.versionPath)
+	if err != nil {
+		return 0, err
+	}
+	newContents, err := rm.versionFile.Set(string(contents), to.Id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to update the pinned version in %s: %s", rm.versionPath, err)
+	}
+	if err := ioutil.WriteFile(rm.versionPath, []byte(newContents), fi.Mode()); err != nil {
+		return 0, err
+	}
+	if rm.goMod {
+		if err := goModTidy(ctx, rm.httpClient, path.Dir(rm.versionPath)); err != nil {
+			return 0, fmt.Errorf("Failed to update go.sum: %s", err)
+		}
+	}
+
+	// Run the pre-upload steps before committing, so that their changes
+	// are included in the roll.
+	for _, s := range rm.preUploadSteps {
+		if err := s(ctx, nil, rm.httpClient, rm.parentDir); err != nil {
+			return 0, fmt.Errorf("Failed pre-upload step: %s", err)
+		}
+	}
+
+	// Build the commit message.
+	commitMsg, err := rm.PreviewRoll(ctx, from, to, rolling, emails, cqExtraTrybots)
+	if err != nil {
+		return 0, err
+	}
+	// Use "add --all" so that new files, eg. go.sum, are included.
+	if _, err := parentRepo.Git(ctx, "add", "--all"); err != nil {
+		return 0, err
+	}
+	if _, err := parentRepo.Git(ctx, "commit", "-m", commitMsg); err != nil {
+		return 0, err
+	}
+
+	// Code review services which create rolls via their APIs need the
+	// roll to be pushed to a branch of the parent repo first.
+	if uploader, ok := rm.codereview.(codereview.RollUploader); ok {
+		if _, err := parentRepo.Git(ctx, "push", "origin", fmt.Sprintf("%s:refs/heads/%s", ROLL_BRANCH, ROLL_BRANCH), "-f"); err != nil {
+			return 0, err
+		}
+		return uploader.UploadRoll(ctx, ROLL_BRANCH, rm.parentBranch, commitMsg, dryRun)
+	}
+
+	// Upload the CL.
+	gitExec, err := git.Executable(ctx)
+	if err != nil {
+		return 0, skerr.Wrap(err)
+	}
+	uploadCmd := &exec.Command{
+		Dir:     rm.parentDir,
+		Env:     rm.depotToolsEnv,
+		Name:    gitExec,
+		Args:    []string{"cl", "upload", "--bypass-hooks", "--squash", "-f", "-v", "-v"},
+		Timeout: 2 * time.Minute,
+	}
+	if dryRun {
+		uploadCmd.Args = append(uploadCmd.Args, "--cq-dry-run")
+	} else {
+		uploadCmd.Args = append(uploadCmd.Args, "--use-commit-queue")
+	}
+	uploadCmd.Args = append(uploadCmd.Args, "--gerrit")
+	if emails != nil && len(emails) > 0 {
+		emailStr := strings.Join(emails, ",")
+		uploadCmd.Args = append(uploadCmd.Args, "--send-mail", fmt.Sprintf("--tbrs=%s", emailStr))
+	}
+	uploadCmd.Args = append(uploadCmd.Args, "-m", commitMsg)
+
+	sklog.Infof("Running command: git %s", strings.Join(uploadCmd.Args, " "))
+	if _, err := exec.RunCommand(ctx, uploadCmd); err != nil {
+		return 0, err
+	}
+
+	// Obtain the issue number.
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		return 0, err
+	}
+	defer util.RemoveAll(tmp)
+	jsonFile := path.Join(tmp, "issue.json")
+	if _, err := exec.RunCommand(ctx, &exec.Command{
+		Dir:  rm.parentDir,
+		Env:  rm.depotToolsEnv,
+		Name: gitExec,
+		Args: []string{"cl", "issue", fmt.Sprintf("--json=%s", jsonFile)},
+	}); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(jsonFile)
+	if err != nil {
+		return 0, err
+	}
+	defer util.Close(f)
+	var issue issueJson
+	if err := json.NewDecoder(f).Decode(&issue); err != nil {
+		return 0, err
+	}
+
+	// Mark the change as ready for review, if necessary.
+	if err := rm.unsetWIP(ctx, nil, issue.Issue); err != nil {
+		return 0, err
+	}
+
+	return issue.Issue, nil
+}
@@ -0,0 +1,370 @@
+package repo_manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/gerrit"
+	git_testutils "go.skia.org/infra/go/git/testutils"
+	gitlab_testutils "go.skia.org/infra/go/gitlab/testutils"
+	"go.skia.org/infra/go/mockhttpclient"
+	"go.skia.org/infra/go/recipe_cfg"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func filePinCfg() *FilePinRepoManagerConfig {
+	return &FilePinRepoManagerConfig{
+		DepotToolsRepoManagerConfig: DepotToolsRepoManagerConfig{
+			CommonRepoManagerConfig: CommonRepoManagerConfig{
+				ChildBranch:  "master",
+				ChildPath:    childPath,
+				ParentBranch: "master",
+			},
+		},
+		VersionFile: "package.json",
+		VersionKey:  "dependencies.child",
+	}
+}
+
+// setupFilePinGerrit returns a fake Gerrit which expects a single roll to be
+// uploaded.
+func setupFilePinGerrit(t *testing.T, wd string) *gerrit.Gerrit {
+	gUrl := "https://fake-skia-review.googlesource.com"
+	urlMock := mockhttpclient.NewURLMock()
+	serialized, err := json.Marshal(&gerrit.AccountDetails{
+		AccountId: 101,
+		Name:      mockUser,
+		Email:     mockUser,
+		UserName:  mockUser,
+	})
+	require.NoError(t, err)
+	serialized = append([]byte("abcd\n"), serialized...)
+	urlMock.MockOnce(gUrl+"/a/accounts/self/detail", mockhttpclient.MockGetDialogue(serialized))
+	ci := gerrit.ChangeInfo{
+		ChangeId: "12345",
+		Id:       "12345",
+		Issue:    12345,
+		Revisions: map[string]*gerrit.Revision{
+			"ps1": {
+				ID:     "ps1",
+				Number: 1,
+			},
+		},
+	}
+	respBody, err := json.Marshal(ci)
+	require.NoError(t, err)
+	respBody = append([]byte(")]}'\n"), respBody...)
+	urlMock.MockOnce(gUrl+"/a/changes/12345/detail?o=ALL_REVISIONS", mockhttpclient.MockGetDialogue(respBody))
+	gitcookies := filepath.Join(wd, "gitcookies_fake")
+	require.NoError(t, ioutil.WriteFile(gitcookies, []byte(".googlesource.com\tTRUE\t/\tTRUE\t123\to\tgit-user.google.com=abc123"), os.ModePerm))
+	g, err := gerrit.NewGerrit(gUrl, gitcookies, urlMock.Client())
+	require.NoError(t, err)
+	return g
+}
+
+func setupFilePin(t *testing.T, tags bool) (context.Context, string, *git_testutils.GitBuilder, []string, *git_testutils.GitBuilder, func()) {
+	wd, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+
+	// Create child and parent repos. If requested, tag each child commit
+	// with a version.
+	ctx := context.Background()
+	child := git_testutils.GitInit(t, ctx)
+	childCommits := make([]string, 0, numChildCommits)
+	for i := 0; i < numChildCommits; i++ {
+		childCommits = append(childCommits, child.CommitGen(ctx, "somefile.txt"))
+		if tags {
+			child.Git(ctx, "tag", fmt.Sprintf("v1.%d.0", i))
+		}
+	}
+	pinned := childCommits[0]
+	if tags {
+		pinned = "v1.0.0"
+	}
+
+	parent := git_testutils.GitInit(t, ctx)
+	parent.Add(ctx, "package.json", `{
+  "name": "parent",
+  "dependencies": {
+    "child": "`+pinned+`"
+  }
+}
+`)
+	parent.Commit(ctx)
+
+	mockRun := &exec.CommandCollector{}
+	mockRun.SetDelegateRun(func(ctx context.Context, cmd *exec.Command) error {
+		if strings.Contains(cmd.Name, "git") && cmd.Args[0] == "cl" {
+			if cmd.Args[1] == "upload" {
+				return nil
+			} else if cmd.Args[1] == "issue" {
+				json := testutils.MarshalJSON(t, &issueJson{
+					Issue:    issueNum,
+					IssueUrl: "???",
+				})
+				f := strings.Split(cmd.Args[2], "=")[1]
+				testutils.WriteFile(t, f, json)
+				return nil
+			}
+		}
+		return exec.DefaultRun(ctx, cmd)
+	})
+	ctx = exec.NewContext(ctx, mockRun.Run)
+
+	cleanup := func() {
+		testutils.RemoveAll(t, wd)
+		child.Cleanup()
+		parent.Cleanup()
+	}
+
+	return ctx, wd, child, childCommits, parent, cleanup
+}
+
+func TestFilePinRepoManagerConfigValidate(t *testing.T) {
+	unittest.SmallTest(t)
+
+	cfg := filePinCfg()
+	cfg.ParentRepo = "dummy"
+	cfg.ChildRepo = "dummy"
+	require.NoError(t, cfg.Validate())
+
+	cfg.ChildRevisions = FILE_PIN_CHILD_REVISIONS_SEMVER
+	require.EqualError(t, cfg.Validate(), "SemVerRegex is required when rolling semantic version tags.")
+	cfg.SemVerRegex = `^v(\d+)\.(\d+)\.(\d+)$`
+	require.NoError(t, cfg.Validate())
+	cfg.ChildRevisions = FILE_PIN_CHILD_REVISIONS_TAGS
+	require.EqualError(t, cfg.Validate(), "SemVerRegex is not valid when rolling tags; use \"semver\".")
+	cfg.SemVerRegex = ""
+	cfg.TagRegex = "^v"
+	require.NoError(t, cfg.Validate())
+	cfg.ChildRevisions = "bogus"
+	require.EqualError(t, cfg.Validate(), "Invalid ChildRevisions \"bogus\"; expected one of \"branch\", \"semver\" or \"tags\"")
+	cfg.ChildRevisions = ""
+	cfg.TagRegex = ""
+
+	cfg.VersionFile = "go.mod"
+	cfg.VersionKey = "example.com/child"
+	require.EqualError(t, cfg.Validate(), "Commit hashes are not valid module versions; go.mod requires ChildRevisions of \"tags\" or \"semver\".")
+	cfg.ChildRevisions = FILE_PIN_CHILD_REVISIONS_TAGS
+	require.NoError(t, cfg.Validate())
+	cfg.ChildRevisions = ""
+	cfg.VersionFile = "package.json"
+	cfg.VersionKey = "dependencies.child"
+
+	cfg.VersionRegex = "(.*)"
+	require.EqualError(t, cfg.Validate(), "Exactly one of VersionKey or VersionRegex is required.")
+	cfg.VersionRegex = ""
+	cfg.VersionFile = ""
+	require.EqualError(t, cfg.Validate(), "VersionFile is required.")
+}
+
+// TestFilePinRepoManager tests rolling commits on a branch of the child repo.
+func TestFilePinRepoManager(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx, wd, child, childCommits, parent, cleanup := setupFilePin(t, false)
+	defer cleanup()
+	recipesCfg := filepath.Join(testutils.GetRepoRoot(t), recipe_cfg.RECIPE_CFG_PATH)
+
+	g := setupFilePinGerrit(t, wd)
+	cfg := filePinCfg()
+	cfg.ChildRepo = child.RepoUrl()
+	cfg.ParentRepo = parent.RepoUrl()
+	rm, err := NewFilePinRepoManager(ctx, cfg, wd, g, recipesCfg, "fake.server.com", nil, gerritCR(t, g), false)
+	require.NoError(t, err)
+	lastRollRev, tipRev, notRolledRevs, err := rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, childCommits[0], lastRollRev.Id)
+	require.Equal(t, childCommits[len(childCommits)-1], tipRev.Id)
+	require.Equal(t, len(childCommits)-1, len(notRolledRevs))
+
+	// Test update.
+	lastCommit := child.CommitGen(context.Background(), "abc.txt")
+	lastRollRev, tipRev, notRolledRevs, err = rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, lastCommit, tipRev.Id)
+
+	// Create a roll.
+	issue, err := rm.CreateNewRoll(ctx, lastRollRev, tipRev, notRolledRevs, emails, cqExtraTrybots, false)
+	require.NoError(t, err)
+	require.Equal(t, issueNum, issue)
+}
+
+// TestFilePinRepoManagerSemVer tests rolling semantic version tags.
+func TestFilePinRepoManagerSemVer(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx, wd, child, _, parent, cleanup := setupFilePin(t, true)
+	defer cleanup()
+	recipesCfg := filepath.Join(testutils.GetRepoRoot(t), recipe_cfg.RECIPE_CFG_PATH)
+
+	g := setupFilePinGerrit(t, wd)
+	cfg := filePinCfg()
+	cfg.ChildRepo = child.RepoUrl()
+	cfg.ParentRepo = parent.RepoUrl()
+	cfg.ChildRevisions = FILE_PIN_CHILD_REVISIONS_SEMVER
+	cfg.SemVerRegex = `^v(\d+)\.(\d+)\.(\d+)$`
+	rm, err := NewFilePinRepoManager(ctx, cfg, wd, g, recipesCfg, "fake.server.com", nil, gerritCR(t, g), false)
+	require.NoError(t, err)
+	lastRollRev, tipRev, notRolledRevs, err := rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0", lastRollRev.Id)
+	require.Equal(t, fmt.Sprintf("v1.%d.0", numChildCommits-1), tipRev.Id)
+	require.Equal(t, numChildCommits-1, len(notRolledRevs))
+
+	// Tags which don't match SemVerRegex are ignored.
+	child.CommitGen(context.Background(), "abc.txt")
+	child.Git(ctx, "tag", "not-a-version")
+	_, tipRev2, _, err := rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, tipRev.Id, tipRev2.Id)
+
+	// The details of each tagged commit are only loaded once.
+	require.Len(t, rm.(*filePinRepoManager).commits, numChildCommits)
+
+	// Annotated tags refer to the tagged commit.
+	annotated := child.CommitGen(context.Background(), "abc.txt")
+	child.Git(ctx, "tag", "-a", "-m", "Annotated", "v2.0.0")
+	_, tipRev2, _, err = rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v2.0.0", tipRev2.Id)
+	require.NotNil(t, rm.(*filePinRepoManager).commits[annotated])
+
+	rev, err := rm.GetRevision(ctx, "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, lastRollRev.Id, rev.Id)
+
+	issue, err := rm.CreateNewRoll(ctx, lastRollRev, tipRev, notRolledRevs, emails, cqExtraTrybots, false)
+	require.NoError(t, err)
+	require.Equal(t, issueNum, issue)
+}
+
+// TestFilePinRepoManagerGitLab tests uploading rolls to GitLab.
+func TestFilePinRepoManagerGitLab(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx, wd, child, childCommits, parent, cleanup := setupFilePin(t, false)
+	defer cleanup()
+	recipesCfg := filepath.Join(testutils.GetRepoRoot(t), recipe_cfg.RECIPE_CFG_PATH)
+
+	f := gitlab_testutils.NewFakeGitLab(t, "my-group/parent")
+	defer f.Close()
+	cr, err := (&codereview.GitLabConfig{
+		URL:         f.Server.URL,
+		Project:     "my-group/parent",
+		DryRunLabel: "autoroller: dryrun",
+	}).Init(nil, nil, http.DefaultClient)
+	require.NoError(t, err)
+
+	cfg := filePinCfg()
+	cfg.ChildRepo = child.RepoUrl()
+	cfg.ParentRepo = parent.RepoUrl()
+	rm, err := NewFilePinRepoManager(ctx, cfg, wd, nil, recipesCfg, "fake.server.com", nil, cr, false)
+	require.NoError(t, err)
+	lastRollRev, tipRev, notRolledRevs, err := rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, childCommits[0], lastRollRev.Id)
+
+	// The roll is pushed to a branch of the parent repo and a merge
+	// request is created for it.
+	issue, err := rm.CreateNewRoll(ctx, lastRollRev, tipRev, notRolledRevs, emails, cqExtraTrybots, true)
+	require.NoError(t, err)
+	mr := f.MergeRequest(issue)
+	require.Equal(t, ROLL_BRANCH, mr.SourceBranch)
+	require.Equal(t, "master", mr.TargetBranch)
+	require.True(t, strings.HasPrefix(mr.Title, "Roll "), mr.Title)
+	require.Equal(t, []string{"autoroller: dryrun"}, mr.Labels)
+	contents := parent.Git(ctx, "show", fmt.Sprintf("%s:package.json", ROLL_BRANCH))
+	require.True(t, strings.Contains(contents, tipRev.Id), contents)
+}
+
+// TestFilePinRepoManagerGoMod tests rolling a module pinned to a pseudo-version
+// in go.mod.
+func TestFilePinRepoManagerGoMod(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx := context.Background()
+	wd, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer testutils.RemoveAll(t, wd)
+	recipesCfg := filepath.Join(testutils.GetRepoRoot(t), recipe_cfg.RECIPE_CFG_PATH)
+
+	// The pinned commit isn't tagged; the later commits are.
+	child := git_testutils.GitInit(t, ctx)
+	defer child.Cleanup()
+	ts := time.Date(2019, time.November, 1, 0, 0, 0, 0, time.UTC)
+	pinned := child.CommitGenAt(ctx, "somefile.txt", ts)
+	child.CommitGenAt(ctx, "somefile.txt", ts.Add(time.Hour))
+	child.Git(ctx, "tag", "v1.1.0")
+	child.CommitGenAt(ctx, "somefile.txt", ts.Add(2*time.Hour))
+	child.Git(ctx, "tag", "v1.0.1")
+	pseudo := "v0.0.0-20191101000000-" + pinned[:12]
+
+	parent := git_testutils.GitInit(t, ctx)
+	defer parent.Cleanup()
+	parent.Add(ctx, "go.mod", "module example.com/parent\n\nrequire example.com/child "+pseudo+"\n")
+	parent.Commit(ctx)
+
+	f := gitlab_testutils.NewFakeGitLab(t, "my-group/parent")
+	defer f.Close()
+	cr, err := (&codereview.GitLabConfig{
+		URL:     f.Server.URL,
+		Project: "my-group/parent",
+	}).Init(nil, nil, http.DefaultClient)
+	require.NoError(t, err)
+
+	// Don't install and run Go; write go.sum instead.
+	tidyDir := ""
+	oldGoModTidy := goModTidy
+	goModTidy = func(_ context.Context, _ *http.Client, dir string) error {
+		tidyDir = dir
+		return ioutil.WriteFile(filepath.Join(dir, "go.sum"), []byte("example.com/child v1.1.0 h1:abc=\n"), 0644)
+	}
+	defer func() {
+		goModTidy = oldGoModTidy
+	}()
+
+	cfg := filePinCfg()
+	cfg.ChildRepo = child.RepoUrl()
+	cfg.ParentRepo = parent.RepoUrl()
+	cfg.ChildRevisions = FILE_PIN_CHILD_REVISIONS_SEMVER
+	cfg.SemVerRegex = `^v(\d+)\.(\d+)\.(\d+)$`
+	cfg.VersionFile = "go.mod"
+	cfg.VersionKey = "example.com/child"
+	rm, err := NewFilePinRepoManager(ctx, cfg, wd, nil, recipesCfg, "fake.server.com", nil, cr, false)
+	require.NoError(t, err)
+
+	// The pseudo-version is resolved to the pinned commit, and the tags
+	// created after it are rolled in semantic version order.
+	lastRollRev, tipRev, notRolledRevs, err := rm.Update(ctx)
+	require.NoError(t, err)
+	require.Equal(t, pseudo, lastRollRev.Id)
+	require.Equal(t, ts, lastRollRev.Timestamp.UTC())
+	require.Equal(t, "v1.1.0", tipRev.Id)
+	require.Len(t, notRolledRevs, 2)
+	require.Equal(t, "v1.0.1", notRolledRevs[1].Id)
+	rev, err := rm.GetRevision(ctx, pseudo)
+	require.NoError(t, err)
+	require.Equal(t, pseudo, rev.Id)
+
+	// go.sum is regenerated and included in the roll.
+	issue, err := rm.CreateNewRoll(ctx, lastRollRev, tipRev, notRolledRevs, emails, cqExtraTrybots, false)
+	require.NoError(t, err)
+	require.NotNil(t, f.MergeRequest(issue))
+	_, err = os.Stat(filepath.Join(tidyDir, "go.mod"))
+	require.NoError(t, err)
+	require.Equal(t, "module example.com/parent\n\nrequire example.com/child v1.1.0\n", parent.Git(ctx, "show", fmt.Sprintf("%s:go.mod", ROLL_BRANCH)))
+	require.Equal(t, "example.com/child v1.1.0 h1:abc=\n", parent.Git(ctx, "show", fmt.Sprintf("%s:go.sum", ROLL_BRANCH)))
+}
@@ -54,6 +54,11 @@ type GithubCipdDEPSRepoManagerConfig struct {
 	CipdAssetTag  string `json:"cipdAssetTag"`
 }
 
+// See documentation for RepoManagerConfig interface.
+func (r *GithubCipdDEPSRepoManagerConfig) ProvidesChangedFiles() bool {
+	return false
+}
+
 // See documentation for RepoManagerConfig interface.
 func (r *GithubCipdDEPSRepoManagerConfig) ValidStrategies() []string {
 	return []string{
@@ -275,6 +280,16 @@ func (rm *githubCipdDEPSRepoManager) getLastRollRev(ctx context.Context) (*revis
 	return rm.cipdInstanceToRevision(&instance.InstanceInfo), nil
 }
 
+// See documentation for RepoManager interface.
+func (rm *githubCipdDEPSRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return rm.buildCommitMsg(&CommitMsgVars{
+		ChildPath:   rm.cipdAssetName,
+		RollingFrom: from,
+		RollingTo:   to,
+		ServerURL:   rm.serverURL,
+	})
+}
+
 // See documentation for RepoManager interface.
 func (rm *githubCipdDEPSRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
 	rm.repoMtx.Lock()
@@ -343,12 +358,7 @@ func (rm *githubCipdDEPSRepoManager) CreateNewRoll(ctx context.Context, from, to
 	}
 
 	// Build the commitMsg.
-	commitMsg, err := rm.buildCommitMsg(&CommitMsgVars{
-		ChildPath:   rm.cipdAssetName,
-		RollingFrom: from,
-		RollingTo:   to,
-		ServerURL:   rm.serverURL,
-	})
+	commitMsg, err := rm.PreviewRoll(ctx, from, to, rolling, emails, cqExtraTrybots)
 	if err != nil {
 		return 0, err
 	}
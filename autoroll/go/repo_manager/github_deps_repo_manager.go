@@ -270,6 +270,55 @@ func (rm *githubDEPSRepoManager) Update(ctx context.Context) (*revision.Revision
 	return lastRollRev, tipRev, notRolledRevs, nil
 }
 
+// getTransitiveDeps returns the transitive dependencies which change when
+// rolling to the given revision, based on the given DEPS file.
+func (rm *githubDEPSRepoManager) getTransitiveDeps(ctx context.Context, depsFile string, to *revision.Revision) ([]*TransitiveDep, error) {
+	transitiveDeps := []*TransitiveDep{}
+	for childPath, parentPath := range rm.transitiveDeps {
+		oldRev, err := rm.getdep(ctx, depsFile, parentPath)
+		if err != nil {
+			return nil, err
+		}
+		newRev, ok := to.Dependencies[childPath]
+		if !ok {
+			return nil, skerr.Fmt("To-revision %s is missing dependency entry for %s", to.Id, childPath)
+		}
+		if oldRev != newRev {
+			transitiveDeps = append(transitiveDeps, &TransitiveDep{
+				ParentPath:  parentPath,
+				RollingFrom: oldRev,
+				RollingTo:   newRev,
+			})
+		}
+	}
+	return transitiveDeps, nil
+}
+
+// rollCommitMsg builds the commit message for a roll.
+func (rm *githubDEPSRepoManager) rollCommitMsg(from, to *revision.Revision, rolling []*revision.Revision, emails []string, transitiveDeps []*TransitiveDep) (string, error) {
+	return rm.buildCommitMsg(&CommitMsgVars{
+		ChildPath:      rm.childPath,
+		ChildRepo:      rm.childRepoUrl,
+		Reviewers:      emails,
+		Revisions:      rolling,
+		RollingFrom:    from,
+		RollingTo:      to,
+		ServerURL:      rm.serverURL,
+		TransitiveDeps: transitiveDeps,
+	})
+}
+
+// See documentation for RepoManager interface.
+func (rm *githubDEPSRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	rm.repoMtx.Lock()
+	defer rm.repoMtx.Unlock()
+	transitiveDeps, err := rm.getTransitiveDeps(ctx, filepath.Join(rm.parentDir, "DEPS"), to)
+	if err != nil {
+		return "", err
+	}
+	return rm.rollCommitMsg(from, to, rolling, emails, transitiveDeps)
+}
+
 // See documentation for RepoManager interface.
 func (rm *githubDEPSRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
 	rm.repoMtx.Lock()
@@ -310,32 +359,18 @@ func (rm *githubDEPSRepoManager) CreateNewRoll(ctx context.Context, from, to *re
 
 	// Run "gclient setdep".
 	depsFile := filepath.Join(rm.parentDir, "DEPS")
+	transitiveDeps, err := rm.getTransitiveDeps(ctx, depsFile, to)
+	if err != nil {
+		return 0, err
+	}
 	if err := rm.setdep(ctx, depsFile, rm.childPath, to.Id); err != nil {
 		return 0, err
 	}
 
 	// Update any transitive DEPS.
-	transitiveDeps := []*TransitiveDep{}
-	if len(rm.transitiveDeps) > 0 {
-		for childPath, parentPath := range rm.transitiveDeps {
-			oldRev, err := rm.getdep(ctx, depsFile, parentPath)
-			if err != nil {
-				return 0, err
-			}
-			newRev, ok := to.Dependencies[childPath]
-			if !ok {
-				return 0, skerr.Fmt("To-revision %s is missing dependency entry for %s", to.Id, childPath)
-			}
-			if oldRev != newRev {
-				if err := rm.setdep(ctx, depsFile, parentPath, newRev); err != nil {
-					return 0, err
-				}
-				transitiveDeps = append(transitiveDeps, &TransitiveDep{
-					ParentPath:  parentPath,
-					RollingFrom: oldRev,
-					RollingTo:   newRev,
-				})
-			}
+	for _, td := range transitiveDeps {
+		if err := rm.setdep(ctx, depsFile, td.ParentPath, td.RollingTo); err != nil {
+			return 0, err
 		}
 	}
 
@@ -370,16 +405,7 @@ func (rm *githubDEPSRepoManager) CreateNewRoll(ctx context.Context, from, to *re
 		d.Body = pullRequestInLogRE.ReplaceAllString(d.Body, fmt.Sprintf(" (%s/%s$1)", user, repo))
 		details = append(details, d)
 	}
-	commitMsg, err := rm.buildCommitMsg(&CommitMsgVars{
-		ChildPath:      rm.childPath,
-		ChildRepo:      rm.childRepoUrl,
-		Reviewers:      emails,
-		Revisions:      rolling,
-		RollingFrom:    from,
-		RollingTo:      to,
-		ServerURL:      rm.serverURL,
-		TransitiveDeps: transitiveDeps,
-	})
+	commitMsg, err := rm.rollCommitMsg(from, to, rolling, emails, transitiveDeps)
 	if err != nil {
 		return 0, fmt.Errorf("Could not build github commit message: %s", err)
 	}
@@ -267,6 +267,19 @@ func (rm *githubRepoManager) cleanParent(ctx context.Context) error {
 	return nil
 }
 
+// See documentation for RepoManager interface.
+func (rm *githubRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return rm.buildCommitMsg(&CommitMsgVars{
+		ChildPath:   rm.childPath,
+		ChildRepo:   rm.childRepoURL,
+		Reviewers:   emails,
+		Revisions:   rolling,
+		RollingFrom: from,
+		RollingTo:   to,
+		ServerURL:   rm.serverURL,
+	})
+}
+
 // See documentation for RepoManager interface.
 func (rm *githubRepoManager) CreateNewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string, dryRun bool) (int64, error) {
 	rm.repoMtx.Lock()
@@ -317,15 +330,10 @@ func (rm *githubRepoManager) CreateNewRoll(ctx context.Context, from, to *revisi
 		details = append(details, d)
 	}
 
-	commitMsg, err := rm.buildCommitMsg(&CommitMsgVars{
-		ChildPath:   rm.childPath,
-		ChildRepo:   rm.childRepoURL,
-		Reviewers:   emails,
-		Revisions:   rolling,
-		RollingFrom: from,
-		RollingTo:   to,
-		ServerURL:   rm.serverURL,
-	})
+	commitMsg, err := rm.PreviewRoll(ctx, from, to, rolling, emails, cqExtraTrybots)
+	if err != nil {
+		return 0, err
+	}
 
 	for i := len(details) - 1; i >= 0; i-- {
 		// Write the file.
@@ -30,7 +30,7 @@ func githubCR(t *testing.T, g *github.GitHub) codereview.CodeReview {
 		RepoName:      "my-repo",
 		ChecksNum:     3,
 		ChecksWaitFor: []string{"a", "b", "c"},
-	}).Init(nil, g)
+	}).Init(nil, g, nil)
 	require.NoError(t, err)
 	return rv
 }
@@ -28,6 +28,11 @@ func (c *NoCheckoutRepoManagerConfig) NoCheckout() bool {
 	return true
 }
 
+// See documentation for RepoManagerConfig interface.
+func (c *NoCheckoutRepoManagerConfig) ProvidesChangedFiles() bool {
+	return false
+}
+
 func (c *NoCheckoutRepoManagerConfig) Validate() error {
 	if err := c.CommonRepoManagerConfig.Validate(); err != nil {
 		return err
@@ -143,6 +148,12 @@ func (rm *noCheckoutRepoManager) CreateNewRoll(ctx context.Context, from, to *re
 	return ci.Issue, nil
 }
 
+// See documentation for RepoManager interface.
+func (rm *noCheckoutRepoManager) PreviewRoll(ctx context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	commitMsg, _, err := rm.createRoll(ctx, from, to, rolling, rm.serverURL, cqExtraTrybots, emails)
+	return commitMsg, err
+}
+
 // See documentation for RepoManager interface.
 func (rm *noCheckoutRepoManager) Update(ctx context.Context) (*revision.Revision, *revision.Revision, []*revision.Revision, error) {
 	rm.repoMtx.Lock()
@@ -17,6 +17,7 @@ import (
 
 	"go.skia.org/infra/autoroll/go/codereview"
 	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/sensitive"
 	"go.skia.org/infra/autoroll/go/strategy"
 	"go.skia.org/infra/go/cleanup"
 	"go.skia.org/infra/go/depot_tools"
@@ -57,6 +58,11 @@ type RepoManager interface {
 	// GetRevision returns a revision.Revision instance from the given
 	// revision ID.
 	GetRevision(context.Context, string) (*revision.Revision, error)
+
+	// PreviewRoll returns the commit message which CreateNewRoll would use
+	// for the given roll, without modifying the parent repo or uploading
+	// anything. The parameters are the same as those of CreateNewRoll.
+	PreviewRoll(context.Context, *revision.Revision, *revision.Revision, []*revision.Revision, []string, string) (string, error)
 }
 
 // Start makes the RepoManager begin the periodic update process.
@@ -115,6 +121,9 @@ type CommonRepoManagerConfig struct {
 	BugProject string `json:"bugProject,omitempty"`
 	// Named steps to run before uploading roll CLs.
 	PreUploadSteps []string `json:"preUploadSteps,omitempty"`
+	// Rules used to detect sensitive changes in the child repo, which are
+	// listed in the commit message and may require human review.
+	SensitiveChanges *sensitive.Config `json:"sensitiveChanges,omitempty"`
 }
 
 // Validate the config.
@@ -142,9 +151,20 @@ func (c *CommonRepoManagerConfig) Validate() error {
 			return err
 		}
 	}
+	if c.SensitiveChanges != nil {
+		if err := c.SensitiveChanges.Validate(); err != nil {
+			return fmt.Errorf("SensitiveChanges validation failed: %s", err)
+		}
+	}
 	return nil
 }
 
+// GetSensitiveChanges returns the rules used to detect sensitive changes, or
+// nil if none are configured.
+func (r *CommonRepoManagerConfig) GetSensitiveChanges() *sensitive.Config {
+	return r.SensitiveChanges
+}
+
 // See documentation for RepoManagerConfig interface.
 func (r *CommonRepoManagerConfig) DefaultStrategy() string {
 	return strategy.ROLL_STRATEGY_BATCH
@@ -155,6 +175,11 @@ func (r *CommonRepoManagerConfig) NoCheckout() bool {
 	return false
 }
 
+// See documentation for RepoManagerConfig interface.
+func (r *CommonRepoManagerConfig) ProvidesChangedFiles() bool {
+	return true
+}
+
 // See documentation for RepoManagerConfig interface.
 func (r *CommonRepoManagerConfig) ValidStrategies() []string {
 	return []string{
@@ -184,8 +209,13 @@ type commonRepoManager struct {
 	parentBranch     string
 	preUploadSteps   []PreUploadStep
 	repoMtx          sync.RWMutex
+	sensitive        *sensitive.Classifier
 	serverURL        string
 	workdir          string
+
+	// Files changed by each commit not yet rolled, keyed by commit hash.
+	changedFiles    map[string][]string
+	changedFilesMtx sync.Mutex // Protects changedFiles.
 }
 
 // Returns a commonRepoManager instance.
@@ -219,6 +249,13 @@ func newCommonRepoManager(ctx context.Context, c CommonRepoManagerConfig, workdi
 	if err != nil {
 		return nil, err
 	}
+	var classifier *sensitive.Classifier
+	if c.SensitiveChanges != nil {
+		classifier, err = sensitive.NewClassifier(c.SensitiveChanges)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &commonRepoManager{
 		childBranch:      c.ChildBranch,
 		childDir:         childDir,
@@ -236,6 +273,7 @@ func newCommonRepoManager(ctx context.Context, c CommonRepoManagerConfig, workdi
 		bugProject:       c.BugProject,
 		parentBranch:     c.ParentBranch,
 		preUploadSteps:   preUploadSteps,
+		sensitive:        classifier,
 		serverURL:        serverURL,
 		workdir:          workdir,
 	}, nil
@@ -265,7 +303,57 @@ func (r *commonRepoManager) getCommitsNotRolled(ctx context.Context, lastRollRev
 		}
 		notRolled = append(notRolled, detail)
 	}
-	return revision.FromLongCommits(r.childRevLinkTmpl, notRolled), nil
+	revs := revision.FromLongCommits(r.childRevLinkTmpl, notRolled)
+	if r.sensitive != nil && r.sensitive.UsesPaths() {
+		// The files changed by a commit never change, so only look up
+		// those of commits we haven't seen before. Entries for commits
+		// which have since been rolled are dropped.
+		r.changedFilesMtx.Lock()
+		defer r.changedFilesMtx.Unlock()
+		changedFiles := make(map[string][]string, len(revs))
+		for _, rev := range revs {
+			files, ok := r.changedFiles[rev.Id]
+			if !ok {
+				files, err = r.getChangedFiles(ctx, rev.Id)
+				if err != nil {
+					return nil, err
+				}
+			}
+			changedFiles[rev.Id] = files
+			rev.Files = files
+		}
+		r.changedFiles = changedFiles
+	}
+	return revs, nil
+}
+
+// getChangedFiles returns the paths of the files changed by the given commit
+// in the child repo. Merge commits are compared against their first parent, so
+// that the files brought in by the merge are included.
+func (r *commonRepoManager) getChangedFiles(ctx context.Context, commit string) ([]string, error) {
+	details, err := r.childRepo.Details(ctx, commit)
+	if err != nil {
+		return nil, err
+	}
+	// Note that "git diff-tree --first-parent" does not limit the diff of a
+	// merge commit to its first parent, so we pass the parent explicitly.
+	args := []string{"diff-tree", "--no-commit-id", "--name-only", "-r", "-z"}
+	if len(details.Parents) > 0 {
+		args = append(args, details.Parents[0], details.Hash)
+	} else {
+		args = append(args, "--root", details.Hash)
+	}
+	output, err := r.childRepo.Git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(output, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
 }
 
 // See documentation for RepoManager interface.
@@ -350,6 +438,14 @@ func (r *commonRepoManager) buildCommitMsg(vars *CommitMsgVars) (string, error)
 		sort.Strings(vars.Tests)
 	}
 
+	// Sensitive changes.
+	vars.SensitiveChanges = nil
+	vars.ReviewRequired = false
+	if r.sensitive != nil {
+		vars.SensitiveChanges = r.sensitive.Classify(vars.Revisions)
+		vars.ReviewRequired = r.sensitive.ReviewRequired(vars.SensitiveChanges)
+	}
+
 	// Create the commit message.
 	var buf bytes.Buffer
 	if err := r.commitMsgTmpl.Execute(&buf, vars); err != nil {
@@ -1,9 +1,14 @@
 package repo_manager
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/sensitive"
+	"go.skia.org/infra/go/git"
+	git_testutils "go.skia.org/infra/go/git/testutils"
 	"go.skia.org/infra/go/testutils/unittest"
 )
 
@@ -55,6 +60,10 @@ func TestCommonConfigValidation(t *testing.T) {
 			"bogus",
 		}
 	}, "No such pre-upload step: bogus")
+
+	testErr(func(c *CommonRepoManagerConfig) {
+		c.SensitiveChanges = &sensitive.Config{}
+	}, "SensitiveChanges validation failed: At least one rule is required.")
 }
 
 func TestDepotToolsConfigValidation(t *testing.T) {
@@ -74,3 +83,157 @@ func TestDepotToolsConfigValidation(t *testing.T) {
 	cfg.ParentRepo = ""
 	require.EqualError(t, cfg.Validate(), "ParentRepo is required.")
 }
+
+func TestBuildCommitMsgSensitiveChanges(t *testing.T) {
+	unittest.SmallTest(t)
+
+	tmpl, err := ParseCommitMsgTemplate(TMPL_COMMIT_MSG_DEFAULT)
+	require.NoError(t, err)
+	classifier, err := sensitive.NewClassifier(&sensitive.Config{
+		Rules: []*sensitive.Rule{
+			{
+				Name:  "third_party",
+				Paths: []string{"third_party/"},
+			},
+			{
+				Name:     "build flags",
+				Keywords: []string{"is_official_build"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	r := &commonRepoManager{
+		childPath:     "path/to/child",
+		commitMsgTmpl: tmpl,
+		sensitive:     classifier,
+	}
+	a := &revision.Revision{Id: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Display: "aaaaaaaaaaaa"}
+	b := &revision.Revision{Id: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Display: "bbbbbbbbbbbb", Files: []string{"third_party/foo.c"}}
+	c := &revision.Revision{Id: "cccccccccccccccccccccccccccccccccccccccc", Display: "cccccccccccc", Files: []string{"third_party/bar.c"}}
+	d := &revision.Revision{Id: "dddddddddddddddddddddddddddddddddddddddd", Display: "dddddddddddd", Details: "Set is_official_build"}
+	vars := &CommitMsgVars{
+		ChildPath:   "path/to/child",
+		ChildRepo:   "https://child-repo.git",
+		Reviewers:   []string{"me@google.com"},
+		Revisions:   []*revision.Revision{d, c, b},
+		RollingFrom: a,
+		RollingTo:   d,
+		ServerURL:   "https://fake.server.url",
+	}
+	msg, err := r.buildCommitMsg(vars)
+	require.NoError(t, err)
+	require.Contains(t, msg, `
+Sensitive changes:
+  third_party: cccccccccccc, bbbbbbbbbbbb
+  build flags: dddddddddddd
+
+Created with:`)
+	require.False(t, vars.ReviewRequired)
+
+	// Call out the need for human review.
+	classifier, err = sensitive.NewClassifier(&sensitive.Config{
+		Rules: []*sensitive.Rule{
+			{
+				Name:  "third_party",
+				Paths: []string{"third_party/"},
+			},
+		},
+		RequireReview: true,
+	})
+	require.NoError(t, err)
+	r.sensitive = classifier
+	msg, err = r.buildCommitMsg(vars)
+	require.NoError(t, err)
+	require.Contains(t, msg, `
+Sensitive changes (human review required):
+  third_party: cccccccccccc, bbbbbbbbbbbb
+`)
+	require.True(t, vars.ReviewRequired)
+
+	// No section if nothing matches.
+	vars.Revisions = []*revision.Revision{d}
+	msg, err = r.buildCommitMsg(vars)
+	require.NoError(t, err)
+	require.NotContains(t, msg, "Sensitive changes")
+	require.False(t, vars.ReviewRequired)
+}
+
+func TestGetCommitsNotRolledChangedFiles(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx := context.Background()
+	gb := git_testutils.GitInit(t, ctx)
+	defer gb.Cleanup()
+	c0 := gb.CommitGen(ctx, "README")
+	c1 := gb.CommitGen(ctx, "third_party/foo.c")
+	c2 := gb.CommitGen(ctx, "src/bar.c")
+
+	classifier, err := sensitive.NewClassifier(&sensitive.Config{
+		Rules: []*sensitive.Rule{
+			{
+				Name:  "third_party",
+				Paths: []string{"third_party/"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	r := &commonRepoManager{
+		childRepo: &git.Checkout{GitDir: git.GitDir(gb.Dir())},
+		sensitive: classifier,
+	}
+	revs, err := r.getCommitsNotRolled(ctx, &revision.Revision{Id: c0}, &revision.Revision{Id: c2})
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	require.Equal(t, c2, revs[0].Id)
+	require.Equal(t, []string{"src/bar.c"}, revs[0].Files)
+	require.Equal(t, c1, revs[1].Id)
+	require.Equal(t, []string{"third_party/foo.c"}, revs[1].Files)
+	require.Equal(t, map[string][]string{
+		c1: {"third_party/foo.c"},
+		c2: {"src/bar.c"},
+	}, r.changedFiles)
+
+	// Changed files are not looked up again for commits we've already seen.
+	r.changedFiles[c2] = []string{"cached.c"}
+	c3 := gb.CommitGen(ctx, "third_party/baz.c")
+	revs, err = r.getCommitsNotRolled(ctx, &revision.Revision{Id: c1}, &revision.Revision{Id: c3})
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	require.Equal(t, []string{"third_party/baz.c"}, revs[0].Files)
+	require.Equal(t, []string{"cached.c"}, revs[1].Files)
+
+	// Commits which have been rolled are forgotten.
+	require.Equal(t, map[string][]string{
+		c2: {"cached.c"},
+		c3: {"third_party/baz.c"},
+	}, r.changedFiles)
+}
+
+func TestGetChangedFilesMergeCommit(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx := context.Background()
+	gb := git_testutils.GitInit(t, ctx)
+	defer gb.Cleanup()
+	c0 := gb.CommitGen(ctx, "README")
+	gb.CreateBranchTrackBranch(ctx, "branch2", "master")
+	gb.CommitGen(ctx, "third_party/foo.c")
+	gb.CheckoutBranch(ctx, "master")
+	c := gb.CommitGen(ctx, "src/bar.c")
+	merge := gb.MergeBranch(ctx, "branch2")
+
+	r := &commonRepoManager{
+		childRepo: &git.Checkout{GitDir: git.GitDir(gb.Dir())},
+	}
+	files, err := r.getChangedFiles(ctx, c0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"README"}, files)
+	files, err = r.getChangedFiles(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, []string{"src/bar.c"}, files)
+
+	// Merge commits include the files changed relative to the first parent.
+	files, err = r.getChangedFiles(ctx, merge)
+	require.NoError(t, err)
+	require.Equal(t, []string{"third_party/foo.c"}, files)
+}
@@ -112,7 +112,7 @@ func gerritCR(t *testing.T, g gerrit.GerritInterface) codereview.CodeReview {
 		URL:     "https://skia-review.googlesource.com",
 		Project: "skia",
 		Config:  codereview.GERRIT_CONFIG_CHROMIUM,
-	}).Init(g, nil)
+	}).Init(g, nil, nil)
 	require.NoError(t, err)
 	return rv
 }
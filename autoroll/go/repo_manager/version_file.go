@@ -0,0 +1,645 @@
+package repo_manager
+
+/*
+	Helpers for reading and updating a version pinned in a file, used by the
+	file-pin RepoManager.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Supported formats for VersionFileFormat.
+	VERSION_FILE_FORMAT_GO_MOD = "go.mod"
+	VERSION_FILE_FORMAT_JSON   = "json"
+	VERSION_FILE_FORMAT_TOML   = "toml"
+	VERSION_FILE_FORMAT_YAML   = "yaml"
+)
+
+var (
+	VALID_VERSION_FILE_FORMATS = []string{
+		VERSION_FILE_FORMAT_GO_MOD,
+		VERSION_FILE_FORMAT_JSON,
+		VERSION_FILE_FORMAT_TOML,
+		VERSION_FILE_FORMAT_YAML,
+	}
+)
+
+// versionFile reads and updates the version pinned in the contents of a file.
+type versionFile interface {
+	// Get returns the version pinned in the given file contents.
+	Get(contents string) (string, error)
+
+	// Set returns the given file contents with the pinned version replaced
+	// by the given version. All other contents, including formatting and
+	// comments, are preserved.
+	Set(contents, version string) (string, error)
+}
+
+// versionFileFormat returns the format of the given version file, inferring it
+// from the file name if not provided.
+func versionFileFormat(file, format string) (string, error) {
+	if format != "" {
+		for _, f := range VALID_VERSION_FILE_FORMATS {
+			if format == f {
+				return format, nil
+			}
+		}
+		return "", fmt.Errorf("Invalid VersionFileFormat %q; expected one of %v", format, VALID_VERSION_FILE_FORMATS)
+	}
+	base := path.Base(file)
+	switch {
+	case base == "go.mod":
+		return VERSION_FILE_FORMAT_GO_MOD, nil
+	case strings.HasSuffix(base, ".json"):
+		return VERSION_FILE_FORMAT_JSON, nil
+	case strings.HasSuffix(base, ".toml"):
+		return VERSION_FILE_FORMAT_TOML, nil
+	case strings.HasSuffix(base, ".yaml"), strings.HasSuffix(base, ".yml"):
+		return VERSION_FILE_FORMAT_YAML, nil
+	}
+	return "", fmt.Errorf("Unable to infer the format of %q; VersionFileFormat is required.", file)
+}
+
+// newVersionFile returns a versionFile which uses either the given regular
+// expression or the given key path, in which case the format of the file is
+// inferred from its name if not provided. Exactly one of versionRegex or key
+// is required.
+func newVersionFile(file, format, key, versionRegex string) (versionFile, error) {
+	if (key == "") == (versionRegex == "") {
+		return nil, errors.New("Exactly one of VersionKey or VersionRegex is required.")
+	}
+	if versionRegex != "" {
+		re, err := regexp.Compile(versionRegex)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid VersionRegex: %s", err)
+		}
+		if re.NumSubexp() != 1 {
+			return nil, fmt.Errorf("VersionRegex must contain exactly one capture group, not %d.", re.NumSubexp())
+		}
+		return &regexVersionFile{re: re}, nil
+	}
+	format, err := versionFileFormat(file, format)
+	if err != nil {
+		return nil, err
+	}
+	if format == VERSION_FILE_FORMAT_GO_MOD {
+		return &goModVersionFile{module: key}, nil
+	}
+	return &keyVersionFile{
+		format: format,
+		key:    strings.Split(key, "."),
+	}, nil
+}
+
+// setAndVerify is a helper for versionFile.Set implementations which verifies
+// that the pinned version was updated as expected.
+func setAndVerify(vf versionFile, newContents, version string) (string, error) {
+	actual, err := vf.Get(newContents)
+	if err != nil {
+		return "", fmt.Errorf("Failed to verify updated version: %s", err)
+	}
+	if actual != version {
+		return "", fmt.Errorf("Failed to update version; expected %q but got %q", version, actual)
+	}
+	return newContents, nil
+}
+
+// regexVersionFile is a versionFile which finds the version using a regular
+// expression with a single capture group.
+type regexVersionFile struct {
+	re *regexp.Regexp
+}
+
+// find returns the start and end indexes of the version in the contents.
+func (f *regexVersionFile) find(contents string) (int, int, error) {
+	matches := f.re.FindAllStringSubmatchIndex(contents, -1)
+	if len(matches) == 0 {
+		return 0, 0, fmt.Errorf("Found no match for %q", f.re.String())
+	} else if len(matches) > 1 {
+		return 0, 0, fmt.Errorf("Found %d matches for %q; expected exactly one", len(matches), f.re.String())
+	}
+	return matches[0][2], matches[0][3], nil
+}
+
+// See documentation for versionFile interface.
+func (f *regexVersionFile) Get(contents string) (string, error) {
+	start, end, err := f.find(contents)
+	if err != nil {
+		return "", err
+	}
+	return contents[start:end], nil
+}
+
+// See documentation for versionFile interface.
+func (f *regexVersionFile) Set(contents, version string) (string, error) {
+	start, end, err := f.find(contents)
+	if err != nil {
+		return "", err
+	}
+	return setAndVerify(f, contents[:start]+version+contents[end:], version)
+}
+
+// span is the location of a value within file contents.
+type span struct {
+	start int
+	end   int
+}
+
+// goModVersionFile is a versionFile which finds the required version of a
+// module in a go.mod file.
+type goModVersionFile struct {
+	module string
+}
+
+// find returns the location of the required version of the module.
+func (f *goModVersionFile) find(contents string) (span, error) {
+	var found []span
+	inRequire := false
+	offset := 0
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		lineStart := offset
+		offset += len(line)
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if inRequire {
+			if fields[0] == ")" {
+				inRequire = false
+				continue
+			}
+		} else if fields[0] == "require" {
+			if len(fields) == 2 && fields[1] == "(" {
+				inRequire = true
+				continue
+			}
+			fields = fields[1:]
+		} else {
+			continue
+		}
+		if len(fields) < 2 || fields[0] != f.module {
+			continue
+		}
+		// Find the version after the module path.
+		modIdx := strings.Index(line, f.module)
+		verIdx := modIdx + len(f.module) + strings.Index(line[modIdx+len(f.module):], fields[1])
+		found = append(found, span{
+			start: lineStart + verIdx,
+			end:   lineStart + verIdx + len(fields[1]),
+		})
+	}
+	if len(found) == 0 {
+		return span{}, fmt.Errorf("Module %q is not required in go.mod", f.module)
+	} else if len(found) > 1 {
+		return span{}, fmt.Errorf("Module %q is required %d times in go.mod", f.module, len(found))
+	}
+	return found[0], nil
+}
+
+// See documentation for versionFile interface.
+func (f *goModVersionFile) Get(contents string) (string, error) {
+	s, err := f.find(contents)
+	if err != nil {
+		return "", err
+	}
+	return contents[s.start:s.end], nil
+}
+
+// See documentation for versionFile interface.
+func (f *goModVersionFile) Set(contents, version string) (string, error) {
+	s, err := f.find(contents)
+	if err != nil {
+		return "", err
+	}
+	return setAndVerify(f, contents[:s.start]+version+contents[s.end:], version)
+}
+
+// keyVersionFile is a versionFile which finds the version using a key path
+// within a structured (JSON, TOML, or YAML) file. The file is parsed to
+// retrieve the version, but it is updated in place to preserve formatting and
+// comments, so only the following forms are supported when updating:
+//
+//   - JSON: string values within objects; not values within arrays.
+//   - TOML: single-line string values of key/value pairs in tables, whose
+//     keys may be quoted. Values within inline tables, arrays, and arrays of
+//     tables are not supported, nor are multi-line strings or dotted keys.
+//   - YAML: scalar values within block mappings. Values within sequences and
+//     flow collections are not supported, nor are block scalars, anchors,
+//     aliases, or tags. Unquoted values which YAML parses as another type,
+//     eg. 1.20, are returned as written.
+//
+// Updates to unsupported forms fail rather than producing incorrect results.
+type keyVersionFile struct {
+	format string
+	key    []string
+}
+
+// parse parses the given file contents.
+func (f *keyVersionFile) parse(contents string) (interface{}, error) {
+	var data interface{}
+	switch f.format {
+	case VERSION_FILE_FORMAT_JSON:
+		if err := json.Unmarshal([]byte(contents), &data); err != nil {
+			return nil, fmt.Errorf("Failed to parse JSON: %s", err)
+		}
+	case VERSION_FILE_FORMAT_TOML:
+		tree, err := toml.Load(contents)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse TOML: %s", err)
+		}
+		data = tree.ToMap()
+	case VERSION_FILE_FORMAT_YAML:
+		if err := yaml.Unmarshal([]byte(contents), &data); err != nil {
+			return nil, fmt.Errorf("Failed to parse YAML: %s", err)
+		}
+	}
+	return data, nil
+}
+
+// lookup returns the value for the key path within the given parsed contents,
+// along with a func which deletes it.
+func (f *keyVersionFile) lookup(data interface{}) (interface{}, func(), error) {
+	var del func()
+	for i, k := range f.key {
+		var next interface{}
+		found := false
+		switch m := data.(type) {
+		case map[string]interface{}:
+			next, found = m[k]
+			del = func() { delete(m, k) }
+		case map[interface{}]interface{}:
+			next, found = m[k]
+			del = func() { delete(m, k) }
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("Key %q not found", strings.Join(f.key[:i+1], "."))
+		}
+		data = next
+	}
+	return data, del, nil
+}
+
+// find returns the location of the value for the key path in the given
+// contents.
+func (f *keyVersionFile) find(contents string) (span, error) {
+	switch f.format {
+	case VERSION_FILE_FORMAT_JSON:
+		return findJSONValue(contents, f.key)
+	case VERSION_FILE_FORMAT_TOML:
+		return findTOMLValue(contents, f.key)
+	default:
+		return findYAMLValue(contents, f.key)
+	}
+}
+
+// See documentation for versionFile interface.
+func (f *keyVersionFile) Get(contents string) (string, error) {
+	data, err := f.parse(contents)
+	if err != nil {
+		return "", err
+	}
+	value, _, err := f.lookup(data)
+	if err != nil {
+		return "", err
+	}
+	if rv, ok := value.(string); ok {
+		return rv, nil
+	}
+	if f.format == VERSION_FILE_FORMAT_YAML {
+		// Unquoted versions like 1.20 are parsed as numbers; use the
+		// value as written, as long as it is the same scalar.
+		if s, err := findYAMLValue(contents, f.key); err == nil {
+			raw := contents[s.start:s.end]
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(raw), &parsed); err == nil && reflect.DeepEqual(parsed, value) {
+				return raw, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Value of %q is not a string: %v", strings.Join(f.key, "."), value)
+}
+
+// See documentation for versionFile interface.
+func (f *keyVersionFile) Set(contents, version string) (string, error) {
+	if _, err := f.Get(contents); err != nil {
+		return "", err
+	}
+	// Replace the value in place to preserve formatting and comments.
+	s, err := f.find(contents)
+	if err != nil {
+		return "", fmt.Errorf("Unable to update %q in place: %s", strings.Join(f.key, "."), err)
+	}
+	newContents := contents[:s.start] + version + contents[s.end:]
+
+	// Verify that nothing else changed.
+	oldData, err := f.parse(contents)
+	if err != nil {
+		return "", err
+	}
+	newData, err := f.parse(newContents)
+	if err != nil {
+		return "", fmt.Errorf("Failed to verify updated version: %s", err)
+	}
+	for _, data := range []interface{}{oldData, newData} {
+		_, del, err := f.lookup(data)
+		if err != nil {
+			return "", fmt.Errorf("Failed to verify updated version: %s", err)
+		}
+		del()
+	}
+	if !reflect.DeepEqual(oldData, newData) {
+		return "", fmt.Errorf("Failed to update version; contents other than %q changed", strings.Join(f.key, "."))
+	}
+	return setAndVerify(f, newContents, version)
+}
+
+// checkFound is a helper for the find*Value functions which returns the only
+// span found for the given key, or an error if there is not exactly one.
+func checkFound(found []span, key []string) (span, error) {
+	if len(found) == 0 {
+		return span{}, fmt.Errorf("Key %q not found", strings.Join(key, "."))
+	} else if len(found) > 1 {
+		return span{}, fmt.Errorf("Key %q found %d times", strings.Join(key, "."), len(found))
+	}
+	return found[0], nil
+}
+
+// checkUnsupported is a helper for the find*Value functions which returns an
+// error if the given path, whose value is written in the given unsupported
+// form, is the wanted key path or one of its parents.
+func checkUnsupported(path, want, form string) error {
+	if path == want || strings.HasPrefix(want, path+".") {
+		return fmt.Errorf("Value of %q is %s, which is not supported", path, form)
+	}
+	return nil
+}
+
+// findJSONValue returns the location of the string value for the given key
+// path within the given JSON contents, excluding the quotes. Values within
+// arrays are not supported.
+func findJSONValue(contents string, key []string) (span, error) {
+	want := strings.Join(key, ".")
+	type frame struct {
+		isObject bool
+		key      string
+	}
+	var stack []*frame
+	var found []span
+	expectKey := false
+	for i := 0; i < len(contents); i++ {
+		switch contents[i] {
+		case '{':
+			stack = append(stack, &frame{isObject: true})
+			expectKey = true
+		case '[':
+			stack = append(stack, &frame{})
+			expectKey = false
+		case '}', ']':
+			if len(stack) == 0 {
+				return span{}, errors.New("Invalid JSON: unbalanced brackets")
+			}
+			stack = stack[:len(stack)-1]
+			expectKey = false
+		case ',':
+			expectKey = len(stack) > 0 && stack[len(stack)-1].isObject
+		case '"':
+			end := i + 1
+			for ; end < len(contents) && contents[end] != '"'; end++ {
+				if contents[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(contents) {
+				return span{}, errors.New("Invalid JSON: unterminated string")
+			}
+			str := contents[i+1 : end]
+			if len(stack) > 0 && stack[len(stack)-1].isObject && expectKey {
+				stack[len(stack)-1].key = str
+				expectKey = false
+			} else {
+				path := make([]string, 0, len(stack))
+				for _, f := range stack {
+					if f.isObject {
+						path = append(path, f.key)
+					} else {
+						path = append(path, "[]")
+					}
+				}
+				if strings.Join(path, ".") == want {
+					found = append(found, span{start: i + 1, end: end})
+				}
+			}
+			i = end
+		}
+	}
+	return checkFound(found, key)
+}
+
+// findYAMLValue returns the location of the scalar value for the given key
+// path within the given YAML contents, excluding any quotes. Only block
+// mappings are supported; keys within sequences are not.
+func findYAMLValue(contents string, key []string) (span, error) {
+	want := strings.Join(key, ".")
+	type frame struct {
+		indent int
+		key    string
+	}
+	var stack []frame
+	var found []span
+	offset := 0
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		lineStart := offset
+		offset += len(line)
+		content := strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(content) - len(trimmed)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			stack = append(stack, frame{indent: indent, key: "[]"})
+			continue
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon < 0 || (colon+1 < len(trimmed) && trimmed[colon+1] != ' ') {
+			continue
+		}
+		k := strings.Trim(trimmed[:colon], `"'`)
+		value := trimmed[colon+1:]
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = value[:idx]
+		}
+		if strings.TrimSpace(value) == "" {
+			stack = append(stack, frame{indent: indent, key: k})
+			continue
+		}
+		path := make([]string, 0, len(stack)+1)
+		for _, f := range stack {
+			path = append(path, f.key)
+		}
+		fullKey := strings.Join(append(path, k), ".")
+		if first := strings.TrimSpace(value)[0]; strings.IndexByte("{[|>&*!", first) >= 0 {
+			if err := checkUnsupported(fullKey, want, fmt.Sprintf("a YAML node starting with %q", first)); err != nil {
+				return span{}, err
+			}
+			continue
+		}
+		if fullKey != want {
+			continue
+		}
+		start := lineStart + indent + colon + 1 + len(value) - len(strings.TrimLeft(value, " "))
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			start++
+			value = value[1 : len(value)-1]
+		}
+		found = append(found, span{start: start, end: start + len(value)})
+	}
+	return checkFound(found, key)
+}
+
+// scanTOMLString returns the index of the closing quote of the single-line
+// TOML string which starts at the given index, or -1 if it is unterminated.
+// Escapes are only recognized in basic (double-quoted) strings.
+func scanTOMLString(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+		} else if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// scanTOMLKey returns the index of the first occurrence of the given delimiter
+// in the given string which is not within a quoted key, or -1 if there is none.
+func scanTOMLKey(s string, delim byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\'' {
+			if i = scanTOMLString(s, i); i < 0 {
+				return -1
+			}
+		} else if s[i] == delim {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitTOMLKey splits a TOML key into its dotted parts, removing quotes.
+// Quoted parts may contain dots.
+func splitTOMLKey(key string) ([]string, error) {
+	var parts []string
+	for {
+		end := scanTOMLKey(key, '.')
+		part := key
+		if end >= 0 {
+			part = key[:end]
+		}
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '"' || part[0] == '\'') {
+			if scanTOMLString(part, 0) != len(part)-1 {
+				return nil, fmt.Errorf("Invalid TOML key: %s", key)
+			}
+			part = part[1 : len(part)-1]
+		}
+		parts = append(parts, part)
+		if end < 0 {
+			return parts, nil
+		}
+		key = key[end+1:]
+	}
+}
+
+// findTOMLValue returns the location of the string value for the given key
+// path within the given TOML contents, excluding the quotes. Only single-line
+// string values of key/value pairs in tables are supported.
+func findTOMLValue(contents string, key []string) (span, error) {
+	want := strings.Join(key, ".")
+	var found []span
+	var table []string
+	offset := 0
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		lineStart := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			// Keys within arrays of tables are not supported, so
+			// give them a path which can't match.
+			isArray := strings.HasPrefix(trimmed, "[[")
+			header := strings.TrimLeft(trimmed, "[")
+			end := scanTOMLKey(header, ']')
+			if end < 0 {
+				return span{}, fmt.Errorf("Invalid TOML table header: %s", trimmed)
+			}
+			var err error
+			table, err = splitTOMLKey(header[:end])
+			if err != nil {
+				return span{}, err
+			}
+			if isArray {
+				table = append(table, "[]")
+			}
+			continue
+		}
+		eq := scanTOMLKey(line, '=')
+		if eq < 0 {
+			continue
+		}
+		k, err := splitTOMLKey(line[:eq])
+		if err != nil {
+			return span{}, err
+		}
+		fullKey := strings.Join(append(append([]string{}, table...), k...), ".")
+		value := line[eq+1:]
+		valueStart := len(value) - len(strings.TrimLeft(value, " \t"))
+		value = value[valueStart:]
+		if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+			if err := checkUnsupported(fullKey, want, "an inline table or array"); err != nil {
+				return span{}, err
+			}
+			continue
+		}
+		if fullKey != want {
+			continue
+		}
+		if strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, `'''`) {
+			return span{}, checkUnsupported(fullKey, want, "a multi-line string")
+		}
+		if len(value) == 0 || (value[0] != '"' && value[0] != '\'') {
+			return span{}, fmt.Errorf("Value of %q is not a string", want)
+		}
+		end := scanTOMLString(value, 0)
+		if end < 0 {
+			return span{}, fmt.Errorf("Unterminated string value for %q", want)
+		}
+		start := lineStart + eq + 1 + valueStart + 1
+		found = append(found, span{
+			start: start,
+			end:   start + end - 1,
+		})
+	}
+	return checkFound(found, key)
+}
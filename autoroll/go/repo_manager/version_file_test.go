@@ -0,0 +1,208 @@
+package repo_manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+// testVersionFile asserts that the versionFile finds the expected version in
+// the given contents and updates it to produce the expected contents.
+func testVersionFile(t *testing.T, vf versionFile, contents, oldVersion, newVersion, expect string) {
+	actual, err := vf.Get(contents)
+	require.NoError(t, err)
+	require.Equal(t, oldVersion, actual)
+	updated, err := vf.Set(contents, newVersion)
+	require.NoError(t, err)
+	require.Equal(t, expect, updated)
+}
+
+func TestVersionFileConfig(t *testing.T) {
+	unittest.SmallTest(t)
+	test := func(file, format, key, re, expectErr string) {
+		_, err := newVersionFile(file, format, key, re)
+		if expectErr == "" {
+			require.NoError(t, err)
+		} else {
+			require.EqualError(t, err, expectErr)
+		}
+	}
+	test("VERSION", "", "", "", "Exactly one of VersionKey or VersionRegex is required.")
+	test("VERSION", "", "a", "(.*)", "Exactly one of VersionKey or VersionRegex is required.")
+	test("VERSION", "", "", ".*", "VersionRegex must contain exactly one capture group, not 0.")
+	test("VERSION", "", "", "(.*)", "")
+	test("VERSION", "", "a", "", "Unable to infer the format of \"VERSION\"; VersionFileFormat is required.")
+	test("VERSION", "xml", "a", "", "Invalid VersionFileFormat \"xml\"; expected one of [go.mod json toml yaml]")
+	test("VERSION", "json", "a", "", "")
+	test("dir/go.mod", "", "a", "", "")
+	test("Cargo.toml", "", "a", "", "")
+	test("config.yml", "", "a", "", "")
+}
+
+func TestVersionFileRegex(t *testing.T) {
+	unittest.SmallTest(t)
+	vf, err := newVersionFile("build.gradle", "", "", `childVersion = '([^']+)'`)
+	require.NoError(t, err)
+	testVersionFile(t, vf, "a = 'b'\nchildVersion = '1.2.3'\n", "1.2.3", "1.3.0", "a = 'b'\nchildVersion = '1.3.0'\n")
+
+	_, err = vf.Get("nothing here")
+	require.EqualError(t, err, "Found no match for \"childVersion = '([^']+)'\"")
+	_, err = vf.Get("childVersion = '1'\nchildVersion = '2'")
+	require.EqualError(t, err, "Found 2 matches for \"childVersion = '([^']+)'\"; expected exactly one")
+}
+
+func TestVersionFileGoMod(t *testing.T) {
+	unittest.SmallTest(t)
+	vf, err := newVersionFile("go.mod", "", "github.com/foo/bar", "")
+	require.NoError(t, err)
+	contents := `module example.com/me
+
+require (
+	github.com/foo/bar v1.2.3 // indirect
+	github.com/foo/bar/v2 v2.0.0
+)
+
+require github.com/baz/qux v0.1.0
+`
+	testVersionFile(t, vf, contents, "v1.2.3", "v1.3.0", `module example.com/me
+
+require (
+	github.com/foo/bar v1.3.0 // indirect
+	github.com/foo/bar/v2 v2.0.0
+)
+
+require github.com/baz/qux v0.1.0
+`)
+
+	vf, err = newVersionFile("go.mod", "", "github.com/baz/qux", "")
+	require.NoError(t, err)
+	testVersionFile(t, vf, contents, "v0.1.0", "v0.2.0", strings.Replace(contents, "v0.1.0", "v0.2.0", 1))
+
+	vf, err = newVersionFile("go.mod", "", "github.com/missing", "")
+	require.NoError(t, err)
+	_, err = vf.Get(contents)
+	require.EqualError(t, err, "Module \"github.com/missing\" is not required in go.mod")
+}
+
+func TestVersionFileJSON(t *testing.T) {
+	unittest.SmallTest(t)
+	vf, err := newVersionFile("package.json", "", "dependencies.foo", "")
+	require.NoError(t, err)
+	contents := `{
+  "name": "me",
+  "dependencies": {
+    "bar": "1.0.0",
+    "foo": "^2.1.0"
+  },
+  "devDependencies": {
+    "foo": "^2.1.0"
+  }
+}
+`
+	// The same key and value appear elsewhere in the file.
+	testVersionFile(t, vf, contents, "^2.1.0", "^2.2.0", strings.Replace(contents, `"foo": "^2.1.0"`, `"foo": "^2.2.0"`, 1))
+
+	vf, err = newVersionFile("package.json", "", "dependencies.baz", "")
+	require.NoError(t, err)
+	_, err = vf.Get(contents)
+	require.EqualError(t, err, "Key \"dependencies.baz\" not found")
+	vf, err = newVersionFile("package.json", "", "dependencies", "")
+	require.NoError(t, err)
+	_, err = vf.Get(contents)
+	require.Error(t, err)
+
+	// Values within arrays are not supported, but don't interfere with
+	// other keys.
+	contents = `{"deps": [{"name": "child", "version": "1.0"}], "version": "2.0"}`
+	vf, err = newVersionFile("package.json", "", "version", "")
+	require.NoError(t, err)
+	testVersionFile(t, vf, contents, "2.0", "2.1", `{"deps": [{"name": "child", "version": "1.0"}], "version": "2.1"}`)
+	vf, err = newVersionFile("package.json", "", "deps.version", "")
+	require.NoError(t, err)
+	_, err = vf.Get(contents)
+	require.EqualError(t, err, "Key \"deps.version\" not found")
+
+	// Versions which would change other contents are rejected.
+	_, err = vf.Set(`{"deps": {"version": "1.0"}}`, `1.1", "other": "x`)
+	require.EqualError(t, err, "Failed to update version; contents other than \"deps.version\" changed")
+}
+
+func TestVersionFileYAML(t *testing.T) {
+	unittest.SmallTest(t)
+	vf, err := newVersionFile("deps.yaml", "", "deps.child.version", "")
+	require.NoError(t, err)
+	contents := `# Pinned dependencies.
+deps:
+  other:
+    version: "1.0"
+  child:
+    url: https://child.googlesource.com
+    version: "1.0" # Rolled automatically.
+`
+	testVersionFile(t, vf, contents, "1.0", "1.1", `# Pinned dependencies.
+deps:
+  other:
+    version: "1.0"
+  child:
+    url: https://child.googlesource.com
+    version: "1.1" # Rolled automatically.
+`)
+
+	// Unquoted versions are returned as written.
+	vf, err = newVersionFile("deps.yaml", "", "child.version", "")
+	require.NoError(t, err)
+	testVersionFile(t, vf, "child:\n  version: 1.20\n", "1.20", "1.21", "child:\n  version: 1.21\n")
+
+	// Flow collections are not supported.
+	contents = "child: {version: \"1.0\"}\n"
+	actual, err := vf.Get(contents)
+	require.NoError(t, err)
+	require.Equal(t, "1.0", actual)
+	_, err = vf.Set(contents, "1.1")
+	require.EqualError(t, err, "Unable to update \"child.version\" in place: Value of \"child\" is a YAML node starting with '{', which is not supported")
+}
+
+func TestVersionFileTOML(t *testing.T) {
+	unittest.SmallTest(t)
+	vf, err := newVersionFile("Cargo.toml", "", "dependencies.child.version", "")
+	require.NoError(t, err)
+	contents := `[package]
+version = "0.1.0"
+
+[dependencies.child]
+git = "https://child.googlesource.com"
+version = "1.2.3" # Rolled automatically.
+`
+	testVersionFile(t, vf, contents, "1.2.3", "1.3.0", strings.Replace(contents, "1.2.3", "1.3.0", 1))
+
+	vf, err = newVersionFile("Cargo.toml", "", "dependencies.child", "")
+	require.NoError(t, err)
+	testVersionFile(t, vf, "[dependencies]\nchild = '1.0'\n", "1.0", "2.0", "[dependencies]\nchild = '2.0'\n")
+
+	vf, err = newVersionFile("Cargo.toml", "", "package.edition", "")
+	require.NoError(t, err)
+	_, err = vf.Get(contents)
+	require.EqualError(t, err, "Key \"package.edition\" not found")
+
+	// Quoted keys may contain '=' and '.'.
+	vf, err = newVersionFile("Cargo.toml", "", "dependencies.a=b", "")
+	require.NoError(t, err)
+	contents = "[dependencies]\n\"a.b\" = \"0.1\"\n\"a=b\" = \"1.0\"\n"
+	testVersionFile(t, vf, contents, "1.0", "1.1", "[dependencies]\n\"a.b\" = \"0.1\"\n\"a=b\" = \"1.1\"\n")
+
+	// Inline tables and arrays of tables are not supported.
+	vf, err = newVersionFile("Cargo.toml", "", "dependencies.child.version", "")
+	require.NoError(t, err)
+	contents = "[dependencies]\nchild = { version = \"1.0\" }\n"
+	actual, err := vf.Get(contents)
+	require.NoError(t, err)
+	require.Equal(t, "1.0", actual)
+	_, err = vf.Set(contents, "1.1")
+	require.EqualError(t, err, "Unable to update \"dependencies.child.version\" in place: Value of \"dependencies.child\" is an inline table or array, which is not supported")
+	vf, err = newVersionFile("Cargo.toml", "", "bin.name", "")
+	require.NoError(t, err)
+	_, err = vf.Get("[[bin]]\nname = \"child\"\n")
+	require.EqualError(t, err, "Key \"bin.name\" not found")
+}
@@ -0,0 +1,330 @@
+package revert
+
+/*
+	Watch the parent tree after a roll lands and detect breakages which are
+	likely to have been caused by the roll, so that the roller can revert it.
+	A breakage is only attributed to the roll if the tree closed after the
+	roll landed and at least one failing build includes the roll in its
+	blamelist.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/gcs"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/human"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// Default period after a roll lands during which breakages of the
+	// parent tree are attributed to the roll.
+	DEFAULT_WATCH_PERIOD = time.Hour
+
+	// States of the tree, as reported by the tree status endpoint.
+	TREE_STATE_CLOSED    = "closed"
+	TREE_STATE_OPEN      = "open"
+	TREE_STATE_THROTTLED = "throttled"
+
+	// Maximum number of suspected culprits to list individually.
+	MAX_CULPRITS = 20
+)
+
+// Config provides configuration for automatically reverting rolls which break
+// the parent tree.
+type Config struct {
+	// TreeStatusURL is the URL of the parent tree status endpoint, eg.
+	// "https://tree-status.skia.org/current". The endpoint returns a JSON
+	// object with a "general_state" of "open", "throttled" or "closed",
+	// and an optional "message".
+	TreeStatusURL string `json:"treeStatusURL"`
+
+	// FailingBuildsURL is the URL of an endpoint which lists the currently
+	// failing builds in the parent repo. The endpoint returns a JSON list
+	// of objects with a "name", a "url" and a "blamelist" of parent commit
+	// IDs which may have caused the failure.
+	FailingBuildsURL string `json:"failingBuildsURL"`
+
+	// WatchPeriod is how long after a roll lands the roller watches the
+	// parent tree, eg. "2h". Defaults to DEFAULT_WATCH_PERIOD.
+	WatchPeriod string `json:"watchPeriod,omitempty"`
+}
+
+// See documentation for util.Validator interface.
+func (c *Config) Validate() error {
+	if c.TreeStatusURL == "" {
+		return errors.New("TreeStatusURL is required.")
+	}
+	if c.FailingBuildsURL == "" {
+		return errors.New("FailingBuildsURL is required.")
+	}
+	if c.WatchPeriod != "" {
+		if _, err := human.ParseDuration(c.WatchPeriod); err != nil {
+			return fmt.Errorf("Invalid WatchPeriod: %s", err)
+		}
+	}
+	return nil
+}
+
+// GetWatchPeriod returns the WatchPeriod as a time.Duration.
+func (c *Config) GetWatchPeriod() time.Duration {
+	if c.WatchPeriod == "" {
+		return DEFAULT_WATCH_PERIOD
+	}
+	// Validate ensures that this succeeds.
+	rv, _ := human.ParseDuration(c.WatchPeriod)
+	return rv
+}
+
+// TreeStatus is the status of the parent tree.
+type TreeStatus struct {
+	GeneralState string `json:"general_state"`
+	Message      string `json:"message"`
+}
+
+// GetTreeStatus retrieves the TreeStatus from the given URL.
+func GetTreeStatus(ctx context.Context, client *http.Client, url string) (*TreeStatus, error) {
+	var rv TreeStatus
+	if err := getJSON(ctx, client, url, &rv); err != nil {
+		return nil, fmt.Errorf("Failed to retrieve tree status: %s", err)
+	}
+	return &rv, nil
+}
+
+// FailingBuild is a failing build in the parent repo.
+type FailingBuild struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	// Blamelist contains the IDs of the parent commits which may have
+	// caused the failure.
+	Blamelist []string `json:"blamelist"`
+}
+
+// GetFailingBuilds retrieves the FailingBuilds from the given URL.
+func GetFailingBuilds(ctx context.Context, client *http.Client, url string) ([]*FailingBuild, error) {
+	var rv []*FailingBuild
+	if err := getJSON(ctx, client, url, &rv); err != nil {
+		return nil, fmt.Errorf("Failed to retrieve failing builds: %s", err)
+	}
+	return rv, nil
+}
+
+// getJSON retrieves the given URL and decodes the JSON response into dst.
+func getJSON(ctx context.Context, client *http.Client, url string, dst interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s", resp.Status, httputils.ReadAndClose(resp.Body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return fmt.Errorf("Failed to decode response: %s", err)
+	}
+	return nil
+}
+
+// Breakage describes a breakage of the parent tree which is correlated with a
+// roll.
+type Breakage struct {
+	// Roll is the roll which is suspected to have caused the breakage.
+	Roll *autoroll.AutoRollIssue
+	// Culprits are the child revisions included in the roll, in reverse
+	// chronological order. May be empty if they are not known.
+	Culprits []*revision.Revision
+	// TreeMessage is the message provided when the tree was closed.
+	TreeMessage string
+	// Builds are the failing builds whose blamelists include the roll.
+	Builds []*FailingBuild
+}
+
+// FormatCulprits returns a human-readable list of the suspected culprits.
+func (b *Breakage) FormatCulprits() string {
+	if len(b.Culprits) == 0 {
+		return fmt.Sprintf("%s..%s", b.Roll.RollingFrom, b.Roll.RollingTo)
+	}
+	lines := make([]string, 0, len(b.Culprits)+1)
+	for i, rev := range b.Culprits {
+		if i == MAX_CULPRITS {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(b.Culprits)-MAX_CULPRITS))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", rev.Id, rev.Author, rev.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FormatBuilds returns a human-readable list of the failing builds.
+func (b *Breakage) FormatBuilds() string {
+	lines := make([]string, 0, len(b.Builds))
+	for _, build := range b.Builds {
+		lines = append(lines, fmt.Sprintf("%s %s", build.Name, build.Url))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// watchState is the state of a Watcher, which is persisted in GCS.
+type watchState struct {
+	// The roll currently being watched, if any.
+	Culprits []*revision.Revision    `json:"culprits,omitempty"`
+	Landed   time.Time               `json:"landed"`
+	Roll     *autoroll.AutoRollIssue `json:"roll,omitempty"`
+	SawOpen  bool                    `json:"sawOpen"`
+}
+
+// Watcher watches the parent tree after a roll lands. Only the most recently
+// landed roll is watched. The state of the Watcher is persisted in GCS, so that
+// the roll is still watched after the roller restarts.
+type Watcher struct {
+	buildsUrl string
+	client    *http.Client
+	gcs       gcs.GCSClient
+	gcsPath   string
+	mtx       sync.Mutex
+	period    time.Duration
+	state     watchState
+	url       string
+	timeFunc  func() time.Time
+}
+
+// NewWatcher returns a Watcher instance which persists its state in the given
+// file in GCS.
+func NewWatcher(ctx context.Context, c *Config, client *http.Client, gcsClient gcs.GCSClient, gcsPath string) (*Watcher, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		buildsUrl: c.FailingBuildsURL,
+		client:    client,
+		gcs:       gcsClient,
+		gcsPath:   gcsPath,
+		period:    c.GetWatchPeriod(),
+		url:       c.TreeStatusURL,
+		timeFunc:  time.Now,
+	}
+	r, err := gcsClient.FileReader(ctx, gcsPath)
+	if err == nil {
+		defer util.Close(r)
+		if err := json.NewDecoder(r).Decode(&w.state); err != nil {
+			return nil, fmt.Errorf("Invalid or corrupted file for revert Watcher: %s", err)
+		}
+	} else if err != storage.ErrObjectNotExist {
+		return nil, fmt.Errorf("Unable to read file for revert Watcher: %s", err)
+	}
+	return w, nil
+}
+
+// write the state of the Watcher to GCS. Assumes the caller holds w.mtx.
+func (w *Watcher) write(ctx context.Context) error {
+	return gcs.WithWriteFile(w.gcs, ctx, w.gcsPath, gcs.FILE_WRITE_OPTS_TEXT, func(wr io.Writer) error {
+		return json.NewEncoder(wr).Encode(&w.state)
+	})
+}
+
+// Watch begins watching the parent tree for breakages caused by the given roll,
+// which just landed, replacing any previously-watched roll. The given culprits
+// are the child revisions included in the roll. Rolls whose LandedRevision is
+// not known can't be correlated with failing builds and are not watched.
+func (w *Watcher) Watch(ctx context.Context, roll *autoroll.AutoRollIssue, culprits []*revision.Revision) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if roll.LandedRevision == "" {
+		sklog.Warningf("Landed revision of roll %d is unknown; not watching.", roll.Issue)
+		w.state = watchState{}
+	} else {
+		w.state = watchState{
+			Culprits: culprits,
+			Landed:   w.timeFunc(),
+			Roll:     roll,
+		}
+	}
+	return w.write(ctx)
+}
+
+// Watching returns the roll currently being watched, or nil if none.
+func (w *Watcher) Watching() *autoroll.AutoRollIssue {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.state.Roll
+}
+
+// Check retrieves the status of the parent tree and returns a Breakage if the
+// tree was closed after having been seen open since the watched roll landed
+// and at least one failing build includes the roll in its blamelist. Each roll
+// results in at most one Breakage. Returns nil if there is no correlated
+// breakage.
+func (w *Watcher) Check(ctx context.Context) (*Breakage, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.state.Roll == nil {
+		return nil, nil
+	}
+	if w.timeFunc().After(w.state.Landed.Add(w.period)) {
+		w.state = watchState{}
+		return nil, w.write(ctx)
+	}
+	status, err := GetTreeStatus(ctx, w.client, w.url)
+	if err != nil {
+		return nil, err
+	}
+	if status.GeneralState != TREE_STATE_CLOSED {
+		if !w.state.SawOpen {
+			w.state.SawOpen = true
+			return nil, w.write(ctx)
+		}
+		return nil, nil
+	}
+	if !w.state.SawOpen {
+		// The tree was already closed when the roll landed, so we
+		// can't attribute the breakage to the roll.
+		return nil, nil
+	}
+	failing, err := GetFailingBuilds(ctx, w.client, w.buildsUrl)
+	if err != nil {
+		return nil, err
+	}
+	var builds []*FailingBuild
+	for _, build := range failing {
+		if util.In(w.state.Roll.LandedRevision, build.Blamelist) {
+			builds = append(builds, build)
+		}
+	}
+	if len(builds) == 0 {
+		// The tree is closed, but none of the failures are blamed on
+		// the roll. Keep watching, in case they are later.
+		sklog.Infof("Parent tree is closed, but no failing builds include roll %d.", w.state.Roll.Issue)
+		return nil, nil
+	}
+	rv := &Breakage{
+		Roll:        w.state.Roll,
+		Culprits:    w.state.Culprits,
+		TreeMessage: status.Message,
+		Builds:      builds,
+	}
+	w.state = watchState{}
+	if err := w.write(ctx); err != nil {
+		// Don't lose the Breakage; at worst we'll find it again after
+		// a restart, and the roller won't revert the same roll twice
+		// because it is no longer the current revision.
+		sklog.Errorf("Failed to write revert Watcher state: %s", err)
+	}
+	return rv, nil
+}
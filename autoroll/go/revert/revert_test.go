@@ -0,0 +1,157 @@
+package revert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/gcs/test_gcsclient"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestConfigValidate(t *testing.T) {
+	unittest.SmallTest(t)
+	require.EqualError(t, (&Config{}).Validate(), "TreeStatusURL is required.")
+	c := &Config{
+		TreeStatusURL: "https://tree-status",
+	}
+	require.EqualError(t, c.Validate(), "FailingBuildsURL is required.")
+	c.FailingBuildsURL = "https://failing-builds"
+	c.WatchPeriod = "bogus"
+	require.Error(t, c.Validate())
+	c.WatchPeriod = "2h"
+	require.NoError(t, c.Validate())
+	require.Equal(t, 2*time.Hour, c.GetWatchPeriod())
+	c.WatchPeriod = ""
+	require.Equal(t, DEFAULT_WATCH_PERIOD, c.GetWatchPeriod())
+}
+
+func TestWatcher(t *testing.T) {
+	unittest.SmallTest(t)
+	ctx := context.Background()
+	status := &TreeStatus{GeneralState: TREE_STATE_OPEN}
+	failing := []*FailingBuild{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/builds" {
+			require.NoError(t, json.NewEncoder(w).Encode(failing))
+		} else {
+			require.NoError(t, json.NewEncoder(w).Encode(status))
+		}
+	}))
+	defer srv.Close()
+	cfg := &Config{
+		TreeStatusURL:    srv.URL + "/status",
+		FailingBuildsURL: srv.URL + "/builds",
+	}
+	gcsClient := test_gcsclient.NewMemoryClient("fake-bucket")
+	now := time.Unix(1574000000, 0)
+	newWatcher := func() *Watcher {
+		w, err := NewWatcher(ctx, cfg, http.DefaultClient, gcsClient, "test-roller/revert_watcher")
+		require.NoError(t, err)
+		w.timeFunc = func() time.Time {
+			return now
+		}
+		return w
+	}
+	w := newWatcher()
+
+	// Nothing to watch.
+	b, err := w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+
+	// The tree was already closed when the roll landed.
+	roll := &autoroll.AutoRollIssue{
+		Issue:          123,
+		LandedRevision: "parent2",
+		RollingFrom:    "a",
+		RollingTo:      "c",
+	}
+	culprits := []*revision.Revision{
+		{Id: "c", Author: "me@google.com", Description: "Break things"},
+		{Id: "b", Author: "you@google.com", Description: "Fix things"},
+	}
+	status.GeneralState = TREE_STATE_CLOSED
+	require.NoError(t, w.Watch(ctx, roll, culprits))
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	require.Equal(t, roll, w.Watching())
+
+	// The tree opens, then closes.
+	status.GeneralState = TREE_STATE_OPEN
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	status.GeneralState = TREE_STATE_CLOSED
+	status.Message = "Tree is closed (Automatic: Test failed)"
+
+	// The roller restarts; the new Watcher picks up where the old one
+	// left off.
+	w = newWatcher()
+	require.Equal(t, roll, w.Watching())
+
+	// None of the failing builds are blamed on the roll; keep watching.
+	other := &FailingBuild{
+		Name:      "Build-Other",
+		Url:       "https://build/1",
+		Blamelist: []string{"parent3"},
+	}
+	failing = []*FailingBuild{other}
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	require.Equal(t, roll, w.Watching())
+
+	// A failing build includes the roll in its blamelist.
+	blamed := &FailingBuild{
+		Name:      "Test-Blamed",
+		Url:       "https://build/2",
+		Blamelist: []string{"parent3", "parent2"},
+	}
+	failing = []*FailingBuild{other, blamed}
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, b)
+	require.Equal(t, roll, b.Roll)
+	require.Equal(t, "Tree is closed (Automatic: Test failed)", b.TreeMessage)
+	require.Equal(t, []*FailingBuild{blamed}, b.Builds)
+	require.Equal(t, "Test-Blamed https://build/2", b.FormatBuilds())
+	require.Equal(t, "c me@google.com Break things\nb you@google.com Fix things", b.FormatCulprits())
+
+	// Only one Breakage per roll.
+	require.Nil(t, w.Watching())
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+
+	// Breakages after the watch period aren't attributed to the roll.
+	require.NoError(t, w.Watch(ctx, roll, nil))
+	status.GeneralState = TREE_STATE_THROTTLED
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	now = now.Add(DEFAULT_WATCH_PERIOD + time.Second)
+	status.GeneralState = TREE_STATE_CLOSED
+	b, err = w.Check(ctx)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	require.Nil(t, w.Watching())
+	require.Nil(t, newWatcher().Watching())
+
+	// Rolls whose landed revision is unknown aren't watched.
+	require.NoError(t, w.Watch(ctx, roll, nil))
+	require.NoError(t, w.Watch(ctx, &autoroll.AutoRollIssue{Issue: 456}, nil))
+	require.Nil(t, w.Watching())
+	require.Nil(t, newWatcher().Watching())
+
+	// Unknown culprits.
+	b = &Breakage{Roll: roll}
+	require.Equal(t, "a..c", b.FormatCulprits())
+}
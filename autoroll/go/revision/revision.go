@@ -43,6 +43,11 @@ type Revision struct {
 	// eg. a shortened commit hash.
 	Display string `json:"display"`
 
+	// Files are the paths of the files changed by this Revision. This is
+	// only populated by RepoManagers which need it, eg. to detect
+	// sensitive changes, and is not serialized.
+	Files []string `json:"-"`
+
 	// Tests are any tests which should be run on rolls including this
 	// Revision.
 	Tests []string `json:"tests"`
@@ -71,6 +76,7 @@ func (r *Revision) Copy() *Revision {
 		Details:      r.Details,
 		Display:      r.Display,
 		Dependencies: util.CopyStringMap(r.Dependencies),
+		Files:        util.CopyStringSlice(r.Files),
 		Tests:        util.CopyStringSlice(r.Tests),
 		Timestamp:    r.Timestamp,
 		URL:          r.URL,
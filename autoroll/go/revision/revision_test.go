@@ -24,6 +24,7 @@ func TestCopyRevision(t *testing.T) {
 			"dep": "version1",
 		},
 		Details:   "blah blah blah",
+		Files:     []string{"a/b.txt"},
 		Tests:     []string{"test1"},
 		Timestamp: time.Now(),
 		URL:       "www.best-commit.com",
@@ -3,6 +3,7 @@ package roller
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,12 +12,16 @@ import (
 
 	"github.com/gorilla/mux"
 	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/autoroll/go/freeze"
+	"go.skia.org/infra/autoroll/go/group"
 	"go.skia.org/infra/autoroll/go/manual"
 	"go.skia.org/infra/autoroll/go/modes"
 	arb_notifier "go.skia.org/infra/autoroll/go/notifier"
 	"go.skia.org/infra/autoroll/go/recent_rolls"
 	"go.skia.org/infra/autoroll/go/repo_manager"
+	"go.skia.org/infra/autoroll/go/revert"
 	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/sensitive"
 	"go.skia.org/infra/autoroll/go/state_machine"
 	"go.skia.org/infra/autoroll/go/status"
 	"go.skia.org/infra/autoroll/go/strategy"
@@ -27,9 +32,11 @@ import (
 	"go.skia.org/infra/go/cleanup"
 	"go.skia.org/infra/go/comment"
 	"go.skia.org/infra/go/email"
+	"go.skia.org/infra/go/firestore"
 	"go.skia.org/infra/go/gcs"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/human"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/notifier"
@@ -47,38 +54,69 @@ const (
 
 	// We'll send a notification if this many rolls fail in a row.
 	NOTIFY_IF_LAST_N_FAILED = 3
+
+	// Files in GCS which hold the state of the throttlers, relative to the
+	// roller's directory.
+	SAFETY_THROTTLE_FILE  = "attempt_counter"
+	FAILURE_THROTTLE_FILE = "fail_counter"
+	SUCCESS_THROTTLE_FILE = "success_counter"
+
+	// We wait this long after a failed roll before trying again.
+	FAILURE_THROTTLE_PERIOD = time.Hour
+
+	// File in GCS which holds the last calendar which was read successfully,
+	// relative to the roller's directory.
+	CALENDAR_FILE = "calendar"
+
+	// How often the calendar is reloaded.
+	CALENDAR_RELOAD_PERIOD = 10 * time.Minute
 )
 
 // AutoRoller is a struct which automates the merging new revisions of one
 // project into another.
 type AutoRoller struct {
+	atomicMtx       sync.RWMutex // Protects atomicRoll.
+	atomicRoll      *group.AtomicRoll
+	calendar        []*time_window.Exclusion
 	cfg             AutoRollerConfig
 	childName       string
+	client          *http.Client
 	codereview      codereview.CodeReview
 	currentRoll     codereview.RollImpl
+	currentRollMtx  sync.RWMutex // Protects currentRoll.
 	emails          []string
 	emailsMtx       sync.RWMutex
 	failureThrottle *state_machine.Throttler
+	freeze          *freeze.Freeze
+	gcs             gcs.GCSClient
+	groupMode       *modes.ModeHistory
+	groupTimeWindow *time_window.TimeWindow
 	lastRollRev     *revision.Revision
 	liveness        metrics2.Liveness
 	manualRollDB    manual.DB
 	modeHistory     *modes.ModeHistory
 	nextRollRev     *revision.Revision
+	nextSensitive   []*sensitive.Match // Sensitive changes in the next roll.
 	notifier        *arb_notifier.AutoRollNotifier
 	notifierConfigs []*notifier.Config
 	notRolledRevs   []*revision.Revision
 	parentName      string
 	recent          *recent_rolls.RecentRolls
+	revertWatcher   *revert.Watcher
 	rm              repo_manager.RepoManager
 	rollIntoAndroid bool
 	roller          string
 	runningMtx      sync.Mutex
 	safetyThrottle  *state_machine.Throttler
+	sensitive       *sensitive.Classifier
+	sensitiveMtx    sync.RWMutex // Protects nextSensitive.
 	serverURL       string
 	sheriff         []string
 	sheriffBackup   []string
 	sm              *state_machine.AutoRollStateMachine
+	stateTimes      *stateTimer
 	status          *status.AutoRollStatusCache
+	statusChecker   strategy.StatusChecker
 	statusMtx       sync.RWMutex
 	strategy        strategy.NextRollStrategy
 	strategyHistory *strategy.StrategyHistory
@@ -86,47 +124,66 @@ type AutoRoller struct {
 	successThrottle *state_machine.Throttler
 	timeWindow      *time_window.TimeWindow
 	tipRev          *revision.Revision
+	windowMtx       sync.RWMutex // Protects calendar and freeze.
 }
 
-// NewAutoRoller returns an AutoRoller instance.
-func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail, chatBotConfigReader chatbot.ConfigReader, g *gerrit.Gerrit, githubClient *github.GitHub, workdir, recipesCfgFile, serverURL string, gcsClient gcs.GCSClient, client *http.Client, rollerName string, local bool, manualRollDB manual.DB) (*AutoRoller, error) {
+// newRepoManager creates the RepoManager specified by the given config.
+func newRepoManager(ctx context.Context, c AutoRollerConfig, workdir string, g *gerrit.Gerrit, githubClient *github.GitHub, recipesCfgFile, serverURL string, client *http.Client, cr codereview.CodeReview, rollerName string, local bool) (repo_manager.RepoManager, error) {
+	if c.AndroidRepoManager != nil {
+		return repo_manager.NewAndroidRepoManager(ctx, c.AndroidRepoManager, workdir, g, serverURL, c.ServiceAccount, client, cr, local)
+	}
+	if c.CopyRepoManager != nil {
+		return repo_manager.NewCopyRepoManager(ctx, c.CopyRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.DEPSRepoManager != nil {
+		return repo_manager.NewDEPSRepoManager(ctx, c.DEPSRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.FilePinRepoManager != nil {
+		return repo_manager.NewFilePinRepoManager(ctx, c.FilePinRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.FuchsiaSDKAndroidRepoManager != nil {
+		return repo_manager.NewFuchsiaSDKAndroidRepoManager(ctx, c.FuchsiaSDKAndroidRepoManager, workdir, g, serverURL, client, cr, local)
+	}
+	if c.FreeTypeRepoManager != nil {
+		return repo_manager.NewFreeTypeRepoManager(ctx, c.FreeTypeRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.FuchsiaSDKRepoManager != nil {
+		return repo_manager.NewFuchsiaSDKRepoManager(ctx, c.FuchsiaSDKRepoManager, workdir, g, serverURL, client, cr, local)
+	}
+	if c.GithubRepoManager != nil {
+		return repo_manager.NewGithubRepoManager(ctx, c.GithubRepoManager, workdir, githubClient, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.GithubCipdDEPSRepoManager != nil {
+		return repo_manager.NewGithubCipdDEPSRepoManager(ctx, c.GithubCipdDEPSRepoManager, workdir, rollerName, githubClient, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.GithubDEPSRepoManager != nil {
+		return repo_manager.NewGithubDEPSRepoManager(ctx, c.GithubDEPSRepoManager, workdir, rollerName, githubClient, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.NoCheckoutDEPSRepoManager != nil {
+		return repo_manager.NewNoCheckoutDEPSRepoManager(ctx, c.NoCheckoutDEPSRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
+	}
+	if c.SemVerGCSRepoManager != nil {
+		return repo_manager.NewSemVerGCSRepoManager(ctx, c.SemVerGCSRepoManager, workdir, g, serverURL, client, cr, local)
+	}
+	return nil, skerr.Fmt("Invalid roller config; no repo manager defined!")
+}
+
+// NewAutoRoller returns an AutoRoller instance. crClient is an http.Client
+// which is authenticated for GitLab or Gitea; it is only required if the
+// roller uses one of them for code review.
+func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail, chatBotConfigReader chatbot.ConfigReader, g *gerrit.Gerrit, githubClient *github.GitHub, crClient *http.Client, workdir, recipesCfgFile, serverURL string, gcsClient gcs.GCSClient, client *http.Client, rollerName string, local bool, manualRollDB manual.DB) (*AutoRoller, error) {
 	// Validation and setup.
 	if err := c.Validate(); err != nil {
 		return nil, skerr.Wrapf(err, "Failed to validate config")
 	}
 
-	cr, err := c.CodeReview().Init(g, githubClient)
+	cr, err := c.CodeReview().Init(g, githubClient, crClient)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "Failed to initialize code review")
 	}
 
 	// Create the RepoManager.
-	var rm repo_manager.RepoManager
-	if c.AndroidRepoManager != nil {
-		rm, err = repo_manager.NewAndroidRepoManager(ctx, c.AndroidRepoManager, workdir, g, serverURL, c.ServiceAccount, client, cr, local)
-	} else if c.CopyRepoManager != nil {
-		rm, err = repo_manager.NewCopyRepoManager(ctx, c.CopyRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.DEPSRepoManager != nil {
-		rm, err = repo_manager.NewDEPSRepoManager(ctx, c.DEPSRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.FuchsiaSDKAndroidRepoManager != nil {
-		rm, err = repo_manager.NewFuchsiaSDKAndroidRepoManager(ctx, c.FuchsiaSDKAndroidRepoManager, workdir, g, serverURL, client, cr, local)
-	} else if c.FreeTypeRepoManager != nil {
-		rm, err = repo_manager.NewFreeTypeRepoManager(ctx, c.FreeTypeRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.FuchsiaSDKRepoManager != nil {
-		rm, err = repo_manager.NewFuchsiaSDKRepoManager(ctx, c.FuchsiaSDKRepoManager, workdir, g, serverURL, client, cr, local)
-	} else if c.GithubRepoManager != nil {
-		rm, err = repo_manager.NewGithubRepoManager(ctx, c.GithubRepoManager, workdir, githubClient, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.GithubCipdDEPSRepoManager != nil {
-		rm, err = repo_manager.NewGithubCipdDEPSRepoManager(ctx, c.GithubCipdDEPSRepoManager, workdir, rollerName, githubClient, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.GithubDEPSRepoManager != nil {
-		rm, err = repo_manager.NewGithubDEPSRepoManager(ctx, c.GithubDEPSRepoManager, workdir, rollerName, githubClient, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.NoCheckoutDEPSRepoManager != nil {
-		rm, err = repo_manager.NewNoCheckoutDEPSRepoManager(ctx, c.NoCheckoutDEPSRepoManager, workdir, g, recipesCfgFile, serverURL, client, cr, local)
-	} else if c.SemVerGCSRepoManager != nil {
-		rm, err = repo_manager.NewSemVerGCSRepoManager(ctx, c.SemVerGCSRepoManager, workdir, g, serverURL, client, cr, local)
-	} else {
-		return nil, skerr.Fmt("Invalid roller config; no repo manager defined!")
-	}
+	rm, err := newRepoManager(ctx, c, workdir, g, githubClient, recipesCfgFile, serverURL, client, cr, rollerName, local)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "Failed to initialize repo manager")
 	}
@@ -145,8 +202,15 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 		}
 		currentStrategy = sh.CurrentStrategy()
 	}
+	var statusChecker strategy.StatusChecker
+	if c.GreenRevision != nil {
+		statusChecker, err = strategy.NewStatusChecker(c.GreenRevision, client)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create status checker")
+		}
+	}
 	sklog.Info("Setting strategy.")
-	strat, err := strategy.GetNextRollStrategy(currentStrategy.Strategy)
+	strat, err := strategy.GetNextRollStrategy(currentStrategy.Strategy, statusChecker)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "Failed to get next roll strategy")
 	}
@@ -163,6 +227,15 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 	if nextRollRev == nil {
 		nextRollRev = lastRollRev
 	}
+	var classifier *sensitive.Classifier
+	var sensitiveChanges []*sensitive.Match
+	if sc := c.SensitiveChanges(); sc != nil {
+		classifier, err = sensitive.NewClassifier(sc)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create sensitive change classifier")
+		}
+		sensitiveChanges = classifier.Classify(rollingRevs(notRolledRevs, nextRollRev.Id))
+	}
 
 	sklog.Info("Creating roll history")
 	recent, err := recent_rolls.NewRecentRolls(ctx, rollerName)
@@ -186,12 +259,12 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 	if c.SafetyThrottle == nil {
 		c.SafetyThrottle = SAFETY_THROTTLE_CONFIG_DEFAULT
 	}
-	safetyThrottle, err := state_machine.NewThrottler(ctx, gcsClient, rollerName+"/attempt_counter", c.SafetyThrottle.TimeWindow, c.SafetyThrottle.AttemptCount)
+	safetyThrottle, err := state_machine.NewThrottler(ctx, gcsClient, rollerName+"/"+SAFETY_THROTTLE_FILE, c.SafetyThrottle.TimeWindow, c.SafetyThrottle.AttemptCount)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "Failed to create safety throttler")
 	}
 
-	failureThrottle, err := state_machine.NewThrottler(ctx, gcsClient, rollerName+"/fail_counter", time.Hour, 1)
+	failureThrottle, err := state_machine.NewThrottler(ctx, gcsClient, rollerName+"/"+FAILURE_THROTTLE_FILE, FAILURE_THROTTLE_PERIOD, 1)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "Failed to create failure throttler")
 	}
@@ -203,7 +276,7 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 			return nil, skerr.Wrapf(err, "Failed to parse maxRollFrequency")
 		}
 	}
-	successThrottle, err := state_machine.NewThrottler(ctx, gcsClient, rollerName+"/success_counter", maxRollFreq, 1)
+	successThrottle, err := state_machine.NewThrottler(ctx, gcsClient, rollerName+"/"+SUCCESS_THROTTLE_FILE, maxRollFreq, 1)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "Failed to create success throttler")
 	}
@@ -224,34 +297,88 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 		return nil, skerr.Wrapf(err, "Failed to create status cache")
 	}
 	sklog.Info("Creating TimeWindow.")
+	loc, err := c.TimeWindowLocation()
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to create TimeWindow")
+	}
 	var tw *time_window.TimeWindow
 	if c.TimeWindow != "" {
-		tw, err = time_window.Parse(c.TimeWindow)
+		tw, err = time_window.ParseInLocation(c.TimeWindow, loc)
 		if err != nil {
 			return nil, skerr.Wrapf(err, "Failed to create TimeWindow")
 		}
 	}
+	var calendar []*time_window.Exclusion
+	if c.TimeWindowCalendar != "" {
+		calendar, err = loadCalendar(ctx, client, gcsClient, rollerName+"/"+CALENDAR_FILE, c.TimeWindowCalendar, loc)
+		if err != nil {
+			// Don't prevent the roller from starting; the calendar is
+			// reloaded periodically.
+			sklog.Errorf("Failed to load calendar %s; starting with an empty calendar: %s", c.TimeWindowCalendar, err)
+			calendar = nil
+		}
+	}
+	fr, err := freeze.Get(ctx, c.Group)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to retrieve freeze")
+	}
+	var groupMode *modes.ModeHistory
+	if c.Group != "" {
+		groupMode, err = modes.NewModeHistory(ctx, group.ModeKey(c.Group))
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create group mode history")
+		}
+	}
+	var groupTimeWindow *time_window.TimeWindow
+	if c.GroupConfig != nil && c.GroupConfig.TimeWindow != "" {
+		groupLoc, err := c.GroupConfig.TimeWindowLocation()
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create group TimeWindow")
+		}
+		groupTimeWindow, err = time_window.ParseInLocation(c.GroupConfig.TimeWindow, groupLoc)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create group TimeWindow")
+		}
+	}
+	var revertWatcher *revert.Watcher
+	if c.AutoRevert != nil {
+		revertWatcher, err = revert.NewWatcher(ctx, c.AutoRevert, client, gcsClient, rollerName+"/revert_watcher")
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create revert watcher")
+		}
+	}
 	arb := &AutoRoller{
+		calendar:        calendar,
 		cfg:             c,
+		client:          client,
 		codereview:      cr,
 		emails:          emails,
 		failureThrottle: failureThrottle,
+		freeze:          fr,
+		gcs:             gcsClient,
+		groupMode:       groupMode,
+		groupTimeWindow: groupTimeWindow,
 		lastRollRev:     lastRollRev,
 		liveness:        metrics2.NewLiveness("last_autoroll_landed", map[string]string{"roller": c.RollerName}),
 		manualRollDB:    manualRollDB,
 		modeHistory:     mh,
 		nextRollRev:     nextRollRev,
+		nextSensitive:   sensitiveChanges,
 		notifier:        n,
 		notifierConfigs: c.Notifiers,
 		notRolledRevs:   notRolledRevs,
 		recent:          recent,
+		revertWatcher:   revertWatcher,
 		rm:              rm,
 		roller:          rollerName,
 		safetyThrottle:  safetyThrottle,
+		sensitive:       classifier,
 		serverURL:       serverURL,
 		sheriff:         c.Sheriff,
 		sheriffBackup:   c.SheriffBackup,
+		stateTimes:      newStateTimer(),
 		status:          statusCache,
+		statusChecker:   statusChecker,
 		strategy:        strat,
 		strategyHistory: sh,
 		successThrottle: successThrottle,
@@ -274,7 +401,7 @@ func NewAutoRoller(ctx context.Context, c AutoRollerConfig, emailer *email.GMail
 		if err != nil {
 			return nil, skerr.Wrapf(err, "Failed to retrieve current roll")
 		}
-		arb.currentRoll = roll
+		arb.setCurrentRoll(roll)
 	}
 	sklog.Info("Done creating autoroller")
 	return arb, nil
@@ -344,6 +471,15 @@ func (r *AutoRoller) Start(ctx context.Context, tickFrequency, repoFrequency tim
 		}
 	}, nil)
 
+	// Reload the calendar in a loop.
+	if r.cfg.TimeWindowCalendar != "" {
+		cleanup.Repeat(CALENDAR_RELOAD_PERIOD, func(ctx context.Context) {
+			if err := r.reloadCalendar(ctx); err != nil {
+				sklog.Errorf("Failed to reload calendar; keeping the previous calendar: %s", err)
+			}
+		}, nil)
+	}
+
 	// Update the current sheriff in a loop.
 	cleanup.Repeat(30*time.Minute, func(ctx context.Context) {
 		emails, err := getSheriff(r.cfg.ParentName, r.cfg.ChildName, r.cfg.RollerName, r.cfg.Sheriff, r.cfg.SheriffBackup)
@@ -404,9 +540,18 @@ func replaceSheriffPlaceholder(configs []*notifier.Config, emails []string) []*n
 
 // See documentation for state_machine.AutoRollerImpl interface.
 func (r *AutoRoller) GetActiveRoll() state_machine.RollCLImpl {
+	r.currentRollMtx.RLock()
+	defer r.currentRollMtx.RUnlock()
 	return r.currentRoll
 }
 
+// setCurrentRoll sets the currently-active roll.
+func (r *AutoRoller) setCurrentRoll(roll codereview.RollImpl) {
+	r.currentRollMtx.Lock()
+	defer r.currentRollMtx.Unlock()
+	r.currentRoll = roll
+}
+
 // GetEmails returns the list of email addresses which are copied on rolls.
 func (r *AutoRoller) GetEmails() []string {
 	r.emailsMtx.RLock()
@@ -416,9 +561,37 @@ func (r *AutoRoller) GetEmails() []string {
 	return rv
 }
 
-// See documentation for state_machine.AutoRollerImpl interface.
+// See documentation for state_machine.AutoRollerImpl interface. The mode is
+// the most restrictive of the roller's own mode and the mode of its group. In
+// an atomic group, the roller only uploads dry runs until every roller in the
+// group is ready to submit. Likewise, if the next roll includes sensitive
+// changes which require human review, the roller only uploads dry runs, which
+// a human may then land.
 func (r *AutoRoller) GetMode() string {
-	return r.modeHistory.CurrentMode().Mode
+	mode := r.modeHistory.CurrentMode().Mode
+	if r.groupMode != nil {
+		if groupMode := r.groupMode.CurrentMode(); groupMode != nil {
+			mode = modes.MostRestrictive(mode, groupMode.Mode)
+		}
+	}
+	if mode == modes.MODE_RUNNING && r.cfg.isAtomic() && !r.atomicCanSubmit() {
+		return modes.MODE_DRY_RUN
+	}
+	if mode == modes.MODE_RUNNING && r.reviewRequired() {
+		return modes.MODE_DRY_RUN
+	}
+	return mode
+}
+
+// reviewRequired returns true iff the next roll includes sensitive changes
+// which must be reviewed and landed by a human.
+func (r *AutoRoller) reviewRequired() bool {
+	if r.sensitive == nil {
+		return false
+	}
+	r.sensitiveMtx.RLock()
+	defer r.sensitiveMtx.RUnlock()
+	return r.sensitive.ReviewRequired(r.nextSensitive)
 }
 
 // Reset all of the roller's throttle timers.
@@ -437,7 +610,7 @@ func (r *AutoRoller) unthrottle(ctx context.Context) error {
 
 // See documentation for state_machine.AutoRollerImpl interface.
 func (r *AutoRoller) UploadNewRoll(ctx context.Context, from, to *revision.Revision, dryRun bool) (state_machine.RollCLImpl, error) {
-	issue, err := r.createNewRoll(ctx, from, to, r.GetEmails(), dryRun)
+	issue, err := r.createNewRoll(ctx, from, to, r.revsRollingTo(to.Id), r.GetEmails(), dryRun)
 	if err != nil {
 		return nil, err
 	}
@@ -448,24 +621,37 @@ func (r *AutoRoller) UploadNewRoll(ctx context.Context, from, to *revision.Revis
 	if err := roll.InsertIntoDB(ctx); err != nil {
 		return nil, err
 	}
-	r.currentRoll = roll
+	r.setCurrentRoll(roll)
 	return roll, nil
 }
 
-// createNewRoll is a helper function which uploads a new roll.
-func (r *AutoRoller) createNewRoll(ctx context.Context, from, to *revision.Revision, emails []string, dryRun bool) (*autoroll.AutoRollIssue, error) {
+// revsRollingTo returns the not-yet-rolled revisions which would be included in
+// a roll to the given revision ID, in reverse chronological order.
+func (r *AutoRoller) revsRollingTo(to string) []*revision.Revision {
 	r.statusMtx.RLock()
+	defer r.statusMtx.RUnlock()
+	return rollingRevs(r.notRolledRevs, to)
+}
+
+// rollingRevs returns the revisions from notRolledRevs which would be included
+// in a roll to the given revision ID, in reverse chronological order.
+func rollingRevs(notRolledRevs []*revision.Revision, to string) []*revision.Revision {
 	var revs []*revision.Revision
 	found := false
-	for _, rev := range r.notRolledRevs {
-		if rev.Id == to.Id {
+	for _, rev := range notRolledRevs {
+		if rev.Id == to {
 			found = true
 		}
 		if found {
 			revs = append(revs, rev)
 		}
 	}
-	r.statusMtx.RUnlock()
+	return revs
+}
+
+// createNewRoll is a helper function which uploads a new roll, which includes
+// the given revisions.
+func (r *AutoRoller) createNewRoll(ctx context.Context, from, to *revision.Revision, revs []*revision.Revision, emails []string, dryRun bool) (*autoroll.AutoRollIssue, error) {
 	issueNum, err := r.rm.CreateNewRoll(ctx, from, to, revs, emails, strings.Join(r.cfg.CqExtraTrybots, ";"), dryRun)
 	if err != nil {
 		return nil, err
@@ -499,9 +685,110 @@ func (r *AutoRoller) GetNextRollRev() *revision.Revision {
 	return r.nextRollRev
 }
 
+// readCalendarFile reads the contents of the calendar file at the given path
+// or http(s) URL.
+func readCalendarFile(ctx context.Context, client *http.Client, path string) ([]byte, error) {
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		return ioutil.ReadFile(path)
+	}
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to read %s: %s %s", path, resp.Status, httputils.ReadAndClose(resp.Body))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// readCalendar reads the calendar file at the given path or http(s) URL.
+func readCalendar(ctx context.Context, client *http.Client, path string, loc *time.Location) ([]*time_window.Exclusion, error) {
+	contents, err := readCalendarFile(ctx, client, path)
+	if err != nil {
+		return nil, err
+	}
+	return time_window.ParseCalendar(contents, loc)
+}
+
+// loadCalendar reads the calendar file at the given path or http(s) URL and
+// stores a copy of it in GCS at gcsPath. If the calendar cannot be read, the
+// copy stored by a previous call is used instead.
+func loadCalendar(ctx context.Context, client *http.Client, gcsClient gcs.GCSClient, gcsPath, path string, loc *time.Location) ([]*time_window.Exclusion, error) {
+	contents, err := readCalendarFile(ctx, client, path)
+	if err == nil {
+		var calendar []*time_window.Exclusion
+		calendar, err = time_window.ParseCalendar(contents, loc)
+		if err == nil {
+			if err := gcsClient.SetFileContents(ctx, gcsPath, gcs.FILE_WRITE_OPTS_TEXT, contents); err != nil {
+				sklog.Errorf("Failed to store a copy of calendar %s: %s", path, err)
+			}
+			return calendar, nil
+		}
+	}
+	sklog.Errorf("Failed to read calendar %s; using the last known calendar: %s", path, err)
+	contents, gcsErr := gcsClient.GetFileContents(ctx, gcsPath)
+	if gcsErr != nil {
+		return nil, fmt.Errorf("Failed to read calendar %s (%s) and its last known copy: %s", path, err, gcsErr)
+	}
+	return time_window.ParseCalendar(contents, loc)
+}
+
+// reloadCalendar reloads the roller's calendar. The previous calendar is kept
+// if an error is returned.
+func (r *AutoRoller) reloadCalendar(ctx context.Context) error {
+	loc, err := r.cfg.TimeWindowLocation()
+	if err != nil {
+		return err
+	}
+	calendar, err := loadCalendar(ctx, r.client, r.gcs, r.roller+"/"+CALENDAR_FILE, r.cfg.TimeWindowCalendar, loc)
+	if err != nil {
+		return err
+	}
+	r.windowMtx.Lock()
+	defer r.windowMtx.Unlock()
+	r.calendar = calendar
+	return nil
+}
+
+// updateFreeze reloads the freeze status of the roller's group. The calendar
+// is reloaded separately; see reloadCalendar.
+func (r *AutoRoller) updateFreeze(ctx context.Context) error {
+	fr, err := freeze.Get(ctx, r.cfg.Group)
+	if err != nil {
+		return skerr.Wrapf(err, "Failed to retrieve freeze")
+	}
+	r.windowMtx.Lock()
+	defer r.windowMtx.Unlock()
+	r.freeze = fr
+	return nil
+}
+
+// rollWindowStatus returns a time_window.Status indicating whether the roller
+// is allowed to upload rolls at the given time, taking into account the
+// TimeWindow, the calendar, and the time window and any freeze of the roller's
+// group.
+func (r *AutoRoller) rollWindowStatus(t time.Time) *time_window.Status {
+	r.windowMtx.RLock()
+	defer r.windowMtx.RUnlock()
+	exclusions := r.calendar
+	if r.freeze.Active(t) {
+		exclusions = append([]*time_window.Exclusion{{
+			Start:  r.freeze.Time,
+			End:    r.freeze.Until,
+			Reason: fmt.Sprintf("Group %q frozen by %s: %s", r.freeze.Group, r.freeze.User, r.freeze.Message),
+		}}, exclusions...)
+	}
+	return time_window.GetCombinedStatus(t, []*time_window.TimeWindow{r.timeWindow, r.groupTimeWindow}, exclusions)
+}
+
 // See documentation for state_machine.AutoRollerImpl interface.
 func (r *AutoRoller) InRollWindow(t time.Time) bool {
-	return r.timeWindow.Test(t)
+	return r.rollWindowStatus(t).Open
 }
 
 // See documentation for state_machine.AutoRollerImpl interface.
@@ -598,6 +885,25 @@ func (r *AutoRoller) UpdateRepos(ctx context.Context) error {
 		}
 	}
 
+	// Rollers in an atomic group all roll to the same revision.
+	if r.cfg.isAtomic() {
+		nextRollRev, err = r.syncAtomicRoll(ctx, lastRollRev, nextRollRev, notRolledRevs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Detect sensitive changes in the next roll.
+	if r.sensitive != nil {
+		sensitiveChanges := r.sensitive.Classify(rollingRevs(notRolledRevs, nextRollRev.Id))
+		for _, m := range sensitiveChanges {
+			sklog.Infof("Next roll includes %d sensitive changes matching %q", len(m.Revisions), m.Rule)
+		}
+		r.sensitiveMtx.Lock()
+		r.nextSensitive = sensitiveChanges
+		r.sensitiveMtx.Unlock()
+	}
+
 	// Store the revs.
 	r.statusMtx.Lock()
 	defer r.statusMtx.Unlock()
@@ -614,14 +920,9 @@ func (r *AutoRoller) updateStatus(ctx context.Context, replaceLastError bool, la
 	defer r.statusMtx.Unlock()
 
 	recent := r.recent.GetRecentRolls()
-	numFailures := 0
-	for _, roll := range recent {
-		if roll.Failed() {
-			numFailures++
-		} else if roll.Succeeded() {
-			break
-		}
-	}
+	r.stateTimes.update(r.sm.Current(), time.Now())
+	health := computeHealth(r.notRolledRevs, recent, r.stateTimes, time.Now())
+	reportHealth(r.cfg.RollerName, health)
 	if !replaceLastError {
 		lastError = r.status.Get().Error
 	}
@@ -649,18 +950,26 @@ func (r *AutoRoller) updateStatus(ctx context.Context, replaceLastError bool, la
 	if currentRoll != nil {
 		currentRollRev = currentRoll.RollingTo
 	}
+	windowClosedReason := ""
+	var windowOpensAt int64
+	if r.sm.Current() == state_machine.S_NORMAL_WAIT_FOR_WINDOW {
+		ws := r.rollWindowStatus(time.Now())
+		windowClosedReason = ws.Reason
+		windowOpensAt = ws.NextOpen.Unix()
+	}
 	if err := status.Set(ctx, r.roller, &status.AutoRollStatus{
 		AutoRollMiniStatus: status.AutoRollMiniStatus{
 			CurrentRollRev:      currentRollRev,
 			LastRollRev:         r.lastRollRev.Id,
 			Mode:                r.GetMode(),
-			NumFailedRolls:      numFailures,
+			NumFailedRolls:      health.FailureStreak,
 			NumNotRolledCommits: numNotRolled,
 		},
 		ChildName:          r.childName,
 		CurrentRoll:        r.recent.CurrentRoll(),
 		Error:              lastError,
 		FullHistoryUrl:     r.codereview.GetFullHistoryUrl(),
+		Health:             health,
 		IssueUrlBase:       r.codereview.GetIssueUrlBase(),
 		LastRoll:           r.recent.LastRoll(),
 		NotRolledRevisions: notRolledRevs,
@@ -669,6 +978,8 @@ func (r *AutoRoller) updateStatus(ctx context.Context, replaceLastError bool, la
 		ThrottledUntil:     throttledUntil,
 		ValidModes:         modes.VALID_MODES,
 		ValidStrategies:    r.cfg.ValidStrategies(),
+		WindowClosedReason: windowClosedReason,
+		WindowOpensAt:      windowOpensAt,
 	}); err != nil {
 		return err
 	}
@@ -696,17 +1007,32 @@ func (r *AutoRoller) Tick(ctx context.Context) error {
 		}
 	}
 
+	// Update the freeze status.
+	if err := r.updateFreeze(ctx); err != nil {
+		return skerr.Wrapf(err, "Failed to update freeze status")
+	}
+
+	// Revert the last roll if it broke the parent tree.
+	if err := r.checkForBreakage(ctx); err != nil {
+		return skerr.Wrapf(err, "Failed to check for breakage caused by the last roll")
+	}
+
 	// Update modes and strategies.
 	if err := r.modeHistory.Update(ctx); err != nil {
 		return skerr.Wrapf(err, "Failed to update mode history")
 	}
+	if r.groupMode != nil {
+		if err := r.groupMode.Update(ctx); err != nil {
+			return skerr.Wrapf(err, "Failed to update group mode history")
+		}
+	}
 	oldStrategy := r.strategyHistory.CurrentStrategy().Strategy
 	if err := r.strategyHistory.Update(ctx); err != nil {
 		return skerr.Wrapf(err, "Failed to update strategy history")
 	}
 	newStrategy := r.strategyHistory.CurrentStrategy().Strategy
 	if oldStrategy != newStrategy {
-		strat, err := strategy.GetNextRollStrategy(newStrategy)
+		strat, err := strategy.GetNextRollStrategy(newStrategy, r.statusChecker)
 		if err != nil {
 			return skerr.Wrapf(err, "Failed to get next roll strategy")
 		}
@@ -773,6 +1099,10 @@ func (r *AutoRoller) rollFinished(ctx context.Context, justFinished codereview.R
 	}
 	metrics2.GetInt64Metric("autoroll_last_roll_result", map[string]string{"roller": r.cfg.RollerName}).Update(v)
 
+	if err := r.watchForBreakage(ctx, currentRoll); err != nil {
+		return skerr.Wrapf(err, "Failed to watch the parent tree after roll %d", currentRoll.Issue)
+	}
+
 	recent = recent[idx:]
 	var lastRoll *autoroll.AutoRollIssue
 	if len(recent) > 1 {
@@ -813,6 +1143,78 @@ func (r *AutoRoller) rollFinished(ctx context.Context, justFinished codereview.R
 	return nil
 }
 
+// watchForBreakage begins watching the parent tree for breakages caused by the
+// given roll, if it landed. The revisions included in the roll must not yet
+// have been removed from notRolledRevs.
+func (r *AutoRoller) watchForBreakage(ctx context.Context, roll *autoroll.AutoRollIssue) error {
+	if r.revertWatcher != nil && roll.Closed && roll.Committed && !roll.IsDryRun {
+		return r.revertWatcher.Watch(ctx, roll.Copy(), r.revsRollingTo(roll.RollingTo))
+	}
+	return nil
+}
+
+// checkForBreakage determines whether the parent tree broke after the last roll
+// landed and a failing build blames the roll. If so, it uploads a revert of the
+// roll, records the revert as a manual roll request so that it is tracked to
+// completion, stops the roller so that the child stays pinned at the revision
+// before the roll, and sends a notification listing the suspected culprits and
+// the failing builds.
+func (r *AutoRoller) checkForBreakage(ctx context.Context) error {
+	if r.revertWatcher == nil || r.GetMode() != modes.MODE_RUNNING {
+		return nil
+	}
+	b, err := r.revertWatcher.Check(ctx)
+	if err != nil {
+		// Failing to obtain the tree status shouldn't prevent rolling.
+		sklog.Errorf("Failed to check the parent tree: %s", err)
+		return nil
+	}
+	if b == nil {
+		return nil
+	}
+	if b.Roll.RollingTo != r.GetCurrentRev().Id {
+		sklog.Warningf("Parent tree closed after roll %d landed, but the current revision is %s; not reverting.", b.Roll.Issue, r.GetCurrentRev().Id)
+		return nil
+	}
+	sklog.Infof("Failing builds blame roll %d; reverting.", b.Roll.Issue)
+	from, err := r.getRevision(ctx, b.Roll.RollingTo)
+	if err != nil {
+		return skerr.Wrapf(err, "Failed to retrieve revision %s", b.Roll.RollingTo)
+	}
+	to, err := r.getRevision(ctx, b.Roll.RollingFrom)
+	if err != nil {
+		return skerr.Wrapf(err, "Failed to retrieve revision %s", b.Roll.RollingFrom)
+	}
+	// The revert is not a dry run: the parent tree is broken, and the
+	// commit queue still verifies the revert before it lands.
+	issue, err := r.createNewRoll(ctx, from, to, b.Culprits, r.GetEmails(), false)
+	if err != nil {
+		r.notifier.SendRollCreationFailed(ctx, err)
+		return skerr.Wrapf(err, "Failed to upload revert of roll %d", b.Roll.Issue)
+	}
+	issueURL := fmt.Sprintf("%s%d", r.codereview.GetIssueUrlBase(), issue.Issue)
+	revertedURL := fmt.Sprintf("%s%d", r.codereview.GetIssueUrlBase(), b.Roll.Issue)
+	// The roller is stopped below, so the state machine won't pick up the
+	// revert. Track it as a started manual roll instead.
+	req := &manual.ManualRollRequest{
+		Requester:  "AutoRoll Bot",
+		Revision:   to.Id,
+		RollerName: r.cfg.RollerName,
+		Status:     manual.STATUS_STARTED,
+		Timestamp:  firestore.FixTimestamp(time.Now()),
+		Url:        issueURL,
+	}
+	if err := r.manualRollDB.Put(req); err != nil {
+		return skerr.Wrapf(err, "Failed to record revert %s of roll %d", issueURL, b.Roll.Issue)
+	}
+	msg := fmt.Sprintf("Failing builds blame %s; uploaded revert %s.", revertedURL, issueURL)
+	if err := r.modeHistory.Add(ctx, modes.MODE_STOPPED, "AutoRoll Bot", msg); err != nil {
+		return skerr.Wrapf(err, "Failed to stop the roller after reverting roll %d", b.Roll.Issue)
+	}
+	r.notifier.SendAutoRevert(ctx, fmt.Sprintf("%d", issue.Issue), issueURL, revertedURL, b.TreeMessage, b.FormatCulprits(), b.FormatBuilds())
+	return nil
+}
+
 // Handle manual roll requests.
 func (r *AutoRoller) handleManualRolls(ctx context.Context) error {
 	sklog.Infof("Searching manual roll requests for %s", r.cfg.RollerName)
@@ -821,7 +1223,37 @@ func (r *AutoRoller) handleManualRolls(ctx context.Context) error {
 		return skerr.Wrapf(err, "Failed to get incomplete rolls")
 	}
 	sklog.Infof("Found %d requests.", len(reqs))
+	incomplete := make(map[string]bool, len(reqs))
 	for _, req := range reqs {
+		incomplete[req.Id] = true
+	}
+	now := time.Now()
+	for _, req := range manual.Queue(reqs) {
+		if req.Status == manual.STATUS_PENDING {
+			if !req.IsReady(now) {
+				sklog.Infof("Manual roll request %s is scheduled for %s; skipping.", req.Id, req.ScheduledTime)
+				continue
+			}
+			if req.DependsOn != "" {
+				if incomplete[req.DependsOn] {
+					sklog.Infof("Manual roll request %s is waiting for %s; skipping.", req.Id, req.DependsOn)
+					continue
+				}
+				dep, err := r.manualRollDB.Get(req.DependsOn)
+				if err != nil && err != manual.ErrNotFound {
+					return skerr.Wrapf(err, "Failed to retrieve manual roll request %s", req.DependsOn)
+				}
+				if dep == nil || dep.Result != manual.RESULT_SUCCESS {
+					sklog.Warningf("Manual roll request %s depends on %s, which did not succeed; canceling.", req.Id, req.DependsOn)
+					req.Status = manual.STATUS_COMPLETE
+					req.Result = manual.RESULT_CANCELED
+					if err := r.manualRollDB.Put(req); err != nil {
+						return skerr.Wrapf(err, "Failed to update manual roll request")
+					}
+					continue
+				}
+			}
+		}
 		var issue *autoroll.AutoRollIssue
 		to, err := r.getRevision(ctx, req.Revision)
 		if err != nil {
@@ -833,18 +1265,29 @@ func (r *AutoRoller) handleManualRolls(ctx context.Context) error {
 			}
 			continue
 		}
+		created := false
 		if req.Status == manual.STATUS_PENDING {
+			// The request may have been canceled since we loaded it.
+			latest, err := r.manualRollDB.Get(req.Id)
+			if err != nil {
+				return skerr.Wrapf(err, "Failed to retrieve manual roll request %s", req.Id)
+			}
+			if latest.Status != manual.STATUS_PENDING {
+				sklog.Infof("Manual roll request %s is no longer pending; skipping.", req.Id)
+				continue
+			}
+			req = latest
 			emails := r.GetEmails()
-			if !util.In(req.Requester, emails) {
-				emails = append(emails, req.Requester)
+			if !util.In(req.Reviewer(), emails) {
+				emails = append(emails, req.Reviewer())
 			}
-			var err error
-			sklog.Infof("Creating manual roll to %s as requested by %s...", req.Revision, req.Requester)
+			sklog.Infof("Creating manual roll to %s as requested by %s (dry run: %v)...", req.Revision, req.Requester, req.DryRun)
 			from := r.GetCurrentRev()
-			issue, err = r.createNewRoll(ctx, from, to, emails, false)
+			issue, err = r.createNewRoll(ctx, from, to, r.revsRollingTo(to.Id), emails, req.DryRun)
 			if err != nil {
 				return skerr.Wrapf(err, "Failed to create manual roll for %s: %s", req.Id, err)
 			}
+			created = true
 		} else if req.Status == manual.STATUS_STARTED {
 			split := strings.Split(req.Url, "/")
 			i, err := strconv.Atoi(split[len(split)-1])
@@ -852,6 +1295,7 @@ func (r *AutoRoller) handleManualRolls(ctx context.Context) error {
 				return skerr.Wrapf(err, "Failed to parse issue number from %s for %s: %s", req.Url, req.Id, err)
 			}
 			issue = &autoroll.AutoRollIssue{
+				IsDryRun:  req.DryRun,
 				RollingTo: req.Revision,
 				Issue:     int64(i),
 			}
@@ -866,15 +1310,43 @@ func (r *AutoRoller) handleManualRolls(ctx context.Context) error {
 		}
 		req.Status = manual.STATUS_STARTED
 		req.Url = roll.IssueURL()
-		if roll.IsFinished() {
+		finished, success := roll.IsFinished(), roll.IsSuccess()
+		if req.DryRun {
+			finished, success = roll.IsDryRunFinished(), roll.IsDryRunSuccess()
+		}
+		if finished {
 			req.Status = manual.STATUS_COMPLETE
-			if roll.IsSuccess() {
+			if success {
 				req.Result = manual.RESULT_SUCCESS
 			} else {
 				req.Result = manual.RESULT_FAILURE
 			}
+			// Manual rolls can break the parent tree too. The
+			// issue was updated when we retrieved the roll.
+			if err := r.watchForBreakage(ctx, issue); err != nil {
+				return skerr.Wrapf(err, "Failed to watch the parent tree after manual roll %s", req.Id)
+			}
+			// Dry runs are never committed, so we close the CL.
+			if req.DryRun && !roll.IsClosed() {
+				result := autoroll.ROLL_RESULT_DRY_RUN_FAILURE
+				if success {
+					result = autoroll.ROLL_RESULT_DRY_RUN_SUCCESS
+				}
+				if err := roll.Close(ctx, result, "Manual dry run finished; closing this roll."); err != nil {
+					return skerr.Wrapf(err, "Failed to close manual dry run %s", req.Id)
+				}
+			}
 		}
-		if err := r.manualRollDB.Put(req); err != nil {
+		if err := r.manualRollDB.Put(req); err == manual.ErrConcurrentUpdate && created {
+			// The request was canceled while we were creating the
+			// roll. Close the roll rather than leaving it behind.
+			sklog.Warningf("Manual roll request %s was modified while creating %s; closing the roll.", req.Id, req.Url)
+			if !roll.IsClosed() {
+				if err := roll.Close(ctx, autoroll.ROLL_RESULT_FAILURE, "Manual roll request was canceled; closing this roll."); err != nil {
+					return skerr.Wrapf(err, "Failed to close roll for canceled manual roll request %s", req.Id)
+				}
+			}
+		} else if err != nil {
 			return skerr.Wrapf(err, "Failed to update manual roll request")
 		}
 	}
@@ -2,13 +2,171 @@ package roller
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/autoroll/go/manual"
+	"go.skia.org/infra/autoroll/go/modes"
+	arb_notifier "go.skia.org/infra/autoroll/go/notifier"
+	"go.skia.org/infra/autoroll/go/recent_rolls"
+	"go.skia.org/infra/autoroll/go/revert"
 	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/time_window"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/ds"
+	"go.skia.org/infra/go/ds/testutil"
+	"go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/go/gcs/test_gcsclient"
 	"go.skia.org/infra/go/testutils/unittest"
 )
 
+// createdRoll records the parameters of a roll created by a
+// recordingRepoManager.
+type createdRoll struct {
+	from   *revision.Revision
+	to     *revision.Revision
+	revs   []*revision.Revision
+	dryRun bool
+}
+
+// recordingRepoManager is a repo_manager.RepoManager which records the rolls
+// it creates and knows about a fixed set of revisions.
+type recordingRepoManager struct {
+	fakeRepoManager
+	revs  []*revision.Revision
+	rolls []*createdRoll
+	// If set, onCreate is called while creating each roll.
+	onCreate func()
+}
+
+func (r *recordingRepoManager) CreateNewRoll(_ context.Context, from, to *revision.Revision, revs []*revision.Revision, _ []string, _ string, dryRun bool) (int64, error) {
+	if r.onCreate != nil {
+		r.onCreate()
+	}
+	r.rolls = append(r.rolls, &createdRoll{
+		from:   from,
+		to:     to,
+		revs:   revs,
+		dryRun: dryRun,
+	})
+	return int64(100 + len(r.rolls)), nil
+}
+
+func (r *recordingRepoManager) GetRevision(_ context.Context, id string) (*revision.Revision, error) {
+	for _, rev := range r.revs {
+		if rev.Id == id {
+			return rev, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown revision %s", id)
+}
+
+// fakeCodeReview is a codereview.CodeReview with a fixed issue URL base, which
+// retrieves fakeRolls.
+type fakeCodeReview struct {
+	simulatedCodeReview
+	rolls map[int64]*fakeRoll
+}
+
+func (c *fakeCodeReview) GetIssueUrlBase() string {
+	return "https://codereview/"
+}
+
+func (c *fakeCodeReview) RetrieveRoll(_ context.Context, issue *autoroll.AutoRollIssue, _ *recent_rolls.RecentRolls, _ *revision.Revision, _ func(context.Context, codereview.RollImpl) error) (codereview.RollImpl, error) {
+	if c.rolls == nil {
+		c.rolls = map[int64]*fakeRoll{}
+	}
+	roll, ok := c.rolls[issue.Issue]
+	if !ok {
+		roll = &fakeRoll{issue: issue.Issue}
+		c.rolls[issue.Issue] = roll
+	}
+	return roll, nil
+}
+
+// fakeRoll is a codereview.RollImpl whose state is set by the test.
+type fakeRoll struct {
+	issue          int64
+	closed         bool
+	closedResult   string
+	finished       bool
+	success        bool
+	dryRunFinished bool
+	dryRunSuccess  bool
+}
+
+func (r *fakeRoll) AddComment(context.Context, string) error {
+	return nil
+}
+
+func (r *fakeRoll) Close(_ context.Context, result, _ string) error {
+	r.closed = true
+	r.closedResult = result
+	return nil
+}
+
+func (r *fakeRoll) InsertIntoDB(context.Context) error {
+	return nil
+}
+
+func (r *fakeRoll) IsClosed() bool {
+	return r.closed
+}
+
+func (r *fakeRoll) IsFinished() bool {
+	return r.finished
+}
+
+func (r *fakeRoll) IsSuccess() bool {
+	return r.success
+}
+
+func (r *fakeRoll) IsDryRunFinished() bool {
+	return r.dryRunFinished
+}
+
+func (r *fakeRoll) IsDryRunSuccess() bool {
+	return r.dryRunSuccess
+}
+
+func (r *fakeRoll) IssueID() string {
+	return fmt.Sprintf("%d", r.issue)
+}
+
+func (r *fakeRoll) IssueURL() string {
+	return fmt.Sprintf("https://codereview/%d", r.issue)
+}
+
+func (r *fakeRoll) RetryCQ(context.Context) error {
+	return nil
+}
+
+func (r *fakeRoll) RetryDryRun(context.Context) error {
+	return nil
+}
+
+func (r *fakeRoll) RollingTo() *revision.Revision {
+	return nil
+}
+
+func (r *fakeRoll) SwitchToDryRun(context.Context) error {
+	return nil
+}
+
+func (r *fakeRoll) SwitchToNormal(context.Context) error {
+	return nil
+}
+
+func (r *fakeRoll) Update(context.Context) error {
+	return nil
+}
+
 func TestAutoRollerRolledPast(t *testing.T) {
 	unittest.SmallTest(t)
 
@@ -42,3 +200,294 @@ func TestAutoRollerRolledPast(t *testing.T) {
 	check("5", false)             // tipRev
 	check("some other rev", true) // everything else
 }
+
+func TestAutoRollerCheckForBreakage(t *testing.T) {
+	unittest.LargeTest(t)
+
+	ctx := context.Background()
+	testutil.InitDatastore(t, ds.KIND_AUTOROLL_MODE)
+
+	status := &revert.TreeStatus{GeneralState: revert.TREE_STATE_OPEN}
+	failing := []*revert.FailingBuild{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/builds" {
+			require.NoError(t, json.NewEncoder(w).Encode(failing))
+		} else {
+			require.NoError(t, json.NewEncoder(w).Encode(status))
+		}
+	}))
+	defer srv.Close()
+	watcher, err := revert.NewWatcher(ctx, &revert.Config{
+		TreeStatusURL:    srv.URL + "/status",
+		FailingBuildsURL: srv.URL + "/builds",
+	}, http.DefaultClient, test_gcsclient.NewMemoryClient("fake-bucket"), "test-roller/revert_watcher")
+	require.NoError(t, err)
+
+	rollerName := "test-roller"
+	mh, err := modes.NewModeHistory(ctx, rollerName)
+	require.NoError(t, err)
+	require.NoError(t, mh.Add(ctx, modes.MODE_RUNNING, "me@google.com", "Let's roll."))
+	n, err := arb_notifier.New(ctx, "childRepo", "parentRepo", "https://autoroll", nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	a := &revision.Revision{Id: "a"}
+	b := &revision.Revision{Id: "b"}
+	c := &revision.Revision{Id: "c"}
+	rm := &recordingRepoManager{
+		revs: []*revision.Revision{c, b, a},
+	}
+	manualRollDB := manual.NewInMemoryDB()
+	r := &AutoRoller{
+		cfg:           AutoRollerConfig{RollerName: rollerName},
+		codereview:    &fakeCodeReview{},
+		lastRollRev:   c,
+		manualRollDB:  manualRollDB,
+		modeHistory:   mh,
+		nextRollRev:   c,
+		notifier:      n,
+		revertWatcher: watcher,
+		rm:            rm,
+		tipRev:        c,
+	}
+
+	// The roll from a to c landed.
+	roll := &autoroll.AutoRollIssue{
+		Closed:         true,
+		Committed:      true,
+		Issue:          1,
+		LandedRevision: "parent1",
+		RollingFrom:    "a",
+		RollingTo:      "c",
+	}
+	require.NoError(t, watcher.Watch(ctx, roll, []*revision.Revision{c, b}))
+	require.NoError(t, r.checkForBreakage(ctx))
+
+	// The tree closes, but the failing builds don't blame the roll.
+	status.GeneralState = revert.TREE_STATE_CLOSED
+	status.Message = "Tree is closed (Automatic: Test failed)"
+	failing = []*revert.FailingBuild{
+		{
+			Name:      "Test-Other",
+			Url:       "https://build/1",
+			Blamelist: []string{"parent2"},
+		},
+	}
+	require.NoError(t, r.checkForBreakage(ctx))
+	require.Empty(t, rm.rolls)
+	require.Equal(t, modes.MODE_RUNNING, r.GetMode())
+
+	// A failing build blames the roll.
+	failing = append(failing, &revert.FailingBuild{
+		Name:      "Test-Blamed",
+		Url:       "https://build/2",
+		Blamelist: []string{"parent2", "parent1"},
+	})
+	require.NoError(t, r.checkForBreakage(ctx))
+
+	// The revert rolls back from c to a, includes the reverted revisions,
+	// and goes through the commit queue.
+	require.Len(t, rm.rolls, 1)
+	require.Equal(t, &createdRoll{
+		from:   c,
+		to:     a,
+		revs:   []*revision.Revision{c, b},
+		dryRun: false,
+	}, rm.rolls[0])
+
+	// The revert is tracked as a started manual roll.
+	reqs, err := manualRollDB.GetIncomplete(rollerName)
+	require.NoError(t, err)
+	require.Len(t, reqs, 1)
+	require.Equal(t, manual.STATUS_STARTED, reqs[0].Status)
+	require.Equal(t, "a", reqs[0].Revision)
+	require.Equal(t, "https://codereview/101", reqs[0].Url)
+
+	// The roller is stopped.
+	require.Equal(t, modes.MODE_STOPPED, r.GetMode())
+	require.Contains(t, mh.CurrentMode().Message, "https://codereview/101")
+
+	// The roll is only reverted once, and nothing happens while the roller
+	// is stopped.
+	require.NoError(t, watcher.Watch(ctx, roll, []*revision.Revision{c, b}))
+	status.GeneralState = revert.TREE_STATE_OPEN
+	require.NoError(t, r.checkForBreakage(ctx))
+	status.GeneralState = revert.TREE_STATE_CLOSED
+	require.NoError(t, r.checkForBreakage(ctx))
+	require.Len(t, rm.rolls, 1)
+}
+
+func TestAutoRollerHandleManualRolls(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	rollerName := "test-roller"
+	a := &revision.Revision{Id: "a"}
+	b := &revision.Revision{Id: "b"}
+	c := &revision.Revision{Id: "c"}
+	rm := &recordingRepoManager{
+		revs: []*revision.Revision{c, b, a},
+	}
+	cr := &fakeCodeReview{}
+	manualRollDB := manual.NewInMemoryDB()
+	r := &AutoRoller{
+		cfg:           AutoRollerConfig{RollerName: rollerName},
+		codereview:    cr,
+		lastRollRev:   a,
+		manualRollDB:  manualRollDB,
+		nextRollRev:   c,
+		notRolledRevs: []*revision.Revision{c, b},
+		rm:            rm,
+		tipRev:        c,
+	}
+
+	now := firestore.FixTimestamp(time.Now())
+	put := func(req *manual.ManualRollRequest) *manual.ManualRollRequest {
+		req.Requester = "me@google.com"
+		req.RollerName = rollerName
+		req.Status = manual.STATUS_PENDING
+		req.Timestamp = now
+		require.NoError(t, manualRollDB.Put(req))
+		return req
+	}
+	get := func(id string) *manual.ManualRollRequest {
+		req, err := manualRollDB.Get(id)
+		require.NoError(t, err)
+		return req
+	}
+
+	// Requests which are scheduled in the future are skipped, along with
+	// the requests which depend on them.
+	req1 := put(&manual.ManualRollRequest{
+		Revision:      "b",
+		ScheduledTime: now.Add(time.Hour),
+	})
+	req2 := put(&manual.ManualRollRequest{
+		Revision:  "c",
+		DependsOn: req1.Id,
+	})
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Empty(t, rm.rolls)
+	require.Equal(t, manual.STATUS_PENDING, get(req1.Id).Status)
+	require.Equal(t, manual.STATUS_PENDING, get(req2.Id).Status)
+
+	// Once the scheduled time passes, the roll is created, but the
+	// dependent request keeps waiting.
+	req1 = get(req1.Id)
+	req1.ScheduledTime = now.Add(-time.Minute)
+	require.NoError(t, manualRollDB.Put(req1))
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Len(t, rm.rolls, 1)
+	require.Equal(t, b, rm.rolls[0].to)
+	require.False(t, rm.rolls[0].dryRun)
+	req1 = get(req1.Id)
+	require.Equal(t, manual.STATUS_STARTED, req1.Status)
+	require.Equal(t, "https://codereview/101", req1.Url)
+	require.Equal(t, manual.STATUS_PENDING, get(req2.Id).Status)
+
+	// The roll fails, so the dependent request is canceled.
+	cr.rolls[101].finished = true
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Equal(t, manual.RESULT_FAILURE, get(req1.Id).Result)
+	require.NoError(t, r.handleManualRolls(ctx))
+	req2 = get(req2.Id)
+	require.Equal(t, manual.STATUS_COMPLETE, req2.Status)
+	require.Equal(t, manual.RESULT_CANCELED, req2.Result)
+	require.Len(t, rm.rolls, 1)
+
+	// Dry runs are closed when they finish.
+	req3 := put(&manual.ManualRollRequest{
+		Revision: "c",
+		DryRun:   true,
+	})
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Len(t, rm.rolls, 2)
+	require.True(t, rm.rolls[1].dryRun)
+	cr.rolls[102].dryRunFinished = true
+	cr.rolls[102].dryRunSuccess = true
+	require.NoError(t, r.handleManualRolls(ctx))
+	req3 = get(req3.Id)
+	require.Equal(t, manual.STATUS_COMPLETE, req3.Status)
+	require.Equal(t, manual.RESULT_SUCCESS, req3.Result)
+	require.True(t, cr.rolls[102].closed)
+	require.Equal(t, autoroll.ROLL_RESULT_DRY_RUN_SUCCESS, cr.rolls[102].closedResult)
+
+	// Requests which depend on a successful request are rolled.
+	put(&manual.ManualRollRequest{
+		Revision:  "c",
+		DependsOn: req3.Id,
+	})
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Len(t, rm.rolls, 3)
+	require.Equal(t, c, rm.rolls[2].to)
+
+	// If the request is canceled while the roll is being created, the roll
+	// is closed and the request stays canceled.
+	cr.rolls[103].finished = true
+	cr.rolls[103].success = true
+	require.NoError(t, r.handleManualRolls(ctx))
+	req5 := put(&manual.ManualRollRequest{
+		Revision: "c",
+	})
+	rm.onCreate = func() {
+		req := get(req5.Id)
+		req.Status = manual.STATUS_COMPLETE
+		req.Result = manual.RESULT_CANCELED
+		require.NoError(t, manualRollDB.Put(req))
+	}
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Len(t, rm.rolls, 4)
+	require.True(t, cr.rolls[104].closed)
+	require.Equal(t, autoroll.ROLL_RESULT_FAILURE, cr.rolls[104].closedResult)
+	req5 = get(req5.Id)
+	require.Equal(t, manual.STATUS_COMPLETE, req5.Status)
+	require.Equal(t, manual.RESULT_CANCELED, req5.Result)
+	require.Equal(t, "", req5.Url)
+
+	// Nothing is left to do.
+	require.NoError(t, r.handleManualRolls(ctx))
+	require.Len(t, rm.rolls, 4)
+}
+
+func TestLoadCalendar(t *testing.T) {
+	unittest.SmallTest(t)
+	ctx := context.Background()
+
+	contents := `{"exclusions": [{"start": "2019-12-24", "end": "2020-01-01", "reason": "Holidays"}]}`
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, err := w.Write([]byte(contents))
+		require.NoError(t, err)
+	}))
+	defer srv.Close()
+	gcsClient := test_gcsclient.NewMemoryClient("fake-bucket")
+	load := func() ([]*time_window.Exclusion, error) {
+		return loadCalendar(ctx, http.DefaultClient, gcsClient, "my-roller/"+CALENDAR_FILE, srv.URL, time.UTC)
+	}
+
+	// The calendar can't be read, and there is no last known calendar.
+	status = http.StatusInternalServerError
+	_, err := load()
+	require.Error(t, err)
+
+	// The calendar is read successfully.
+	status = http.StatusOK
+	calendar, err := load()
+	require.NoError(t, err)
+	require.Len(t, calendar, 1)
+	require.Equal(t, "Holidays", calendar[0].Reason)
+
+	// The calendar can't be read; use the last known calendar.
+	status = http.StatusInternalServerError
+	calendar, err = load()
+	require.NoError(t, err)
+	require.Len(t, calendar, 1)
+	require.Equal(t, "Holidays", calendar[0].Reason)
+
+	// The calendar is invalid; use the last known calendar.
+	status = http.StatusOK
+	contents = "bogus"
+	calendar, err = load()
+	require.NoError(t, err)
+	require.Len(t, calendar, 1)
+}
@@ -5,13 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/flynn/json5"
 	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/autoroll/go/group"
 	arb_notifier "go.skia.org/infra/autoroll/go/notifier"
 	"go.skia.org/infra/autoroll/go/repo_manager"
+	"go.skia.org/infra/autoroll/go/revert"
+	"go.skia.org/infra/autoroll/go/sensitive"
 	"go.skia.org/infra/autoroll/go/strategy"
 	"go.skia.org/infra/autoroll/go/time_window"
 	"go.skia.org/infra/go/human"
@@ -95,6 +99,16 @@ func (r *Google3FakeRepoManagerConfig) NoCheckout() bool {
 	return false
 }
 
+// See documentation for RepoManagerConfig interface.
+func (r *Google3FakeRepoManagerConfig) ProvidesChangedFiles() bool {
+	return false
+}
+
+// See documentation for RepoManagerConfig interface.
+func (r *Google3FakeRepoManagerConfig) GetSensitiveChanges() *sensitive.Config {
+	return nil
+}
+
 // See documentation for RepoManagerConfig interface.
 func (r *Google3FakeRepoManagerConfig) ValidStrategies() []string {
 	return []string{
@@ -163,15 +177,20 @@ type AutoRollerConfig struct {
 	// for Sheriff.
 	SheriffBackup []string `json:"sheriffBackup,omitempty"`
 
-	// Code review settings.
+	// Code review settings. Gitea and GitLab create rolls via their APIs
+	// from a branch pushed to the parent repo, which is currently only
+	// supported by FilePinRepoManager.
 	Gerrit        *codereview.GerritConfig  `json:"gerrit,omitempty"`
+	Gitea         *codereview.GiteaConfig   `json:"gitea,omitempty"`
 	Github        *codereview.GithubConfig  `json:"github,omitempty"`
+	GitLab        *codereview.GitLabConfig  `json:"gitlab,omitempty"`
 	Google3Review *codereview.Google3Config `json:"google3Review,omitempty"`
 
 	// RepoManager configs. Exactly one must be provided.
 	AndroidRepoManager           *repo_manager.AndroidRepoManagerConfig           `json:"androidRepoManager,omitempty"`
 	CopyRepoManager              *repo_manager.CopyRepoManagerConfig              `json:"copyRepoManager,omitempty"`
 	DEPSRepoManager              *repo_manager.DEPSRepoManagerConfig              `json:"depsRepoManager,omitempty"`
+	FilePinRepoManager           *repo_manager.FilePinRepoManagerConfig           `json:"filePinRepoManager,omitempty"`
 	FreeTypeRepoManager          *repo_manager.FreeTypeRepoManagerConfig          `json:"freeTypeRepoManager"`
 	FuchsiaSDKAndroidRepoManager *repo_manager.FuchsiaSDKAndroidRepoManagerConfig `json:"fuchsiaSDKAndroidRepoManager,omitempty"`
 	FuchsiaSDKRepoManager        *repo_manager.FuchsiaSDKRepoManagerConfig        `json:"fuchsiaSDKRepoManager,omitempty"`
@@ -187,9 +206,29 @@ type AutoRollerConfig struct {
 
 	// Optional Fields.
 
+	// Configuration for automatically reverting rolls which break the
+	// parent tree. If provided, the roller watches the parent tree after
+	// each roll lands, and if the tree closes and a failing build blames
+	// the roll, it uploads a revert of the roll, stops itself, and notifies
+	// with the suspected culprits. The revert is tracked as a manual roll,
+	// so SupportsManualRolls is required. Only Gerrit and GitHub report the
+	// commit as which a roll landed, which is needed to blame the roll.
+	AutoRevert *revert.Config `json:"autoRevert,omitempty"`
 	// Comma-separated list of trybots to add to roll CLs, in addition to
 	// the default set of commit queue trybots.
 	CqExtraTrybots []string `json:"cqExtraTrybots,omitempty"`
+	// Group to which this roller belongs. All rollers in a group may be
+	// frozen at once; see the freeze package.
+	Group string `json:"group,omitempty"`
+	// Configuration shared by all rollers in the Group, including a shared
+	// time window and atomic rolls. If provided, it must be identical for
+	// every roller in the Group.
+	GroupConfig *group.Config `json:"groupConfig,omitempty"`
+	// Configuration for the "green" roll strategy, which rolls to the most
+	// recent child revision for which the required child-side checks
+	// passed. If provided, the strategy is added to the valid strategies
+	// for the roller.
+	GreenRevision *strategy.GreenRevisionConfig `json:"greenRevision,omitempty"`
 	// Limit to one successful roll within this time period.
 	MaxRollFrequency string `json:"maxRollFrequency,omitempty"`
 	// Any extra notification systems to be used for this roller.
@@ -197,6 +236,15 @@ type AutoRollerConfig struct {
 	// Time window in which the roller is allowed to upload roll CLs. See
 	// the go/time_window package for supported format.
 	TimeWindow string `json:"timeWindow,omitempty"`
+	// IANA name of the timezone in which TimeWindow and the dates in
+	// TimeWindowCalendar are interpreted, eg. "America/New_York". Defaults
+	// to UTC.
+	TimeWindowTimezone string `json:"timeWindowTimezone,omitempty"`
+	// Path or http(s) URL of a calendar file listing dates on which the
+	// roller may not upload roll CLs, eg. holidays and release freezes,
+	// regardless of TimeWindow. See time_window.ParseCalendar for the
+	// format. The calendar is reloaded periodically.
+	TimeWindowCalendar string `json:"timeWindowCalendar,omitempty"`
 	// Throttling configuration to prevent uploading too many CLs within
 	// too short a time period.
 	SafetyThrottle *ThrottleConfig `json:"safetyThrottle,omitempty"`
@@ -235,14 +283,20 @@ func (c *AutoRollerConfig) Validate() error {
 	if c.Gerrit != nil {
 		cr = append(cr, c.Gerrit)
 	}
+	if c.Gitea != nil {
+		cr = append(cr, c.Gitea)
+	}
 	if c.Github != nil {
 		cr = append(cr, c.Github)
 	}
+	if c.GitLab != nil {
+		cr = append(cr, c.GitLab)
+	}
 	if c.Google3Review != nil {
 		cr = append(cr, c.Google3Review)
 	}
 	if len(cr) != 1 {
-		return errors.New("Exactly one of Gerrit, Github, or Google3Review is required.")
+		return errors.New("Exactly one of Gerrit, Gitea, Github, GitLab, or Google3Review is required.")
 	}
 	if err := cr[0].Validate(); err != nil {
 		return err
@@ -255,6 +309,9 @@ func (c *AutoRollerConfig) Validate() error {
 	if err := rm.Validate(); err != nil {
 		return err
 	}
+	if (c.Gitea != nil || c.GitLab != nil) && c.FilePinRepoManager == nil {
+		return errors.New("Gitea and GitLab are only supported by the file-pin repo manager.")
+	}
 
 	if c.Kubernetes == nil {
 		return errors.New("Kubernetes config is required.")
@@ -268,28 +325,164 @@ func (c *AutoRollerConfig) Validate() error {
 	} else if !isNoCheckout && c.Kubernetes.Disk == "" {
 		return errors.New("kubernetes.disk is required for repo managers which use a checkout.")
 	}
+	if sc := rm.GetSensitiveChanges(); sc != nil && sc.UsesPaths() && !rm.ProvidesChangedFiles() {
+		return errors.New("Sensitive change rules with paths are not supported by this repo manager, which does not determine the files changed by each revision.")
+	}
 
 	// Verify that the notifier configs are valid.
 	if _, err := arb_notifier.New(context.Background(), "fake", "fake", "fake", nil, nil, nil, c.Notifiers); err != nil {
 		return err
 	}
 
+	if c.AutoRevert != nil {
+		if err := c.AutoRevert.Validate(); err != nil {
+			return fmt.Errorf("AutoRevert validation failed: %s", err)
+		}
+		if !c.SupportsManualRolls {
+			return errors.New("AutoRevert requires SupportsManualRolls.")
+		}
+		if c.Gerrit == nil && c.Github == nil {
+			return errors.New("AutoRevert requires Gerrit or Github.")
+		}
+	}
+
+	if c.GreenRevision != nil {
+		if err := c.GreenRevision.Validate(); err != nil {
+			return fmt.Errorf("GreenRevision validation failed: %s", err)
+		}
+	}
+
+	if c.GroupConfig != nil {
+		if c.Group == "" {
+			return errors.New("Group is required when GroupConfig is provided.")
+		}
+		if err := c.GroupConfig.Validate(); err != nil {
+			return fmt.Errorf("GroupConfig validation failed: %s", err)
+		}
+		if !util.In(c.RollerName, c.GroupConfig.Rollers) {
+			return fmt.Errorf("GroupConfig does not include roller %q.", c.RollerName)
+		}
+	}
+
 	// Verify that the TimeWindow is valid.
-	_, err = time_window.Parse(c.TimeWindow)
+	loc, err := c.TimeWindowLocation()
+	if err != nil {
+		return err
+	}
+	_, err = time_window.ParseInLocation(c.TimeWindow, loc)
 	return err
 }
 
+// ValidateGroups verifies that the given configs agree on the configuration of
+// each roller group: all rollers in a group must have identical GroupConfigs,
+// and each roller listed in a GroupConfig must belong to the group. Rollers
+// listed in a GroupConfig which are not among the given configs are ignored.
+func ValidateGroups(cfgs []*AutoRollerConfig) error {
+	byGroup := map[string][]*AutoRollerConfig{}
+	byName := map[string]*AutoRollerConfig{}
+	for _, c := range cfgs {
+		byName[c.RollerName] = c
+		if c.Group != "" {
+			byGroup[c.Group] = append(byGroup[c.Group], c)
+		}
+	}
+	for g, members := range byGroup {
+		first := members[0]
+		for _, c := range members[1:] {
+			if !reflect.DeepEqual(first.GroupConfig, c.GroupConfig) {
+				return fmt.Errorf("Rollers %q and %q in group %q have different GroupConfigs.", first.RollerName, c.RollerName, g)
+			}
+		}
+		if first.GroupConfig == nil {
+			continue
+		}
+		if first.GroupConfig.Atomic {
+			// Rollers in an atomic group roll to the same revision,
+			// so they must roll the same child.
+			for _, c := range members[1:] {
+				if c.ChildName != first.ChildName {
+					return fmt.Errorf("Rollers %q and %q in atomic group %q have different ChildNames.", first.RollerName, c.RollerName, g)
+				}
+				if c.childRepo() != first.childRepo() {
+					return fmt.Errorf("Rollers %q and %q in atomic group %q roll different child repos: %q and %q.", first.RollerName, c.RollerName, g, first.childRepo(), c.childRepo())
+				}
+			}
+		}
+		for _, name := range first.GroupConfig.Rollers {
+			if c, ok := byName[name]; ok && c.Group != g {
+				return fmt.Errorf("Roller %q is listed in group %q but belongs to group %q.", name, g, c.Group)
+			}
+		}
+	}
+	return nil
+}
+
+// TimeWindowLocation returns the location in which the TimeWindow is
+// interpreted.
+func (c *AutoRollerConfig) TimeWindowLocation() (*time.Location, error) {
+	if c.TimeWindowTimezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.TimeWindowTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid TimeWindowTimezone %q: %s", c.TimeWindowTimezone, err)
+	}
+	return loc, nil
+}
+
 // Return the code review config for the roller.
 func (c *AutoRollerConfig) CodeReview() codereview.CodeReviewConfig {
+	if c.Gitea != nil {
+		return c.Gitea
+	}
 	if c.Github != nil {
 		return c.Github
 	}
+	if c.GitLab != nil {
+		return c.GitLab
+	}
 	if c.Google3Review != nil {
 		return c.Google3Review
 	}
 	return c.Gerrit
 }
 
+// childRepo returns a string which identifies the child repo and branch rolled
+// by the roller. Repo managers which find the child repo in the parent's DEPS
+// do not name it in their config, so they are identified by the type of repo
+// manager and the path of the child in the parent.
+func (c *AutoRollerConfig) childRepo() string {
+	switch {
+	case c.AndroidRepoManager != nil:
+		return "android:" + c.AndroidRepoManager.ChildPath + "@" + c.AndroidRepoManager.ChildBranch
+	case c.CopyRepoManager != nil:
+		return c.CopyRepoManager.ChildRepo + "@" + c.CopyRepoManager.ChildBranch
+	case c.DEPSRepoManager != nil:
+		return "deps:" + c.DEPSRepoManager.ChildPath + "@" + c.DEPSRepoManager.ChildBranch
+	case c.FilePinRepoManager != nil:
+		return c.FilePinRepoManager.ChildRepo + "@" + c.FilePinRepoManager.ChildBranch
+	case c.FreeTypeRepoManager != nil:
+		return c.FreeTypeRepoManager.ChildRepo + "@" + c.FreeTypeRepoManager.ChildBranch
+	case c.FuchsiaSDKAndroidRepoManager != nil:
+		return "fuchsia-sdk:" + c.FuchsiaSDKAndroidRepoManager.ChildPath
+	case c.FuchsiaSDKRepoManager != nil:
+		return "fuchsia-sdk:" + c.FuchsiaSDKRepoManager.ChildPath
+	case c.GithubRepoManager != nil:
+		return c.GithubRepoManager.ChildRepoURL + "@" + c.GithubRepoManager.ChildBranch
+	case c.GithubCipdDEPSRepoManager != nil:
+		return "cipd:" + c.GithubCipdDEPSRepoManager.CipdAssetName
+	case c.GithubDEPSRepoManager != nil:
+		return "deps:" + c.GithubDEPSRepoManager.ChildPath + "@" + c.GithubDEPSRepoManager.ChildBranch
+	case c.Google3RepoManager != nil:
+		return c.Google3RepoManager.ChildRepo + "@" + c.Google3RepoManager.ChildBranch
+	case c.NoCheckoutDEPSRepoManager != nil:
+		return c.NoCheckoutDEPSRepoManager.ChildRepo + "@" + c.NoCheckoutDEPSRepoManager.ChildBranch
+	case c.SemVerGCSRepoManager != nil:
+		return "gs://" + c.SemVerGCSRepoManager.GCSBucket + "/" + c.SemVerGCSRepoManager.GCSPath
+	}
+	return ""
+}
+
 // Return the RepoManagerConfig for the roller.
 func (c *AutoRollerConfig) repoManagerConfig() (RepoManagerConfig, error) {
 	rm := []RepoManagerConfig{}
@@ -302,6 +495,9 @@ func (c *AutoRollerConfig) repoManagerConfig() (RepoManagerConfig, error) {
 	if c.DEPSRepoManager != nil {
 		rm = append(rm, c.DEPSRepoManager)
 	}
+	if c.FilePinRepoManager != nil {
+		rm = append(rm, c.FilePinRepoManager)
+	}
 	if c.FreeTypeRepoManager != nil {
 		rm = append(rm, c.FreeTypeRepoManager)
 	}
@@ -350,7 +546,21 @@ func (c *AutoRollerConfig) ValidStrategies() []string {
 	if err != nil {
 		sklog.Fatalf("Failed to obtain RepoManagerConfig; this should have been caught during validation! %s", err)
 	}
-	return rm.ValidStrategies()
+	rv := rm.ValidStrategies()
+	if c.GreenRevision != nil {
+		rv = append(util.CopyStringSlice(rv), strategy.ROLL_STRATEGY_GREEN)
+	}
+	return rv
+}
+
+// Return the rules used to detect sensitive changes, or nil if none are
+// configured.
+func (c *AutoRollerConfig) SensitiveChanges() *sensitive.Config {
+	rm, err := c.repoManagerConfig()
+	if err != nil {
+		sklog.Fatalf("Failed to obtain RepoManagerConfig; this should have been caught during validation! %s", err)
+	}
+	return rm.GetSensitiveChanges()
 }
 
 // RepoManagerConfig provides configuration information for RepoManagers.
@@ -360,9 +570,17 @@ type RepoManagerConfig interface {
 	// Return the default NextRollStrategy name.
 	DefaultStrategy() string
 
+	// Return the rules used to detect sensitive changes, or nil if none
+	// are configured.
+	GetSensitiveChanges() *sensitive.Config
+
 	// Return true if the RepoManager does not use a local checkout.
 	NoCheckout() bool
 
+	// Return true if the RepoManager populates the Files of the Revisions
+	// which have not yet been rolled.
+	ProvidesChangedFiles() bool
+
 	// Return the list of valid NextRollStrategy names for this RepoManager.
 	ValidStrategies() []string
 }
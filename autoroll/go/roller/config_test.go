@@ -8,7 +8,11 @@ import (
 	"github.com/flynn/json5"
 	"github.com/stretchr/testify/require"
 	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/autoroll/go/group"
 	"go.skia.org/infra/autoroll/go/repo_manager"
+	"go.skia.org/infra/autoroll/go/revert"
+	"go.skia.org/infra/autoroll/go/sensitive"
+	"go.skia.org/infra/autoroll/go/strategy"
 	"go.skia.org/infra/go/deepequal"
 	"go.skia.org/infra/go/notifier"
 	"go.skia.org/infra/go/testutils/unittest"
@@ -70,7 +74,7 @@ func TestConfigs(t *testing.T) {
 
 	testErr(func(c *AutoRollerConfig) {
 		c.Gerrit = nil
-	}, "Exactly one of Gerrit, Github, or Google3Review is required.")
+	}, "Exactly one of Gerrit, Gitea, Github, GitLab, or Google3Review is required.")
 
 	testErr(func(c *AutoRollerConfig) {
 		c.ParentName = ""
@@ -86,11 +90,28 @@ func TestConfigs(t *testing.T) {
 
 	testErr(func(c *AutoRollerConfig) {
 		c.Google3RepoManager = nil
-	}, "Exactly one repo manager is expected but got 0. At config.go:335 config.go:251 config_test.go:58 config_test.go:87 testing.go:865 asm_amd64.s:1337")
+	}, "Exactly one repo manager is expected but got 0. At config.go:467 config.go:295 config_test.go:61 config_test.go:90 testing.go:865 asm_amd64.s:1337")
 
 	testErr(func(c *AutoRollerConfig) {
 		c.AndroidRepoManager = &repo_manager.AndroidRepoManagerConfig{}
-	}, "Exactly one repo manager is expected but got 2. At config.go:335 config.go:251 config_test.go:58 config_test.go:91 testing.go:865 asm_amd64.s:1337")
+	}, "Exactly one repo manager is expected but got 2. At config.go:467 config.go:295 config_test.go:61 config_test.go:94 testing.go:865 asm_amd64.s:1337")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.Gerrit = nil
+		c.GitLab = &codereview.GitLabConfig{
+			URL:     "https://gitlab.example.com",
+			Project: "my-group/my-project",
+		}
+	}, "Gitea and GitLab are only supported by the file-pin repo manager.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.Gerrit = nil
+		c.Gitea = &codereview.GiteaConfig{
+			URL:       "https://gitea.example.com",
+			RepoOwner: "me",
+			RepoName:  "my-repo",
+		}
+	}, "Gitea and GitLab are only supported by the file-pin repo manager.")
 
 	testErr(func(c *AutoRollerConfig) {
 		c.Notifiers = []*notifier.Config{
@@ -131,6 +152,81 @@ func TestConfigs(t *testing.T) {
 		}
 	}, "kubernetes.disk is not valid for no-checkout repo managers.")
 
+	pathRules := &sensitive.Config{
+		Rules: []*sensitive.Rule{
+			{
+				Name:  "third_party",
+				Paths: []string{"third_party/"},
+			},
+		},
+	}
+	filePinConfig := func(childRevisions string) *repo_manager.FilePinRepoManagerConfig {
+		return &repo_manager.FilePinRepoManagerConfig{
+			DepotToolsRepoManagerConfig: repo_manager.DepotToolsRepoManagerConfig{
+				CommonRepoManagerConfig: repo_manager.CommonRepoManagerConfig{
+					ChildBranch:      "master",
+					ChildPath:        "child",
+					ParentBranch:     "master",
+					ParentRepo:       "fake",
+					SensitiveChanges: pathRules,
+				},
+			},
+			ChildRepo:      "fake",
+			ChildRevisions: childRevisions,
+			VersionFile:    "package.json",
+			VersionKey:     "dependencies.child",
+		}
+	}
+	testErr(func(c *AutoRollerConfig) {
+		c.Google3RepoManager = nil
+		c.FilePinRepoManager = filePinConfig(repo_manager.FILE_PIN_CHILD_REVISIONS_TAGS)
+	}, "Sensitive change rules with paths are not supported by this repo manager, which does not determine the files changed by each revision.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.GreenRevision = &strategy.GreenRevisionConfig{}
+	}, "GreenRevision validation failed: Exactly one of TaskSchedulerURL or StatusURL is required.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.AutoRevert = &revert.Config{}
+	}, "AutoRevert validation failed: TreeStatusURL is required.")
+
+	autoRevert := &revert.Config{
+		TreeStatusURL:    "https://tree-status",
+		FailingBuildsURL: "https://failing-builds",
+	}
+	testErr(func(c *AutoRollerConfig) {
+		c.AutoRevert = autoRevert
+	}, "AutoRevert requires SupportsManualRolls.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.AutoRevert = autoRevert
+		c.SupportsManualRolls = true
+		c.Gerrit = nil
+		c.Google3Review = &codereview.Google3Config{}
+	}, "AutoRevert requires Gerrit or Github.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.TimeWindowTimezone = "Nowhere/Bogus"
+	}, "Invalid TimeWindowTimezone \"Nowhere/Bogus\": unknown time zone Nowhere/Bogus")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.GroupConfig = &group.Config{
+			Rollers: []string{c.RollerName},
+		}
+	}, "Group is required when GroupConfig is provided.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.Group = "my-group"
+		c.GroupConfig = &group.Config{}
+	}, "GroupConfig validation failed: At least one roller is required.")
+
+	testErr(func(c *AutoRollerConfig) {
+		c.Group = "my-group"
+		c.GroupConfig = &group.Config{
+			Rollers: []string{"other-roller"},
+		}
+	}, "GroupConfig does not include roller \"test-roller\".")
+
 	// Helper function: create a valid base config, allow the caller to
 	// mutate it, then assert that validation succeeds.
 	testNoErr := func(fn func(c *AutoRollerConfig)) {
@@ -145,10 +241,20 @@ func TestConfigs(t *testing.T) {
 		c.CqExtraTrybots = []string{"extra-bot"}
 	})
 
+	testNoErr(func(c *AutoRollerConfig) {
+		c.AutoRevert = autoRevert
+		c.SupportsManualRolls = true
+	})
+
 	testNoErr(func(c *AutoRollerConfig) {
 		c.MaxRollFrequency = "1h"
 	})
 
+	testNoErr(func(c *AutoRollerConfig) {
+		c.Google3RepoManager = nil
+		c.FilePinRepoManager = filePinConfig(repo_manager.FILE_PIN_CHILD_REVISIONS_BRANCH)
+	})
+
 	testNoErr(func(c *AutoRollerConfig) {
 		c.Notifiers = []*notifier.Config{
 			{
@@ -174,6 +280,47 @@ func TestConfigs(t *testing.T) {
 		}
 	})
 
+	filePinRepoManager := func(c *AutoRollerConfig) {
+		c.Google3RepoManager = nil
+		c.FilePinRepoManager = &repo_manager.FilePinRepoManagerConfig{
+			DepotToolsRepoManagerConfig: repo_manager.DepotToolsRepoManagerConfig{
+				CommonRepoManagerConfig: repo_manager.CommonRepoManagerConfig{
+					ChildBranch:  "master",
+					ChildPath:    "child",
+					ParentBranch: "master",
+					ParentRepo:   "fake",
+				},
+			},
+			ChildRepo:   "fake",
+			VersionFile: "package.json",
+			VersionKey:  "dependencies.child",
+		}
+	}
+
+	testNoErr(func(c *AutoRollerConfig) {
+		filePinRepoManager(c)
+		c.Gerrit = nil
+		c.GitLab = &codereview.GitLabConfig{
+			URL:             "https://gitlab.example.com",
+			Project:         "my-group/my-project",
+			CommitLabel:     "autoroller: commit",
+			DryRunLabel:     "autoroller: dryrun",
+			TriggerPipeline: true,
+		}
+	})
+
+	testNoErr(func(c *AutoRollerConfig) {
+		filePinRepoManager(c)
+		c.Gerrit = nil
+		c.Gitea = &codereview.GiteaConfig{
+			URL:            "https://gitea.example.com",
+			RepoOwner:      "me",
+			RepoName:       "my-repo",
+			RequiredChecks: []string{"ci/build"},
+			MergeMethod:    "rebase",
+		}
+	})
+
 	testNoErr(func(c *AutoRollerConfig) {
 		c.Gerrit = nil
 		c.Github = &codereview.GithubConfig{
@@ -184,6 +331,100 @@ func TestConfigs(t *testing.T) {
 			MergeMethodURL: "???",
 		}
 	})
+
+	testNoErr(func(c *AutoRollerConfig) {
+		c.TimeWindow = "M-F 09:00-17:00"
+		c.TimeWindowTimezone = "America/New_York"
+	})
+
+	testNoErr(func(c *AutoRollerConfig) {
+		c.GreenRevision = &strategy.GreenRevisionConfig{
+			StatusURL: "https://status/{revision}",
+		}
+	})
+
+	testNoErr(func(c *AutoRollerConfig) {
+		c.Group = "my-group"
+		c.GroupConfig = &group.Config{
+			Rollers:    []string{c.RollerName, "other-roller"},
+			Atomic:     true,
+			TimeWindow: "M-F 09:00-17:00",
+		}
+	})
+
+	// The green strategy is only valid with a GreenRevisionConfig.
+	c := validBaseConfig()
+	require.Equal(t, []string{strategy.ROLL_STRATEGY_BATCH}, c.ValidStrategies())
+	c.GreenRevision = &strategy.GreenRevisionConfig{
+		StatusURL: "https://status/{revision}",
+	}
+	require.Equal(t, []string{strategy.ROLL_STRATEGY_BATCH, strategy.ROLL_STRATEGY_GREEN}, c.ValidStrategies())
+}
+
+func TestValidateGroups(t *testing.T) {
+	unittest.SmallTest(t)
+
+	mk := func(name, g string, gc *group.Config) *AutoRollerConfig {
+		c := validBaseConfig()
+		c.RollerName = name
+		c.Group = g
+		c.GroupConfig = gc
+		return c
+	}
+	gc := &group.Config{
+		Rollers: []string{"a", "b"},
+		Atomic:  true,
+	}
+	require.NoError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", gc),
+		mk("b", "g", gc),
+		mk("c", "", nil),
+		mk("d", "other", nil),
+	}))
+
+	// GroupConfigs must be identical.
+	require.EqualError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", gc),
+		mk("b", "g", &group.Config{
+			Rollers: []string{"a", "b"},
+		}),
+	}), "Rollers \"a\" and \"b\" in group \"g\" have different GroupConfigs.")
+	require.EqualError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", gc),
+		mk("b", "g", nil),
+	}), "Rollers \"a\" and \"b\" in group \"g\" have different GroupConfigs.")
+
+	// Listed rollers must belong to the group.
+	require.EqualError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", gc),
+		mk("b", "other", nil),
+	}), "Roller \"b\" is listed in group \"g\" but belongs to group \"other\".")
+
+	// Rollers in atomic groups must roll the same child.
+	b := mk("b", "g", gc)
+	b.ChildName = "otherChild"
+	require.EqualError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", gc),
+		b,
+	}), "Rollers \"a\" and \"b\" in atomic group \"g\" have different ChildNames.")
+	b = mk("b", "g", gc)
+	b.Google3RepoManager.ChildRepo = "other-repo"
+	require.EqualError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", gc),
+		b,
+	}), "Rollers \"a\" and \"b\" in atomic group \"g\" roll different child repos: \"my-repo@master\" and \"other-repo@master\".")
+
+	// Non-atomic groups may roll different children.
+	nonAtomic := &group.Config{
+		Rollers: []string{"a", "b"},
+	}
+	b = mk("b", "g", nonAtomic)
+	b.ChildName = "otherChild"
+	b.Google3RepoManager.ChildRepo = "other-repo"
+	require.NoError(t, ValidateGroups([]*AutoRollerConfig{
+		mk("a", "g", nonAtomic),
+		b,
+	}))
 }
 
 func TestConfigSerialization(t *testing.T) {
@@ -0,0 +1,132 @@
+package roller
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"go.skia.org/infra/autoroll/go/group"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/state_machine"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/sklog"
+)
+
+// isAtomic returns true iff the roller belongs to an atomic roller group.
+func (c *AutoRollerConfig) isAtomic() bool {
+	return c.GroupConfig != nil && c.GroupConfig.Atomic
+}
+
+// atomicRolledPast returns true iff the roller has rolled to or past the
+// revision of the given AtomicRoll.
+func atomicRolledPast(a *group.AtomicRoll, lastRollRev *revision.Revision, notRolledRevs []*revision.Revision) bool {
+	if a.Revision == lastRollRev.Id {
+		return true
+	}
+	for _, rev := range notRolledRevs {
+		if rev.Id == a.Revision {
+			return false
+		}
+	}
+	// We don't know about the revision. Either we rolled past it, or our
+	// view of the child repo is behind that of the roller which chose it;
+	// use the timestamps to distinguish, if we have them.
+	if a.RevisionTime.IsZero() || lastRollRev.Timestamp.IsZero() {
+		return true
+	}
+	return !lastRollRev.Timestamp.Before(a.RevisionTime)
+}
+
+// updateAtomicRoll returns the updated AtomicRoll for a group, given the
+// current AtomicRoll (which may be nil), the names of the rollers in the
+// group, and the state of the given roller. readyRev is the revision of the
+// roller's current roll if it is ready to submit, or the empty string
+// otherwise; the roller's readiness is recomputed on every call, so that it
+// stops counting as ready once its roll fails or moves to another revision. An AtomicRoll which has not finished within the given timeout is
+// abandoned, so that a roller which is unable to land it does not block the
+// group forever. Returns nil if no update is needed.
+func updateAtomicRoll(a *group.AtomicRoll, rollers []string, rollerName string, lastRollRev, nextRollRev *revision.Revision, notRolledRevs []*revision.Revision, readyRev string, timeout time.Duration, now time.Time) *group.AtomicRoll {
+	var rv *group.AtomicRoll
+	expired := !a.Done(rollers) && a.Expired(timeout, now)
+	if expired {
+		sklog.Warningf("Atomic roll to %s started at %s has not landed in all rollers (landed: %v); abandoning it.", a.Revision, a.Time, a.Landed)
+	}
+	if a == nil || a.Done(rollers) || expired {
+		// Choose the next revision for the group to roll to.
+		if nextRollRev.Id == lastRollRev.Id {
+			return nil
+		}
+		rv = &group.AtomicRoll{
+			Revision:     nextRollRev.Id,
+			RevisionTime: nextRollRev.Timestamp,
+			Time:         now,
+		}
+	} else {
+		rv = a.Copy()
+	}
+	if atomicRolledPast(rv, lastRollRev, notRolledRevs) {
+		rv.SetLanded(rollerName)
+	} else if readyRev == rv.Revision {
+		rv.SetReady(rollerName)
+	} else {
+		rv.UnsetReady(rollerName)
+	}
+	if a != nil && reflect.DeepEqual(a, rv) {
+		return nil
+	}
+	return rv
+}
+
+// atomicNextRollRev returns the revision which the roller should roll to next,
+// given the group's AtomicRoll. If the roller does not know about the
+// AtomicRoll's revision, it should not roll at all.
+func atomicNextRollRev(a *group.AtomicRoll, lastRollRev *revision.Revision, notRolledRevs []*revision.Revision) *revision.Revision {
+	if a != nil {
+		for _, rev := range notRolledRevs {
+			if rev.Id == a.Revision {
+				return rev
+			}
+		}
+	}
+	return lastRollRev
+}
+
+// syncAtomicRoll records the state of the roller in the AtomicRoll of its group
+// and returns the revision which the roller should roll to next.
+func (r *AutoRoller) syncAtomicRoll(ctx context.Context, lastRollRev, nextRollRev *revision.Revision, notRolledRevs []*revision.Revision) (*revision.Revision, error) {
+	// The roller is ready if its dry run has passed, or if it has already
+	// started submitting the roll and the CQ has not failed.
+	readyRev := ""
+	if roll := r.GetActiveRoll(); roll != nil && !roll.IsClosed() {
+		if (roll.IsDryRunFinished() && roll.IsDryRunSuccess()) || (r.sm.Current() == state_machine.S_NORMAL_ACTIVE && !roll.IsFinished()) {
+			readyRev = roll.RollingTo().Id
+		}
+	}
+	a, err := group.UpdateAtomicRoll(ctx, r.cfg.Group, func(a *group.AtomicRoll) *group.AtomicRoll {
+		return updateAtomicRoll(a, r.cfg.GroupConfig.Rollers, r.cfg.RollerName, lastRollRev, nextRollRev, notRolledRevs, readyRev, r.cfg.GroupConfig.GetAtomicTimeout(), time.Now())
+	})
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to update atomic roll for group %q", r.cfg.Group)
+	}
+	r.atomicMtx.Lock()
+	r.atomicRoll = a
+	r.atomicMtx.Unlock()
+	rv := atomicNextRollRev(a, lastRollRev, notRolledRevs)
+	if rv.Id != nextRollRev.Id {
+		sklog.Infof("Group %q is rolling atomically; rolling to %s instead of %s", r.cfg.Group, rv.Id, nextRollRev.Id)
+	}
+	return rv, nil
+}
+
+// atomicCanSubmit returns true iff the roller's current roll is for the
+// revision of its group's AtomicRoll and every roller in the group is ready to
+// submit its roll.
+func (r *AutoRoller) atomicCanSubmit() bool {
+	roll := r.GetActiveRoll()
+	r.atomicMtx.RLock()
+	defer r.atomicMtx.RUnlock()
+	if r.atomicRoll == nil || roll == nil || roll.RollingTo().Id != r.atomicRoll.Revision {
+		return false
+	}
+	return r.atomicRoll.CanSubmit(r.cfg.GroupConfig.Rollers)
+}
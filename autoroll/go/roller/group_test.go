@@ -0,0 +1,118 @@
+package roller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/group"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestUpdateAtomicRoll(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1574000000, 0).UTC()
+	rollers := []string{"a", "b"}
+	revs := []*revision.Revision{
+		{Id: "r3", Timestamp: now.Add(-time.Minute)},
+		{Id: "r2", Timestamp: now.Add(-2 * time.Minute)},
+		{Id: "r1", Timestamp: now.Add(-3 * time.Minute)},
+	}
+	last := &revision.Revision{Id: "r0", Timestamp: now.Add(-4 * time.Minute)}
+	timeout := group.DEFAULT_ATOMIC_TIMEOUT
+
+	// Nothing to roll; don't start an atomic roll.
+	require.Nil(t, updateAtomicRoll(nil, rollers, "a", last, last, nil, "", timeout, now))
+
+	// Roller "a" chooses the revision for the group.
+	a := updateAtomicRoll(nil, rollers, "a", last, revs[1], revs, "", timeout, now)
+	require.Equal(t, &group.AtomicRoll{
+		Revision:     "r2",
+		RevisionTime: revs[1].Timestamp,
+		Time:         now,
+	}, a)
+	require.Equal(t, "r2", atomicNextRollRev(a, last, revs).Id)
+
+	// Roller "b" prefers a different revision but rolls to the group's.
+	require.Nil(t, updateAtomicRoll(a, rollers, "b", last, revs[0], revs, "", timeout, now))
+
+	// Roller "b" doesn't know about the revision yet; it waits.
+	require.Equal(t, "r0", atomicNextRollRev(a, last, revs[:1]).Id)
+	require.Nil(t, updateAtomicRoll(a, rollers, "b", last, last, nil, "", timeout, now))
+
+	// Dry runs for other revisions don't count.
+	require.Nil(t, updateAtomicRoll(a, rollers, "a", last, revs[1], revs, "r3", timeout, now))
+
+	// Both rollers become ready.
+	a = updateAtomicRoll(a, rollers, "a", last, revs[1], revs, "r2", timeout, now)
+	require.Equal(t, []string{"a"}, a.Ready)
+	require.False(t, a.CanSubmit(rollers))
+	a = updateAtomicRoll(a, rollers, "b", last, revs[1], revs, "r2", timeout, now)
+	require.Equal(t, []string{"a", "b"}, a.Ready)
+	require.True(t, a.CanSubmit(rollers))
+	require.False(t, a.Done(rollers))
+
+	// Roller "b" is no longer ready, eg. because its CQ failed. It becomes
+	// ready again when the retry passes.
+	a = updateAtomicRoll(a, rollers, "b", last, revs[1], revs, "", timeout, now)
+	require.Equal(t, []string{"a"}, a.Ready)
+	require.False(t, a.CanSubmit(rollers))
+	require.Nil(t, updateAtomicRoll(a, rollers, "b", last, revs[1], revs, "r3", timeout, now))
+	a = updateAtomicRoll(a, rollers, "b", last, revs[1], revs, "r2", timeout, now)
+	require.Equal(t, []string{"a", "b"}, a.Ready)
+	require.True(t, a.CanSubmit(rollers))
+
+	// Roller "a" lands the roll.
+	a = updateAtomicRoll(a, rollers, "a", revs[1], revs[1], revs[:1], "", timeout, now)
+	require.Equal(t, []string{"a"}, a.Landed)
+	require.True(t, a.CanSubmit(rollers))
+	require.Equal(t, "r2", atomicNextRollRev(a, revs[1], revs[:1]).Id)
+
+	// Roller "b" lands a later revision, eg. via a manual roll.
+	a = updateAtomicRoll(a, rollers, "b", revs[0], revs[0], nil, "", timeout, now)
+	require.Equal(t, []string{"a", "b"}, a.Landed)
+	require.True(t, a.Done(rollers))
+
+	// The next roller to update chooses a new revision.
+	later := now.Add(time.Hour)
+	a = updateAtomicRoll(a, rollers, "a", revs[1], revs[0], revs[:1], "", timeout, later)
+	require.Equal(t, &group.AtomicRoll{
+		Revision:     "r3",
+		RevisionTime: revs[0].Timestamp,
+		Time:         later,
+	}, a)
+
+	// Roller "a" lands the roll, but roller "b" can't. The roll is
+	// abandoned after the timeout and the group moves on.
+	a = updateAtomicRoll(a, rollers, "a", revs[0], revs[0], nil, "", timeout, later)
+	require.Equal(t, []string{"a"}, a.Landed)
+	r4 := &revision.Revision{Id: "r4", Timestamp: later}
+	require.Nil(t, updateAtomicRoll(a, rollers, "a", revs[0], r4, []*revision.Revision{r4}, "", timeout, later.Add(timeout)))
+	expired := later.Add(timeout + time.Minute)
+	a = updateAtomicRoll(a, rollers, "a", revs[0], r4, []*revision.Revision{r4}, "", timeout, expired)
+	require.Equal(t, &group.AtomicRoll{
+		Revision:     "r4",
+		RevisionTime: r4.Timestamp,
+		Time:         expired,
+	}, a)
+}
+
+func TestAtomicRolledPast(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1574000000, 0).UTC()
+	a := &group.AtomicRoll{
+		Revision:     "r2",
+		RevisionTime: now,
+	}
+	notRolled := []*revision.Revision{{Id: "r2"}}
+	require.True(t, atomicRolledPast(a, &revision.Revision{Id: "r2"}, nil))
+	require.False(t, atomicRolledPast(a, &revision.Revision{Id: "r1"}, notRolled))
+
+	// The revision is unknown; use the timestamps.
+	require.False(t, atomicRolledPast(a, &revision.Revision{Id: "r1", Timestamp: now.Add(-time.Minute)}, nil))
+	require.True(t, atomicRolledPast(a, &revision.Revision{Id: "r3", Timestamp: now.Add(time.Minute)}, nil))
+	require.True(t, atomicRolledPast(a, &revision.Revision{Id: "r3"}, nil))
+}
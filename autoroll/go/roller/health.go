@@ -0,0 +1,96 @@
+package roller
+
+import (
+	"time"
+
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/status"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/metrics2"
+)
+
+// stateTimer tracks the time spent by the state machine in each state.
+type stateTimer struct {
+	current string
+	entered time.Time
+	last    time.Time
+	totals  map[string]time.Duration
+}
+
+// newStateTimer returns a stateTimer instance.
+func newStateTimer() *stateTimer {
+	return &stateTimer{
+		totals: map[string]time.Duration{},
+	}
+}
+
+// update records that the state machine is in the given state at the given
+// time. The time since the previous update is attributed to the state given
+// in the previous update.
+func (t *stateTimer) update(state string, now time.Time) {
+	if t.current != "" && now.After(t.last) {
+		t.totals[t.current] += now.Sub(t.last)
+	}
+	if state != t.current {
+		t.current = state
+		t.entered = now
+	}
+	if _, ok := t.totals[state]; !ok {
+		t.totals[state] = 0
+	}
+	t.last = now
+}
+
+// computeHealth returns a status.Health for the given not-yet-rolled revisions,
+// which are in reverse chronological order, and the given recent rolls, which
+// are most recent first.
+func computeHealth(notRolledRevs []*revision.Revision, recent []*autoroll.AutoRollIssue, timer *stateTimer, now time.Time) *status.Health {
+	rv := &status.Health{
+		CommitsBehind:  len(notRolledRevs),
+		RollDurations:  []*status.RollDuration{},
+		State:          timer.current,
+		StateSince:     timer.entered.Unix(),
+		StateDurations: make(map[string]int64, len(timer.totals)),
+	}
+	if len(notRolledRevs) > 0 {
+		if ts := notRolledRevs[len(notRolledRevs)-1].Timestamp; !ts.IsZero() && ts.Before(now) {
+			rv.TimeBehind = int64(now.Sub(ts).Seconds())
+		}
+	}
+	for _, roll := range recent {
+		if roll.Failed() {
+			rv.FailureStreak++
+		} else if roll.Succeeded() {
+			break
+		}
+	}
+	for _, roll := range recent {
+		if roll.Committed && !roll.IsDryRun && roll.Modified.After(roll.Created) {
+			rv.RollDurations = append(rv.RollDurations, &status.RollDuration{
+				Issue:    roll.Issue,
+				Duration: int64(roll.Modified.Sub(roll.Created).Seconds()),
+			})
+		}
+	}
+	for state, d := range timer.totals {
+		rv.StateDurations[state] = int64(d.Seconds())
+	}
+	return rv
+}
+
+// reportHealth updates the health metrics for the given roller.
+func reportHealth(rollerName string, h *status.Health) {
+	tags := map[string]string{"roller": rollerName}
+	metrics2.GetInt64Metric("autoroll_commits_behind", tags).Update(int64(h.CommitsBehind))
+	metrics2.GetInt64Metric("autoroll_time_behind_s", tags).Update(h.TimeBehind)
+	metrics2.GetInt64Metric("autoroll_failure_streak", tags).Update(int64(h.FailureStreak))
+	if len(h.RollDurations) > 0 {
+		metrics2.GetInt64Metric("autoroll_last_roll_duration_s", tags).Update(h.RollDurations[0].Duration)
+	}
+	for state, d := range h.StateDurations {
+		metrics2.GetInt64Metric("autoroll_state_duration_s", map[string]string{
+			"roller": rollerName,
+			"state":  state,
+		}).Update(d)
+	}
+}
@@ -0,0 +1,81 @@
+package roller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/status"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestStateTimer(t *testing.T) {
+	unittest.SmallTest(t)
+	now := time.Unix(1574000000, 0)
+	timer := newStateTimer()
+	timer.update("idle", now)
+	timer.update("idle", now.Add(time.Minute))
+	timer.update("active", now.Add(3*time.Minute))
+	timer.update("idle", now.Add(10*time.Minute))
+	require.Equal(t, "idle", timer.current)
+	require.Equal(t, now.Add(10*time.Minute), timer.entered)
+	require.Equal(t, map[string]time.Duration{
+		"idle":   3 * time.Minute,
+		"active": 7 * time.Minute,
+	}, timer.totals)
+}
+
+func TestComputeHealth(t *testing.T) {
+	unittest.SmallTest(t)
+	now := time.Unix(1574000000, 0)
+	timer := newStateTimer()
+	timer.update("idle", now.Add(-time.Hour))
+	timer.update("active", now.Add(-time.Minute))
+	notRolled := []*revision.Revision{
+		{Id: "c", Timestamp: now.Add(-time.Hour)},
+		{Id: "b", Timestamp: now.Add(-2 * time.Hour)},
+	}
+	recent := []*autoroll.AutoRollIssue{
+		{Issue: 5, Result: autoroll.ROLL_RESULT_IN_PROGRESS},
+		{Issue: 4, Result: autoroll.ROLL_RESULT_FAILURE},
+		{Issue: 3, Result: autoroll.ROLL_RESULT_FAILURE},
+		{
+			Issue:     2,
+			Result:    autoroll.ROLL_RESULT_SUCCESS,
+			Committed: true,
+			Created:   now.Add(-3 * time.Hour),
+			Modified:  now.Add(-150 * time.Minute),
+		},
+		{
+			Issue:     1,
+			Result:    autoroll.ROLL_RESULT_FAILURE,
+			Committed: true,
+			IsDryRun:  true,
+			Created:   now.Add(-5 * time.Hour),
+			Modified:  now.Add(-4 * time.Hour),
+		},
+	}
+	require.Equal(t, &status.Health{
+		CommitsBehind: 2,
+		TimeBehind:    7200,
+		FailureStreak: 2,
+		RollDurations: []*status.RollDuration{
+			{Issue: 2, Duration: 1800},
+		},
+		State:      "active",
+		StateSince: now.Add(-time.Minute).Unix(),
+		StateDurations: map[string]int64{
+			"idle":   3540,
+			"active": 0,
+		},
+	}, computeHealth(notRolled, recent, timer, now))
+
+	// Up to date.
+	h := computeHealth(nil, nil, timer, now)
+	require.Equal(t, 0, h.CommitsBehind)
+	require.Equal(t, int64(0), h.TimeBehind)
+	require.Equal(t, 0, h.FailureStreak)
+	require.Empty(t, h.RollDurations)
+}
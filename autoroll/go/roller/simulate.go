@@ -0,0 +1,344 @@
+package roller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/autoroll/go/codereview"
+	"go.skia.org/infra/autoroll/go/recent_rolls"
+	"go.skia.org/infra/autoroll/go/repo_manager"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/sensitive"
+	"go.skia.org/infra/autoroll/go/state_machine"
+	"go.skia.org/infra/autoroll/go/strategy"
+	"go.skia.org/infra/autoroll/go/time_window"
+	"go.skia.org/infra/go/autoroll"
+	"go.skia.org/infra/go/gcs"
+	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/human"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// Placeholder identity used by the simulated code review.
+	SIMULATED_USER_EMAIL = "autoroll-simulation@example.com"
+	SIMULATED_USER_NAME  = "autoroll-simulation"
+)
+
+// Simulation describes the roll which a roller would create next, given its
+// config and the current state of the child and parent repos.
+type Simulation struct {
+	// The strategy used to choose NextRollRev.
+	Strategy string
+
+	// Revisions, as reported by the RepoManager.
+	LastRollRev   *revision.Revision
+	NextRollRev   *revision.Revision
+	NotRolledRevs []*revision.Revision
+	TipRev        *revision.Revision
+
+	// Rolling contains the revisions which would be included in the roll,
+	// in reverse chronological order. Empty if there is nothing to roll.
+	Rolling []*revision.Revision
+
+	// The roll CL. CommitMsg is empty if there is nothing to roll.
+	CommitMsg      string
+	CqExtraTrybots string
+	Reviewers      []string
+
+	// Sensitive changes included in the roll, if any rules are configured.
+	// If ReviewRequired is true, the roller would upload a dry run and
+	// wait for a human to land it.
+	ReviewRequired   bool
+	SensitiveChanges []*sensitive.Match
+
+	// Restrictions on when the roll would be uploaded. TimeWindow and
+	// GroupTimeWindow are empty if the roller and its group have no time
+	// window. Window is the status of the roll window at the time of the
+	// simulation, which does not take group freezes into account.
+	GroupTimeWindow  string
+	MaxRollFrequency time.Duration
+	SafetyThrottle   *ThrottleConfig
+	TimeWindow       string
+	Window           *time_window.Status
+
+	// The current state of the throttles, as stored by the roller in GCS.
+	// Each is the zero time if the throttle is not active.
+	// ThrottleStateUnknown is true if the state could not be read.
+	FailureThrottledUntil time.Time
+	SafetyThrottledUntil  time.Time
+	SuccessThrottledUntil time.Time
+	ThrottleStateUnknown  bool
+}
+
+// Simulate instantiates the RepoManager and strategy for the given config,
+// updates the RepoManager, and determines the roll which would be created next,
+// without uploading anything or touching the roller's persistent state. If
+// strategyName is empty, the config's default strategy is used. If gcsClient
+// is not nil, the current state of the roller's throttles is read from it.
+// Note that RepoManagers which use a local checkout still sync the checkout in
+// workdir.
+func Simulate(ctx context.Context, c AutoRollerConfig, g *gerrit.Gerrit, githubClient *github.GitHub, workdir, recipesCfgFile, serverURL string, client *http.Client, gcsClient gcs.GCSClient, rollerName, strategyName string, local bool) (*Simulation, error) {
+	if err := c.Validate(); err != nil {
+		return nil, skerr.Wrapf(err, "Failed to validate config")
+	}
+	if strategyName == "" {
+		strategyName = c.DefaultStrategy()
+	} else if !util.In(strategyName, c.ValidStrategies()) {
+		return nil, skerr.Fmt("Invalid strategy %q; expected one of %v", strategyName, c.ValidStrategies())
+	}
+	var statusChecker strategy.StatusChecker
+	if c.GreenRevision != nil {
+		var err error
+		statusChecker, err = strategy.NewStatusChecker(c.GreenRevision, client)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create status checker")
+		}
+	}
+	strat, err := strategy.GetNextRollStrategy(strategyName, statusChecker)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to get next roll strategy")
+	}
+	rm, err := newRepoManager(ctx, c, workdir, g, githubClient, recipesCfgFile, serverURL, client, &simulatedCodeReview{c.CodeReview()}, rollerName, local)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to initialize repo manager")
+	}
+	reviewers, err := getSheriff(c.ParentName, c.ChildName, c.RollerName, c.Sheriff, c.SheriffBackup)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to get sheriff")
+	}
+	loc, err := c.TimeWindowLocation()
+	if err != nil {
+		return nil, err
+	}
+	var calendar []*time_window.Exclusion
+	if c.TimeWindowCalendar != "" {
+		calendar, err = readCalendar(ctx, client, c.TimeWindowCalendar, loc)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to read calendar")
+		}
+	}
+	var classifier *sensitive.Classifier
+	if sc := c.SensitiveChanges(); sc != nil {
+		classifier, err = sensitive.NewClassifier(sc)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create sensitive change classifier")
+		}
+	}
+	return simulate(ctx, c, rm, strategyName, strat, classifier, reviewers, calendar, loc, gcsClient, rollerName, time.Now())
+}
+
+// simulate is a helper for Simulate which uses an already-created RepoManager,
+// strategy and sensitive change classifier, which may be nil. If gcsClient is
+// nil, the state of the throttles is unknown.
+func simulate(ctx context.Context, c AutoRollerConfig, rm repo_manager.RepoManager, strategyName string, strat strategy.NextRollStrategy, classifier *sensitive.Classifier, reviewers []string, calendar []*time_window.Exclusion, loc *time.Location, gcsClient gcs.GCSClient, rollerName string, now time.Time) (*Simulation, error) {
+	rv := &Simulation{
+		CqExtraTrybots: strings.Join(c.CqExtraTrybots, ";"),
+		Reviewers:      reviewers,
+		SafetyThrottle: c.SafetyThrottle,
+		Strategy:       strategyName,
+	}
+	if rv.SafetyThrottle == nil {
+		rv.SafetyThrottle = SAFETY_THROTTLE_CONFIG_DEFAULT
+	}
+	if c.MaxRollFrequency != "" {
+		var err error
+		rv.MaxRollFrequency, err = human.ParseDuration(c.MaxRollFrequency)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to parse maxRollFrequency")
+		}
+	}
+	var tw *time_window.TimeWindow
+	if c.TimeWindow != "" {
+		var err error
+		tw, err = time_window.ParseInLocation(c.TimeWindow, loc)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create TimeWindow")
+		}
+	}
+	var groupTw *time_window.TimeWindow
+	if c.GroupConfig != nil && c.GroupConfig.TimeWindow != "" {
+		groupLoc, err := c.GroupConfig.TimeWindowLocation()
+		if err != nil {
+			return nil, err
+		}
+		groupTw, err = time_window.ParseInLocation(c.GroupConfig.TimeWindow, groupLoc)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "Failed to create group TimeWindow")
+		}
+	}
+	if gcsClient == nil {
+		rv.ThrottleStateUnknown = true
+	} else if err := rv.readThrottleState(ctx, gcsClient, rollerName, now); err != nil {
+		sklog.Warningf("Failed to read throttle state: %s", err)
+		rv.ThrottleStateUnknown = true
+	}
+	rv.TimeWindow = tw.String()
+	rv.GroupTimeWindow = groupTw.String()
+	rv.Window = time_window.GetCombinedStatus(now, []*time_window.TimeWindow{tw, groupTw}, calendar)
+
+	// Find the next roll revision, as the roller would.
+	var err error
+	rv.LastRollRev, rv.TipRev, rv.NotRolledRevs, err = rm.Update(ctx)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to update repo manager")
+	}
+	rv.NextRollRev, err = strat.GetNextRollRev(ctx, rv.NotRolledRevs)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to obtain next roll rev")
+	}
+	if rv.NextRollRev == nil || rv.NextRollRev.Id == rv.LastRollRev.Id {
+		rv.NextRollRev = rv.LastRollRev
+		return rv, nil
+	}
+	found := false
+	for _, rev := range rv.NotRolledRevs {
+		if rev.Id == rv.NextRollRev.Id {
+			found = true
+		}
+		if found {
+			rv.Rolling = append(rv.Rolling, rev)
+		}
+	}
+	if classifier != nil {
+		rv.SensitiveChanges = classifier.Classify(rv.Rolling)
+		rv.ReviewRequired = classifier.ReviewRequired(rv.SensitiveChanges)
+	}
+
+	// Render the commit message.
+	rv.CommitMsg, err = rm.PreviewRoll(ctx, rv.LastRollRev, rv.NextRollRev, rv.Rolling, rv.Reviewers, rv.CqExtraTrybots)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "Failed to build commit message")
+	}
+	return rv, nil
+}
+
+// readThrottleState reads the current state of the roller's throttles from
+// GCS, without modifying it.
+func (s *Simulation) readThrottleState(ctx context.Context, gcsClient gcs.GCSClient, rollerName string, now time.Time) error {
+	var err error
+	s.SafetyThrottledUntil, err = state_machine.ReadThrottledUntil(ctx, gcsClient, rollerName+"/"+SAFETY_THROTTLE_FILE, s.SafetyThrottle.TimeWindow, s.SafetyThrottle.AttemptCount, now)
+	if err != nil {
+		return err
+	}
+	s.FailureThrottledUntil, err = state_machine.ReadThrottledUntil(ctx, gcsClient, rollerName+"/"+FAILURE_THROTTLE_FILE, FAILURE_THROTTLE_PERIOD, 1, now)
+	if err != nil {
+		return err
+	}
+	s.SuccessThrottledUntil, err = state_machine.ReadThrottledUntil(ctx, gcsClient, rollerName+"/"+SUCCESS_THROTTLE_FILE, s.MaxRollFrequency, 1, now)
+	return err
+}
+
+// String returns a human-readable summary of the Simulation.
+func (s *Simulation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Strategy:        %s\n", s.Strategy)
+	fmt.Fprintf(&b, "Last roll:       %s\n", s.LastRollRev.Id)
+	fmt.Fprintf(&b, "Tip of tree:     %s\n", s.TipRev.Id)
+	fmt.Fprintf(&b, "Not yet rolled:  %d revisions\n", len(s.NotRolledRevs))
+	if len(s.Rolling) == 0 {
+		fmt.Fprintf(&b, "Next roll:       none; already up to date\n")
+	} else {
+		fmt.Fprintf(&b, "Next roll:       %s (%d revisions)\n", s.NextRollRev.Id, len(s.Rolling))
+	}
+	fmt.Fprintf(&b, "Reviewers:       %s\n", strings.Join(s.Reviewers, ","))
+	fmt.Fprintf(&b, "Extra trybots:   %s\n", s.CqExtraTrybots)
+	if len(s.SensitiveChanges) > 0 {
+		matches := make([]string, 0, len(s.SensitiveChanges))
+		for _, m := range s.SensitiveChanges {
+			matches = append(matches, fmt.Sprintf("%s (%d revisions)", m.Rule, len(m.Revisions)))
+		}
+		fmt.Fprintf(&b, "Sensitive:       %s\n", strings.Join(matches, ", "))
+		if s.ReviewRequired {
+			fmt.Fprintf(&b, "Human review:    required; the roller would upload a dry run\n")
+		}
+	}
+	if s.TimeWindow == "" {
+		fmt.Fprintf(&b, "Time window:     none\n")
+	} else {
+		fmt.Fprintf(&b, "Time window:     %s\n", s.TimeWindow)
+	}
+	if s.GroupTimeWindow != "" {
+		fmt.Fprintf(&b, "Group window:    %s\n", s.GroupTimeWindow)
+	}
+	if s.Window.Open {
+		fmt.Fprintf(&b, "Window status:   open\n")
+	} else {
+		fmt.Fprintf(&b, "Window status:   closed (%s); opens at %s\n", s.Window.Reason, s.Window.NextOpen.Format(time.RFC1123))
+	}
+	fmt.Fprintf(&b, "Safety throttle: %d attempts per %s\n", s.SafetyThrottle.AttemptCount, s.SafetyThrottle.TimeWindow)
+	if s.MaxRollFrequency == 0 {
+		fmt.Fprintf(&b, "Max frequency:   none\n")
+	} else {
+		fmt.Fprintf(&b, "Max frequency:   one roll per %s\n", s.MaxRollFrequency)
+	}
+	if s.ThrottleStateUnknown {
+		fmt.Fprintf(&b, "Throttled:       unknown\n")
+	} else {
+		throttled := false
+		for _, t := range []struct {
+			name  string
+			until time.Time
+		}{
+			{"safety", s.SafetyThrottledUntil},
+			{"failure", s.FailureThrottledUntil},
+			{"max frequency", s.SuccessThrottledUntil},
+		} {
+			if !t.until.IsZero() {
+				fmt.Fprintf(&b, "Throttled:       until %s (%s)\n", t.until.Format(time.RFC1123), t.name)
+				throttled = true
+			}
+		}
+		if !throttled {
+			fmt.Fprintf(&b, "Throttled:       no\n")
+		}
+	}
+	if s.CommitMsg != "" {
+		fmt.Fprintf(&b, "\nCommit message:\n\n%s\n", s.CommitMsg)
+	}
+	return b.String()
+}
+
+// simulatedCodeReview is a codereview.CodeReview which is used during
+// simulations, so that no code review credentials are required. It cannot be
+// used to retrieve rolls.
+type simulatedCodeReview struct {
+	cfg codereview.CodeReviewConfig
+}
+
+// See documentation for codereview.CodeReview interface.
+func (c *simulatedCodeReview) Config() codereview.CodeReviewConfig {
+	return c.cfg
+}
+
+// See documentation for codereview.CodeReview interface.
+func (c *simulatedCodeReview) GetIssueUrlBase() string {
+	return ""
+}
+
+// See documentation for codereview.CodeReview interface.
+func (c *simulatedCodeReview) GetFullHistoryUrl() string {
+	return ""
+}
+
+// See documentation for codereview.CodeReview interface.
+func (c *simulatedCodeReview) RetrieveRoll(context.Context, *autoroll.AutoRollIssue, *recent_rolls.RecentRolls, *revision.Revision, func(context.Context, codereview.RollImpl) error) (codereview.RollImpl, error) {
+	return nil, errors.New("Rolls cannot be retrieved during a simulation.")
+}
+
+// See documentation for codereview.CodeReview interface.
+func (c *simulatedCodeReview) UserEmail() string {
+	return SIMULATED_USER_EMAIL
+}
+
+// See documentation for codereview.CodeReview interface.
+func (c *simulatedCodeReview) UserName() string {
+	return SIMULATED_USER_NAME
+}
@@ -0,0 +1,168 @@
+package roller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/group"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/autoroll/go/sensitive"
+	"go.skia.org/infra/autoroll/go/state_machine"
+	"go.skia.org/infra/autoroll/go/strategy"
+	"go.skia.org/infra/autoroll/go/time_window"
+	"go.skia.org/infra/go/gcs/test_gcsclient"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+// fakeRepoManager is a repo_manager.RepoManager with fixed revisions.
+type fakeRepoManager struct {
+	lastRollRev   *revision.Revision
+	notRolledRevs []*revision.Revision
+}
+
+func (r *fakeRepoManager) CreateNewRoll(context.Context, *revision.Revision, *revision.Revision, []*revision.Revision, []string, string, bool) (int64, error) {
+	return 0, errors.New("Simulations must not create rolls!")
+}
+
+func (r *fakeRepoManager) Update(context.Context) (*revision.Revision, *revision.Revision, []*revision.Revision, error) {
+	tipRev := r.lastRollRev
+	if len(r.notRolledRevs) > 0 {
+		tipRev = r.notRolledRevs[0]
+	}
+	return r.lastRollRev, tipRev, r.notRolledRevs, nil
+}
+
+func (r *fakeRepoManager) GetRevision(context.Context, string) (*revision.Revision, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func (r *fakeRepoManager) PreviewRoll(_ context.Context, from, to *revision.Revision, rolling []*revision.Revision, emails []string, cqExtraTrybots string) (string, error) {
+	return from.Id + ".." + to.Id, nil
+}
+
+func TestSimulate(t *testing.T) {
+	unittest.SmallTest(t)
+	ctx := context.Background()
+
+	c := AutoRollerConfig{
+		CqExtraTrybots:   []string{"bot1", "bot2"},
+		MaxRollFrequency: "2h",
+		TimeWindow:       "M-F 09:00-17:00",
+	}
+	rm := &fakeRepoManager{
+		lastRollRev: &revision.Revision{Id: "a"},
+		notRolledRevs: []*revision.Revision{
+			{Id: "d"},
+			{Id: "c"},
+			{Id: "b"},
+		},
+	}
+	single, err := strategy.GetNextRollStrategy(strategy.ROLL_STRATEGY_SINGLE, nil)
+	require.NoError(t, err)
+	// Saturday.
+	now := time.Date(2019, time.November, 16, 12, 0, 0, 0, time.UTC)
+	sim, err := simulate(ctx, c, rm, strategy.ROLL_STRATEGY_SINGLE, single, nil, []string{"me@google.com"}, nil, time.UTC, nil, "", now)
+	require.NoError(t, err)
+	require.Equal(t, "b", sim.NextRollRev.Id)
+	require.Equal(t, "d", sim.TipRev.Id)
+	require.Len(t, sim.Rolling, 1)
+	require.Equal(t, "a..b", sim.CommitMsg)
+	require.Equal(t, "bot1;bot2", sim.CqExtraTrybots)
+	require.Equal(t, []string{"me@google.com"}, sim.Reviewers)
+	require.Equal(t, 2*time.Hour, sim.MaxRollFrequency)
+	require.Equal(t, "M-F 09:00-17:00 (UTC)", sim.TimeWindow)
+	require.Equal(t, SAFETY_THROTTLE_CONFIG_DEFAULT, sim.SafetyThrottle)
+	require.False(t, sim.Window.Open)
+	require.Equal(t, time.Date(2019, time.November, 18, 9, 0, 0, 0, time.UTC), sim.Window.NextOpen)
+
+	// Calendar exclusions apply, and the batch strategy rolls everything.
+	batch, err := strategy.GetNextRollStrategy(strategy.ROLL_STRATEGY_BATCH, nil)
+	require.NoError(t, err)
+	c.TimeWindow = ""
+	calendar := []*time_window.Exclusion{
+		{
+			Start:  now.Add(-time.Hour),
+			End:    now.Add(time.Hour),
+			Reason: "Release",
+		},
+	}
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, nil, nil, calendar, time.UTC, nil, "", now)
+	require.NoError(t, err)
+	require.Equal(t, "d", sim.NextRollRev.Id)
+	require.Len(t, sim.Rolling, 3)
+	require.Equal(t, "a..d", sim.CommitMsg)
+	require.False(t, sim.Window.Open)
+	require.Equal(t, now.Add(time.Hour), sim.Window.NextOpen)
+	require.Contains(t, sim.String(), "Next roll:       d (3 revisions)")
+
+	// The group's time window also applies.
+	c.GroupConfig = &group.Config{
+		Rollers:    []string{"my-roller"},
+		TimeWindow: "Sa 13:00-14:00",
+	}
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, nil, nil, nil, time.UTC, nil, "", now)
+	require.NoError(t, err)
+	require.Equal(t, "Sa 13:00-14:00 (UTC)", sim.GroupTimeWindow)
+	require.False(t, sim.Window.Open)
+	require.Equal(t, now.Add(time.Hour), sim.Window.NextOpen)
+	require.Contains(t, sim.String(), "Group window:    Sa 13:00-14:00 (UTC)")
+	c.GroupConfig = nil
+
+	// Sensitive changes are reported.
+	rm.notRolledRevs[1].Files = []string{"third_party/foo/foo.c"}
+	classifier, err := sensitive.NewClassifier(&sensitive.Config{
+		Rules: []*sensitive.Rule{
+			{
+				Name:  "third_party",
+				Paths: []string{"third_party/"},
+			},
+		},
+		RequireReview: true,
+	})
+	require.NoError(t, err)
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, classifier, nil, nil, time.UTC, nil, "", now)
+	require.NoError(t, err)
+	require.Len(t, sim.SensitiveChanges, 1)
+	require.Equal(t, "third_party", sim.SensitiveChanges[0].Rule)
+	require.Equal(t, []*revision.Revision{rm.notRolledRevs[1]}, sim.SensitiveChanges[0].Revisions)
+	require.True(t, sim.ReviewRequired)
+	require.Contains(t, sim.String(), "Sensitive:       third_party (1 revisions)")
+	require.Contains(t, sim.String(), "Human review:    required")
+
+	// Nothing to roll.
+	rm.notRolledRevs = nil
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, nil, nil, nil, time.UTC, nil, "", now)
+	require.NoError(t, err)
+	require.Equal(t, "a", sim.NextRollRev.Id)
+	require.Empty(t, sim.Rolling)
+	require.Equal(t, "", sim.CommitMsg)
+	require.True(t, sim.Window.Open)
+	require.Contains(t, sim.String(), "Next roll:       none; already up to date")
+	require.True(t, sim.ThrottleStateUnknown)
+	require.Contains(t, sim.String(), "Throttled:       unknown")
+
+	// The current throttle state is read from GCS.
+	gcsClient := test_gcsclient.NewMemoryClient("fake-bucket")
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, nil, nil, nil, time.UTC, gcsClient, "my-roller", now)
+	require.NoError(t, err)
+	require.False(t, sim.ThrottleStateUnknown)
+	require.True(t, sim.SuccessThrottledUntil.IsZero())
+	require.Contains(t, sim.String(), "Throttled:       no")
+	successThrottle, err := state_machine.NewThrottler(ctx, gcsClient, "my-roller/"+SUCCESS_THROTTLE_FILE, 2*time.Hour, 1)
+	require.NoError(t, err)
+	require.NoError(t, successThrottle.Inc(ctx))
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, nil, nil, nil, time.UTC, gcsClient, "my-roller", now)
+	require.NoError(t, err)
+	require.Equal(t, successThrottle.ThrottledUntil(), sim.SuccessThrottledUntil)
+	require.True(t, sim.SafetyThrottledUntil.IsZero())
+	require.True(t, sim.FailureThrottledUntil.IsZero())
+	require.Contains(t, sim.String(), "(max frequency)")
+
+	// Throttles which have already expired don't apply.
+	sim, err = simulate(ctx, c, rm, strategy.ROLL_STRATEGY_BATCH, batch, nil, nil, nil, time.UTC, gcsClient, "my-roller", successThrottle.ThrottledUntil())
+	require.NoError(t, err)
+	require.True(t, sim.SuccessThrottledUntil.IsZero())
+}
@@ -0,0 +1,225 @@
+// Package sensitive classifies the revisions included in a roll according to
+// configurable rules, so that changes which touch security-sensitive areas of
+// the child repo, eg. third_party code, license files or build flags, can be
+// called out in the roll CL and optionally held for human review.
+package sensitive
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.skia.org/infra/autoroll/go/revision"
+)
+
+// Rule describes one category of sensitive changes. A revision matches the
+// Rule if it matches any of the Rule's Paths, Authors or Keywords.
+type Rule struct {
+	// Name of the Rule, used in roll CL descriptions, eg. "third_party".
+	Name string `json:"name"`
+
+	// At least one of Paths, Authors or Keywords is required.
+
+	// Paths are matched against the files changed by each revision. A
+	// pattern ending in "/" matches every file in that directory, eg.
+	// "third_party/". Other patterns use path.Match syntax and are matched
+	// against the full path of each file, or against its base name if the
+	// pattern contains no "/", eg. "LICENSE" or "*.gni". Paths can only be
+	// used with RepoManagers which determine the files changed by each
+	// revision, ie. those which roll commits from a local checkout of the
+	// child repo.
+	Paths []string `json:"paths,omitempty"`
+
+	// Authors are regular expressions which are matched against the author
+	// of each revision.
+	Authors []string `json:"authors,omitempty"`
+
+	// Keywords are regular expressions which are matched against the
+	// description and details of each revision, eg. a commit message.
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+// Validate the Rule.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("Name is required.")
+	}
+	if len(r.Paths) == 0 && len(r.Authors) == 0 && len(r.Keywords) == 0 {
+		return fmt.Errorf("Rule %q requires at least one of Paths, Authors, or Keywords.", r.Name)
+	}
+	for _, p := range r.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("Rule %q has invalid path %q: %s", r.Name, p, err)
+		}
+	}
+	for _, a := range r.Authors {
+		if _, err := regexp.Compile(a); err != nil {
+			return fmt.Errorf("Rule %q has invalid author regex %q: %s", r.Name, a, err)
+		}
+	}
+	for _, k := range r.Keywords {
+		if _, err := regexp.Compile(k); err != nil {
+			return fmt.Errorf("Rule %q has invalid keyword regex %q: %s", r.Name, k, err)
+		}
+	}
+	return nil
+}
+
+// Config provides configuration for sensitive change detection.
+type Config struct {
+	// Rules used to classify revisions.
+	Rules []*Rule `json:"rules"`
+
+	// Optional fields.
+
+	// RequireReview indicates that rolls which include sensitive changes
+	// must be reviewed and landed by a human. The roller only uploads dry
+	// runs while the next roll includes sensitive changes.
+	RequireReview bool `json:"requireReview,omitempty"`
+}
+
+// Validate the Config.
+func (c *Config) Validate() error {
+	if len(c.Rules) == 0 {
+		return errors.New("At least one rule is required.")
+	}
+	names := map[string]bool{}
+	for _, r := range c.Rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return fmt.Errorf("Duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+// UsesPaths returns true iff any of the Rules match on changed files.
+func (c *Config) UsesPaths() bool {
+	for _, r := range c.Rules {
+		if len(r.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Match lists the revisions which matched a single Rule.
+type Match struct {
+	Rule      string
+	Revisions []*revision.Revision
+}
+
+// rule is a Rule whose regular expressions have been compiled.
+type rule struct {
+	name     string
+	paths    []string
+	authors  []*regexp.Regexp
+	keywords []*regexp.Regexp
+}
+
+// matchPath returns true iff the given file matches the pattern.
+func matchPath(pattern, file string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(file, pattern)
+	}
+	if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+	// Errors are ruled out by Rule.Validate.
+	ok, _ := path.Match(pattern, file)
+	return ok
+}
+
+// match returns true iff the given revision matches the rule.
+func (r *rule) match(rev *revision.Revision) bool {
+	for _, p := range r.paths {
+		for _, f := range rev.Files {
+			if matchPath(p, f) {
+				return true
+			}
+		}
+	}
+	for _, re := range r.authors {
+		if re.MatchString(rev.Author) {
+			return true
+		}
+	}
+	for _, re := range r.keywords {
+		if re.MatchString(rev.Description) || re.MatchString(rev.Details) {
+			return true
+		}
+	}
+	return false
+}
+
+// Classifier classifies revisions according to a Config.
+type Classifier struct {
+	requireReview bool
+	rules         []*rule
+	usesPaths     bool
+}
+
+// NewClassifier returns a Classifier for the given Config.
+func NewClassifier(c *Config) (*Classifier, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	rules := make([]*rule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		compiled := &rule{
+			name:  r.Name,
+			paths: r.Paths,
+		}
+		for _, a := range r.Authors {
+			compiled.authors = append(compiled.authors, regexp.MustCompile(a))
+		}
+		for _, k := range r.Keywords {
+			compiled.keywords = append(compiled.keywords, regexp.MustCompile(k))
+		}
+		rules = append(rules, compiled)
+	}
+	return &Classifier{
+		requireReview: c.RequireReview,
+		rules:         rules,
+		usesPaths:     c.UsesPaths(),
+	}, nil
+}
+
+// Classify returns a Match for each Rule which matched at least one of the
+// given revisions, in the order in which the Rules were configured. Within
+// each Match, the revisions are in the same order as they were given.
+func (c *Classifier) Classify(revs []*revision.Revision) []*Match {
+	var rv []*Match
+	for _, r := range c.rules {
+		var matched []*revision.Revision
+		for _, rev := range revs {
+			if r.match(rev) {
+				matched = append(matched, rev)
+			}
+		}
+		if len(matched) > 0 {
+			rv = append(rv, &Match{
+				Rule:      r.name,
+				Revisions: matched,
+			})
+		}
+	}
+	return rv
+}
+
+// ReviewRequired returns true iff a roll with the given Matches must be
+// reviewed and landed by a human.
+func (c *Classifier) ReviewRequired(matches []*Match) bool {
+	return c.requireReview && len(matches) > 0
+}
+
+// UsesPaths returns true iff any of the Rules match on changed files, in which
+// case the Files of each revision must be populated before classifying.
+func (c *Classifier) UsesPaths() bool {
+	return c.usesPaths
+}
@@ -0,0 +1,151 @@
+package sensitive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestConfigValidation(t *testing.T) {
+	unittest.SmallTest(t)
+
+	validConfig := func() *Config {
+		return &Config{
+			Rules: []*Rule{
+				{
+					Name:  "third_party",
+					Paths: []string{"third_party/"},
+				},
+			},
+		}
+	}
+	require.NoError(t, validConfig().Validate())
+
+	testErr := func(fn func(c *Config), err string) {
+		c := validConfig()
+		fn(c)
+		require.EqualError(t, c.Validate(), err)
+	}
+	testErr(func(c *Config) {
+		c.Rules = nil
+	}, "At least one rule is required.")
+	testErr(func(c *Config) {
+		c.Rules[0].Name = ""
+	}, "Name is required.")
+	testErr(func(c *Config) {
+		c.Rules[0].Paths = nil
+	}, "Rule \"third_party\" requires at least one of Paths, Authors, or Keywords.")
+	testErr(func(c *Config) {
+		c.Rules[0].Paths = []string{"[a-"}
+	}, "Rule \"third_party\" has invalid path \"[a-\": syntax error in pattern")
+	testErr(func(c *Config) {
+		c.Rules[0].Authors = []string{"("}
+	}, "Rule \"third_party\" has invalid author regex \"(\": error parsing regexp: missing closing ): `(`")
+	testErr(func(c *Config) {
+		c.Rules[0].Keywords = []string{"("}
+	}, "Rule \"third_party\" has invalid keyword regex \"(\": error parsing regexp: missing closing ): `(`")
+	testErr(func(c *Config) {
+		c.Rules = append(c.Rules, &Rule{
+			Name:    "third_party",
+			Authors: []string{"me@google.com"},
+		})
+	}, "Duplicate rule name \"third_party\"")
+}
+
+func TestMatchPath(t *testing.T) {
+	unittest.SmallTest(t)
+
+	test := func(pattern, file string, expect bool) {
+		require.Equal(t, expect, matchPath(pattern, file), "%s %s", pattern, file)
+	}
+	test("third_party/", "third_party/foo/foo.c", true)
+	test("third_party/", "src/third_party/foo.c", false)
+	test("third_party/", "third_party", false)
+	test("LICENSE", "LICENSE", true)
+	test("LICENSE", "third_party/foo/LICENSE", true)
+	test("LICENSE", "LICENSE.txt", false)
+	test("*.gni", "gn/flags.gni", true)
+	test("gn/*.gni", "gn/flags.gni", true)
+	test("gn/*.gni", "other/gn/flags.gni", false)
+	test("BUILD.gn", "src/BUILD.gn.bak", false)
+}
+
+func TestClassify(t *testing.T) {
+	unittest.SmallTest(t)
+
+	c, err := NewClassifier(&Config{
+		Rules: []*Rule{
+			{
+				Name:  "third_party",
+				Paths: []string{"third_party/"},
+			},
+			{
+				Name:  "license",
+				Paths: []string{"LICENSE", "COPYING"},
+			},
+			{
+				Name:     "build flags",
+				Paths:    []string{"*.gni"},
+				Keywords: []string{`(?i)\bsecurity\b`},
+			},
+			{
+				Name:    "external",
+				Authors: []string{`@(?:example\.com|other\.org)$`},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, c.UsesPaths())
+
+	a := &revision.Revision{
+		Id:     "a",
+		Author: "me@google.com",
+		Files:  []string{"src/foo.cpp", "third_party/foo/LICENSE"},
+	}
+	b := &revision.Revision{
+		Id:          "b",
+		Author:      "you@example.com",
+		Description: "Fix a bug",
+		Details:     "Fix a security bug.",
+	}
+	d := &revision.Revision{
+		Id:          "d",
+		Author:      "me@google.com",
+		Description: "Insecurity is not matched",
+		Files:       []string{"src/bar.cpp"},
+	}
+	require.Empty(t, c.Classify(nil))
+	require.Empty(t, c.Classify([]*revision.Revision{d}))
+	require.False(t, c.ReviewRequired(nil))
+
+	matches := c.Classify([]*revision.Revision{d, b, a})
+	require.Len(t, matches, 4)
+	require.Equal(t, "third_party", matches[0].Rule)
+	require.Equal(t, []*revision.Revision{a}, matches[0].Revisions)
+	require.Equal(t, "license", matches[1].Rule)
+	require.Equal(t, []*revision.Revision{a}, matches[1].Revisions)
+	require.Equal(t, "build flags", matches[2].Rule)
+	require.Equal(t, []*revision.Revision{b}, matches[2].Revisions)
+	require.Equal(t, "external", matches[3].Rule)
+	require.Equal(t, []*revision.Revision{b}, matches[3].Revisions)
+
+	// Review is only required if configured.
+	require.False(t, c.ReviewRequired(matches))
+	c, err = NewClassifier(&Config{
+		Rules: []*Rule{
+			{
+				Name:    "external",
+				Authors: []string{`@example\.com$`},
+			},
+		},
+		RequireReview: true,
+	})
+	require.NoError(t, err)
+	require.False(t, c.UsesPaths())
+	matches = c.Classify([]*revision.Revision{d, b, a})
+	require.Len(t, matches, 1)
+	require.True(t, c.ReviewRequired(matches))
+	require.False(t, c.ReviewRequired(c.Classify([]*revision.Revision{a})))
+}
@@ -0,0 +1,155 @@
+package main
+
+/*
+	Simulate the next roll for an AutoRoll config, without uploading anything.
+
+	Instantiates the configured RepoManager and strategy, updates the
+	RepoManager, and prints the next roll revision, the commit message, the
+	reviewers and trybots, and the time window and throttling which apply,
+	including whether the roller is currently throttled.
+	The parent and child repo URLs in the config may point to local repos.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/flynn/json5"
+	"go.skia.org/infra/autoroll/go/roller"
+	"go.skia.org/infra/go/auth"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/gcs"
+	"go.skia.org/infra/go/gcs/gcsclient"
+	"go.skia.org/infra/go/gerrit"
+	"go.skia.org/infra/go/github"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+var (
+	config         = flag.String("config", "", "Config file to simulate.")
+	gcsBucket      = flag.String("gcs_bucket", "skia-autoroll", "GCS bucket in which the roller stores its state, used to report whether it is throttled. Set to empty to skip.")
+	jsonOutput     = flag.Bool("json", false, "If set, print the simulation results as JSON.")
+	local          = flag.Bool("local", true, "Use the local user's credentials, as opposed to the default service account.")
+	noAuth         = flag.Bool("no_auth", false, "Use an unauthenticated HTTP client, eg. if all of the repos are local.")
+	recipesCfgFile = flag.String("recipes_cfg", "", "Path to the recipes.cfg file. Defaults to recipes.cfg in --workdir.")
+	strategy       = flag.String("strategy", "", "Roll strategy to use. Defaults to the config's default strategy.")
+	workdir        = flag.String("workdir", "", "Directory to use for checkouts. Defaults to a temporary dir which is deleted afterward.")
+)
+
+func main() {
+	common.Init()
+	if err := run(context.Background()); err != nil {
+		sklog.Fatal(err)
+	}
+}
+
+// run performs the simulation. It is separate from main so that deferred
+// cleanup runs before exiting on error.
+func run(ctx context.Context) error {
+	if *config == "" {
+		return errors.New("--config is required.")
+	}
+	var cfg roller.AutoRollerConfig
+	if err := util.WithReadFile(*config, func(r io.Reader) error {
+		return json5.NewDecoder(r).Decode(&cfg)
+	}); err != nil {
+		return fmt.Errorf("Failed to read %s: %s", *config, err)
+	}
+
+	if *workdir == "" {
+		tmp, err := ioutil.TempDir("", "simulate_roller")
+		if err != nil {
+			return err
+		}
+		defer util.RemoveAll(tmp)
+		*workdir = tmp
+	}
+	if *recipesCfgFile == "" {
+		*recipesCfgFile = filepath.Join(*workdir, "recipes.cfg")
+	}
+
+	client := httputils.DefaultClientConfig().With2xxOnly().Client()
+	var gcsClient gcs.GCSClient
+	if !*noAuth {
+		ts, err := auth.NewDefaultTokenSource(*local, auth.SCOPE_USERINFO_EMAIL, auth.SCOPE_GERRIT, auth.SCOPE_READ_ONLY)
+		if err != nil {
+			return err
+		}
+		client = httputils.DefaultClientConfig().WithTokenSource(ts).With2xxOnly().Client()
+		if *gcsBucket != "" {
+			s, err := storage.NewClient(ctx, option.WithTokenSource(ts))
+			if err != nil {
+				return err
+			}
+			gcsClient = gcsclient.New(s, *gcsBucket)
+		}
+	}
+
+	// Code review clients are only used for reading; they are not required
+	// unless the RepoManager uses them to find revisions.
+	usr, err := user.Current()
+	if err != nil {
+		return err
+	}
+	var g *gerrit.Gerrit
+	var githubClient *github.GitHub
+	if cfg.Gerrit != nil {
+		gc, err := cfg.Gerrit.GetConfig()
+		if err != nil {
+			return fmt.Errorf("Failed to get Gerrit config: %s", err)
+		}
+		g, err = gerrit.NewGerritWithConfig(gc, cfg.Gerrit.URL, filepath.Join(usr.HomeDir, ".gitcookies"), nil)
+		if err != nil {
+			return fmt.Errorf("Failed to create Gerrit client: %s", err)
+		}
+	} else if cfg.Github != nil {
+		if b, err := ioutil.ReadFile(path.Join(usr.HomeDir, github.GITHUB_TOKEN_FILENAME)); err != nil {
+			sklog.Warningf("Not creating a Github client: %s", err)
+		} else {
+			httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: strings.TrimSpace(string(b))}))
+			githubClient, err = github.NewGitHub(ctx, cfg.Github.RepoOwner, cfg.Github.RepoName, httpClient)
+			if err != nil {
+				return fmt.Errorf("Could not create Github client: %s", err)
+			}
+		}
+	}
+
+	// Set environment variable for depot_tools.
+	if err := os.Setenv("SKIP_GCE_AUTH_FOR_GIT", "1"); err != nil {
+		return err
+	}
+
+	serverURL := roller.AUTOROLL_URL_PUBLIC + "/r/" + cfg.RollerName
+	if cfg.IsInternal {
+		serverURL = roller.AUTOROLL_URL_PRIVATE + "/r/" + cfg.RollerName
+	}
+	sim, err := roller.Simulate(ctx, cfg, g, githubClient, *workdir, *recipesCfgFile, serverURL, client, gcsClient, cfg.RollerName, *strategy, *local)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		b, err := json.MarshalIndent(sim, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		fmt.Print(sim.String())
+	}
+	return nil
+}
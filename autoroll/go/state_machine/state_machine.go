@@ -217,17 +217,43 @@ func (t *Throttler) ThrottledUntil() time.Time {
 	if t.c == nil {
 		return time.Time{}
 	}
-	times := t.c.GetDecrementTimes()
-	if int64(len(times)) < t.threshold {
+	return throttledUntil(t.c.GetDecrementTimes(), t.threshold)
+}
+
+// throttledUntil returns the approximate time when a Throttler with the given
+// counter decrement times and threshold will no longer be throttled.
+func throttledUntil(times []time.Time, threshold int64) time.Time {
+	if int64(len(times)) < threshold {
 		return time.Time{}
 	}
 	sort.Slice(times, func(i, j int) bool {
 		return times[i].Before(times[j])
 	})
-	idx := int64(len(times)) - t.threshold
+	idx := int64(len(times)) - threshold
 	return times[idx]
 }
 
+// ReadThrottledUntil returns the approximate time when a Throttler created
+// with the given parameters would no longer be throttled, as of the given
+// time. Unlike NewThrottler, it does not modify the file in GCS. Returns the
+// zero time if the Throttler would not be throttled.
+func ReadThrottledUntil(ctx context.Context, gcsClient gcs.GCSClient, gcsPath string, period time.Duration, attempts int64, now time.Time) (time.Time, error) {
+	if period <= time.Duration(0) || attempts <= 0 {
+		return time.Time{}, nil
+	}
+	times, err := counters.ReadDecrementTimes(ctx, gcsClient, gcsPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	pending := make([]time.Time, 0, len(times))
+	for _, t := range times {
+		if t.After(now) {
+			pending = append(pending, t)
+		}
+	}
+	return throttledUntil(pending, attempts), nil
+}
+
 // New returns a StateMachine for the autoroller.
 func New(ctx context.Context, impl AutoRollerImpl, n *notifier.AutoRollNotifier, gcsClient gcs.GCSClient, gcsPrefix string) (*AutoRollStateMachine, error) {
 	s := &AutoRollStateMachine{
@@ -41,6 +41,44 @@ type AutoRollStatus struct {
 	ThrottledUntil     int64                     `json:"throttledUntil"`
 	ValidModes         []string                  `json:"validModes"`
 	ValidStrategies    []string                  `json:"validStrategies"`
+	// WindowClosedReason and WindowOpensAt (in seconds since the epoch)
+	// are set while the roller is waiting for its roll window to open.
+	WindowClosedReason string `json:"windowClosedReason"`
+	WindowOpensAt      int64  `json:"windowOpensAt"`
+	// Health indicates whether the roller is keeping up with the child.
+	Health *Health `json:"health"`
+}
+
+// Health provides metrics which indicate whether a roller is keeping up with
+// its child repo. All durations are in seconds.
+type Health struct {
+	// The number of child revisions which have not been rolled.
+	CommitsBehind int `json:"commitsBehind"`
+
+	// The age of the oldest child revision which has not been rolled, or
+	// zero if the roller is up to date or the age is not known.
+	TimeBehind int64 `json:"timeBehind"`
+
+	// The number of consecutive failed rolls.
+	FailureStreak int `json:"failureStreak"`
+
+	// Time from upload to land of recently-landed rolls, most recent first.
+	RollDurations []*RollDuration `json:"rollDurations"`
+
+	// The current state of the state machine and when it was entered, in
+	// seconds since the epoch.
+	State      string `json:"state"`
+	StateSince int64  `json:"stateSince"`
+
+	// Total time spent in each state of the state machine since the roller
+	// started.
+	StateDurations map[string]int64 `json:"stateDurations"`
+}
+
+// RollDuration is the time from upload to land of a single roll.
+type RollDuration struct {
+	Issue    int64 `json:"issue"`
+	Duration int64 `json:"duration"`
 }
 
 // AutoRollMiniStatus is a struct which provides a minimal amount of status
@@ -215,6 +253,8 @@ func (s *AutoRollStatus) Copy() *AutoRollStatus {
 		ThrottledUntil:     s.ThrottledUntil,
 		ValidModes:         util.CopyStringSlice(s.ValidModes),
 		ValidStrategies:    util.CopyStringSlice(s.ValidStrategies),
+		WindowClosedReason: s.WindowClosedReason,
+		WindowOpensAt:      s.WindowOpensAt,
 	}
 	if s.CurrentRoll != nil {
 		rv.CurrentRoll = s.CurrentRoll.Copy()
@@ -222,6 +262,36 @@ func (s *AutoRollStatus) Copy() *AutoRollStatus {
 	if s.LastRoll != nil {
 		rv.LastRoll = s.LastRoll.Copy()
 	}
+	if s.Health != nil {
+		rv.Health = s.Health.Copy()
+	}
+	return rv
+}
+
+// Copy returns a deep copy of the Health.
+func (h *Health) Copy() *Health {
+	rv := &Health{
+		CommitsBehind: h.CommitsBehind,
+		TimeBehind:    h.TimeBehind,
+		FailureStreak: h.FailureStreak,
+		State:         h.State,
+		StateSince:    h.StateSince,
+	}
+	if h.RollDurations != nil {
+		rv.RollDurations = make([]*RollDuration, 0, len(h.RollDurations))
+		for _, d := range h.RollDurations {
+			rv.RollDurations = append(rv.RollDurations, &RollDuration{
+				Issue:    d.Issue,
+				Duration: d.Duration,
+			})
+		}
+	}
+	if h.StateDurations != nil {
+		rv.StateDurations = make(map[string]int64, len(h.StateDurations))
+		for k, v := range h.StateDurations {
+			rv.StateDurations[k] = v
+		}
+	}
 	return rv
 }
 
@@ -48,12 +48,30 @@ func TestCopyStatus(t *testing.T) {
 				Id: "b",
 			},
 		},
-		ParentName:      "parent-repo",
-		Recent:          recent,
-		Status:          "some-status",
-		ThrottledUntil:  time.Now().Unix(),
-		ValidModes:      modes.VALID_MODES,
-		ValidStrategies: []string{strategy.ROLL_STRATEGY_SINGLE, strategy.ROLL_STRATEGY_BATCH},
+		ParentName:         "parent-repo",
+		Recent:             recent,
+		Status:             "some-status",
+		ThrottledUntil:     time.Now().Unix(),
+		ValidModes:         modes.VALID_MODES,
+		ValidStrategies:    []string{strategy.ROLL_STRATEGY_SINGLE, strategy.ROLL_STRATEGY_BATCH},
+		WindowClosedReason: "Outside of roll window",
+		WindowOpensAt:      time.Now().Unix(),
+		Health: &Health{
+			CommitsBehind: 6,
+			TimeBehind:    3600,
+			FailureStreak: 3,
+			RollDurations: []*RollDuration{
+				{
+					Issue:    123,
+					Duration: 1800,
+				},
+			},
+			State:      "some-status",
+			StateSince: time.Now().Unix(),
+			StateDurations: map[string]int64{
+				"some-status": 60,
+			},
+		},
 	}
 	deepequal.AssertCopy(t, v, v.Copy())
 }
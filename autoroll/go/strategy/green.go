@@ -0,0 +1,257 @@
+package strategy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	// Placeholder in GreenRevisionConfig.StatusURL which is replaced with
+	// the ID of the Revision.
+	STATUS_URL_REVISION_PLACEHOLDER = "{revision}"
+
+	// Result reported by a status endpoint for a check which passed.
+	CHECK_RESULT_SUCCESS = "success"
+)
+
+// GreenRevisionConfig provides configuration for ROLL_STRATEGY_GREEN, which
+// rolls to the most recent child revision for which all of the required
+// child-side checks passed. Exactly one of TaskSchedulerURL or StatusURL is
+// required.
+type GreenRevisionConfig struct {
+	// TaskSchedulerURL is the URL of the Task Scheduler which runs Jobs
+	// for the child repo, eg. "https://task-scheduler.skia.org". The
+	// required checks are the names of Jobs, and a check passed if the most
+	// recent Job with that name at the revision succeeded.
+	TaskSchedulerURL string `json:"taskSchedulerURL,omitempty"`
+	// ChildRepo is the URL of the child repo, as known to the Task
+	// Scheduler. Required with TaskSchedulerURL.
+	ChildRepo string `json:"childRepo,omitempty"`
+
+	// StatusURL is the URL of an endpoint which reports the results of
+	// checks for a revision, with "{revision}" in place of the revision
+	// ID. The endpoint returns a JSON object mapping check names to
+	// results, where "success" indicates that the check passed.
+	StatusURL string `json:"statusURL,omitempty"`
+
+	// RequiredChecks are the names of the checks which must pass. Required
+	// with TaskSchedulerURL. If not provided with StatusURL, all of the
+	// checks reported for a revision must pass and at least one must be
+	// reported.
+	RequiredChecks []string `json:"requiredChecks,omitempty"`
+}
+
+// See documentation for util.Validator interface.
+func (c *GreenRevisionConfig) Validate() error {
+	if (c.TaskSchedulerURL == "") == (c.StatusURL == "") {
+		return errors.New("Exactly one of TaskSchedulerURL or StatusURL is required.")
+	}
+	if c.TaskSchedulerURL != "" {
+		if c.ChildRepo == "" {
+			return errors.New("ChildRepo is required with TaskSchedulerURL.")
+		}
+		if len(c.RequiredChecks) == 0 {
+			return errors.New("RequiredChecks is required with TaskSchedulerURL.")
+		}
+	}
+	if c.StatusURL != "" && !strings.Contains(c.StatusURL, STATUS_URL_REVISION_PLACEHOLDER) {
+		return fmt.Errorf("StatusURL must contain %q.", STATUS_URL_REVISION_PLACEHOLDER)
+	}
+	return nil
+}
+
+// StatusChecker determines whether the required checks passed for Revisions.
+type StatusChecker interface {
+	// Return true iff all of the required checks passed for the given
+	// Revision.
+	IsGreen(context.Context, *revision.Revision) (bool, error)
+}
+
+// NewStatusChecker returns a StatusChecker based on the given config.
+func NewStatusChecker(c *GreenRevisionConfig, client *http.Client) (StatusChecker, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.TaskSchedulerURL != "" {
+		return &taskSchedulerStatusChecker{
+			client:   client,
+			jobs:     util.CopyStringSlice(c.RequiredChecks),
+			repo:     c.ChildRepo,
+			url:      strings.TrimRight(c.TaskSchedulerURL, "/"),
+			timeFunc: time.Now,
+		}, nil
+	}
+	return &urlStatusChecker{
+		checks: util.CopyStringSlice(c.RequiredChecks),
+		client: client,
+		url:    c.StatusURL,
+	}, nil
+}
+
+// taskSchedulerStatusChecker is a StatusChecker which uses the results of Jobs
+// in the Task Scheduler.
+type taskSchedulerStatusChecker struct {
+	client   *http.Client
+	jobs     []string
+	repo     string
+	url      string
+	timeFunc func() time.Time
+}
+
+// searchJobs retrieves the Jobs with the required names at the given
+// Revision.
+func (c *taskSchedulerStatusChecker) searchJobs(ctx context.Context, rev *revision.Revision) ([]*types.Job, error) {
+	// The Task Scheduler accepts a regular expression for the Job name.
+	names := make([]string, 0, len(c.jobs))
+	for _, name := range c.jobs {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	params := url.Values{}
+	params.Set("repo", c.repo)
+	params.Set("revision", rev.Id)
+	params.Set("name", "^("+strings.Join(names, "|")+")$")
+	// Jobs are created after their revisions land.
+	params.Set("time_start", rev.Timestamp.UTC().Format(time.RFC3339Nano))
+	params.Set("time_end", c.timeFunc().UTC().Format(time.RFC3339Nano))
+	req, err := http.NewRequest(http.MethodGet, c.url+"/json/jobs/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Task Scheduler returned %s: %s", resp.Status, httputils.ReadAndClose(resp.Body))
+	}
+	var jobs []*types.Job
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return nil, fmt.Errorf("Failed to decode jobs: %s", err)
+	}
+	return jobs, nil
+}
+
+// See documentation for StatusChecker interface.
+func (c *taskSchedulerStatusChecker) IsGreen(ctx context.Context, rev *revision.Revision) (bool, error) {
+	jobs, err := c.searchJobs(ctx, rev)
+	if err != nil {
+		return false, fmt.Errorf("Failed to search for jobs at %s: %s", rev.Id, err)
+	}
+	// Find the most recent Job with each required name.
+	required := util.NewStringSet(c.jobs)
+	latest := map[string]*types.Job{}
+	for _, j := range jobs {
+		if j.Revision != rev.Id || !required[j.Name] || j.IsTryJob() {
+			continue
+		}
+		if prev, ok := latest[j.Name]; !ok || j.Created.After(prev.Created) {
+			latest[j.Name] = j
+		}
+	}
+	for _, name := range c.jobs {
+		if j, ok := latest[name]; !ok || j.Status != types.JOB_STATUS_SUCCESS {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// urlStatusChecker is a StatusChecker which retrieves the results of checks
+// from a status endpoint.
+type urlStatusChecker struct {
+	checks []string
+	client *http.Client
+	url    string
+}
+
+// getChecks retrieves the results of the checks for the given Revision.
+func (c *urlStatusChecker) getChecks(ctx context.Context, rev *revision.Revision) (map[string]string, error) {
+	u := strings.Replace(c.url, STATUS_URL_REVISION_PLACEHOLDER, url.PathEscape(rev.Id), -1)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		// No checks have been reported for this revision.
+		return map[string]string{}, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Status endpoint returned %s: %s", resp.Status, httputils.ReadAndClose(resp.Body))
+	}
+	var rv map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&rv); err != nil {
+		return nil, fmt.Errorf("Failed to decode check results: %s", err)
+	}
+	return rv, nil
+}
+
+// See documentation for StatusChecker interface.
+func (c *urlStatusChecker) IsGreen(ctx context.Context, rev *revision.Revision) (bool, error) {
+	results, err := c.getChecks(ctx, rev)
+	if err != nil {
+		return false, fmt.Errorf("Failed to retrieve checks for %s: %s", rev.Id, err)
+	}
+	required := c.checks
+	if len(required) == 0 {
+		for name := range results {
+			required = append(required, name)
+		}
+	}
+	for _, name := range required {
+		if results[name] != CHECK_RESULT_SUCCESS {
+			return false, nil
+		}
+	}
+	return len(required) > 0, nil
+}
+
+// greenStrategy is a NextRollStrategy which rolls to the most recent revision
+// for which all of the required checks passed.
+type greenStrategy struct {
+	checker StatusChecker
+}
+
+// See documentation for NextRollStrategy interface.
+func (s *greenStrategy) GetNextRollRev(ctx context.Context, notRolled []*revision.Revision) (*revision.Revision, error) {
+	// Commits are listed in reverse chronological order, so the first
+	// green revision is the one we want. Failure to check one revision
+	// shouldn't prevent rolling to an older one, so treat it as not green.
+	for _, rev := range notRolled {
+		green, err := s.checker.IsGreen(ctx, rev)
+		if err != nil {
+			sklog.Warningf("Failed to check whether %s is green: %s", rev.Id, err)
+			continue
+		}
+		if green {
+			return rev, nil
+		}
+	}
+	return nil, nil
+}
+
+// StrategyGreen returns a NextRollStrategy which rolls to the most recent
+// revision for which all of the required checks passed, as determined by the
+// given StatusChecker.
+func StrategyGreen(checker StatusChecker) NextRollStrategy {
+	return &greenStrategy{
+		checker: checker,
+	}
+}
@@ -0,0 +1,215 @@
+package strategy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/autoroll/go/revision"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+func TestGreenRevisionConfigValidate(t *testing.T) {
+	unittest.SmallTest(t)
+	test := func(c *GreenRevisionConfig, expectErr string) {
+		err := c.Validate()
+		if expectErr == "" {
+			require.NoError(t, err)
+		} else {
+			require.EqualError(t, err, expectErr)
+		}
+	}
+	test(&GreenRevisionConfig{}, "Exactly one of TaskSchedulerURL or StatusURL is required.")
+	test(&GreenRevisionConfig{
+		TaskSchedulerURL: "https://task-scheduler.skia.org",
+		StatusURL:        "https://status/{revision}",
+	}, "Exactly one of TaskSchedulerURL or StatusURL is required.")
+	test(&GreenRevisionConfig{
+		TaskSchedulerURL: "https://task-scheduler.skia.org",
+		RequiredChecks:   []string{"Build"},
+	}, "ChildRepo is required with TaskSchedulerURL.")
+	test(&GreenRevisionConfig{
+		TaskSchedulerURL: "https://task-scheduler.skia.org",
+		ChildRepo:        "https://skia.googlesource.com/skia.git",
+	}, "RequiredChecks is required with TaskSchedulerURL.")
+	test(&GreenRevisionConfig{
+		TaskSchedulerURL: "https://task-scheduler.skia.org",
+		ChildRepo:        "https://skia.googlesource.com/skia.git",
+		RequiredChecks:   []string{"Build"},
+	}, "")
+	test(&GreenRevisionConfig{
+		StatusURL: "https://status/",
+	}, "StatusURL must contain \"{revision}\".")
+	test(&GreenRevisionConfig{
+		StatusURL: "https://status/{revision}",
+	}, "")
+}
+
+// revs returns Revisions with the given IDs, in reverse chronological order.
+func revs(ts time.Time, ids ...string) []*revision.Revision {
+	rv := make([]*revision.Revision, 0, len(ids))
+	for i, id := range ids {
+		rv = append(rv, &revision.Revision{
+			Id:        id,
+			Timestamp: ts.Add(-time.Duration(i) * time.Minute),
+		})
+	}
+	return rv
+}
+
+func TestGreenStrategyTaskScheduler(t *testing.T) {
+	unittest.SmallTest(t)
+	ctx := context.Background()
+	repo := "https://skia.googlesource.com/skia.git"
+	ts := time.Unix(1574000000, 0).UTC()
+	job := func(rev, name string, status types.JobStatus, created time.Time) *types.Job {
+		return &types.Job{
+			Created: created,
+			Name:    name,
+			RepoState: types.RepoState{
+				Repo:     repo,
+				Revision: rev,
+			},
+			Status: status,
+		}
+	}
+	tryjob := job("c", "Build", types.JOB_STATUS_SUCCESS, ts)
+	tryjob.Issue = "123"
+	tryjob.Patchset = "1"
+	tryjob.Server = "https://skia-review.googlesource.com"
+	jobs := []*types.Job{
+		// "d" has no results.
+		// "c" failed the test; the try job doesn't count.
+		job("c", "Build", types.JOB_STATUS_SUCCESS, ts),
+		job("c", "Test", types.JOB_STATUS_FAILURE, ts),
+		tryjob,
+		// "b" failed the test, but a retry succeeded.
+		job("b", "Build", types.JOB_STATUS_SUCCESS, ts),
+		job("b", "Test", types.JOB_STATUS_FAILURE, ts),
+		job("b", "Test", types.JOB_STATUS_SUCCESS, ts.Add(time.Minute)),
+		job("b", "Other", types.JOB_STATUS_FAILURE, ts),
+		// "a" passed.
+		job("a", "Build", types.JOB_STATUS_SUCCESS, ts),
+		job("a", "Test", types.JOB_STATUS_SUCCESS, ts),
+	}
+	// Like the Task Scheduler, filter the Jobs by revision and name.
+	queries := map[string]url.Values{}
+	fail := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/json/jobs/search", r.URL.Path)
+		query := r.URL.Query()
+		rev := query.Get("revision")
+		queries[rev] = query
+		if rev == fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		nameRe := regexp.MustCompile(query.Get("name"))
+		rv := []*types.Job{}
+		for _, j := range jobs {
+			if j.Revision == rev && nameRe.MatchString(j.Name) {
+				rv = append(rv, j)
+			}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(rv))
+	}))
+	defer srv.Close()
+
+	c, err := NewStatusChecker(&GreenRevisionConfig{
+		TaskSchedulerURL: srv.URL + "/",
+		ChildRepo:        repo,
+		RequiredChecks:   []string{"Build", "Test"},
+	}, http.DefaultClient)
+	require.NoError(t, err)
+	c.(*taskSchedulerStatusChecker).timeFunc = func() time.Time {
+		return ts.Add(time.Hour)
+	}
+	s, err := GetNextRollStrategy(ROLL_STRATEGY_GREEN, c)
+	require.NoError(t, err)
+
+	notRolled := revs(ts, "d", "c", "b", "a")
+	next, err := s.GetNextRollRev(ctx, notRolled)
+	require.NoError(t, err)
+	require.Equal(t, "b", next.Id)
+	// Older revisions aren't checked once a green one is found.
+	require.Len(t, queries, 3)
+	require.Equal(t, url.Values{
+		"repo":       {repo},
+		"revision":   {"b"},
+		"name":       {"^(Build|Test)$"},
+		"time_start": {"2019-11-17T14:11:20Z"},
+		"time_end":   {"2019-11-17T15:13:20Z"},
+	}, queries["b"])
+
+	// A revision which can't be checked isn't green, but it doesn't
+	// prevent us from rolling to an older revision.
+	fail = "b"
+	next, err = s.GetNextRollRev(ctx, notRolled)
+	require.NoError(t, err)
+	require.Equal(t, "a", next.Id)
+	fail = ""
+
+	// No green revisions.
+	next, err = s.GetNextRollRev(ctx, notRolled[:2])
+	require.NoError(t, err)
+	require.Nil(t, next)
+
+	// Up to date.
+	next, err = s.GetNextRollRev(ctx, nil)
+	require.NoError(t, err)
+	require.Nil(t, next)
+
+	// The strategy requires a StatusChecker.
+	_, err = GetNextRollStrategy(ROLL_STRATEGY_GREEN, nil)
+	require.EqualError(t, err, "Roll strategy \"green\" requires a green revision config")
+}
+
+func TestGreenStrategyStatusURL(t *testing.T) {
+	unittest.SmallTest(t)
+	ctx := context.Background()
+	results := map[string]map[string]string{
+		"d": {"build": "success", "test": "pending"},
+		"c": {"build": "success", "test": "failure"},
+		"b": {"build": "success", "test": "success", "other": "failure"},
+		"a": {"build": "success", "test": "success"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rev := strings.TrimPrefix(r.URL.Path, "/status/")
+		res, ok := results[rev]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(res))
+	}))
+	defer srv.Close()
+
+	check := func(required []string, notRolled []*revision.Revision, expect string) {
+		c, err := NewStatusChecker(&GreenRevisionConfig{
+			StatusURL:      srv.URL + "/status/{revision}",
+			RequiredChecks: required,
+		}, http.DefaultClient)
+		require.NoError(t, err)
+		next, err := StrategyGreen(c).GetNextRollRev(ctx, notRolled)
+		require.NoError(t, err)
+		if expect == "" {
+			require.Nil(t, next)
+		} else {
+			require.Equal(t, expect, next.Id)
+		}
+	}
+	ts := time.Unix(1574000000, 0).UTC()
+	check([]string{"build", "test"}, revs(ts, "e", "d", "c", "b", "a"), "b")
+	check([]string{"build"}, revs(ts, "e", "d", "c", "b", "a"), "d")
+	// If no checks are required, all reported checks must pass.
+	check(nil, revs(ts, "e", "d", "c", "b", "a"), "a")
+	check(nil, revs(ts, "e"), "")
+}
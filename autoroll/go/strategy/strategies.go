@@ -9,6 +9,9 @@ import (
 
 const (
 	ROLL_STRATEGY_BATCH = "batch"
+	// Roll to the most recent revision for which the required child-side
+	// checks passed. Requires a GreenRevisionConfig.
+	ROLL_STRATEGY_GREEN = "green"
 	// TODO(rmistry): Rename to "batch of " + N_COMMITS ?
 	ROLL_STRATEGY_N_BATCH = "n_batch"
 	ROLL_STRATEGY_SINGLE  = "single"
@@ -26,11 +29,17 @@ type NextRollStrategy interface {
 	GetNextRollRev(context.Context, []*revision.Revision) (*revision.Revision, error)
 }
 
-// Return the NextRollStrategy indicated by the given string.
-func GetNextRollStrategy(strategy string) (NextRollStrategy, error) {
+// Return the NextRollStrategy indicated by the given string. The StatusChecker
+// is required for ROLL_STRATEGY_GREEN and may be nil otherwise.
+func GetNextRollStrategy(strategy string, checker StatusChecker) (NextRollStrategy, error) {
 	switch strategy {
 	case ROLL_STRATEGY_BATCH:
 		return StrategyHead(), nil
+	case ROLL_STRATEGY_GREEN:
+		if checker == nil {
+			return nil, fmt.Errorf("Roll strategy %q requires a green revision config", strategy)
+		}
+		return StrategyGreen(checker), nil
 	case ROLL_STRATEGY_N_BATCH:
 		return StrategyNCommits(), nil
 	case ROLL_STRATEGY_SINGLE:
@@ -0,0 +1,158 @@
+package time_window
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// Format of dates in calendar files.
+	DATE_FORMAT = "2006-01-02"
+
+	// maxOpenIterations bounds the search for the next time at which rolls
+	// are allowed, in case of a pathological calendar.
+	maxOpenIterations = 1000
+)
+
+// Exclusion is a period of time during which rolls are not allowed, regardless
+// of the TimeWindow, eg. a holiday or a release freeze.
+type Exclusion struct {
+	// Start of the Exclusion, inclusive.
+	Start time.Time `json:"start"`
+	// End of the Exclusion, exclusive.
+	End time.Time `json:"end"`
+	// Reason is a human-readable reason for the Exclusion.
+	Reason string `json:"reason"`
+}
+
+// Contains returns true iff the given time.Time falls within the Exclusion.
+func (e *Exclusion) Contains(t time.Time) bool {
+	return !t.Before(e.Start) && t.Before(e.End)
+}
+
+// calendarEntryJSON is an entry in a calendar file.
+type calendarEntryJSON struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Reason string `json:"reason"`
+}
+
+// calendarJSON is the format of a calendar file.
+type calendarJSON struct {
+	Exclusions []*calendarEntryJSON `json:"exclusions"`
+}
+
+// parseCalendarTime parses the given timestamp, which is either a date in
+// DATE_FORMAT, interpreted in the given location, or an RFC3339 timestamp.
+// Dates are returned as the start of the given day, or the start of the
+// following day if end is true, so that dates are inclusive.
+func parseCalendarTime(s string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(DATE_FORMAT, s, loc); err == nil {
+		if end {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Expected date format %q or RFC3339, not %q", DATE_FORMAT, s)
+	}
+	return t, nil
+}
+
+// ParseCalendar parses Exclusions from the contents of a calendar file, which
+// is a JSON object like:
+//
+//   {
+//     "exclusions": [
+//       {"start": "2019-12-24", "end": "2020-01-01", "reason": "Holidays"},
+//       {"start": "2020-03-02T17:00:00-08:00", "end": "2020-03-04T09:00:00-08:00", "reason": "M82 branch"}
+//     ]
+//   }
+//
+// Dates are interpreted in the given location and are inclusive, so the first
+// entry above covers all of December 24 through January 1. Timestamps are
+// in RFC3339 format, with the end being exclusive.
+func ParseCalendar(b []byte, loc *time.Location) ([]*Exclusion, error) {
+	var c calendarJSON
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("Failed to parse calendar: %s", err)
+	}
+	rv := make([]*Exclusion, 0, len(c.Exclusions))
+	for _, e := range c.Exclusions {
+		start, err := parseCalendarTime(e.Start, loc, false)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseCalendarTime(e.End, loc, true)
+		if err != nil {
+			return nil, err
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("Calendar entry %q ends before it starts", e.Reason)
+		}
+		if e.Reason == "" {
+			return nil, fmt.Errorf("Calendar entry starting at %q has no reason", e.Start)
+		}
+		rv = append(rv, &Exclusion{
+			Start:  start,
+			End:    end,
+			Reason: e.Reason,
+		})
+	}
+	return rv, nil
+}
+
+// Status describes whether rolls are allowed at a given time.
+type Status struct {
+	// Open is true iff rolls are allowed.
+	Open bool
+	// Reason is a human-readable reason why rolls are not allowed.
+	Reason string
+	// NextOpen is the earliest time at which rolls are allowed.
+	NextOpen time.Time
+}
+
+// GetStatus returns a Status indicating whether rolls are allowed at the given
+// time.Time, given the TimeWindow and Exclusions, either of which may be nil.
+func (w *TimeWindow) GetStatus(t time.Time, exclusions []*Exclusion) *Status {
+	return GetCombinedStatus(t, []*TimeWindow{w}, exclusions)
+}
+
+// GetCombinedStatus returns a Status indicating whether rolls are allowed at the
+// given time.Time, given the Exclusions, when rolls are only allowed while all
+// of the given TimeWindows are open. Nil TimeWindows are always open.
+func GetCombinedStatus(t time.Time, windows []*TimeWindow, exclusions []*Exclusion) *Status {
+	rv := &Status{
+		Open:     true,
+		NextOpen: t,
+	}
+	for i := 0; i < maxOpenIterations; i++ {
+		changed := false
+		for _, e := range exclusions {
+			if e.Contains(rv.NextOpen) {
+				if rv.Open {
+					rv.Open = false
+					rv.Reason = fmt.Sprintf("%s until %s", e.Reason, e.End.Format(time.RFC1123))
+				}
+				rv.NextOpen = e.End
+				changed = true
+			}
+		}
+		for _, w := range windows {
+			if !w.Test(rv.NextOpen) {
+				if rv.Open {
+					rv.Open = false
+					rv.Reason = fmt.Sprintf("Outside of roll window %s", w)
+				}
+				rv.NextOpen = w.NextOpen(rv.NextOpen)
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return rv
+}
@@ -0,0 +1,123 @@
+package time_window
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestParseCalendar(t *testing.T) {
+	unittest.SmallTest(t)
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	exclusions, err := ParseCalendar([]byte(`{
+  "exclusions": [
+    {"start": "2019-12-24", "end": "2020-01-01", "reason": "Holidays"},
+    {"start": "2020-03-02T17:00:00-05:00", "end": "2020-03-04T09:00:00-05:00", "reason": "M82 branch"}
+  ]
+}`), loc)
+	require.NoError(t, err)
+	require.Len(t, exclusions, 2)
+	require.True(t, time.Date(2019, 12, 24, 0, 0, 0, 0, loc).Equal(exclusions[0].Start))
+	require.True(t, time.Date(2020, 1, 2, 0, 0, 0, 0, loc).Equal(exclusions[0].End))
+	require.Equal(t, "Holidays", exclusions[0].Reason)
+	require.True(t, exclusions[0].Contains(time.Date(2020, 1, 1, 23, 59, 0, 0, loc)))
+	require.False(t, exclusions[0].Contains(time.Date(2020, 1, 2, 0, 0, 0, 0, loc)))
+	require.True(t, time.Date(2020, 3, 2, 22, 0, 0, 0, time.UTC).Equal(exclusions[1].Start))
+	require.True(t, time.Date(2020, 3, 4, 14, 0, 0, 0, time.UTC).Equal(exclusions[1].End))
+
+	fail := func(contents, expect string) {
+		_, err := ParseCalendar([]byte(contents), loc)
+		require.EqualError(t, err, expect)
+	}
+	fail(`{"exclusions": [{"start": "12/24/2019", "end": "2020-01-01", "reason": "Holidays"}]}`, "Expected date format \"2006-01-02\" or RFC3339, not \"12/24/2019\"")
+	fail(`{"exclusions": [{"start": "2019-12-24", "end": "2019-12-01", "reason": "Holidays"}]}`, "Calendar entry \"Holidays\" ends before it starts")
+	fail(`{"exclusions": [{"start": "2019-12-24", "end": "2020-01-01"}]}`, "Calendar entry starting at \"2019-12-24\" has no reason")
+}
+
+func TestGetStatus(t *testing.T) {
+	unittest.SmallTest(t)
+
+	w, err := Parse("M-F 09:00-17:00")
+	require.NoError(t, err)
+	exclusions := []*Exclusion{
+		{
+			// Wednesday through the following Monday morning.
+			Start:  time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC),
+			End:    time.Date(2020, 3, 9, 10, 0, 0, 0, time.UTC),
+			Reason: "Release freeze",
+		},
+	}
+
+	// Open.
+	ts := time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC)
+	s := w.GetStatus(ts, exclusions)
+	require.True(t, s.Open)
+	require.Equal(t, "", s.Reason)
+	require.True(t, ts.Equal(s.NextOpen))
+
+	// Outside of the window; the window next opens during the exclusion,
+	// so the next opening is at the end of the exclusion.
+	ts = time.Date(2020, 3, 3, 18, 0, 0, 0, time.UTC)
+	s = w.GetStatus(ts, exclusions)
+	require.False(t, s.Open)
+	require.Equal(t, "Outside of roll window M-F 09:00-17:00 (UTC)", s.Reason)
+	require.True(t, time.Date(2020, 3, 9, 10, 0, 0, 0, time.UTC).Equal(s.NextOpen))
+
+	// Excluded.
+	ts = time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	s = w.GetStatus(ts, exclusions)
+	require.False(t, s.Open)
+	require.Equal(t, "Release freeze until Mon, 09 Mar 2020 10:00:00 UTC", s.Reason)
+	require.True(t, time.Date(2020, 3, 9, 10, 0, 0, 0, time.UTC).Equal(s.NextOpen))
+
+	// The exclusion ends outside of the window.
+	exclusions[0].End = time.Date(2020, 3, 7, 0, 0, 0, 0, time.UTC)
+	s = w.GetStatus(ts, exclusions)
+	require.False(t, s.Open)
+	require.True(t, time.Date(2020, 3, 9, 9, 0, 0, 0, time.UTC).Equal(s.NextOpen))
+
+	// With no TimeWindow, only the exclusions apply.
+	s = (*TimeWindow)(nil).GetStatus(ts, exclusions)
+	require.False(t, s.Open)
+	require.True(t, exclusions[0].End.Equal(s.NextOpen))
+	s = (*TimeWindow)(nil).GetStatus(ts, nil)
+	require.True(t, s.Open)
+}
+
+func TestGetCombinedStatus(t *testing.T) {
+	unittest.SmallTest(t)
+
+	w1, err := Parse("M-F 09:00-17:00")
+	require.NoError(t, err)
+	w2, err := Parse("M-W 13:00-20:00")
+	require.NoError(t, err)
+	windows := []*TimeWindow{w1, nil, w2}
+
+	// Both windows are open.
+	ts := time.Date(2020, 3, 3, 14, 0, 0, 0, time.UTC)
+	s := GetCombinedStatus(ts, windows, nil)
+	require.True(t, s.Open)
+	require.True(t, ts.Equal(s.NextOpen))
+
+	// Only the first window is open.
+	ts = time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC)
+	s = GetCombinedStatus(ts, windows, nil)
+	require.False(t, s.Open)
+	require.Equal(t, "Outside of roll window M-W 13:00-20:00 (UTC)", s.Reason)
+	require.True(t, time.Date(2020, 3, 3, 13, 0, 0, 0, time.UTC).Equal(s.NextOpen))
+
+	// Only the second window is open; the windows next overlap on Monday.
+	ts = time.Date(2020, 3, 4, 18, 0, 0, 0, time.UTC)
+	s = GetCombinedStatus(ts, windows, nil)
+	require.False(t, s.Open)
+	require.Equal(t, "Outside of roll window M-F 09:00-17:00 (UTC)", s.Reason)
+	require.True(t, time.Date(2020, 3, 9, 13, 0, 0, 0, time.UTC).Equal(s.NextOpen))
+
+	// No windows.
+	s = GetCombinedStatus(ts, nil, nil)
+	require.True(t, s.Open)
+}
@@ -22,7 +22,14 @@ var (
 )
 
 // Parse returns a TimeWindow instance based on the given string. Times are
-// interpreted as GMT. The accepted format is as follows:
+// interpreted as GMT. See ParseInLocation for the accepted format.
+func Parse(s string) (*TimeWindow, error) {
+	return ParseInLocation(s, time.UTC)
+}
+
+// ParseInLocation returns a TimeWindow instance based on the given string.
+// Times are interpreted in the given location, which accounts for daylight
+// saving time. The accepted format is as follows:
 //
 //      FullWindowExpr      = SingleDayWindowExpr(;SingleDayWindowExpr)*
 //      SingleDayWindowExpr = DayRangesExpr TimeExpr-TimeExpr
@@ -38,7 +45,7 @@ var (
 //   Multiple days, different times:    Sa 08:00-09:00; M-W 12:00-03:00
 //   Wrap around to next day:           M-F 22:00-02:00
 //
-func Parse(s string) (*TimeWindow, error) {
+func ParseInLocation(s string, loc *time.Location) (*TimeWindow, error) {
 	if s == "" {
 		// A nil TimeWindow always returns true from Test().
 		return nil, nil
@@ -54,6 +61,8 @@ func Parse(s string) (*TimeWindow, error) {
 	}
 	return &TimeWindow{
 		dayWindows: dayWindows,
+		expr:       strings.TrimSpace(s),
+		loc:        loc,
 	}, nil
 }
 
@@ -101,22 +110,38 @@ type dayWindow struct {
 	end   dayTime
 }
 
-// test returns true iff the given time.Time occurs within the dayWindow.
+// test returns true iff the given time.Time, which must be in the location of
+// the TimeWindow, occurs within the dayWindow.
 func (w dayWindow) test(t time.Time) bool {
-	// Find the nearest start and end to this t.
-	start := time.Date(t.Year(), t.Month(), t.Day(), w.start.hours, w.start.minutes, 0, 0, time.UTC)
+	// Find the nearest start and end to this t. Days are added using
+	// time.Date rather than 24-hour durations, to account for daylight
+	// saving time.
+	day := t.Day()
+	start := time.Date(t.Year(), t.Month(), day, w.start.hours, w.start.minutes, 0, 0, t.Location())
 	for start.Weekday() != w.day {
-		start = start.Add(-24 * time.Hour)
+		day--
+		start = time.Date(t.Year(), t.Month(), day, w.start.hours, w.start.minutes, 0, 0, t.Location())
 	}
-	end := time.Date(start.Year(), start.Month(), start.Day(), w.end.hours, w.end.minutes, 0, 0, time.UTC)
+	end := time.Date(t.Year(), t.Month(), day, w.end.hours, w.end.minutes, 0, 0, t.Location())
 	if !start.After(t) && end.After(t) {
 		return true
 	}
-	start = start.Add(7 * 24 * time.Hour)
-	end = end.Add(7 * 24 * time.Hour)
+	start = time.Date(t.Year(), t.Month(), day+7, w.start.hours, w.start.minutes, 0, 0, t.Location())
+	end = time.Date(t.Year(), t.Month(), day+7, w.end.hours, w.end.minutes, 0, 0, t.Location())
 	return !start.After(t) && end.After(t)
 }
 
+// nextStart returns the first start of the dayWindow which is not before the
+// given time.Time, which must be in the location of the TimeWindow.
+func (w dayWindow) nextStart(t time.Time) time.Time {
+	for i := 0; ; i++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, w.start.hours, w.start.minutes, 0, 0, t.Location())
+		if start.Weekday() == w.day && !start.Before(t) {
+			return start
+		}
+	}
+}
+
 // parse days and dayWindows from a string formatted like: "M-W,Th,Sa 02:34-03:45"
 func parseDayWindows(s string) ([]*dayWindow, error) {
 	split := strings.SplitN(strings.TrimSpace(s), " ", 2)
@@ -208,6 +233,8 @@ func parseDayWindows(s string) ([]*dayWindow, error) {
 // a roller is allowed to upload rolls.
 type TimeWindow struct {
 	dayWindows []*dayWindow
+	expr       string
+	loc        *time.Location
 }
 
 // Test returns true iff the given time.Time occurs within the TimeWindow.
@@ -215,7 +242,7 @@ func (w *TimeWindow) Test(t time.Time) bool {
 	if w == nil {
 		return true
 	}
-	t = t.UTC()
+	t = t.In(w.loc)
 	for _, dw := range w.dayWindows {
 		if dw.test(t) {
 			return true
@@ -223,3 +250,29 @@ func (w *TimeWindow) Test(t time.Time) bool {
 	}
 	return false
 }
+
+// NextOpen returns the earliest time.Time, not before the given time.Time, at
+// which the TimeWindow is open.
+func (w *TimeWindow) NextOpen(t time.Time) time.Time {
+	if w.Test(t) {
+		return t
+	}
+	t = t.In(w.loc)
+	var rv time.Time
+	for _, dw := range w.dayWindows {
+		start := dw.nextStart(t)
+		if rv.IsZero() || start.Before(rv) {
+			rv = start
+		}
+	}
+	return rv
+}
+
+// String returns the expression from which the TimeWindow was parsed, along
+// with its location.
+func (w *TimeWindow) String() string {
+	if w == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", w.expr, w.loc)
+}
@@ -84,3 +84,33 @@ func TestTimeWindow(t *testing.T) {
 	// A nil TimeWindow always returns true from Test.
 	require.Equal(t, true, (*TimeWindow)(nil).Test(time.Now()))
 }
+
+func TestTimeWindowInLocation(t *testing.T) {
+	unittest.SmallTest(t)
+
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	w, err := ParseInLocation("M-F 09:00-17:00", loc)
+	require.NoError(t, err)
+	require.Equal(t, "M-F 09:00-17:00 (America/New_York)", w.String())
+
+	// Monday, March 9 2020 is the first weekday of daylight saving time;
+	// the previous Friday is in standard time.
+	require.False(t, w.Test(time.Date(2020, 3, 6, 13, 59, 0, 0, time.UTC)))
+	require.True(t, w.Test(time.Date(2020, 3, 6, 14, 0, 0, 0, time.UTC)))
+	require.True(t, w.Test(time.Date(2020, 3, 6, 21, 59, 0, 0, time.UTC)))
+	require.False(t, w.Test(time.Date(2020, 3, 6, 22, 0, 0, 0, time.UTC)))
+	require.False(t, w.Test(time.Date(2020, 3, 9, 12, 59, 0, 0, time.UTC)))
+	require.True(t, w.Test(time.Date(2020, 3, 9, 13, 0, 0, 0, time.UTC)))
+	require.False(t, w.Test(time.Date(2020, 3, 9, 21, 0, 0, 0, time.UTC)))
+
+	// The next opening after Friday evening is Monday morning, in daylight
+	// saving time.
+	ts := time.Date(2020, 3, 6, 22, 0, 0, 0, time.UTC)
+	require.True(t, time.Date(2020, 3, 9, 13, 0, 0, 0, time.UTC).Equal(w.NextOpen(ts)))
+	// If the window is open, NextOpen returns the given time.
+	ts = time.Date(2020, 3, 9, 15, 0, 0, 0, time.UTC)
+	require.True(t, ts.Equal(w.NextOpen(ts)))
+	// A nil TimeWindow is always open.
+	require.True(t, ts.Equal((*TimeWindow)(nil).NextOpen(ts)))
+}
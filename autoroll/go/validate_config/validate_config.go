@@ -23,18 +23,18 @@ var (
 	config = flag.String("config", "", "Config file or dir of config files to validate.")
 )
 
-func validateConfig(f string) error {
+func validateConfig(f string) (*roller.AutoRollerConfig, error) {
 	var cfg roller.AutoRollerConfig
 	if err := util.WithReadFile(f, func(r io.Reader) error {
 		// TODO(borenet): This will just ignore any extraneous keys!
 		return json5.NewDecoder(r).Decode(&cfg)
 	}); err != nil {
-		return fmt.Errorf("Failed to read %s: %s", f, err)
+		return nil, fmt.Errorf("Failed to read %s: %s", f, err)
 	}
 	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("%s failed validation: %s", f, err)
+		return nil, fmt.Errorf("%s failed validation: %s", f, err)
 	}
-	return nil
+	return &cfg, nil
 }
 
 func main() {
@@ -66,10 +66,18 @@ func main() {
 	}
 
 	// Validate the file(s).
+	cfgs := make([]*roller.AutoRollerConfig, 0, len(configFiles))
 	for _, f := range configFiles {
-		if err := validateConfig(f); err != nil {
+		cfg, err := validateConfig(f)
+		if err != nil {
 			sklog.Fatal(err)
 		}
+		cfgs = append(cfgs, cfg)
+	}
+
+	// Verify that the rollers agree on the configuration of their groups.
+	if err := roller.ValidateGroups(cfgs); err != nil {
+		sklog.Fatal(err)
 	}
 	sklog.Infof("Validated %d files.", len(configFiles))
 }
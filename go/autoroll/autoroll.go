@@ -84,6 +84,7 @@ type AutoRollIssue struct {
 	CqFinished     bool               `json:"cqFinished"`
 	CqSuccess      bool               `json:"cqSuccess"`
 	Issue          int64              `json:"issue"`
+	LandedRevision string             `json:"landedRevision,omitempty"`
 	Modified       time.Time          `json:"modified"`
 	Patchsets      []int64            `json:"patchSets"`
 	Result         string             `json:"result"`
@@ -148,6 +149,7 @@ func (i *AutoRollIssue) Copy() *AutoRollIssue {
 		DryRunSuccess:  i.DryRunSuccess,
 		IsDryRun:       i.IsDryRun,
 		Issue:          i.Issue,
+		LandedRevision: i.LandedRevision,
 		Modified:       i.Modified,
 		Patchsets:      patchsetsCpy,
 		Result:         i.Result,
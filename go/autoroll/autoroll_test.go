@@ -33,6 +33,7 @@ func TestAutoRollIssueCopy(t *testing.T) {
 		DryRunSuccess:  true,
 		IsDryRun:       true,
 		Issue:          123,
+		LandedRevision: "789abc",
 		Modified:       time.Now(),
 		Patchsets:      []int64{1},
 		Result:         ROLL_RESULT_SUCCESS,
@@ -183,7 +183,7 @@ func (c *Client) Ensure(ctx context.Context, packages ...*Package) error {
 			return fmt.Errorf("Failed to resolve package version %q @ %q: %s", pkg.Name, pkg.Version, err)
 		}
 		sklog.Infof("Installing version %s (from %s) of %s", pin.InstanceID, pkg.Version, pkg.Name)
-		pkgs[pkg.Path] = common.PinSlice{pin}
+		pkgs[pkg.Path] = append(pkgs[pkg.Path], pin)
 	}
 	// This means use as many threads as CPUs. (Prior to
 	// https://chromium-review.googlesource.com/c/infra/luci/luci-go/+/1848212,
@@ -0,0 +1,71 @@
+package cipd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.chromium.org/luci/cipd/client/cipd"
+	"go.chromium.org/luci/cipd/client/cipd/deployer"
+	"go.chromium.org/luci/cipd/common"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+// fakeLuciClient is a cipd.Client which resolves versions to instance IDs by
+// appending them to the package name and records the packages it is asked to
+// ensure.
+type fakeLuciClient struct {
+	cipd.Client
+	ensured common.PinSliceBySubdir
+}
+
+// See documentation for cipd.Client interface.
+func (c *fakeLuciClient) ResolveVersion(_ context.Context, packageName, version string) (common.Pin, error) {
+	if version == "bogus" {
+		return common.Pin{}, errors.New("no such version")
+	}
+	return common.Pin{
+		PackageName: packageName,
+		InstanceID:  packageName + "-" + version,
+	}, nil
+}
+
+// See documentation for cipd.Client interface.
+func (c *fakeLuciClient) EnsurePackages(_ context.Context, pkgs common.PinSliceBySubdir, _ deployer.ParanoidMode, _ int, _ bool) (cipd.ActionMap, error) {
+	c.ensured = pkgs
+	return nil, nil
+}
+
+func TestEnsure(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	fake := &fakeLuciClient{}
+	c := &Client{fake}
+
+	// Packages which share a path are all installed.
+	require.NoError(t, c.Ensure(ctx,
+		&Package{Name: "git", Path: "bin", Version: "1"},
+		&Package{Name: "python", Path: "bin", Version: "2"},
+		&Package{Name: "go", Path: "go", Version: "3"},
+	))
+	require.Equal(t, common.PinSliceBySubdir{
+		"bin": {
+			{PackageName: "git", InstanceID: "git-1"},
+			{PackageName: "python", InstanceID: "python-2"},
+		},
+		"go": {
+			{PackageName: "go", InstanceID: "go-3"},
+		},
+	}, fake.ensured)
+
+	// Nothing is installed if any version fails to resolve.
+	fake.ensured = nil
+	err := c.Ensure(ctx,
+		&Package{Name: "git", Path: "bin", Version: "1"},
+		&Package{Name: "python", Path: "bin", Version: "bogus"},
+	)
+	require.EqualError(t, err, "Failed to resolve package version \"python\" @ \"bogus\": no such version")
+	require.Nil(t, fake.ensured)
+}
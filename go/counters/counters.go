@@ -48,6 +48,14 @@ func read(ctx context.Context, gcsClient gcs.GCSClient, path string) ([]time.Tim
 	return times, nil
 }
 
+// ReadDecrementTimes returns the decrement times of the
+// PersistentAutoDecrementCounter which uses the given file, without modifying
+// the file. The times may include some which have already passed, if no
+// PersistentAutoDecrementCounter instance was running to decrement them.
+func ReadDecrementTimes(ctx context.Context, gcsClient gcs.GCSClient, path string) ([]time.Time, error) {
+	return read(ctx, gcsClient, path)
+}
+
 // NewPersistentAutoDecrementCounter returns a PersistentAutoDecrementCounter
 // instance using the given file.
 func NewPersistentAutoDecrementCounter(ctx context.Context, gcsClient gcs.GCSClient, path string, d time.Duration) (*PersistentAutoDecrementCounter, error) {
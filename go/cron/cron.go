@@ -0,0 +1,289 @@
+// Package cron parses and evaluates cron expressions.
+//
+// Expressions consist of five whitespace-separated fields:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field is "*", a value, a range "a-b", or a comma-separated list of
+// these, and values and ranges may be followed by a step, eg. "*/15" or
+// "1-11/2". Months and days of the week may be given by their three-letter
+// English names, eg. "JAN" or "mon", and Sunday may be either 0 or 7. As in
+// standard cron, if both day-of-month and day-of-week are restricted, a day
+// matches if either of them matches.
+//
+// The following descriptors may be used in place of the five fields:
+// @yearly (or @annually), @monthly, @weekly, @daily (or @midnight) and
+// @hourly.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Next gives up if no matching time is found within this many years,
+	// eg. for "0 0 30 2 *".
+	MAX_YEARS = 5
+)
+
+var (
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+
+	dayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// field describes the allowed values of one field of a cron expression.
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	fieldMinute = field{"minute", 0, 59, nil}
+	fieldHour   = field{"hour", 0, 23, nil}
+	fieldDom    = field{"day-of-month", 1, 31, nil}
+	fieldMonth  = field{"month", 1, 12, monthNames}
+	// Day-of-week allows 7 as an alias for Sunday.
+	fieldDow = field{"day-of-week", 0, 7, dayNames}
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	expr string
+
+	// Bit sets of the matching values for each field.
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// Whether day-of-month and day-of-week are unrestricted, ie. "*".
+	domStar bool
+	dowStar bool
+}
+
+// Parse parses the given cron expression.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@") {
+		d, ok := descriptors[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("Unknown descriptor %q", spec)
+		}
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Expected 5 fields in cron expression %q but got %d", expr, len(fields))
+	}
+	s := &Schedule{
+		expr:    expr,
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	if s.minute, err = parseField(fields[0], fieldMinute); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], fieldHour); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], fieldDom); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], fieldMonth); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], fieldDow); err != nil {
+		return nil, err
+	}
+	// Sunday may be given as 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+		s.dow &^= 1 << 7
+	}
+	return s, nil
+}
+
+// parseField parses one field of a cron expression and returns the bit set of
+// matching values.
+func parseField(spec string, f field) (uint64, error) {
+	var rv uint64
+	for _, item := range strings.Split(spec, ",") {
+		bits, err := parseItem(item, f)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid %s %q: %s", f.name, spec, err)
+		}
+		rv |= bits
+	}
+	return rv, nil
+}
+
+// parseItem parses one comma-separated item of a field.
+func parseItem(item string, f field) (uint64, error) {
+	rangeSpec := item
+	step := 1
+	if idx := strings.Index(item, "/"); idx >= 0 {
+		rangeSpec = item[:idx]
+		var err error
+		step, err = strconv.Atoi(item[idx+1:])
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", item[idx+1:])
+		}
+	}
+	var start, end int
+	if rangeSpec == "*" {
+		start, end = f.min, f.max
+	} else if idx := strings.Index(rangeSpec, "-"); idx >= 0 {
+		var err error
+		if start, err = parseValue(rangeSpec[:idx], f); err != nil {
+			return 0, err
+		}
+		if end, err = parseValue(rangeSpec[idx+1:], f); err != nil {
+			return 0, err
+		}
+		if end < start {
+			return 0, fmt.Errorf("range %q ends before it starts", rangeSpec)
+		}
+	} else {
+		var err error
+		if start, err = parseValue(rangeSpec, f); err != nil {
+			return 0, err
+		}
+		end = start
+		// "a/n" means "a-max/n".
+		if strings.Contains(item, "/") {
+			end = f.max
+		}
+	}
+	var rv uint64
+	for i := start; i <= end; i += step {
+		rv |= 1 << uint(i)
+	}
+	return rv, nil
+}
+
+// parseValue parses a single value, which may be a name.
+func parseValue(v string, f field) (int, error) {
+	if n, ok := f.names[strings.ToLower(v)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", v)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// String returns the cron expression from which the Schedule was parsed.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// matchDay returns true iff the given time falls on a matching day.
+func (s *Schedule) matchDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the earliest time strictly after the given time which matches
+// the Schedule, evaluated in the given time's location. Returns the zero time
+// if there is no such time within MAX_YEARS.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// Start at the next whole minute. Note that we don't use time.Date or
+	// Truncate, since the former may choose a different instant during a
+	// repeated hour and the latter is not aligned to the wall clock in
+	// zones whose offset isn't a whole number of hours.
+	t = t.Add(-time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond())).Add(time.Minute)
+	limit := t.Year() + MAX_YEARS
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.matchDay(t) {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = nextHour(t)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// nextHour returns the start of the wall-clock hour following the given time,
+// which must be a whole minute. Around DST transitions, this is the first
+// instant after the given time whose wall-clock hour differs.
+func nextHour(t time.Time) time.Time {
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// advance returns next if it is after t. Around DST transitions, time.Date may
+// normalize a nonexistent time so that it is not after t; in that case,
+// advance steps forward to the next wall-clock hour instead.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return nextHour(t)
+}
+
+// Prev returns the latest time at or before the given time which matches the
+// Schedule, evaluated in the given time's location. Returns the zero time if
+// there is no such time within MAX_YEARS.
+func (s *Schedule) Prev(t time.Time) time.Time {
+	// Search successively longer windows preceding t, so that frequent
+	// schedules don't require iterating over a long window and
+	// infrequent schedules are still found.
+	for _, window := range []time.Duration{
+		time.Hour,
+		24 * time.Hour,
+		32 * 24 * time.Hour,
+		(MAX_YEARS*366 + 1) * 24 * time.Hour,
+	} {
+		prev := time.Time{}
+		for next := s.Next(t.Add(-window)); !next.IsZero() && !next.After(t); next = s.Next(next) {
+			prev = next
+		}
+		if !prev.IsZero() {
+			return prev
+		}
+	}
+	return time.Time{}
+}
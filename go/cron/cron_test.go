@@ -0,0 +1,126 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestParse(t *testing.T) {
+	unittest.SmallTest(t)
+
+	test := func(expr string, expectErr string) {
+		_, err := Parse(expr)
+		if expectErr == "" {
+			require.NoError(t, err, expr)
+		} else {
+			require.EqualError(t, err, expectErr, expr)
+		}
+	}
+	test("* * * * *", "")
+	test("0 3 * * 1-5", "")
+	test("*/15 0-6,18-23 1,15 JAN-jun Mon,wed,FRI", "")
+	test("0 0 * * 7", "")
+	test("5/10 * * * *", "")
+	test("@daily", "")
+	test("@Weekly", "")
+	test("", "Expected 5 fields in cron expression \"\" but got 0")
+	test("* * * *", "Expected 5 fields in cron expression \"* * * *\" but got 4")
+	test("@fortnightly", "Unknown descriptor \"@fortnightly\"")
+	test("60 * * * *", "Invalid minute \"60\": value 60 out of range [0, 59]")
+	test("* 24 * * *", "Invalid hour \"24\": value 24 out of range [0, 23]")
+	test("* * 0 * *", "Invalid day-of-month \"0\": value 0 out of range [1, 31]")
+	test("* * * FOO *", "Invalid month \"FOO\": invalid value \"FOO\"")
+	test("* * * * 8", "Invalid day-of-week \"8\": value 8 out of range [0, 7]")
+	test("*/0 * * * *", "Invalid minute \"*/0\": invalid step \"0\"")
+	test("5-1 * * * *", "Invalid minute \"5-1\": range \"5-1\" ends before it starts")
+}
+
+func TestNext(t *testing.T) {
+	unittest.SmallTest(t)
+
+	// Thursday, 2019-10-24 10:30:15 UTC.
+	now := time.Date(2019, time.October, 24, 10, 30, 15, 0, time.UTC)
+	test := func(expr string, from, expect time.Time) {
+		s, err := Parse(expr)
+		require.NoError(t, err)
+		require.Equal(t, expect, s.Next(from), expr)
+	}
+	date := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	test("* * * * *", now, date(2019, time.October, 24, 10, 31))
+	test("*/15 * * * *", now, date(2019, time.October, 24, 10, 45))
+	test("5/10 * * * *", now, date(2019, time.October, 24, 10, 35))
+	test("0 3 * * *", now, date(2019, time.October, 25, 3, 0))
+	test("@hourly", now, date(2019, time.October, 24, 11, 0))
+	// Next is strictly after the given time.
+	test("30 10 * * *", date(2019, time.October, 24, 10, 30), date(2019, time.October, 25, 10, 30))
+	// Weekdays only; the 26th and 27th are a weekend.
+	test("0 3 * * 1-5", date(2019, time.October, 25, 12, 0), date(2019, time.October, 28, 3, 0))
+	// Sunday may be 0 or 7.
+	test("0 0 * * 7", now, date(2019, time.October, 27, 0, 0))
+	test("0 0 * * SUN", now, date(2019, time.October, 27, 0, 0))
+	// Day-of-month or day-of-week.
+	test("0 0 1 * MON", now, date(2019, time.October, 28, 0, 0))
+	test("0 0 1 * MON", date(2019, time.October, 29, 0, 0), date(2019, time.November, 1, 0, 0))
+	test("@monthly", now, date(2019, time.November, 1, 0, 0))
+	test("@yearly", now, date(2020, time.January, 1, 0, 0))
+	// Leap day.
+	test("0 0 29 2 *", now, date(2020, time.February, 29, 0, 0))
+	// Impossible.
+	test("0 0 30 2 *", now, time.Time{})
+
+	// Timezones.
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	test("0 3 * * *", now.In(ny), time.Date(2019, time.October, 25, 3, 0, 0, 0, ny))
+	// 2:30 doesn't exist on the day DST starts in New York.
+	s, err := Parse("30 2 * * *")
+	require.NoError(t, err)
+	next := s.Next(time.Date(2020, time.March, 7, 12, 0, 0, 0, ny))
+	require.Equal(t, time.Date(2020, time.March, 9, 2, 30, 0, 0, ny), next)
+	// 1:30 happens twice on the day DST ends; fire on the first.
+	s, err = Parse("30 1 * * *")
+	require.NoError(t, err)
+	next = s.Next(time.Date(2019, time.November, 2, 12, 0, 0, 0, ny))
+	require.Equal(t, time.Date(2019, time.November, 3, 5, 30, 0, 0, time.UTC), next.UTC())
+	// Starting from the second 1:20, the next 1:15 is the following day.
+	s, err = Parse("15 1 * * *")
+	require.NoError(t, err)
+	next = s.Next(time.Date(2019, time.November, 3, 6, 20, 0, 0, time.UTC).In(ny))
+	require.Equal(t, time.Date(2019, time.November, 4, 6, 15, 0, 0, time.UTC), next.UTC())
+
+	// Zones whose offset isn't a whole number of hours.
+	stJohns, err := time.LoadLocation("America/St_Johns")
+	require.NoError(t, err)
+	s, err = Parse("0 3 * * *")
+	require.NoError(t, err)
+	next = s.Next(time.Date(2019, time.March, 9, 12, 0, 0, 0, stJohns))
+	require.Equal(t, time.Date(2019, time.March, 10, 3, 0, 0, 0, stJohns), next)
+	adelaide, err := time.LoadLocation("Australia/Adelaide")
+	require.NoError(t, err)
+	s, err = Parse("30 2 * * *")
+	require.NoError(t, err)
+	next = s.Next(time.Date(2020, time.April, 4, 12, 0, 0, 0, adelaide))
+	require.Equal(t, time.Date(2020, time.April, 4, 16, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestPrev(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Date(2019, time.October, 24, 10, 30, 15, 0, time.UTC)
+	test := func(expr string, expect time.Time) {
+		s, err := Parse(expr)
+		require.NoError(t, err)
+		require.Equal(t, expect, s.Prev(now), expr)
+	}
+	test("* * * * *", time.Date(2019, time.October, 24, 10, 30, 0, 0, time.UTC))
+	test("0 3 * * *", time.Date(2019, time.October, 24, 3, 0, 0, 0, time.UTC))
+	test("0 0 * * SAT", time.Date(2019, time.October, 19, 0, 0, 0, 0, time.UTC))
+	test("@yearly", time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC))
+	test("0 0 29 2 *", time.Date(2016, time.February, 29, 0, 0, 0, 0, time.UTC))
+	test("0 0 30 2 *", time.Time{})
+}
@@ -65,16 +65,20 @@ const (
 	CLUSTER_TELEMETRY_IDS           Kind = "ClusterTelemetryIDs"
 
 	// Autoroll
-	KIND_AUTOROLL_MODE                Kind = "AutorollMode"
-	KIND_AUTOROLL_MODE_ANCESTOR       Kind = "AutorollModeAncestor" // Fake; used to force strong consistency for testing's sake.
-	KIND_AUTOROLL_ROLL                Kind = "AutorollRoll"
-	KIND_AUTOROLL_ROLL_ANCESTOR       Kind = "AutorollRollAncestor" // Fake; used to force strong consistency for testing's sake.
-	KIND_AUTOROLL_STATUS              Kind = "AutorollStatus"
-	KIND_AUTOROLL_STATUS_ANCESTOR     Kind = "AutorollStatusAncestor" // Fake; used to force strong consistency for testing's sake.
-	KIND_AUTOROLL_STRATEGY            Kind = "AutorollStrategy"
-	KIND_AUTOROLL_STRATEGY_ANCESTOR   Kind = "AutorollStrategyAncestor" // Fake; used to force strong consistency for testing's sake.
-	KIND_AUTOROLL_UNTHROTTLE          Kind = "AutorollUnthrottle"
-	KIND_AUTOROLL_UNTHROTTLE_ANCESTOR Kind = "AutorollUnthrottleAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_ATOMIC_ROLL          Kind = "AutorollAtomicRoll"
+	KIND_AUTOROLL_ATOMIC_ROLL_ANCESTOR Kind = "AutorollAtomicRollAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_FREEZE               Kind = "AutorollFreeze"
+	KIND_AUTOROLL_FREEZE_ANCESTOR      Kind = "AutorollFreezeAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_MODE                 Kind = "AutorollMode"
+	KIND_AUTOROLL_MODE_ANCESTOR        Kind = "AutorollModeAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_ROLL                 Kind = "AutorollRoll"
+	KIND_AUTOROLL_ROLL_ANCESTOR        Kind = "AutorollRollAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_STATUS               Kind = "AutorollStatus"
+	KIND_AUTOROLL_STATUS_ANCESTOR      Kind = "AutorollStatusAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_STRATEGY             Kind = "AutorollStrategy"
+	KIND_AUTOROLL_STRATEGY_ANCESTOR    Kind = "AutorollStrategyAncestor" // Fake; used to force strong consistency for testing's sake.
+	KIND_AUTOROLL_UNTHROTTLE           Kind = "AutorollUnthrottle"
+	KIND_AUTOROLL_UNTHROTTLE_ANCESTOR  Kind = "AutorollUnthrottleAncestor" // Fake; used to force strong consistency for testing's sake.
 
 	// AlertManager
 	INCIDENT_AM               Kind = "IncidentAm"
@@ -126,8 +130,8 @@ var (
 	// even if that app isn't running there, which has a better failure mode of
 	// possibly backing up too much data rather than too little.
 	KindsToBackup = map[string][]Kind{
-		AUTOROLL_NS:            {KIND_AUTOROLL_MODE, KIND_AUTOROLL_MODE_ANCESTOR, KIND_AUTOROLL_ROLL, KIND_AUTOROLL_ROLL_ANCESTOR, KIND_AUTOROLL_STATUS, KIND_AUTOROLL_STATUS_ANCESTOR, KIND_AUTOROLL_STRATEGY, KIND_AUTOROLL_STRATEGY_ANCESTOR, KIND_AUTOROLL_UNTHROTTLE, KIND_AUTOROLL_UNTHROTTLE_ANCESTOR},
-		AUTOROLL_INTERNAL_NS:   {KIND_AUTOROLL_MODE, KIND_AUTOROLL_MODE_ANCESTOR, KIND_AUTOROLL_ROLL, KIND_AUTOROLL_ROLL_ANCESTOR, KIND_AUTOROLL_STATUS, KIND_AUTOROLL_STATUS_ANCESTOR, KIND_AUTOROLL_STRATEGY, KIND_AUTOROLL_STRATEGY_ANCESTOR, KIND_AUTOROLL_UNTHROTTLE, KIND_AUTOROLL_UNTHROTTLE_ANCESTOR},
+		AUTOROLL_NS:            {KIND_AUTOROLL_ATOMIC_ROLL, KIND_AUTOROLL_ATOMIC_ROLL_ANCESTOR, KIND_AUTOROLL_FREEZE, KIND_AUTOROLL_FREEZE_ANCESTOR, KIND_AUTOROLL_MODE, KIND_AUTOROLL_MODE_ANCESTOR, KIND_AUTOROLL_ROLL, KIND_AUTOROLL_ROLL_ANCESTOR, KIND_AUTOROLL_STATUS, KIND_AUTOROLL_STATUS_ANCESTOR, KIND_AUTOROLL_STRATEGY, KIND_AUTOROLL_STRATEGY_ANCESTOR, KIND_AUTOROLL_UNTHROTTLE, KIND_AUTOROLL_UNTHROTTLE_ANCESTOR},
+		AUTOROLL_INTERNAL_NS:   {KIND_AUTOROLL_ATOMIC_ROLL, KIND_AUTOROLL_ATOMIC_ROLL_ANCESTOR, KIND_AUTOROLL_FREEZE, KIND_AUTOROLL_FREEZE_ANCESTOR, KIND_AUTOROLL_MODE, KIND_AUTOROLL_MODE_ANCESTOR, KIND_AUTOROLL_ROLL, KIND_AUTOROLL_ROLL_ANCESTOR, KIND_AUTOROLL_STATUS, KIND_AUTOROLL_STATUS_ANCESTOR, KIND_AUTOROLL_STRATEGY, KIND_AUTOROLL_STRATEGY_ANCESTOR, KIND_AUTOROLL_UNTHROTTLE, KIND_AUTOROLL_UNTHROTTLE_ANCESTOR},
 		PERF_NS:                {ALERT},
 		PERF_ANDROID_NS:        {ALERT},
 		PERF_ANDROID_X_NS:      {ALERT},
@@ -81,6 +81,14 @@ const (
 
 	URL_TMPL_CHANGE = "/changes/%d/detail?o=ALL_REVISIONS"
 
+	// URLs for branches and commits of a project.
+	URL_TMPL_BRANCH         = "/projects/%s/branches/%s"
+	URL_TMPL_PROJECT_COMMIT = "/projects/%s/commits/%s"
+
+	// Maximum number of commits on the target branch of a merged change
+	// which GetMergedRevision searches for the change.
+	MAX_MERGED_REVISION_SEARCH = 100
+
 	// Kinds of patchsets.
 	PATCHSET_KIND_MERGE_FIRST_PARENT_UPDATE = "MERGE_FIRST_PARENT_UPDATE"
 	PATCHSET_KIND_NO_CHANGE                 = "NO_CHANGE"
@@ -229,6 +237,7 @@ type GerritInterface interface {
 	Files(ctx context.Context, issue int64, patch string) (map[string]*FileInfo, error)
 	GetFileNames(ctx context.Context, issue int64, patch string) ([]string, error)
 	GetIssueProperties(context.Context, int64) (*ChangeInfo, error)
+	GetMergedRevision(context.Context, *ChangeInfo) (string, error)
 	GetPatch(context.Context, int64, string) (string, error)
 	GetRepoUrl() string
 	GetTrybotResults(context.Context, int64, int64) ([]*buildbucketpb.Build, error)
@@ -504,6 +513,50 @@ func (g *Gerrit) GetCommit(ctx context.Context, issue int64, revision string) (*
 	return ret, nil
 }
 
+// BranchInfo describes a branch of a project.
+type BranchInfo struct {
+	Ref      string `json:"ref"`
+	Revision string `json:"revision"`
+}
+
+// GetMergedRevision returns the ID of the commit which landed the given merged
+// change on its branch. Depending on the submit type of the project, this is
+// either the current patchset of the change or a merge commit which has the
+// current patchset as a parent, so the first-parent history of the branch is
+// searched for either. Returns the empty string if the change is not found
+// within the last MAX_MERGED_REVISION_SEARCH commits on the branch.
+// See: https://gerrit-review.googlesource.com/Documentation/rest-api-projects.html#get-commit
+func (g *Gerrit) GetMergedRevision(ctx context.Context, ci *ChangeInfo) (string, error) {
+	if !ci.IsMerged() || len(ci.Patchsets) == 0 {
+		return "", fmt.Errorf("Change %d is not merged.", ci.Issue)
+	}
+	patchset := ci.Patchsets[len(ci.Patchsets)-1].ID
+	project := url.PathEscape(ci.Project)
+	var branch BranchInfo
+	if err := g.get(ctx, fmt.Sprintf(URL_TMPL_BRANCH, project, url.PathEscape(ci.Branch)), &branch, nil); err != nil {
+		return "", skerr.Wrapf(err, "Failed to retrieve branch %q of %s", ci.Branch, ci.Project)
+	}
+	commit := branch.Revision
+	for i := 0; i < MAX_MERGED_REVISION_SEARCH && commit != ""; i++ {
+		if commit == patchset {
+			return commit, nil
+		}
+		var c CommitInfo
+		if err := g.get(ctx, fmt.Sprintf(URL_TMPL_PROJECT_COMMIT, project, commit), &c, nil); err != nil {
+			return "", skerr.Wrapf(err, "Failed to retrieve commit %s of %s", commit, ci.Project)
+		}
+		commit = ""
+		for idx, p := range c.Parents {
+			if idx == 0 {
+				commit = p.Commit
+			} else if p.Commit == patchset {
+				return c.Commit, nil
+			}
+		}
+	}
+	return "", nil
+}
+
 type reviewer struct {
 	Reviewer string `json:"reviewer"`
 }
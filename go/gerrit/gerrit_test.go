@@ -467,3 +467,62 @@ func TestGetCommit(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, expectedParent, commitInfo.Parents[0].Commit)
 }
+
+func TestGetMergedRevision(t *testing.T) {
+	unittest.SmallTest(t)
+
+	// The branch has a merge commit "merge" whose second parent is the
+	// change's current patchset, "ps2".
+	responses := map[string]string{
+		"/projects/my%2Fproject/branches/master":   `{"ref": "refs/heads/master", "revision": "head"}`,
+		"/projects/my%2Fproject/commits/head":      `{"commit": "head", "parents": [{"commit": "merge"}]}`,
+		"/projects/my%2Fproject/commits/merge":     `{"commit": "merge", "parents": [{"commit": "base"}, {"commit": "ps2"}]}`,
+		"/projects/my%2Fproject/commits/base":      `{"commit": "base", "parents": [{"commit": "root"}]}`,
+		"/projects/my%2Fproject/commits/root":      `{"commit": "root", "parents": []}`,
+		"/projects/my%2Fproject/branches/no-merge": `{"ref": "refs/heads/no-merge", "revision": "ps2"}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, err := fmt.Fprintf(w, ")]}'\n%s", resp)
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	api, err := NewGerritWithConfig(CONFIG_CHROMIUM, ts.URL, "", nil)
+	require.NoError(t, err)
+	ci := &ChangeInfo{
+		Issue:   123,
+		Project: "my/project",
+		Branch:  "master",
+		Status:  CHANGE_STATUS_MERGED,
+		Patchsets: []*Revision{
+			{ID: "ps1", Number: 1},
+			{ID: "ps2", Number: 2},
+		},
+	}
+	rev, err := api.GetMergedRevision(context.TODO(), ci)
+	require.NoError(t, err)
+	require.Equal(t, "merge", rev)
+
+	// The current patchset itself landed.
+	ci.Branch = "no-merge"
+	rev, err = api.GetMergedRevision(context.TODO(), ci)
+	require.NoError(t, err)
+	require.Equal(t, "ps2", rev)
+
+	// The change isn't on the branch.
+	ci.Branch = "master"
+	ci.Patchsets = ci.Patchsets[:1]
+	rev, err = api.GetMergedRevision(context.TODO(), ci)
+	require.NoError(t, err)
+	require.Equal(t, "", rev)
+
+	// The change isn't merged.
+	ci.Status = CHANGE_STATUS_NEW
+	_, err = api.GetMergedRevision(context.TODO(), ci)
+	require.EqualError(t, err, "Change 123 is not merged.")
+}
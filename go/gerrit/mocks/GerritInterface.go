@@ -244,6 +244,27 @@ func (_m *GerritInterface) GetIssueProperties(_a0 context.Context, _a1 int64) (*
 	return r0, r1
 }
 
+// GetMergedRevision provides a mock function with given fields: _a0, _a1
+func (_m *GerritInterface) GetMergedRevision(_a0 context.Context, _a1 *gerrit.ChangeInfo) (string, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, *gerrit.ChangeInfo) string); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *gerrit.ChangeInfo) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetPatch provides a mock function with given fields: _a0, _a1, _a2
 func (_m *GerritInterface) GetPatch(_a0 context.Context, _a1 int64, _a2 string) (string, error) {
 	ret := _m.Called(_a0, _a1, _a2)
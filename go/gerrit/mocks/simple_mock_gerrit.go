@@ -38,6 +38,9 @@ func (g *SimpleGerritInterface) ExtractIssueFromCommit(commitMsg string) (int64,
 func (g *SimpleGerritInterface) GetIssueProperties(ctx context.Context, issue int64) (*gerrit.ChangeInfo, error) {
 	return &gerrit.ChangeInfo{Issue: issue}, nil
 }
+func (g *SimpleGerritInterface) GetMergedRevision(ctx context.Context, ci *gerrit.ChangeInfo) (string, error) {
+	return "", nil
+}
 func (g *SimpleGerritInterface) GetPatch(ctx context.Context, issue int64, revision string) (string, error) {
 	return "", nil
 }
@@ -3,6 +3,7 @@ package testutils
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"path"
 
 	"github.com/stretchr/testify/require"
@@ -71,6 +72,34 @@ func (g *MockGerrit) MockGetIssueProperties(ci *gerrit.ChangeInfo) {
 	g.Mock.MockOnce(url, mockhttpclient.MockGetDialogue(serialized))
 }
 
+// mockGet mocks a GET request to the given sub URL, which returns the given
+// object as JSON.
+func (g *MockGerrit) mockGet(suburl string, rv interface{}) {
+	serialized, err := json.Marshal(rv)
+	require.NoError(g.t, err)
+	serialized = append([]byte(")]}'\n"), serialized...)
+	g.Mock.MockOnce(FAKE_GERRIT_URL+suburl, mockhttpclient.MockGetDialogue(serialized))
+}
+
+// MockGetMergedRevision mocks the requests made by GetMergedRevision for the
+// given merged change. The given commits are the first-parent history of the
+// change's branch, most recent first, up to and including the commit which
+// landed the change.
+func (g *MockGerrit) MockGetMergedRevision(ci *gerrit.ChangeInfo, commits ...*gerrit.CommitInfo) {
+	project := url.PathEscape(ci.Project)
+	g.mockGet(fmt.Sprintf(gerrit.URL_TMPL_BRANCH, project, url.PathEscape(ci.Branch)), &gerrit.BranchInfo{
+		Ref:      "refs/heads/" + ci.Branch,
+		Revision: commits[0].Commit,
+	})
+	for _, c := range commits[:len(commits)-1] {
+		g.mockGet(fmt.Sprintf(gerrit.URL_TMPL_PROJECT_COMMIT, project, c.Commit), c)
+	}
+	// The last commit is only retrieved if it is a merge commit.
+	if last := commits[len(commits)-1]; len(last.Parents) > 1 {
+		g.mockGet(fmt.Sprintf(gerrit.URL_TMPL_PROJECT_COMMIT, project, last.Commit), last)
+	}
+}
+
 func (g *MockGerrit) MockGetTrybotResults(ci *gerrit.ChangeInfo, patchset int, results []*buildbucketpb.Build) {
 	g.bb.MockGetTrybotsForCL(ci.Issue, int64(patchset), g.Gerrit.Url(ci.Issue), results, nil)
 }
@@ -0,0 +1,318 @@
+// package gitea provides a library for interacting with Gitea via its REST API:
+// https://try.gitea.io/api/swagger
+//
+// This library assumes that the http.Client provided in NewGitea contains the
+// appropriate authentication, eg. an access token supplied as an OAuth2 bearer
+// token.
+
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	TOKEN_FILENAME    = "gitea_token"
+	TOKEN_SERVER_PATH = "/var/secrets/gitea-token"
+
+	PULL_REQUEST_STATE_OPEN   = "open"
+	PULL_REQUEST_STATE_CLOSED = "closed"
+
+	MERGE_METHOD_MERGE  = "merge"
+	MERGE_METHOD_REBASE = "rebase"
+	MERGE_METHOD_SQUASH = "squash"
+
+	STATUS_PENDING = "pending"
+	STATUS_SUCCESS = "success"
+	STATUS_ERROR   = "error"
+	STATUS_FAILURE = "failure"
+	STATUS_WARNING = "warning"
+
+	apiPath = "/api/v1"
+)
+
+// User represents a Gitea user.
+type User struct {
+	ID       int64  `json:"id"`
+	Login    string `json:"login"`
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+}
+
+// Label represents a label in a Gitea repo.
+type Label struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Branch identifies the head or base of a pull request.
+type Branch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// PullRequest represents a Gitea pull request.
+type PullRequest struct {
+	ID        int64     `json:"id"`
+	Number    int64     `json:"number"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	State     string    `json:"state"`
+	Labels    []*Label  `json:"labels"`
+	Mergeable bool      `json:"mergeable"`
+	Merged    bool      `json:"merged"`
+	Head      *Branch   `json:"head"`
+	Base      *Branch   `json:"base"`
+	HTMLURL   string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HasLabel returns true iff the pull request has the given label.
+func (pr *PullRequest) HasLabel(name string) bool {
+	for _, l := range pr.Labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Status represents a single commit status, eg. one CI job.
+type Status struct {
+	ID        int64     `json:"id"`
+	Context   string    `json:"context"`
+	Status    string    `json:"status"`
+	TargetURL string    `json:"target_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CombinedStatus represents the combined commit statuses for a ref.
+type CombinedStatus struct {
+	State    string    `json:"state"`
+	SHA      string    `json:"sha"`
+	Statuses []*Status `json:"statuses"`
+}
+
+// Gitea is used for interacting with the Gitea API for a single repo.
+type Gitea struct {
+	// Base URL of the Gitea server, eg. "https://gitea.com".
+	URL       string
+	RepoOwner string
+	RepoName  string
+
+	client *http.Client
+}
+
+// NewGitea returns a new Gitea instance.
+func NewGitea(giteaURL, repoOwner, repoName string, httpClient *http.Client) (*Gitea, error) {
+	if giteaURL == "" {
+		return nil, errors.New("URL is required.")
+	}
+	if repoOwner == "" {
+		return nil, errors.New("RepoOwner is required.")
+	}
+	if repoName == "" {
+		return nil, errors.New("RepoName is required.")
+	}
+	return &Gitea{
+		URL:       strings.TrimSuffix(giteaURL, "/"),
+		RepoOwner: repoOwner,
+		RepoName:  repoName,
+		client:    httpClient,
+	}, nil
+}
+
+// repoURL returns the API URL for the given path within the repo.
+func (g *Gitea) repoURL(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s%s/repos/%s/%s", g.URL, apiPath, url.PathEscape(g.RepoOwner), url.PathEscape(g.RepoName)) + fmt.Sprintf(format, args...)
+}
+
+// do performs an API request. If body is non-nil, it is encoded as JSON. If
+// rv is non-nil, the response is decoded into it.
+func (g *Gitea) do(ctx context.Context, method, u string, body, rv interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("Failed to encode request: %s", err)
+		}
+	}
+	req, err := http.NewRequest(method, u, &buf)
+	if err != nil {
+		return fmt.Errorf("Failed to create request: %s", err)
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed doing %s %s: %s", method, u, err)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unexpected status code %d from %s %s: %s", resp.StatusCode, method, u, string(b))
+	}
+	if rv != nil {
+		if err := json.NewDecoder(resp.Body).Decode(rv); err != nil {
+			return fmt.Errorf("Failed to decode response from %s %s: %s", method, u, err)
+		}
+	}
+	return nil
+}
+
+// GetAuthenticatedUser returns the user whose credentials are used by the
+// client.
+func (g *Gitea) GetAuthenticatedUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := g.do(ctx, http.MethodGet, g.URL+apiPath+"/user", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// getLabelIDs returns the IDs of the given labels, which must exist in the
+// repo.
+func (g *Gitea) getLabelIDs(ctx context.Context, names ...string) ([]int64, error) {
+	var labels []*Label
+	if err := g.do(ctx, http.MethodGet, g.repoURL("/labels?limit=100"), nil, &labels); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, l := range labels {
+			if l.Name == name {
+				ids = append(ids, l.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("No label %q exists in %s/%s", name, g.RepoOwner, g.RepoName)
+		}
+	}
+	return ids, nil
+}
+
+// CreatePullRequest creates a pull request to merge headBranch into
+// baseBranch, with the given labels, which must exist in the repo.
+func (g *Gitea) CreatePullRequest(ctx context.Context, headBranch, baseBranch, title, body string, labels []string) (*PullRequest, error) {
+	req := map[string]interface{}{
+		"head":  headBranch,
+		"base":  baseBranch,
+		"title": title,
+		"body":  body,
+	}
+	if len(labels) > 0 {
+		ids, err := g.getLabelIDs(ctx, labels...)
+		if err != nil {
+			return nil, err
+		}
+		req["labels"] = ids
+	}
+	var pr PullRequest
+	if err := g.do(ctx, http.MethodPost, g.repoURL("/pulls"), req, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// GetPullRequest returns the given pull request.
+func (g *Gitea) GetPullRequest(ctx context.Context, number int64) (*PullRequest, error) {
+	var pr PullRequest
+	if err := g.do(ctx, http.MethodGet, g.repoURL("/pulls/%d", number), nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// ClosePullRequest closes the given pull request without merging it.
+func (g *Gitea) ClosePullRequest(ctx context.Context, number int64) (*PullRequest, error) {
+	var pr PullRequest
+	if err := g.do(ctx, http.MethodPatch, g.repoURL("/pulls/%d", number), map[string]string{
+		"state": PULL_REQUEST_STATE_CLOSED,
+	}, &pr); err != nil {
+		return nil, err
+	}
+	if pr.State != PULL_REQUEST_STATE_CLOSED {
+		return nil, fmt.Errorf("Tried to close pull request %d but the state is %s", number, pr.State)
+	}
+	return &pr, nil
+}
+
+// MergePullRequest merges the given pull request using the given merge method
+// and commit message.
+func (g *Gitea) MergePullRequest(ctx context.Context, number int64, mergeMethod, title, msg string) error {
+	return g.do(ctx, http.MethodPost, g.repoURL("/pulls/%d/merge", number), map[string]string{
+		"Do":                mergeMethod,
+		"MergeTitleField":   title,
+		"MergeMessageField": msg,
+	}, nil)
+}
+
+// AddComment adds a comment to the given pull request.
+func (g *Gitea) AddComment(ctx context.Context, number int64, msg string) error {
+	return g.do(ctx, http.MethodPost, g.repoURL("/issues/%d/comments", number), map[string]string{
+		"body": msg,
+	}, nil)
+}
+
+// ReplaceLabel removes oldLabel from the pull request, if present, and adds
+// newLabel. Either label may be empty.
+func (g *Gitea) ReplaceLabel(ctx context.Context, number int64, oldLabel, newLabel string) error {
+	if oldLabel != "" {
+		ids, err := g.getLabelIDs(ctx, oldLabel)
+		if err != nil {
+			return err
+		}
+		if err := g.do(ctx, http.MethodDelete, g.repoURL("/issues/%d/labels/%d", number, ids[0]), nil, nil); err != nil {
+			return err
+		}
+	}
+	if newLabel != "" {
+		ids, err := g.getLabelIDs(ctx, newLabel)
+		if err != nil {
+			return err
+		}
+		if err := g.do(ctx, http.MethodPost, g.repoURL("/issues/%d/labels", number), map[string][]int64{
+			"labels": ids,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCombinedStatus returns the combined commit statuses for the given ref.
+func (g *Gitea) GetCombinedStatus(ctx context.Context, ref string) (*CombinedStatus, error) {
+	var s CombinedStatus
+	if err := g.do(ctx, http.MethodGet, g.repoURL("/commits/%s/status", url.PathEscape(ref)), nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetIssueUrlBase returns a base URL which can be used to construct URLs for
+// individual pull requests.
+func (g *Gitea) GetIssueUrlBase() string {
+	return fmt.Sprintf("%s/%s/%s/pulls/", g.URL, g.RepoOwner, g.RepoName)
+}
+
+// GetFullHistoryUrl returns a URL which lists all pull requests created by the
+// given user.
+func (g *Gitea) GetFullHistoryUrl(userID int64) string {
+	return fmt.Sprintf("%s/%s/%s/pulls?state=all&poster=%d", g.URL, g.RepoOwner, g.RepoName, userID)
+}
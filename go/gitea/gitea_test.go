@@ -0,0 +1,100 @@
+package gitea_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/gitea"
+	gitea_testutils "go.skia.org/infra/go/gitea/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestNewGitea(t *testing.T) {
+	unittest.SmallTest(t)
+
+	g, err := gitea.NewGitea("https://gitea.example.com/", "me", "my-repo", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://gitea.example.com/me/my-repo/pulls/", g.GetIssueUrlBase())
+	require.Equal(t, "https://gitea.example.com/me/my-repo/pulls?state=all&poster=7", g.GetFullHistoryUrl(7))
+
+	_, err = gitea.NewGitea("", "me", "my-repo", nil)
+	require.EqualError(t, err, "URL is required.")
+	_, err = gitea.NewGitea("https://gitea.example.com", "", "my-repo", nil)
+	require.EqualError(t, err, "RepoOwner is required.")
+	_, err = gitea.NewGitea("https://gitea.example.com", "me", "", nil)
+	require.EqualError(t, err, "RepoName is required.")
+}
+
+func TestPullRequestLifecycle(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	f := gitea_testutils.NewFakeGitea(t, "me", "my-repo", "autoroller: commit", "autoroller: dryrun")
+	defer f.Close()
+	g := f.Gitea
+
+	user, err := g.GetAuthenticatedUser(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "roller", user.Login)
+
+	// Labels must exist.
+	_, err = g.CreatePullRequest(ctx, "roll", "master", "Roll child", "Details", []string{"bogus"})
+	require.EqualError(t, err, "No label \"bogus\" exists in me/my-repo")
+
+	// Create a pull request.
+	pr, err := g.CreatePullRequest(ctx, "roll", "master", "Roll child", "Details", []string{"autoroller: dryrun"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), pr.Number)
+	require.Equal(t, gitea.PULL_REQUEST_STATE_OPEN, pr.State)
+	require.True(t, pr.HasLabel("autoroller: dryrun"))
+	require.False(t, pr.HasLabel("autoroller: commit"))
+
+	// Labels.
+	require.NoError(t, g.ReplaceLabel(ctx, pr.Number, "autoroller: dryrun", "autoroller: commit"))
+	pr, err = g.GetPullRequest(ctx, pr.Number)
+	require.NoError(t, err)
+	require.False(t, pr.HasLabel("autoroller: dryrun"))
+	require.True(t, pr.HasLabel("autoroller: commit"))
+
+	// Comments.
+	require.NoError(t, g.AddComment(ctx, pr.Number, "hello"))
+	require.Equal(t, []string{"hello"}, f.Comments(pr.Number))
+
+	// Statuses.
+	s, err := g.GetCombinedStatus(ctx, pr.Head.SHA)
+	require.NoError(t, err)
+	require.Equal(t, "", s.State)
+	require.Len(t, s.Statuses, 0)
+	f.SetStatuses(pr.Number, &gitea.Status{
+		ID:      1,
+		Context: "ci/build",
+		Status:  gitea.STATUS_SUCCESS,
+	}, &gitea.Status{
+		ID:      2,
+		Context: "ci/test",
+		Status:  gitea.STATUS_PENDING,
+	})
+	s, err = g.GetCombinedStatus(ctx, pr.Head.SHA)
+	require.NoError(t, err)
+	require.Equal(t, gitea.STATUS_PENDING, s.State)
+	require.Len(t, s.Statuses, 2)
+
+	// Merge.
+	require.Error(t, g.MergePullRequest(ctx, pr.Number, "bogus", "Roll child", "Details"))
+	require.NoError(t, g.MergePullRequest(ctx, pr.Number, gitea.MERGE_METHOD_SQUASH, "Roll child", "Details"))
+	pr, err = g.GetPullRequest(ctx, pr.Number)
+	require.NoError(t, err)
+	require.True(t, pr.Merged)
+
+	// Merged pull requests can't be closed.
+	_, err = g.ClosePullRequest(ctx, pr.Number)
+	require.Error(t, err)
+
+	// Close a different pull request.
+	pr, err = g.CreatePullRequest(ctx, "roll", "master", "Roll child", "Details", nil)
+	require.NoError(t, err)
+	pr, err = g.ClosePullRequest(ctx, pr.Number)
+	require.NoError(t, err)
+	require.Equal(t, gitea.PULL_REQUEST_STATE_CLOSED, pr.State)
+}
@@ -0,0 +1,386 @@
+package testutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/gitea"
+	"go.skia.org/infra/go/sktest"
+	"go.skia.org/infra/go/util"
+)
+
+// FakeGitea is a local HTTP server which implements the subset of the Gitea
+// API used by the gitea package, backed by in-memory state.
+type FakeGitea struct {
+	Gitea  *gitea.Gitea
+	Server *httptest.Server
+	User   *gitea.User
+
+	comments     map[int64][]string
+	labels       []*gitea.Label
+	mtx          sync.Mutex
+	nextNumber   int64
+	pullRequests map[int64]*gitea.PullRequest
+	repoName     string
+	repoOwner    string
+	statuses     map[string][]*gitea.Status
+	t            sktest.TestingT
+}
+
+// NewFakeGitea returns a FakeGitea instance for the given repo, which has the
+// given labels. The caller is responsible for calling Close.
+func NewFakeGitea(t sktest.TestingT, repoOwner, repoName string, labels ...string) *FakeGitea {
+	f := &FakeGitea{
+		User: &gitea.User{
+			ID:       7,
+			Login:    "roller",
+			FullName: "Roller",
+			Email:    "roller@example.com",
+		},
+		comments:     map[int64][]string{},
+		nextNumber:   1,
+		pullRequests: map[int64]*gitea.PullRequest{},
+		repoName:     repoName,
+		repoOwner:    repoOwner,
+		statuses:     map[string][]*gitea.Status{},
+		t:            t,
+	}
+	for i, l := range labels {
+		f.labels = append(f.labels, &gitea.Label{
+			ID:   int64(i + 1),
+			Name: l,
+		})
+	}
+	r := mux.NewRouter()
+	p := fmt.Sprintf("/api/v1/repos/%s/%s", repoOwner, repoName)
+	r.HandleFunc("/api/v1/user", f.getUser).Methods(http.MethodGet)
+	r.HandleFunc(p+"/labels", f.getLabels).Methods(http.MethodGet)
+	r.HandleFunc(p+"/pulls", f.createPullRequest).Methods(http.MethodPost)
+	r.HandleFunc(p+"/pulls/{number}", f.getPullRequest).Methods(http.MethodGet)
+	r.HandleFunc(p+"/pulls/{number}", f.editPullRequest).Methods(http.MethodPatch)
+	r.HandleFunc(p+"/pulls/{number}/merge", f.mergePullRequest).Methods(http.MethodPost)
+	r.HandleFunc(p+"/issues/{number}/comments", f.addComment).Methods(http.MethodPost)
+	r.HandleFunc(p+"/issues/{number}/labels", f.addLabels).Methods(http.MethodPost)
+	r.HandleFunc(p+"/issues/{number}/labels/{id}", f.removeLabel).Methods(http.MethodDelete)
+	r.HandleFunc(p+"/commits/{ref}/status", f.getCombinedStatus).Methods(http.MethodGet)
+	f.Server = httptest.NewServer(r)
+	g, err := gitea.NewGitea(f.Server.URL, repoOwner, repoName, http.DefaultClient)
+	require.NoError(t, err)
+	f.Gitea = g
+	return f
+}
+
+// Close shuts down the server.
+func (f *FakeGitea) Close() {
+	f.Server.Close()
+}
+
+// PullRequest returns a copy of the given pull request.
+func (f *FakeGitea) PullRequest(number int64) *gitea.PullRequest {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr, ok := f.pullRequests[number]
+	require.True(f.t, ok, "No pull request %d", number)
+	cpy := *pr
+	cpy.Labels = append([]*gitea.Label{}, pr.Labels...)
+	return &cpy
+}
+
+// Comments returns the comments on the given pull request.
+func (f *FakeGitea) Comments(number int64) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return util.CopyStringSlice(f.comments[number])
+}
+
+// SetStatuses sets the commit statuses for the HEAD of the given pull request.
+func (f *FakeGitea) SetStatuses(number int64, statuses ...*gitea.Status) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr, ok := f.pullRequests[number]
+	require.True(f.t, ok, "No pull request %d", number)
+	f.statuses[pr.Head.SHA] = statuses
+}
+
+// SetMergeable sets whether the given pull request is mergeable.
+func (f *FakeGitea) SetMergeable(number int64, mergeable bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr, ok := f.pullRequests[number]
+	require.True(f.t, ok, "No pull request %d", number)
+	pr.Mergeable = mergeable
+}
+
+// writeJSON writes the given value as a JSON response.
+func (f *FakeGitea) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	require.NoError(f.t, json.NewEncoder(w).Encode(v))
+}
+
+// lookup returns the pull request referenced by the request, or writes an
+// error response and returns nil. Assumes that the caller holds f.mtx.
+func (f *FakeGitea) lookup(w http.ResponseWriter, r *http.Request) *gitea.PullRequest {
+	number, err := strconv.ParseInt(mux.Vars(r)["number"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	pr, ok := f.pullRequests[number]
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil
+	}
+	return pr
+}
+
+// findLabel returns the label with the given ID, or nil if none exists.
+// Assumes that the caller holds f.mtx.
+func (f *FakeGitea) findLabel(id int64) *gitea.Label {
+	for _, l := range f.labels {
+		if l.ID == id {
+			return l
+		}
+	}
+	return nil
+}
+
+func (f *FakeGitea) getUser(w http.ResponseWriter, r *http.Request) {
+	f.writeJSON(w, http.StatusOK, f.User)
+}
+
+func (f *FakeGitea) getLabels(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	labels := f.labels
+	if labels == nil {
+		labels = []*gitea.Label{}
+	}
+	f.writeJSON(w, http.StatusOK, labels)
+}
+
+func (f *FakeGitea) createPullRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var req struct {
+		Head   string  `json:"head"`
+		Base   string  `json:"base"`
+		Title  string  `json:"title"`
+		Body   string  `json:"body"`
+		Labels []int64 `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Head == "" || req.Base == "" || req.Title == "" {
+		http.Error(w, "head, base and title are required", http.StatusUnprocessableEntity)
+		return
+	}
+	for _, pr := range f.pullRequests {
+		if pr.State == gitea.PULL_REQUEST_STATE_OPEN && pr.Head.Ref == req.Head && pr.Base.Ref == req.Base {
+			http.Error(w, "pull request already exists for these targets", http.StatusConflict)
+			return
+		}
+	}
+	labels := []*gitea.Label{}
+	for _, id := range req.Labels {
+		l := f.findLabel(id)
+		if l == nil {
+			http.Error(w, fmt.Sprintf("label %d does not exist", id), http.StatusUnprocessableEntity)
+			return
+		}
+		labels = append(labels, l)
+	}
+	number := f.nextNumber
+	f.nextNumber++
+	now := time.Now().UTC()
+	pr := &gitea.PullRequest{
+		ID:        1000 + number,
+		Number:    number,
+		Title:     req.Title,
+		Body:      req.Body,
+		State:     gitea.PULL_REQUEST_STATE_OPEN,
+		Labels:    labels,
+		Mergeable: true,
+		Head: &gitea.Branch{
+			Ref: req.Head,
+			SHA: fmt.Sprintf("%040d", number),
+		},
+		Base: &gitea.Branch{
+			Ref: req.Base,
+		},
+		HTMLURL:   fmt.Sprintf("%s/%s/%s/pulls/%d", f.Server.URL, f.repoOwner, f.repoName, number),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	f.pullRequests[number] = pr
+	f.writeJSON(w, http.StatusCreated, pr)
+}
+
+func (f *FakeGitea) getPullRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if pr := f.lookup(w, r); pr != nil {
+		f.writeJSON(w, http.StatusOK, pr)
+	}
+}
+
+func (f *FakeGitea) editPullRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr := f.lookup(w, r)
+	if pr == nil {
+		return
+	}
+	var req struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.State != "" {
+		if pr.Merged {
+			http.Error(w, "cannot change state of a merged pull request", http.StatusConflict)
+			return
+		}
+		pr.State = req.State
+	}
+	pr.UpdatedAt = time.Now().UTC()
+	f.writeJSON(w, http.StatusCreated, pr)
+}
+
+func (f *FakeGitea) mergePullRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr := f.lookup(w, r)
+	if pr == nil {
+		return
+	}
+	var req struct {
+		Do string `json:"Do"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !util.In(req.Do, []string{gitea.MERGE_METHOD_MERGE, gitea.MERGE_METHOD_REBASE, gitea.MERGE_METHOD_SQUASH}) {
+		http.Error(w, fmt.Sprintf("invalid merge method %q", req.Do), http.StatusUnprocessableEntity)
+		return
+	}
+	if pr.State != gitea.PULL_REQUEST_STATE_OPEN || !pr.Mergeable {
+		http.Error(w, "pull request is not mergeable", http.StatusMethodNotAllowed)
+		return
+	}
+	pr.State = gitea.PULL_REQUEST_STATE_CLOSED
+	pr.Merged = true
+	pr.UpdatedAt = time.Now().UTC()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeGitea) addComment(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr := f.lookup(w, r)
+	if pr == nil {
+		return
+	}
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.comments[pr.Number] = append(f.comments[pr.Number], req.Body)
+	f.writeJSON(w, http.StatusCreated, map[string]string{"body": req.Body})
+}
+
+func (f *FakeGitea) addLabels(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr := f.lookup(w, r)
+	if pr == nil {
+		return
+	}
+	var req struct {
+		Labels []int64 `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.Labels {
+		l := f.findLabel(id)
+		if l == nil {
+			http.Error(w, fmt.Sprintf("label %d does not exist", id), http.StatusUnprocessableEntity)
+			return
+		}
+		if !pr.HasLabel(l.Name) {
+			pr.Labels = append(pr.Labels, l)
+		}
+	}
+	f.writeJSON(w, http.StatusOK, pr.Labels)
+}
+
+func (f *FakeGitea) removeLabel(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	pr := f.lookup(w, r)
+	if pr == nil {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	labels := []*gitea.Label{}
+	for _, l := range pr.Labels {
+		if l.ID != id {
+			labels = append(labels, l)
+		}
+	}
+	pr.Labels = labels
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeGitea) getCombinedStatus(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	ref := mux.Vars(r)["ref"]
+	statuses := f.statuses[ref]
+	if statuses == nil {
+		statuses = []*gitea.Status{}
+	}
+	// Gitea reports the "worst" of the statuses as the combined state.
+	state := ""
+	if len(statuses) > 0 {
+		state = gitea.STATUS_SUCCESS
+	}
+	rank := map[string]int{
+		gitea.STATUS_SUCCESS: 0,
+		gitea.STATUS_WARNING: 1,
+		gitea.STATUS_PENDING: 2,
+		gitea.STATUS_FAILURE: 3,
+		gitea.STATUS_ERROR:   4,
+	}
+	for _, s := range statuses {
+		if rank[s.Status] > rank[state] {
+			state = s.Status
+		}
+	}
+	f.writeJSON(w, http.StatusOK, &gitea.CombinedStatus{
+		State:    state,
+		SHA:      ref,
+		Statuses: statuses,
+	})
+}
@@ -0,0 +1,297 @@
+// package gitlab provides a library for interacting with GitLab via its REST
+// API: https://docs.gitlab.com/ee/api/
+//
+// This library assumes that the http.Client provided in NewGitLab contains the
+// appropriate authentication, eg. a personal access token supplied as an OAuth2
+// bearer token.
+
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	TOKEN_FILENAME    = "gitlab_token"
+	TOKEN_SERVER_PATH = "/var/secrets/gitlab-token"
+
+	MERGE_REQUEST_STATE_OPENED = "opened"
+	MERGE_REQUEST_STATE_CLOSED = "closed"
+	MERGE_REQUEST_STATE_LOCKED = "locked"
+	MERGE_REQUEST_STATE_MERGED = "merged"
+
+	MERGE_STATUS_CAN_BE_MERGED    = "can_be_merged"
+	MERGE_STATUS_CANNOT_BE_MERGED = "cannot_be_merged"
+
+	PIPELINE_STATUS_CREATED  = "created"
+	PIPELINE_STATUS_PENDING  = "pending"
+	PIPELINE_STATUS_RUNNING  = "running"
+	PIPELINE_STATUS_SUCCESS  = "success"
+	PIPELINE_STATUS_FAILED   = "failed"
+	PIPELINE_STATUS_CANCELED = "canceled"
+	PIPELINE_STATUS_SKIPPED  = "skipped"
+	PIPELINE_STATUS_MANUAL   = "manual"
+
+	apiPath = "/api/v4"
+)
+
+// User represents a GitLab user.
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+}
+
+// Pipeline represents a GitLab CI pipeline.
+type Pipeline struct {
+	ID        int64     `json:"id"`
+	SHA       string    `json:"sha"`
+	Ref       string    `json:"ref"`
+	Status    string    `json:"status"`
+	WebURL    string    `json:"web_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Finished returns true iff the pipeline has finished running.
+func (p *Pipeline) Finished() bool {
+	switch p.Status {
+	case PIPELINE_STATUS_SUCCESS, PIPELINE_STATUS_FAILED, PIPELINE_STATUS_CANCELED, PIPELINE_STATUS_SKIPPED:
+		return true
+	}
+	return false
+}
+
+// Job represents a single job within a GitLab CI pipeline.
+type Job struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Stage     string    `json:"stage"`
+	Status    string    `json:"status"`
+	WebURL    string    `json:"web_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MergeRequest represents a GitLab merge request.
+type MergeRequest struct {
+	ID           int64     `json:"id"`
+	IID          int64     `json:"iid"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	State        string    `json:"state"`
+	Labels       []string  `json:"labels"`
+	SourceBranch string    `json:"source_branch"`
+	TargetBranch string    `json:"target_branch"`
+	SHA          string    `json:"sha"`
+	MergeStatus  string    `json:"merge_status"`
+	HasConflicts bool      `json:"has_conflicts"`
+	HeadPipeline *Pipeline `json:"head_pipeline"`
+	WebURL       string    `json:"web_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// GitLab is used for interacting with the GitLab API for a single project.
+type GitLab struct {
+	// Base URL of the GitLab server, eg. "https://gitlab.com".
+	URL string
+	// Path of the project, eg. "my-group/my-project".
+	Project string
+
+	client *http.Client
+}
+
+// NewGitLab returns a new GitLab instance.
+func NewGitLab(gitlabURL, project string, httpClient *http.Client) (*GitLab, error) {
+	if gitlabURL == "" {
+		return nil, errors.New("URL is required.")
+	}
+	if project == "" {
+		return nil, errors.New("Project is required.")
+	}
+	return &GitLab{
+		URL:     strings.TrimSuffix(gitlabURL, "/"),
+		Project: project,
+		client:  httpClient,
+	}, nil
+}
+
+// projectURL returns the API URL for the given path within the project.
+func (g *GitLab) projectURL(format string, args ...interface{}) string {
+	return g.URL + apiPath + "/projects/" + url.PathEscape(g.Project) + fmt.Sprintf(format, args...)
+}
+
+// do performs an API request. If body is non-nil, it is encoded as JSON. If
+// rv is non-nil, the response is decoded into it.
+func (g *GitLab) do(ctx context.Context, method, u string, body, rv interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return fmt.Errorf("Failed to encode request: %s", err)
+		}
+	}
+	req, err := http.NewRequest(method, u, &buf)
+	if err != nil {
+		return fmt.Errorf("Failed to create request: %s", err)
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed doing %s %s: %s", method, u, err)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unexpected status code %d from %s %s: %s", resp.StatusCode, method, u, string(b))
+	}
+	if rv != nil {
+		if err := json.NewDecoder(resp.Body).Decode(rv); err != nil {
+			return fmt.Errorf("Failed to decode response from %s %s: %s", method, u, err)
+		}
+	}
+	return nil
+}
+
+// See https://docs.gitlab.com/ee/api/users.html#for-normal-users-1
+// for the API documentation.
+func (g *GitLab) GetCurrentUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := g.do(ctx, http.MethodGet, g.URL+apiPath+"/user", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// See https://docs.gitlab.com/ee/api/merge_requests.html#create-mr
+// for the API documentation.
+func (g *GitLab) CreateMergeRequest(ctx context.Context, sourceBranch, targetBranch, title, description string, labels []string) (*MergeRequest, error) {
+	req := map[string]interface{}{
+		"source_branch":        sourceBranch,
+		"target_branch":        targetBranch,
+		"title":                title,
+		"description":          description,
+		"remove_source_branch": true,
+	}
+	if len(labels) > 0 {
+		req["labels"] = strings.Join(labels, ",")
+	}
+	var mr MergeRequest
+	if err := g.do(ctx, http.MethodPost, g.projectURL("/merge_requests"), req, &mr); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+// See https://docs.gitlab.com/ee/api/merge_requests.html#get-single-mr
+// for the API documentation.
+func (g *GitLab) GetMergeRequest(ctx context.Context, iid int64) (*MergeRequest, error) {
+	var mr MergeRequest
+	if err := g.do(ctx, http.MethodGet, g.projectURL("/merge_requests/%d", iid), nil, &mr); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+// See https://docs.gitlab.com/ee/api/merge_requests.html#update-mr
+// for the API documentation.
+func (g *GitLab) CloseMergeRequest(ctx context.Context, iid int64) (*MergeRequest, error) {
+	var mr MergeRequest
+	if err := g.do(ctx, http.MethodPut, g.projectURL("/merge_requests/%d", iid), map[string]string{
+		"state_event": "close",
+	}, &mr); err != nil {
+		return nil, err
+	}
+	if mr.State != MERGE_REQUEST_STATE_CLOSED {
+		return nil, fmt.Errorf("Tried to close merge request %d but the state is %s", iid, mr.State)
+	}
+	return &mr, nil
+}
+
+// ReplaceLabel removes oldLabel from the merge request, if present, and adds
+// newLabel. Either label may be empty. See
+// https://docs.gitlab.com/ee/api/merge_requests.html#update-mr for the API
+// documentation.
+func (g *GitLab) ReplaceLabel(ctx context.Context, iid int64, oldLabel, newLabel string) error {
+	req := map[string]string{}
+	if oldLabel != "" {
+		req["remove_labels"] = oldLabel
+	}
+	if newLabel != "" {
+		req["add_labels"] = newLabel
+	}
+	if len(req) == 0 {
+		return nil
+	}
+	return g.do(ctx, http.MethodPut, g.projectURL("/merge_requests/%d", iid), req, nil)
+}
+
+// See https://docs.gitlab.com/ee/api/notes.html#create-new-merge-request-note
+// for the API documentation.
+func (g *GitLab) AddComment(ctx context.Context, iid int64, msg string) error {
+	return g.do(ctx, http.MethodPost, g.projectURL("/merge_requests/%d/notes", iid), map[string]string{
+		"body": msg,
+	}, nil)
+}
+
+// See https://docs.gitlab.com/ee/api/merge_requests.html#create-mr-pipeline
+// for the API documentation.
+func (g *GitLab) CreateMergeRequestPipeline(ctx context.Context, iid int64) (*Pipeline, error) {
+	var p Pipeline
+	if err := g.do(ctx, http.MethodPost, g.projectURL("/merge_requests/%d/pipelines", iid), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// See https://docs.gitlab.com/ee/api/jobs.html#list-pipeline-jobs
+// for the API documentation.
+func (g *GitLab) GetPipelineJobs(ctx context.Context, pipelineID int64) ([]*Job, error) {
+	var jobs []*Job
+	if err := g.do(ctx, http.MethodGet, g.projectURL("/pipelines/%d/jobs?per_page=100", pipelineID), nil, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// MergeMergeRequest merges the merge request, provided that its HEAD is still
+// at the given commit hash. See
+// https://docs.gitlab.com/ee/api/merge_requests.html#accept-mr for the API
+// documentation.
+func (g *GitLab) MergeMergeRequest(ctx context.Context, iid int64, sha string, squash bool) (*MergeRequest, error) {
+	var mr MergeRequest
+	if err := g.do(ctx, http.MethodPut, g.projectURL("/merge_requests/%d/merge", iid), map[string]interface{}{
+		"sha":                         sha,
+		"squash":                      squash,
+		"should_remove_source_branch": true,
+	}, &mr); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+// GetIssueUrlBase returns a base URL which can be used to construct URLs for
+// individual merge requests.
+func (g *GitLab) GetIssueUrlBase() string {
+	return fmt.Sprintf("%s/%s/-/merge_requests/", g.URL, g.Project)
+}
+
+// GetFullHistoryUrl returns a URL which lists all merge requests created by
+// the given user.
+func (g *GitLab) GetFullHistoryUrl(username string) string {
+	return fmt.Sprintf("%s/%s/-/merge_requests?scope=all&state=all&author_username=%s", g.URL, g.Project, url.QueryEscape(username))
+}
@@ -0,0 +1,101 @@
+package gitlab_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/gitlab"
+	gitlab_testutils "go.skia.org/infra/go/gitlab/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func TestNewGitLab(t *testing.T) {
+	unittest.SmallTest(t)
+
+	g, err := gitlab.NewGitLab("https://gitlab.example.com/", "my-group/my-project", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://gitlab.example.com/my-group/my-project/-/merge_requests/", g.GetIssueUrlBase())
+	require.Equal(t, "https://gitlab.example.com/my-group/my-project/-/merge_requests?scope=all&state=all&author_username=roller", g.GetFullHistoryUrl("roller"))
+
+	_, err = gitlab.NewGitLab("", "my-group/my-project", nil)
+	require.EqualError(t, err, "URL is required.")
+	_, err = gitlab.NewGitLab("https://gitlab.example.com", "", nil)
+	require.EqualError(t, err, "Project is required.")
+}
+
+func TestMergeRequestLifecycle(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	f := gitlab_testutils.NewFakeGitLab(t, "my-group/my-project")
+	defer f.Close()
+	g := f.GitLab
+
+	user, err := g.GetCurrentUser(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "roller", user.Username)
+	require.Equal(t, "roller@example.com", user.Email)
+
+	// Create a merge request.
+	mr, err := g.CreateMergeRequest(ctx, "roll", "master", "Roll child", "Details", []string{"autoroller: dryrun"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), mr.IID)
+	require.Equal(t, gitlab.MERGE_REQUEST_STATE_OPENED, mr.State)
+	require.Equal(t, []string{"autoroller: dryrun"}, mr.Labels)
+	require.Nil(t, mr.HeadPipeline)
+
+	// Only one open merge request per source branch.
+	_, err = g.CreateMergeRequest(ctx, "roll", "master", "Roll child", "Details", nil)
+	require.Error(t, err)
+
+	// Labels.
+	require.NoError(t, g.ReplaceLabel(ctx, mr.IID, "autoroller: dryrun", "autoroller: commit"))
+	require.Equal(t, []string{"autoroller: commit"}, f.MergeRequest(mr.IID).Labels)
+	require.NoError(t, g.ReplaceLabel(ctx, mr.IID, "", ""))
+
+	// Comments.
+	require.NoError(t, g.AddComment(ctx, mr.IID, "hello"))
+	require.Equal(t, []string{"hello"}, f.Notes(mr.IID))
+
+	// Pipelines.
+	p, err := g.CreateMergeRequestPipeline(ctx, mr.IID)
+	require.NoError(t, err)
+	require.False(t, p.Finished())
+	f.SetPipelineStatus(mr.IID, gitlab.PIPELINE_STATUS_FAILED, &gitlab.Job{
+		ID:     1,
+		Name:   "test",
+		Status: gitlab.PIPELINE_STATUS_FAILED,
+	})
+	mr, err = g.GetMergeRequest(ctx, mr.IID)
+	require.NoError(t, err)
+	require.Equal(t, p.ID, mr.HeadPipeline.ID)
+	require.True(t, mr.HeadPipeline.Finished())
+	jobs, err := g.GetPipelineJobs(ctx, p.ID)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "test", jobs[0].Name)
+
+	// Merge. The SHA must match.
+	_, err = g.MergeMergeRequest(ctx, mr.IID, "bogus", true)
+	require.Error(t, err)
+	mr, err = g.MergeMergeRequest(ctx, mr.IID, mr.SHA, true)
+	require.NoError(t, err)
+	require.Equal(t, gitlab.MERGE_REQUEST_STATE_MERGED, mr.State)
+
+	// Merged merge requests can't be closed.
+	_, err = g.CloseMergeRequest(ctx, mr.IID)
+	require.Error(t, err)
+
+	// Close a different merge request.
+	mr, err = g.CreateMergeRequest(ctx, "roll", "master", "Roll child", "Details", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), mr.IID)
+	mr, err = g.CloseMergeRequest(ctx, mr.IID)
+	require.NoError(t, err)
+	require.Equal(t, gitlab.MERGE_REQUEST_STATE_CLOSED, mr.State)
+
+	// Missing merge request.
+	_, err = g.GetMergeRequest(ctx, 42)
+	require.Error(t, err)
+}
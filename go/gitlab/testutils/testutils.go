@@ -0,0 +1,361 @@
+package testutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/gitlab"
+	"go.skia.org/infra/go/sktest"
+	"go.skia.org/infra/go/util"
+)
+
+// FakeGitLab is a local HTTP server which implements the subset of the GitLab
+// API used by the gitlab package, backed by in-memory state.
+type FakeGitLab struct {
+	GitLab *gitlab.GitLab
+	Server *httptest.Server
+	User   *gitlab.User
+
+	mtx            sync.Mutex
+	jobs           map[int64][]*gitlab.Job
+	mergeRequests  map[int64]*gitlab.MergeRequest
+	nextIID        int64
+	nextPipelineID int64
+	notes          map[int64][]string
+	pipelinesFail  bool
+	project        string
+	t              sktest.TestingT
+}
+
+// NewFakeGitLab returns a FakeGitLab instance for the given project. The
+// caller is responsible for calling Close.
+func NewFakeGitLab(t sktest.TestingT, project string) *FakeGitLab {
+	f := &FakeGitLab{
+		User: &gitlab.User{
+			ID:       7,
+			Username: "roller",
+			Name:     "Roller",
+			Email:    "roller@example.com",
+		},
+		jobs:           map[int64][]*gitlab.Job{},
+		mergeRequests:  map[int64]*gitlab.MergeRequest{},
+		nextIID:        1,
+		nextPipelineID: 100,
+		notes:          map[int64][]string{},
+		project:        project,
+		t:              t,
+	}
+	r := mux.NewRouter().UseEncodedPath()
+	p := "/api/v4/projects/{project}"
+	r.HandleFunc("/api/v4/user", f.getUser).Methods(http.MethodGet)
+	r.HandleFunc(p+"/merge_requests", f.createMergeRequest).Methods(http.MethodPost)
+	r.HandleFunc(p+"/merge_requests/{iid}", f.getMergeRequest).Methods(http.MethodGet)
+	r.HandleFunc(p+"/merge_requests/{iid}", f.updateMergeRequest).Methods(http.MethodPut)
+	r.HandleFunc(p+"/merge_requests/{iid}/merge", f.mergeMergeRequest).Methods(http.MethodPut)
+	r.HandleFunc(p+"/merge_requests/{iid}/notes", f.addNote).Methods(http.MethodPost)
+	r.HandleFunc(p+"/merge_requests/{iid}/pipelines", f.createPipeline).Methods(http.MethodPost)
+	r.HandleFunc(p+"/pipelines/{id}/jobs", f.getJobs).Methods(http.MethodGet)
+	f.Server = httptest.NewServer(r)
+	g, err := gitlab.NewGitLab(f.Server.URL, project, http.DefaultClient)
+	require.NoError(t, err)
+	f.GitLab = g
+	return f
+}
+
+// Close shuts down the server.
+func (f *FakeGitLab) Close() {
+	f.Server.Close()
+}
+
+// MergeRequest returns a copy of the given merge request.
+func (f *FakeGitLab) MergeRequest(iid int64) *gitlab.MergeRequest {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr, ok := f.mergeRequests[iid]
+	require.True(f.t, ok, "No merge request %d", iid)
+	cpy := *mr
+	cpy.Labels = util.CopyStringSlice(mr.Labels)
+	if mr.HeadPipeline != nil {
+		p := *mr.HeadPipeline
+		cpy.HeadPipeline = &p
+	}
+	return &cpy
+}
+
+// Notes returns the comments on the given merge request.
+func (f *FakeGitLab) Notes(iid int64) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return util.CopyStringSlice(f.notes[iid])
+}
+
+// SetPipelineStatus sets the status of the head pipeline of the given merge
+// request, creating the pipeline if necessary, and sets its jobs.
+func (f *FakeGitLab) SetPipelineStatus(iid int64, status string, jobs ...*gitlab.Job) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr, ok := f.mergeRequests[iid]
+	require.True(f.t, ok, "No merge request %d", iid)
+	if mr.HeadPipeline == nil {
+		mr.HeadPipeline = f.newPipeline(mr)
+	}
+	mr.HeadPipeline.Status = status
+	mr.HeadPipeline.UpdatedAt = time.Now().UTC()
+	f.jobs[mr.HeadPipeline.ID] = jobs
+}
+
+// SetMergeStatus sets the merge status of the given merge request.
+func (f *FakeGitLab) SetMergeStatus(iid int64, mergeStatus string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr, ok := f.mergeRequests[iid]
+	require.True(f.t, ok, "No merge request %d", iid)
+	mr.MergeStatus = mergeStatus
+	mr.HasConflicts = mergeStatus == gitlab.MERGE_STATUS_CANNOT_BE_MERGED
+}
+
+// SetPipelinesFail determines whether requests to create pipelines fail.
+func (f *FakeGitLab) SetPipelinesFail(fail bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.pipelinesFail = fail
+}
+
+// newPipeline creates a new pipeline for the given merge request. Assumes that
+// the caller holds f.mtx.
+func (f *FakeGitLab) newPipeline(mr *gitlab.MergeRequest) *gitlab.Pipeline {
+	id := f.nextPipelineID
+	f.nextPipelineID++
+	now := time.Now().UTC()
+	return &gitlab.Pipeline{
+		ID:        id,
+		SHA:       mr.SHA,
+		Ref:       fmt.Sprintf("refs/merge-requests/%d/head", mr.IID),
+		Status:    gitlab.PIPELINE_STATUS_CREATED,
+		WebURL:    fmt.Sprintf("%s/%s/-/pipelines/%d", f.Server.URL, f.project, id),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// writeJSON writes the given value as a JSON response.
+func (f *FakeGitLab) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	require.NoError(f.t, json.NewEncoder(w).Encode(v))
+}
+
+// lookup returns the merge request referenced by the request, or writes an
+// error response and returns nil. Assumes that the caller holds f.mtx.
+func (f *FakeGitLab) lookup(w http.ResponseWriter, r *http.Request) *gitlab.MergeRequest {
+	vars := mux.Vars(r)
+	if vars["project"] != url.PathEscape(f.project) {
+		http.Error(w, "404 Project Not Found", http.StatusNotFound)
+		return nil
+	}
+	iid, err := strconv.ParseInt(vars["iid"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	mr, ok := f.mergeRequests[iid]
+	if !ok {
+		http.Error(w, "404 Not found", http.StatusNotFound)
+		return nil
+	}
+	return mr
+}
+
+func (f *FakeGitLab) getUser(w http.ResponseWriter, r *http.Request) {
+	f.writeJSON(w, http.StatusOK, f.User)
+}
+
+func (f *FakeGitLab) createMergeRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if mux.Vars(r)["project"] != url.PathEscape(f.project) {
+		http.Error(w, "404 Project Not Found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		Labels       string `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.SourceBranch == "" || req.TargetBranch == "" || req.Title == "" {
+		http.Error(w, "source_branch, target_branch and title are required", http.StatusBadRequest)
+		return
+	}
+	for _, mr := range f.mergeRequests {
+		if mr.State == gitlab.MERGE_REQUEST_STATE_OPENED && mr.SourceBranch == req.SourceBranch {
+			http.Error(w, "Another open merge request already exists for this source branch", http.StatusConflict)
+			return
+		}
+	}
+	iid := f.nextIID
+	f.nextIID++
+	now := time.Now().UTC()
+	labels := []string{}
+	if req.Labels != "" {
+		labels = strings.Split(req.Labels, ",")
+	}
+	mr := &gitlab.MergeRequest{
+		ID:           1000 + iid,
+		IID:          iid,
+		Title:        req.Title,
+		Description:  req.Description,
+		State:        gitlab.MERGE_REQUEST_STATE_OPENED,
+		Labels:       labels,
+		SourceBranch: req.SourceBranch,
+		TargetBranch: req.TargetBranch,
+		SHA:          fmt.Sprintf("%040d", iid),
+		MergeStatus:  gitlab.MERGE_STATUS_CAN_BE_MERGED,
+		WebURL:       fmt.Sprintf("%s/%s/-/merge_requests/%d", f.Server.URL, f.project, iid),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	f.mergeRequests[iid] = mr
+	f.writeJSON(w, http.StatusCreated, mr)
+}
+
+func (f *FakeGitLab) getMergeRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if mr := f.lookup(w, r); mr != nil {
+		f.writeJSON(w, http.StatusOK, mr)
+	}
+}
+
+func (f *FakeGitLab) updateMergeRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr := f.lookup(w, r)
+	if mr == nil {
+		return
+	}
+	var req struct {
+		StateEvent   string `json:"state_event"`
+		AddLabels    string `json:"add_labels"`
+		RemoveLabels string `json:"remove_labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.StateEvent == "close" {
+		if mr.State == gitlab.MERGE_REQUEST_STATE_MERGED {
+			http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mr.State = gitlab.MERGE_REQUEST_STATE_CLOSED
+	}
+	if req.RemoveLabels != "" {
+		remove := strings.Split(req.RemoveLabels, ",")
+		labels := []string{}
+		for _, l := range mr.Labels {
+			if !util.In(l, remove) {
+				labels = append(labels, l)
+			}
+		}
+		mr.Labels = labels
+	}
+	if req.AddLabels != "" {
+		for _, l := range strings.Split(req.AddLabels, ",") {
+			if !util.In(l, mr.Labels) {
+				mr.Labels = append(mr.Labels, l)
+			}
+		}
+	}
+	mr.UpdatedAt = time.Now().UTC()
+	f.writeJSON(w, http.StatusOK, mr)
+}
+
+func (f *FakeGitLab) mergeMergeRequest(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr := f.lookup(w, r)
+	if mr == nil {
+		return
+	}
+	var req struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if mr.State != gitlab.MERGE_REQUEST_STATE_OPENED || mr.MergeStatus != gitlab.MERGE_STATUS_CAN_BE_MERGED {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.SHA != "" && req.SHA != mr.SHA {
+		http.Error(w, "409 SHA does not match HEAD of source branch", http.StatusConflict)
+		return
+	}
+	mr.State = gitlab.MERGE_REQUEST_STATE_MERGED
+	mr.UpdatedAt = time.Now().UTC()
+	f.writeJSON(w, http.StatusOK, mr)
+}
+
+func (f *FakeGitLab) addNote(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr := f.lookup(w, r)
+	if mr == nil {
+		return
+	}
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.notes[mr.IID] = append(f.notes[mr.IID], req.Body)
+	f.writeJSON(w, http.StatusCreated, map[string]string{"body": req.Body})
+}
+
+func (f *FakeGitLab) createPipeline(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	mr := f.lookup(w, r)
+	if mr == nil {
+		return
+	}
+	if f.pipelinesFail {
+		http.Error(w, "Failed to create pipeline", http.StatusInternalServerError)
+		return
+	}
+	mr.HeadPipeline = f.newPipeline(mr)
+	f.writeJSON(w, http.StatusCreated, mr.HeadPipeline)
+}
+
+func (f *FakeGitLab) getJobs(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jobs := f.jobs[id]
+	if jobs == nil {
+		jobs = []*gitlab.Job{}
+	}
+	f.writeJSON(w, http.StatusOK, jobs)
+}
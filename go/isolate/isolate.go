@@ -488,3 +488,60 @@ func (c *Client) ReUploadIsolatedFiles(ctx context.Context, isolatedFiles []*iso
 	}
 	return rv, nil
 }
+
+// Download retrieves the files of the given isolated hash, including those of
+// any isolated files it includes, into outputDir.
+func (c *Client) Download(ctx context.Context, hash, outputDir string) error {
+	cmd := []string{
+		c.isolateserver, "download", "--verbose",
+		"--isolate-server", c.serverUrl,
+		"--isolated", hash,
+		"--output-dir", outputDir,
+	}
+	if c.serviceAccountJSON != "" {
+		cmd = append(cmd, "--service-account-json", c.serviceAccountJSON)
+	}
+	output, err := exec.RunCwd(ctx, c.workdir, cmd...)
+	if err != nil {
+		return fmt.Errorf("Failed to run isolated: %s\nOutput:\n%s", err, output)
+	}
+	return nil
+}
+
+// ArchiveDir uploads the contents of the given directory to the isolate server
+// and returns the resulting isolated hash.
+func (c *Client) ArchiveDir(ctx context.Context, dir string) (string, error) {
+	tmpDir, err := ioutil.TempDir("", "isolate")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create temporary dir: %s", err)
+	}
+	defer util.RemoveAll(tmpDir)
+	jsonOutput := filepath.Join(tmpDir, "hashes.json")
+	cmd := []string{
+		c.isolateserver, "archive", "--verbose",
+		"--isolate-server", c.serverUrl,
+		"--dirs", fmt.Sprintf("%s:.", dir),
+		"--dump-json", jsonOutput,
+	}
+	if c.serviceAccountJSON != "" {
+		cmd = append(cmd, "--service-account-json", c.serviceAccountJSON)
+	}
+	output, err := exec.RunCwd(ctx, c.workdir, cmd...)
+	if err != nil {
+		return "", fmt.Errorf("Failed to run isolated: %s\nOutput:\n%s", err, output)
+	}
+	var hashes map[string]string
+	if err := util.WithReadFile(jsonOutput, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&hashes)
+	}); err != nil {
+		return "", fmt.Errorf("Failed to read isolated hash: %s", err)
+	}
+	if len(hashes) != 1 {
+		return "", fmt.Errorf("Expected a single isolated hash but got %v", hashes)
+	}
+	var rv string
+	for _, hash := range hashes {
+		rv = hash
+	}
+	return rv, nil
+}
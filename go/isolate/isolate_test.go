@@ -2,6 +2,8 @@ package isolate
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.chromium.org/luci/common/isolated"
 	"go.skia.org/infra/go/deepequal"
+	"go.skia.org/infra/go/exec"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/testutils/unittest"
 )
@@ -220,3 +223,74 @@ func TestReUploadIsolatedFiles(t *testing.T) {
 	require.Equal(t, 40, len(hash3)) // Sanity check.
 	require.NotEqual(t, hash1, hash3)
 }
+
+func TestDownload(t *testing.T) {
+	unittest.SmallTest(t)
+
+	var cmds []*exec.Command
+	ctx := exec.NewContext(context.Background(), func(_ context.Context, cmd *exec.Command) error {
+		cmds = append(cmds, cmd)
+		if len(cmds) > 1 {
+			return errors.New("exit status 1")
+		}
+		return nil
+	})
+	c, err := NewClientWithServiceAccount("workdir", ISOLATE_SERVER_URL_FAKE, "creds.json")
+	require.NoError(t, err)
+	require.NoError(t, c.Download(ctx, "abc123", "/out"))
+	require.Len(t, cmds, 1)
+	require.Equal(t, c.workdir, cmds[0].Dir)
+	require.Equal(t, "isolated", cmds[0].Name)
+	require.Equal(t, []string{
+		"download", "--verbose",
+		"--isolate-server", ISOLATE_SERVER_URL_FAKE,
+		"--isolated", "abc123",
+		"--output-dir", "/out",
+		"--service-account-json", "creds.json",
+	}, cmds[0].Args)
+
+	// Failures are reported.
+	err = c.Download(ctx, "abc123", "/out")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Failed to run isolated: exit status 1")
+}
+
+func TestArchiveDir(t *testing.T) {
+	unittest.SmallTest(t)
+
+	// The fake isolated writes the given hashes to the --dump-json file.
+	var cmd *exec.Command
+	var hashes map[string]string
+	ctx := exec.NewContext(context.Background(), func(_ context.Context, c *exec.Command) error {
+		cmd = c
+		for i, arg := range c.Args {
+			if arg == "--dump-json" {
+				b, err := json.Marshal(hashes)
+				if err != nil {
+					return err
+				}
+				return ioutil.WriteFile(c.Args[i+1], b, os.ModePerm)
+			}
+		}
+		return errors.New("no --dump-json")
+	})
+	c, err := NewClient("workdir", ISOLATE_SERVER_URL_FAKE)
+	require.NoError(t, err)
+
+	hashes = map[string]string{"out": "abc123"}
+	hash, err := c.ArchiveDir(ctx, "/out")
+	require.NoError(t, err)
+	require.Equal(t, "abc123", hash)
+	require.Equal(t, "isolated", cmd.Name)
+	require.Equal(t, []string{"archive", "--verbose", "--isolate-server", ISOLATE_SERVER_URL_FAKE, "--dirs", "/out:."}, cmd.Args[:6])
+	require.Equal(t, "--dump-json", cmd.Args[6])
+	require.Len(t, cmd.Args, 8)
+
+	// We expect exactly one hash.
+	hashes = map[string]string{}
+	_, err = c.ArchiveDir(ctx, "/out")
+	require.EqualError(t, err, "Expected a single isolated hash but got map[]")
+	hashes = map[string]string{"a": "abc123", "b": "def456"}
+	_, err = c.ArchiveDir(ctx, "/out")
+	require.EqualError(t, err, "Expected a single isolated hash but got map[a:abc123 b:def456]")
+}
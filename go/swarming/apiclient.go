@@ -93,6 +93,12 @@ type ApiClient interface {
 	// N tasks done by a bot. When limit is big (>100), this call is very expensive.
 	ListBotTasks(botID string, limit int) ([]*swarming.SwarmingRpcsTaskResult, error)
 
+	// ListBotEvents returns a slice of swarming.SwarmingRpcsBotEvent
+	// instances corresponding to the events of the given bot within the
+	// given time window, most recent first. Specify time.Time{} for start
+	// and end if you do not want to restrict on time.
+	ListBotEvents(botID string, start, end time.Time) ([]*swarming.SwarmingRpcsBotEvent, error)
+
 	// ListTasks returns a slice of swarming.SwarmingRpcsTaskRequestMetadata
 	// instances corresponding to the specified tags and within given time window.
 	// The results will have TaskId, TaskResult, and Request fields populated.
@@ -249,6 +255,34 @@ func (c *apiClient) ListBotTasks(botID string, limit int) ([]*swarming.SwarmingR
 	return res.Items, nil
 }
 
+func (c *apiClient) ListBotEvents(botID string, start, end time.Time) ([]*swarming.SwarmingRpcsBotEvent, error) {
+	events := []*swarming.SwarmingRpcsBotEvent{}
+	cursor := ""
+	for {
+		list := c.s.Bot.Events(botID)
+		list.Limit(100)
+		if !start.IsZero() {
+			list.Start(float64(start.Unix()))
+		}
+		if !end.IsZero() {
+			list.End(float64(end.Unix()))
+		}
+		if cursor != "" {
+			list.Cursor(cursor)
+		}
+		res, err := list.Do()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, res.Items...)
+		if len(res.Items) == 0 || res.Cursor == "" {
+			break
+		}
+		cursor = res.Cursor
+	}
+	return events, nil
+}
+
 func (c *apiClient) ListSkiaTasks(start, end time.Time) ([]*swarming.SwarmingRpcsTaskRequestMetadata, error) {
 	return c.ListTasks(start, end, []string{"pool:Skia"}, "")
 }
@@ -302,6 +302,22 @@ func (_m *MockApiClient) ListTaskResults(start time.Time, end time.Time, tags []
 	return r0, r1
 }
 
+// ListBotEvents provides a mock function with given fields: botID, start, end
+func (_m *MockApiClient) ListBotEvents(botID string, start time.Time, end time.Time) ([]*v1.SwarmingRpcsBotEvent, error) {
+	ret := _m.Called(botID, start, end)
+
+	var r0 []*v1.SwarmingRpcsBotEvent
+	if rf, ok := ret.Get(0).(func(string, time.Time, time.Time) []*v1.SwarmingRpcsBotEvent); ok {
+		r0 = rf(botID, start, end)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*v1.SwarmingRpcsBotEvent)
+		}
+	}
+
+	return r0, ret.Error(1)
+}
+
 // ListBotTasks provides a mock function with given fields: botID, limit
 func (_m *MockApiClient) ListBotTasks(botID string, limit int) ([]*v1.SwarmingRpcsTaskResult, error) {
 	ret := _m.Called(botID, limit)
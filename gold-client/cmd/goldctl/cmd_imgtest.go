@@ -309,28 +309,7 @@ func (i *imgTest) runImgTestAddCmd(cmd *cobra.Command, args []string) {
 		ifErrLogExit(cmd, err)
 	}
 
-	extraKeys := map[string]string{}
-	if i.testKeysFile != "" {
-		j, err := ioutil.ReadFile(i.testKeysFile)
-		if err != nil {
-			logErrf(cmd, "Could not read --add-test-key-file: does it exist? %s", err)
-			exitProcess(cmd, 1)
-		}
-		if err = json.Unmarshal(j, &extraKeys); err != nil {
-			logErrf(cmd, "--add-test-key-file was not a readable JSON object %s", err)
-			exitProcess(cmd, 1)
-		}
-	} else {
-		for _, pair := range i.testKeysStrings {
-			split := strings.SplitN(pair, ":", 2)
-			if len(split) != 2 {
-				logInfof(cmd, "Ignoring malformatted --add-test-key=%s", pair)
-			} else {
-				extraKeys[split[0]] = split[1]
-			}
-		}
-	}
-
+	extraKeys := getTestKeys(cmd, i.testKeysFile, i.testKeysStrings)
 	if i.corpus != "" {
 		extraKeys[types.CORPUS_FIELD] = i.corpus
 	}
@@ -368,6 +347,33 @@ func (i *imgTest) runImgTestFinalizeCmd(cmd *cobra.Command, args []string) {
 	exitProcess(cmd, 0)
 }
 
+// getTestKeys returns the keys that apply to a single test, either read from the JSON file
+// testKeysFile or parsed from key:value pairs. It exits the process if the file cannot be read.
+func getTestKeys(cmd *cobra.Command, testKeysFile string, testKeysStrings []string) map[string]string {
+	extraKeys := map[string]string{}
+	if testKeysFile != "" {
+		j, err := ioutil.ReadFile(testKeysFile)
+		if err != nil {
+			logErrf(cmd, "Could not read --add-test-key-file: does it exist? %s", err)
+			exitProcess(cmd, 1)
+		}
+		if err = json.Unmarshal(j, &extraKeys); err != nil {
+			logErrf(cmd, "--add-test-key-file was not a readable JSON object %s", err)
+			exitProcess(cmd, 1)
+		}
+	} else {
+		for _, pair := range testKeysStrings {
+			split := strings.SplitN(pair, ":", 2)
+			if len(split) != 2 {
+				logInfof(cmd, "Ignoring malformatted --add-test-key=%s", pair)
+			} else {
+				extraKeys[split[0]] = split[1]
+			}
+		}
+	}
+	return extraKeys
+}
+
 // readKeysFile is a helper function to read a JSON file with key/value pairs.
 func readKeysFile(keysFile string) (map[string]string, error) {
 	reader, err := os.Open(keysFile)
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"go.skia.org/infra/gold-client/go/goldclient"
+	"go.skia.org/infra/golden/go/jsonio"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// localEnv is the state for the local command and its sub-commands.
+type localEnv struct {
+	workDir        string
+	baselineFile   string
+	imagesDir      string
+	outDir         string
+	keysFile       string
+	corpus         string
+	commitHash     string
+	failureFile    string
+	passFailStep   bool
+	updateBaseline bool
+
+	testName        string
+	pngFile         string
+	testKeysFile    string
+	testKeysStrings []string
+}
+
+// getLocalCmd returns the definition of the local command.
+func getLocalCmd() *cobra.Command {
+	env := &localEnv{}
+
+	localCmd := &cobra.Command{
+		Use:   "local",
+		Short: "Compare test images against a local baseline",
+		Long: `
+Works like imgtest, but without a Gold instance. Expectations are read from a local baseline
+file (in the format served by Gold's baseline endpoint) and nothing is uploaded. Diff images
+and a JSON/HTML report are written to an output directory. No authentication is needed.`,
+	}
+
+	localInitCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize a local testing environment",
+		Long: `
+Start a local testing session during which tests are added. This reads the baseline and the
+keys shared by all tests that are added via 'add'.`,
+		Run: env.runLocalInitCmd,
+	}
+	localInitCmd.Flags().StringVar(&env.workDir, fstrWorkDir, "", "Work directory for intermediate results")
+	localInitCmd.Flags().StringVar(&env.baselineFile, "baseline-file", "", "JSON file containing the baseline to compare against")
+	localInitCmd.Flags().StringVar(&env.imagesDir, "images-dir", "", "Directory containing the images of known digests as <digest>.png. Defaults to a directory in the work directory.")
+	localInitCmd.Flags().StringVar(&env.outDir, "out-dir", "", "Directory that will contain the report and diff images")
+	localInitCmd.Flags().StringVar(&env.keysFile, "keys-file", "", "JSON file containing key/value pairs commmon to all tests")
+	localInitCmd.Flags().StringVar(&env.corpus, "corpus", "", "Gold Corpus Name. Overrides any value from keys-file")
+	localInitCmd.Flags().StringVar(&env.commitHash, "commit", "", "Git commit hash, if any. Only used for reporting.")
+	localInitCmd.Flags().StringVar(&env.failureFile, "failure-file", "", "Path to the file where to write failure information")
+	localInitCmd.Flags().BoolVar(&env.passFailStep, "passfail", false, "Whether the 'add' call returns a pass/fail for each test.")
+	localInitCmd.Flags().BoolVar(&env.updateBaseline, "update-baseline", false, "Whether 'finalize' writes an updated baseline containing the added images which passed.")
+	Must(localInitCmd.MarkFlagRequired(fstrWorkDir))
+	Must(localInitCmd.MarkFlagRequired("baseline-file"))
+	Must(localInitCmd.MarkFlagRequired("out-dir"))
+	Must(localInitCmd.MarkFlagRequired("keys-file"))
+
+	localAddCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Compares a test image against the local baseline",
+		Long: `
+Add an image generated by a test. The image is compared against the baseline and, if it is not
+positive, diffed against the closest positive image of the same test.`,
+		Run:  env.runLocalAddCmd,
+		Args: cobra.NoArgs,
+	}
+	localAddCmd.Flags().StringVar(&env.workDir, fstrWorkDir, "", "Work directory for intermediate results")
+	localAddCmd.Flags().StringVar(&env.testName, "test-name", "", "Unique name of the test, must not contain spaces.")
+	localAddCmd.Flags().StringVar(&env.pngFile, "png-file", "", "Path to the PNG file that contains the test results.")
+	localAddCmd.Flags().StringVar(&env.corpus, "corpus", "", "Gold Corpus Name. Overrides any other values (e.g. from keys-file or add-test-key)")
+	localAddCmd.Flags().StringVar(&env.testKeysFile, "add-test-key-file", "", "A JSON file containing keys and values that should be applied to this test only.")
+	localAddCmd.Flags().StringSliceVar(&env.testKeysStrings, "add-test-key", []string{}, "Any amount of key:value paris that will be added to this test only.")
+	Must(localAddCmd.MarkFlagRequired(fstrWorkDir))
+	Must(localAddCmd.MarkFlagRequired("test-name"))
+	Must(localAddCmd.MarkFlagRequired("png-file"))
+
+	localFinalizeCmd := &cobra.Command{
+		Use:   "finalize",
+		Short: "Finish adding tests and write the report.",
+		Long: `
+All tests have been added. Write the JSON and HTML report and, if requested during init,
+the updated baseline to the output directory.`,
+		Run: env.runLocalFinalizeCmd,
+	}
+	localFinalizeCmd.Flags().StringVar(&env.workDir, fstrWorkDir, "", "Work directory for intermediate results")
+	Must(localFinalizeCmd.MarkFlagRequired(fstrWorkDir))
+
+	localCmd.AddCommand(
+		localInitCmd,
+		localAddCmd,
+		localFinalizeCmd,
+	)
+	return localCmd
+}
+
+func (l *localEnv) runLocalInitCmd(cmd *cobra.Command, args []string) {
+	keyMap, err := readKeysFile(l.keysFile)
+	ifErrLogExit(cmd, err)
+	if l.corpus != "" {
+		keyMap[types.CORPUS_FIELD] = l.corpus
+	}
+
+	config := goldclient.LocalClientConfig{
+		WorkDir:        l.workDir,
+		BaselineFile:   l.baselineFile,
+		ImagesDir:      l.imagesDir,
+		OutputDir:      l.outDir,
+		PassFailStep:   l.passFailStep,
+		FailureFile:    l.failureFile,
+		UpdateBaseline: l.updateBaseline,
+	}
+	goldClient, err := goldclient.NewLocalClient(config)
+	ifErrLogExit(cmd, err)
+
+	gr := jsonio.GoldResults{
+		GitHash: l.commitHash,
+		Key:     keyMap,
+	}
+	// The commit is optional for local runs, so the shared config is not validated.
+	err = goldClient.SetSharedConfig(gr, true)
+	ifErrLogExit(cmd, err)
+
+	logInfof(cmd, "Directory %s successfully loaded with baseline %s\n", l.workDir, l.baselineFile)
+}
+
+func (l *localEnv) runLocalAddCmd(cmd *cobra.Command, args []string) {
+	goldClient := l.loadClient(cmd)
+
+	extraKeys := getTestKeys(cmd, l.testKeysFile, l.testKeysStrings)
+	if l.corpus != "" {
+		extraKeys[types.CORPUS_FIELD] = l.corpus
+	}
+
+	pass, err := goldClient.Test(types.TestName(l.testName), l.pngFile, extraKeys)
+	ifErrLogExit(cmd, err)
+
+	if !pass {
+		logErrf(cmd, "Test: %s FAIL\n", l.testName)
+		exitProcess(cmd, 1)
+	}
+	logInfof(cmd, "Test: %s PASS\n", l.testName)
+	exitProcess(cmd, 0)
+}
+
+func (l *localEnv) runLocalFinalizeCmd(cmd *cobra.Command, args []string) {
+	goldClient := l.loadClient(cmd)
+
+	err := goldClient.Finalize()
+	ifErrLogExit(cmd, err)
+	exitProcess(cmd, 0)
+}
+
+// loadClient loads the LocalClient from the work directory, exiting if 'local init' was not
+// called first.
+func (l *localEnv) loadClient(cmd *cobra.Command) *goldclient.LocalClient {
+	goldClient, err := goldclient.LoadLocalClient(l.workDir)
+	ifErrLogExit(cmd, err)
+	if goldClient == nil {
+		logErrf(cmd, "No local run found in %s - did you call goldctl local init first?\n", l.workDir)
+		exitProcess(cmd, 1)
+	}
+	return goldClient
+}
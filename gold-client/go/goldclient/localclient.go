@@ -0,0 +1,516 @@
+package goldclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.skia.org/infra/go/fileutil"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/baseline"
+	"go.skia.org/infra/golden/go/diff"
+	"go.skia.org/infra/golden/go/jsonio"
+	"go.skia.org/infra/golden/go/types"
+	"go.skia.org/infra/golden/go/types/expectations"
+)
+
+const (
+	// localStateFile is the name of the file that holds the state of a LocalClient in the work
+	// directory between calls.
+	localStateFile = "local-state.json"
+
+	// localImagesDir is the default directory (relative to the work directory) that holds the
+	// images of known digests.
+	localImagesDir = "images"
+
+	// These files are written to the output directory by LocalClient.Finalize.
+	LocalReportJSONFile      = "report.json"
+	LocalReportHTMLFile      = "report.html"
+	LocalUpdatedBaselineFile = "updated-baseline.json"
+)
+
+// LocalClientConfig configures a LocalClient.
+type LocalClientConfig struct {
+	// WorkDir is a temporary directory that caches data for one run with multiple calls to
+	// LocalClient.
+	WorkDir string
+
+	// BaselineFile is a JSON file in the format served by Gold's baseline endpoint
+	// (i.e. a baseline.Baseline).
+	BaselineFile string
+
+	// ImagesDir contains images of known digests, named <digest>.png. They are used to find
+	// the closest positive image when a test fails. Images of added tests are copied into it.
+	// Defaults to a directory in WorkDir.
+	ImagesDir string
+
+	// OutputDir is where the diff images and the reports are written.
+	OutputDir string
+
+	// PassFailStep indicates whether each call to Test(...) should return a pass/fail value.
+	PassFailStep bool
+
+	// FailureFile is a file on disk that will contain newline-separated descriptions of any
+	// failures. Only written to if PassFailStep is true.
+	FailureFile string
+
+	// UpdateBaseline causes Finalize to write an updated baseline to the output directory, which
+	// contains the digests produced by this run which passed.
+	UpdateBaseline bool
+}
+
+// LocalResult is the outcome of comparing one image against the local baseline.
+type LocalResult struct {
+	Test   types.TestName    `json:"test"`
+	Digest types.Digest      `json:"digest"`
+	Keys   map[string]string `json:"keys"`
+	Label  string            `json:"label"`
+	Pass   bool              `json:"pass"`
+	// Image is the path of the image, relative to the output directory.
+	Image string `json:"image"`
+
+	// The following fields are only set for failing tests which have a positive image that
+	// could be compared against. Paths are relative to the output directory.
+	ClosestDigest types.Digest      `json:"closest_digest,omitempty"`
+	ClosestImage  string            `json:"closest_image,omitempty"`
+	DiffImage     string            `json:"diff_image,omitempty"`
+	DiffMetrics   *diff.DiffMetrics `json:"diff_metrics,omitempty"`
+}
+
+// LocalReport summarizes a local run. It is written as JSON and HTML by Finalize.
+type LocalReport struct {
+	BaselineFile string            `json:"baseline_file"`
+	Key          map[string]string `json:"key"`
+	Passed       int               `json:"passed"`
+	Failed       int               `json:"failed"`
+	Results      []LocalResult     `json:"results"`
+}
+
+// localState is the state of a LocalClient that is cached in the work directory.
+type localState struct {
+	Config       LocalClientConfig
+	SharedConfig *jsonio.GoldResults
+	Expectations expectations.Baseline
+	Results      []LocalResult
+}
+
+// LocalClient implements the GoldClient interface without a Gold instance or GCS. The
+// expectations are read from a baseline file and the results are written to a local output
+// directory.
+type LocalClient struct {
+	workDir string
+	state   *localState
+
+	// overwritable by tests
+	loadAndHashImage func(path string) ([]byte, types.Digest, error)
+}
+
+// NewLocalClient returns a LocalClient which reads the expectations from the baseline file
+// given in config. Like CloudClient, its state is cached in the work directory, so it can be
+// restored with LoadLocalClient.
+func NewLocalClient(config LocalClientConfig) (*LocalClient, error) {
+	if config.WorkDir == "" {
+		return nil, skerr.Fmt("no 'workDir' provided to NewLocalClient")
+	}
+	if config.BaselineFile == "" || config.OutputDir == "" {
+		return nil, skerr.Fmt("a baseline file and an output directory must be provided")
+	}
+	workDir, err := fileutil.EnsureDirExists(config.WorkDir)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "setting up workdir %q", config.WorkDir)
+	}
+	config.WorkDir = workDir
+	if config.ImagesDir == "" {
+		config.ImagesDir = filepath.Join(workDir, localImagesDir)
+	}
+	for _, dir := range []string{config.ImagesDir, config.OutputDir} {
+		if _, err := fileutil.EnsureDirExists(dir); err != nil {
+			return nil, skerr.Wrapf(err, "creating directory %q", dir)
+		}
+	}
+
+	var b baseline.Baseline
+	if ok, err := loadJSONFile(config.BaselineFile, &b); err != nil {
+		return nil, skerr.Wrapf(err, "reading baseline file %s", config.BaselineFile)
+	} else if !ok {
+		return nil, skerr.Fmt("baseline file %s does not exist", config.BaselineFile)
+	}
+	if b.Expectations == nil {
+		b.Expectations = expectations.Baseline{}
+	}
+
+	if config.FailureFile != "" {
+		if err := ioutil.WriteFile(config.FailureFile, nil, 0644); err != nil {
+			return nil, skerr.Wrapf(err, "making failure file %s", config.FailureFile)
+		}
+	}
+
+	ret := &LocalClient{
+		workDir: workDir,
+		state: &localState{
+			Config:       config,
+			Expectations: b.Expectations,
+		},
+		loadAndHashImage: loadAndHashImage,
+	}
+	if err := ret.save(); err != nil {
+		return nil, skerr.Wrapf(err, "writing the state to disk")
+	}
+	return ret, nil
+}
+
+// LoadLocalClient returns a LocalClient that has previously been stored to disk in the given
+// work directory. It returns nil, nil if the work directory was not set up for a LocalClient.
+func LoadLocalClient(workDir string) (*LocalClient, error) {
+	if workDir == "" {
+		return nil, skerr.Fmt("no 'workDir' provided to LoadLocalClient")
+	}
+	state := &localState{}
+	if ok, err := loadJSONFile(filepath.Join(workDir, localStateFile), state); err != nil {
+		return nil, skerr.Wrapf(err, "loading state from disk")
+	} else if !ok {
+		return nil, nil
+	}
+	return &LocalClient{
+		workDir:          workDir,
+		state:            state,
+		loadAndHashImage: loadAndHashImage,
+	}, nil
+}
+
+// SetSharedConfig implements the GoldClient interface.
+func (c *LocalClient) SetSharedConfig(sharedConfig jsonio.GoldResults, skipValidation bool) error {
+	if !skipValidation {
+		if err := sharedConfig.Validate(true); err != nil {
+			return skerr.Wrapf(err, "invalid configuration")
+		}
+	}
+	c.state.SharedConfig = &sharedConfig
+	return c.save()
+}
+
+// Test implements the GoldClient interface. The image is compared against the local baseline;
+// if it is not positive, it is diffed against the closest positive image of the same test.
+func (c *LocalClient) Test(name types.TestName, imgFileName string, additionalKeys map[string]string) (bool, error) {
+	imgBytes, imgHash, err := c.loadAndHashImage(imgFileName)
+	if err != nil {
+		return false, skerr.Wrap(err)
+	}
+
+	res := LocalResult{
+		Test:   name,
+		Digest: imgHash,
+		Keys:   map[string]string{types.PRIMARY_KEY_FIELD: string(name)},
+		Label:  c.state.Expectations[name][imgHash].String(),
+		Pass:   c.state.Expectations[name][imgHash] == expectations.Positive,
+		Image:  string(imgHash) + ".png",
+	}
+	if c.state.SharedConfig != nil {
+		for k, v := range c.state.SharedConfig.Key {
+			res.Keys[k] = v
+		}
+	}
+	for k, v := range additionalKeys {
+		res.Keys[k] = v
+	}
+
+	if err := c.writeImage(imgHash, imgBytes); err != nil {
+		return false, skerr.Wrap(err)
+	}
+	fmt.Printf("Given image with hash %s for test %s (%s)\n", imgHash, name, res.Label)
+
+	if !res.Pass {
+		img, err := png.Decode(bytes.NewReader(imgBytes))
+		if err != nil {
+			return false, skerr.Wrapf(err, "decoding %s", imgFileName)
+		}
+		closest, err := c.closestPositive(name, img)
+		if err != nil {
+			return false, skerr.Wrap(err)
+		}
+		if closest != nil {
+			res.ClosestDigest = closest.digest
+			res.ClosestImage = string(closest.digest) + ".png"
+			res.DiffImage = fmt.Sprintf("diff-%s-%s.png", imgHash, closest.digest)
+			res.DiffMetrics = closest.metrics
+			if err := c.writeDiff(filepath.Join(c.state.Config.OutputDir, res.DiffImage), closest, res.ClosestImage); err != nil {
+				return false, skerr.Wrap(err)
+			}
+		}
+	}
+	c.state.Results = append(c.state.Results, res)
+
+	ret := true
+	if c.state.Config.PassFailStep {
+		ret = res.Pass
+		if !ret && c.state.Config.FailureFile != "" {
+			line := fmt.Sprintf("%s: %s image %s\n", name, res.Label, filepath.Join(c.state.Config.OutputDir, res.Image))
+			if err := appendToFile(c.state.Config.FailureFile, line); err != nil {
+				return false, skerr.Wrap(err)
+			}
+		}
+	}
+	return ret, c.save()
+}
+
+// Check implements the GoldClient interface.
+func (c *LocalClient) Check(name types.TestName, imgFileName string) (bool, error) {
+	_, imgHash, err := c.loadAndHashImage(imgFileName)
+	if err != nil {
+		return false, skerr.Wrap(err)
+	}
+	fmt.Printf("Given image with hash %s for test %s\n", imgHash, name)
+	return c.state.Expectations[name][imgHash] == expectations.Positive, nil
+}
+
+// Diff implements the GoldClient interface. It compares the image against the images of the
+// positive digests of the given test that are available locally. The corpus is ignored, since
+// the baseline is not split by corpus.
+func (c *LocalClient) Diff(_ context.Context, name types.TestName, _, imgFileName, outDir string) error {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return skerr.Wrapf(err, "creating outdir %s", outDir)
+	}
+	b, inputDigest, err := c.loadAndHashImage(imgFileName)
+	if err != nil {
+		return skerr.Wrapf(err, "reading input %s", imgFileName)
+	}
+	origFilePath := filepath.Join(outDir, fmt.Sprintf("input-%s.png", inputDigest))
+	if err := ioutil.WriteFile(origFilePath, b, 0644); err != nil {
+		return skerr.Wrapf(err, "writing to %s", origFilePath)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return skerr.Wrapf(err, "reading %s as png", origFilePath)
+	}
+	closest, err := c.closestPositive(name, img)
+	if err != nil {
+		return skerr.Wrap(err)
+	}
+	if closest == nil {
+		fmt.Printf("No positive images are available locally for test %s\n", name)
+		return nil
+	}
+	return c.writeDiff(filepath.Join(outDir, "diff.png"), closest, fmt.Sprintf("closest-%s.png", closest.digest))
+}
+
+// Finalize implements the GoldClient interface. It writes the JSON and HTML reports and, if
+// configured, the updated baseline to the output directory.
+func (c *LocalClient) Finalize() error {
+	r := c.Report()
+	out := c.state.Config.OutputDir
+	if err := saveJSONFile(filepath.Join(out, LocalReportJSONFile), r); err != nil {
+		return skerr.Wrapf(err, "writing JSON report")
+	}
+	if err := writeHTMLReport(filepath.Join(out, LocalReportHTMLFile), r); err != nil {
+		return skerr.Wrapf(err, "writing HTML report")
+	}
+	fmt.Printf("%d tests passed, %d failed. Report written to %s\n", r.Passed, r.Failed, out)
+
+	if c.state.Config.UpdateBaseline {
+		b := baseline.Baseline{
+			Expectations: c.UpdatedBaseline(),
+		}
+		md5, err := util.MD5Sum(b.Expectations)
+		if err != nil {
+			return skerr.Wrapf(err, "hashing baseline")
+		}
+		b.MD5 = md5
+		p := filepath.Join(out, LocalUpdatedBaselineFile)
+		if err := saveJSONFile(p, b); err != nil {
+			return skerr.Wrapf(err, "writing updated baseline")
+		}
+		fmt.Printf("Updated baseline written to %s\n", p)
+	}
+	return nil
+}
+
+// Report returns a summary of all results added so far, failures first.
+func (c *LocalClient) Report() LocalReport {
+	r := LocalReport{
+		BaselineFile: c.state.Config.BaselineFile,
+		Results:      append([]LocalResult{}, c.state.Results...),
+	}
+	if c.state.SharedConfig != nil {
+		r.Key = c.state.SharedConfig.Key
+	}
+	for _, res := range r.Results {
+		if res.Pass {
+			r.Passed++
+		} else {
+			r.Failed++
+		}
+	}
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		if r.Results[i].Pass != r.Results[j].Pass {
+			return !r.Results[i].Pass
+		}
+		return r.Results[i].Test < r.Results[j].Test
+	})
+	return r
+}
+
+// UpdatedBaseline returns a baseline with the digests produced by this run which passed, ie.
+// those which are positive in the local baseline. Digests which were not produced by this run, or
+// which did not pass, are omitted.
+func (c *LocalClient) UpdatedBaseline() expectations.Baseline {
+	ret := expectations.Baseline{}
+	for _, res := range c.state.Results {
+		if !res.Pass {
+			continue
+		}
+		if ret[res.Test] == nil {
+			ret[res.Test] = map[types.Digest]expectations.Label{}
+		}
+		ret[res.Test][res.Digest] = expectations.Positive
+	}
+	return ret
+}
+
+// closestImage is the result of comparing an image against a known image.
+type closestImage struct {
+	digest   types.Digest
+	encoded  []byte
+	metrics  *diff.DiffMetrics
+	combined float32
+	diffImg  image.Image
+}
+
+// closestPositive returns the positive image of the given test that is closest to img, using
+// the combined diff metric. It returns nil if no positive image is available locally.
+func (c *LocalClient) closestPositive(name types.TestName, img image.Image) (*closestImage, error) {
+	var ret *closestImage
+	for d, label := range c.state.Expectations[name] {
+		if label != expectations.Positive {
+			continue
+		}
+		p := filepath.Join(c.state.Config.ImagesDir, string(d)+".png")
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, skerr.Wrapf(err, "reading %s", p)
+		}
+		right, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			return nil, skerr.Wrapf(err, "invalid PNG for digest %s at %s", d, p)
+		}
+		dm, diffImg := diff.PixelDiff(img, right)
+		cdm := diff.CombinedDiffMetric(dm, nil, nil)
+		if ret == nil || cdm < ret.combined || (cdm == ret.combined && d < ret.digest) {
+			ret = &closestImage{
+				digest:   d,
+				encoded:  b,
+				metrics:  dm,
+				combined: cdm,
+				diffImg:  diffImg,
+			}
+		}
+	}
+	return ret, nil
+}
+
+// writeImage stores the given image in the images directory and the output directory.
+func (c *LocalClient) writeImage(d types.Digest, b []byte) error {
+	for _, dir := range []string{c.state.Config.ImagesDir, c.state.Config.OutputDir} {
+		p := filepath.Join(dir, string(d)+".png")
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			return skerr.Wrapf(err, "writing image to %s", p)
+		}
+	}
+	return nil
+}
+
+// writeDiff writes the diff image to diffPath and the closest image to closestName in the
+// same directory.
+func (c *LocalClient) writeDiff(diffPath string, closest *closestImage, closestName string) error {
+	o := filepath.Join(filepath.Dir(diffPath), closestName)
+	if err := ioutil.WriteFile(o, closest.encoded, 0644); err != nil {
+		return skerr.Wrapf(err, "writing closest image to %s", o)
+	}
+	f, err := os.Create(diffPath)
+	if err != nil {
+		return skerr.Wrapf(err, "opening %s for writing", diffPath)
+	}
+	if err := png.Encode(f, closest.diffImg); err != nil {
+		util.Close(f)
+		return skerr.Wrapf(err, "encoding diff image")
+	}
+	return skerr.Wrap(f.Close())
+}
+
+// save writes the state to the work directory.
+func (c *LocalClient) save() error {
+	return saveJSONFile(filepath.Join(c.workDir, localStateFile), c.state)
+}
+
+// appendToFile appends the given line to the file, creating it if necessary.
+func appendToFile(fileName, line string) error {
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return skerr.Wrapf(err, "opening %s", fileName)
+	}
+	if _, err := f.WriteString(line); err != nil {
+		util.Close(f)
+		return skerr.Wrapf(err, "writing to %s", fileName)
+	}
+	return skerr.Wrap(f.Close())
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Gold local report</title>
+  <style>
+    body { font-family: sans-serif; }
+    table { border-collapse: collapse; }
+    td, th { border: 1px solid #ccc; padding: 4px; vertical-align: top; }
+    img { max-width: 256px; max-height: 256px; }
+    .fail { color: #c00; }
+    .pass { color: #080; }
+  </style>
+</head>
+<body>
+  <h1>Gold local report</h1>
+  <p>Baseline: {{.BaselineFile}}</p>
+  <p>{{.Passed}} passed, {{.Failed}} failed</p>
+  <table>
+    <tr><th>Test</th><th>Result</th><th>Image</th><th>Closest positive</th><th>Diff</th></tr>
+    {{range .Results}}
+    <tr>
+      <td>{{.Test}}<br><small>{{range $k, $v := .Keys}}{{$k}}={{$v}}<br>{{end}}</small></td>
+      <td class="{{if .Pass}}pass{{else}}fail{{end}}">{{if .Pass}}PASS{{else}}FAIL{{end}} ({{.Label}})</td>
+      <td><a href="{{.Image}}"><img src="{{.Image}}"></a><br><small>{{.Digest}}</small></td>
+      <td>{{if .ClosestImage}}<a href="{{.ClosestImage}}"><img src="{{.ClosestImage}}"></a><br><small>{{.ClosestDigest}}</small>{{end}}</td>
+      <td>{{if .DiffImage}}<a href="{{.DiffImage}}"><img src="{{.DiffImage}}"></a>{{end}}
+        {{with .DiffMetrics}}<br><small>{{.NumDiffPixels}} pixels ({{.PixelDiffPercent}}%), max RGBA {{.MaxRGBADiffs}}</small>{{end}}</td>
+    </tr>
+    {{end}}
+  </table>
+</body>
+</html>
+`))
+
+// writeHTMLReport renders the report as a self-contained HTML page. Images are referenced
+// relative to the page.
+func writeHTMLReport(fileName string, r LocalReport) error {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, r); err != nil {
+		return skerr.Wrap(err)
+	}
+	return skerr.Wrap(ioutil.WriteFile(fileName, buf.Bytes(), 0644))
+}
+
+// Make sure LocalClient fulfills the GoldClient interface
+var _ GoldClient = (*LocalClient)(nil)
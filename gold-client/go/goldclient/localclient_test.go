@@ -0,0 +1,138 @@
+package goldclient
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/golden/go/baseline"
+	"go.skia.org/infra/golden/go/jsonio"
+	"go.skia.org/infra/golden/go/types"
+	"go.skia.org/infra/golden/go/types/expectations"
+)
+
+// TestLocalClientSunnyDay runs init, add and finalize against a local baseline and makes sure
+// the diffs, the reports and the updated baseline are written.
+func TestLocalClientSunnyDay(t *testing.T) {
+	unittest.MediumTest(t)
+
+	const passingTest = types.TestName("passing_test")
+	const failingTest = types.TestName("failing_test")
+
+	wd, cleanup := testutils.TempDir(t)
+	defer cleanup()
+	outDir := filepath.Join(wd, "out")
+	imagesDir := filepath.Join(wd, "known")
+	require.NoError(t, os.MkdirAll(imagesDir, 0755))
+
+	img1Path := writePNG(t, wd, "img1.png", image1)
+	img2Path := writePNG(t, wd, "img2.png", image2)
+	_, hash1, err := loadAndHashImage(img1Path)
+	require.NoError(t, err)
+	_, hash2, err := loadAndHashImage(img2Path)
+	require.NoError(t, err)
+	// The known positive image for failing_test is image2.
+	writePNG(t, imagesDir, string(hash2)+".png", image2)
+
+	baselineFile := filepath.Join(wd, "baseline.json")
+	require.NoError(t, saveJSONFile(baselineFile, baseline.Baseline{
+		Expectations: expectations.Baseline{
+			passingTest: {hash1: expectations.Positive},
+			failingTest: {hash2: expectations.Positive},
+		},
+	}))
+
+	c, err := NewLocalClient(LocalClientConfig{
+		WorkDir:        filepath.Join(wd, "work"),
+		BaselineFile:   baselineFile,
+		ImagesDir:      imagesDir,
+		OutputDir:      outDir,
+		PassFailStep:   true,
+		UpdateBaseline: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.SetSharedConfig(jsonio.GoldResults{
+		Key: map[string]string{"os": "Linux"},
+	}, true))
+
+	pass, err := c.Test(passingTest, img1Path, nil)
+	require.NoError(t, err)
+	assert.True(t, pass)
+
+	// Make sure the state survives between calls.
+	c, err = LoadLocalClient(filepath.Join(wd, "work"))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+
+	pass, err = c.Test(failingTest, img1Path, map[string]string{"gpu": "none"})
+	require.NoError(t, err)
+	assert.False(t, pass)
+
+	require.NoError(t, c.Finalize())
+
+	var r LocalReport
+	ok, err := loadJSONFile(filepath.Join(outDir, LocalReportJSONFile), &r)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, 1, r.Passed)
+	assert.Equal(t, 1, r.Failed)
+	require.Len(t, r.Results, 2)
+	failed := r.Results[0]
+	assert.Equal(t, failingTest, failed.Test)
+	assert.Equal(t, hash1, failed.Digest)
+	assert.Equal(t, "untriaged", failed.Label)
+	assert.Equal(t, map[string]string{
+		types.PRIMARY_KEY_FIELD: string(failingTest),
+		"os":                    "Linux",
+		"gpu":                   "none",
+	}, failed.Keys)
+	assert.Equal(t, hash2, failed.ClosestDigest)
+	require.NotNil(t, failed.DiffMetrics)
+	assert.Equal(t, passingTest, r.Results[1].Test)
+	assert.True(t, r.Results[1].Pass)
+
+	diffImg, err := openNRGBAFromFile(filepath.Join(outDir, failed.DiffImage))
+	require.NoError(t, err)
+	assert.Equal(t, diff12, diffImg)
+	assert.FileExists(t, filepath.Join(outDir, failed.Image))
+	assert.FileExists(t, filepath.Join(outDir, failed.ClosestImage))
+	assert.FileExists(t, filepath.Join(outDir, LocalReportHTMLFile))
+
+	var b baseline.Baseline
+	ok, err = loadJSONFile(filepath.Join(outDir, LocalUpdatedBaselineFile), &b)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.NotEmpty(t, b.MD5)
+	assert.Equal(t, expectations.Baseline{
+		passingTest: {hash1: expectations.Positive},
+	}, b.Expectations)
+}
+
+// TestLoadLocalClientNotInitialized makes sure a work directory without a local run is
+// reported as such.
+func TestLoadLocalClientNotInitialized(t *testing.T) {
+	unittest.MediumTest(t)
+
+	wd, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	c, err := LoadLocalClient(wd)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+}
+
+func writePNG(t *testing.T, dir, name string, img image.Image) string {
+	p := filepath.Join(dir, name)
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+	return p
+}
@@ -52,9 +52,12 @@ import (
 	"go.skia.org/infra/golden/go/diff"
 	"go.skia.org/infra/golden/go/diffstore"
 	"go.skia.org/infra/golden/go/expstorage/fs_expstore"
+	"go.skia.org/infra/golden/go/flaky"
 	"go.skia.org/infra/golden/go/ignore"
 	"go.skia.org/infra/golden/go/ignore/ds_ignorestore"
 	"go.skia.org/infra/golden/go/indexer"
+	"go.skia.org/infra/golden/go/publisher"
+	"go.skia.org/infra/golden/go/publisher/fs_deliverylog"
 	"go.skia.org/infra/golden/go/search"
 	"go.skia.org/infra/golden/go/shared"
 	"go.skia.org/infra/golden/go/status"
@@ -103,6 +106,8 @@ func main() {
 		eventTopic          = flag.String("event_topic", "", "The pubsub topic to use for distributed events.")
 		forceLogin          = flag.Bool("force_login", true, "Force the user to be authenticated for all requests.")
 		fsNamespace         = flag.String("fs_namespace", "", "Typically the instance id. e.g. 'flutter', 'skia', etc")
+		flakyThreshold      = flag.Int("flaky_threshold", 0, "Number of digest changes within flaky_window after which a trace is considered flaky. Untriaged digests of flaky traces don't count against the status. 0 means disabled.")
+		flakyWindow         = flag.Int("flaky_window", flaky.DefaultWindow, "Number of recent commits used to compute the flakiness of traces.")
 		fsProjectID         = flag.String("fs_project_id", "skia-firestore", "The project with the firestore instance. Datastore and Firestore can't be in the same project.")
 		hang                = flag.Bool("hang", false, "If true, just hang and do nothing.")
 		gerritURL           = flag.String("gerrit_url", gerrit.GERRIT_SKIA_URL, "URL of the Gerrit instance where we retrieve CL metadata.")
@@ -128,6 +133,9 @@ func main() {
 		siteURL             = flag.String("site_url", "https://gold.skia.org", "URL where this app is hosted.")
 		tileFreshness       = flag.Duration("tile_freshness", time.Minute, "How often to re-fetch the tile")
 		traceBTTableID      = flag.String("trace_bt_table", "", "BigTable table ID for the traces.")
+		triagePubSubTopic   = flag.String("triage_pubsub_topic", "", "If set, events about triage and ignore rule changes are published to this PubSub topic in pubsub_project_id.")
+		triageWebhookURL    = flag.String("triage_webhook_url", "", "If set, events about triage and ignore rule changes are POSTed to this URL.")
+		triageWebhookSecret = flag.String("triage_webhook_secret_file", "", "File containing the secret used to sign the requests to triage_webhook_url. Required if triage_webhook_url is set.")
 	)
 	// Parse the options. So we can configure logging.
 	flag.Parse()
@@ -424,6 +432,7 @@ func main() {
 		GCSClient:         gsClient,
 		TileSource:        tileSource,
 		Warmer:            warmer.New(),
+		FlakinessWindow:   *flakyWindow,
 	}
 
 	// Rebuild the index every few minutes.
@@ -439,10 +448,12 @@ func main() {
 	sklog.Infof("Search API created")
 
 	swc := status.StatusWatcherConfig{
-		VCS:               vcs,
-		EventBus:          evt,
-		TileSource:        tileSource,
-		ExpectationsStore: expStore,
+		VCS:                 vcs,
+		EventBus:            evt,
+		TileSource:          tileSource,
+		ExpectationsStore:   expStore,
+		FlakyTraceThreshold: *flakyThreshold,
+		IndexSource:         ixr,
 	}
 
 	statusWatcher, err := status.New(swc)
@@ -451,12 +462,55 @@ func main() {
 	}
 	sklog.Infof("statusWatcher created")
 
+	// Deliveries are logged to Firestore, so that those made by the tryjob ingesters can be
+	// seen here as well.
+	deliveryLog := fs_deliverylog.New(fsClient)
+	if *authoritative {
+		deliveryLog.StartCleanup(ctx, fs_deliverylog.DefaultRetention, time.Hour)
+	}
+	var eventSinks []publisher.Sink
+	if *triageWebhookURL != "" {
+		if *triageWebhookSecret == "" {
+			sklog.Fatalf("--triage_webhook_secret_file is required if --triage_webhook_url is set.")
+		}
+		b, err := ioutil.ReadFile(*triageWebhookSecret)
+		if err != nil {
+			sklog.Fatalf("Could not read webhook secret: %s", err)
+		}
+		sink, err := publisher.NewWebhookSink(httputils.NewTimeoutClient(), *triageWebhookURL, strings.TrimSpace(string(b)))
+		if err != nil {
+			sklog.Fatalf("Could not set up triage webhook: %s", err)
+		}
+		eventSinks = append(eventSinks, sink)
+	}
+	if *triagePubSubTopic != "" {
+		sink, err := publisher.NewPubSubSink(ctx, *pubsubProjectID, *triagePubSubTopic)
+		if err != nil {
+			sklog.Fatalf("Could not set up triage event topic: %s", err)
+		}
+		eventSinks = append(eventSinks, sink)
+	}
+	var eventPublisher publisher.Publisher
+	if len(eventSinks) > 0 {
+		eventPublisher = publisher.New(ctx, publisher.Config{
+			Instance: *fsNamespace,
+			Source:   "frontend",
+			Sinks:    eventSinks,
+			Log:      deliveryLog,
+		})
+		// Changes made to the expectations by this instance (e.g. triaging or undoing a
+		// triage) are published as DigestsTriaged events.
+		publisher.PublishExpectationChanges(evt, eventPublisher)
+	}
+
 	handlers, err := web.NewHandlers(web.HandlersConfig{
 		Baseliner:                        baseliner,
 		ChangeListStore:                  cls,
 		ContinuousIntegrationURLTemplate: *cisURLTemplate,
 		CodeReviewURLTemplate:            *crsURLTemplate,
 		DiffStore:                        diffStore,
+		EventDeliveryLog:                 deliveryLog,
+		EventPublisher:                   eventPublisher,
 		ExpectationsStore:                expStore,
 		GCSClient:                        gsClient,
 		IgnoreStore:                      ignoreStore,
@@ -509,8 +563,10 @@ func main() {
 	jsonRouter.HandleFunc(trim("/json/commits"), handlers.CommitsHandler).Methods("GET")
 	jsonRouter.HandleFunc(trim("/json/details"), handlers.DetailsHandler).Methods("GET")
 	jsonRouter.HandleFunc(trim("/json/diff"), handlers.DiffHandler).Methods("GET")
+	jsonRouter.HandleFunc(trim("/json/events/deliveries"), handlers.EventDeliveriesHandler).Methods("GET")
 	jsonRouter.HandleFunc(trim("/json/export"), handlers.ExportHandler).Methods("GET")
 	jsonRouter.HandleFunc(trim("/json/failure"), handlers.ListFailureHandler).Methods("GET")
+	jsonRouter.HandleFunc(trim("/json/flaky"), handlers.FlakyTracesHandler).Methods("GET")
 	jsonRouter.HandleFunc(trim("/json/failure/clear"), handlers.ClearFailureHandler).Methods("POST")
 	jsonRouter.HandleFunc(trim("/json/gitlog"), handlers.GitLogHandler).Methods("GET")
 	jsonRouter.HandleFunc(trim("/json/list"), handlers.ListTestsHandler).Methods("GET")
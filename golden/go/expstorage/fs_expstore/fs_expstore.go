@@ -87,6 +87,8 @@ type Store struct {
 	client     *ifirestore.Client
 	mode       AccessMode
 	crsAndCLID string // crs+"_"+id. Empty string means master branch.
+	crs        string
+	clID       string
 
 	// eventBus allows this Store to communicate with the outside world when
 	// expectations change.
@@ -174,8 +176,10 @@ func (f *Store) ForChangeList(id, crs string) expstorage.ExpectationsStore {
 	}
 	return &Store{
 		client:     f.client,
-		eventBus:   nil,
+		eventBus:   f.eventBus,
 		crsAndCLID: crs + "_" + id,
+		crs:        crs,
+		clID:       id,
 		mode:       f.mode,
 		cache:      &expectations.Expectations{},
 	}
@@ -434,8 +438,18 @@ func (f *Store) AddChange(ctx context.Context, delta []expstorage.Delta, userID
 	update := map[string]interface{}{
 		committedField: true,
 	}
-	_, err = f.client.Set(ctx, tr, update, 10, maxOperationTime, firestore.MergeAll)
-	return err
+	if _, err = f.client.Set(ctx, tr, update, 10, maxOperationTime, firestore.MergeAll); err != nil {
+		return err
+	}
+	if f.eventBus != nil {
+		f.eventBus.Publish(expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+			CRS:    f.crs,
+			CLID:   f.clID,
+			User:   userID,
+			Deltas: delta,
+		}, false)
+	}
+	return nil
 }
 
 // flatten creates the data for the Documents to be written for a given Expectations delta.
@@ -669,11 +669,52 @@ func TestEventBusAddMaster(t *testing.T) {
 		ExpectationDelta: change2[1],
 		CRSAndCLID:       "",
 	}, /*global=*/ true).Once()
+	// Each change is also announced once within this instance.
+	meb.On("Publish", expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+		User:   userOne,
+		Deltas: change1,
+	}, /*global=*/ false).Once()
+	meb.On("Publish", expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+		User:   userTwo,
+		Deltas: change2,
+	}, /*global=*/ false).Once()
 
 	require.NoError(t, f.AddChange(ctx, change1, userOne))
 	require.NoError(t, f.AddChange(ctx, change2, userTwo))
 }
 
+// TestEventBusAddChangeList makes sure that changes made to a ChangeList are announced within
+// the instance, but don't change the master expectations.
+func TestEventBusAddChangeList(t *testing.T) {
+	unittest.LargeTest(t)
+
+	meb := &mocks.EventBus{}
+	defer meb.AssertExpectations(t)
+
+	c, cleanup := firestore.NewClientForTesting(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	f, err := New(ctx, c, meb, ReadWrite)
+	require.NoError(t, err)
+
+	change := []expstorage.Delta{
+		{
+			Grouping: data.AlphaTest,
+			Digest:   data.AlphaGood1Digest,
+			Label:    expectations.Positive,
+		},
+	}
+	meb.On("Publish", expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+		CRS:    "gerrit",
+		CLID:   "123",
+		User:   userOne,
+		Deltas: change,
+	}, /*global=*/ false).Once()
+
+	require.NoError(t, f.ForChangeList("123", "gerrit").AddChange(ctx, change, userOne))
+}
+
 // TestEventBusUndo tests that eventbus signals are properly sent during Undo.
 func TestEventBusUndo(t *testing.T) {
 	unittest.LargeTest(t)
@@ -707,6 +748,14 @@ func TestEventBusUndo(t *testing.T) {
 		ExpectationDelta: expectedUndo,
 		CRSAndCLID:       "",
 	}, /*global=*/ true).Once()
+	meb.On("Publish", expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+		User:   userOne,
+		Deltas: []expstorage.Delta{change},
+	}, /*global=*/ false).Once()
+	meb.On("Publish", expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+		User:   userOne,
+		Deltas: []expstorage.Delta{expectedUndo},
+	}, /*global=*/ false).Once()
 
 	require.NoError(t, f.AddChange(ctx, []expstorage.Delta{change}, userOne))
 
@@ -16,6 +16,12 @@ const (
 	// EV_EXPSTORAGE_CHANGED is the event emitted when expectations change.
 	// Callback argument: []string with the names of changed tests.
 	EV_EXPSTORAGE_CHANGED = "expstorage:changed"
+
+	// EV_EXPSTORAGE_CHANGE_ADDED is the event emitted within an instance when that instance
+	// adds a change to the expectations, either by triaging or by undoing an earlier change.
+	// Unlike EV_EXPSTORAGE_CHANGED, it is sent once per change and is never distributed.
+	// Callback argument: *EventChangeAdded.
+	EV_EXPSTORAGE_CHANGE_ADDED = "expstorage:change-added"
 )
 
 func init() {
@@ -92,6 +98,15 @@ type EventExpectationChange struct {
 	ExpectationDelta Delta
 }
 
+// EventChangeAdded is the structure that is sent in EV_EXPSTORAGE_CHANGE_ADDED events.
+// CRS and CLID are empty if the change happened on the master branch.
+type EventChangeAdded struct {
+	CRS    string
+	CLID   string
+	User   string
+	Deltas []Delta
+}
+
 // CountMany indicates it is computationally expensive to determine exactly how many
 // items there are.
 var CountMany = math.MaxInt32
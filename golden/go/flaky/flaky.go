@@ -0,0 +1,150 @@
+// Package flaky computes how often the traces of a tile alternate between digests.
+// A trace that keeps producing different digests at subsequent commits is likely
+// flaky, i.e. the test is not deterministic on that configuration.
+package flaky
+
+import (
+	"sort"
+
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/shared"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// DefaultWindow is the number of most recent commits that are considered when
+// no explicit window is provided.
+const DefaultWindow = 20
+
+// TraceFlakiness summarizes how much a single trace changed in the considered window.
+type TraceFlakiness struct {
+	TraceID tiling.TraceID
+	Test    types.TestName
+	Corpus  string
+	Params  map[string]string
+
+	// DataPoints is the number of non-missing digests in the window.
+	DataPoints int
+	// DistinctDigests is the number of different non-missing digests in the window.
+	DistinctDigests int
+	// Transitions is the number of times two consecutive non-missing digests differed.
+	Transitions int
+}
+
+// Detector allows querying the flakiness of traces in a tile.
+// It should be immutable once created and therefore thread-safe.
+type Detector interface {
+	// Window returns the number of commits that were considered.
+	Window() int
+
+	// ByTrace returns the flakiness of every trace that had at least one data point
+	// in the considered window.
+	ByTrace() map[tiling.TraceID]*TraceFlakiness
+
+	// IsFlaky returns true if the given trace had at least minTransitions transitions
+	// in the considered window. It always returns false if minTransitions is not positive.
+	IsFlaky(id tiling.TraceID, minTransitions int) bool
+
+	// FlakyTraces returns all traces with at least minTransitions transitions, sorted by
+	// descending number of transitions (ties are broken by trace id).
+	FlakyTraces(minTransitions int) []*TraceFlakiness
+}
+
+// Flakiness implements Detector.
+type Flakiness struct {
+	window  int
+	byTrace map[tiling.TraceID]*TraceFlakiness
+}
+
+// New computes the flakiness of all traces in the given tile, only looking at the
+// last window commits that have data. If window is not positive, DefaultWindow is used.
+func New(tile *tiling.Tile, window int) *Flakiness {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Flakiness{
+		window:  window,
+		byTrace: calculate(tile, window),
+	}
+}
+
+// Window implements the Detector interface.
+func (f *Flakiness) Window() int {
+	return f.window
+}
+
+// ByTrace implements the Detector interface.
+func (f *Flakiness) ByTrace() map[tiling.TraceID]*TraceFlakiness {
+	return f.byTrace
+}
+
+// IsFlaky implements the Detector interface.
+func (f *Flakiness) IsFlaky(id tiling.TraceID, minTransitions int) bool {
+	if minTransitions <= 0 {
+		return false
+	}
+	tf, ok := f.byTrace[id]
+	return ok && tf.Transitions >= minTransitions
+}
+
+// FlakyTraces implements the Detector interface.
+func (f *Flakiness) FlakyTraces(minTransitions int) []*TraceFlakiness {
+	var rv []*TraceFlakiness
+	for _, tf := range f.byTrace {
+		if tf.Transitions >= minTransitions {
+			rv = append(rv, tf)
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Transitions != rv[j].Transitions {
+			return rv[i].Transitions > rv[j].Transitions
+		}
+		return rv[i].TraceID < rv[j].TraceID
+	})
+	return rv
+}
+
+// calculate computes the flakiness of every trace in the tile.
+func calculate(tile *tiling.Tile, window int) map[tiling.TraceID]*TraceFlakiness {
+	defer shared.NewMetricsTimer("flaky_calculate").Stop()
+	rv := make(map[tiling.TraceID]*TraceFlakiness, len(tile.Traces))
+	end := tile.LastCommitIndex() + 1
+	start := end - window
+	if start < 0 {
+		start = 0
+	}
+	for id, tr := range tile.Traces {
+		gt, ok := tr.(*types.GoldenTrace)
+		if !ok || gt == nil {
+			continue
+		}
+		tf := &TraceFlakiness{
+			TraceID: id,
+			Test:    gt.TestName(),
+			Corpus:  gt.Corpus(),
+			Params:  gt.Keys,
+		}
+		seen := types.DigestSet{}
+		prev := types.MISSING_DIGEST
+		for i := start; i < end && i < len(gt.Digests); i++ {
+			d := gt.Digests[i]
+			if d == types.MISSING_DIGEST {
+				continue
+			}
+			tf.DataPoints++
+			seen[d] = true
+			if prev != types.MISSING_DIGEST && prev != d {
+				tf.Transitions++
+			}
+			prev = d
+		}
+		if tf.DataPoints == 0 {
+			continue
+		}
+		tf.DistinctDigests = len(seen)
+		rv[id] = tf
+	}
+	return rv
+}
+
+// Make sure Flakiness fulfills the Detector interface.
+var _ Detector = (*Flakiness)(nil)
@@ -0,0 +1,144 @@
+package flaky
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/types"
+)
+
+func TestFlakinessNew(t *testing.T) {
+	unittest.SmallTest(t)
+
+	f := New(makeTile(), 0)
+	assert.Equal(t, DefaultWindow, f.Window())
+
+	require.Equal(t, map[tiling.TraceID]*TraceFlakiness{
+		stableTraceID: {
+			TraceID:         stableTraceID,
+			Test:            AlphaTest,
+			Corpus:          "gm",
+			Params:          stableParams(),
+			DataPoints:      5,
+			DistinctDigests: 1,
+			Transitions:     0,
+		},
+		flakyTraceID: {
+			TraceID:         flakyTraceID,
+			Test:            AlphaTest,
+			Corpus:          "gm",
+			Params:          flakyParams(),
+			DataPoints:      5,
+			DistinctDigests: 2,
+			Transitions:     4,
+		},
+		regressedTraceID: {
+			TraceID:    regressedTraceID,
+			Test:       BetaTest,
+			Corpus:     "gm",
+			Params:     regressedParams(),
+			DataPoints: 3,
+			// Missing data is skipped, so this only changed once.
+			DistinctDigests: 2,
+			Transitions:     1,
+		},
+	}, f.ByTrace())
+}
+
+func TestFlakinessWindow(t *testing.T) {
+	unittest.SmallTest(t)
+
+	// Only the last two commits are considered, where the flaky trace changed once
+	// and the regressed trace did not change at all.
+	f := New(makeTile(), 2)
+	assert.Equal(t, 1, f.ByTrace()[flakyTraceID].Transitions)
+	assert.Equal(t, 0, f.ByTrace()[regressedTraceID].Transitions)
+	assert.Equal(t, 1, f.ByTrace()[regressedTraceID].DistinctDigests)
+}
+
+func TestFlakyTraces(t *testing.T) {
+	unittest.SmallTest(t)
+
+	f := New(makeTile(), 0)
+
+	xtf := f.FlakyTraces(1)
+	require.Len(t, xtf, 2)
+	assert.Equal(t, flakyTraceID, xtf[0].TraceID)
+	assert.Equal(t, regressedTraceID, xtf[1].TraceID)
+
+	xtf = f.FlakyTraces(2)
+	require.Len(t, xtf, 1)
+	assert.Equal(t, flakyTraceID, xtf[0].TraceID)
+
+	assert.True(t, f.IsFlaky(flakyTraceID, 4))
+	assert.False(t, f.IsFlaky(flakyTraceID, 5))
+	assert.False(t, f.IsFlaky(stableTraceID, 1))
+	// A non-positive threshold means nothing is considered flaky.
+	assert.False(t, f.IsFlaky(flakyTraceID, 0))
+	assert.False(t, f.IsFlaky("not-a-trace", 1))
+}
+
+const (
+	AlphaTest = types.TestName("test_alpha")
+	BetaTest  = types.TestName("test_beta")
+
+	FirstDigest  = types.Digest("a1")
+	SecondDigest = types.Digest("b2")
+
+	stableTraceID    = tiling.TraceID(",config=565,name=test_alpha,source_type=gm,")
+	flakyTraceID     = tiling.TraceID(",config=8888,name=test_alpha,source_type=gm,")
+	regressedTraceID = tiling.TraceID(",config=8888,name=test_beta,source_type=gm,")
+)
+
+func stableParams() map[string]string {
+	return map[string]string{
+		"config":                "565",
+		types.PRIMARY_KEY_FIELD: string(AlphaTest),
+		types.CORPUS_FIELD:      "gm",
+	}
+}
+
+func flakyParams() map[string]string {
+	return map[string]string{
+		"config":                "8888",
+		types.PRIMARY_KEY_FIELD: string(AlphaTest),
+		types.CORPUS_FIELD:      "gm",
+	}
+}
+
+func regressedParams() map[string]string {
+	return map[string]string{
+		"config":                "8888",
+		types.PRIMARY_KEY_FIELD: string(BetaTest),
+		types.CORPUS_FIELD:      "gm",
+	}
+}
+
+func makeTile() *tiling.Tile {
+	return &tiling.Tile{
+		Commits: []*tiling.Commit{
+			{CommitTime: 1, Hash: "aaa", Author: "a@example.com"},
+			{CommitTime: 2, Hash: "bbb", Author: "a@example.com"},
+			{CommitTime: 3, Hash: "ccc", Author: "a@example.com"},
+			{CommitTime: 4, Hash: "ddd", Author: "a@example.com"},
+			{CommitTime: 5, Hash: "eee", Author: "a@example.com"},
+		},
+		Traces: map[tiling.TraceID]tiling.Trace{
+			stableTraceID: types.NewGoldenTrace(
+				types.DigestSlice{FirstDigest, FirstDigest, FirstDigest, FirstDigest, FirstDigest},
+				stableParams(),
+			),
+			flakyTraceID: types.NewGoldenTrace(
+				types.DigestSlice{FirstDigest, SecondDigest, FirstDigest, SecondDigest, FirstDigest},
+				flakyParams(),
+			),
+			regressedTraceID: types.NewGoldenTrace(
+				types.DigestSlice{FirstDigest, types.MISSING_DIGEST, SecondDigest, types.MISSING_DIGEST, SecondDigest},
+				regressedParams(),
+			),
+		},
+	}
+}
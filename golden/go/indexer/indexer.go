@@ -19,6 +19,7 @@ import (
 	"go.skia.org/infra/golden/go/digest_counter"
 	"go.skia.org/infra/golden/go/digesttools"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/flaky"
 	"go.skia.org/infra/golden/go/paramsets"
 	"go.skia.org/infra/golden/go/pdag"
 	"go.skia.org/infra/golden/go/shared"
@@ -49,6 +50,7 @@ type SearchIndex struct {
 	dCounters         [2]digest_counter.DigestCounter
 	summaries         [2]countsAndBlames
 	paramsetSummaries [2]paramsets.ParamSummary
+	flakiness         [2]flaky.Detector
 	preSliced         map[preSliceGroup][]*types.TracePair
 
 	cpxTile types.ComplexTile
@@ -71,6 +73,7 @@ type countsAndBlames []*summary.TriageStatus
 type searchIndexConfig struct {
 	diffStore         diff.DiffStore
 	expectationsStore expstorage.ExpectationsStore
+	flakinessWindow   int
 	gcsClient         storage.GCSClient
 	warmer            warmer.DiffWarmer
 }
@@ -85,6 +88,7 @@ func newSearchIndex(sic searchIndexConfig, cpxTile types.ComplexTile) *SearchInd
 		dCounters:         [2]digest_counter.DigestCounter{},
 		summaries:         [2]countsAndBlames{},
 		paramsetSummaries: [2]paramsets.ParamSummary{},
+		flakiness:         [2]flaky.Detector{},
 		preSliced:         map[preSliceGroup][]*types.TracePair{},
 		cpxTile:           cpxTile,
 	}
@@ -104,6 +108,9 @@ func SearchIndexForTesting(cpxTile types.ComplexTile, dc [2]digest_counter.Diges
 		blamer:            b,
 		cpxTile:           cpxTile,
 	}
+	if err := calcFlakiness(s); err != nil {
+		return nil, skerr.Wrap(err)
+	}
 	return s, preSliceData(s)
 }
 
@@ -203,6 +210,11 @@ func (idx *SearchIndex) GetParamsetSummaryByTest(is types.IgnoreState) map[types
 	return idx.paramsetSummaries[is].GetByTest()
 }
 
+// Flakiness implements the IndexSearcher interface.
+func (idx *SearchIndex) Flakiness(is types.IgnoreState) flaky.Detector {
+	return idx.flakiness[is]
+}
+
 // GetBlame implements the IndexSearcher interface.
 func (idx *SearchIndex) GetBlame(test types.TestName, digest types.Digest, commits []*tiling.Commit) blame.BlameDistribution {
 	if idx.blamer == nil {
@@ -250,6 +262,10 @@ type IndexerConfig struct {
 	GCSClient         storage.GCSClient
 	TileSource        tilesource.TileSource
 	Warmer            warmer.DiffWarmer
+
+	// FlakinessWindow is the number of recent commits used to compute the flakiness
+	// of traces. If zero, flaky.DefaultWindow is used.
+	FlakinessWindow int
 }
 
 // Indexer is the type that continuously processes data as the underlying
@@ -284,6 +300,9 @@ func New(ic IndexerConfig, interval time.Duration) (*Indexer, error) {
 
 	preSliceNode := root.Child(preSliceData)
 
+	// Flakiness only depends on the tile, just like the DigestCounters.
+	flakinessNode := root.Child(calcFlakiness)
+
 	// Node that triggers blame and writing baselines.
 	// This is used to trigger when expectations change.
 	// We don't need to re-calculate DigestCounts if the
@@ -312,7 +331,7 @@ func New(ic IndexerConfig, interval time.Duration) (*Indexer, error) {
 
 	// Set the result on the Indexer instance, once summaries, parameters and writing
 	// the hash files is done.
-	pdag.NewNodeWithParents(ret.setIndex, summariesNode, paramsNodeInclude, paramsNodeExclude, writeHashes)
+	pdag.NewNodeWithParents(ret.setIndex, summariesNode, paramsNodeInclude, paramsNodeExclude, writeHashes, flakinessNode)
 
 	ret.pipeline = root
 	ret.indexTestsNode = indexTestsNode
@@ -413,6 +432,7 @@ func (ix *Indexer) executePipeline(cpxTile types.ComplexTile) error {
 	sic := searchIndexConfig{
 		diffStore:         ix.DiffStore,
 		expectationsStore: ix.ExpectationsStore,
+		flakinessWindow:   ix.FlakinessWindow,
 		gcsClient:         ix.GCSClient,
 		warmer:            ix.Warmer,
 	}
@@ -447,6 +467,7 @@ func (ix *Indexer) cloneLastIndex() *SearchIndex {
 	sic := searchIndexConfig{
 		diffStore:         ix.DiffStore,
 		expectationsStore: ix.ExpectationsStore,
+		flakinessWindow:   ix.FlakinessWindow,
 		gcsClient:         ix.GCSClient,
 		warmer:            ix.Warmer,
 	}
@@ -456,6 +477,7 @@ func (ix *Indexer) cloneLastIndex() *SearchIndex {
 		cpxTile:           lastIdx.cpxTile,
 		dCounters:         lastIdx.dCounters,         // stay the same even if expectations change.
 		paramsetSummaries: lastIdx.paramsetSummaries, // stay the same even if expectations change.
+		flakiness:         lastIdx.flakiness,         // stay the same even if expectations change.
 		preSliced:         lastIdx.preSliced,         // stay the same even if expectations change.
 
 		summaries: [2]countsAndBlames{
@@ -502,6 +524,16 @@ func calcDigestCountsExclude(state interface{}) error {
 	return nil
 }
 
+// calcFlakiness is the pipeline function to calculate how often each trace changed digests
+// over the most recent commits.
+func calcFlakiness(state interface{}) error {
+	idx := state.(*SearchIndex)
+	for _, is := range types.IgnoreStates {
+		idx.flakiness[is] = flaky.New(idx.cpxTile.GetTile(is), idx.flakinessWindow)
+	}
+	return nil
+}
+
 // preSliceData is the pipeline function to pre-slice our traces. Currently, we pre-slice by
 // corpus name and then by test name because this breaks our traces up into groups of <1000.
 func preSliceData(state interface{}) error {
@@ -127,6 +127,15 @@ func TestIndexerInitialTriggerSunnyDay(t *testing.T) {
 
 	require.Equal(t, publishedSearchIndex, actualIndex)
 
+	// Only the alpha traces changed digests in the tile.
+	flakyTraces := actualIndex.Flakiness(types.IncludeIgnoredTraces).FlakyTraces(1)
+	require.Len(t, flakyTraces, 3)
+	for _, tf := range flakyTraces {
+		assert.Equal(t, data.AlphaTest, tf.Test)
+		assert.Equal(t, 1, tf.Transitions)
+	}
+	assert.Len(t, actualIndex.Flakiness(types.ExcludeIgnoredTraces).FlakyTraces(1), 2)
+
 	// Block until all async calls are finished so the assertExpectations calls
 	// can properly check that their functions were called.
 	wg.Wait()
@@ -6,6 +6,8 @@ import (
 	blame "go.skia.org/infra/golden/go/blame"
 	digest_counter "go.skia.org/infra/golden/go/digest_counter"
 
+	flaky "go.skia.org/infra/golden/go/flaky"
+
 	mock "github.com/stretchr/testify/mock"
 
 	paramtools "go.skia.org/infra/go/paramtools"
@@ -72,6 +74,22 @@ func (_m *IndexSearcher) DigestCountsByTrace(is types.IgnoreState) map[tiling.Tr
 	return r0
 }
 
+// Flakiness provides a mock function with given fields: is
+func (_m *IndexSearcher) Flakiness(is types.IgnoreState) flaky.Detector {
+	ret := _m.Called(is)
+
+	var r0 flaky.Detector
+	if rf, ok := ret.Get(0).(func(types.IgnoreState) flaky.Detector); ok {
+		r0 = rf(is)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(flaky.Detector)
+		}
+	}
+
+	return r0
+}
+
 // GetBlame provides a mock function with given fields: test, digest, commits
 func (_m *IndexSearcher) GetBlame(test types.TestName, digest types.Digest, commits []*tiling.Commit) blame.BlameDistribution {
 	ret := _m.Called(test, digest, commits)
@@ -7,6 +7,7 @@ import (
 	"go.skia.org/infra/go/tiling"
 	"go.skia.org/infra/golden/go/blame"
 	"go.skia.org/infra/golden/go/digest_counter"
+	"go.skia.org/infra/golden/go/flaky"
 	"go.skia.org/infra/golden/go/summary"
 	"go.skia.org/infra/golden/go/types"
 )
@@ -52,6 +53,9 @@ type IndexSearcher interface {
 	// GetParamsetSummaryByTest returns all ParamSetSummaries in this tile grouped by test name.
 	GetParamsetSummaryByTest(is types.IgnoreState) map[types.TestName]map[types.Digest]paramtools.ParamSet
 
+	// Flakiness returns how often the traces changed digests over the most recent commits.
+	Flakiness(is types.IgnoreState) flaky.Detector
+
 	// GetBlame returns the blame computed for the given test/digest.
 	GetBlame(test types.TestName, digest types.Digest, commits []*tiling.Commit) blame.BlameDistribution
 
@@ -4,7 +4,10 @@ import (
 	"context"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 
@@ -17,6 +20,7 @@ import (
 	"go.skia.org/infra/go/sharedconfig"
 	"go.skia.org/infra/go/skerr"
 	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/go/vcsinfo"
 	"go.skia.org/infra/golden/go/clstore"
 	"go.skia.org/infra/golden/go/clstore/fs_clstore"
@@ -26,10 +30,16 @@ import (
 	"go.skia.org/infra/golden/go/continuous_integration"
 	"go.skia.org/infra/golden/go/continuous_integration/buildbucket_cis"
 	"go.skia.org/infra/golden/go/continuous_integration/dummy_cis"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/expstorage/fs_expstore"
 	"go.skia.org/infra/golden/go/jsonio"
+	"go.skia.org/infra/golden/go/publisher"
+	"go.skia.org/infra/golden/go/publisher/fs_deliverylog"
 	"go.skia.org/infra/golden/go/shared"
 	"go.skia.org/infra/golden/go/tjstore"
 	"go.skia.org/infra/golden/go/tjstore/fs_tjstore"
+	"go.skia.org/infra/golden/go/types"
+	"go.skia.org/infra/golden/go/types/expectations"
 )
 
 const (
@@ -44,6 +54,19 @@ const (
 
 	continuousIntegrationSystemParam = "ContinuousIntegrationSystem"
 
+	// If either EventWebhookURL or EventPubSubTopic is set, an event listing the untriaged
+	// digests of a PatchSet is published once its TryJobs have not produced new results for
+	// EventDelay (defaults to defaultEventDelay). EventWebhookSecretFile is required if
+	// EventWebhookURL is set.
+	eventWebhookURLParam        = "EventWebhookURL"
+	eventWebhookSecretFileParam = "EventWebhookSecretFile"
+	eventPubSubTopicParam       = "EventPubSubTopic"
+	eventDelayParam             = "EventDelay"
+
+	defaultEventDelay = 10 * time.Minute
+	// publishedRetention is how long we remember which digests were published for a PatchSet.
+	publishedRetention = 7 * 24 * time.Hour
+
 	gerritCRS      = "gerrit"
 	githubCRS      = "github"
 	buildbucketCIS = "buildbucket"
@@ -63,10 +86,27 @@ type goldTryjobProcessor struct {
 	changeListStore clstore.Store
 	tryJobStore     tjstore.Store
 
+	// eventPublisher and expStore are only set if events about untriaged digests should be sent.
+	eventPublisher publisher.Publisher
+	expStore       expstorage.ExpectationsStore
+	eventDelay     time.Duration
+
+	eventMutex sync.Mutex
+	// pendingEvents maps the PatchSets which got new results to the time of the last ingestion.
+	pendingEvents map[tjstore.CombinedPSID]time.Time
+	// publishedEvents records which untriaged digests were already published for a PatchSet.
+	publishedEvents map[tjstore.CombinedPSID]*publishedDigests
+
 	crsName string
 	cisName string
 }
 
+// publishedDigests are the untriaged digests which were published for a PatchSet.
+type publishedDigests struct {
+	digests map[publisher.UntriagedDigest]bool
+	ts      time.Time
+}
+
 // newModularTryjobProcessor returns an ingestion.Processor which is modular and can support
 // different CodeReviewSystems (e.g. "Gerrit", "GitHub") and different ContinuousIntegrationSystems
 // (e.g. "BuildBucket", "CirrusCI"). This particular implementation stores the data in Firestore.
@@ -101,19 +141,68 @@ func newModularTryjobProcessor(ctx context.Context, _ vcsinfo.VCS, config *share
 		return nil, skerr.Fmt("missing firestore namespace")
 	}
 
+	var sinks []publisher.Sink
+	if u := config.ExtraParams[eventWebhookURLParam]; u != "" {
+		secretFile := config.ExtraParams[eventWebhookSecretFileParam]
+		if strings.TrimSpace(secretFile) == "" {
+			return nil, skerr.Fmt("missing secret file for event webhook %s", u)
+		}
+		b, err := ioutil.ReadFile(secretFile)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "reading webhook secret in %s", secretFile)
+		}
+		wh, err := publisher.NewWebhookSink(httputils.NewTimeoutClient(), u, strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, skerr.Wrapf(err, "could not set up event webhook")
+		}
+		sinks = append(sinks, wh)
+	}
+	if topic := config.ExtraParams[eventPubSubTopicParam]; topic != "" {
+		ps, err := publisher.NewPubSubSink(ctx, fsProjectID, topic)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "could not set up event topic %s", topic)
+		}
+		sinks = append(sinks, ps)
+	}
+
 	fsClient, err := firestore.NewClient(ctx, fsProjectID, "gold", fsNamespace, nil)
 	if err != nil {
 		return nil, skerr.Wrapf(err, "could not init firestore in project %s, namespace %s", fsProjectID, fsNamespace)
 	}
 
-	return &goldTryjobProcessor{
+	gtp := &goldTryjobProcessor{
 		reviewClient:      crs,
 		integrationClient: cis,
 		changeListStore:   fs_clstore.New(fsClient, crsName),
 		tryJobStore:       fs_tjstore.New(fsClient, cisName),
 		crsName:           crsName,
 		cisName:           cisName,
-	}, nil
+	}
+
+	if len(sinks) > 0 {
+		gtp.eventDelay = defaultEventDelay
+		if d := config.ExtraParams[eventDelayParam]; d != "" {
+			gtp.eventDelay, err = time.ParseDuration(d)
+			if err != nil {
+				return nil, skerr.Wrapf(err, "invalid %s %q", eventDelayParam, d)
+			}
+		}
+		gtp.expStore, err = fs_expstore.New(ctx, fsClient, nil, fs_expstore.ReadOnly)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "could not create expectation store")
+		}
+		// The deliveries are logged to Firestore, so that failures can be seen in the frontend.
+		gtp.eventPublisher = publisher.New(ctx, publisher.Config{
+			Instance: fsNamespace,
+			Source:   "ingester",
+			Sinks:    sinks,
+			Log:      fs_deliverylog.New(fsClient),
+		})
+		go util.RepeatCtx(time.Minute, ctx, func(ctx context.Context) {
+			gtp.publishPending(ctx, time.Now())
+		})
+	}
+	return gtp, nil
 }
 
 func codeReviewSystemFactory(crsName string, config *sharedconfig.IngesterConfig, client *http.Client) (code_review.Client, error) {
@@ -256,6 +345,128 @@ func (g *goldTryjobProcessor) Process(ctx context.Context, rf ingestion.ResultFi
 		return skerr.Wrapf(err, "putting %d results for CL %s, PS %d (%s), TJ %s, file %s", len(tjr), clID, psOrder, psID, tjID, rf.Name())
 	}
 
+	if g.eventPublisher != nil {
+		g.markPending(combinedID, time.Now())
+	}
+
+	return nil
+}
+
+// markPending records that the given PatchSet got new results at the given time. An event is
+// published for it by publishPending once no new results have arrived for eventDelay. This way
+// we send one event per PatchSet instead of one per result file.
+func (g *goldTryjobProcessor) markPending(id tjstore.CombinedPSID, ts time.Time) {
+	g.eventMutex.Lock()
+	defer g.eventMutex.Unlock()
+	if g.pendingEvents == nil {
+		g.pendingEvents = map[tjstore.CombinedPSID]time.Time{}
+	}
+	g.pendingEvents[id] = ts
+}
+
+// publishPending publishes events for all PatchSets which have not had new results for
+// eventDelay. PatchSets for which the event could not be created are retried on the next call.
+func (g *goldTryjobProcessor) publishPending(ctx context.Context, now time.Time) {
+	g.eventMutex.Lock()
+	var ready []tjstore.CombinedPSID
+	for id, ts := range g.pendingEvents {
+		if now.Sub(ts) >= g.eventDelay {
+			ready = append(ready, id)
+			delete(g.pendingEvents, id)
+		}
+	}
+	for id, p := range g.publishedEvents {
+		if now.Sub(p.ts) > publishedRetention {
+			delete(g.publishedEvents, id)
+		}
+	}
+	g.eventMutex.Unlock()
+
+	for _, id := range ready {
+		if err := g.publishUntriaged(ctx, id, now); err != nil {
+			sklog.Errorf("Could not publish untriaged digests for CL %s, PS %s; will retry: %s", id.CL, id.PS, err)
+			g.markPending(id, now.Add(-g.eventDelay))
+		}
+	}
+}
+
+// publishUntriaged sends an event listing the digests produced by the TryJobs of the given
+// PatchSet that are neither triaged on the master branch nor on the ChangeList. No event is
+// sent if all digests have been triaged or if all untriaged digests were already published.
+func (g *goldTryjobProcessor) publishUntriaged(ctx context.Context, id tjstore.CombinedPSID, now time.Time) error {
+	results, err := g.tryJobStore.GetResults(ctx, id)
+	if err != nil {
+		return skerr.Wrapf(err, "getting results")
+	}
+	xtj, err := g.tryJobStore.GetTryJobs(ctx, id)
+	if err != nil {
+		return skerr.Wrapf(err, "getting tryjobs")
+	}
+	masterExp, err := g.expStore.Get()
+	if err != nil {
+		return skerr.Wrapf(err, "getting master expectations")
+	}
+	clExp, err := g.expStore.ForChangeList(id.CL, id.CRS).Get()
+	if err != nil {
+		return skerr.Wrapf(err, "getting expectations for CL %s", id.CL)
+	}
+
+	g.eventMutex.Lock()
+	defer g.eventMutex.Unlock()
+	if g.publishedEvents == nil {
+		g.publishedEvents = map[tjstore.CombinedPSID]*publishedDigests{}
+	}
+	published := g.publishedEvents[id]
+	if published == nil {
+		published = &publishedDigests{digests: map[publisher.UntriagedDigest]bool{}}
+	}
+	seen := map[publisher.UntriagedDigest]bool{}
+	var untriaged []publisher.UntriagedDigest
+	hasNew := false
+	for _, r := range results {
+		tn := types.TestName(r.ResultParams[types.PRIMARY_KEY_FIELD])
+		if clExp.Classification(tn, r.Digest) != expectations.Untriaged ||
+			masterExp.Classification(tn, r.Digest) != expectations.Untriaged {
+			continue
+		}
+		ud := publisher.UntriagedDigest{Test: tn, Digest: r.Digest}
+		if !seen[ud] {
+			seen[ud] = true
+			untriaged = append(untriaged, ud)
+			if !published.digests[ud] {
+				hasNew = true
+			}
+		}
+	}
+	if !hasNew {
+		return nil
+	}
+	sort.Slice(untriaged, func(i, j int) bool {
+		if untriaged[i].Test != untriaged[j].Test {
+			return untriaged[i].Test < untriaged[j].Test
+		}
+		return untriaged[i].Digest < untriaged[j].Digest
+	})
+	tjIDs := make([]string, 0, len(xtj))
+	for _, tj := range xtj {
+		tjIDs = append(tjIDs, tj.SystemID)
+	}
+	g.eventPublisher.Publish(publisher.Event{
+		Type: publisher.ChangeListUntriaged,
+		ChangeList: &publisher.ChangeListPayload{
+			CRS:          id.CRS,
+			ChangeListID: id.CL,
+			PatchSetID:   id.PS,
+			CIS:          g.cisName,
+			TryJobIDs:    tjIDs,
+			Untriaged:    untriaged,
+		},
+	})
+	for _, ud := range untriaged {
+		published.digests[ud] = true
+	}
+	published.ts = now
+	g.publishedEvents[id] = published
 	return nil
 }
 
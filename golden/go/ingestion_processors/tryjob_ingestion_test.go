@@ -17,8 +17,12 @@ import (
 	mockcrs "go.skia.org/infra/golden/go/code_review/mocks"
 	ci "go.skia.org/infra/golden/go/continuous_integration"
 	mockcis "go.skia.org/infra/golden/go/continuous_integration/mocks"
+	"go.skia.org/infra/golden/go/mocks"
+	"go.skia.org/infra/golden/go/publisher"
+	mock_publisher "go.skia.org/infra/golden/go/publisher/mocks"
 	"go.skia.org/infra/golden/go/tjstore"
 	mocktjstore "go.skia.org/infra/golden/go/tjstore/mocks"
+	"go.skia.org/infra/golden/go/types/expectations"
 )
 
 const (
@@ -269,6 +273,116 @@ func TestTryJobProcessCLExistsSunnyDay(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestEventWebhookRequiresSecret makes sure we don't send unsigned events.
+func TestEventWebhookRequiresSecret(t *testing.T) {
+	unittest.SmallTest(t)
+
+	config := &sharedconfig.IngesterConfig{
+		ExtraParams: map[string]string{
+			firestoreProjectIDParam: "should-use-emulator",
+			firestoreNamespaceParam: "testing",
+
+			codeReviewSystemParam:      "github",
+			githubRepoParam:            "google/skia",
+			githubCredentialsPathParam: "testdata/fake_token", // this is actually a file on disk.
+
+			continuousIntegrationSystemParam: "cirrus",
+
+			eventWebhookURLParam: "https://example.com/hook",
+		},
+	}
+
+	_, err := newModularTryjobProcessor(context.Background(), nil, config, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing secret file")
+}
+
+// TestTryJobProcessPublishesUntriaged tests that a single event is published for the untriaged
+// digests of a PatchSet once its TryJobs stop producing results, if a publisher is configured.
+func TestTryJobProcessPublishesUntriaged(t *testing.T) {
+	unittest.SmallTest(t)
+
+	mcls := &mockclstore.Store{}
+	mtjs := &mocktjstore.Store{}
+	mcrs := &mockcrs.Client{}
+	mcis := &mockcis.Client{}
+	mes := &mocks.ExpectationsStore{}
+	mclExp := &mocks.ExpectationsStore{}
+	mp := &mock_publisher.Publisher{}
+	defer mcls.AssertExpectations(t)
+	defer mtjs.AssertExpectations(t)
+	defer mcrs.AssertExpectations(t)
+	defer mcis.AssertExpectations(t)
+	defer mes.AssertExpectations(t)
+	defer mclExp.AssertExpectations(t)
+	defer mp.AssertExpectations(t)
+
+	mcls.On("GetChangeList", testutils.AnyContext, sampleCLID).Return(makeChangeList(), nil)
+	xps := makePatchSets()
+	mcls.On("GetPatchSetByOrder", testutils.AnyContext, sampleCLID, samplePSOrder).Return(xps[1], nil)
+
+	mtjs.On("GetTryJob", testutils.AnyContext, sampleTJID).Return(makeTryJob(), nil)
+	mtjs.On("PutResults", testutils.AnyContext, sampleCombinedID, sampleTJID, makeTryJobResults()).Return(nil)
+	mtjs.On("GetResults", testutils.AnyContext, sampleCombinedID).Return(makeTryJobResults(), nil)
+	mtjs.On("GetTryJobs", testutils.AnyContext, sampleCombinedID).Return([]ci.TryJob{makeTryJob()}, nil)
+
+	// The digest is neither triaged on master nor on the CL.
+	mes.On("Get").Return(&expectations.Expectations{}, nil)
+	mes.On("ForChangeList", sampleCLID, "gerrit").Return(mclExp)
+	mclExp.On("Get").Return(&expectations.Expectations{}, nil)
+
+	// Only one event should be published, even though two result files were ingested and
+	// publishPending runs several times.
+	mp.On("Publish", publisher.Event{
+		Type: publisher.ChangeListUntriaged,
+		ChangeList: &publisher.ChangeListPayload{
+			CRS:          "gerrit",
+			ChangeListID: sampleCLID,
+			PatchSetID:   samplePSID,
+			CIS:          "buildbucket",
+			TryJobIDs:    []string{sampleTJID},
+			Untriaged: []publisher.UntriagedDigest{
+				{
+					Test:   "Pixel_CanvasDisplayLinearRGBUnaccelerated2DGPUCompositing",
+					Digest: "690f72c0b56ae014c8ac66e7f25c0779",
+				},
+			},
+		},
+	}).Return().Once()
+
+	gtp := goldTryjobProcessor{
+		reviewClient:      mcrs,
+		integrationClient: mcis,
+		changeListStore:   mcls,
+		tryJobStore:       mtjs,
+		eventPublisher:    mp,
+		expStore:          mes,
+		eventDelay:        time.Minute,
+		crsName:           "gerrit",
+		cisName:           "buildbucket",
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		fsResult, err := ingestion_mocks.MockResultFileLocationFromFile(legacyGoldCtlFile)
+		require.NoError(t, err)
+		require.NoError(t, gtp.Process(ctx, fsResult))
+	}
+
+	// The TryJobs may still produce results, so nothing is published yet.
+	now := time.Now()
+	gtp.publishPending(ctx, now)
+	require.Len(t, gtp.pendingEvents, 1)
+
+	gtp.publishPending(ctx, now.Add(time.Minute))
+	require.Empty(t, gtp.pendingEvents)
+
+	// More results arrive, but they don't contain new untriaged digests.
+	gtp.markPending(sampleCombinedID, now.Add(2*time.Minute))
+	gtp.publishPending(ctx, now.Add(3*time.Minute))
+	require.Empty(t, gtp.pendingEvents)
+}
+
 // TestTryJobProcessPSExistsSunnyDay tests that the ingestion works when the
 // CL and the PS already exists.
 func TestTryJobProcessPSExistsSunnyDay(t *testing.T) {
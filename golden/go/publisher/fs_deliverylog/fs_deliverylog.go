@@ -0,0 +1,165 @@
+// Package fs_deliverylog implements the publisher.DeliveryLog interface with a Firestore
+// backend. This allows the frontend to show the deliveries made by the ingesters.
+package fs_deliverylog
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	ifirestore "go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/publisher"
+)
+
+const (
+	// deliveryCollection is the collection in Firestore.
+	deliveryCollection = "publisher_deliveries"
+
+	// finishedField is the field we query by.
+	finishedField = "finished"
+
+	maxReadAttempts  = 5
+	maxWriteAttempts = 5
+	maxOperationTime = time.Minute
+
+	// DefaultRetention is how long deliveries are kept before they are deleted by StartCleanup.
+	DefaultRetention = 30 * 24 * time.Hour
+)
+
+// LogImpl is the Firestore based implementation of publisher.DeliveryLog.
+type LogImpl struct {
+	client *ifirestore.Client
+}
+
+// New returns a new LogImpl.
+func New(client *ifirestore.Client) *LogImpl {
+	return &LogImpl{client: client}
+}
+
+// deliveryEntry represents how a publisher.Delivery is stored in Firestore.
+type deliveryEntry struct {
+	Source    string    `firestore:"source"`
+	EventID   string    `firestore:"eventid"`
+	EventType string    `firestore:"eventtype"`
+	Sink      string    `firestore:"sink"`
+	Attempts  int       `firestore:"attempts"`
+	Success   bool      `firestore:"success"`
+	Error     string    `firestore:"error"`
+	Finished  time.Time `firestore:"finished"`
+}
+
+// Add implements the publisher.DeliveryLog interface.
+func (l *LogImpl) Add(ctx context.Context, d publisher.Delivery) error {
+	defer metrics2.FuncTimer().Stop()
+	doc := l.client.Collection(deliveryCollection).NewDoc()
+	entry := deliveryEntry{
+		Source:    d.Source,
+		EventID:   d.EventID,
+		EventType: string(d.EventType),
+		Sink:      d.Sink,
+		Attempts:  d.Attempts,
+		Success:   d.Success,
+		Error:     d.Error,
+		Finished:  d.Finished,
+	}
+	if _, err := l.client.Set(ctx, doc, entry, maxWriteAttempts, maxOperationTime); err != nil {
+		return skerr.Wrapf(err, "storing delivery of event %s to %s", d.EventID, d.Sink)
+	}
+	return nil
+}
+
+// Recent implements the publisher.DeliveryLog interface.
+func (l *LogImpl) Recent(ctx context.Context, n int) ([]publisher.Delivery, error) {
+	defer metrics2.FuncTimer().Stop()
+	q := l.client.Collection(deliveryCollection).OrderBy(finishedField, firestore.Desc).Limit(n)
+	rv := []publisher.Delivery{}
+	err := l.client.IterDocs(ctx, "Recent", "", q, maxReadAttempts, maxOperationTime, func(doc *firestore.DocumentSnapshot) error {
+		if doc == nil {
+			return nil
+		}
+		entry := deliveryEntry{}
+		if err := doc.DataTo(&entry); err != nil {
+			return skerr.Wrapf(err, "corrupt data in firestore, could not unmarshal delivery with id %s", doc.Ref.ID)
+		}
+		rv = append(rv, publisher.Delivery{
+			Source:    entry.Source,
+			EventID:   entry.EventID,
+			EventType: publisher.EventType(entry.EventType),
+			Sink:      entry.Sink,
+			Attempts:  entry.Attempts,
+			Success:   entry.Success,
+			Error:     entry.Error,
+			Finished:  entry.Finished,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, skerr.Wrapf(err, "fetching recent deliveries")
+	}
+	return rv, nil
+}
+
+// DeleteOlderThan deletes all deliveries which finished before the given time. It returns the
+// number of deliveries deleted.
+func (l *LogImpl) DeleteOlderThan(ctx context.Context, cutoff time.Time) (int, error) {
+	defer metrics2.FuncTimer().Stop()
+	q := l.client.Collection(deliveryCollection).Where(finishedField, "<", cutoff)
+	var refs []*firestore.DocumentRef
+	err := l.client.IterDocs(ctx, "DeleteOlderThan", cutoff.String(), q, maxReadAttempts, maxOperationTime, func(doc *firestore.DocumentSnapshot) error {
+		if doc == nil {
+			return nil
+		}
+		refs = append(refs, doc.Ref)
+		return nil
+	})
+	if err != nil {
+		return 0, skerr.Wrapf(err, "finding deliveries before %s", cutoff)
+	}
+	deleted := 0
+	for _, chunk := range chunkRefs(refs, ifirestore.MAX_TRANSACTION_DOCS) {
+		b := l.client.Batch()
+		for _, ref := range chunk {
+			b.Delete(ref)
+		}
+		if _, err := b.Commit(ctx); err != nil {
+			return deleted, skerr.Wrapf(err, "deleting %d deliveries", len(chunk))
+		}
+		deleted += len(chunk)
+	}
+	return deleted, nil
+}
+
+// StartCleanup deletes deliveries older than the given retention every period, until the
+// context is cancelled. Only one process needs to do this.
+func (l *LogImpl) StartCleanup(ctx context.Context, retention, period time.Duration) {
+	go util.RepeatCtx(period, ctx, func(ctx context.Context) {
+		n, err := l.DeleteOlderThan(ctx, time.Now().Add(-retention))
+		if err != nil {
+			sklog.Errorf("Could not clean up event deliveries: %s", err)
+			return
+		}
+		if n > 0 {
+			sklog.Infof("Deleted %d event deliveries older than %s", n, retention)
+		}
+	})
+}
+
+// chunkRefs splits the given refs into slices of at most n elements.
+func chunkRefs(refs []*firestore.DocumentRef, n int) [][]*firestore.DocumentRef {
+	var rv [][]*firestore.DocumentRef
+	for len(refs) > n {
+		rv = append(rv, refs[:n])
+		refs = refs[n:]
+	}
+	if len(refs) > 0 {
+		rv = append(rv, refs)
+	}
+	return rv
+}
+
+// Make sure LogImpl fulfills the publisher.DeliveryLog interface.
+var _ publisher.DeliveryLog = (*LogImpl)(nil)
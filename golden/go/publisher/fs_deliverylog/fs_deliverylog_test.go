@@ -0,0 +1,97 @@
+package fs_deliverylog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/golden/go/publisher"
+)
+
+func TestAddRecent(t *testing.T) {
+	unittest.LargeTest(t)
+	c, cleanup := firestore.NewClientForTesting(t)
+	defer cleanup()
+
+	l := New(c)
+	ctx := context.Background()
+
+	xd, err := l.Recent(ctx, 10)
+	require.NoError(t, err)
+	require.Empty(t, xd)
+
+	first := publisher.Delivery{
+		Source:    "ingester",
+		EventID:   "first",
+		EventType: publisher.ChangeListUntriaged,
+		Sink:      "webhook:https://example.com",
+		Attempts:  5,
+		Error:     "status 500",
+		Finished:  time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC),
+	}
+	second := publisher.Delivery{
+		Source:    "frontend",
+		EventID:   "second",
+		EventType: publisher.DigestsTriaged,
+		Sink:      "webhook:https://example.com",
+		Attempts:  1,
+		Success:   true,
+		Finished:  time.Date(2019, time.December, 1, 13, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, l.Add(ctx, first))
+	require.NoError(t, l.Add(ctx, second))
+
+	xd, err = l.Recent(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, []publisher.Delivery{second, first}, xd)
+
+	xd, err = l.Recent(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []publisher.Delivery{second}, xd)
+}
+
+func TestDeleteOlderThan(t *testing.T) {
+	unittest.LargeTest(t)
+	c, cleanup := firestore.NewClientForTesting(t)
+	defer cleanup()
+
+	l := New(c)
+	ctx := context.Background()
+
+	old := publisher.Delivery{
+		Source:    "ingester",
+		EventID:   "old",
+		EventType: publisher.ChangeListUntriaged,
+		Sink:      "webhook:https://example.com",
+		Attempts:  1,
+		Success:   true,
+		Finished:  time.Date(2019, time.November, 1, 12, 0, 0, 0, time.UTC),
+	}
+	recent := publisher.Delivery{
+		Source:    "frontend",
+		EventID:   "recent",
+		EventType: publisher.DigestsTriaged,
+		Sink:      "webhook:https://example.com",
+		Attempts:  1,
+		Success:   true,
+		Finished:  time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, l.Add(ctx, old))
+	require.NoError(t, l.Add(ctx, recent))
+
+	n, err := l.DeleteOlderThan(ctx, time.Date(2019, time.November, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	xd, err := l.Recent(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, []publisher.Delivery{recent}, xd)
+
+	// Nothing else to delete.
+	n, err = l.DeleteOlderThan(ctx, time.Date(2019, time.November, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
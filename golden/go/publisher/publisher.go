@@ -0,0 +1,361 @@
+// Package publisher sends events about triage changes (e.g. digests being triaged or ignore
+// rules changing) to systems outside of Gold, such as webhooks or PubSub topics. The events
+// are serialized as JSON using the stable schema defined by Event.
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.skia.org/infra/go/eventbus"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/ignore"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// SchemaVersion is the version of the JSON schema of Event. It will be incremented if fields
+// are removed or change their meaning; new fields may be added without changing it.
+const SchemaVersion = 1
+
+// EventType identifies what happened.
+type EventType string
+
+const (
+	// DigestsTriaged is sent when a user triages one or more digests, either on the master
+	// branch or on a ChangeList.
+	DigestsTriaged EventType = "digests_triaged"
+	// IgnoreRuleChanged is sent when an ignore rule is created, updated or deleted.
+	IgnoreRuleChanged EventType = "ignore_rule_changed"
+	// ChangeListUntriaged is sent when a TryJob on a ChangeList produced untriaged digests.
+	ChangeListUntriaged EventType = "changelist_untriaged_digests"
+)
+
+// IgnoreRuleAction describes what happened to an ignore rule.
+type IgnoreRuleAction string
+
+const (
+	IgnoreRuleCreated IgnoreRuleAction = "created"
+	IgnoreRuleUpdated IgnoreRuleAction = "updated"
+	IgnoreRuleDeleted IgnoreRuleAction = "deleted"
+)
+
+// Event is the JSON payload that is sent to all sinks. Exactly one of the Triage, IgnoreRule or
+// ChangeList fields is set, depending on the Type.
+type Event struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	Type          EventType `json:"type"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Instance identifies the Gold instance, e.g. "skia" or "flutter".
+	Instance string `json:"instance"`
+
+	Triage     *TriagePayload     `json:"triage,omitempty"`
+	IgnoreRule *IgnoreRulePayload `json:"ignore_rule,omitempty"`
+	ChangeList *ChangeListPayload `json:"changelist,omitempty"`
+}
+
+// TriagedDigest is a single digest that was given a label.
+type TriagedDigest struct {
+	Test   types.TestName `json:"test"`
+	Digest types.Digest   `json:"digest"`
+	Label  string         `json:"label"`
+}
+
+// TriagePayload describes a triage operation.
+type TriagePayload struct {
+	User string `json:"user"`
+	// CRS and ChangeListID are empty if the triage happened on the master branch.
+	CRS          string          `json:"crs,omitempty"`
+	ChangeListID string          `json:"changelist_id,omitempty"`
+	Digests      []TriagedDigest `json:"digests"`
+}
+
+// IgnoreRulePayload describes a change to an ignore rule.
+type IgnoreRulePayload struct {
+	Action  IgnoreRuleAction `json:"action"`
+	User    string           `json:"user"`
+	RuleID  string           `json:"rule_id"`
+	Query   string           `json:"query,omitempty"`
+	Note    string           `json:"note,omitempty"`
+	Expires *time.Time       `json:"expires,omitempty"`
+}
+
+// UntriagedDigest is a digest produced by a TryJob that has no label yet.
+type UntriagedDigest struct {
+	Test   types.TestName `json:"test"`
+	Digest types.Digest   `json:"digest"`
+}
+
+// ChangeListPayload describes the untriaged digests that were produced by the TryJobs of one
+// PatchSet of a ChangeList.
+type ChangeListPayload struct {
+	CRS          string            `json:"crs"`
+	ChangeListID string            `json:"changelist_id"`
+	PatchSetID   string            `json:"patchset_id"`
+	CIS          string            `json:"cis"`
+	TryJobIDs    []string          `json:"tryjob_ids"`
+	Untriaged    []UntriagedDigest `json:"untriaged"`
+}
+
+// TriageEvent returns an Event for the given triage operation. crs and clID should be empty if
+// the triage happened on the master branch.
+func TriageEvent(user, crs, clID string, deltas []expstorage.Delta) Event {
+	p := &TriagePayload{
+		User:         user,
+		CRS:          crs,
+		ChangeListID: clID,
+	}
+	for _, d := range deltas {
+		p.Digests = append(p.Digests, TriagedDigest{
+			Test:   d.Grouping,
+			Digest: d.Digest,
+			Label:  d.Label.String(),
+		})
+	}
+	return Event{Type: DigestsTriaged, Triage: p}
+}
+
+// PublishExpectationChanges publishes a DigestsTriaged event to the given Publisher for every
+// change to the expectations which is added by this instance, including undoing a change.
+func PublishExpectationChanges(evt eventbus.EventBus, p Publisher) {
+	evt.SubscribeAsync(expstorage.EV_EXPSTORAGE_CHANGE_ADDED, func(e interface{}) {
+		c := e.(*expstorage.EventChangeAdded)
+		p.Publish(TriageEvent(c.User, c.CRS, c.CLID, c.Deltas))
+	})
+}
+
+// IgnoreRuleEvent returns an Event for the given change to an ignore rule. For deleted rules,
+// only the ID of the rule needs to be set.
+func IgnoreRuleEvent(action IgnoreRuleAction, user string, rule ignore.Rule) Event {
+	p := &IgnoreRulePayload{
+		Action: action,
+		User:   user,
+		RuleID: rule.ID,
+		Query:  rule.Query,
+		Note:   rule.Note,
+	}
+	if !rule.Expires.IsZero() {
+		exp := rule.Expires.UTC()
+		p.Expires = &exp
+	}
+	return Event{Type: IgnoreRuleChanged, IgnoreRule: p}
+}
+
+// Publisher sends events to outside systems.
+type Publisher interface {
+	// Publish queues the event for delivery to all configured sinks. It does not block on the
+	// delivery; failed deliveries are retried in the background. The schema version, id,
+	// timestamp and instance of the event are filled in by Publish.
+	Publish(e Event)
+
+	// Deliveries returns the most recent delivery attempts, newest first. If a DeliveryLog is
+	// configured, this includes the deliveries made by other processes sharing that log.
+	Deliveries(ctx context.Context) ([]Delivery, error)
+}
+
+// DeliveryLog persists delivery records, so that deliveries made by one process (e.g. the
+// tryjob ingester) can be inspected through another (e.g. the frontend).
+type DeliveryLog interface {
+	// Add records the given delivery.
+	Add(ctx context.Context, d Delivery) error
+	// Recent returns up to n of the most recent deliveries, newest first.
+	Recent(ctx context.Context, n int) ([]Delivery, error)
+}
+
+// Delivery records the outcome of sending one event to one sink.
+type Delivery struct {
+	// Source identifies the process which made the delivery, e.g. "frontend" or "ingester".
+	Source    string    `json:"source"`
+	EventID   string    `json:"event_id"`
+	EventType EventType `json:"event_type"`
+	Sink      string    `json:"sink"`
+	Attempts  int       `json:"attempts"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Config configures an Impl.
+type Config struct {
+	// Instance identifies the Gold instance in the sent events.
+	Instance string
+	// Source identifies this process in the delivery records.
+	Source string
+	Sinks  []Sink
+	// Log, if set, persists the delivery records. Otherwise they are only kept in memory.
+	Log DeliveryLog
+
+	// MaxAttempts is the number of times a delivery to one sink is tried before giving up.
+	// Defaults to 5.
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry; it doubles with every retry.
+	// Defaults to one second.
+	RetryDelay time.Duration
+	// DeliveryLogSize is the number of delivery records that are kept. Defaults to 500.
+	DeliveryLogSize int
+	// QueueSize is the number of events that can wait for delivery. If the queue is full,
+	// events are dropped (and logged). Defaults to 1000.
+	QueueSize int
+}
+
+const (
+	defaultMaxAttempts     = 5
+	defaultRetryDelay      = time.Second
+	defaultDeliveryLogSize = 500
+	defaultQueueSize       = 1000
+)
+
+// Impl implements the Publisher interface. Events are delivered in order by a single
+// background goroutine.
+type Impl struct {
+	cfg   Config
+	queue chan queuedEvent
+
+	mutex      sync.Mutex
+	deliveries []Delivery
+
+	droppedCounter metrics2.Counter
+	failedCounter  metrics2.Counter
+}
+
+type queuedEvent struct {
+	id   string
+	kind EventType
+	data []byte
+}
+
+// New returns a Publisher which delivers events to the given sinks until ctx is canceled.
+func New(ctx context.Context, cfg Config) *Impl {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	if cfg.DeliveryLogSize <= 0 {
+		cfg.DeliveryLogSize = defaultDeliveryLogSize
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	p := &Impl{
+		cfg:            cfg,
+		queue:          make(chan queuedEvent, cfg.QueueSize),
+		droppedCounter: metrics2.GetCounter("gold_publisher_dropped_events", nil),
+		failedCounter:  metrics2.GetCounter("gold_publisher_failed_deliveries", nil),
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-p.queue:
+				p.deliver(ctx, e)
+			}
+		}
+	}()
+	return p
+}
+
+// Publish implements the Publisher interface.
+func (p *Impl) Publish(e Event) {
+	e.SchemaVersion = SchemaVersion
+	e.ID = uuid.New().String()
+	e.Timestamp = time.Now().UTC()
+	e.Instance = p.cfg.Instance
+	data, err := json.Marshal(e)
+	if err != nil {
+		// Should never happen.
+		sklog.Errorf("Could not serialize event %#v: %s", e, err)
+		return
+	}
+	select {
+	case p.queue <- queuedEvent{id: e.ID, kind: e.Type, data: data}:
+	default:
+		p.droppedCounter.Inc(1)
+		sklog.Errorf("Event queue full; dropping %s event %s", e.Type, e.ID)
+	}
+}
+
+// deliver sends the event to every sink, retrying each one with an exponential backoff.
+func (p *Impl) deliver(ctx context.Context, e queuedEvent) {
+	for _, s := range p.cfg.Sinks {
+		d := Delivery{
+			Source:    p.cfg.Source,
+			EventID:   e.id,
+			EventType: e.kind,
+			Sink:      s.Name(),
+		}
+		delay := p.cfg.RetryDelay
+		var err error
+	RetryLoop:
+		for {
+			d.Attempts++
+			if err = s.Send(ctx, e.data); err == nil {
+				break
+			}
+			sklog.Warningf("Attempt %d to deliver event %s to %s failed: %s", d.Attempts, e.id, d.Sink, err)
+			if d.Attempts >= p.cfg.MaxAttempts {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				err = skerr.Wrapf(ctx.Err(), "giving up after %d attempts", d.Attempts)
+				break RetryLoop
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		d.Success = err == nil
+		if err != nil {
+			d.Error = err.Error()
+			p.failedCounter.Inc(1)
+			sklog.Errorf("Could not deliver event %s to %s: %s", e.id, d.Sink, err)
+		}
+		d.Finished = time.Now()
+		p.record(ctx, d)
+	}
+}
+
+// record adds the delivery to the delivery log, evicting the oldest entry if necessary. If a
+// DeliveryLog is configured, the delivery is persisted there as well.
+func (p *Impl) record(ctx context.Context, d Delivery) {
+	if p.cfg.Log != nil {
+		if err := p.cfg.Log.Add(ctx, d); err != nil {
+			sklog.Errorf("Could not persist delivery of event %s to %s: %s", d.EventID, d.Sink, err)
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deliveries = append(p.deliveries, d)
+	if len(p.deliveries) > p.cfg.DeliveryLogSize {
+		p.deliveries = p.deliveries[len(p.deliveries)-p.cfg.DeliveryLogSize:]
+	}
+}
+
+// Deliveries implements the Publisher interface.
+func (p *Impl) Deliveries(ctx context.Context) ([]Delivery, error) {
+	if p.cfg.Log != nil {
+		rv, err := p.cfg.Log.Recent(ctx, p.cfg.DeliveryLogSize)
+		if err != nil {
+			return nil, skerr.Wrapf(err, "reading delivery log")
+		}
+		return rv, nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	rv := make([]Delivery, 0, len(p.deliveries))
+	for i := len(p.deliveries) - 1; i >= 0; i-- {
+		rv = append(rv, p.deliveries[i])
+	}
+	return rv, nil
+}
+
+// Make sure Impl fulfills the Publisher interface.
+var _ Publisher = (*Impl)(nil)
@@ -0,0 +1,248 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/eventbus"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types/expectations"
+)
+
+// TestPublishWebhookRetries makes sure an event is retried until the webhook accepts it and
+// that the delivered payload follows the schema.
+func TestPublishWebhookRetries(t *testing.T) {
+	unittest.SmallTest(t)
+
+	var mutex sync.Mutex
+	calls := 0
+	var received []byte
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+		if calls < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		received = b
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := New(ctx, Config{
+		Instance:    "testing",
+		Sinks:       []Sink{newWebhookSink(t, srv.URL, "s3cret")},
+		MaxAttempts: 5,
+		RetryDelay:  time.Millisecond,
+	})
+
+	p.Publish(TriageEvent("user@example.com", "", "", []expstorage.Delta{
+		{Grouping: "some_test", Digest: "abcd", Label: expectations.Positive},
+	}))
+
+	require.Eventually(t, func() bool {
+		return len(deliveries(t, p)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	d := deliveries(t, p)[0]
+	assert.True(t, d.Success)
+	assert.Equal(t, 3, d.Attempts)
+	assert.Equal(t, DigestsTriaged, d.EventType)
+	assert.Empty(t, d.Error)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, Sign([]byte("s3cret"), received), signature)
+	var e Event
+	require.NoError(t, json.Unmarshal(received, &e))
+	assert.Equal(t, SchemaVersion, e.SchemaVersion)
+	assert.Equal(t, d.EventID, e.ID)
+	assert.Equal(t, "testing", e.Instance)
+	assert.Nil(t, e.IgnoreRule)
+	assert.Nil(t, e.ChangeList)
+	assert.Equal(t, &TriagePayload{
+		User: "user@example.com",
+		Digests: []TriagedDigest{
+			{Test: "some_test", Digest: "abcd", Label: "positive"},
+		},
+	}, e.Triage)
+}
+
+// TestPublishGivesUp makes sure failed deliveries are recorded after MaxAttempts.
+func TestPublishGivesUp(t *testing.T) {
+	unittest.SmallTest(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := New(ctx, Config{
+		Source:      "ingester",
+		Sinks:       []Sink{newWebhookSink(t, srv.URL, "s3cret")},
+		MaxAttempts: 2,
+		RetryDelay:  time.Millisecond,
+	})
+
+	p.Publish(Event{
+		Type: IgnoreRuleChanged,
+		IgnoreRule: &IgnoreRulePayload{
+			Action: IgnoreRuleDeleted,
+			User:   "user@example.com",
+			RuleID: "12345",
+		},
+	})
+
+	require.Eventually(t, func() bool {
+		return len(deliveries(t, p)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	d := deliveries(t, p)[0]
+	assert.False(t, d.Success)
+	assert.Equal(t, 2, d.Attempts)
+	assert.Equal(t, IgnoreRuleChanged, d.EventType)
+	assert.Equal(t, "ingester", d.Source)
+	assert.Contains(t, d.Error, "status 500")
+}
+
+// TestDeliveryLogSize makes sure the delivery log is bounded and returned newest first.
+func TestDeliveryLogSize(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	p := &Impl{cfg: Config{DeliveryLogSize: 2}}
+	p.record(ctx, Delivery{EventID: "one"})
+	p.record(ctx, Delivery{EventID: "two"})
+	p.record(ctx, Delivery{EventID: "three"})
+
+	assert.Equal(t, []Delivery{{EventID: "three"}, {EventID: "two"}}, deliveries(t, p))
+}
+
+// TestDeliveriesFromLog makes sure deliveries are persisted to and read from the configured
+// DeliveryLog, so that deliveries made by other processes show up too.
+func TestDeliveriesFromLog(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	log := &memoryLog{}
+	require.NoError(t, log.Add(ctx, Delivery{Source: "ingester", EventID: "other"}))
+	p := &Impl{cfg: Config{DeliveryLogSize: 10, Log: log}}
+	p.record(ctx, Delivery{Source: "frontend", EventID: "mine"})
+
+	assert.Equal(t, []Delivery{
+		{Source: "frontend", EventID: "mine"},
+		{Source: "ingester", EventID: "other"},
+	}, deliveries(t, p))
+}
+
+// TestWebhookRequiresSecret makes sure unsigned webhooks cannot be configured.
+func TestWebhookRequiresSecret(t *testing.T) {
+	unittest.SmallTest(t)
+
+	_, err := NewWebhookSink(httputils.NewTimeoutClient(), "https://example.com/hook", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "secret is required")
+}
+
+func newWebhookSink(t *testing.T, url, secret string) Sink {
+	s, err := NewWebhookSink(httputils.NewTimeoutClient(), url, secret)
+	require.NoError(t, err)
+	return s
+}
+
+func deliveries(t *testing.T, p *Impl) []Delivery {
+	rv, err := p.Deliveries(context.Background())
+	require.NoError(t, err)
+	return rv
+}
+
+// memoryLog is a DeliveryLog which keeps the deliveries in memory.
+type memoryLog struct {
+	deliveries []Delivery
+}
+
+func (m *memoryLog) Add(_ context.Context, d Delivery) error {
+	m.deliveries = append(m.deliveries, d)
+	return nil
+}
+
+func (m *memoryLog) Recent(_ context.Context, n int) ([]Delivery, error) {
+	var rv []Delivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(rv) < n; i-- {
+		rv = append(rv, m.deliveries[i])
+	}
+	return rv, nil
+}
+
+// chanPublisher is a Publisher which sends all published events to a channel.
+type chanPublisher chan Event
+
+func (c chanPublisher) Publish(e Event) {
+	c <- e
+}
+
+func (c chanPublisher) Deliveries(context.Context) ([]Delivery, error) {
+	return nil, nil
+}
+
+// TestPublishExpectationChanges makes sure that changes added to the expectations, e.g. by
+// undoing an earlier triage, are published as DigestsTriaged events.
+func TestPublishExpectationChanges(t *testing.T) {
+	unittest.SmallTest(t)
+
+	evt := eventbus.New()
+	p := make(chanPublisher, 1)
+	PublishExpectationChanges(evt, p)
+
+	evt.Publish(expstorage.EV_EXPSTORAGE_CHANGE_ADDED, &expstorage.EventChangeAdded{
+		CRS:  "gerrit",
+		CLID: "1234",
+		User: "user@example.com",
+		Deltas: []expstorage.Delta{
+			{
+				Grouping: "some_test",
+				Digest:   "abcd",
+				Label:    expectations.Untriaged,
+			},
+		},
+	}, false)
+
+	select {
+	case e := <-p:
+		require.Equal(t, Event{
+			Type: DigestsTriaged,
+			Triage: &TriagePayload{
+				User:         "user@example.com",
+				CRS:          "gerrit",
+				ChangeListID: "1234",
+				Digests: []TriagedDigest{
+					{
+						Test:   "some_test",
+						Digest: "abcd",
+						Label:  expectations.Untriaged.String(),
+					},
+				},
+			},
+		}, e)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Timed out waiting for the event to be published.")
+	}
+}
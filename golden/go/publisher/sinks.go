@@ -0,0 +1,119 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"cloud.google.com/go/pubsub"
+	"go.skia.org/infra/go/skerr"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// SignatureHeader is the HTTP header which contains the hex-encoded HMAC-SHA256 of the
+	// request body, signed with the secret of the webhook.
+	SignatureHeader = "X-Gold-Signature"
+)
+
+// Sink is a destination for serialized events.
+type Sink interface {
+	// Name returns a human readable name for the delivery log.
+	Name() string
+	// Send delivers the given JSON-encoded event. It returns an error if the delivery should be
+	// retried.
+	Send(ctx context.Context, data []byte) error
+}
+
+// webhookSink POSTs events to a URL.
+type webhookSink struct {
+	client *http.Client
+	url    string
+	secret []byte
+}
+
+// NewWebhookSink returns a Sink which POSTs every event as JSON to the given URL. The body is
+// signed with the given secret (see SignatureHeader), so that receivers can verify that the
+// event came from Gold; the secret must not be empty.
+func NewWebhookSink(client *http.Client, url, secret string) (Sink, error) {
+	if secret == "" {
+		return nil, skerr.Fmt("a secret is required for webhook %s", url)
+	}
+	return &webhookSink{
+		client: client,
+		url:    url,
+		secret: []byte(secret),
+	}, nil
+}
+
+// Name implements the Sink interface.
+func (w *webhookSink) Name() string {
+	return "webhook:" + w.url
+}
+
+// Send implements the Sink interface.
+func (w *webhookSink) Send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return skerr.Wrapf(err, "creating request to %s", w.url)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.secret, data))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return skerr.Wrapf(err, "posting to %s", w.url)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return skerr.Fmt("webhook %s responded with status %d", w.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of data using the given secret.
+func Sign(secret, data []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pubSubSink publishes events to a PubSub topic.
+type pubSubSink struct {
+	topic *pubsub.Topic
+}
+
+// NewPubSubSink returns a Sink which publishes every event to the given topic, creating the
+// topic if it does not exist.
+func NewPubSubSink(ctx context.Context, projectID, topic string) (Sink, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, skerr.Wrapf(err, "creating pubsub client for project %s", projectID)
+	}
+	t := client.Topic(topic)
+	if exists, err := t.Exists(ctx); err != nil {
+		return nil, skerr.Wrapf(err, "checking whether topic %s exists", topic)
+	} else if !exists {
+		if t, err = client.CreateTopic(ctx, topic); err != nil {
+			return nil, skerr.Wrapf(err, "creating topic %s", topic)
+		}
+	}
+	return &pubSubSink{topic: t}, nil
+}
+
+// Name implements the Sink interface.
+func (p *pubSubSink) Name() string {
+	return "pubsub:" + p.topic.String()
+}
+
+// Send implements the Sink interface.
+func (p *pubSubSink) Send(ctx context.Context, data []byte) error {
+	res := p.topic.Publish(ctx, &pubsub.Message{
+		Data: data,
+	})
+	_, err := res.Get(ctx)
+	return skerr.Wrap(err)
+}
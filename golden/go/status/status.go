@@ -12,6 +12,8 @@ import (
 	"go.skia.org/infra/go/tiling"
 	"go.skia.org/infra/go/vcsinfo"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/flaky"
+	"go.skia.org/infra/golden/go/indexer"
 	"go.skia.org/infra/golden/go/shared"
 	"go.skia.org/infra/golden/go/tilesource"
 	"go.skia.org/infra/golden/go/types"
@@ -23,6 +25,8 @@ const (
 	METRIC_TOTAL  = "gold_status_total_digests"
 	METRIC_ALL    = "gold_status_all"
 	METRIC_CORPUS = "gold_status_by_corpus"
+
+	METRIC_FLAKY_UNTRIAGED = "gold_status_flaky_untriaged_by_corpus"
 )
 
 // GUIStatus reflects the current rebaseline status. In particular whether
@@ -59,6 +63,10 @@ type GUICorpusStatus struct {
 
 	// Number of negative digests in HEAD.
 	NegativeCount int `json:"negativeCount"`
+
+	// Number of untriaged digests in HEAD that were produced by flaky traces. These are
+	// not included in UntriagedCount.
+	FlakyUntriagedCount int `json:"flakyUntriagedCount"`
 }
 
 type CorpusStatusSorter []*GUICorpusStatus
@@ -73,6 +81,15 @@ type StatusWatcherConfig struct {
 	ExpectationsStore expstorage.ExpectationsStore
 	TileSource        tilesource.TileSource
 	VCS               vcsinfo.VCS
+
+	// FlakyTraceThreshold is the number of transitions between digests (see the flaky package)
+	// at which a trace is considered flaky. Untriaged digests at HEAD of flaky traces are
+	// reported separately and do not make a corpus (or the overall status) not OK, so they
+	// don't trigger alerts. If zero, no trace is considered flaky.
+	FlakyTraceThreshold int
+	// IndexSource provides the flakiness of traces, which is computed by the indexer. If nil,
+	// no trace is considered flaky.
+	IndexSource indexer.IndexSource
 }
 
 type StatusWatcher struct {
@@ -88,6 +105,9 @@ type StatusWatcher struct {
 
 	// Gauges to track counts of digests by corpus / label
 	corpusGauges map[string]map[expectations.Label]metrics2.Int64Metric
+
+	// Gauges to track counts of untriaged digests produced by flaky traces by corpus.
+	flakyCorpusGauges map[string]metrics2.Int64Metric
 }
 
 func New(swc StatusWatcherConfig) (*StatusWatcher, error) {
@@ -98,6 +118,7 @@ func New(swc StatusWatcherConfig) (*StatusWatcher, error) {
 		allNegativeGauge:    metrics2.GetInt64Metric(METRIC_ALL, map[string]string{"type": expectations.Negative.String()}),
 		totalGauge:          metrics2.GetInt64Metric(METRIC_TOTAL, nil),
 		corpusGauges:        map[string]map[expectations.Label]metrics2.Int64Metric{},
+		flakyCorpusGauges:   map[string]metrics2.Int64Metric{},
 	}
 
 	if err := ret.calcAndWatchStatus(); err != nil {
@@ -210,6 +231,8 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 
 	// Gathers unique labels by corpus and label.
 	byCorpus := map[string]map[expectations.Label]map[string]bool{}
+	// Gathers unique untriaged digests from flaky traces by corpus.
+	flakyByCorpus := map[string]map[string]bool{}
 
 	// Iterate over the current traces
 	dataTile := cpxTile.GetTile(types.ExcludeIgnoredTraces)
@@ -217,8 +240,14 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 		sklog.Warningf("Empty tile, doing nothing")
 		return nil
 	}
+	var flakes flaky.Detector
+	if s.FlakyTraceThreshold > 0 && s.IndexSource != nil {
+		if idx := s.IndexSource.GetIndex(); idx != nil {
+			flakes = idx.Flakiness(types.ExcludeIgnoredTraces)
+		}
+	}
 	tileLen := dataTile.LastCommitIndex() + 1
-	for _, trace := range dataTile.Traces {
+	for id, trace := range dataTile.Traces {
 		gTrace := trace.(*types.GoldenTrace)
 
 		idx := tileLen - 1
@@ -240,6 +269,7 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 				expectations.Negative:  {},
 				expectations.Untriaged: {},
 			}
+			flakyByCorpus[corpus] = map[string]bool{}
 
 			if _, ok := s.corpusGauges[corpus]; !ok {
 				s.corpusGauges[corpus] = map[expectations.Label]metrics2.Int64Metric{
@@ -247,6 +277,7 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 					expectations.Positive:  metrics2.GetInt64Metric(METRIC_CORPUS, map[string]string{"type": expectations.Positive.String(), "corpus": corpus}),
 					expectations.Negative:  metrics2.GetInt64Metric(METRIC_CORPUS, map[string]string{"type": expectations.Negative.String(), "corpus": corpus}),
 				}
+				s.flakyCorpusGauges[corpus] = metrics2.GetInt64Metric(METRIC_FLAKY_UNTRIAGED, map[string]string{"corpus": corpus})
 			}
 		}
 
@@ -254,6 +285,10 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 		digest := gTrace.Digests[idx]
 		testName := gTrace.TestName()
 		status := exp.Classification(testName, digest)
+		if status == expectations.Untriaged && flakes != nil && flakes.IsFlaky(id, s.FlakyTraceThreshold) {
+			flakyByCorpus[corpus][string(testName)+string(digest)] = true
+			continue
+		}
 
 		okByCorpus[corpus] = okByCorpus[corpus] &&
 			((status == expectations.Positive) || (status == expectations.Negative))
@@ -270,11 +305,17 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 		untriagedCount := len(byCorpus[corpus][expectations.Untriaged])
 		positiveCount := len(byCorpus[corpus][expectations.Positive])
 		negativeCount := len(byCorpus[corpus][expectations.Negative])
+		// A digest that is untriaged on a non-flaky trace is not suppressed.
+		for key := range byCorpus[corpus][expectations.Untriaged] {
+			delete(flakyByCorpus[corpus], key)
+		}
+		flakyUntriagedCount := len(flakyByCorpus[corpus])
 		corpStatus = append(corpStatus, &GUICorpusStatus{
-			Name:           corpus,
-			OK:             okByCorpus[corpus],
-			UntriagedCount: untriagedCount,
-			NegativeCount:  negativeCount,
+			Name:                corpus,
+			OK:                  okByCorpus[corpus],
+			UntriagedCount:      untriagedCount,
+			NegativeCount:       negativeCount,
+			FlakyUntriagedCount: flakyUntriagedCount,
 		})
 		allUntriagedCount += untriagedCount
 		allNegativeCount += negativeCount
@@ -283,6 +324,7 @@ func (s *StatusWatcher) calcStatus(cpxTile types.ComplexTile) error {
 		s.corpusGauges[corpus][expectations.Positive].Update(int64(positiveCount))
 		s.corpusGauges[corpus][expectations.Negative].Update(int64(negativeCount))
 		s.corpusGauges[corpus][expectations.Untriaged].Update(int64(untriagedCount))
+		s.flakyCorpusGauges[corpus].Update(int64(flakyUntriagedCount))
 	}
 	s.allUntriagedGauge.Update(int64(allUntriagedCount))
 	s.allPositiveGauge.Update(int64(allPositiveCount))
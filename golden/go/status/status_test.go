@@ -11,6 +11,8 @@ import (
 	mock_eventbus "go.skia.org/infra/go/eventbus/mocks"
 	"go.skia.org/infra/go/testutils/unittest"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/flaky"
+	mock_indexer "go.skia.org/infra/golden/go/indexer/mocks"
 	"go.skia.org/infra/golden/go/mocks"
 	data "go.skia.org/infra/golden/go/testutils/data_three_devices"
 	"go.skia.org/infra/golden/go/types"
@@ -137,3 +139,65 @@ func TestStatusWatcherEventBus(t *testing.T) {
 	}, 2*time.Second, 100*time.Millisecond)
 
 }
+
+// TestStatusWatcherFlakyTraces tests that untriaged digests produced by flaky traces are
+// reported separately and do not count against the status.
+func TestStatusWatcherFlakyTraces(t *testing.T) {
+	unittest.SmallTest(t)
+
+	meb := &mock_eventbus.EventBus{}
+	mes := &mocks.ExpectationsStore{}
+	mts := &mocks.TileSource{}
+	mis := &mock_indexer.IndexSource{}
+	mi := &mock_indexer.IndexSearcher{}
+	defer meb.AssertExpectations(t)
+	defer mes.AssertExpectations(t)
+	defer mts.AssertExpectations(t)
+	defer mis.AssertExpectations(t)
+	defer mi.AssertExpectations(t)
+
+	cpxTile := types.NewComplexTile(data.MakeTestTile())
+	cpxTile.SetSparse(data.MakeTestCommits())
+	mts.On("GetTile").Return(cpxTile)
+
+	mes.On("Get").Return(data.MakeTestExpectations(), nil)
+
+	meb.On("SubscribeAsync", expstorage.EV_EXPSTORAGE_CHANGED, mock.Anything)
+
+	// The flakiness is computed by the indexer.
+	mis.On("GetIndex").Return(mi)
+	mi.On("Flakiness", types.ExcludeIgnoredTraces).Return(flaky.New(cpxTile.GetTile(types.ExcludeIgnoredTraces), flaky.DefaultWindow))
+
+	swc := StatusWatcherConfig{
+		EventBus:          meb,
+		ExpectationsStore: mes,
+		TileSource:        mts,
+		IndexSource:       mis,
+		// The bullhead alpha trace changed digests once, so with this threshold its untriaged
+		// digest is considered flaky. The crosshatch beta trace only has one data point.
+		FlakyTraceThreshold: 1,
+	}
+
+	watcher, err := New(swc)
+	require.NoError(t, err)
+
+	commits := data.MakeTestCommits()
+
+	status := watcher.GetStatus()
+	require.Equal(t, &GUIStatus{
+		OK:            false,
+		FirstCommit:   commits[0],
+		LastCommit:    commits[2],
+		TotalCommits:  3,
+		FilledCommits: 3,
+		CorpStatus: []*GUICorpusStatus{
+			{
+				Name:                "gm",
+				OK:                  false,
+				UntriagedCount:      1,
+				NegativeCount:       0,
+				FlakyUntriagedCount: 1,
+			},
+		},
+	}, status)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"go.skia.org/infra/go/tiling"
 	"go.skia.org/infra/golden/go/expstorage"
 	"go.skia.org/infra/golden/go/types"
 
@@ -132,3 +133,21 @@ func ConvertLogEntry(entry expstorage.TriageLogEntry) TriageLogEntry {
 type DigestListResponse struct {
 	Digests []types.Digest `json:"digests"`
 }
+
+// FlakyTrace represents a trace that changed digests repeatedly over the most recent commits.
+type FlakyTrace struct {
+	ID              tiling.TraceID    `json:"id"`
+	Test            types.TestName    `json:"test"`
+	Corpus          string            `json:"corpus"`
+	Params          map[string]string `json:"params"`
+	DataPoints      int               `json:"data_points"`
+	DistinctDigests int               `json:"distinct_digests"`
+	Transitions     int               `json:"transitions"`
+}
+
+// FlakyTracesResponse is the response for "which traces are flaky?"
+type FlakyTracesResponse struct {
+	// Window is the number of commits considered when computing flakiness.
+	Window int          `json:"window"`
+	Traces []FlakyTrace `json:"traces"`
+}
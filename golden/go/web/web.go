@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +29,7 @@ import (
 	"go.skia.org/infra/golden/go/expstorage"
 	"go.skia.org/infra/golden/go/ignore"
 	"go.skia.org/infra/golden/go/indexer"
+	"go.skia.org/infra/golden/go/publisher"
 	"go.skia.org/infra/golden/go/search"
 	"go.skia.org/infra/golden/go/search/export"
 	"go.skia.org/infra/golden/go/search/query"
@@ -58,6 +60,13 @@ const (
 	maxAnonBurstExpensive = 50
 	maxAnonQPSCheap       = rate.Limit(5.0)
 	maxAnonBurstCheap     = 50
+
+	// defaultMinFlakyTransitions is the number of times a trace needs to change digests in the
+	// flakiness window to be reported as flaky, if the request does not specify otherwise.
+	defaultMinFlakyTransitions = 2
+
+	// maxEventDeliveries is the number of event deliveries returned by EventDeliveriesHandler.
+	maxEventDeliveries = 500
 )
 
 type validateFields int
@@ -76,6 +85,8 @@ type HandlersConfig struct {
 	CodeReviewURLTemplate            string
 	ContinuousIntegrationURLTemplate string
 	DiffStore                        diff.DiffStore
+	EventDeliveryLog                 publisher.DeliveryLog
+	EventPublisher                   publisher.Publisher
 	ExpectationsStore                expstorage.ExpectationsStore
 	GCSClient                        storage.GCSClient
 	IgnoreStore                      ignore.Store
@@ -677,6 +688,7 @@ func (wh *Handlers) IgnoresUpdateHandler(w http.ResponseWriter, r *http.Request)
 		httputils.ReportError(w, err, "Unable to update ignore rule", http.StatusInternalServerError)
 		return
 	}
+	wh.publish(publisher.IgnoreRuleEvent(publisher.IgnoreRuleUpdated, user, *ignoreRule))
 
 	// If update worked just list the current ignores and return them.
 	wh.IgnoresHandler(w, r)
@@ -701,6 +713,7 @@ func (wh *Handlers) IgnoresDeleteHandler(w http.ResponseWriter, r *http.Request)
 		return
 	} else if numDeleted == 1 {
 		sklog.Infof("Successfully deleted ignore with id %s", id)
+		wh.publish(publisher.IgnoreRuleEvent(publisher.IgnoreRuleDeleted, user, ignore.Rule{ID: id}))
 		// If delete worked just list the current ignores and return them.
 		wh.IgnoresHandler(w, r)
 	} else {
@@ -738,6 +751,7 @@ func (wh *Handlers) IgnoresAddHandler(w http.ResponseWriter, r *http.Request) {
 		httputils.ReportError(w, err, "Failed to create ignore rule", http.StatusInternalServerError)
 		return
 	}
+	wh.publish(publisher.IgnoreRuleEvent(publisher.IgnoreRuleCreated, user, *ignoreRule))
 
 	wh.IgnoresHandler(w, r)
 }
@@ -802,6 +816,37 @@ func (wh *Handlers) triage(ctx context.Context, user string, req frontend.Triage
 	return nil
 }
 
+// publish sends the given event to the EventPublisher, if one is configured.
+func (wh *Handlers) publish(e publisher.Event) {
+	if wh.EventPublisher == nil {
+		return
+	}
+	wh.EventPublisher.Publish(e)
+}
+
+// EventDeliveriesHandler returns the most recent attempts to deliver triage events to
+// outside systems (e.g. webhooks), newest first. If an EventDeliveryLog is configured, this
+// includes the deliveries made by the tryjob ingesters.
+func (wh *Handlers) EventDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	defer metrics2.FuncTimer().Stop()
+	if login.LoggedInAs(r) == "" {
+		http.Error(w, "You must be logged in to see event deliveries.", http.StatusUnauthorized)
+		return
+	}
+	deliveries := []publisher.Delivery{}
+	var err error
+	if wh.EventDeliveryLog != nil {
+		deliveries, err = wh.EventDeliveryLog.Recent(r.Context(), maxEventDeliveries)
+	} else if wh.EventPublisher != nil {
+		deliveries, err = wh.EventPublisher.Deliveries(r.Context())
+	}
+	if err != nil {
+		httputils.ReportError(w, err, "Could not retrieve event deliveries", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, deliveries)
+}
+
 // StatusHandler returns the current status of with respect to HEAD.
 func (wh *Handlers) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	defer metrics2.FuncTimer().Stop()
@@ -1451,3 +1496,63 @@ func (wh *Handlers) getDigestsResponse(test, corpus string) frontend.DigestListR
 		Digests: xd,
 	}
 }
+
+// FlakyTracesHandler returns the traces that alternated between digests the most over the
+// most recent commits. It accepts the optional form values "corpus", "min_transitions"
+// (defaults to 2) and "include_ignored".
+func (wh *Handlers) FlakyTracesHandler(w http.ResponseWriter, r *http.Request) {
+	defer metrics2.FuncTimer().Stop()
+	if err := wh.cheapLimitForAnonUsers(r); err != nil {
+		httputils.ReportError(w, err, "Try again later", http.StatusInternalServerError)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		httputils.ReportError(w, err, "Failed to parse form values", http.StatusInternalServerError)
+		return
+	}
+
+	minTransitions := defaultMinFlakyTransitions
+	if mt := r.Form.Get("min_transitions"); mt != "" {
+		n, err := strconv.Atoi(mt)
+		if err == nil && n < 1 {
+			err = skerr.Fmt("invalid min_transitions %d", n)
+		}
+		if err != nil {
+			httputils.ReportError(w, err, "min_transitions must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		minTransitions = n
+	}
+	is := types.ExcludeIgnoredTraces
+	if r.Form.Get("include_ignored") == "true" {
+		is = types.IncludeIgnoredTraces
+	}
+
+	sendJSONResponse(w, wh.getFlakyTracesResponse(r.Form.Get("corpus"), minTransitions, is))
+}
+
+// getFlakyTracesResponse returns the traces from the given corpus (or all corpora if empty)
+// that had at least minTransitions transitions.
+func (wh *Handlers) getFlakyTracesResponse(corpus string, minTransitions int, is types.IgnoreState) frontend.FlakyTracesResponse {
+	f := wh.Indexer.GetIndex().Flakiness(is)
+	rv := frontend.FlakyTracesResponse{
+		Window: f.Window(),
+		Traces: []frontend.FlakyTrace{},
+	}
+	for _, tf := range f.FlakyTraces(minTransitions) {
+		if corpus != "" && tf.Corpus != corpus {
+			continue
+		}
+		rv.Traces = append(rv.Traces, frontend.FlakyTrace{
+			ID:              tf.TraceID,
+			Test:            tf.Test,
+			Corpus:          tf.Corpus,
+			Params:          tf.Params,
+			DataPoints:      tf.DataPoints,
+			DistinctDigests: tf.DistinctDigests,
+			Transitions:     tf.Transitions,
+		})
+	}
+	return rv
+}
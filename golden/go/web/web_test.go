@@ -19,6 +19,7 @@ import (
 	ci "go.skia.org/infra/golden/go/continuous_integration"
 	"go.skia.org/infra/golden/go/digest_counter"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/flaky"
 	"go.skia.org/infra/golden/go/indexer"
 	mock_indexer "go.skia.org/infra/golden/go/indexer/mocks"
 	"go.skia.org/infra/golden/go/mocks"
@@ -694,3 +695,43 @@ func TestDigestListHandlerSunnyDay(t *testing.T) {
 		Digests: []types.Digest{bug_revert.GoodDigestAlfa, bug_revert.UntriagedDigestBravo},
 	}, dlr)
 }
+
+// TestGetFlakyTracesSunnyDay tests that traces which changed digests often are reported.
+func TestGetFlakyTracesSunnyDay(t *testing.T) {
+	unittest.SmallTest(t)
+	mi := &mock_indexer.IndexSource{}
+	defer mi.AssertExpectations(t)
+
+	fis := makeBugRevertIndex(5)
+	mi.On("GetIndex").Return(fis)
+
+	wh := Handlers{
+		HandlersConfig: HandlersConfig{
+			Indexer: mi,
+		},
+	}
+
+	ftr := wh.getFlakyTracesResponse("gm", 3, types.ExcludeIgnoredTraces)
+	assert.Equal(t, frontend.FlakyTracesResponse{
+		Window: flaky.DefaultWindow,
+		Traces: []frontend.FlakyTrace{
+			{
+				ID:     ",device=gamma,name=test_two,source_type=gm,",
+				Test:   bug_revert.TestTwo,
+				Corpus: "gm",
+				Params: map[string]string{
+					"device":                bug_revert.GammaDevice,
+					types.PRIMARY_KEY_FIELD: string(bug_revert.TestTwo),
+					types.CORPUS_FIELD:      "gm",
+				},
+				DataPoints:      4,
+				DistinctDigests: 4,
+				Transitions:     3,
+			},
+		},
+	}, ftr)
+
+	// No traces belong to other corpora.
+	ftr = wh.getFlakyTracesResponse("not-gm", 1, types.ExcludeIgnoredTraces)
+	assert.Empty(t, ftr.Traces)
+}
@@ -49,6 +49,7 @@ import (
 	"go.skia.org/infra/task_scheduler/go/db"
 	"go.skia.org/infra/task_scheduler/go/db/cache"
 	"go.skia.org/infra/task_scheduler/go/db/firestore"
+	"go.skia.org/infra/task_scheduler/go/quarantine"
 	"go.skia.org/infra/task_scheduler/go/types"
 	"go.skia.org/infra/task_scheduler/go/window"
 	"google.golang.org/api/option"
@@ -76,6 +77,7 @@ var (
 	commitsTemplate  *template.Template            = nil
 	iCache           *incremental.IncrementalCache = nil
 	lkgrObj          *lkgr.LKGR                    = nil
+	quarantined      *quarantine.Quarantine        = nil
 	taskDb           db.RemoteDB                   = nil
 	taskDriverDb     task_driver_db.DB             = nil
 	taskDriverLogs   *logs.LogsManager             = nil
@@ -269,10 +271,14 @@ func incrementalJsonHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	update := struct {
 		*incremental.Update
-		Pod string `json:"pod"`
+		Pod         string   `json:"pod"`
+		Quarantined []string `json:"quarantined_task_specs"`
 	}{
 		Pod: podId,
 	}
+	for _, e := range quarantined.GetEntries() {
+		update.Quarantined = append(update.Quarantined, e.Name)
+	}
 	if (expectPodId != "" && expectPodId != podId) || from == nil {
 		update.Update, err = iCache.GetAll(repoUrl, numCommits)
 	} else {
@@ -746,6 +752,13 @@ func main() {
 		sklog.Fatalf("Failed to create Firestore DB client: %s", err)
 	}
 
+	// Quarantined TaskSpecs.
+	quarantined, err = quarantine.NewWithParams(ctx, firestore.FIRESTORE_PROJECT, *firestoreInstance, ts)
+	if err != nil {
+		sklog.Fatalf("Failed to create Quarantine: %s", err)
+	}
+	quarantined.AutoUpdate(ctx)
+
 	criaTs, err := auth.NewJWTServiceAccountTokenSource("", *chromeInfraAuthJWT, auth.SCOPE_USERINFO_EMAIL)
 	if err != nil {
 		sklog.Fatal(err)
@@ -0,0 +1,149 @@
+package main
+
+/*
+	Analyze where the time was spent for a Job, or for the Jobs of a JobSpec
+	within a time range, to find which TaskSpecs to split or speed up.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"go.skia.org/infra/go/auth"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db/firestore"
+	"go.skia.org/infra/task_scheduler/go/job_analysis"
+)
+
+var (
+	end        = flag.String("end", "", "End of the time range, in RFC3339 format. Defaults to now.")
+	fsInstance = flag.String("firestore_instance", "", "Firestore instance to use.")
+	jobId      = flag.String("job", "", "ID of a single Job to analyze.")
+	jsonOutput = flag.Bool("json", false, "Write the results as JSON rather than tables.")
+	local      = flag.Bool("local", false, "True if running locally.")
+	name       = flag.String("name", "", "Name of the JobSpec to analyze. Requires --repo.")
+	repo       = flag.String("repo", "", "Repo of the JobSpec to analyze.")
+	start      = flag.String("start", "", "Start of the time range, in RFC3339 format. Defaults to 7 days before the end, which is also the maximum range.")
+)
+
+// parseTime parses the given RFC3339 timestamp, returning the default if it is
+// empty.
+func parseTime(ts string, def time.Time) (time.Time, error) {
+	if ts == "" {
+		return def, nil
+	}
+	return time.Parse(time.RFC3339, ts)
+}
+
+// round rounds the given duration for display.
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Second)
+}
+
+// printJob prints a table describing the given JobAnalysis.
+func printJob(a *job_analysis.JobAnalysis) {
+	fmt.Printf("Job %s (%s): %s\n", a.Id, a.Name, round(a.Duration))
+	fmt.Printf("Critical path (%s): %v\n\n", round(a.CriticalPathTime), a.CriticalPath)
+	onPath := util.NewStringSet(a.CriticalPath)
+	tasks := make([]*job_analysis.TaskAnalysis, 0, len(a.Tasks))
+	for _, ta := range a.Tasks {
+		tasks = append(tasks, ta)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Ready.Equal(tasks[j].Ready) {
+			return tasks[i].Name < tasks[j].Name
+		}
+		return tasks[i].Ready.Before(tasks[j].Ready)
+	})
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TaskSpec\tCritical\tAttempts\tScheduling\tPending\tRunning\tTotal")
+	for _, ta := range tasks {
+		critical := ""
+		if onPath[ta.Name] {
+			critical = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", ta.Name, critical, len(ta.TaskIds), round(ta.SchedulingTime), round(ta.PendingTime), round(ta.RunningTime), round(ta.TotalTime))
+	}
+	util.LogErr(tw.Flush())
+}
+
+// printAggregate prints a table describing the given Aggregate.
+func printAggregate(agg *job_analysis.Aggregate) {
+	fmt.Printf("%d jobs; duration p50 %s, p90 %s, max %s\n\n", agg.Jobs, round(agg.Duration.P50), round(agg.Duration.P90), round(agg.Duration.Max))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TaskSpec\tCritical path jobs\tCritical path time\tPending p50/p90\tRunning p50/p90\tTotal p50/p90")
+	for _, taskName := range agg.ByCriticalPathTime {
+		t := agg.Tasks[taskName]
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s / %s\t%s / %s\t%s / %s\n", t.Name, t.CriticalPathCount, round(t.CriticalPathTime), round(t.PendingTime.P50), round(t.PendingTime.P90), round(t.RunningTime.P50), round(t.RunningTime.P90), round(t.TotalTime.P50), round(t.TotalTime.P90))
+	}
+	util.LogErr(tw.Flush())
+}
+
+func main() {
+	common.Init()
+
+	if *fsInstance == "" {
+		sklog.Fatal("--firestore_instance is required.")
+	}
+	if (*jobId == "") == (*name == "") {
+		sklog.Fatal("Exactly one of --job or --name is required.")
+	}
+	if *name != "" && *repo == "" {
+		sklog.Fatal("--repo is required with --name.")
+	}
+
+	ctx := context.Background()
+	ts, err := auth.NewDefaultTokenSource(*local)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	d, err := firestore.NewDBWithParams(ctx, firestore.FIRESTORE_PROJECT, *fsInstance, ts)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	defer util.Close(d)
+
+	var result interface{}
+	if *jobId != "" {
+		a, err := job_analysis.AnalyzeJobById(d, *jobId, time.Now())
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		if !*jsonOutput {
+			printJob(a)
+			return
+		}
+		result = a
+	} else {
+		endTs, err := parseTime(*end, time.Now())
+		if err != nil {
+			sklog.Fatalf("Invalid --end: %s", err)
+		}
+		startTs, err := parseTime(*start, endTs.Add(-job_analysis.MAX_TIME_RANGE))
+		if err != nil {
+			sklog.Fatalf("Invalid --start: %s", err)
+		}
+		agg, _, err := job_analysis.AnalyzeJobSpec(d, *repo, *name, startTs, endTs)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		if !*jsonOutput {
+			printAggregate(agg)
+			return
+		}
+		result = agg
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		sklog.Fatal(err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"go.skia.org/infra/go/git/repograph"
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/types"
 	"golang.org/x/oauth2"
 )
 
@@ -137,19 +138,48 @@ func (b *Blacklist) Match(taskSpec, commit string) bool {
 // Rules in the Blacklist. Returns the name of the matched Rule or the empty
 // string if no Rules match.
 func (b *Blacklist) MatchRule(taskSpec, commit string) string {
+	return b.MatchCandidate(&Candidate{
+		TaskSpec: taskSpec,
+		Commit:   commit,
+	})
+}
+
+// MatchCandidate determines whether the given Candidate matches one of the
+// unexpired Rules in the Blacklist. Returns the name of the matched Rule or the
+// empty string if no Rules match.
+func (b *Blacklist) MatchCandidate(c *Candidate) string {
 	if b == nil {
 		return ""
 	}
+	now := time.Now()
 	b.mtx.RLock()
 	defer b.mtx.RUnlock()
 	for _, rule := range b.rules {
-		if rule.Match(taskSpec, commit) {
+		if rule.MatchCandidate(c, now) {
 			return rule.Name
 		}
 	}
 	return ""
 }
 
+// NeedsChangedFiles returns true iff any of the unexpired Rules in the
+// Blacklist match on the files changed by a commit, in which case callers
+// should provide Candidate.ChangedFiles.
+func (b *Blacklist) NeedsChangedFiles() bool {
+	if b == nil {
+		return false
+	}
+	now := time.Now()
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	for _, rule := range b.rules {
+		if len(rule.PathPatterns) > 0 && !rule.Expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
 // Add adds a new Rule to the Blacklist.
 func (b *Blacklist) AddRule(r *Rule, repos repograph.Map) error {
 	if b == nil {
@@ -263,13 +293,47 @@ func (b *Blacklist) GetRules() []*Rule {
 // Commits are simply commit hashes for which the rule applies. If the list is
 // empty, the Rule applies for all commits.
 //
-// A Rule should specify TaskSpecPatterns or Commits or both.
+// AuthorPatterns consists of regular expressions used to match the authors of
+// commits for which the rule applies.
+//
+// PathPatterns consists of regular expressions used to match file paths; the
+// rule applies to commits which change any matching file.
+//
+// Triggers are the trigger types (see types.TRIGGER_TYPE_*) of Jobs for which
+// the rule applies.
+//
+// If Expires is set, the Rule no longer applies after that time.
+//
+// A Rule applies to a task if all of its non-empty criteria match. A Rule
+// should specify at least one of TaskSpecPatterns, Commits, AuthorPatterns,
+// PathPatterns or Triggers.
 type Rule struct {
-	AddedBy          string   `json:"added_by"`
-	TaskSpecPatterns []string `json:"task_spec_patterns"`
-	Commits          []string `json:"commits"`
-	Description      string   `json:"description"`
-	Name             string   `json:"name"`
+	AddedBy          string    `json:"added_by"`
+	AuthorPatterns   []string  `json:"author_patterns"`
+	TaskSpecPatterns []string  `json:"task_spec_patterns"`
+	Commits          []string  `json:"commits"`
+	Description      string    `json:"description"`
+	Expires          time.Time `json:"expires"`
+	Name             string    `json:"name"`
+	PathPatterns     []string  `json:"path_patterns"`
+	Triggers         []string  `json:"triggers"`
+}
+
+// Candidate describes a task which might be prevented from running by a Rule.
+// TaskSpec and Commit are required. The other fields are optional, but a Rule
+// which matches on a field does not match Candidates for which that field is
+// not provided.
+type Candidate struct {
+	// Author is the author of the commit.
+	Author string
+	// ChangedFiles are the files changed by the commit.
+	ChangedFiles []string
+	// Commit is the commit hash at which the task would run.
+	Commit string
+	// TaskSpec is the name of the TaskSpec.
+	TaskSpec string
+	// Trigger is the trigger type of the Job(s) which need the task.
+	Trigger string
 }
 
 // ValidateRule returns an error if the given Rule is not valid.
@@ -283,17 +347,48 @@ func ValidateRule(r *Rule, repos repograph.Map) error {
 	if r.AddedBy == "" {
 		return errors.New("Rules must have an AddedBy user.")
 	}
-	if len(r.TaskSpecPatterns) == 0 && len(r.Commits) == 0 {
-		return errors.New("Rules must include a taskSpec pattern and/or a commit/range.")
+	if len(r.TaskSpecPatterns) == 0 && len(r.Commits) == 0 && len(r.AuthorPatterns) == 0 && len(r.PathPatterns) == 0 && len(r.Triggers) == 0 {
+		return errors.New("Rules must include a taskSpec pattern, a commit/range, an author pattern, a path pattern and/or a trigger.")
 	}
 	for _, c := range r.Commits {
 		if _, _, _, err := repos.FindCommit(c); err != nil {
 			return err
 		}
 	}
+	for _, patterns := range [][]string{r.TaskSpecPatterns, r.AuthorPatterns, r.PathPatterns} {
+		for _, p := range patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("Invalid pattern %q: %s", p, err)
+			}
+		}
+	}
+	for _, trigger := range r.Triggers {
+		if !util.In(trigger, types.TRIGGER_TYPES) {
+			return fmt.Errorf("Unknown trigger %q; expected one of %v", trigger, types.TRIGGER_TYPES)
+		}
+	}
+	if !util.TimeIsZero(r.Expires) && !r.Expires.After(time.Now()) {
+		return errors.New("Rule expiration time must be in the future.")
+	}
 	return nil
 }
 
+// matchPatterns returns true iff any of the given regular expressions match
+// the given string.
+func matchPatterns(patterns []string, s string) bool {
+	for _, p := range patterns {
+		match, err := regexp.MatchString(p, s)
+		if err != nil {
+			sklog.Warningf("Rule regexp returned error for input %q: %s: %s", s, p, err)
+			return false
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
 // matchTaskSpec determines whether the taskSpec portion of the Rule matches.
 func (r *Rule) matchTaskSpec(taskSpec string) bool {
 	// If no taskSpecs are specified, then the rule applies for ALL taskSpecs.
@@ -330,18 +425,75 @@ func (r *Rule) matchCommit(commit string) bool {
 	return false
 }
 
+// matchAuthor determines whether the author portion of the Rule matches.
+func (r *Rule) matchAuthor(author string) bool {
+	// If no authors are specified, then the rule applies for ALL authors.
+	if len(r.AuthorPatterns) == 0 {
+		return true
+	}
+	return matchPatterns(r.AuthorPatterns, author)
+}
+
+// matchPaths determines whether the path portion of the Rule matches.
+func (r *Rule) matchPaths(changedFiles []string) bool {
+	// If no paths are specified, then the rule applies for ALL commits.
+	if len(r.PathPatterns) == 0 {
+		return true
+	}
+	// Otherwise, the rule applies if the commit changed any matching file.
+	for _, f := range changedFiles {
+		if matchPatterns(r.PathPatterns, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTrigger determines whether the trigger portion of the Rule matches.
+func (r *Rule) matchTrigger(trigger string) bool {
+	// If no triggers are specified, then the rule applies for ALL triggers.
+	if len(r.Triggers) == 0 {
+		return true
+	}
+	return util.In(trigger, r.Triggers)
+}
+
+// Expired returns true iff the Rule has an expiration time which is not after
+// the given time.
+func (r *Rule) Expired(now time.Time) bool {
+	return !util.TimeIsZero(r.Expires) && !r.Expires.After(now)
+}
+
 // Match returns true iff the Rule matches the given taskSpec and commit.
 func (r *Rule) Match(taskSpec, commit string) bool {
-	return r.matchTaskSpec(taskSpec) && r.matchCommit(commit)
+	return r.MatchCandidate(&Candidate{
+		TaskSpec: taskSpec,
+		Commit:   commit,
+	}, time.Now())
+}
+
+// MatchCandidate returns true iff the Rule has not expired as of the given time
+// and matches the given Candidate.
+func (r *Rule) MatchCandidate(c *Candidate, now time.Time) bool {
+	return !r.Expired(now) &&
+		r.matchTaskSpec(c.TaskSpec) &&
+		r.matchCommit(c.Commit) &&
+		r.matchAuthor(c.Author) &&
+		r.matchPaths(c.ChangedFiles) &&
+		r.matchTrigger(c.Trigger)
 }
 
 // Copy returns a deep copy of the Rule.
 func (r *Rule) Copy() *Rule {
 	return &Rule{
 		AddedBy:          r.AddedBy,
+		AuthorPatterns:   util.CopyStringSlice(r.AuthorPatterns),
 		TaskSpecPatterns: util.CopyStringSlice(r.TaskSpecPatterns),
 		Commits:          util.CopyStringSlice(r.Commits),
 		Description:      r.Description,
+		Expires:          r.Expires,
 		Name:             r.Name,
+		PathPatterns:     util.CopyStringSlice(r.PathPatterns),
+		Triggers:         util.CopyStringSlice(r.Triggers),
 	}
 }
@@ -14,6 +14,7 @@ import (
 	git_testutils "go.skia.org/infra/go/git/testutils"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/types"
 )
 
 func setup(t *testing.T) (*Blacklist, func()) {
@@ -60,10 +61,14 @@ func TestRuleCopy(t *testing.T) {
 	unittest.SmallTest(t)
 	r := &Rule{
 		AddedBy:          "me@google.com",
+		AuthorPatterns:   []string{"you@google.com"},
 		TaskSpecPatterns: []string{"a", "b"},
 		Commits:          []string{"abc123", "def456"},
 		Description:      "this is a rule",
+		Expires:          time.Unix(1572000000, 0).UTC(),
 		Name:             "example",
+		PathPatterns:     []string{"^docs/"},
+		Triggers:         []string{types.TRIGGER_TYPE_COMMIT},
 	}
 	deepequal.AssertCopy(t, r, r.Copy())
 }
@@ -253,6 +258,74 @@ func setupTestRepo(t *testing.T) (context.Context, *git_testutils.GitBuilder, []
 	return ctx, gb, commits
 }
 
+func TestMatchCandidate(t *testing.T) {
+	unittest.SmallTest(t)
+	now := time.Unix(1572000000, 0).UTC()
+	r := &Rule{
+		AddedBy:          "test@google.com",
+		Name:             "Docs changes",
+		TaskSpecPatterns: []string{"^Test-"},
+		AuthorPatterns:   []string{"@google.com"},
+		PathPatterns:     []string{"^docs/", "\\.md$"},
+		Triggers:         []string{types.TRIGGER_TYPE_COMMIT, types.TRIGGER_TYPE_TRYJOB},
+		Expires:          now.Add(time.Hour),
+	}
+	c := func() *Candidate {
+		return &Candidate{
+			Author:       "Me (me@google.com)",
+			ChangedFiles: []string{"src/a.cpp", "README.md"},
+			Commit:       "abc123",
+			TaskSpec:     "Test-Linux",
+			Trigger:      types.TRIGGER_TYPE_COMMIT,
+		}
+	}
+	require.True(t, r.MatchCandidate(c(), now))
+
+	// Every criterion must match.
+	cand := c()
+	cand.TaskSpec = "Build-Linux"
+	require.False(t, r.MatchCandidate(cand, now))
+	cand = c()
+	cand.Author = "You (you@chromium.org)"
+	require.False(t, r.MatchCandidate(cand, now))
+	cand = c()
+	cand.ChangedFiles = []string{"src/a.cpp"}
+	require.False(t, r.MatchCandidate(cand, now))
+	cand = c()
+	cand.ChangedFiles = []string{"docs/index.html"}
+	require.True(t, r.MatchCandidate(cand, now))
+	cand = c()
+	cand.Trigger = types.TRIGGER_TYPE_FORCED
+	require.False(t, r.MatchCandidate(cand, now))
+
+	// Unknown fields don't match rules which need them.
+	cand = c()
+	cand.Author = ""
+	require.False(t, r.MatchCandidate(cand, now))
+	cand = c()
+	cand.ChangedFiles = nil
+	require.False(t, r.MatchCandidate(cand, now))
+
+	// Expired rules never match.
+	require.False(t, r.MatchCandidate(c(), now.Add(time.Hour)))
+	require.True(t, r.Expired(now.Add(time.Hour)))
+	require.False(t, r.Expired(now))
+
+	// Empty criteria match everything.
+	r = &Rule{
+		AddedBy:  "test@google.com",
+		Name:     "Periodic",
+		Triggers: []string{types.TRIGGER_TYPE_PERIODIC},
+	}
+	require.False(t, r.Expired(now))
+	cand = &Candidate{
+		Commit:   "abc123",
+		TaskSpec: "Perf-Linux",
+		Trigger:  types.TRIGGER_TYPE_PERIODIC,
+	}
+	require.True(t, r.MatchCandidate(cand, now))
+}
+
 func TestValidation(t *testing.T) {
 	unittest.LargeTest(t)
 	// Setup.
@@ -320,7 +393,7 @@ func TestValidation(t *testing.T) {
 				TaskSpecPatterns: []string{},
 				Commits:          []string{},
 			},
-			expect: fmt.Errorf("Rules must include a taskSpec pattern and/or a commit/range."),
+			expect: fmt.Errorf("Rules must include a taskSpec pattern, a commit/range, an author pattern, a path pattern and/or a trigger."),
 			msg:    "No taskSpecs or commits",
 		},
 		{
@@ -381,6 +454,46 @@ func TestValidation(t *testing.T) {
 			expect: nil,
 			msg:    "Five commits",
 		},
+		{
+			rule: Rule{
+				AddedBy:        "test@google.com",
+				Name:           "My rule",
+				AuthorPatterns: []string{"me@google.com"},
+				PathPatterns:   []string{"^docs/"},
+				Triggers:       []string{types.TRIGGER_TYPE_TRYJOB},
+				Expires:        time.Now().Add(time.Hour),
+			},
+			expect: nil,
+			msg:    "Author, path, trigger and expiration",
+		},
+		{
+			rule: Rule{
+				AddedBy:      "test@google.com",
+				Name:         "My rule",
+				PathPatterns: []string{"docs/("},
+			},
+			expect: fmt.Errorf("Invalid pattern \"docs/(\": error parsing regexp: missing closing ): `docs/(`"),
+			msg:    "Invalid path pattern",
+		},
+		{
+			rule: Rule{
+				AddedBy:  "test@google.com",
+				Name:     "My rule",
+				Triggers: []string{"nightly"},
+			},
+			expect: fmt.Errorf("Unknown trigger \"nightly\"; expected one of [commit forced periodic tryjob upstream]"),
+			msg:    "Unknown trigger",
+		},
+		{
+			rule: Rule{
+				AddedBy:          "test@google.com",
+				Name:             "My rule",
+				TaskSpecPatterns: []string{".*"},
+				Expires:          time.Now().Add(-time.Hour),
+			},
+			expect: fmt.Errorf("Rule expiration time must be in the future."),
+			msg:    "Already expired",
+		},
 	}
 	for _, test := range tests {
 		require.Equal(t, test.expect, ValidateRule(&test.rule, repos), test.msg)
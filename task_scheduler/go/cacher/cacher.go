@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 
 	"go.chromium.org/luci/common/isolated"
 	"go.skia.org/infra/go/git"
@@ -47,12 +48,22 @@ func (c *Cacher) GetOrCacheRepoState(ctx context.Context, rs types.RepoState) (*
 	// Obtain the TasksCfg.
 	cv, err := c.tcc.SetIfUnset(ctx, rs, func(ctx context.Context) (*task_cfg_cache.CachedValue, error) {
 		var tasksCfg *specs.TasksCfg
+		var changedFiles []string
 		err := ltgr.Do(ctx, func(co *git.TempCheckout) error {
 			cfg, err := specs.ReadTasksCfg(co.Dir())
 			if err != nil {
 				return err
 			}
 			tasksCfg = cfg
+			// Record the files changed by the commit, for use by
+			// JobSpecs with path filters. Try jobs obtain the changed
+			// files from the code review server instead.
+			if !rs.IsTryJob() {
+				changedFiles, err = getChangedFiles(ctx, co, rs.Revision)
+				if err != nil {
+					return err
+				}
+			}
 			return nil
 		})
 		if err != nil && !specs.ErrorIsPermanent(err) {
@@ -63,9 +74,10 @@ func (c *Cacher) GetOrCacheRepoState(ctx context.Context, rs types.RepoState) (*
 			errString = err.Error()
 		}
 		return &task_cfg_cache.CachedValue{
-			RepoState: rs,
-			Cfg:       tasksCfg,
-			Err:       errString,
+			RepoState:    rs,
+			Cfg:          tasksCfg,
+			Err:          errString,
+			ChangedFiles: changedFiles,
 		}, nil
 	})
 	if err != nil {
@@ -132,3 +144,31 @@ func (c *Cacher) GetOrCacheRepoState(ctx context.Context, rs types.RepoState) (*
 
 	return cv.Cfg, nil
 }
+
+// getChangedFiles returns the paths of the files changed by the given commit,
+// relative to the repo root. Merge commits are compared to their first parent.
+func getChangedFiles(ctx context.Context, co *git.TempCheckout, revision string) ([]string, error) {
+	details, err := co.Details(ctx, revision)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to obtain changed files for %s: %s", revision, err)
+	}
+	// Note that "git diff-tree --first-parent" does not limit the diff of a
+	// merge commit to its first parent, so we pass the parent explicitly.
+	args := []string{"diff-tree", "--no-commit-id", "--name-only", "-r"}
+	if len(details.Parents) > 0 {
+		args = append(args, details.Parents[0], details.Hash)
+	} else {
+		args = append(args, "--root", details.Hash)
+	}
+	out, err := co.Git(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to obtain changed files for %s: %s", revision, err)
+	}
+	changedFiles := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			changedFiles = append(changedFiles, line)
+		}
+	}
+	return changedFiles, nil
+}
@@ -0,0 +1,223 @@
+package cron_triggers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Collection name for the most recent Firing of each JobSpec.
+	COLLECTION_CRON_TRIGGERS = "cron_triggers"
+
+	// Subcollection name for the history of Firings of each JobSpec.
+	COLLECTION_FIRINGS = "firings"
+
+	// We'll perform this many attempts for a given request.
+	DEFAULT_ATTEMPTS = 3
+
+	// Timeouts for various requests.
+	TIMEOUT_GET = 60 * time.Second
+	TIMEOUT_PUT = 10 * time.Second
+
+	// A firing which is processed more than FIRING_GRACE_PERIOD after it
+	// was due is considered to have been missed.
+	FIRING_GRACE_PERIOD = 10 * time.Minute
+)
+
+// Firing records the Task Scheduler's handling of one or more scheduled
+// firings of a JobSpec's cron trigger.
+type Firing struct {
+	Repo    string `json:"repo"`
+	JobName string `json:"jobName"`
+	// Scheduled is the time at which the firing was due.
+	Scheduled time.Time `json:"scheduled"`
+	// Processed is the time at which the Task Scheduler handled the
+	// firing.
+	Processed time.Time `json:"processed"`
+	// JobId is the ID of the Job triggered for this firing, if any.
+	JobId string `json:"jobId,omitempty"`
+	// Missed is the number of earlier firings since the previous Firing
+	// which were missed, eg. because the Task Scheduler was down.
+	Missed int `json:"missed,omitempty"`
+	// CaughtUp is true if this firing was late, or if there were Missed
+	// firings, and the Job was triggered to catch up anyway. If the Job
+	// was triggered and CaughtUp is false, any Missed firings were
+	// skipped.
+	CaughtUp bool `json:"caughtUp,omitempty"`
+	// Skipped is true if no Job was triggered for this firing.
+	Skipped bool `json:"skipped,omitempty"`
+	// Reason explains why the firing was skipped.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Copy returns a deep copy of the Firing.
+func (f *Firing) Copy() *Firing {
+	return &Firing{
+		Repo:      f.Repo,
+		JobName:   f.JobName,
+		Scheduled: f.Scheduled,
+		Processed: f.Processed,
+		JobId:     f.JobId,
+		Missed:    f.Missed,
+		CaughtUp:  f.CaughtUp,
+		Skipped:   f.Skipped,
+		Reason:    f.Reason,
+	}
+}
+
+// Evaluate determines whether the given cron trigger for the given JobSpec has
+// fired since the given previous Firing, which may be nil if the JobSpec has
+// never fired. Returns nil if no firing is due. Otherwise, returns a Firing
+// for the most recent scheduled time, accounting for any firings which were
+// missed in between; the caller should trigger a Job unless the Firing is
+// Skipped and then record the Firing.
+func Evaluate(repo, jobName string, trigger *specs.CronTrigger, prev *Firing, now time.Time) (*Firing, error) {
+	sched, loc, err := trigger.Parse()
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(loc)
+	latest := sched.Prev(now)
+	if latest.IsZero() {
+		return nil, nil
+	}
+	f := &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: latest.UTC(),
+	}
+	if prev == nil {
+		// We don't know how long the JobSpec has existed, so we can't
+		// tell whether any firings were missed. Record the most recent
+		// one so that we can tell from now on.
+		f.Skipped = true
+		f.Reason = "No previous firing recorded; not triggering for firings before the cron trigger was first seen."
+		return f, nil
+	}
+	if !latest.After(prev.Scheduled) {
+		return nil, nil
+	}
+	for t := sched.Next(prev.Scheduled.In(loc)); !t.IsZero() && t.Before(latest); t = sched.Next(t) {
+		f.Missed++
+	}
+	late := now.Sub(latest) > FIRING_GRACE_PERIOD
+	if late || f.Missed > 0 {
+		if trigger.CatchUp {
+			f.CaughtUp = true
+		} else if late {
+			f.Skipped = true
+			f.Reason = fmt.Sprintf("Firing was processed %s late and catch_up is not enabled.", now.Sub(latest).Round(time.Second))
+		}
+	}
+	return f, nil
+}
+
+// DB stores Firings.
+type DB interface {
+	// GetLastFiring returns the most recent Firing for the given JobSpec,
+	// or nil if there is none.
+	GetLastFiring(repo, jobName string) (*Firing, error)
+
+	// PutFiring records the given Firing.
+	PutFiring(f *Firing) error
+}
+
+// firingKey returns a key which uniquely identifies the JobSpec with the
+// given name in the given repo and which is a valid Firestore document ID.
+func firingKey(repo, jobName string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(repo+"#"+jobName)))
+}
+
+// firestoreDB is a DB backed by Firestore.
+type firestoreDB struct {
+	client *firestore.Client
+	coll   *fs.CollectionRef
+}
+
+// NewFirestoreDBWithParams returns a DB backed by Firestore, using the given
+// params.
+func NewFirestoreDBWithParams(ctx context.Context, project, instance string, ts oauth2.TokenSource) (DB, error) {
+	client, err := firestore.NewClient(ctx, project, firestore.APP_TASK_SCHEDULER, instance, ts)
+	if err != nil {
+		return nil, err
+	}
+	return NewFirestoreDB(client), nil
+}
+
+// NewFirestoreDB returns a DB backed by the given firestore.Client.
+func NewFirestoreDB(client *firestore.Client) DB {
+	return &firestoreDB{
+		client: client,
+		coll:   client.Collection(COLLECTION_CRON_TRIGGERS),
+	}
+}
+
+// See documentation for DB interface.
+func (d *firestoreDB) GetLastFiring(repo, jobName string) (*Firing, error) {
+	doc, err := d.client.Get(context.TODO(), d.coll.Doc(firingKey(repo, jobName)), DEFAULT_ATTEMPTS, TIMEOUT_GET)
+	if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var f Firing
+	if err := doc.DataTo(&f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// See documentation for DB interface.
+func (d *firestoreDB) PutFiring(f *Firing) error {
+	ref := d.coll.Doc(firingKey(f.Repo, f.JobName))
+	histRef := ref.Collection(COLLECTION_FIRINGS).Doc(f.Scheduled.UTC().Format(time.RFC3339))
+	return d.client.RunTransaction(context.TODO(), "PutFiring", f.JobName, DEFAULT_ATTEMPTS, TIMEOUT_PUT, func(ctx context.Context, tx *fs.Transaction) error {
+		if err := tx.Set(ref, f); err != nil {
+			return err
+		}
+		return tx.Set(histRef, f)
+	})
+}
+
+// inMemoryDB is a DB which stores Firings in memory.
+type inMemoryDB struct {
+	firings map[string][]*Firing
+	mtx     sync.Mutex
+}
+
+// NewInMemoryDB returns a DB which stores Firings in memory.
+func NewInMemoryDB() DB {
+	return &inMemoryDB{
+		firings: map[string][]*Firing{},
+	}
+}
+
+// See documentation for DB interface.
+func (d *inMemoryDB) GetLastFiring(repo, jobName string) (*Firing, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	firings := d.firings[firingKey(repo, jobName)]
+	if len(firings) == 0 {
+		return nil, nil
+	}
+	return firings[len(firings)-1].Copy(), nil
+}
+
+// See documentation for DB interface.
+func (d *inMemoryDB) PutFiring(f *Firing) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	key := firingKey(f.Repo, f.JobName)
+	d.firings[key] = append(d.firings[key], f.Copy())
+	return nil
+}
@@ -0,0 +1,171 @@
+package cron_triggers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/deepequal"
+	"go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/specs"
+)
+
+const (
+	repo    = "fake.git"
+	jobName = "Nightly-Job"
+)
+
+func TestEvaluate(t *testing.T) {
+	unittest.SmallTest(t)
+
+	trigger := &specs.CronTrigger{
+		Schedule: "0 3 * * *",
+		Timezone: "America/New_York",
+	}
+	ny, err := time.LoadLocation(trigger.Timezone)
+	require.NoError(t, err)
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2019, time.October, day, hour, min, 0, 0, ny)
+	}
+
+	// No previous firing; record the most recent scheduled time as
+	// skipped.
+	f, err := Evaluate(repo, jobName, trigger, nil, at(24, 10, 0))
+	require.NoError(t, err)
+	require.Equal(t, &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: at(24, 3, 0).UTC(),
+		Skipped:   true,
+		Reason:    "No previous firing recorded; not triggering for firings before the cron trigger was first seen.",
+	}, f)
+	prev := f
+
+	// Not due yet.
+	f, err = Evaluate(repo, jobName, trigger, prev, at(25, 2, 59))
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	// Due.
+	f, err = Evaluate(repo, jobName, trigger, prev, at(25, 3, 1))
+	require.NoError(t, err)
+	require.Equal(t, &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: at(25, 3, 0).UTC(),
+	}, f)
+
+	// Already fired.
+	f, err = Evaluate(repo, jobName, trigger, f, at(25, 3, 2))
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	// Missed two firings, but the most recent is on time. The missed
+	// firings are skipped.
+	f, err = Evaluate(repo, jobName, trigger, prev, at(27, 3, 5))
+	require.NoError(t, err)
+	require.Equal(t, &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: at(27, 3, 0).UTC(),
+		Missed:    2,
+	}, f)
+
+	// Missed two firings and the most recent is late. Everything is
+	// skipped.
+	f, err = Evaluate(repo, jobName, trigger, prev, at(27, 9, 0))
+	require.NoError(t, err)
+	require.Equal(t, &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: at(27, 3, 0).UTC(),
+		Missed:    2,
+		Skipped:   true,
+		Reason:    "Firing was processed 6h0m0s late and catch_up is not enabled.",
+	}, f)
+
+	// Same, but catch up.
+	trigger.CatchUp = true
+	f, err = Evaluate(repo, jobName, trigger, prev, at(27, 9, 0))
+	require.NoError(t, err)
+	require.Equal(t, &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: at(27, 3, 0).UTC(),
+		Missed:    2,
+		CaughtUp:  true,
+	}, f)
+
+	// Invalid schedule.
+	trigger.Schedule = "bogus"
+	_, err = Evaluate(repo, jobName, trigger, prev, at(27, 9, 0))
+	require.EqualError(t, err, "Expected 5 fields in cron expression \"bogus\" but got 1")
+}
+
+func TestFiringCopy(t *testing.T) {
+	unittest.SmallTest(t)
+	f := &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: time.Unix(1572000000, 0).UTC(),
+		Processed: time.Unix(1572000060, 0).UTC(),
+		JobId:     "abc123",
+		Missed:    3,
+		CaughtUp:  true,
+		Skipped:   true,
+		Reason:    "reasons",
+	}
+	deepequal.AssertCopy(t, f, f.Copy())
+}
+
+func testDB(t *testing.T, d DB) {
+	f, err := d.GetLastFiring(repo, jobName)
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	f1 := &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: time.Unix(1572000000, 0).UTC(),
+		Processed: time.Unix(1572000060, 0).UTC(),
+		Skipped:   true,
+		Reason:    "first",
+	}
+	require.NoError(t, d.PutFiring(f1))
+	f, err = d.GetLastFiring(repo, jobName)
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, f1, f)
+
+	f2 := &Firing{
+		Repo:      repo,
+		JobName:   jobName,
+		Scheduled: time.Unix(1572086400, 0).UTC(),
+		Processed: time.Unix(1572086460, 0).UTC(),
+		JobId:     "abc123",
+	}
+	require.NoError(t, d.PutFiring(f2))
+	f, err = d.GetLastFiring(repo, jobName)
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, f2, f)
+
+	// Other JobSpecs are unaffected.
+	f, err = d.GetLastFiring(repo, "Weekly-Job")
+	require.NoError(t, err)
+	require.Nil(t, f)
+	f, err = d.GetLastFiring("other.git", jobName)
+	require.NoError(t, err)
+	require.Nil(t, f)
+}
+
+func TestInMemoryDB(t *testing.T) {
+	unittest.SmallTest(t)
+	testDB(t, NewInMemoryDB())
+}
+
+func TestFirestoreDB(t *testing.T) {
+	unittest.LargeTest(t)
+	c, cleanup := firestore.NewClientForTesting(t)
+	defer cleanup()
+	testDB(t, NewFirestoreDB(c))
+}
@@ -66,6 +66,10 @@ type TaskCache interface {
 	// date range.
 	GetTasksFromDateRange(from time.Time, to time.Time) ([]*types.Task, error)
 
+	// GetTaskForReuseKey returns the most recently created successful task
+	// with the given ReuseKey, or nil if no such task exists.
+	GetTaskForReuseKey(string) (*types.Task, error)
+
 	// KnownTaskName returns true iff the given task name has been seen
 	// before for a non-forced, non-tryjob run.
 	KnownTaskName(string, string) bool
@@ -91,6 +95,8 @@ type taskCache struct {
 	tasksByCommit map[string]map[string]map[string]*types.Task
 	// map[TaskKey]map[task_id]*Task
 	tasksByKey map[types.TaskKey]map[string]*types.Task
+	// map[reuse_key]map[task_id]*Task
+	tasksByReuseKey map[string]map[string]*types.Task
 	// tasksByTime is sorted by Task.Created.
 	tasksByTime []*types.Task
 	timeWindow  *window.Window
@@ -190,6 +196,35 @@ func (c *taskCache) GetTasksFromDateRange(from time.Time, to time.Time) ([]*type
 	return rv, nil
 }
 
+// See documentation for TaskCache interface.
+func (c *taskCache) GetTaskForReuseKey(key string) (*types.Task, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var rv *types.Task
+	for _, t := range c.tasksByReuseKey[key] {
+		if t.Success() && (rv == nil || t.Created.After(rv.Created)) {
+			rv = t
+		}
+	}
+	if rv == nil {
+		return nil, nil
+	}
+	return rv.Copy(), nil
+}
+
+// removeFromTasksByReuseKey removes task (which must be a previously-inserted
+// Task, not a new Task) from c.tasksByReuseKey. Assumes the caller holds a
+// lock.
+func (c *taskCache) removeFromTasksByReuseKey(task *types.Task) {
+	if byId, ok := c.tasksByReuseKey[task.ReuseKey]; ok {
+		delete(byId, task.Id)
+		if len(byId) == 0 {
+			delete(c.tasksByReuseKey, task.ReuseKey)
+		}
+	}
+}
+
 // See documentation for TaskCache interface.
 func (c *taskCache) KnownTaskName(repo, name string) bool {
 	c.mtx.RLock()
@@ -277,6 +312,9 @@ func (c *taskCache) expireTasks() {
 			}
 		}
 
+		// Tasks by reuse key.
+		c.removeFromTasksByReuseKey(task)
+
 		// Tasks by time.
 		c.tasksByTime[i] = nil // Allow GC.
 
@@ -312,6 +350,19 @@ func (c *taskCache) insertOrUpdateTask(task *types.Task) {
 	}
 	byKey[task.Id] = task
 
+	// Insert into tasksByReuseKey.
+	if isUpdate {
+		c.removeFromTasksByReuseKey(old)
+	}
+	if task.ReuseKey != "" {
+		byReuseKey, ok := c.tasksByReuseKey[task.ReuseKey]
+		if !ok {
+			byReuseKey = map[string]*types.Task{}
+			c.tasksByReuseKey[task.ReuseKey] = byReuseKey
+		}
+		byReuseKey[task.Id] = task
+	}
+
 	if isUpdate {
 		// If we already know about this task, the blamelist might have changed, so
 		// we need to remove it from tasksByCommit and re-insert where needed.
@@ -419,15 +470,16 @@ func NewTaskCache(ctx context.Context, d db.TaskReader, timeWindow *window.Windo
 		return nil, err
 	}
 	c := &taskCache{
-		db:             d,
-		knownTaskNames: map[string]map[string]time.Time{},
-		tasks:          map[string]*types.Task{},
-		tasksByCommit:  map[string]map[string]map[string]*types.Task{},
-		tasksByKey:     map[types.TaskKey]map[string]*types.Task{},
-		unfinished:     map[string]*types.Task{},
-		modified:       map[string]*types.Task{},
-		timeWindow:     timeWindow,
-		onModFn:        onModifiedTasks,
+		db:              d,
+		knownTaskNames:  map[string]map[string]time.Time{},
+		tasks:           map[string]*types.Task{},
+		tasksByCommit:   map[string]map[string]map[string]*types.Task{},
+		tasksByKey:      map[types.TaskKey]map[string]*types.Task{},
+		tasksByReuseKey: map[string]map[string]*types.Task{},
+		unfinished:      map[string]*types.Task{},
+		modified:        map[string]*types.Task{},
+		timeWindow:      timeWindow,
+		onModFn:         onModifiedTasks,
 	}
 	for _, t := range tasks {
 		if c.timeWindow.TestTime(t.Repo, t.Created) {
@@ -232,6 +232,79 @@ func TestTaskCacheGetTasksFromDateRange(t *testing.T) {
 	deepequal.AssertDeepEqual(t, []*types.Task{}, tasks)
 }
 
+func TestTaskCacheGetTaskForReuseKey(t *testing.T) {
+	unittest.SmallTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := memory.NewInMemoryTaskDB()
+
+	// Pre-load a successful task into the DB.
+	timeStart := time.Now().Add(-30 * time.Minute) // Arbitrary starting point.
+	t1 := types.MakeTestTask(timeStart, []string{"a"})
+	t1.ReuseKey = "key1"
+	t1.Status = types.TASK_STATUS_SUCCESS
+	require.NoError(t, d.PutTask(t1))
+	d.Wait()
+
+	// Create the cache.
+	w, err := window.New(time.Hour, 0, nil)
+	require.NoError(t, err)
+	wait := make(chan struct{})
+	c, err := NewTaskCache(ctx, d, w, func() {
+		wait <- struct{}{}
+	})
+	require.NoError(t, err)
+	<-wait
+
+	found, err := c.GetTaskForReuseKey("key1")
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, t1, found)
+	found, err = c.GetTaskForReuseKey("key2")
+	require.NoError(t, err)
+	require.Nil(t, found)
+
+	// A newer task with the same key which has not yet succeeded is not
+	// returned, nor is a task with a different key.
+	t2 := types.MakeTestTask(timeStart.Add(time.Minute), []string{"b"})
+	t2.ReuseKey = "key1"
+	t3 := types.MakeTestTask(timeStart.Add(2*time.Minute), []string{"c"})
+	t3.ReuseKey = "key2"
+	t3.Status = types.TASK_STATUS_FAILURE
+	require.NoError(t, d.PutTasks([]*types.Task{t2, t3}))
+	d.Wait()
+	<-wait
+	require.NoError(t, c.Update())
+	found, err = c.GetTaskForReuseKey("key1")
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, t1, found)
+	found, err = c.GetTaskForReuseKey("key2")
+	require.NoError(t, err)
+	require.Nil(t, found)
+
+	// Once the newer task succeeds, it is returned.
+	t2.Status = types.TASK_STATUS_SUCCESS
+	require.NoError(t, d.PutTask(t2))
+	d.Wait()
+	<-wait
+	require.NoError(t, c.Update())
+	found, err = c.GetTaskForReuseKey("key1")
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, t2, found)
+
+	// If the task's key changes, it is no longer returned for the old key.
+	t2.ReuseKey = "key3"
+	require.NoError(t, d.PutTask(t2))
+	d.Wait()
+	<-wait
+	require.NoError(t, c.Update())
+	found, err = c.GetTaskForReuseKey("key1")
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, t1, found)
+	found, err = c.GetTaskForReuseKey("key3")
+	require.NoError(t, err)
+	deepequal.AssertDeepEqual(t, t2, found)
+}
+
 func TestTaskCacheMultiRepo(t *testing.T) {
 	unittest.SmallTest(t)
 	ctx, cancel := context.WithCancel(context.Background())
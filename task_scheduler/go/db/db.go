@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"regexp"
 	"sort"
@@ -11,7 +12,6 @@ import (
 	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/sklog"
-	"go.skia.org/infra/go/swarming"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/types"
 	"go.skia.org/infra/task_scheduler/go/window"
@@ -425,12 +425,21 @@ var errNotModified = errors.New("Task not modified")
 
 // UpdateDBFromSwarmingTask updates a task in db from data in s.
 func UpdateDBFromSwarmingTask(db TaskDB, s *swarming_api.SwarmingRpcsTaskResult) (bool, error) {
-	id, err := swarming.GetTagValue(s, types.SWARMING_TAG_ID)
+	res, err := types.SwarmingTaskResult(s)
 	if err != nil {
 		return false, err
 	}
-	_, err = UpdateTaskWithRetries(db, id, func(task *types.Task) error {
-		modified, err := task.UpdateFromSwarming(s)
+	return UpdateDBFromTaskResult(db, res)
+}
+
+// UpdateDBFromTaskResult updates a task in db from data in res.
+func UpdateDBFromTaskResult(db TaskDB, res *types.TaskResult) (bool, error) {
+	ids := res.Tags[types.SWARMING_TAG_ID]
+	if len(ids) != 1 {
+		return false, fmt.Errorf("Expected a single value for tag key %q", types.SWARMING_TAG_ID)
+	}
+	_, err := UpdateTaskWithRetries(db, ids[0], func(task *types.Task) error {
+		modified, err := task.UpdateFromTaskResult(res)
 		if err != nil {
 			return err
 		}
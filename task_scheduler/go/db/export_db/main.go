@@ -0,0 +1,234 @@
+package main
+
+/*
+	Export Tasks or Jobs created within a time range to JSON or CSV.
+*/
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/auth"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/firestore"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	FORMAT_CSV  = "csv"
+	FORMAT_JSON = "json"
+
+	KIND_JOBS  = "jobs"
+	KIND_TASKS = "tasks"
+
+	// Query the DB in chunks of this size.
+	TIME_CHUNK = 24 * time.Hour
+)
+
+var (
+	end        = flag.String("end", "", "End of the time range, in RFC3339 format. Defaults to now.")
+	format     = flag.String("format", FORMAT_JSON, fmt.Sprintf("Output format; %q or %q.", FORMAT_JSON, FORMAT_CSV))
+	fsInstance = flag.String("firestore_instance", "", "Firestore instance to export from.")
+	kind       = flag.String("kind", KIND_TASKS, fmt.Sprintf("What to export; %q or %q.", KIND_TASKS, KIND_JOBS))
+	local      = flag.Bool("local", false, "True if running locally.")
+	out        = flag.String("out", "", "Output file. Defaults to stdout.")
+	repo       = flag.String("repo", "", "If set, only export tasks or jobs for this repo.")
+	start      = flag.String("start", "", "Start of the time range, in RFC3339 format. Defaults to 24 hours before the end.")
+
+	TASK_CSV_HEADER = []string{"id", "name", "repo", "revision", "issue", "patchset", "status", "attempt", "retry_of", "forced_job_id", "swarming_task_id", "created", "started", "finished", "commits", "jobs"}
+	JOB_CSV_HEADER  = []string{"id", "name", "repo", "revision", "issue", "patchset", "status", "is_force", "priority", "buildbucket_build_id", "created", "requested", "finished"}
+)
+
+// formatTime returns the given time in RFC3339 format, or the empty string if
+// the time is zero.
+func formatTime(ts time.Time) string {
+	if util.TimeIsZero(ts) {
+		return ""
+	}
+	return ts.UTC().Format(time.RFC3339)
+}
+
+// taskRow returns the CSV row for the given Task.
+func taskRow(t *types.Task) []string {
+	return []string{
+		t.Id,
+		t.Name,
+		t.Repo,
+		t.Revision,
+		t.Issue,
+		t.Patchset,
+		string(t.Status),
+		strconv.Itoa(t.Attempt),
+		t.RetryOf,
+		t.ForcedJobId,
+		t.SwarmingTaskId,
+		formatTime(t.Created),
+		formatTime(t.Started),
+		formatTime(t.Finished),
+		strings.Join(t.Commits, " "),
+		strings.Join(t.Jobs, " "),
+	}
+}
+
+// jobRow returns the CSV row for the given Job.
+func jobRow(j *types.Job) []string {
+	return []string{
+		j.Id,
+		j.Name,
+		j.Repo,
+		j.Revision,
+		j.Issue,
+		j.Patchset,
+		string(j.Status),
+		strconv.FormatBool(j.IsForce),
+		strconv.FormatFloat(j.Priority, 'f', -1, 64),
+		strconv.FormatInt(j.BuildbucketBuildId, 10),
+		formatTime(j.Created),
+		formatTime(j.Requested),
+		formatTime(j.Finished),
+	}
+}
+
+// exportTasks writes the Tasks created within the given time range to w.
+func exportTasks(d db.TaskReader, startTs, endTs time.Time, w io.Writer) error {
+	tasks := []*types.Task{}
+	if err := util.IterTimeChunks(startTs, endTs, TIME_CHUNK, func(chunkStart, chunkEnd time.Time) error {
+		sklog.Infof("Loading tasks from %s - %s", chunkStart, chunkEnd)
+		chunk, err := d.GetTasksFromDateRange(chunkStart, chunkEnd, *repo)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, chunk...)
+		return nil
+	}); err != nil {
+		return err
+	}
+	sklog.Infof("Exporting %d tasks.", len(tasks))
+	if *format == FORMAT_JSON {
+		return writeJSON(w, tasks)
+	}
+	rows := make([][]string, 0, len(tasks))
+	for _, t := range tasks {
+		rows = append(rows, taskRow(t))
+	}
+	return writeCSV(w, TASK_CSV_HEADER, rows)
+}
+
+// exportJobs writes the Jobs created within the given time range to w.
+func exportJobs(d db.JobReader, startTs, endTs time.Time, w io.Writer) error {
+	jobs := []*types.Job{}
+	if err := util.IterTimeChunks(startTs, endTs, TIME_CHUNK, func(chunkStart, chunkEnd time.Time) error {
+		sklog.Infof("Loading jobs from %s - %s", chunkStart, chunkEnd)
+		chunk, err := d.GetJobsFromDateRange(chunkStart, chunkEnd, *repo)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, chunk...)
+		return nil
+	}); err != nil {
+		return err
+	}
+	sklog.Infof("Exporting %d jobs.", len(jobs))
+	if *format == FORMAT_JSON {
+		return writeJSON(w, jobs)
+	}
+	rows := make([][]string, 0, len(jobs))
+	for _, j := range jobs {
+		rows = append(rows, jobRow(j))
+	}
+	return writeCSV(w, JOB_CSV_HEADER, rows)
+}
+
+// writeJSON writes the given value to w as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeCSV writes the given header and rows to w as CSV.
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseTime parses the given RFC3339 timestamp, returning the default if it is
+// empty.
+func parseTime(ts string, def time.Time) (time.Time, error) {
+	if ts == "" {
+		return def, nil
+	}
+	return time.Parse(time.RFC3339, ts)
+}
+
+func main() {
+	common.Init()
+
+	if *fsInstance == "" {
+		sklog.Fatal("--firestore_instance is required.")
+	}
+	if *format != FORMAT_JSON && *format != FORMAT_CSV {
+		sklog.Fatalf("--format must be %q or %q.", FORMAT_JSON, FORMAT_CSV)
+	}
+	if *kind != KIND_TASKS && *kind != KIND_JOBS {
+		sklog.Fatalf("--kind must be %q or %q.", KIND_TASKS, KIND_JOBS)
+	}
+	endTs, err := parseTime(*end, time.Now())
+	if err != nil {
+		sklog.Fatalf("Invalid --end: %s", err)
+	}
+	startTs, err := parseTime(*start, endTs.Add(-24*time.Hour))
+	if err != nil {
+		sklog.Fatalf("Invalid --start: %s", err)
+	}
+	if !startTs.Before(endTs) {
+		sklog.Fatal("--start must be before --end.")
+	}
+
+	ctx := context.Background()
+	ts, err := auth.NewDefaultTokenSource(*local)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	d, err := firestore.NewDBWithParams(ctx, firestore.FIRESTORE_PROJECT, *fsInstance, ts)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	defer util.Close(d)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		defer util.Close(f)
+		w = f
+	}
+	if *kind == KIND_TASKS {
+		err = exportTasks(d, startTs, endTs, w)
+	} else {
+		err = exportJobs(d, startTs, endTs, w)
+	}
+	if err != nil {
+		sklog.Fatal(err)
+	}
+}
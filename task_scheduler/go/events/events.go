@@ -0,0 +1,425 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	// Kinds of objects described by Events.
+	KIND_JOB  = "job"
+	KIND_TASK = "task"
+
+	// Types of Events.
+
+	// The Task or Job was inserted into the DB.
+	EVENT_CREATED = "created"
+	// The Task was triggered in Swarming.
+	EVENT_TRIGGERED = "triggered"
+	// The Task started running.
+	EVENT_STARTED = "started"
+	// The Task or Job finished, successfully or not. Canceled Jobs produce
+	// EVENT_CANCELED instead.
+	EVENT_FINISHED = "finished"
+	// The Task is a retry of a previous attempt.
+	EVENT_RETRIED = "retried"
+	// The Job was canceled.
+	EVENT_CANCELED = "canceled"
+
+	// Events which could not be sent are buffered and retried with each
+	// subsequent send and every RETRY_PERIOD. If more than MAX_PENDING_EVENTS
+	// are waiting to be sent, the oldest are dropped.
+	MAX_PENDING_EVENTS = 10000
+	RETRY_PERIOD       = time.Minute
+
+	// When the Publisher starts, it replays modifications made up to
+	// REPLAY_OVERLAP before its stored Watermarks, in case modifications
+	// reached it slightly out of order.
+	REPLAY_OVERLAP = time.Minute
+)
+
+// Event describes a state transition of a Task or Job.
+type Event struct {
+	// Kind is one of the KIND_* constants.
+	Kind string `json:"kind"`
+	// Type is one of the EVENT_* constants.
+	Type string `json:"type"`
+	// Id is the ID of the Task or Job.
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Repo     string `json:"repo"`
+	Revision string `json:"revision"`
+	Status   string `json:"status"`
+	// Timestamp is the time at which the Task or Job was modified.
+	Timestamp time.Time `json:"timestamp"`
+	// Exactly one of Task or Job is set, according to Kind.
+	Task *types.Task `json:"task,omitempty"`
+	Job  *types.Job  `json:"job,omitempty"`
+}
+
+// taskState is the subset of a Task's state needed to detect transitions.
+type taskState struct {
+	created        time.Time
+	status         types.TaskStatus
+	swarmingTaskId string
+}
+
+// jobState is the subset of a Job's state needed to detect transitions.
+type jobState struct {
+	created time.Time
+	status  types.JobStatus
+}
+
+// taskTransitions returns the types of Events which describe the change from
+// the given previous state, which is nil for new Tasks, to the given Task.
+func taskTransitions(prev *taskState, t *types.Task) []string {
+	rv := []string{}
+	if prev == nil {
+		rv = append(rv, EVENT_CREATED)
+		if t.RetryOf != "" {
+			rv = append(rv, EVENT_RETRIED)
+		}
+		prev = &taskState{}
+	}
+	if prev.swarmingTaskId == "" && t.SwarmingTaskId != "" {
+		rv = append(rv, EVENT_TRIGGERED)
+	}
+	// Short Tasks may finish before we see them running.
+	if prev.status == types.TASK_STATUS_PENDING && t.Status != types.TASK_STATUS_PENDING && !util.TimeIsZero(t.Started) {
+		rv = append(rv, EVENT_STARTED)
+	}
+	prevDone := prev.status != types.TASK_STATUS_PENDING && prev.status != types.TASK_STATUS_RUNNING
+	if !prevDone && t.Done() {
+		rv = append(rv, EVENT_FINISHED)
+	}
+	return rv
+}
+
+// jobTransitions returns the types of Events which describe the change from
+// the given previous state, which is nil for new Jobs, to the given Job.
+func jobTransitions(prev *jobState, j *types.Job) []string {
+	rv := []string{}
+	if prev == nil {
+		rv = append(rv, EVENT_CREATED)
+		prev = &jobState{}
+	}
+	if prev.status == types.JOB_STATUS_IN_PROGRESS && j.Done() {
+		if j.Status == types.JOB_STATUS_CANCELED {
+			rv = append(rv, EVENT_CANCELED)
+		} else {
+			rv = append(rv, EVENT_FINISHED)
+		}
+	}
+	return rv
+}
+
+// Publisher watches the DB for modified Tasks and Jobs and sends an Event to
+// its Sink for each state transition. Events are delivered at least once;
+// a Sink which fails partway through a batch may see some Events again when
+// the batch is retried. If the Publisher has a WatermarkStore, transitions
+// which happen while it is not running are published when it next starts,
+// possibly along with some Events which were already published.
+type Publisher struct {
+	jobs   map[string]*jobState
+	marks  WatermarkStore
+	mtx    sync.Mutex
+	sink   Sink
+	tasks  map[string]*taskState
+	window time.Duration
+
+	// Events waiting to be sent, oldest first.
+	pending    []*Event
+	pendingMtx sync.Mutex
+	// Watermarks which will be stored once pending is empty, and those
+	// which were last stored. Protected by pendingMtx.
+	nextMarks  Watermarks
+	savedMarks Watermarks
+
+	dropped   metrics2.Counter
+	errors    metrics2.Counter
+	published metrics2.Counter
+}
+
+// NewPublisher returns a Publisher which sends Events to the given Sink. The
+// Publisher remembers the state of Tasks and Jobs created within the given
+// window; modifications to older Tasks and Jobs are ignored. The Publisher
+// keeps track of its progress in the given WatermarkStore, if not nil.
+func NewPublisher(sink Sink, window time.Duration, marks WatermarkStore) *Publisher {
+	return &Publisher{
+		jobs:      map[string]*jobState{},
+		marks:     marks,
+		sink:      sink,
+		tasks:     map[string]*taskState{},
+		window:    window,
+		dropped:   metrics2.GetCounter("task_scheduler_events_dropped"),
+		errors:    metrics2.GetCounter("task_scheduler_events_errors"),
+		published: metrics2.GetCounter("task_scheduler_events_published"),
+	}
+}
+
+// Init loads the current state of Tasks and Jobs within the window from the
+// DB, so that modifications to them are not reported as new. Returns Events
+// for Tasks and Jobs which were modified after the stored Watermarks, ie.
+// which may have transitions that were never published. Their state before
+// the modification is unknown, so every transition after their creation is
+// published again, unless they were created after the Watermarks too.
+func (p *Publisher) Init(d db.RemoteDB, now time.Time) ([]*Event, error) {
+	var marks Watermarks
+	if p.marks != nil {
+		var err error
+		marks, err = p.marks.Get()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load watermarks: %s", err)
+		}
+	}
+	start := now.Add(-p.window)
+	tasks, err := d.GetTasksFromDateRange(start, now, "")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load tasks: %s", err)
+	}
+	jobs, err := d.GetJobsFromDateRange(start, now, "")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load jobs: %s", err)
+	}
+	p.pendingMtx.Lock()
+	p.nextMarks = marks
+	p.savedMarks = marks
+	p.pendingMtx.Unlock()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	rv := []*Event{}
+	if !marks.Tasks.IsZero() {
+		since := marks.Tasks.Add(-REPLAY_OVERLAP)
+		for _, t := range tasks {
+			if !t.DbModified.After(since) {
+				continue
+			}
+			if !t.Created.After(since) {
+				p.tasks[t.Id] = &taskState{created: t.Created}
+			}
+			rv = append(rv, p.taskEvents(t)...)
+		}
+	}
+	if !marks.Jobs.IsZero() {
+		since := marks.Jobs.Add(-REPLAY_OVERLAP)
+		for _, j := range jobs {
+			if !j.DbModified.After(since) {
+				continue
+			}
+			if !j.Created.After(since) {
+				p.jobs[j.Id] = &jobState{created: j.Created}
+			}
+			rv = append(rv, p.jobEvents(j)...)
+		}
+	}
+	for _, t := range tasks {
+		p.tasks[t.Id] = makeTaskState(t)
+	}
+	for _, j := range jobs {
+		p.jobs[j.Id] = makeJobState(j)
+	}
+	return rv, nil
+}
+
+// makeTaskState returns a taskState for the given Task.
+func makeTaskState(t *types.Task) *taskState {
+	return &taskState{
+		created:        t.Created,
+		status:         t.Status,
+		swarmingTaskId: t.SwarmingTaskId,
+	}
+}
+
+// makeJobState returns a jobState for the given Job.
+func makeJobState(j *types.Job) *jobState {
+	return &jobState{
+		created: j.Created,
+		status:  j.Status,
+	}
+}
+
+// taskEvents returns Events for the transitions of the given Task from its
+// known state. Assumes the caller holds p.mtx.
+func (p *Publisher) taskEvents(t *types.Task) []*Event {
+	rv := []*Event{}
+	for _, typ := range taskTransitions(p.tasks[t.Id], t) {
+		rv = append(rv, &Event{
+			Kind:      KIND_TASK,
+			Type:      typ,
+			Id:        t.Id,
+			Name:      t.Name,
+			Repo:      t.Repo,
+			Revision:  t.Revision,
+			Status:    string(t.Status),
+			Timestamp: t.DbModified,
+			Task:      t.Copy(),
+		})
+	}
+	return rv
+}
+
+// jobEvents returns Events for the transitions of the given Job from its known
+// state. Assumes the caller holds p.mtx.
+func (p *Publisher) jobEvents(j *types.Job) []*Event {
+	rv := []*Event{}
+	for _, typ := range jobTransitions(p.jobs[j.Id], j) {
+		rv = append(rv, &Event{
+			Kind:      KIND_JOB,
+			Type:      typ,
+			Id:        j.Id,
+			Name:      j.Name,
+			Repo:      j.Repo,
+			Revision:  j.Revision,
+			Status:    string(j.Status),
+			Timestamp: j.DbModified,
+			Job:       j.Copy(),
+		})
+	}
+	return rv
+}
+
+// processTasks updates the state of the given Tasks and returns Events for
+// any transitions, along with Watermarks which cover the given Tasks.
+func (p *Publisher) processTasks(tasks []*types.Task, now time.Time) ([]*Event, Watermarks) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	cutoff := now.Add(-p.window)
+	rv := []*Event{}
+	var marks Watermarks
+	for _, t := range tasks {
+		if t.DbModified.After(marks.Tasks) {
+			marks.Tasks = t.DbModified
+		}
+		if t.Created.Before(cutoff) {
+			continue
+		}
+		rv = append(rv, p.taskEvents(t)...)
+		p.tasks[t.Id] = makeTaskState(t)
+	}
+	return rv, marks
+}
+
+// processJobs updates the state of the given Jobs and returns Events for any
+// transitions, along with Watermarks which cover the given Jobs.
+func (p *Publisher) processJobs(jobs []*types.Job, now time.Time) ([]*Event, Watermarks) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	cutoff := now.Add(-p.window)
+	rv := []*Event{}
+	var marks Watermarks
+	for _, j := range jobs {
+		if j.DbModified.After(marks.Jobs) {
+			marks.Jobs = j.DbModified
+		}
+		if j.Created.Before(cutoff) {
+			continue
+		}
+		rv = append(rv, p.jobEvents(j)...)
+		p.jobs[j.Id] = makeJobState(j)
+	}
+	return rv, marks
+}
+
+// expire forgets about Tasks and Jobs which were created before the window.
+func (p *Publisher) expire(now time.Time) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	cutoff := now.Add(-p.window)
+	for id, t := range p.tasks {
+		if t.created.Before(cutoff) {
+			delete(p.tasks, id)
+		}
+	}
+	for id, j := range p.jobs {
+		if j.created.Before(cutoff) {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+// send sends the given Events to the Sink, along with any Events which
+// previously failed to send. If sending fails, the Events are kept to be
+// retried later. The given Watermarks cover the given Events; once every
+// pending Event has been sent, the Watermarks are stored.
+func (p *Publisher) send(ctx context.Context, events []*Event, marks Watermarks) {
+	p.pendingMtx.Lock()
+	defer p.pendingMtx.Unlock()
+	p.pending = append(p.pending, events...)
+	p.nextMarks.merge(marks)
+	if len(p.pending) == 0 {
+		p.storeMarks()
+		return
+	}
+	if err := p.sink.Send(ctx, p.pending); err != nil {
+		sklog.Errorf("Failed to publish %d events: %s", len(p.pending), err)
+		p.errors.Inc(1)
+		if drop := len(p.pending) - MAX_PENDING_EVENTS; drop > 0 {
+			sklog.Errorf("Too many pending events; dropping the oldest %d.", drop)
+			p.dropped.Inc(int64(drop))
+			p.pending = append([]*Event{}, p.pending[drop:]...)
+		}
+		return
+	}
+	p.published.Inc(int64(len(p.pending)))
+	p.pending = nil
+	p.storeMarks()
+}
+
+// storeMarks stores the Watermarks if they have advanced. Assumes the caller
+// holds p.pendingMtx and that there are no pending Events.
+func (p *Publisher) storeMarks() {
+	if p.marks == nil || p.nextMarks == p.savedMarks {
+		return
+	}
+	if err := p.marks.Put(p.nextMarks); err != nil {
+		sklog.Errorf("Failed to store watermarks: %s", err)
+		return
+	}
+	p.savedMarks = p.nextMarks
+}
+
+// Start loads the initial state from the DB and starts goroutines which
+// publish Events for modified Tasks and Jobs until the Context is canceled.
+func (p *Publisher) Start(ctx context.Context, d db.RemoteDB) error {
+	// Subscribe to modifications before loading the initial state, so that
+	// nothing modified in between is missed. Modifications which are
+	// already reflected in the initial state do not produce Events, since
+	// Tasks and Jobs only move forward through their states.
+	tasksCh := d.ModifiedTasksCh(ctx)
+	jobsCh := d.ModifiedJobsCh(ctx)
+	replay, err := p.Init(d, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(replay) > 0 {
+		sklog.Infof("Replaying %d events for modifications since the last run.", len(replay))
+	}
+	p.send(ctx, replay, Watermarks{})
+	go func() {
+		for tasks := range tasksCh {
+			events, marks := p.processTasks(tasks, time.Now())
+			p.send(ctx, events, marks)
+		}
+	}()
+	go func() {
+		for jobs := range jobsCh {
+			events, marks := p.processJobs(jobs, time.Now())
+			p.send(ctx, events, marks)
+		}
+	}()
+	go util.RepeatCtx(RETRY_PERIOD, ctx, func(ctx context.Context) {
+		p.send(ctx, nil, Watermarks{})
+	})
+	go util.RepeatCtx(time.Hour, ctx, func(ctx context.Context) {
+		p.expire(time.Now())
+	})
+	return nil
+}
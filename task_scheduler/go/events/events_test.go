@@ -0,0 +1,379 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/db/memory"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+// fakeSink is a Sink which records the Events sent to it.
+type fakeSink struct {
+	events []*Event
+	// If set, Send returns this error.
+	err error
+}
+
+func (s *fakeSink) Send(_ context.Context, events []*Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	return nil
+}
+
+func TestTaskTransitions(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1572000000, 0).UTC()
+	task := &types.Task{
+		Id:             "task1",
+		Created:        now,
+		SwarmingTaskId: "swarm1",
+	}
+	require.Equal(t, []string{EVENT_CREATED, EVENT_TRIGGERED}, taskTransitions(nil, task))
+	prev := makeTaskState(task)
+	require.Equal(t, []string{}, taskTransitions(prev, task))
+
+	task.Status = types.TASK_STATUS_RUNNING
+	task.Started = now.Add(time.Minute)
+	require.Equal(t, []string{EVENT_STARTED}, taskTransitions(prev, task))
+	prev = makeTaskState(task)
+	require.Equal(t, []string{}, taskTransitions(prev, task))
+
+	task.Status = types.TASK_STATUS_FAILURE
+	require.Equal(t, []string{EVENT_FINISHED}, taskTransitions(prev, task))
+	require.Equal(t, []string{}, taskTransitions(makeTaskState(task), task))
+
+	// A short task which finished before we saw it running.
+	require.Equal(t, []string{EVENT_STARTED, EVENT_FINISHED}, taskTransitions(&taskState{swarmingTaskId: "swarm1"}, task))
+
+	// A retry.
+	retry := &types.Task{
+		Id:      "task2",
+		RetryOf: "task1",
+	}
+	require.Equal(t, []string{EVENT_CREATED, EVENT_RETRIED}, taskTransitions(nil, retry))
+}
+
+func TestJobTransitions(t *testing.T) {
+	unittest.SmallTest(t)
+
+	job := &types.Job{Id: "job1"}
+	require.Equal(t, []string{EVENT_CREATED}, jobTransitions(nil, job))
+	prev := makeJobState(job)
+	require.Equal(t, []string{}, jobTransitions(prev, job))
+
+	job.Status = types.JOB_STATUS_SUCCESS
+	require.Equal(t, []string{EVENT_FINISHED}, jobTransitions(prev, job))
+	require.Equal(t, []string{}, jobTransitions(makeJobState(job), job))
+
+	job.Status = types.JOB_STATUS_CANCELED
+	require.Equal(t, []string{EVENT_CANCELED}, jobTransitions(prev, job))
+}
+
+func TestPublisher(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1572000000, 0).UTC()
+	sink := &fakeSink{}
+	p := NewPublisher(sink, 24*time.Hour, nil)
+	ctx := context.Background()
+	send := func(events []*Event, marks Watermarks) {
+		p.send(ctx, events, marks)
+	}
+
+	task := &types.Task{
+		Id:         "task1",
+		Created:    now,
+		DbModified: now,
+		TaskKey: types.TaskKey{
+			RepoState: types.RepoState{
+				Repo:     "fake.git",
+				Revision: "abc123",
+			},
+			Name: "Build",
+		},
+		SwarmingTaskId: "swarm1",
+	}
+	// Tasks created before the window are ignored.
+	old := task.Copy()
+	old.Id = "old"
+	old.Created = now.Add(-48 * time.Hour)
+	send(p.processTasks([]*types.Task{task, old}, now))
+	require.Equal(t, 2, len(sink.events))
+	require.Equal(t, KIND_TASK, sink.events[0].Kind)
+	require.Equal(t, EVENT_CREATED, sink.events[0].Type)
+	require.Equal(t, EVENT_TRIGGERED, sink.events[1].Type)
+	require.Equal(t, "task1", sink.events[1].Id)
+	require.Equal(t, "Build", sink.events[1].Name)
+	require.Equal(t, "fake.git", sink.events[1].Repo)
+	require.Equal(t, "abc123", sink.events[1].Revision)
+	require.Equal(t, task, sink.events[1].Task)
+
+	// No transitions, no events.
+	send(p.processTasks([]*types.Task{task}, now))
+	require.Equal(t, 2, len(sink.events))
+
+	job := &types.Job{
+		Id:      "job1",
+		Created: now,
+		Name:    "Build-Job",
+		Status:  types.JOB_STATUS_SUCCESS,
+	}
+	send(p.processJobs([]*types.Job{job}, now))
+	require.Equal(t, 4, len(sink.events))
+	require.Equal(t, KIND_JOB, sink.events[2].Kind)
+	require.Equal(t, EVENT_CREATED, sink.events[2].Type)
+	require.Equal(t, EVENT_FINISHED, sink.events[3].Type)
+	require.Equal(t, string(types.JOB_STATUS_SUCCESS), sink.events[3].Status)
+
+	// Expired entries are forgotten.
+	p.expire(now.Add(25 * time.Hour))
+	require.Equal(t, 0, len(p.tasks))
+	require.Equal(t, 0, len(p.jobs))
+}
+
+func TestPublisherRetry(t *testing.T) {
+	unittest.SmallTest(t)
+
+	sink := &fakeSink{
+		err: errors.New("unavailable"),
+	}
+	p := NewPublisher(sink, 24*time.Hour, nil)
+	ctx := context.Background()
+
+	// Events which fail to send are kept.
+	e1 := &Event{Id: "1"}
+	e2 := &Event{Id: "2"}
+	p.send(ctx, []*Event{e1}, Watermarks{})
+	p.send(ctx, []*Event{e2}, Watermarks{})
+	require.Equal(t, 0, len(sink.events))
+	require.Equal(t, []*Event{e1, e2}, p.pending)
+
+	// Once the Sink recovers, the pending Events are sent in order.
+	sink.err = nil
+	p.send(ctx, nil, Watermarks{})
+	require.Equal(t, []*Event{e1, e2}, sink.events)
+	require.Equal(t, 0, len(p.pending))
+
+	// If too many Events are pending, the oldest are dropped.
+	sink.err = errors.New("unavailable")
+	sink.events = nil
+	for i := 0; i < MAX_PENDING_EVENTS; i++ {
+		p.send(ctx, []*Event{{}}, Watermarks{})
+	}
+	p.send(ctx, []*Event{e1, e2}, Watermarks{})
+	require.Equal(t, MAX_PENDING_EVENTS, len(p.pending))
+	require.Equal(t, e2, p.pending[MAX_PENDING_EVENTS-1])
+	require.Equal(t, e1, p.pending[MAX_PENDING_EVENTS-2])
+}
+
+func TestPublisherStart(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := memory.NewInMemoryDB()
+	existing := &types.Task{
+		Created:        time.Now(),
+		SwarmingTaskId: "swarm1",
+	}
+	require.NoError(t, d.PutTask(existing))
+
+	sink := &syncSink{}
+	p := NewPublisher(sink, 24*time.Hour, nil)
+	require.NoError(t, p.Start(ctx, d))
+
+	// Modifying a Task which existed before the Publisher started produces
+	// only the Events for the new transition.
+	existing.Status = types.TASK_STATUS_RUNNING
+	existing.Started = time.Now()
+	require.NoError(t, d.PutTask(existing))
+	require.NoError(t, testutils.EventuallyConsistent(10*time.Second, func() error {
+		if len(sink.get()) == 0 {
+			return testutils.TryAgainErr
+		}
+		return nil
+	}))
+	events := sink.get()
+	require.Equal(t, 1, len(events))
+	require.Equal(t, EVENT_STARTED, events[0].Type)
+	require.Equal(t, existing.Id, events[0].Id)
+}
+
+// syncSink is a Sink which records the Events sent to it and may be used
+// from multiple goroutines.
+type syncSink struct {
+	events []*Event
+	mtx    sync.Mutex
+}
+
+func (s *syncSink) Send(_ context.Context, events []*Event) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *syncSink) Close() error {
+	return nil
+}
+
+func (s *syncSink) get() []*Event {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]*Event{}, s.events...)
+}
+
+// memWatermarkStore is a WatermarkStore which keeps Watermarks in memory.
+type memWatermarkStore struct {
+	marks Watermarks
+	puts  int
+}
+
+func (s *memWatermarkStore) Get() (Watermarks, error) {
+	return s.marks, nil
+}
+
+func (s *memWatermarkStore) Put(w Watermarks) error {
+	s.marks = w
+	s.puts++
+	return nil
+}
+
+func TestFileWatermarkStore(t *testing.T) {
+	unittest.SmallTest(t)
+
+	wd, cleanup := testutils.TempDir(t)
+	defer cleanup()
+	s := NewFileWatermarkStore(filepath.Join(wd, "marks.json"))
+	marks, err := s.Get()
+	require.NoError(t, err)
+	require.Equal(t, Watermarks{}, marks)
+
+	expect := Watermarks{
+		Tasks: time.Unix(1572000000, 0).UTC(),
+		Jobs:  time.Unix(1572000001, 0).UTC(),
+	}
+	require.NoError(t, s.Put(expect))
+	marks, err = NewFileWatermarkStore(filepath.Join(wd, "marks.json")).Get()
+	require.NoError(t, err)
+	require.Equal(t, expect, marks)
+}
+
+func TestPublisherWatermarks(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1572000000, 0).UTC()
+	sink := &fakeSink{
+		err: errors.New("unavailable"),
+	}
+	store := &memWatermarkStore{}
+	p := NewPublisher(sink, 24*time.Hour, store)
+	ctx := context.Background()
+	task := &types.Task{
+		Id:         "task1",
+		Created:    now,
+		DbModified: now,
+	}
+	job := &types.Job{
+		Id:         "job1",
+		Created:    now,
+		DbModified: now.Add(time.Second),
+	}
+
+	// Watermarks aren't stored until their Events are sent.
+	events, marks := p.processTasks([]*types.Task{task}, now)
+	p.send(ctx, events, marks)
+	require.Equal(t, 0, store.puts)
+	sink.err = nil
+	events, marks = p.processJobs([]*types.Job{job}, now)
+	p.send(ctx, events, marks)
+	require.Len(t, sink.events, 2)
+	require.Equal(t, Watermarks{Tasks: task.DbModified, Jobs: job.DbModified}, store.marks)
+	require.Equal(t, 1, store.puts)
+
+	// Modifications without transitions advance the Watermarks too.
+	task.DbModified = now.Add(time.Minute)
+	events, marks = p.processTasks([]*types.Task{task}, now)
+	p.send(ctx, events, marks)
+	require.Len(t, sink.events, 2)
+	require.Equal(t, task.DbModified, store.marks.Tasks)
+	require.Equal(t, 2, store.puts)
+
+	// The Watermarks aren't stored again if they haven't changed.
+	p.send(ctx, nil, Watermarks{})
+	require.Equal(t, 2, store.puts)
+}
+
+func TestPublisherReplay(t *testing.T) {
+	unittest.SmallTest(t)
+
+	d := memory.NewInMemoryDB()
+	put := func(task *types.Task) {
+		require.NoError(t, d.PutTask(task))
+	}
+
+	// "old" was published before the Publisher last stopped, and "running"
+	// had been published as running.
+	old := &types.Task{
+		Created:        time.Now(),
+		SwarmingTaskId: "swarm1",
+		Status:         types.TASK_STATUS_SUCCESS,
+	}
+	put(old)
+	running := &types.Task{
+		Created:        time.Now(),
+		SwarmingTaskId: "swarm2",
+		Started:        time.Now(),
+		Status:         types.TASK_STATUS_RUNNING,
+	}
+	put(running)
+	store := &memWatermarkStore{
+		marks: Watermarks{
+			Tasks: time.Now().Add(REPLAY_OVERLAP),
+		},
+	}
+
+	// While the Publisher was stopped, "running" finished and "created"
+	// was created.
+	running.Status = types.TASK_STATUS_FAILURE
+	put(running)
+	created := &types.Task{
+		Created: time.Now(),
+	}
+	put(created)
+
+	sink := &fakeSink{}
+	p := NewPublisher(sink, 24*time.Hour, store)
+	replay, err := p.Init(d, time.Now())
+	require.NoError(t, err)
+	transitions := map[string][]string{}
+	for _, e := range replay {
+		transitions[e.Id] = append(transitions[e.Id], e.Type)
+	}
+	// We don't know which transitions of "running" were published, so
+	// they're all published again.
+	require.Equal(t, map[string][]string{
+		running.Id: {EVENT_TRIGGERED, EVENT_STARTED, EVENT_FINISHED},
+		created.Id: {EVENT_CREATED},
+	}, transitions)
+
+	// Without Watermarks, there's nothing to replay.
+	replay, err = NewPublisher(sink, 24*time.Hour, &memWatermarkStore{}).Init(d, time.Now())
+	require.NoError(t, err)
+	require.Len(t, replay, 0)
+}
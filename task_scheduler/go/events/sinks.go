@@ -0,0 +1,242 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+	"go.skia.org/infra/go/httputils"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+const (
+	// Prefixes of Sink URLs. See NewSink.
+	SINK_PREFIX_FILE   = "file://"
+	SINK_PREFIX_HTTP   = "http://"
+	SINK_PREFIX_HTTPS  = "https://"
+	SINK_PREFIX_PUBSUB = "pubsub://"
+
+	// Attributes of PubSub messages.
+	PUBSUB_ATTR_ID   = "id"
+	PUBSUB_ATTR_KIND = "kind"
+	PUBSUB_ATTR_TYPE = "type"
+
+	// Maximum size of the body of each request made by a WebhookSink. A
+	// single Event which is larger than this is sent in a request of its
+	// own.
+	WEBHOOK_MAX_REQUEST_BYTES = 1024 * 1024
+)
+
+// Sink is a destination for Events.
+type Sink interface {
+	// Send the given Events.
+	Send(context.Context, []*Event) error
+
+	// Close the Sink.
+	Close() error
+}
+
+// NewSink returns a Sink based on the given URL, which is one of:
+//
+//   - "pubsub://<project>/<topic>": Publish each Event as a JSON-encoded
+//     PubSub message. The topic is created if necessary.
+//   - "http://..." or "https://...": POST each batch of Events to the URL as
+//     a JSON list, split into requests of at most WEBHOOK_MAX_REQUEST_BYTES.
+//   - "file://<path>": Append each Event to the file as a line of JSON.
+func NewSink(ctx context.Context, url string, c *http.Client, ts oauth2.TokenSource) (Sink, error) {
+	if strings.HasPrefix(url, SINK_PREFIX_PUBSUB) {
+		split := strings.SplitN(strings.TrimPrefix(url, SINK_PREFIX_PUBSUB), "/", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return nil, fmt.Errorf("Invalid PubSub sink %q; expected pubsub://<project>/<topic>", url)
+		}
+		return NewPubSubSink(ctx, split[0], split[1], ts)
+	} else if strings.HasPrefix(url, SINK_PREFIX_HTTP) || strings.HasPrefix(url, SINK_PREFIX_HTTPS) {
+		return NewWebhookSink(url, c), nil
+	} else if strings.HasPrefix(url, SINK_PREFIX_FILE) {
+		return NewFileSink(strings.TrimPrefix(url, SINK_PREFIX_FILE))
+	}
+	return nil, fmt.Errorf("Unknown event sink %q; expected one of %s, %s, %s, or %s", url, SINK_PREFIX_PUBSUB, SINK_PREFIX_HTTP, SINK_PREFIX_HTTPS, SINK_PREFIX_FILE)
+}
+
+// PubSubSink is a Sink which publishes Events to a PubSub topic.
+type PubSubSink struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+// NewPubSubSink returns a Sink which publishes Events to the given PubSub
+// topic, creating it if necessary.
+func NewPubSubSink(ctx context.Context, project, topic string, ts oauth2.TokenSource) (*PubSubSink, error) {
+	c, err := pubsub.NewClient(ctx, project, option.WithTokenSource(ts))
+	if err != nil {
+		return nil, err
+	}
+	t := c.Topic(topic)
+	exists, err := t.Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if _, err := c.CreateTopic(ctx, topic); err != nil {
+			return nil, err
+		}
+	}
+	return &PubSubSink{
+		client: c,
+		topic:  t,
+	}, nil
+}
+
+// See documentation for Sink interface.
+func (s *PubSubSink) Send(ctx context.Context, events []*Event) error {
+	results := make([]*pubsub.PublishResult, 0, len(events))
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		results = append(results, s.topic.Publish(ctx, &pubsub.Message{
+			Attributes: map[string]string{
+				PUBSUB_ATTR_ID:   e.Id,
+				PUBSUB_ATTR_KIND: e.Kind,
+				PUBSUB_ATTR_TYPE: e.Type,
+			},
+			Data: b,
+		}))
+	}
+	for _, r := range results {
+		if _, err := r.Get(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// See documentation for Sink interface.
+func (s *PubSubSink) Close() error {
+	s.topic.Stop()
+	return s.client.Close()
+}
+
+// WebhookSink is a Sink which POSTs Events to a URL.
+type WebhookSink struct {
+	client   *http.Client
+	maxBytes int
+	url      string
+}
+
+// NewWebhookSink returns a Sink which POSTs each batch of Events to the given
+// URL as JSON lists of at most WEBHOOK_MAX_REQUEST_BYTES.
+func NewWebhookSink(url string, c *http.Client) *WebhookSink {
+	return &WebhookSink{
+		client:   c,
+		maxBytes: WEBHOOK_MAX_REQUEST_BYTES,
+		url:      url,
+	}
+}
+
+// See documentation for Sink interface. If one request fails, the Events in
+// the earlier requests have already been sent.
+func (s *WebhookSink) Send(ctx context.Context, events []*Event) error {
+	var buf bytes.Buffer
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		// Account for the brackets and separating comma.
+		if buf.Len() > 0 && buf.Len()+len(b)+2 > s.maxBytes {
+			if err := s.post(ctx, buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() == 0 {
+			buf.WriteString("[")
+		} else {
+			buf.WriteString(",")
+		}
+		buf.Write(b)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return s.post(ctx, buf.Bytes())
+}
+
+// post sends the given JSON list of Events, without its closing bracket.
+func (s *WebhookSink) post(ctx context.Context, list []byte) error {
+	b := append(list, ']')
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	body := httputils.ReadAndClose(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook %s returned status %d: %s", s.url, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// See documentation for Sink interface.
+func (s *WebhookSink) Close() error {
+	return nil
+}
+
+// FileSink is a Sink which appends Events to a local file as newline-delimited
+// JSON.
+type FileSink struct {
+	enc *json.Encoder
+	f   *os.File
+	mtx sync.Mutex
+}
+
+// NewFileSink returns a Sink which appends Events to the given file, creating
+// it if necessary.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{
+		enc: json.NewEncoder(f),
+		f:   f,
+	}, nil
+}
+
+// See documentation for Sink interface.
+func (s *FileSink) Send(_ context.Context, events []*Event) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, e := range events {
+		// json.Encoder writes a newline after each value.
+		if err := s.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// See documentation for Sink interface.
+func (s *FileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.f.Close()
+}
+
+// Ensure that the Sinks implement the interface.
+var _ Sink = &PubSubSink{}
+var _ Sink = &WebhookSink{}
+var _ Sink = &FileSink{}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func makeEvents() []*Event {
+	ts := time.Unix(1572000000, 0).UTC()
+	return []*Event{
+		{
+			Kind:      KIND_TASK,
+			Type:      EVENT_CREATED,
+			Id:        "task1",
+			Timestamp: ts,
+		},
+		{
+			Kind:      KIND_JOB,
+			Type:      EVENT_FINISHED,
+			Id:        "job1",
+			Timestamp: ts,
+		},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	unittest.SmallTest(t)
+
+	wd, cleanup := testutils.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(wd, "events.ndjson")
+	s, err := NewSink(context.Background(), SINK_PREFIX_FILE+path, nil, nil)
+	require.NoError(t, err)
+	expect := makeEvents()
+	require.NoError(t, s.Send(context.Background(), expect[:1]))
+	require.NoError(t, s.Send(context.Background(), expect[1:]))
+	require.NoError(t, s.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer testutils.AssertCloses(t, f)
+	actual := []*Event{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		actual = append(actual, &e)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, expect, actual)
+}
+
+func TestWebhookSink(t *testing.T) {
+	unittest.SmallTest(t)
+
+	var received []*Event
+	requests := 0
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		var events []*Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+		received = append(received, events...)
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s, err := NewSink(context.Background(), srv.URL, http.DefaultClient, nil)
+	require.NoError(t, err)
+	expect := makeEvents()
+	require.NoError(t, s.Send(context.Background(), expect))
+	require.Equal(t, expect, received)
+	require.Equal(t, 1, requests)
+
+	// Large batches are split into multiple requests, each of which has
+	// at least one Event.
+	received = nil
+	requests = 0
+	s.(*WebhookSink).maxBytes = 1
+	require.NoError(t, s.Send(context.Background(), expect))
+	require.Equal(t, expect, received)
+	require.Equal(t, len(expect), requests)
+
+	// Nothing to send.
+	requests = 0
+	require.NoError(t, s.Send(context.Background(), nil))
+	require.Equal(t, 0, requests)
+
+	status = http.StatusInternalServerError
+	require.Error(t, s.Send(context.Background(), expect))
+	require.Equal(t, 1, requests)
+}
+
+func TestNewSinkInvalid(t *testing.T) {
+	unittest.SmallTest(t)
+
+	_, err := NewSink(context.Background(), "bogus", nil, nil)
+	require.EqualError(t, err, "Unknown event sink \"bogus\"; expected one of pubsub://, http://, https://, or file://")
+	_, err = NewSink(context.Background(), "pubsub://project", nil, nil)
+	require.EqualError(t, err, "Invalid PubSub sink \"pubsub://project\"; expected pubsub://<project>/<topic>")
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/util"
+)
+
+// Watermarks record how far the Publisher has published Events: every
+// modification of a Task or Job with a DbModified timestamp no later than the
+// corresponding watermark has been sent to the Sink.
+type Watermarks struct {
+	Tasks time.Time `json:"tasks"`
+	Jobs  time.Time `json:"jobs"`
+}
+
+// merge advances the Watermarks to the later of their current values and the
+// given values.
+func (w *Watermarks) merge(other Watermarks) {
+	if other.Tasks.After(w.Tasks) {
+		w.Tasks = other.Tasks
+	}
+	if other.Jobs.After(w.Jobs) {
+		w.Jobs = other.Jobs
+	}
+}
+
+// WatermarkStore persists Watermarks across restarts of the Publisher.
+type WatermarkStore interface {
+	// Get returns the most recently stored Watermarks, or zero Watermarks
+	// if none have been stored.
+	Get() (Watermarks, error)
+
+	// Put stores the given Watermarks.
+	Put(Watermarks) error
+}
+
+// fileWatermarkStore is a WatermarkStore which stores Watermarks in a local
+// JSON file.
+type fileWatermarkStore struct {
+	mtx  sync.Mutex
+	path string
+}
+
+// NewFileWatermarkStore returns a WatermarkStore which stores Watermarks in the
+// given file.
+func NewFileWatermarkStore(path string) WatermarkStore {
+	return &fileWatermarkStore{
+		path: path,
+	}
+}
+
+// See documentation for WatermarkStore interface.
+func (s *fileWatermarkStore) Get() (Watermarks, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var rv Watermarks
+	err := util.WithReadFile(s.path, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&rv)
+	})
+	if os.IsNotExist(err) {
+		return Watermarks{}, nil
+	}
+	return rv, err
+}
+
+// See documentation for WatermarkStore interface.
+func (s *fileWatermarkStore) Put(w Watermarks) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return util.WithWriteFile(s.path, func(wr io.Writer) error {
+		return json.NewEncoder(wr).Encode(w)
+	})
+}
@@ -42,3 +42,50 @@ func FindFlakes(tasks []*types.Task) []*types.Task {
 	}
 	return flaky
 }
+
+// FlakeRate describes how often the tasks for a TaskSpec failed flakily.
+type FlakeRate struct {
+	Repo  string `json:"repo"`
+	Name  string `json:"name"`
+	Flaky int    `json:"flaky"`
+	Total int    `json:"total"`
+}
+
+// Rate returns the fraction of finished tasks which were flaky.
+func (r *FlakeRate) Rate() float64 {
+	if r.Total == 0 {
+		return 0.0
+	}
+	return float64(r.Flaky) / float64(r.Total)
+}
+
+// FindFlakeRates returns the FlakeRate for each TaskSpec in the given slice of
+// tasks, keyed by repo and TaskSpec name.
+func FindFlakeRates(tasks []*types.Task) map[string]map[string]*FlakeRate {
+	rv := map[string]map[string]*FlakeRate{}
+	get := func(task *types.Task) *FlakeRate {
+		byName, ok := rv[task.Repo]
+		if !ok {
+			byName = map[string]*FlakeRate{}
+			rv[task.Repo] = byName
+		}
+		r, ok := byName[task.Name]
+		if !ok {
+			r = &FlakeRate{
+				Repo: task.Repo,
+				Name: task.Name,
+			}
+			byName[task.Name] = r
+		}
+		return r
+	}
+	for _, task := range tasks {
+		if task.Done() {
+			get(task).Total++
+		}
+	}
+	for _, task := range FindFlakes(tasks) {
+		get(task).Flaky++
+	}
+	return rv
+}
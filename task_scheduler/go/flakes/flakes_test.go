@@ -0,0 +1,61 @@
+package flakes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+func TestFindFlakeRates(t *testing.T) {
+	unittest.SmallTest(t)
+
+	const repo = "fake.git"
+	task := func(id, name, revision string, status types.TaskStatus) *types.Task {
+		return &types.Task{
+			Id: id,
+			TaskKey: types.TaskKey{
+				RepoState: types.RepoState{
+					Repo:     repo,
+					Revision: revision,
+				},
+				Name: name,
+			},
+			Status: status,
+		}
+	}
+	tasks := []*types.Task{
+		// Failed, then succeeded on retry: one flake.
+		task("1", "Test", "a", types.TASK_STATUS_FAILURE),
+		task("2", "Test", "a", types.TASK_STATUS_SUCCESS),
+		// Mishaps are always flakes.
+		task("3", "Test", "b", types.TASK_STATUS_MISHAP),
+		// Consistent failure is not a flake.
+		task("4", "Test", "c", types.TASK_STATUS_FAILURE),
+		task("5", "Test", "c", types.TASK_STATUS_FAILURE),
+		// Unfinished tasks are ignored.
+		task("6", "Test", "d", types.TASK_STATUS_RUNNING),
+		task("7", "Build", "a", types.TASK_STATUS_SUCCESS),
+	}
+	rates := FindFlakeRates(tasks)
+	require.Equal(t, map[string]map[string]*FlakeRate{
+		repo: {
+			"Build": {
+				Repo:  repo,
+				Name:  "Build",
+				Flaky: 0,
+				Total: 1,
+			},
+			"Test": {
+				Repo:  repo,
+				Name:  "Test",
+				Flaky: 2,
+				Total: 5,
+			},
+		},
+	}, rates)
+	require.Equal(t, 0.4, rates[repo]["Test"].Rate())
+	require.Equal(t, 0.0, rates[repo]["Build"].Rate())
+	require.Equal(t, 0.0, (&FlakeRate{}).Rate())
+}
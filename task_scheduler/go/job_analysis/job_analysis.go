@@ -0,0 +1,391 @@
+package job_analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+// MAX_TIME_RANGE is the longest time range which may be given to
+// AnalyzeJobSpec, which limits the number of Jobs and Tasks it retrieves.
+const MAX_TIME_RANGE = 7 * 24 * time.Hour
+
+// TaskAnalysis describes the time spent on one TaskSpec of a Job, across all
+// attempts. Unfinished Tasks are considered to end at the time of analysis.
+type TaskAnalysis struct {
+	Name    string   `json:"name"`
+	TaskIds []string `json:"taskIds"`
+	// Ready is the time at which all of the TaskSpec's dependencies
+	// finished, or the creation time of the Job if it has none.
+	Ready time.Time `json:"ready"`
+	// Created is the creation time of the first attempt.
+	Created time.Time `json:"created"`
+	// Finished is the finish time of the last attempt.
+	Finished time.Time `json:"finished"`
+	// SchedulingTime is the time between Ready and Created, ie. the time
+	// the Task Scheduler took to trigger the first attempt.
+	SchedulingTime time.Duration `json:"schedulingTime"`
+	// PendingTime is the total time the attempts spent waiting for a bot.
+	PendingTime time.Duration `json:"pendingTime"`
+	// RunningTime is the total time the attempts spent running.
+	RunningTime time.Duration `json:"runningTime"`
+	// TotalTime is the time between Ready and Finished.
+	TotalTime time.Duration `json:"totalTime"`
+}
+
+// JobAnalysis describes where the time was spent for a Job.
+type JobAnalysis struct {
+	Id       string        `json:"id"`
+	Name     string        `json:"name"`
+	Created  time.Time     `json:"created"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration"`
+	// CriticalPath lists the TaskSpecs, in order of execution, along the
+	// chain of dependencies which determined when the Job finished.
+	CriticalPath []string `json:"criticalPath"`
+	// CriticalPathTime is the total time spent on the critical path. Any
+	// remaining Duration was spent after the last Task finished.
+	CriticalPathTime time.Duration            `json:"criticalPathTime"`
+	Tasks            map[string]*TaskAnalysis `json:"tasks"`
+}
+
+// AnalyzeJob computes the timeline of the given Job using the given Tasks,
+// keyed by TaskSpec name. Unfinished Tasks and Jobs are considered to end at
+// the given time.
+func AnalyzeJob(job *types.Job, tasks map[string][]*types.Task, now time.Time) (*JobAnalysis, error) {
+	rv := &JobAnalysis{
+		Id:       job.Id,
+		Name:     job.Name,
+		Created:  job.Created,
+		Finished: job.Finished,
+		Tasks:    make(map[string]*TaskAnalysis, len(job.Dependencies)),
+	}
+	if !job.Done() || util.TimeIsZero(rv.Finished) {
+		rv.Finished = now
+	}
+	rv.Duration = rv.Finished.Sub(rv.Created)
+
+	// Visit the TaskSpecs in dependency order, so that each TaskSpec's
+	// Ready time is known when we visit it.
+	if err := job.TraverseDependencies(func(name string) error {
+		ta := &TaskAnalysis{
+			Name:  name,
+			Ready: job.Created,
+		}
+		for _, dep := range job.Dependencies[name] {
+			d, ok := rv.Tasks[dep]
+			if !ok {
+				return fmt.Errorf("Dependency %q of %q was not visited.", dep, name)
+			}
+			if d.Finished.After(ta.Ready) {
+				ta.Ready = d.Finished
+			}
+		}
+		attempts := make([]*types.Task, len(tasks[name]))
+		copy(attempts, tasks[name])
+		sort.Sort(types.TaskSlice(attempts))
+		ta.Finished = ta.Ready
+		for i, t := range attempts {
+			ta.TaskIds = append(ta.TaskIds, t.Id)
+			if i == 0 {
+				ta.Created = t.Created
+			}
+			started := t.Started
+			if util.TimeIsZero(started) {
+				started = now
+			}
+			finished := t.Finished
+			if util.TimeIsZero(finished) {
+				finished = now
+			}
+			if started.Before(t.Created) {
+				started = t.Created
+			}
+			if finished.Before(started) {
+				finished = started
+			}
+			ta.PendingTime += started.Sub(t.Created)
+			ta.RunningTime += finished.Sub(started)
+			if finished.After(ta.Finished) {
+				ta.Finished = finished
+			}
+		}
+		if len(attempts) > 0 && ta.Created.After(ta.Ready) {
+			ta.SchedulingTime = ta.Created.Sub(ta.Ready)
+		}
+		ta.TotalTime = ta.Finished.Sub(ta.Ready)
+		rv.Tasks[name] = ta
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Trace the critical path backward from the last TaskSpec to finish,
+	// following the dependency which finished last.
+	// TaskSpecs which never ran, eg. because a dependency failed, are not
+	// considered.
+	var last *TaskAnalysis
+	for _, ta := range rv.Tasks {
+		if len(ta.TaskIds) == 0 {
+			continue
+		}
+		if last == nil || ta.Finished.After(last.Finished) || (ta.Finished.Equal(last.Finished) && ta.Name < last.Name) {
+			last = ta
+		}
+	}
+	path := []string{}
+	for last != nil {
+		path = append(path, last.Name)
+		rv.CriticalPathTime += last.TotalTime
+		var next *TaskAnalysis
+		for _, dep := range job.Dependencies[last.Name] {
+			d := rv.Tasks[dep]
+			if len(d.TaskIds) == 0 {
+				continue
+			}
+			if next == nil || d.Finished.After(next.Finished) || (d.Finished.Equal(next.Finished) && d.Name < next.Name) {
+				next = d
+			}
+		}
+		last = next
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	rv.CriticalPath = path
+	return rv, nil
+}
+
+// Percentiles summarizes a set of durations.
+type Percentiles struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// makePercentiles returns Percentiles for the given durations, using the
+// nearest-rank method.
+func makePercentiles(durations []time.Duration) *Percentiles {
+	rv := &Percentiles{
+		Count: len(durations),
+	}
+	if len(durations) == 0 {
+		return rv
+	}
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	rank := func(p float64) time.Duration {
+		idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return sorted[idx]
+	}
+	rv.Mean = total / time.Duration(len(sorted))
+	rv.P50 = rank(0.5)
+	rv.P90 = rank(0.9)
+	rv.P99 = rank(0.99)
+	rv.Max = sorted[len(sorted)-1]
+	return rv
+}
+
+// TaskSpecAggregate summarizes the time spent on a TaskSpec across many Jobs.
+type TaskSpecAggregate struct {
+	Name           string       `json:"name"`
+	SchedulingTime *Percentiles `json:"schedulingTime"`
+	PendingTime    *Percentiles `json:"pendingTime"`
+	RunningTime    *Percentiles `json:"runningTime"`
+	TotalTime      *Percentiles `json:"totalTime"`
+	// CriticalPathCount is the number of Jobs for which the TaskSpec was
+	// on the critical path.
+	CriticalPathCount int `json:"criticalPathCount"`
+	// CriticalPathTime is the total time the TaskSpec contributed to the
+	// critical paths of the Jobs. TaskSpecs with the highest values are
+	// the best candidates to split or speed up.
+	CriticalPathTime time.Duration `json:"criticalPathTime"`
+}
+
+// Aggregate summarizes the JobAnalyses for many Jobs.
+type Aggregate struct {
+	Jobs     int                           `json:"jobs"`
+	Duration *Percentiles                  `json:"duration"`
+	Tasks    map[string]*TaskSpecAggregate `json:"tasks"`
+	// ByCriticalPathTime lists the TaskSpecs in decreasing order of
+	// CriticalPathTime.
+	ByCriticalPathTime []string `json:"byCriticalPathTime"`
+}
+
+// AggregateJobs summarizes the given JobAnalyses.
+func AggregateJobs(analyses []*JobAnalysis) *Aggregate {
+	durations := make([]time.Duration, 0, len(analyses))
+	type samples struct {
+		scheduling []time.Duration
+		pending    []time.Duration
+		running    []time.Duration
+		total      []time.Duration
+	}
+	byName := map[string]*samples{}
+	rv := &Aggregate{
+		Jobs:  len(analyses),
+		Tasks: map[string]*TaskSpecAggregate{},
+	}
+	for _, a := range analyses {
+		durations = append(durations, a.Duration)
+		for name, ta := range a.Tasks {
+			s, ok := byName[name]
+			if !ok {
+				s = &samples{}
+				byName[name] = s
+				rv.Tasks[name] = &TaskSpecAggregate{Name: name}
+			}
+			s.scheduling = append(s.scheduling, ta.SchedulingTime)
+			s.pending = append(s.pending, ta.PendingTime)
+			s.running = append(s.running, ta.RunningTime)
+			s.total = append(s.total, ta.TotalTime)
+		}
+		for _, name := range a.CriticalPath {
+			rv.Tasks[name].CriticalPathCount++
+			rv.Tasks[name].CriticalPathTime += a.Tasks[name].TotalTime
+		}
+	}
+	rv.Duration = makePercentiles(durations)
+	for name, s := range byName {
+		agg := rv.Tasks[name]
+		agg.SchedulingTime = makePercentiles(s.scheduling)
+		agg.PendingTime = makePercentiles(s.pending)
+		agg.RunningTime = makePercentiles(s.running)
+		agg.TotalTime = makePercentiles(s.total)
+		rv.ByCriticalPathTime = append(rv.ByCriticalPathTime, name)
+	}
+	sort.Slice(rv.ByCriticalPathTime, func(i, j int) bool {
+		a := rv.Tasks[rv.ByCriticalPathTime[i]]
+		b := rv.Tasks[rv.ByCriticalPathTime[j]]
+		if a.CriticalPathTime == b.CriticalPathTime {
+			return a.Name < b.Name
+		}
+		return a.CriticalPathTime > b.CriticalPathTime
+	})
+	return rv
+}
+
+// getTasks retrieves the Tasks for the given Job, keyed by TaskSpec name.
+// Tasks found in the given map, which may be nil, are not retrieved from the
+// DB.
+func getTasks(d db.TaskReader, job *types.Job, known map[string]*types.Task) (map[string][]*types.Task, error) {
+	rv := make(map[string][]*types.Task, len(job.Tasks))
+	for name, summaries := range job.Tasks {
+		for _, s := range summaries {
+			t, ok := known[s.Id]
+			if !ok {
+				var err error
+				t, err = d.GetTaskById(s.Id)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to retrieve task %s: %s", s.Id, err)
+				}
+				if t == nil {
+					return nil, fmt.Errorf("Unknown task %s for job %s", s.Id, job.Id)
+				}
+			}
+			rv[name] = append(rv[name], t)
+		}
+	}
+	return rv, nil
+}
+
+// AnalyzeJobById retrieves the given Job and its Tasks from the DB and
+// analyzes it.
+func AnalyzeJobById(d db.RemoteDB, id string, now time.Time) (*JobAnalysis, error) {
+	job, err := d.GetJobById(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, db.ErrNotFound
+	}
+	tasks, err := getTasks(d, job, nil)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeJob(job, tasks, now)
+}
+
+// AnalyzeJobSpec retrieves the finished Jobs with the given name in the given
+// repo which were created within the given time range, analyzes each of them
+// and returns the aggregate. Try jobs are excluded, since their TaskSpecs may
+// differ from those at the tip of the repo. The time range may not exceed
+// MAX_TIME_RANGE.
+func AnalyzeJobSpec(d db.RemoteDB, repo, name string, start, end time.Time) (*Aggregate, []*JobAnalysis, error) {
+	if err := ValidateTimeRange(start, end); err != nil {
+		return nil, nil, err
+	}
+	jobs, err := d.GetJobsFromDateRange(start, end, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := []*types.Job{}
+	lastFinished := end
+	for _, job := range jobs {
+		if job.Name != name || !job.Done() || job.IsTryJob() {
+			continue
+		}
+		matched = append(matched, job)
+		if job.Finished.After(lastFinished) {
+			lastFinished = job.Finished
+		}
+	}
+	if len(matched) == 0 {
+		return AggregateJobs(nil), []*JobAnalysis{}, nil
+	}
+
+	// Retrieve the Tasks for all of the Jobs at once. Tasks are created
+	// after their Jobs, except for those which the Jobs reused from
+	// earlier, which are retrieved individually.
+	tasks, err := d.GetTasksFromDateRange(start, lastFinished.Add(time.Nanosecond), repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	known := make(map[string]*types.Task, len(tasks))
+	for _, t := range tasks {
+		known[t.Id] = t
+	}
+	analyses := make([]*JobAnalysis, 0, len(matched))
+	for _, job := range matched {
+		tasks, err := getTasks(d, job, known)
+		if err != nil {
+			return nil, nil, err
+		}
+		a, err := AnalyzeJob(job, tasks, job.Finished)
+		if err != nil {
+			return nil, nil, err
+		}
+		analyses = append(analyses, a)
+	}
+	return AggregateJobs(analyses), analyses, nil
+}
+
+// ValidateTimeRange returns an error if the given time range is not valid for
+// AnalyzeJobSpec.
+func ValidateTimeRange(start, end time.Time) error {
+	if !start.Before(end) {
+		return fmt.Errorf("Start time %s must be before end time %s.", start, end)
+	}
+	if end.Sub(start) > MAX_TIME_RANGE {
+		return fmt.Errorf("Time range %s exceeds the maximum of %s.", end.Sub(start), MAX_TIME_RANGE)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package job_analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/memory"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+func TestAnalyzeJob(t *testing.T) {
+	unittest.SmallTest(t)
+
+	t0 := time.Unix(1572000000, 0).UTC()
+	at := func(min int) time.Time {
+		return t0.Add(time.Duration(min) * time.Minute)
+	}
+	job := &types.Job{
+		Id:      "job",
+		Name:    "Test-Job",
+		Created: at(0),
+		Dependencies: map[string][]string{
+			"Build":  {},
+			"Test":   {"Build"},
+			"Perf":   {"Build"},
+			"Upload": {"Perf"},
+		},
+		Finished: at(60),
+		Status:   types.JOB_STATUS_FAILURE,
+	}
+	makeTask := func(id string, created, started, finished int, status types.TaskStatus) *types.Task {
+		return &types.Task{
+			Id:       id,
+			Created:  at(created),
+			Started:  at(started),
+			Finished: at(finished),
+			Status:   status,
+		}
+	}
+	tasks := map[string][]*types.Task{
+		"Build": {makeTask("b", 1, 3, 10, types.TASK_STATUS_SUCCESS)},
+		// Test was retried.
+		"Test": {
+			makeTask("t2", 30, 31, 55, types.TASK_STATUS_SUCCESS),
+			makeTask("t1", 11, 15, 30, types.TASK_STATUS_MISHAP),
+		},
+		"Perf": {makeTask("p", 12, 20, 40, types.TASK_STATUS_FAILURE)},
+		// Upload never ran, since Perf failed.
+	}
+	a, err := AnalyzeJob(job, tasks, at(100))
+	require.NoError(t, err)
+	require.Equal(t, 60*time.Minute, a.Duration)
+	require.Equal(t, []string{"Build", "Test"}, a.CriticalPath)
+	require.Equal(t, 55*time.Minute, a.CriticalPathTime)
+
+	require.Equal(t, &TaskAnalysis{
+		Name:           "Build",
+		TaskIds:        []string{"b"},
+		Ready:          at(0),
+		Created:        at(1),
+		Finished:       at(10),
+		SchedulingTime: time.Minute,
+		PendingTime:    2 * time.Minute,
+		RunningTime:    7 * time.Minute,
+		TotalTime:      10 * time.Minute,
+	}, a.Tasks["Build"])
+	require.Equal(t, &TaskAnalysis{
+		Name:           "Test",
+		TaskIds:        []string{"t1", "t2"},
+		Ready:          at(10),
+		Created:        at(11),
+		Finished:       at(55),
+		SchedulingTime: time.Minute,
+		PendingTime:    5 * time.Minute,
+		RunningTime:    39 * time.Minute,
+		TotalTime:      45 * time.Minute,
+	}, a.Tasks["Test"])
+	require.Equal(t, &TaskAnalysis{
+		Name:     "Upload",
+		Ready:    at(40),
+		Finished: at(40),
+	}, a.Tasks["Upload"])
+
+	// Unfinished tasks and jobs end at the given time.
+	job.Status = types.JOB_STATUS_IN_PROGRESS
+	job.Finished = time.Time{}
+	tasks["Upload"] = []*types.Task{{
+		Id:      "u",
+		Created: at(41),
+	}}
+	a, err = AnalyzeJob(job, tasks, at(100))
+	require.NoError(t, err)
+	require.Equal(t, 100*time.Minute, a.Duration)
+	require.Equal(t, []string{"Build", "Perf", "Upload"}, a.CriticalPath)
+	require.Equal(t, 59*time.Minute, a.Tasks["Upload"].PendingTime)
+	require.Equal(t, time.Duration(0), a.Tasks["Upload"].RunningTime)
+}
+
+func TestMakePercentiles(t *testing.T) {
+	unittest.SmallTest(t)
+
+	require.Equal(t, &Percentiles{}, makePercentiles(nil))
+	durations := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	require.Equal(t, &Percentiles{
+		Count: 100,
+		Mean:  50500 * time.Millisecond,
+		P50:   50 * time.Second,
+		P90:   90 * time.Second,
+		P99:   99 * time.Second,
+		Max:   100 * time.Second,
+	}, makePercentiles(durations))
+}
+
+func TestAggregateJobs(t *testing.T) {
+	unittest.SmallTest(t)
+
+	analyses := []*JobAnalysis{
+		{
+			Duration:     10 * time.Minute,
+			CriticalPath: []string{"Build", "Test"},
+			Tasks: map[string]*TaskAnalysis{
+				"Build": {Name: "Build", TotalTime: 4 * time.Minute},
+				"Test":  {Name: "Test", TotalTime: 6 * time.Minute},
+				"Perf":  {Name: "Perf", TotalTime: 2 * time.Minute},
+			},
+		},
+		{
+			Duration:     20 * time.Minute,
+			CriticalPath: []string{"Build", "Perf"},
+			Tasks: map[string]*TaskAnalysis{
+				"Build": {Name: "Build", TotalTime: 5 * time.Minute},
+				"Test":  {Name: "Test", TotalTime: 3 * time.Minute},
+				"Perf":  {Name: "Perf", TotalTime: 15 * time.Minute},
+			},
+		},
+	}
+	agg := AggregateJobs(analyses)
+	require.Equal(t, 2, agg.Jobs)
+	require.Equal(t, 15*time.Minute, agg.Duration.Mean)
+	require.Equal(t, []string{"Perf", "Build", "Test"}, agg.ByCriticalPathTime)
+	require.Equal(t, 2, agg.Tasks["Build"].CriticalPathCount)
+	require.Equal(t, 9*time.Minute, agg.Tasks["Build"].CriticalPathTime)
+	require.Equal(t, 1, agg.Tasks["Test"].CriticalPathCount)
+	require.Equal(t, 6*time.Minute, agg.Tasks["Test"].CriticalPathTime)
+	require.Equal(t, 15*time.Minute, agg.Tasks["Perf"].TotalTime.Max)
+	require.Equal(t, 2*time.Minute, agg.Tasks["Perf"].TotalTime.P50)
+}
+
+// countingDB is a DB which counts calls to GetTaskById.
+type countingDB struct {
+	db.RemoteDB
+	getTaskById int
+}
+
+func (d *countingDB) GetTaskById(id string) (*types.Task, error) {
+	d.getTaskById++
+	return d.RemoteDB.GetTaskById(id)
+}
+
+func TestAnalyzeJobSpec(t *testing.T) {
+	unittest.SmallTest(t)
+
+	t0 := time.Unix(1572000000, 0).UTC()
+	at := func(min int) time.Time {
+		return t0.Add(time.Duration(min) * time.Minute)
+	}
+	mem := memory.NewInMemoryDB()
+	d := &countingDB{RemoteDB: mem}
+	makeTask := func(name string, created, finished int) *types.Task {
+		return &types.Task{
+			Created:  at(created),
+			Started:  at(created),
+			Finished: at(finished),
+			Status:   types.TASK_STATUS_SUCCESS,
+			TaskKey: types.TaskKey{
+				RepoState: types.RepoState{
+					Repo:     "fake.git",
+					Revision: "abc123",
+				},
+				Name: name,
+			},
+		}
+	}
+	// The Build task was created before the time range and reused by
+	// the Job.
+	build := makeTask("Build", 0, 10)
+	test := makeTask("Test", 70, 80)
+	require.NoError(t, mem.PutTasks([]*types.Task{build, test}))
+	makeJob := func(name string, created, finished int) *types.Job {
+		return &types.Job{
+			Created: at(created),
+			Dependencies: map[string][]string{
+				"Build": {},
+				"Test":  {"Build"},
+			},
+			Finished: at(finished),
+			Name:     name,
+			RepoState: types.RepoState{
+				Repo:     "fake.git",
+				Revision: "abc123",
+			},
+			Status: types.JOB_STATUS_SUCCESS,
+			Tasks: map[string][]*types.TaskSummary{
+				"Build": {{Id: build.Id}},
+				"Test":  {{Id: test.Id}},
+			},
+		}
+	}
+	require.NoError(t, mem.PutJobs([]*types.Job{
+		makeJob("Test-Job", 60, 90),
+		makeJob("Test-Job", 65, 90),
+		makeJob("Other-Job", 60, 90),
+	}))
+
+	agg, analyses, err := AnalyzeJobSpec(d, "fake.git", "Test-Job", at(30), at(120))
+	require.NoError(t, err)
+	require.Equal(t, 2, agg.Jobs)
+	require.Len(t, analyses, 2)
+	require.Equal(t, []string{"Build", "Test"}, analyses[0].CriticalPath)
+	// Only the reused Build task was retrieved individually, once per Job.
+	require.Equal(t, 2, d.getTaskById)
+
+	// The time range is limited.
+	_, _, err = AnalyzeJobSpec(d, "fake.git", "Test-Job", at(0), at(0).Add(MAX_TIME_RANGE+time.Minute))
+	require.EqualError(t, err, "Time range 168h1m0s exceeds the maximum of 168h0m0s.")
+	_, _, err = AnalyzeJobSpec(d, "fake.git", "Test-Job", at(120), at(30))
+	require.Error(t, err)
+}
@@ -0,0 +1,665 @@
+// Package local_executor provides an implementation of types.TaskExecutor
+// which runs tasks as processes on the local host, optionally wrapped in a
+// container. It is intended for small deployments which do not have a
+// Swarming fleet and for end-to-end testing of the Task Scheduler. Like a
+// Swarming bot, it materializes the isolated inputs, CIPD packages and named
+// caches of each task and uploads its isolated outputs, so it still requires
+// an Isolate server.
+package local_executor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	osexec "os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/cipd"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	// Environment variables which are set for every task.
+	ENV_ISOLATED       = "TASK_ISOLATED_INPUT"
+	ENV_ISOLATE_SERVER = "TASK_ISOLATE_SERVER"
+	ENV_TASK_DIR       = "TASK_DIR"
+	ENV_TASK_ID        = "TASK_ID"
+	ENV_MACHINE_ID     = "TASK_MACHINE_ID"
+
+	// CONTAINER_TASK_DIR may be used in Config.ContainerCommand; it is
+	// replaced with the host directory of the task, which contains its
+	// working directory, its isolated output directory and its named caches,
+	// and which must be mounted at Config.ContainerTaskDir.
+	CONTAINER_TASK_DIR = "${TASK_DIR}"
+
+	// CONTAINER_WORK_DIR may be used in Config.ContainerCommand; it is
+	// replaced with the working directory of the task inside the container.
+	CONTAINER_WORK_DIR = "${TASK_WORK_DIR}"
+
+	// PLACEHOLDER_ISOLATED_OUTDIR may be used in the command of a task, as
+	// on Swarming; it is replaced with the directory whose contents are
+	// uploaded as the isolated output of the task.
+	PLACEHOLDER_ISOLATED_OUTDIR = "${ISOLATED_OUTDIR}"
+
+	// Subdirectories of Config.Workdir.
+	CACHES_DIR = "caches"
+	TASKS_DIR  = "tasks"
+
+	// Subdirectories of the directory of each task. Named caches are moved
+	// into the directory of the task while it runs, so that everything the
+	// task uses is available in the container.
+	TASK_CACHES_DIR = "caches"
+	TASK_OUTPUT_DIR = "out"
+	TASK_WORK_DIR   = "w"
+
+	// Finished tasks are forgotten after FINISHED_TASK_RETENTION.
+	FINISHED_TASK_RETENTION = 24 * time.Hour
+)
+
+// MachineConfig describes one local machine, ie. a slot which is able to run
+// a single task at a time.
+type MachineConfig struct {
+	ID string `json:"id"`
+	// Dimensions of the machine, in "key:value" format. Each machine should
+	// have a "pool" dimension.
+	Dimensions []string `json:"dimensions"`
+}
+
+// Config is the configuration for a LocalTaskExecutor.
+type Config struct {
+	// ContainerCommand, if provided, is prepended to the command of every
+	// task, eg. ["docker", "run", "--rm", "-v", "${TASK_DIR}:/task", "-w",
+	// "${TASK_WORK_DIR}", "img"]. Occurrences of CONTAINER_TASK_DIR and
+	// CONTAINER_WORK_DIR are replaced as described above. The environment
+	// of the task is set on the ContainerCommand, which is responsible for
+	// passing it into the container, eg. with "--env-file" or "-e".
+	ContainerCommand []string `json:"containerCommand,omitempty"`
+	// ContainerTaskDir is the absolute path inside the container at which
+	// ContainerCommand mounts CONTAINER_TASK_DIR. Required with
+	// ContainerCommand. Paths given to the task, eg. ${ISOLATED_OUTDIR},
+	// are inside ContainerTaskDir.
+	ContainerTaskDir string `json:"containerTaskDir,omitempty"`
+	// Machines are the slots available to run tasks.
+	Machines []*MachineConfig `json:"machines"`
+	// Workdir is the directory in which each task gets its own working
+	// directory.
+	Workdir string `json:"workdir"`
+}
+
+// Validate returns an error if the Config is not valid.
+func (c *Config) Validate() error {
+	if c.Workdir == "" {
+		return fmt.Errorf("Workdir is required.")
+	}
+	if len(c.Machines) == 0 {
+		return fmt.Errorf("At least one machine is required.")
+	}
+	if len(c.ContainerCommand) > 0 && !path.IsAbs(c.ContainerTaskDir) {
+		return fmt.Errorf("ContainerTaskDir must be an absolute path when ContainerCommand is provided.")
+	}
+	if len(c.ContainerCommand) == 0 && c.ContainerTaskDir != "" {
+		return fmt.Errorf("ContainerTaskDir is only valid with ContainerCommand.")
+	}
+	ids := make(map[string]bool, len(c.Machines))
+	for _, m := range c.Machines {
+		if m.ID == "" {
+			return fmt.Errorf("Machine ID is required.")
+		}
+		if ids[m.ID] {
+			return fmt.Errorf("Duplicate machine ID %q", m.ID)
+		}
+		ids[m.ID] = true
+		for _, d := range m.Dimensions {
+			if !strings.Contains(d, ":") {
+				return fmt.Errorf("Invalid dimension %q for machine %q; expected \"key:value\"", d, m.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// machine tracks the state of one local machine.
+type machine struct {
+	*MachineConfig
+	dims        util.StringSet
+	currentTask string
+}
+
+// task tracks the state of one task.
+type task struct {
+	req      *types.TaskRequest
+	result   *types.TaskResult
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// isolateClient is the subset of isolate.Client used by LocalTaskExecutor.
+type isolateClient interface {
+	ArchiveDir(ctx context.Context, dir string) (string, error)
+	Download(ctx context.Context, hash, outputDir string) error
+	ServerURL() string
+}
+
+// LocalTaskExecutor implements types.TaskExecutor by running tasks on the
+// local host. Tasks are kept in memory only, until FINISHED_TASK_RETENTION
+// after they finish; tasks which were triggered by a previous instance of the
+// LocalTaskExecutor are reported as unfinished forever.
+type LocalTaskExecutor struct {
+	containerCommand []string
+	containerTaskDir string
+	ctx              context.Context
+	ensureCipd       func(ctx context.Context, rootDir string, pkgs ...*cipd.Package) error
+	isolate          isolateClient
+	machines         []*machine
+	mtx              sync.Mutex
+	pending          []string
+	tasks            map[string]*task
+	taskCount        int
+	wg               sync.WaitGroup
+	workdir          string
+}
+
+// NewLocalTaskExecutor returns a LocalTaskExecutor. Running tasks are killed
+// when the given context is canceled. The isolate client is used to download
+// the isolated inputs and upload the isolated outputs of tasks, and the HTTP
+// client is used to install their CIPD packages. Tasks which need either are
+// rejected if the corresponding client is nil.
+func NewLocalTaskExecutor(ctx context.Context, c *Config, isolateClient *isolate.Client, httpClient *http.Client) (*LocalTaskExecutor, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	workdir, err := filepath.Abs(c.Workdir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(workdir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("Failed to create workdir: %s", err)
+	}
+	machines := make([]*machine, 0, len(c.Machines))
+	for _, m := range c.Machines {
+		machines = append(machines, &machine{
+			MachineConfig: m,
+			dims:          util.NewStringSet(m.Dimensions),
+		})
+	}
+	e := &LocalTaskExecutor{
+		containerCommand: c.ContainerCommand,
+		containerTaskDir: c.ContainerTaskDir,
+		ctx:              ctx,
+		machines:         machines,
+		tasks:            map[string]*task{},
+		workdir:          workdir,
+	}
+	if isolateClient != nil {
+		e.isolate = isolateClient
+	}
+	if httpClient != nil {
+		e.ensureCipd = func(ctx context.Context, rootDir string, pkgs ...*cipd.Package) error {
+			return cipd.Ensure(ctx, httpClient, rootDir, pkgs...)
+		}
+	}
+	return e, nil
+}
+
+// GetFreeMachines implements types.TaskExecutor.
+func (e *LocalTaskExecutor) GetFreeMachines(ctx context.Context, pool string) ([]*types.Machine, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	poolDim := fmt.Sprintf("%s:%s", swarming.DIMENSION_POOL_KEY, pool)
+	rv := []*types.Machine{}
+	for _, m := range e.machines {
+		if m.currentTask == "" && m.dims[poolDim] {
+			rv = append(rv, &types.Machine{
+				ID:         m.ID,
+				Dimensions: util.CopyStringSlice(m.Dimensions),
+			})
+		}
+	}
+	return rv, nil
+}
+
+// GetPendingTasks implements types.TaskExecutor.
+func (e *LocalTaskExecutor) GetPendingTasks(ctx context.Context, pool string) ([]*types.TaskResult, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.expire()
+	poolDim := fmt.Sprintf("%s:%s", swarming.DIMENSION_POOL_KEY, pool)
+	rv := []*types.TaskResult{}
+	for _, id := range e.pending {
+		t := e.tasks[id]
+		if util.In(poolDim, t.req.Dimensions) {
+			rv = append(rv, copyResult(t.result))
+		}
+	}
+	return rv, nil
+}
+
+// GetTaskResult implements types.TaskExecutor.
+func (e *LocalTaskExecutor) GetTaskResult(ctx context.Context, taskID string) (*types.TaskResult, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.expire()
+	t, ok := e.tasks[taskID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown task %q", taskID)
+	}
+	return copyResult(t.result), nil
+}
+
+// GetTaskCompletionStatuses implements types.TaskExecutor.
+func (e *LocalTaskExecutor) GetTaskCompletionStatuses(ctx context.Context, taskIDs []string) ([]bool, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.expire()
+	rv := make([]bool, 0, len(taskIDs))
+	for _, id := range taskIDs {
+		t, ok := e.tasks[id]
+		rv = append(rv, ok && t.result.Done())
+	}
+	return rv, nil
+}
+
+// TriggerTask implements types.TaskExecutor.
+func (e *LocalTaskExecutor) TriggerTask(ctx context.Context, req *types.TaskRequest) (*types.TaskResult, error) {
+	if len(req.Command) == 0 {
+		return nil, fmt.Errorf("Task %q has no command.", req.Name)
+	}
+	if e.isolate == nil && req.Isolated != "" {
+		return nil, fmt.Errorf("Task %q has isolated inputs, but the local executor has no isolate client.", req.Name)
+	}
+	if e.ensureCipd == nil && len(req.CipdPackages) > 0 {
+		return nil, fmt.Errorf("Task %q has CIPD packages, but the local executor has no HTTP client with which to install them.", req.Name)
+	}
+	if e.isolate == nil && len(req.Outputs) > 0 {
+		return nil, fmt.Errorf("Task %q has outputs, but the local executor has no isolate client.", req.Name)
+	}
+	cacheNames := make(map[string]bool, len(req.Caches))
+	for _, c := range req.Caches {
+		if cacheNames[c.Name] {
+			return nil, fmt.Errorf("Task %q has duplicate cache %q.", req.Name, c.Name)
+		}
+		cacheNames[c.Name] = true
+		if c.Name == "" || strings.ContainsAny(c.Name, `/\`) || c.Name == "." || c.Name == ".." {
+			return nil, fmt.Errorf("Task %q has invalid cache name %q.", req.Name, c.Name)
+		}
+		if !isRelativeSubpath(c.Path) {
+			return nil, fmt.Errorf("Task %q has invalid path %q for cache %q.", req.Name, c.Path, c.Name)
+		}
+	}
+	for _, pkg := range req.CipdPackages {
+		if !isRelativeSubpath(pkg.Path) {
+			return nil, fmt.Errorf("Task %q has invalid path %q for CIPD package %q.", req.Name, pkg.Path, pkg.Name)
+		}
+	}
+	for _, o := range req.Outputs {
+		if !isRelativeSubpath(o) {
+			return nil, fmt.Errorf("Task %q has invalid output %q.", req.Name, o)
+		}
+	}
+	tags, err := swarming.ParseTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.taskCount++
+	id := fmt.Sprintf("local-%d-%d", time.Now().UnixNano(), e.taskCount)
+	e.tasks[id] = &task{
+		req: req,
+		result: &types.TaskResult{
+			ID:      id,
+			Created: time.Now().UTC(),
+			Status:  types.TASK_STATUS_PENDING,
+			Tags:    tags,
+		},
+	}
+	e.pending = append(e.pending, id)
+	e.schedule()
+	return copyResult(e.tasks[id].result), nil
+}
+
+// CancelTask implements types.TaskExecutor.
+func (e *LocalTaskExecutor) CancelTask(ctx context.Context, taskID string, killRunning bool) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	t, ok := e.tasks[taskID]
+	if !ok {
+		return fmt.Errorf("Unknown task %q", taskID)
+	}
+	switch t.result.Status {
+	case types.TASK_STATUS_PENDING:
+		e.removePending(taskID)
+		t.result.Status = types.TASK_STATUS_MISHAP
+		t.result.Finished = time.Now().UTC()
+	case types.TASK_STATUS_RUNNING:
+		if killRunning {
+			t.canceled = true
+			t.cancel()
+		}
+	}
+	return nil
+}
+
+// Wait waits for all running tasks to finish.
+func (e *LocalTaskExecutor) Wait() {
+	e.wg.Wait()
+}
+
+// expire marks pending tasks which have exceeded their expiration as finished
+// and forgets tasks which finished more than FINISHED_TASK_RETENTION ago.
+// Assumes the caller holds e.mtx.
+func (e *LocalTaskExecutor) expire() {
+	now := time.Now().UTC()
+	for _, id := range util.CopyStringSlice(e.pending) {
+		t := e.tasks[id]
+		if t.req.Expiration > 0 && now.Sub(t.result.Created) > t.req.Expiration {
+			sklog.Warningf("Task %s expired after %s", id, t.req.Expiration)
+			e.removePending(id)
+			t.result.Status = types.TASK_STATUS_MISHAP
+			t.result.Finished = now
+		}
+	}
+	for id, t := range e.tasks {
+		if t.result.Done() && now.Sub(t.result.Finished) > FINISHED_TASK_RETENTION {
+			delete(e.tasks, id)
+		}
+	}
+}
+
+// removePending removes the given task from the pending queue. Assumes the
+// caller holds e.mtx.
+func (e *LocalTaskExecutor) removePending(id string) {
+	for i, p := range e.pending {
+		if p == id {
+			e.pending = append(e.pending[:i], e.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// schedule starts pending tasks, in the order in which they were triggered,
+// on free machines whose dimensions match. Assumes the caller holds e.mtx.
+func (e *LocalTaskExecutor) schedule() {
+	e.expire()
+	stillPending := make([]string, 0, len(e.pending))
+	for _, id := range e.pending {
+		t := e.tasks[id]
+		var m *machine
+		for _, candidate := range e.machines {
+			if candidate.currentTask != "" {
+				continue
+			}
+			match := true
+			for _, d := range t.req.Dimensions {
+				if !candidate.dims[d] {
+					match = false
+					break
+				}
+			}
+			if match {
+				m = candidate
+				break
+			}
+		}
+		if m == nil {
+			stillPending = append(stillPending, id)
+			continue
+		}
+		m.currentTask = id
+		t.result.Status = types.TASK_STATUS_RUNNING
+		t.result.Started = time.Now().UTC()
+		t.result.MachineID = m.ID
+		ctx, cancel := context.WithCancel(e.ctx)
+		t.cancel = cancel
+		e.wg.Add(1)
+		go func(id string, t *task, m *machine) {
+			defer e.wg.Done()
+			defer cancel()
+			status, output := e.run(ctx, id, t.req, m)
+			e.mtx.Lock()
+			defer e.mtx.Unlock()
+			if t.canceled {
+				status = types.TASK_STATUS_MISHAP
+			}
+			t.result.Status = status
+			t.result.IsolatedOutput = output
+			t.result.Finished = time.Now().UTC()
+			m.currentTask = ""
+			e.schedule()
+		}(id, t, m)
+	}
+	e.pending = stillPending
+}
+
+// isRelativeSubpath returns true iff the given path is relative and does not
+// escape the directory it is relative to.
+func isRelativeSubpath(path string) bool {
+	if path == "" || filepath.IsAbs(path) {
+		return false
+	}
+	clean := filepath.Clean(path)
+	return clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
+
+// materialize sets up the working directory of the given task on the given
+// machine: it downloads the isolated inputs, installs the CIPD packages and
+// moves the named caches of the machine into the directory of the task,
+// linking them into the working directory with relative links so that they
+// resolve inside a container too.
+func (e *LocalTaskExecutor) materialize(ctx context.Context, req *types.TaskRequest, m *machine, taskDir, workDir string) error {
+	if req.Isolated != "" {
+		if err := e.isolate.Download(ctx, req.Isolated, workDir); err != nil {
+			return fmt.Errorf("Failed to download isolated inputs: %s", err)
+		}
+	}
+	if len(req.CipdPackages) > 0 {
+		pkgs := make([]*cipd.Package, 0, len(req.CipdPackages))
+		for _, p := range req.CipdPackages {
+			pkgs = append(pkgs, &cipd.Package{
+				Name:    p.Name,
+				Path:    p.Path,
+				Version: p.Version,
+			})
+		}
+		if err := e.ensureCipd(ctx, workDir, pkgs...); err != nil {
+			return fmt.Errorf("Failed to install CIPD packages: %s", err)
+		}
+	}
+	for _, c := range req.Caches {
+		// Named caches belong to a machine, which only runs one task at a
+		// time, so they are never shared by concurrent tasks.
+		cacheDir := filepath.Join(e.workdir, CACHES_DIR, m.ID, c.Name)
+		if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+			return fmt.Errorf("Failed to create cache %q: %s", c.Name, err)
+		}
+		taskCacheDir := filepath.Join(taskDir, TASK_CACHES_DIR, c.Name)
+		if err := os.MkdirAll(filepath.Dir(taskCacheDir), os.ModePerm); err != nil {
+			return fmt.Errorf("Failed to create caches dir: %s", err)
+		}
+		if err := os.Rename(cacheDir, taskCacheDir); err != nil {
+			return fmt.Errorf("Failed to move cache %q: %s", c.Name, err)
+		}
+		dest := filepath.Join(workDir, c.Path)
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return fmt.Errorf("Failed to create parent dir for cache %q: %s", c.Name, err)
+		}
+		target, err := filepath.Rel(filepath.Dir(dest), taskCacheDir)
+		if err != nil {
+			return fmt.Errorf("Failed to link cache %q: %s", c.Name, err)
+		}
+		if err := os.Symlink(target, dest); err != nil {
+			return fmt.Errorf("Failed to link cache %q: %s", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// restoreCaches moves the named caches of the given task back to the given
+// machine.
+func (e *LocalTaskExecutor) restoreCaches(req *types.TaskRequest, m *machine, taskDir string) {
+	for _, c := range req.Caches {
+		taskCacheDir := filepath.Join(taskDir, TASK_CACHES_DIR, c.Name)
+		if _, err := os.Stat(taskCacheDir); os.IsNotExist(err) {
+			continue
+		}
+		cacheDir := filepath.Join(e.workdir, CACHES_DIR, m.ID, c.Name)
+		if err := os.Rename(taskCacheDir, cacheDir); err != nil {
+			sklog.Errorf("Failed to restore cache %q of machine %s: %s", c.Name, m.ID, err)
+		}
+	}
+}
+
+// uploadOutputs moves the outputs of the given task from its working
+// directory into outDir and uploads the contents of outDir to the isolate
+// server. Returns the isolated hash, or the empty string if there are no
+// outputs.
+func (e *LocalTaskExecutor) uploadOutputs(ctx context.Context, req *types.TaskRequest, workDir, outDir string) (string, error) {
+	for _, o := range req.Outputs {
+		src := filepath.Join(workDir, o)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		dest := filepath.Join(outDir, o)
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return "", fmt.Errorf("Failed to create parent dir for output %q: %s", o, err)
+		}
+		if err := os.Rename(src, dest); err != nil {
+			return "", fmt.Errorf("Failed to collect output %q: %s", o, err)
+		}
+	}
+	contents, err := ioutil.ReadDir(outDir)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read output dir: %s", err)
+	}
+	if len(contents) == 0 {
+		return "", nil
+	}
+	if e.isolate == nil {
+		return "", fmt.Errorf("Task wrote outputs, but the local executor has no isolate client.")
+	}
+	return e.isolate.ArchiveDir(ctx, outDir)
+}
+
+// run runs the given task on the given machine and returns its final status
+// and isolated output, if any. Must not be called while holding e.mtx.
+func (e *LocalTaskExecutor) run(ctx context.Context, id string, req *types.TaskRequest, m *machine) (types.TaskStatus, string) {
+	taskDir := filepath.Join(e.workdir, TASKS_DIR, id)
+	workDir := filepath.Join(taskDir, TASK_WORK_DIR)
+	outDir := filepath.Join(taskDir, TASK_OUTPUT_DIR)
+	defer util.RemoveAll(taskDir)
+	for _, dir := range []string{workDir, outDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			sklog.Errorf("Failed to create working directory for task %s: %s", id, err)
+			return types.TASK_STATUS_MISHAP, ""
+		}
+	}
+	defer e.restoreCaches(req, m, taskDir)
+	if err := e.materialize(ctx, req, m, taskDir, workDir); err != nil {
+		sklog.Errorf("Failed to set up task %s: %s", id, err)
+		return types.TASK_STATUS_MISHAP, ""
+	}
+
+	// Paths given to the task must be valid where it runs, ie. inside the
+	// container, if any.
+	runWorkDir := workDir
+	runOutDir := outDir
+	if len(e.containerCommand) > 0 {
+		runWorkDir = path.Join(e.containerTaskDir, TASK_WORK_DIR)
+		runOutDir = path.Join(e.containerTaskDir, TASK_OUTPUT_DIR)
+	}
+	containerReplacer := strings.NewReplacer(CONTAINER_TASK_DIR, taskDir, CONTAINER_WORK_DIR, runWorkDir)
+	replacer := strings.NewReplacer(PLACEHOLDER_ISOLATED_OUTDIR, runOutDir)
+	cmd := make([]string, 0, len(e.containerCommand)+len(req.Command)+len(req.ExtraArgs))
+	for _, c := range e.containerCommand {
+		cmd = append(cmd, containerReplacer.Replace(c))
+	}
+	for _, c := range req.Command {
+		cmd = append(cmd, replacer.Replace(c))
+	}
+	for _, c := range req.ExtraArgs {
+		cmd = append(cmd, replacer.Replace(c))
+	}
+
+	isolateServer := ""
+	if e.isolate != nil {
+		isolateServer = e.isolate.ServerURL()
+	}
+	env := []string{
+		fmt.Sprintf("%s=%s", ENV_ISOLATED, req.Isolated),
+		fmt.Sprintf("%s=%s", ENV_ISOLATE_SERVER, isolateServer),
+		fmt.Sprintf("%s=%s", ENV_TASK_DIR, runWorkDir),
+		fmt.Sprintf("%s=%s", ENV_TASK_ID, id),
+		fmt.Sprintf("%s=%s", ENV_MACHINE_ID, m.ID),
+		"PATH=" + os.Getenv("PATH"),
+	}
+	for k, v := range req.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	for k, prefixes := range req.EnvPrefixes {
+		paths := make([]string, 0, len(prefixes)+1)
+		for _, p := range prefixes {
+			paths = append(paths, path.Join(runWorkDir, p))
+		}
+		// The environment of the host means nothing inside a container.
+		if existing := os.Getenv(k); existing != "" && len(e.containerCommand) == 0 {
+			paths = append(paths, existing)
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, strings.Join(paths, string(os.PathListSeparator))))
+	}
+
+	sklog.Infof("Running task %s (%s) on %s", id, req.Name, m.ID)
+	runCtx := ctx
+	if req.ExecutionTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, req.ExecutionTimeout)
+		defer cancel()
+	}
+	c := osexec.CommandContext(runCtx, cmd[0], cmd[1:]...)
+	c.Dir = workDir
+	c.Env = env
+	c.Stdout = exec.WriteInfoLog
+	c.Stderr = exec.WriteWarningLog
+	status := types.TASK_STATUS_SUCCESS
+	if err := c.Run(); err != nil {
+		sklog.Errorf("Task %s failed: %s", id, err)
+		// Tasks which time out or are killed did not fail on their own,
+		// and neither did those which could not be started.
+		if _, ok := err.(*osexec.ExitError); !ok || runCtx.Err() != nil {
+			return types.TASK_STATUS_MISHAP, ""
+		}
+		status = types.TASK_STATUS_FAILURE
+	}
+
+	// As on Swarming, the outputs of failed tasks are uploaded too.
+	output, err := e.uploadOutputs(ctx, req, workDir, outDir)
+	if err != nil {
+		sklog.Errorf("Failed to upload outputs of task %s: %s", id, err)
+		return types.TASK_STATUS_MISHAP, ""
+	}
+	return status, output
+}
+
+// copyResult returns a copy of the given TaskResult.
+func copyResult(r *types.TaskResult) *types.TaskResult {
+	rv := new(types.TaskResult)
+	*rv = *r
+	rv.Tags = make(map[string][]string, len(r.Tags))
+	for k, v := range r.Tags {
+		rv.Tags[k] = util.CopyStringSlice(v)
+	}
+	return rv
+}
+
+// Make sure LocalTaskExecutor fulfills the types.TaskExecutor interface.
+var _ types.TaskExecutor = &LocalTaskExecutor{}
@@ -0,0 +1,332 @@
+package local_executor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/cipd"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+func setup(t *testing.T, numMachines int) (context.Context, *LocalTaskExecutor, func()) {
+	unittest.MediumTest(t)
+	wd, cleanup := testutils.TempDir(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	machines := []*MachineConfig{}
+	for i := 0; i < numMachines; i++ {
+		machines = append(machines, &MachineConfig{
+			ID:         fmt.Sprintf("m%d", i+1),
+			Dimensions: []string{"pool:Skia", "os:Linux"},
+		})
+	}
+	e, err := NewLocalTaskExecutor(ctx, &Config{
+		Machines: machines,
+		Workdir:  wd,
+	}, nil, nil)
+	require.NoError(t, err)
+	return ctx, e, func() {
+		cancel()
+		e.Wait()
+		cleanup()
+	}
+}
+
+func request(cmd ...string) *types.TaskRequest {
+	return &types.TaskRequest{
+		Command:    cmd,
+		Dimensions: []string{"pool:Skia"},
+		Name:       "fake-task",
+		Tags:       []string{"sk_id:abc123"},
+	}
+}
+
+func waitForResult(t *testing.T, ctx context.Context, e *LocalTaskExecutor, id string) *types.TaskResult {
+	var rv *types.TaskResult
+	require.NoError(t, testutils.EventuallyConsistent(10*time.Second, func() error {
+		res, err := e.GetTaskResult(ctx, id)
+		require.NoError(t, err)
+		if !res.Done() {
+			return testutils.TryAgainErr
+		}
+		rv = res
+		return nil
+	}))
+	return rv
+}
+
+func TestConfigValidate(t *testing.T) {
+	unittest.SmallTest(t)
+
+	c := &Config{}
+	require.EqualError(t, c.Validate(), "Workdir is required.")
+	c.Workdir = "wd"
+	require.EqualError(t, c.Validate(), "At least one machine is required.")
+	c.Machines = []*MachineConfig{{ID: "m1", Dimensions: []string{"pool:Skia"}}}
+	require.NoError(t, c.Validate())
+	c.Machines = append(c.Machines, &MachineConfig{ID: "m1"})
+	require.EqualError(t, c.Validate(), "Duplicate machine ID \"m1\"")
+	c.Machines[1] = &MachineConfig{ID: "m2", Dimensions: []string{"pool"}}
+	require.EqualError(t, c.Validate(), "Invalid dimension \"pool\" for machine \"m2\"; expected \"key:value\"")
+	c.Machines = c.Machines[:1]
+	c.ContainerCommand = []string{"docker", "run"}
+	require.EqualError(t, c.Validate(), "ContainerTaskDir must be an absolute path when ContainerCommand is provided.")
+	c.ContainerTaskDir = "/task"
+	require.NoError(t, c.Validate())
+	c.ContainerCommand = nil
+	require.EqualError(t, c.Validate(), "ContainerTaskDir is only valid with ContainerCommand.")
+}
+
+func TestRunTasks(t *testing.T) {
+	ctx, e, cleanup := setup(t, 1)
+	defer cleanup()
+
+	free, err := e.GetFreeMachines(ctx, "Skia")
+	require.NoError(t, err)
+	require.Len(t, free, 1)
+	assert.Equal(t, "m1", free[0].ID)
+
+	// The first task occupies the only machine, so the second must wait.
+	res1, err := e.TriggerTask(ctx, request("sleep", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, types.TASK_STATUS_RUNNING, res1.Status)
+	assert.Equal(t, "m1", res1.MachineID)
+	assert.Equal(t, map[string][]string{"sk_id": {"abc123"}}, res1.Tags)
+	res2, err := e.TriggerTask(ctx, request("false"))
+	require.NoError(t, err)
+	assert.Equal(t, types.TASK_STATUS_PENDING, res2.Status)
+
+	free, err = e.GetFreeMachines(ctx, "Skia")
+	require.NoError(t, err)
+	assert.Len(t, free, 0)
+	pending, err := e.GetPendingTasks(ctx, "Skia")
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, res2.ID, pending[0].ID)
+
+	res1 = waitForResult(t, ctx, e, res1.ID)
+	assert.Equal(t, types.TASK_STATUS_SUCCESS, res1.Status)
+	res2 = waitForResult(t, ctx, e, res2.ID)
+	assert.Equal(t, types.TASK_STATUS_FAILURE, res2.Status)
+	assert.False(t, res2.Started.IsZero())
+	assert.False(t, res2.Finished.Before(res2.Started))
+
+	done, err := e.GetTaskCompletionStatuses(ctx, []string{res1.ID, res2.ID, "bogus"})
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, false}, done)
+}
+
+func TestTimeoutAndCancel(t *testing.T) {
+	ctx, e, cleanup := setup(t, 1)
+	defer cleanup()
+
+	req := request("sleep", "30")
+	req.ExecutionTimeout = 100 * time.Millisecond
+	res, err := e.TriggerTask(ctx, req)
+	require.NoError(t, err)
+	res = waitForResult(t, ctx, e, res.ID)
+	assert.Equal(t, types.TASK_STATUS_MISHAP, res.Status)
+
+	// Commands which can't be started are mishaps, not failures.
+	res, err = e.TriggerTask(ctx, request("no-such-command"))
+	require.NoError(t, err)
+	assert.Equal(t, types.TASK_STATUS_MISHAP, waitForResult(t, ctx, e, res.ID).Status)
+
+	// Cancel a running task and a pending task.
+	running, err := e.TriggerTask(ctx, request("sleep", "30"))
+	require.NoError(t, err)
+	pending, err := e.TriggerTask(ctx, request("true"))
+	require.NoError(t, err)
+	require.Equal(t, types.TASK_STATUS_PENDING, pending.Status)
+	require.NoError(t, e.CancelTask(ctx, pending.ID, false))
+	require.NoError(t, e.CancelTask(ctx, running.ID, true))
+	assert.Equal(t, types.TASK_STATUS_MISHAP, waitForResult(t, ctx, e, pending.ID).Status)
+	assert.Equal(t, types.TASK_STATUS_MISHAP, waitForResult(t, ctx, e, running.ID).Status)
+
+	// Tasks which have no matching machine expire.
+	req = request("true")
+	req.Dimensions = []string{"pool:Skia", "os:Mac"}
+	req.Expiration = time.Millisecond
+	res, err = e.TriggerTask(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, types.TASK_STATUS_MISHAP, waitForResult(t, ctx, e, res.ID).Status)
+}
+
+// fakeIsolateClient implements isolateClient.
+type fakeIsolateClient struct {
+	inputs  map[string]map[string]string
+	outputs map[string]string
+}
+
+// See documentation for isolateClient interface.
+func (c *fakeIsolateClient) ArchiveDir(_ context.Context, dir string) (string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "result.txt"))
+	if err != nil {
+		return "", err
+	}
+	hash := fmt.Sprintf("output%d", len(c.outputs))
+	c.outputs[hash] = string(contents)
+	return hash, nil
+}
+
+// See documentation for isolateClient interface.
+func (c *fakeIsolateClient) Download(_ context.Context, hash, outputDir string) error {
+	files, ok := c.inputs[hash]
+	if !ok {
+		return fmt.Errorf("No such isolated: %s", hash)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(outputDir, name), []byte(contents), os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// See documentation for isolateClient interface.
+func (c *fakeIsolateClient) ServerURL() string {
+	return "fake-isolate-server"
+}
+
+func TestRejectUnsupportedInputs(t *testing.T) {
+	ctx, e, cleanup := setup(t, 1)
+	defer cleanup()
+
+	test := func(expectErr string, fn func(*types.TaskRequest)) {
+		req := request("true")
+		fn(req)
+		_, err := e.TriggerTask(ctx, req)
+		require.EqualError(t, err, expectErr)
+	}
+	test("Task \"fake-task\" has isolated inputs, but the local executor has no isolate client.", func(req *types.TaskRequest) {
+		req.Isolated = "abc123"
+	})
+	test("Task \"fake-task\" has CIPD packages, but the local executor has no HTTP client with which to install them.", func(req *types.TaskRequest) {
+		req.CipdPackages = []*types.CipdPackage{{Name: "pkg", Path: "bin", Version: "1"}}
+	})
+	test("Task \"fake-task\" has outputs, but the local executor has no isolate client.", func(req *types.TaskRequest) {
+		req.Outputs = []string{"out"}
+	})
+	test("Task \"fake-task\" has invalid cache name \"a/b\".", func(req *types.TaskRequest) {
+		req.Caches = []*types.CacheRequest{{Name: "a/b", Path: "cache/a"}}
+	})
+	test("Task \"fake-task\" has invalid path \"../a\" for cache \"a\".", func(req *types.TaskRequest) {
+		req.Caches = []*types.CacheRequest{{Name: "a", Path: "../a"}}
+	})
+}
+
+func TestMaterializeInputs(t *testing.T) {
+	ctx, e, cleanup := setup(t, 1)
+	defer cleanup()
+
+	iso := &fakeIsolateClient{
+		inputs: map[string]map[string]string{
+			"inputhash": {"input.txt": "hello"},
+		},
+		outputs: map[string]string{},
+	}
+	e.isolate = iso
+	e.ensureCipd = func(_ context.Context, rootDir string, pkgs ...*cipd.Package) error {
+		for _, pkg := range pkgs {
+			dir := filepath.Join(rootDir, pkg.Path)
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, pkg.Name), []byte(pkg.Version), os.ModePerm); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The task reads its isolated input, CIPD package and named cache, and
+	// writes its output.
+	req := request("sh", "-c", "touch cache/count && cat input.txt bin/tool cache/count > ${ISOLATED_OUTDIR}/result.txt && echo x >> cache/count")
+	req.Isolated = "inputhash"
+	req.CipdPackages = []*types.CipdPackage{{Name: "tool", Path: "bin", Version: "v1"}}
+	req.Caches = []*types.CacheRequest{{Name: "count", Path: "cache"}}
+	res, err := e.TriggerTask(ctx, req)
+	require.NoError(t, err)
+	res = waitForResult(t, ctx, e, res.ID)
+	require.Equal(t, types.TASK_STATUS_SUCCESS, res.Status)
+	require.Equal(t, "output0", res.IsolatedOutput)
+	require.Equal(t, "hellov1", iso.outputs["output0"])
+
+	// The named cache persists across tasks on the same machine.
+	res, err = e.TriggerTask(ctx, req)
+	require.NoError(t, err)
+	res = waitForResult(t, ctx, e, res.ID)
+	require.Equal(t, types.TASK_STATUS_SUCCESS, res.Status)
+	require.Equal(t, "output1", res.IsolatedOutput)
+	require.Equal(t, "hellov1x\n", iso.outputs["output1"])
+
+	// Failure to obtain the inputs is a mishap.
+	req.Isolated = "bogus"
+	res, err = e.TriggerTask(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, types.TASK_STATUS_MISHAP, waitForResult(t, ctx, e, res.ID).Status)
+}
+
+func TestForgetFinishedTasks(t *testing.T) {
+	ctx, e, cleanup := setup(t, 1)
+	defer cleanup()
+
+	res, err := e.TriggerTask(ctx, request("true"))
+	require.NoError(t, err)
+	require.Equal(t, types.TASK_STATUS_SUCCESS, waitForResult(t, ctx, e, res.ID).Status)
+
+	e.mtx.Lock()
+	e.tasks[res.ID].result.Finished = time.Now().Add(-FINISHED_TASK_RETENTION - time.Minute)
+	e.mtx.Unlock()
+	_, err = e.GetTaskResult(ctx, res.ID)
+	require.EqualError(t, err, fmt.Sprintf("Unknown task %q", res.ID))
+	require.Len(t, e.tasks, 0)
+}
+
+func TestContainer(t *testing.T) {
+	unittest.MediumTest(t)
+	wd, cleanup := testutils.TempDir(t)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Fake a container by linking the directory of the task to the path at
+	// which it would be mounted.
+	mount := filepath.Join(wd, "mnt")
+	e, err := NewLocalTaskExecutor(ctx, &Config{
+		ContainerCommand: []string{"sh", "-c", "ln -sfn \"$1\" \"$2\" && cd \"$3\" && shift 3 && exec \"$@\"", "sh", CONTAINER_TASK_DIR, mount, CONTAINER_WORK_DIR},
+		ContainerTaskDir: mount,
+		Machines: []*MachineConfig{{
+			ID:         "m1",
+			Dimensions: []string{"pool:Skia"},
+		}},
+		Workdir: filepath.Join(wd, "work"),
+	}, nil, nil)
+	require.NoError(t, err)
+	defer e.Wait()
+	iso := &fakeIsolateClient{
+		outputs: map[string]string{},
+	}
+	e.isolate = iso
+
+	// Every path given to the task is inside the container.
+	req := request("sh", "-c", "echo x >> cache/count && echo $TASK_DIR $TOOLS $(cat cache/count) > ${ISOLATED_OUTDIR}/result.txt")
+	req.Caches = []*types.CacheRequest{{Name: "count", Path: "cache"}}
+	req.EnvPrefixes = map[string][]string{"TOOLS": {"bin"}}
+	for i, expect := range []string{"x", "x x"} {
+		res, err := e.TriggerTask(ctx, req)
+		require.NoError(t, err)
+		res = waitForResult(t, ctx, e, res.ID)
+		require.Equal(t, types.TASK_STATUS_SUCCESS, res.Status)
+		work := filepath.Join(mount, TASK_WORK_DIR)
+		require.Equal(t, fmt.Sprintf("%s %s %s\n", work, filepath.Join(work, "bin"), expect), iso.outputs[res.IsolatedOutput], "task %d", i)
+	}
+}
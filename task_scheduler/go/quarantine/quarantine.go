@@ -0,0 +1,255 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// Collection name for quarantine entries.
+	COLLECTION_QUARANTINE = "quarantined_task_specs"
+
+	// We'll perform this many attempts for a given request.
+	DEFAULT_ATTEMPTS = 3
+
+	// Timeouts for various requests.
+	TIMEOUT_GET = 60 * time.Second
+	TIMEOUT_PUT = 10 * time.Second
+)
+
+var (
+	ERR_NO_SUCH_ENTRY = fmt.Errorf("No such quarantine entry.")
+)
+
+// Quarantine is a struct which contains the set of TaskSpecs which are
+// quarantined. Tasks for quarantined TaskSpecs are still scheduled and their
+// results are still reported, but their failures do not cause Jobs to fail.
+// TaskSpecs are identified by repo and name, since different repos may have
+// TaskSpecs with the same name.
+type Quarantine struct {
+	client  *firestore.Client
+	coll    *fs.CollectionRef
+	mtx     sync.RWMutex
+	entries map[entryKey]*Entry
+}
+
+// entryKey identifies a quarantined TaskSpec.
+type entryKey struct {
+	repo string
+	name string
+}
+
+// docId returns the ID of the Firestore document for the given TaskSpec.
+// Document IDs may not contain slashes, so the repo and name are escaped.
+func docId(repo, taskSpec string) string {
+	return url.QueryEscape(repo) + "|" + url.QueryEscape(taskSpec)
+}
+
+// NewWithParams returns a Quarantine instance backed by Firestore, using the
+// given params.
+func NewWithParams(ctx context.Context, project, instance string, ts oauth2.TokenSource) (*Quarantine, error) {
+	client, err := firestore.NewClient(ctx, project, firestore.APP_TASK_SCHEDULER, instance, ts)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, client)
+}
+
+// New returns a Quarantine instance backed by the given firestore.Client.
+func New(ctx context.Context, client *firestore.Client) (*Quarantine, error) {
+	q := &Quarantine{
+		client: client,
+		coll:   client.Collection(COLLECTION_QUARANTINE),
+	}
+	if err := q.Update(); err != nil {
+		util.LogErr(q.Close())
+		return nil, err
+	}
+	return q, nil
+}
+
+// Close closes the database.
+func (q *Quarantine) Close() error {
+	if q != nil {
+		return q.client.Close()
+	}
+	return nil
+}
+
+// Update updates the local view of the Quarantine to match the remote DB.
+func (q *Quarantine) Update() error {
+	if q == nil {
+		return nil
+	}
+	entries := map[entryKey]*Entry{}
+	if err := q.client.IterDocs(context.TODO(), "GetQuarantineEntries", "", q.coll.Query, DEFAULT_ATTEMPTS, TIMEOUT_GET, func(doc *fs.DocumentSnapshot) error {
+		var e Entry
+		if err := doc.DataTo(&e); err != nil {
+			return err
+		}
+		entries[e.key()] = &e
+		return nil
+	}); err != nil {
+		return err
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.entries = entries
+	return nil
+}
+
+// AutoUpdate starts a goroutine which automatically updates the Quarantine as
+// changes occur in the DB. Starts the goroutine and returns immediately. The
+// goroutine exits when the given context expires.
+func (q *Quarantine) AutoUpdate(ctx context.Context) {
+	go func() {
+		for snap := range firestore.QuerySnapshotChannel(ctx, q.coll.Query) {
+			sklog.Infof("Received quarantine update")
+			docs, err := snap.Documents.GetAll()
+			if err != nil {
+				sklog.Errorf("Failed to retrieve documents from query snapshot: %s", err)
+				continue
+			}
+			entries := make(map[entryKey]*Entry, len(docs))
+			for _, doc := range docs {
+				var e Entry
+				if err := doc.DataTo(&e); err != nil {
+					sklog.Errorf("Failed to decode document %s from query snapshot: %s", doc.Ref.ID, err)
+					continue
+				}
+				entries[e.key()] = &e
+			}
+			q.mtx.Lock()
+			q.entries = entries
+			q.mtx.Unlock()
+		}
+	}()
+}
+
+// IsQuarantined returns true iff the given TaskSpec in the given repo is
+// quarantined.
+func (q *Quarantine) IsQuarantined(repo, taskSpec string) bool {
+	if q == nil {
+		return false
+	}
+	q.mtx.RLock()
+	defer q.mtx.RUnlock()
+	_, ok := q.entries[entryKey{repo: repo, name: taskSpec}]
+	return ok
+}
+
+// AddEntry quarantines a TaskSpec.
+func (q *Quarantine) AddEntry(e *Entry) error {
+	if q == nil {
+		return errors.New("Quarantine is nil; cannot add entries.")
+	}
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	ref := q.coll.Doc(docId(e.Repo, e.Name))
+	if _, err := q.client.Create(context.TODO(), ref, e, DEFAULT_ATTEMPTS, TIMEOUT_PUT); err != nil {
+		return err
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.entries[e.key()] = e
+	return nil
+}
+
+// RemoveEntry removes the given TaskSpec in the given repo from the
+// Quarantine.
+func (q *Quarantine) RemoveEntry(repo, taskSpec string) error {
+	if q == nil {
+		return errors.New("Quarantine is nil; cannot remove entries.")
+	}
+	if !q.IsQuarantined(repo, taskSpec) {
+		return ERR_NO_SUCH_ENTRY
+	}
+	ref := q.coll.Doc(docId(repo, taskSpec))
+	if _, err := q.client.Delete(context.TODO(), ref, DEFAULT_ATTEMPTS, TIMEOUT_PUT); err != nil {
+		return err
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	delete(q.entries, entryKey{repo: repo, name: taskSpec})
+	return nil
+}
+
+// GetEntries returns a slice containing all of the Entries in the Quarantine,
+// sorted by repo and TaskSpec name.
+func (q *Quarantine) GetEntries() []*Entry {
+	if q == nil {
+		return []*Entry{}
+	}
+	q.mtx.RLock()
+	defer q.mtx.RUnlock()
+	rv := make([]*Entry, 0, len(q.entries))
+	for _, e := range q.entries {
+		rv = append(rv, e.Copy())
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Repo != rv[j].Repo {
+			return rv[i].Repo < rv[j].Repo
+		}
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+// Entry indicates that a TaskSpec is quarantined.
+type Entry struct {
+	Added       time.Time `json:"added"`
+	AddedBy     string    `json:"added_by"`
+	Description string    `json:"description"`
+	// Name is the name of the quarantined TaskSpec.
+	Name string `json:"name"`
+	// Repo is the repo which contains the quarantined TaskSpec.
+	Repo string `json:"repo"`
+}
+
+// key returns the entryKey for the Entry.
+func (e *Entry) key() entryKey {
+	return entryKey{repo: e.Repo, name: e.Name}
+}
+
+// Validate returns an error if the Entry is not valid.
+func (e *Entry) Validate() error {
+	if e.Name == "" {
+		return errors.New("Quarantine entries must have a TaskSpec name.")
+	}
+	if e.Repo == "" {
+		return errors.New("Quarantine entries must have a repo.")
+	}
+	if e.AddedBy == "" {
+		return errors.New("Quarantine entries must have an AddedBy user.")
+	}
+	if e.Description == "" {
+		return errors.New("Quarantine entries must have a description.")
+	}
+	if util.TimeIsZero(e.Added) {
+		return errors.New("Quarantine entries must have an Added timestamp.")
+	}
+	return nil
+}
+
+// Copy returns a deep copy of the Entry.
+func (e *Entry) Copy() *Entry {
+	return &Entry{
+		Added:       e.Added,
+		AddedBy:     e.AddedBy,
+		Description: e.Description,
+		Name:        e.Name,
+		Repo:        e.Repo,
+	}
+}
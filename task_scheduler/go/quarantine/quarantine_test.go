@@ -0,0 +1,110 @@
+package quarantine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/deepequal"
+	"go.skia.org/infra/go/firestore"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/testutils/unittest"
+)
+
+func setup(t *testing.T) (*Quarantine, func()) {
+	unittest.LargeTest(t)
+	c, cleanup := firestore.NewClientForTesting(t)
+	q, err := New(context.Background(), c)
+	require.NoError(t, err)
+	return q, cleanup
+}
+
+func TestAddRemove(t *testing.T) {
+	q1, cleanup := setup(t)
+	defer cleanup()
+
+	e := &Entry{
+		Added:       time.Unix(1572000000, 0).UTC(),
+		AddedBy:     "test@google.com",
+		Description: "Fails 10% of the time",
+		Name:        "Test-Flaky",
+		Repo:        "https://skia.googlesource.com/skia.git",
+	}
+	require.NoError(t, q1.AddEntry(e))
+	require.True(t, q1.IsQuarantined(e.Repo, e.Name))
+	require.False(t, q1.IsQuarantined(e.Repo, "Test-Other"))
+	// TaskSpecs with the same name in other repos are not quarantined.
+	require.False(t, q1.IsQuarantined("https://skia.googlesource.com/buildbot.git", e.Name))
+
+	// The Firestore emulator doesn't seem to allow different clients to see
+	// each other's data, so we use the same client as q1.
+	q2, err := New(context.Background(), q1.client)
+	require.NoError(t, err)
+	assertEqual := func() {
+		require.NoError(t, testutils.EventuallyConsistent(30*time.Second, func() error {
+			require.NoError(t, q2.Update())
+			if len(q1.entries) == len(q2.entries) {
+				deepequal.AssertDeepEqual(t, q1.GetEntries(), q2.GetEntries())
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+			return testutils.TryAgainErr
+		}))
+	}
+	assertEqual()
+	require.True(t, q2.IsQuarantined(e.Repo, e.Name))
+
+	require.NoError(t, q1.RemoveEntry(e.Repo, e.Name))
+	require.False(t, q1.IsQuarantined(e.Repo, e.Name))
+	require.Equal(t, ERR_NO_SUCH_ENTRY, q1.RemoveEntry(e.Repo, e.Name))
+	assertEqual()
+}
+
+func TestEntryCopy(t *testing.T) {
+	unittest.SmallTest(t)
+	e := &Entry{
+		Added:       time.Unix(1572000000, 0).UTC(),
+		AddedBy:     "me@google.com",
+		Description: "flaky",
+		Name:        "Test-Flaky",
+		Repo:        "https://skia.googlesource.com/skia.git",
+	}
+	deepequal.AssertCopy(t, e, e.Copy())
+}
+
+func TestEntryValidate(t *testing.T) {
+	unittest.SmallTest(t)
+	e := &Entry{
+		Added:       time.Unix(1572000000, 0).UTC(),
+		AddedBy:     "me@google.com",
+		Description: "flaky",
+		Name:        "Test-Flaky",
+		Repo:        "https://skia.googlesource.com/skia.git",
+	}
+	require.NoError(t, e.Validate())
+	e.Name = ""
+	require.EqualError(t, e.Validate(), "Quarantine entries must have a TaskSpec name.")
+	e.Name = "Test-Flaky"
+	e.Repo = ""
+	require.EqualError(t, e.Validate(), "Quarantine entries must have a repo.")
+	e.Repo = "https://skia.googlesource.com/skia.git"
+	e.AddedBy = ""
+	require.EqualError(t, e.Validate(), "Quarantine entries must have an AddedBy user.")
+	e.AddedBy = "me@google.com"
+	e.Description = ""
+	require.EqualError(t, e.Validate(), "Quarantine entries must have a description.")
+	e.Description = "flaky"
+	e.Added = time.Time{}
+	require.EqualError(t, e.Validate(), "Quarantine entries must have an Added timestamp.")
+}
+
+func TestNilQuarantine(t *testing.T) {
+	unittest.SmallTest(t)
+	var q *Quarantine
+	require.False(t, q.IsQuarantined("https://skia.googlesource.com/skia.git", "Test-Flaky"))
+	require.Equal(t, []*Entry{}, q.GetEntries())
+	require.NoError(t, q.Update())
+	require.Error(t, q.AddEntry(&Entry{}))
+	require.Error(t, q.RemoveEntry("https://skia.googlesource.com/skia.git", "Test-Flaky"))
+}
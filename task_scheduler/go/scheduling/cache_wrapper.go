@@ -62,6 +62,11 @@ func (c *cacheWrapper) GetTasksFromDateRange(time.Time, time.Time) ([]*types.Tas
 	return nil, fmt.Errorf("cacheWrapper.GetTasksFromDateRange not implemented.")
 }
 
+// See documentation for TaskCache interface.
+func (c *cacheWrapper) GetTaskForReuseKey(string) (*types.Task, error) {
+	return nil, fmt.Errorf("cacheWrapper.GetTaskForReuseKey not implemented.")
+}
+
 // See documentation for TaskCache interface.
 func (c *cacheWrapper) KnownTaskName(repo, name string) bool {
 	if c.known {
@@ -0,0 +1,488 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	// FairnessConfig.Pools entry which applies to pools which are not
+	// otherwise listed.
+	FAIRNESS_DEFAULT_POOL = "*"
+
+	// Default window over which bot time usage is measured.
+	DEFAULT_FAIRNESS_WINDOW = 24 * time.Hour
+
+	// The scores of candidates belonging to a tenant which is over its
+	// quota are multiplied by FAIRNESS_OVER_QUOTA_MULTIPLIER, so that they
+	// only run when nothing else needs the bots.
+	FAIRNESS_OVER_QUOTA_MULTIPLIER = 0.01
+
+	// The scores of candidates belonging to a tenant which has used more
+	// than its fair share of bot time are multiplied by the ratio of its
+	// fair share to its actual share, but not less than
+	// FAIRNESS_MIN_MULTIPLIER.
+	FAIRNESS_MIN_MULTIPLIER = 0.1
+
+	MEASUREMENT_FAIRNESS_SHARE = "task_scheduler_fairness_share"
+
+	// Tasks which finished within the fairness window may have been created
+	// up to fairnessTaskLookback before it, since they may have been pending
+	// and running for a long time. Unfinished tasks are always included.
+	fairnessTaskLookback = 24 * time.Hour
+
+	fairnessDimensionRepo    = "repo"
+	fairnessDimensionTrigger = "trigger"
+)
+
+// FairnessConfig describes how the bot time of each Swarming pool is shared
+// among repos and trigger types.
+type FairnessConfig struct {
+	// Pools maps Swarming pool names to the configuration for that pool.
+	// The FAIRNESS_DEFAULT_POOL entry applies to pools which are not
+	// otherwise listed. Pools with no configuration are not subject to
+	// fairness.
+	Pools map[string]*PoolFairnessConfig `json:"pools"`
+	// Window is the period of time over which bot time usage is
+	// measured, eg. "12h". Defaults to DEFAULT_FAIRNESS_WINDOW.
+	Window string `json:"window,omitempty"`
+}
+
+// PoolFairnessConfig describes how the bot time of a single pool is shared.
+// Repos and trigger types which are not listed have a weight of 1 and no
+// quota.
+type PoolFairnessConfig struct {
+	// Repos maps repo URLs to their shares of the pool.
+	Repos map[string]*FairnessShare `json:"repos,omitempty"`
+	// Triggers maps trigger types, ie. types.TRIGGER_TYPE_*, to their shares of
+	// the pool.
+	Triggers map[string]*FairnessShare `json:"triggers,omitempty"`
+}
+
+// FairnessShare describes a tenant's share of a pool's bot time.
+type FairnessShare struct {
+	// Weight is the tenant's share of the pool relative to the other
+	// tenants which are using or want to use it. Defaults to 1.
+	Weight float64 `json:"weight,omitempty"`
+	// Quota is the maximum fraction of the pool's bot time, in (0, 1],
+	// which the tenant may use within the window before its candidates
+	// are deprioritized below everyone else's. Zero means no quota.
+	Quota float64 `json:"quota,omitempty"`
+}
+
+// Validate returns an error if the FairnessConfig is not valid.
+func (c *FairnessConfig) Validate() error {
+	if _, err := c.getWindow(); err != nil {
+		return err
+	}
+	for pool, pc := range c.Pools {
+		if pc == nil {
+			return fmt.Errorf("Pool %q has no configuration.", pool)
+		}
+		for repo, share := range pc.Repos {
+			if err := share.validate(); err != nil {
+				return fmt.Errorf("Pool %q: repo %q: %s", pool, repo, err)
+			}
+		}
+		for trigger, share := range pc.Triggers {
+			if !util.In(trigger, types.TRIGGER_TYPES) {
+				return fmt.Errorf("Pool %q: unknown trigger type %q; expected one of %v", pool, trigger, types.TRIGGER_TYPES)
+			}
+			if err := share.validate(); err != nil {
+				return fmt.Errorf("Pool %q: trigger %q: %s", pool, trigger, err)
+			}
+		}
+	}
+	return nil
+}
+
+// getWindow returns the window over which bot time usage is measured.
+func (c *FairnessConfig) getWindow() (time.Duration, error) {
+	if c.Window == "" {
+		return DEFAULT_FAIRNESS_WINDOW, nil
+	}
+	w, err := time.ParseDuration(c.Window)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid window %q: %s", c.Window, err)
+	}
+	if w <= 0 {
+		return 0, fmt.Errorf("Window must be positive.")
+	}
+	return w, nil
+}
+
+// getPool returns the configuration for the given pool, or nil if the pool is
+// not subject to fairness.
+func (c *FairnessConfig) getPool(pool string) *PoolFairnessConfig {
+	if pc, ok := c.Pools[pool]; ok {
+		return pc
+	}
+	return c.Pools[FAIRNESS_DEFAULT_POOL]
+}
+
+// validate returns an error if the FairnessShare is not valid.
+func (s *FairnessShare) validate() error {
+	if s == nil {
+		return fmt.Errorf("Share is missing.")
+	}
+	if s.Weight < 0 {
+		return fmt.Errorf("Weight must not be negative.")
+	}
+	if s.Quota < 0 || s.Quota > 1 {
+		return fmt.Errorf("Quota must be in [0, 1].")
+	}
+	return nil
+}
+
+// ReadFairnessConfig reads a FairnessConfig from the given JSON file.
+func ReadFairnessConfig(file string) (*FairnessConfig, error) {
+	var cfg FairnessConfig
+	if err := util.WithReadFile(file, func(f io.Reader) error {
+		return json.NewDecoder(f).Decode(&cfg)
+	}); err != nil {
+		return nil, fmt.Errorf("Failed to read fairness config: %s", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid fairness config: %s", err)
+	}
+	return &cfg, nil
+}
+
+// fairnessTenant identifies the consumer of a task's bot time.
+type fairnessTenant struct {
+	pool    string
+	repo    string
+	trigger string
+}
+
+// get returns the tenant's value for the given dimension.
+func (t fairnessTenant) get(dimension string) string {
+	if dimension == fairnessDimensionRepo {
+		return t.repo
+	}
+	return t.trigger
+}
+
+// getShare returns the given tenant's FairnessShare for the given dimension.
+func (pc *PoolFairnessConfig) getShare(dimension, value string) *FairnessShare {
+	var share *FairnessShare
+	if dimension == fairnessDimensionRepo {
+		share = pc.Repos[value]
+	} else {
+		share = pc.Triggers[value]
+	}
+	if share == nil {
+		share = &FairnessShare{}
+	}
+	return share
+}
+
+// weight returns the FairnessShare's weight, accounting for the default.
+func (s *FairnessShare) weight() float64 {
+	if s.Weight == 0 {
+		return 1.0
+	}
+	return s.Weight
+}
+
+// fairness tracks bot time usage by tenant and computes the score multipliers
+// which enforce the FairnessConfig. It is only used from the MainLoop.
+type fairness struct {
+	cfg    *FairnessConfig
+	window time.Duration
+
+	// Cached tenants of tasks, by ID.
+	taskTenants  map[string]fairnessTenant
+	shareMetrics map[string]metrics2.Float64Metric
+
+	// Score multipliers for the current set of candidates.
+	multipliers map[types.TaskKey]float64
+}
+
+// newFairness returns a fairness instance for the given config. Returns nil if
+// the config is nil.
+func newFairness(cfg *FairnessConfig) (*fairness, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	window, _ := cfg.getWindow()
+	return &fairness{
+		cfg:          cfg,
+		window:       window,
+		taskTenants:  map[string]fairnessTenant{},
+		shareMetrics: map[string]metrics2.Float64Metric{},
+		multipliers:  map[types.TaskKey]float64{},
+	}, nil
+}
+
+// getPoolFromDimensions returns the Swarming pool from the given dimensions.
+func getPoolFromDimensions(dims []string) string {
+	for _, d := range dims {
+		if strings.HasPrefix(d, "pool:") {
+			return strings.TrimPrefix(d, "pool:")
+		}
+	}
+	return ""
+}
+
+// getTaskTenant returns the tenant of the given Task.
+func (s *TaskScheduler) getTaskTenant(ctx context.Context, t *types.Task) (fairnessTenant, error) {
+	if tenant, ok := s.fairness.taskTenants[t.Id]; ok {
+		return tenant, nil
+	}
+	spec, err := s.taskCfgCache.GetTaskSpec(ctx, t.RepoState, t.Name)
+	if err != nil {
+		return fairnessTenant{}, err
+	}
+	jobs := make([]*types.Job, 0, len(t.Jobs))
+	for _, id := range t.Jobs {
+		// Long-running tasks may outlive their Jobs in the cache.
+		j, err := s.jCache.GetJobMaybeExpired(id)
+		if err != nil {
+			return fairnessTenant{}, err
+		}
+		if j != nil {
+			jobs = append(jobs, j)
+		}
+	}
+	tenant := fairnessTenant{
+		pool:    getPoolFromDimensions(spec.Dimensions),
+		repo:    t.Repo,
+		trigger: s.getTriggerType(ctx, t.TaskKey, jobs),
+	}
+	s.fairness.taskTenants[t.Id] = tenant
+	return tenant, nil
+}
+
+// updateFairness measures the bot time used by each tenant within the window
+// preceding the given time, updates the share metrics, and computes the score
+// multipliers for the given candidates.
+func (s *TaskScheduler) updateFairness(ctx context.Context, candidates map[string]map[string][]*taskCandidate, now time.Time) error {
+	if s.fairness == nil {
+		return nil
+	}
+	defer metrics2.FuncTimer().Stop()
+
+	usage, err := s.measureFairnessUsage(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	// Find the tenants of the candidates.
+	candidateTenants := map[types.TaskKey]fairnessTenant{}
+	for _, byName := range candidates {
+		for _, cs := range byName {
+			for _, c := range cs {
+				candidateTenants[c.TaskKey] = fairnessTenant{
+					pool:    getPoolFromDimensions(c.TaskSpec.Dimensions),
+					repo:    c.Repo,
+					trigger: s.getTriggerType(ctx, c.TaskKey, c.Jobs),
+				}
+			}
+		}
+	}
+	multipliers, shares := computeFairnessMultipliers(s.fairness.cfg, usage, candidateTenants)
+	s.fairness.multipliers = multipliers
+	s.recordFairnessMetrics(shares)
+	return nil
+}
+
+// measureFairnessUsage returns the bot time used by each tenant, in seconds,
+// within the fairness window preceding the given time.
+func (s *TaskScheduler) measureFairnessUsage(ctx context.Context, now time.Time) (map[fairnessTenant]float64, error) {
+	// Measure bot time usage. Tasks are indexed by creation time, so we
+	// also have to look at tasks which were created before the window but
+	// ran within it.
+	windowStart := now.Add(-s.fairness.window)
+	tasks, err := s.tCache.GetTasksFromDateRange(windowStart.Add(-fairnessTaskLookback), now)
+	if err != nil {
+		return nil, err
+	}
+	unfinished, err := s.tCache.UnfinishedTasks()
+	if err != nil {
+		return nil, err
+	}
+	tasks = append(tasks, unfinished...)
+	usage := map[fairnessTenant]float64{}
+	taskTenants := make(map[string]fairnessTenant, len(tasks))
+	for _, t := range tasks {
+		if _, ok := taskTenants[t.Id]; ok {
+			continue
+		}
+		secs := taskUsage(t, windowStart, now)
+		if secs == 0 {
+			continue
+		}
+		tenant, err := s.getTaskTenant(ctx, t)
+		if err != nil {
+			sklog.Warningf("Failed to determine tenant of task %s; ignoring for fairness: %s", t.Id, err)
+			continue
+		}
+		taskTenants[t.Id] = tenant
+		usage[tenant] += secs
+	}
+	// Forget about tasks which have scrolled out of the window.
+	s.fairness.taskTenants = taskTenants
+	return usage, nil
+}
+
+// taskUsage returns the number of seconds of bot time the given Task used
+// between windowStart and now.
+func taskUsage(t *types.Task, windowStart, now time.Time) float64 {
+	if util.TimeIsZero(t.Started) {
+		return 0
+	}
+	start := t.Started
+	if start.Before(windowStart) {
+		start = windowStart
+	}
+	end := now
+	if t.Done() && !util.TimeIsZero(t.Finished) && t.Finished.Before(now) {
+		end = t.Finished
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start).Seconds()
+}
+
+// computeFairnessMultipliers returns the score multiplier for each candidate,
+// given the bot time usage of each tenant and the tenant of each candidate.
+// Also returns each tenant's actual share of each pool's bot time, keyed by
+// pool, dimension and tenant.
+func computeFairnessMultipliers(cfg *FairnessConfig, usage map[fairnessTenant]float64, candidateTenants map[types.TaskKey]fairnessTenant) (map[types.TaskKey]float64, map[string]map[string]map[string]float64) {
+	// Aggregate the usage by pool and dimension, and find the set of
+	// active tenants, ie. those who have used or want to use each pool.
+	totalByPool := map[string]float64{}
+	usageByPool := map[string]map[string]map[string]float64{}
+	addTenant := func(tenant fairnessTenant, secs float64) {
+		byDim, ok := usageByPool[tenant.pool]
+		if !ok {
+			byDim = map[string]map[string]float64{
+				fairnessDimensionRepo:    {},
+				fairnessDimensionTrigger: {},
+			}
+			usageByPool[tenant.pool] = byDim
+		}
+		for dim, byValue := range byDim {
+			byValue[tenant.get(dim)] += secs
+		}
+		totalByPool[tenant.pool] += secs
+	}
+	for tenant, secs := range usage {
+		addTenant(tenant, secs)
+	}
+	for _, tenant := range candidateTenants {
+		addTenant(tenant, 0)
+	}
+
+	// Compute the actual shares and the multiplier for each tenant.
+	shares := make(map[string]map[string]map[string]float64, len(usageByPool))
+	tenantMultipliers := map[string]map[string]map[string]float64{}
+	for pool, byDim := range usageByPool {
+		shares[pool] = make(map[string]map[string]float64, len(byDim))
+		pc := cfg.getPool(pool)
+		if pc != nil {
+			tenantMultipliers[pool] = make(map[string]map[string]float64, len(byDim))
+		}
+		total := totalByPool[pool]
+		for dim, byValue := range byDim {
+			shares[pool][dim] = make(map[string]float64, len(byValue))
+			totalWeight := 0.0
+			if pc != nil {
+				tenantMultipliers[pool][dim] = make(map[string]float64, len(byValue))
+				for value := range byValue {
+					totalWeight += pc.getShare(dim, value).weight()
+				}
+			}
+			for value, secs := range byValue {
+				actual := 0.0
+				if total > 0 {
+					actual = secs / total
+				}
+				shares[pool][dim][value] = actual
+				if pc == nil {
+					continue
+				}
+				share := pc.getShare(dim, value)
+				fair := share.weight() / totalWeight
+				multiplier := 1.0
+				if share.Quota > 0 && actual >= share.Quota {
+					multiplier = FAIRNESS_OVER_QUOTA_MULTIPLIER
+				} else if actual > fair {
+					multiplier = fair / actual
+					if multiplier < FAIRNESS_MIN_MULTIPLIER {
+						multiplier = FAIRNESS_MIN_MULTIPLIER
+					}
+				}
+				tenantMultipliers[pool][dim][value] = multiplier
+			}
+		}
+	}
+
+	// Apply the multipliers to the candidates.
+	multipliers := make(map[types.TaskKey]float64, len(candidateTenants))
+	for k, tenant := range candidateTenants {
+		byDim, ok := tenantMultipliers[tenant.pool]
+		if !ok {
+			continue
+		}
+		multipliers[k] = byDim[fairnessDimensionRepo][tenant.repo] * byDim[fairnessDimensionTrigger][tenant.trigger]
+	}
+	return multipliers, shares
+}
+
+// recordFairnessMetrics reports each tenant's share of each pool's bot time.
+func (s *TaskScheduler) recordFairnessMetrics(shares map[string]map[string]map[string]float64) {
+	seen := map[string]bool{}
+	for pool, byDim := range shares {
+		for dim, byValue := range byDim {
+			for value, share := range byValue {
+				tags := map[string]string{
+					"pool":      pool,
+					"dimension": dim,
+					"tenant":    value,
+				}
+				key := fmt.Sprintf("%s|%s|%s", pool, dim, value)
+				seen[key] = true
+				metric, ok := s.fairness.shareMetrics[key]
+				if !ok {
+					metric = metrics2.GetFloat64Metric(MEASUREMENT_FAIRNESS_SHARE, tags)
+					s.fairness.shareMetrics[key] = metric
+				}
+				metric.Update(share)
+			}
+		}
+	}
+	for key, metric := range s.fairness.shareMetrics {
+		if !seen[key] {
+			if err := metric.Delete(); err != nil {
+				sklog.Errorf("Failed to delete metric: %s", err)
+			}
+			delete(s.fairness.shareMetrics, key)
+		}
+	}
+}
+
+// applyFairness multiplies the candidate's score by its fairness multiplier.
+func (s *TaskScheduler) applyFairness(c *taskCandidate, diag *taskCandidateScoringDiagnostics) {
+	if s.fairness == nil {
+		return
+	}
+	if multiplier, ok := s.fairness.multipliers[c.TaskKey]; ok {
+		c.Score *= multiplier
+		diag.FairnessMultiplier = multiplier
+	}
+}
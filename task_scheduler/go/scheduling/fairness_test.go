@@ -0,0 +1,268 @@
+package scheduling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/db/cache"
+	"go.skia.org/infra/task_scheduler/go/db/memory"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/types"
+	"go.skia.org/infra/task_scheduler/go/window"
+)
+
+func TestFairnessConfigValidate(t *testing.T) {
+	unittest.SmallTest(t)
+
+	test := func(cfg *FairnessConfig, expectErr string) {
+		err := cfg.Validate()
+		if expectErr == "" {
+			require.NoError(t, err)
+		} else {
+			require.EqualError(t, err, expectErr)
+		}
+	}
+	test(&FairnessConfig{}, "")
+	test(&FairnessConfig{
+		Pools: map[string]*PoolFairnessConfig{
+			"Skia": {
+				Repos: map[string]*FairnessShare{
+					"a.git": {Weight: 3},
+				},
+				Triggers: map[string]*FairnessShare{
+					types.TRIGGER_TYPE_TRYJOB: {Quota: 0.5},
+				},
+			},
+		},
+		Window: "12h",
+	}, "")
+	test(&FairnessConfig{Window: "bogus"}, "Invalid window \"bogus\": time: invalid duration \"bogus\"")
+	test(&FairnessConfig{Window: "-1h"}, "Window must be positive.")
+	test(&FairnessConfig{
+		Pools: map[string]*PoolFairnessConfig{"Skia": nil},
+	}, "Pool \"Skia\" has no configuration.")
+	test(&FairnessConfig{
+		Pools: map[string]*PoolFairnessConfig{
+			"Skia": {
+				Repos: map[string]*FairnessShare{
+					"a.git": {Weight: -1},
+				},
+			},
+		},
+	}, "Pool \"Skia\": repo \"a.git\": Weight must not be negative.")
+	test(&FairnessConfig{
+		Pools: map[string]*PoolFairnessConfig{
+			"Skia": {
+				Triggers: map[string]*FairnessShare{
+					types.TRIGGER_TYPE_FORCED: {Quota: 1.5},
+				},
+			},
+		},
+	}, "Pool \"Skia\": trigger \"forced\": Quota must be in [0, 1].")
+	test(&FairnessConfig{
+		Pools: map[string]*PoolFairnessConfig{
+			"Skia": {
+				Triggers: map[string]*FairnessShare{
+					"nightly": {},
+				},
+			},
+		},
+	}, "Pool \"Skia\": unknown trigger type \"nightly\"; expected one of [commit forced periodic tryjob upstream]")
+}
+
+func TestComputeFairnessMultipliers(t *testing.T) {
+	unittest.SmallTest(t)
+
+	cfg := &FairnessConfig{
+		Pools: map[string]*PoolFairnessConfig{
+			"Skia": {
+				Triggers: map[string]*FairnessShare{
+					types.TRIGGER_TYPE_TRYJOB: {Quota: 0.5},
+				},
+			},
+		},
+	}
+	key := func(repo, name string) types.TaskKey {
+		return types.TaskKey{
+			RepoState: types.RepoState{
+				Repo:     repo,
+				Revision: "abc123",
+			},
+			Name: name,
+		}
+	}
+	aCommit := fairnessTenant{pool: "Skia", repo: "a.git", trigger: types.TRIGGER_TYPE_COMMIT}
+	bCommit := fairnessTenant{pool: "Skia", repo: "b.git", trigger: types.TRIGGER_TYPE_COMMIT}
+	bTryjob := fairnessTenant{pool: "Skia", repo: "b.git", trigger: types.TRIGGER_TYPE_TRYJOB}
+	aOther := fairnessTenant{pool: "Other", repo: "a.git", trigger: types.TRIGGER_TYPE_COMMIT}
+	kA := key("a.git", "Build")
+	kB := key("b.git", "Test")
+	kOther := key("a.git", "Perf")
+	candidates := map[types.TaskKey]fairnessTenant{
+		kA:     aCommit,
+		kB:     bTryjob,
+		kOther: aOther,
+	}
+
+	// a.git has used more than its fair share of the pool, and so have
+	// commit-triggered tasks, since try jobs are waiting. The "Other" pool
+	// is not subject to fairness.
+	multipliers, shares := computeFairnessMultipliers(cfg, map[fairnessTenant]float64{
+		aCommit: 800,
+		bCommit: 200,
+		aOther:  1000,
+	}, candidates)
+	require.Equal(t, map[types.TaskKey]float64{
+		kA: 0.625 * 0.5,
+		kB: 1.0,
+	}, multipliers)
+	require.Equal(t, map[string]map[string]map[string]float64{
+		"Skia": {
+			fairnessDimensionRepo: {
+				"a.git": 0.8,
+				"b.git": 0.2,
+			},
+			fairnessDimensionTrigger: {
+				types.TRIGGER_TYPE_COMMIT: 1.0,
+				types.TRIGGER_TYPE_TRYJOB: 0.0,
+			},
+		},
+		"Other": {
+			fairnessDimensionRepo: {
+				"a.git": 1.0,
+			},
+			fairnessDimensionTrigger: {
+				types.TRIGGER_TYPE_COMMIT: 1.0,
+			},
+		},
+	}, shares)
+
+	// Try jobs have reached their quota.
+	multipliers, _ = computeFairnessMultipliers(cfg, map[fairnessTenant]float64{
+		aCommit: 1000,
+		bTryjob: 1000,
+	}, candidates)
+	require.Equal(t, map[types.TaskKey]float64{
+		kA: 1.0,
+		kB: FAIRNESS_OVER_QUOTA_MULTIPLIER,
+	}, multipliers)
+
+	// The default pool config applies to unlisted pools. a.git is far
+	// over its fair share, but its multiplier is capped.
+	cfg.Pools[FAIRNESS_DEFAULT_POOL] = &PoolFairnessConfig{
+		Repos: map[string]*FairnessShare{
+			"b.git": {Weight: 19},
+		},
+	}
+	bOther := fairnessTenant{pool: "Other", repo: "b.git", trigger: types.TRIGGER_TYPE_COMMIT}
+	kBOther := key("b.git", "Perf")
+	multipliers, _ = computeFairnessMultipliers(cfg, map[fairnessTenant]float64{
+		aOther: 990,
+		bOther: 10,
+	}, map[types.TaskKey]fairnessTenant{
+		kOther:  aOther,
+		kBOther: bOther,
+	})
+	require.Equal(t, map[types.TaskKey]float64{
+		kOther:  FAIRNESS_MIN_MULTIPLIER,
+		kBOther: 1.0,
+	}, multipliers)
+}
+
+func TestTaskUsage(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1580000000, 0)
+	windowStart := now.Add(-time.Hour)
+	task := func(started, finished time.Duration, status types.TaskStatus) *types.Task {
+		t := &types.Task{Status: status}
+		if started != 0 {
+			t.Started = now.Add(-started)
+		}
+		if finished != 0 {
+			t.Finished = now.Add(-finished)
+		}
+		return t
+	}
+
+	// Not yet started.
+	require.Equal(t, 0.0, taskUsage(task(0, 0, types.TASK_STATUS_PENDING), windowStart, now))
+	// Started before the window and still running.
+	require.Equal(t, 3600.0, taskUsage(task(3*time.Hour, 0, types.TASK_STATUS_RUNNING), windowStart, now))
+	// Started before the window and finished within it.
+	require.Equal(t, 1200.0, taskUsage(task(2*time.Hour, 40*time.Minute, types.TASK_STATUS_SUCCESS), windowStart, now))
+	// Ran entirely within the window.
+	require.Equal(t, 600.0, taskUsage(task(30*time.Minute, 20*time.Minute, types.TASK_STATUS_FAILURE), windowStart, now))
+	// Finished before the window.
+	require.Equal(t, 0.0, taskUsage(task(3*time.Hour, 2*time.Hour, types.TASK_STATUS_SUCCESS), windowStart, now))
+}
+
+func TestMeasureFairnessUsage(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	now := time.Now()
+	d := memory.NewInMemoryDB()
+	task := func(repo string, created, started, finished time.Duration) *types.Task {
+		t := &types.Task{
+			TaskKey: types.TaskKey{
+				RepoState: types.RepoState{
+					Repo:     repo,
+					Revision: "abc123",
+				},
+				Name: "Build",
+			},
+			Created: now.Add(-created),
+			Started: now.Add(-started),
+			// None of the Jobs are in the DB, as if they had expired.
+			Jobs:           []string{"missing-job"},
+			Status:         types.TASK_STATUS_RUNNING,
+			SwarmingTaskId: "swarming-task",
+		}
+		if finished != 0 {
+			t.Finished = now.Add(-finished)
+			t.Status = types.TASK_STATUS_SUCCESS
+		}
+		return t
+	}
+	tasks := []*types.Task{
+		// Created well before the window, still running.
+		task("a.git", 30*time.Hour, 30*time.Hour, 0),
+		// Created before the window, finished within it.
+		task("a.git", 2*time.Hour, 90*time.Minute, 30*time.Minute),
+		// Ran within the window.
+		task("b.git", 30*time.Minute, 30*time.Minute, 20*time.Minute),
+		// Finished before the window.
+		task("b.git", 3*time.Hour, 3*time.Hour, 2*time.Hour),
+	}
+	require.NoError(t, d.PutTasks(tasks))
+
+	w, err := window.New(72*time.Hour, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.UpdateWithTime(now))
+	tCache, err := cache.NewTaskCache(ctx, d, w, nil)
+	require.NoError(t, err)
+	jCache, err := cache.NewJobCache(ctx, d, w, nil)
+	require.NoError(t, err)
+	f, err := newFairness(&FairnessConfig{Window: "1h"})
+	require.NoError(t, err)
+	s := &TaskScheduler{
+		fairness: f,
+		jCache:   jCache,
+		taskCfgCache: &simTaskCfgProvider{taskSpecs: map[string]*specs.TaskSpec{
+			"Build": {Dimensions: []string{"pool:Skia"}},
+		}},
+		tCache: tCache,
+	}
+
+	usage, err := s.measureFairnessUsage(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, map[fairnessTenant]float64{
+		{pool: "Skia", repo: "a.git", trigger: types.TRIGGER_TYPE_COMMIT}: 3600 + 1800,
+		{pool: "Skia", repo: "b.git", trigger: types.TRIGGER_TYPE_COMMIT}: 600,
+	}, usage)
+	require.Len(t, s.fairness.taskTenants, 3)
+}
@@ -0,0 +1,597 @@
+package scheduling
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/git"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
+	"go.skia.org/infra/task_scheduler/go/db/cache"
+	"go.skia.org/infra/task_scheduler/go/db/memory"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/types"
+	"go.skia.org/infra/task_scheduler/go/window"
+)
+
+const (
+	// Defaults for SimulatorParams.
+	SIMULATOR_DEFAULT_TICK          = time.Minute
+	SIMULATOR_DEFAULT_TASK_DURATION = 10 * time.Minute
+	SIMULATOR_DEFAULT_WINDOW        = 4 * 24 * time.Hour
+	SIMULATOR_DEFAULT_COMMITS       = 10
+)
+
+// SimulatorRepo contains the commits and branches of one repo.
+type SimulatorRepo struct {
+	Branches []*git.Branch         `json:"branches"`
+	Commits  []*vcsinfo.LongCommit `json:"commits"`
+}
+
+// SimulatorSnapshot contains the historical data which is replayed by
+// Simulate.
+type SimulatorSnapshot struct {
+	// Start and End of the time period to simulate.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Repos maps repo URLs to their commits. Commits are revealed to the
+	// simulated scheduler as time passes.
+	Repos map[string]*SimulatorRepo `json:"repos"`
+	// TaskSpecs by name. The same TaskSpecs are used at every commit.
+	TaskSpecs map[string]*specs.TaskSpec `json:"taskSpecs"`
+	// Jobs are added to the simulated scheduler at their Created time.
+	Jobs []*types.Job `json:"jobs"`
+	// Tasks which finished before Start are used as the initial state of
+	// the simulated DB. The durations and results of all Tasks are used
+	// for the simulated tasks.
+	Tasks []*types.Task `json:"tasks"`
+	// Bots as of Start. Bots which are dead or quarantined can't run tasks.
+	Bots []*types.Machine `json:"bots"`
+	// BotEvents record changes to the bots during the simulated period.
+	BotEvents []*SimulatorBotEvent `json:"botEvents,omitempty"`
+}
+
+// SimulatorBotEvent records the state of a bot after it changed, eg. because
+// the bot was added, died, or was quarantined.
+type SimulatorBotEvent struct {
+	Time time.Time      `json:"time"`
+	Bot  *types.Machine `json:"bot"`
+}
+
+// SimulatorParams are the parameters of a single simulation run.
+type SimulatorParams struct {
+	// Name is used to identify the run in reports.
+	Name string `json:"name"`
+	// Tick is the interval between simulated scheduling loops.
+	Tick time.Duration `json:"tick"`
+	// TimeDecayAmt24Hr is the candidate score time decay; see
+	// NewTaskScheduler.
+	TimeDecayAmt24Hr float64 `json:"timeDecayAmt24Hr"`
+	// Window and WindowCommits define the scheduling window.
+	Window        time.Duration `json:"window"`
+	WindowCommits int           `json:"windowCommits"`
+	// JobPriorities overrides the priority of Jobs by name.
+	JobPriorities map[string]float64 `json:"jobPriorities,omitempty"`
+	// TaskDurations overrides the durations of tasks by TaskSpec name.
+	// Otherwise the duration of a matching historical task is used, or
+	// DefaultTaskDuration if there is none.
+	TaskDurations       map[string]time.Duration `json:"taskDurations,omitempty"`
+	DefaultTaskDuration time.Duration            `json:"defaultTaskDuration"`
+}
+
+// DefaultSimulatorParams returns SimulatorParams matching the production
+// configuration of the Task Scheduler.
+func DefaultSimulatorParams() *SimulatorParams {
+	return &SimulatorParams{
+		Name:                "default",
+		Tick:                SIMULATOR_DEFAULT_TICK,
+		TimeDecayAmt24Hr:    0.9,
+		Window:              SIMULATOR_DEFAULT_WINDOW,
+		WindowCommits:       SIMULATOR_DEFAULT_COMMITS,
+		DefaultTaskDuration: SIMULATOR_DEFAULT_TASK_DURATION,
+	}
+}
+
+// Validate returns an error if the SimulatorParams are not valid.
+func (p *SimulatorParams) Validate() error {
+	if p.Tick <= 0 {
+		return fmt.Errorf("Tick must be positive.")
+	}
+	if p.TimeDecayAmt24Hr < 0 || p.TimeDecayAmt24Hr > 1 {
+		return fmt.Errorf("TimeDecayAmt24Hr must be in [0, 1].")
+	}
+	if p.Window <= 0 {
+		return fmt.Errorf("Window must be positive.")
+	}
+	if p.DefaultTaskDuration <= 0 {
+		return fmt.Errorf("DefaultTaskDuration must be positive.")
+	}
+	for name, prio := range p.JobPriorities {
+		if prio <= 0 || prio > 1 {
+			return fmt.Errorf("Priority for job %q must be in (0, 1].", name)
+		}
+	}
+	return nil
+}
+
+// SimulatorStats summarizes a set of values.
+type SimulatorStats struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// makeSimulatorStats returns SimulatorStats for the given values.
+func makeSimulatorStats(vals []float64) *SimulatorStats {
+	rv := &SimulatorStats{
+		Count: len(vals),
+	}
+	if len(vals) == 0 {
+		return rv
+	}
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	percentile := func(p float64) float64 {
+		idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return sorted[idx]
+	}
+	rv.Mean = sum / float64(len(sorted))
+	rv.P50 = percentile(0.5)
+	rv.P90 = percentile(0.9)
+	rv.P99 = percentile(0.99)
+	rv.Max = sorted[len(sorted)-1]
+	return rv
+}
+
+// SimulatorResult is the outcome of a simulation run.
+type SimulatorResult struct {
+	Params *SimulatorParams `json:"params"`
+	// TasksTriggered is the number of tasks which were triggered.
+	TasksTriggered int `json:"tasksTriggered"`
+	// QueueLatency is the time in seconds between a task candidate first
+	// appearing in the queue and the task being triggered.
+	QueueLatency *SimulatorStats `json:"queueLatency"`
+	// JobLatency is the time in seconds between a Job being created and
+	// finishing, for Jobs which finished during the simulation.
+	JobLatency *SimulatorStats `json:"jobLatency"`
+	// BlamelistLength is the number of commits covered by each triggered
+	// non-try-job task.
+	BlamelistLength *SimulatorStats `json:"blamelistLength"`
+	// BotUtilization is the fraction of available bot time spent running
+	// tasks. Bots are available while they are alive and not quarantined,
+	// or while they are running a task.
+	BotUtilization float64 `json:"botUtilization"`
+	// UnfinishedJobs is the number of Jobs which had not finished when the
+	// simulation ended.
+	UnfinishedJobs int `json:"unfinishedJobs"`
+	// QueueLength is the length of the queue when the simulation ended.
+	QueueLength int `json:"queueLength"`
+}
+
+// simTaskCfgProvider implements taskCfgProvider using a fixed set of
+// TaskSpecs.
+type simTaskCfgProvider struct {
+	taskSpecs map[string]*specs.TaskSpec
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) Cleanup(context.Context, time.Duration) error {
+	return nil
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) Close() error {
+	return nil
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) Get(context.Context, types.RepoState) (*specs.TasksCfg, error) {
+	return &specs.TasksCfg{
+		Tasks: p.taskSpecs,
+	}, nil
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) GetChangedFiles(context.Context, types.RepoState) ([]string, error) {
+	// The simulator replays historical Jobs, so it never needs to
+	// evaluate path filters.
+	return nil, nil
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) GetAddedTaskSpecsForRepoStates(_ context.Context, rss []types.RepoState) (map[types.RepoState]util.StringSet, error) {
+	// The TaskSpecs never change, so none are ever added.
+	rv := make(map[types.RepoState]util.StringSet, len(rss))
+	for _, rs := range rss {
+		rv[rs] = util.StringSet{}
+	}
+	return rv, nil
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) GetTaskSpec(_ context.Context, rs types.RepoState, name string) (*specs.TaskSpec, error) {
+	spec, ok := p.taskSpecs[name]
+	if !ok {
+		return nil, fmt.Errorf("No such task spec %q at %+v", name, rs)
+	}
+	return spec.Copy(), nil
+}
+
+// See documentation for taskCfgProvider interface.
+func (p *simTaskCfgProvider) MakeJob(context.Context, types.RepoState, string) (*types.Job, error) {
+	return nil, fmt.Errorf("The simulator does not create jobs.")
+}
+
+// simRepo reveals the commits of a repo to the simulated scheduler as time
+// passes.
+type simRepo struct {
+	finalBranches []*git.Branch
+	graph         *repograph.Graph
+	impl          *repograph.MemCacheRepoImpl
+}
+
+// headAt returns the most recent commit on the first-parent chain from the
+// given head which landed at or before the given time, or "" if none did.
+func (r *simRepo) headAt(head string, now time.Time) string {
+	for head != "" {
+		c, ok := r.impl.Commits[head]
+		if !ok {
+			return ""
+		}
+		if !c.Timestamp.After(now) {
+			return head
+		}
+		if len(c.Parents) == 0 {
+			return ""
+		}
+		head = c.Parents[0]
+	}
+	return ""
+}
+
+// update moves the branch heads to their state at the given time.
+func (r *simRepo) update(ctx context.Context, now time.Time) error {
+	branches := make([]*git.Branch, 0, len(r.finalBranches))
+	for _, b := range r.finalBranches {
+		if head := r.headAt(b.Head, now); head != "" {
+			branches = append(branches, &git.Branch{
+				Name: b.Name,
+				Head: head,
+			})
+		}
+	}
+	r.impl.BranchList = branches
+	if r.graph == nil {
+		g, err := repograph.NewWithRepoImpl(ctx, r.impl)
+		if err != nil {
+			return err
+		}
+		r.graph = g
+		return nil
+	}
+	return r.graph.Update(ctx)
+}
+
+// simRunningTask is a task which is running on a simulated bot.
+type simRunningTask struct {
+	bot    string
+	end    time.Time
+	id     string
+	start  time.Time
+	status types.TaskStatus
+}
+
+// Simulate replays the given snapshot through the task scheduling logic using
+// the given parameters and reports on the results.
+func Simulate(ctx context.Context, snapshot *SimulatorSnapshot, params *SimulatorParams) (*SimulatorResult, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if !snapshot.Start.Before(snapshot.End) {
+		return nil, fmt.Errorf("Snapshot start (%s) must be before end (%s).", snapshot.Start, snapshot.End)
+	}
+	now := snapshot.Start
+
+	// Set up the repos.
+	simRepos := make(map[string]*simRepo, len(snapshot.Repos))
+	repos := make(repograph.Map, len(snapshot.Repos))
+	for url, r := range snapshot.Repos {
+		commits := make(map[string]*vcsinfo.LongCommit, len(r.Commits))
+		for _, c := range r.Commits {
+			commits[c.Hash] = c
+		}
+		sr := &simRepo{
+			finalBranches: r.Branches,
+			impl:          repograph.NewMemCacheRepoImpl(commits, nil),
+		}
+		if err := sr.update(ctx, now); err != nil {
+			return nil, fmt.Errorf("Failed to load %s: %s", url, err)
+		}
+		simRepos[url] = sr
+		repos[url] = sr.graph
+	}
+
+	// Set up the DB, caches and scheduler.
+	d := memory.NewInMemoryDB()
+	w, err := window.New(params.Window, params.WindowCommits, repos)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.UpdateWithTime(now); err != nil {
+		return nil, err
+	}
+	initial := []*types.Task{}
+	for _, t := range snapshot.Tasks {
+		if t.Done() && t.Finished.Before(now) {
+			initial = append(initial, t.Copy())
+		}
+	}
+	if err := d.PutTasksInChunks(initial); err != nil {
+		return nil, err
+	}
+	tCache, err := cache.NewTaskCache(ctx, d, w, nil)
+	if err != nil {
+		return nil, err
+	}
+	jCache, err := cache.NewJobCache(ctx, d, w, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &TaskScheduler{
+		busyBots:         newBusyBots(),
+		candidateMetrics: map[string]metrics2.Int64Metric{},
+		db:               d,
+		jCache:           jCache,
+		newTasks:         map[types.RepoState]util.StringSet{},
+		pendingInsert:    map[string]bool{},
+		repos:            repos,
+		taskCfgCache:     &simTaskCfgProvider{taskSpecs: snapshot.TaskSpecs},
+		tCache:           tCache,
+		timeDecayAmt24Hr: params.TimeDecayAmt24Hr,
+		window:           w,
+	}
+
+	// Index the historical tasks to obtain durations and results.
+	historical := make(map[types.TaskKey]*types.Task, len(snapshot.Tasks))
+	for _, t := range snapshot.Tasks {
+		if t.Done() && !util.TimeIsZero(t.Started) && t.Finished.After(t.Started) {
+			historical[t.TaskKey] = t
+		}
+	}
+	simulateTask := func(c *taskCandidate) (time.Duration, types.TaskStatus) {
+		status := types.TASK_STATUS_SUCCESS
+		duration := params.DefaultTaskDuration
+		if prev, ok := historical[c.TaskKey]; ok {
+			status = prev.Status
+			duration = prev.Finished.Sub(prev.Started)
+		}
+		if override, ok := params.TaskDurations[c.Name]; ok {
+			duration = override
+		}
+		return duration, status
+	}
+
+	// Sort the Jobs by creation time.
+	jobs := make([]*types.Job, 0, len(snapshot.Jobs))
+	for _, j := range snapshot.Jobs {
+		if !j.Created.Before(snapshot.Start) && j.Created.Before(snapshot.End) {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+
+	// Sort the bot events by time.
+	bots := make(map[string]*types.Machine, len(snapshot.Bots))
+	for _, b := range snapshot.Bots {
+		bots[b.ID] = b
+	}
+	botEvents := make([]*SimulatorBotEvent, len(snapshot.BotEvents))
+	copy(botEvents, snapshot.BotEvents)
+	sort.SliceStable(botEvents, func(i, j int) bool {
+		return botEvents[i].Time.Before(botEvents[j].Time)
+	})
+
+	var (
+		availableTime   time.Duration
+		busyTime        time.Duration
+		blamelistLength = []float64{}
+		firstQueued     = map[types.TaskKey]time.Time{}
+		jobLatency      = []float64{}
+		pendingJobs     = map[string]time.Time{}
+		queue           []*taskCandidate
+		queueLatency    = []float64{}
+		running         = map[string]*simRunningTask{}
+		triggered       = 0
+	)
+	for nextJob, nextBotEvent := 0, 0; now.Before(snapshot.End); now = now.Add(params.Tick) {
+		// Update the bots.
+		for ; nextBotEvent < len(botEvents) && !botEvents[nextBotEvent].Time.After(now); nextBotEvent++ {
+			b := botEvents[nextBotEvent].Bot
+			bots[b.ID] = b
+		}
+
+		// Reveal new commits.
+		for url, r := range simRepos {
+			if err := r.update(ctx, now); err != nil {
+				return nil, fmt.Errorf("Failed to update %s: %s", url, err)
+			}
+		}
+		if err := w.UpdateWithTime(now); err != nil {
+			return nil, err
+		}
+
+		// Finish tasks.
+		if err := tCache.Update(); err != nil {
+			return nil, err
+		}
+		finished := []*types.Task{}
+		for bot, rt := range running {
+			if rt.end.After(now) {
+				continue
+			}
+			t, err := tCache.GetTask(rt.id)
+			if err != nil {
+				return nil, err
+			}
+			t.Status = rt.status
+			t.Finished = rt.end
+			t.IsolatedOutput = "simulated"
+			finished = append(finished, t)
+			busyTime += rt.end.Sub(rt.start)
+			delete(running, bot)
+		}
+		if err := s.putTasksInChunks(finished); err != nil {
+			return nil, err
+		}
+
+		// Add new Jobs.
+		newJobs := []*types.Job{}
+		for ; nextJob < len(jobs) && !jobs[nextJob].Created.After(now); nextJob++ {
+			j := jobs[nextJob].Copy()
+			j.Id = ""
+			j.DbModified = time.Time{}
+			j.Finished = time.Time{}
+			j.Status = types.JOB_STATUS_IN_PROGRESS
+			j.Tasks = nil
+			if prio, ok := params.JobPriorities[j.Name]; ok {
+				j.Priority = prio
+			}
+			newJobs = append(newJobs, j)
+		}
+		if err := s.putJobsInChunks(newJobs); err != nil {
+			return nil, err
+		}
+		for _, j := range newJobs {
+			pendingJobs[j.Id] = j.Created
+		}
+
+		// Update the Jobs and record those which finished.
+		if err := jCache.Update(); err != nil {
+			return nil, err
+		}
+		if err := s.updateUnfinishedJobs(ctx); err != nil {
+			return nil, err
+		}
+		if err := jCache.Update(); err != nil {
+			return nil, err
+		}
+		for id, created := range pendingJobs {
+			j, err := jCache.GetJobMaybeExpired(id)
+			if err != nil {
+				return nil, err
+			}
+			if j.Done() {
+				jobLatency = append(jobLatency, now.Sub(created).Seconds())
+				delete(pendingJobs, id)
+			}
+		}
+
+		// Regenerate the queue and match it to the free bots.
+		queue, _, err = s.regenerateTaskQueue(ctx, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range queue {
+			if _, ok := firstQueued[c.TaskKey]; !ok {
+				firstQueued[c.TaskKey] = now
+			}
+		}
+		freeBots := make([]*types.Machine, 0, len(bots))
+		for _, b := range bots {
+			if _, ok := running[b.ID]; !ok && !b.IsDead && !b.IsQuarantined {
+				freeBots = append(freeBots, b)
+			}
+		}
+		sort.Slice(freeBots, func(i, j int) bool {
+			return freeBots[i].ID < freeBots[j].ID
+		})
+		candidates, assignments := getCandidatesToSchedule(freeBots, queue)
+
+		// "Trigger" the tasks on the bots chosen by
+		// getCandidatesToSchedule.
+		insert := map[string]map[string][]*types.Task{}
+		for _, c := range candidates {
+			bot := assignments[c.TaskKey]
+			t := c.MakeTask()
+			if err := d.AssignId(t); err != nil {
+				return nil, err
+			}
+			t.Created = now
+			t.Started = now
+			t.Status = types.TASK_STATUS_RUNNING
+			t.SwarmingBotId = bot
+			t.SwarmingTaskId = "simulated-" + t.Id
+			duration, status := simulateTask(c)
+			running[bot] = &simRunningTask{
+				bot:    bot,
+				end:    now.Add(duration),
+				id:     t.Id,
+				start:  now,
+				status: status,
+			}
+			if _, ok := insert[t.Repo]; !ok {
+				insert[t.Repo] = map[string][]*types.Task{}
+			}
+			insert[t.Repo][t.Name] = append(insert[t.Repo][t.Name], t)
+
+			triggered++
+			queueLatency = append(queueLatency, now.Sub(firstQueued[c.TaskKey]).Seconds())
+			delete(firstQueued, c.TaskKey)
+			if !c.IsTryJob() {
+				blamelistLength = append(blamelistLength, float64(len(c.Commits)))
+			}
+		}
+		if err := s.addTasks(ctx, insert); err != nil {
+			return nil, err
+		}
+
+		// Bots which are running tasks may have become unavailable; they
+		// are still counted until their tasks finish.
+		tick := params.Tick
+		if remaining := snapshot.End.Sub(now); remaining < tick {
+			tick = remaining
+		}
+		availableTime += time.Duration(len(freeBots)-len(candidates)+len(running)) * tick
+	}
+
+	// Account for tasks which are still running.
+	for _, rt := range running {
+		end := rt.end
+		if end.After(snapshot.End) {
+			end = snapshot.End
+		}
+		busyTime += end.Sub(rt.start)
+	}
+	utilization := 0.0
+	if availableTime > 0 {
+		utilization = float64(busyTime) / float64(availableTime)
+	}
+	return &SimulatorResult{
+		Params:          params,
+		TasksTriggered:  triggered,
+		QueueLatency:    makeSimulatorStats(queueLatency),
+		JobLatency:      makeSimulatorStats(jobLatency),
+		BlamelistLength: makeSimulatorStats(blamelistLength),
+		BotUtilization:  utilization,
+		UnfinishedJobs:  len(pendingJobs),
+		QueueLength:     len(queue),
+	}, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+/*
+	Scheduling simulator for the Task Scheduler.
+
+	Replays historical commits, jobs, tasks and bots through the task
+	scheduling logic with one or more sets of parameters and reports queue
+	latency, blamelist lengths and bot utilization for each, so that changes
+	to priorities, time decay, etc. can be compared before they are deployed.
+
+	The historical data is read either from a JSON snapshot (--snapshot) or
+	from the task DB, git repos, task config cache and Swarming, in which case
+	the snapshot may be written out (--write_snapshot) for later runs.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+	"cloud.google.com/go/datastore"
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/auth"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
+	"go.skia.org/infra/task_scheduler/go/db/firestore"
+	"go.skia.org/infra/task_scheduler/go/scheduling"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/task_cfg_cache"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	// How far before the simulated period to look for bot events, in order
+	// to find the initial state of each bot.
+	botHistoryPeriod = 24 * time.Hour
+)
+
+// deadBotEvents are the Swarming bot event types after which a bot can't run
+// tasks until it reconnects.
+var deadBotEvents = map[string]bool{
+	"bot_missing":   true,
+	"bot_rebooting": true,
+	"bot_shutdown":  true,
+	"bot_terminate": true,
+}
+
+var (
+	// Input/output.
+	snapshotFile      = flag.String("snapshot", "", "JSON snapshot to replay. If not provided, the snapshot is loaded from the task DB.")
+	writeSnapshotFile = flag.String("write_snapshot", "", "If set, write the snapshot to this file.")
+	paramsFiles       = common.NewMultiStringFlag("params", nil, "JSON file containing SimulatorParams. May be repeated to compare several sets of parameters. Unset fields take their default values.")
+	outFile           = flag.String("out", "", "If set, write the results as JSON to this file.")
+
+	// Loading the snapshot from the task DB.
+	btInstance     = flag.String("bigtable_instance", "", "BigTable instance used by the task config cache.")
+	btProject      = flag.String("bigtable_project", "", "GCE project used for BigTable.")
+	end            = flag.String("end", "", "End of the time period to simulate, in RFC3339 format. Defaults to now.")
+	fsInstance     = flag.String("firestore_instance", "", "Firestore instance to use, eg. \"production\"")
+	local          = flag.Bool("local", true, "Whether we're running on a dev machine vs in production.")
+	pools          = common.NewMultiStringFlag("pool", nil, "Swarming pools whose bots are available in the simulation.")
+	repoUrls       = common.NewMultiStringFlag("repo", nil, "Repositories to simulate.")
+	start          = flag.String("start", "", "Start of the time period to simulate, in RFC3339 format. Defaults to 24 hours before --end.")
+	swarmingServer = flag.String("swarming_server", swarming.SWARMING_SERVER, "Which Swarming server to use.")
+	workdir        = flag.String("workdir", "workdir", "Working directory to use.")
+)
+
+// loadSnapshot loads a SimulatorSnapshot from the task DB, git repos, task
+// config cache and Swarming.
+func loadSnapshot(ctx context.Context) (*scheduling.SimulatorSnapshot, error) {
+	endTime := time.Now().UTC()
+	if *end != "" {
+		t, err := time.Parse(time.RFC3339, *end)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --end: %s", err)
+		}
+		endTime = t
+	}
+	startTime := endTime.Add(-24 * time.Hour)
+	if *start != "" {
+		t, err := time.Parse(time.RFC3339, *start)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --start: %s", err)
+		}
+		startTime = t
+	}
+	// Load history which precedes the simulated period so that the
+	// initial blamelists are realistic.
+	historyStart := startTime.Add(-scheduling.SIMULATOR_DEFAULT_WINDOW)
+
+	if *repoUrls == nil {
+		return nil, fmt.Errorf("--repo is required.")
+	}
+	wdAbs, err := filepath.Abs(*workdir)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := auth.NewDefaultTokenSource(*local, auth.SCOPE_USERINFO_EMAIL, datastore.ScopeDatastore, bigtable.Scope, swarming.AUTH_SCOPE)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits.
+	repos := make(repograph.Map, len(*repoUrls))
+	snapshotRepos := make(map[string]*scheduling.SimulatorRepo, len(*repoUrls))
+	for _, repoUrl := range *repoUrls {
+		sklog.Infof("Loading %s", repoUrl)
+		repo, err := repograph.NewLocalGraph(ctx, repoUrl, wdAbs)
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.Update(ctx); err != nil {
+			return nil, err
+		}
+		repos[repoUrl] = repo
+		all := repo.GetAll()
+		commits := make([]*vcsinfo.LongCommit, 0, len(all))
+		for _, c := range all {
+			if c.Timestamp.Before(historyStart) || c.Timestamp.After(endTime) {
+				continue
+			}
+			// Drop references to parents which are not in the
+			// snapshot.
+			lc := *c.LongCommit
+			lc.Parents = make([]string, 0, len(c.Parents))
+			for _, p := range c.Parents {
+				if pc := all[p]; pc != nil && !pc.Timestamp.Before(historyStart) {
+					lc.Parents = append(lc.Parents, p)
+				}
+			}
+			commits = append(commits, &lc)
+		}
+		sort.Slice(commits, func(i, j int) bool {
+			return commits[i].Timestamp.Before(commits[j].Timestamp)
+		})
+		snapshotRepos[repoUrl] = &scheduling.SimulatorRepo{
+			Branches: repo.BranchHeads(),
+			Commits:  commits,
+		}
+	}
+
+	// Jobs and tasks.
+	d, err := firestore.NewDBWithParams(ctx, firestore.FIRESTORE_PROJECT, *fsInstance, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(d)
+	jobs := []*types.Job{}
+	tasks := []*types.Task{}
+	for _, repoUrl := range *repoUrls {
+		j, err := d.GetJobsFromDateRange(startTime, endTime, repoUrl)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j...)
+		t, err := d.GetTasksFromDateRange(historyStart, endTime, repoUrl)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t...)
+	}
+	sklog.Infof("Loaded %d jobs and %d tasks.", len(jobs), len(tasks))
+
+	// TaskSpecs, as of the most recent RepoState of any Job.
+	tcc, err := task_cfg_cache.NewTaskCfgCache(ctx, repos, *btProject, *btInstance, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(tcc)
+	sort.Sort(types.JobSlice(jobs))
+	taskSpecs := map[string]*specs.TaskSpec{}
+	seen := map[types.RepoState]bool{}
+	for _, j := range jobs {
+		if seen[j.RepoState] {
+			continue
+		}
+		seen[j.RepoState] = true
+		cfg, err := tcc.Get(ctx, j.RepoState)
+		if err != nil {
+			sklog.Warningf("Failed to obtain tasks cfg for %+v: %s", j.RepoState, err)
+			continue
+		}
+		for name, spec := range cfg.Tasks {
+			taskSpecs[name] = spec
+		}
+	}
+
+	// Bots.
+	swarm, err := swarming.NewApiClient(httputils.DefaultClientConfig().WithTokenSource(ts).With2xxOnly().Client(), *swarmingServer)
+	if err != nil {
+		return nil, err
+	}
+	bots := []*types.Machine{}
+	botEvents := []*scheduling.SimulatorBotEvent{}
+	for _, pool := range *pools {
+		b, err := swarm.ListBotsForPool(pool)
+		if err != nil {
+			return nil, err
+		}
+		for _, bot := range b {
+			current := &types.Machine{
+				ID:            bot.BotId,
+				Dimensions:    swarming.BotDimensionsToStringSlice(bot.Dimensions),
+				IsDead:        bot.IsDead,
+				IsQuarantined: bot.Quarantined,
+			}
+			events, err := swarm.ListBotEvents(bot.BotId, startTime.Add(-botHistoryPeriod), endTime)
+			if err != nil {
+				return nil, err
+			}
+			initial, changes, err := botHistory(current, events, startTime)
+			if err != nil {
+				return nil, err
+			}
+			bots = append(bots, initial)
+			botEvents = append(botEvents, changes...)
+		}
+	}
+	sklog.Infof("Loaded %d bots with %d changes.", len(bots), len(botEvents))
+
+	return &scheduling.SimulatorSnapshot{
+		Start:     startTime,
+		End:       endTime,
+		Repos:     snapshotRepos,
+		TaskSpecs: taskSpecs,
+		Jobs:      jobs,
+		Tasks:     tasks,
+		Bots:      bots,
+		BotEvents: botEvents,
+	}, nil
+}
+
+// botHistory returns the state of a bot at the given start time and the
+// changes to its state afterward, given its current state and its Swarming
+// events, most recent first. The initial state is that after the last event
+// before start, or after the first event if there are none before start, or
+// the current state if there are no events at all.
+func botHistory(current *types.Machine, events []*swarming_api.SwarmingRpcsBotEvent, start time.Time) (*types.Machine, []*scheduling.SimulatorBotEvent, error) {
+	var initial, prev *types.Machine
+	changes := []*scheduling.SimulatorBotEvent{}
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		ts, err := swarming.ParseTimestamp(ev.Ts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid timestamp for event of bot %s: %s", current.ID, err)
+		}
+		m := &types.Machine{
+			ID:            current.ID,
+			Dimensions:    swarming.BotDimensionsToStringSlice(ev.Dimensions),
+			IsDead:        deadBotEvents[ev.EventType],
+			IsQuarantined: ev.Quarantined || ev.MaintenanceMsg != "",
+		}
+		if len(m.Dimensions) == 0 {
+			m.Dimensions = current.Dimensions
+		}
+		if initial == nil || !ts.After(start) {
+			initial = m
+		} else if prev.IsDead != m.IsDead || prev.IsQuarantined != m.IsQuarantined || !util.SSliceEqual(prev.Dimensions, m.Dimensions) {
+			changes = append(changes, &scheduling.SimulatorBotEvent{
+				Time: ts,
+				Bot:  m,
+			})
+		}
+		prev = m
+	}
+	if initial == nil {
+		initial = current
+	}
+	return initial, changes, nil
+}
+
+// readJSON decodes the given JSON file into dst.
+func readJSON(file string, dst interface{}) error {
+	return util.WithReadFile(file, func(f io.Reader) error {
+		return json.NewDecoder(f).Decode(dst)
+	})
+}
+
+// writeJSON encodes src as JSON into the given file.
+func writeJSON(file string, src interface{}) error {
+	return util.WithWriteFile(file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(src)
+	})
+}
+
+// printResults writes a table comparing the given results.
+func printResults(w io.Writer, results []*scheduling.SimulatorResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Params\tTasks\tQueue latency p50/p90/max (min)\tJob latency p50/p90/max (min)\tBlamelist mean/p90/max\tBot utilization\tUnfinished jobs\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f/%.1f/%.1f\t%.1f/%.1f/%.1f\t%.1f/%.0f/%.0f\t%.1f%%\t%d\t\n",
+			r.Params.Name,
+			r.TasksTriggered,
+			r.QueueLatency.P50/60, r.QueueLatency.P90/60, r.QueueLatency.Max/60,
+			r.JobLatency.P50/60, r.JobLatency.P90/60, r.JobLatency.Max/60,
+			r.BlamelistLength.Mean, r.BlamelistLength.P90, r.BlamelistLength.Max,
+			100*r.BotUtilization,
+			r.UnfinishedJobs)
+	}
+	return tw.Flush()
+}
+
+func main() {
+	common.Init()
+	ctx := context.Background()
+
+	// Load the snapshot.
+	var snapshot *scheduling.SimulatorSnapshot
+	if *snapshotFile != "" {
+		snapshot = new(scheduling.SimulatorSnapshot)
+		if err := readJSON(*snapshotFile, snapshot); err != nil {
+			sklog.Fatalf("Failed to read snapshot: %s", err)
+		}
+	} else {
+		var err error
+		snapshot, err = loadSnapshot(ctx)
+		if err != nil {
+			sklog.Fatalf("Failed to load snapshot: %s", err)
+		}
+	}
+	if *writeSnapshotFile != "" {
+		if err := writeJSON(*writeSnapshotFile, snapshot); err != nil {
+			sklog.Fatalf("Failed to write snapshot: %s", err)
+		}
+	}
+
+	// Load the parameters.
+	params := []*scheduling.SimulatorParams{}
+	if *paramsFiles == nil {
+		params = append(params, scheduling.DefaultSimulatorParams())
+	}
+	for _, f := range *paramsFiles {
+		p := scheduling.DefaultSimulatorParams()
+		p.Name = filepath.Base(f)
+		if err := readJSON(f, p); err != nil {
+			sklog.Fatalf("Failed to read %s: %s", f, err)
+		}
+		params = append(params, p)
+	}
+
+	// Run the simulations.
+	results := make([]*scheduling.SimulatorResult, 0, len(params))
+	for _, p := range params {
+		sklog.Infof("Simulating %s to %s with params %q", snapshot.Start, snapshot.End, p.Name)
+		res, err := scheduling.Simulate(ctx, snapshot, p)
+		if err != nil {
+			sklog.Fatalf("Simulation %q failed: %s", p.Name, err)
+		}
+		results = append(results, res)
+	}
+	if err := printResults(os.Stdout, results); err != nil {
+		sklog.Fatal(err)
+	}
+	if *outFile != "" {
+		if err := writeJSON(*outFile, results); err != nil {
+			sklog.Fatalf("Failed to write results: %s", err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package scheduling
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/git"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/go/vcsinfo"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+// makeSimulatorSnapshot returns a snapshot of a linear repo with one commit
+// every ten minutes, each of which has a Job with a single task.
+func makeSimulatorSnapshot(numCommits int) *SimulatorSnapshot {
+	const repo = "fake.git"
+	start := time.Unix(1572000000, 0).UTC()
+	commits := make([]*vcsinfo.LongCommit, 0, numCommits)
+	jobs := make([]*types.Job, 0, numCommits)
+	parent := ""
+	for i := 0; i < numCommits; i++ {
+		hash := fmt.Sprintf("%040d", i+1)
+		c := &vcsinfo.LongCommit{
+			ShortCommit: &vcsinfo.ShortCommit{
+				Hash:    hash,
+				Author:  "me@google.com",
+				Subject: fmt.Sprintf("Commit %d", i),
+			},
+			Timestamp: start.Add(time.Duration(i) * 10 * time.Minute),
+		}
+		if parent != "" {
+			c.Parents = []string{parent}
+		}
+		commits = append(commits, c)
+		jobs = append(jobs, &types.Job{
+			Created:      c.Timestamp,
+			Dependencies: map[string][]string{"Build": {}},
+			Name:         "Build",
+			Priority:     0.5,
+			RepoState: types.RepoState{
+				Repo:     repo,
+				Revision: hash,
+			},
+		})
+		parent = hash
+	}
+	return &SimulatorSnapshot{
+		Start: start,
+		End:   start.Add(time.Duration(numCommits) * 10 * time.Minute),
+		Repos: map[string]*SimulatorRepo{
+			repo: {
+				Branches: []*git.Branch{{Name: "master", Head: parent}},
+				Commits:  commits,
+			},
+		},
+		TaskSpecs: map[string]*specs.TaskSpec{
+			"Build": {
+				Dimensions: []string{"pool:Skia", "os:Linux"},
+				Isolate:    "build.isolate",
+			},
+		},
+		Jobs: jobs,
+		Bots: []*types.Machine{
+			{ID: "bot1", Dimensions: []string{"pool:Skia", "os:Linux"}},
+			{ID: "bot2", Dimensions: []string{"pool:Skia", "os:Mac"}},
+		},
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	unittest.MediumTest(t)
+
+	snapshot := makeSimulatorSnapshot(12)
+
+	// Tasks are faster than commits, so every commit gets its own task.
+	params := DefaultSimulatorParams()
+	params.DefaultTaskDuration = 5 * time.Minute
+	res, err := Simulate(context.Background(), snapshot, params)
+	require.NoError(t, err)
+	assert.Equal(t, 12, res.TasksTriggered)
+	assert.Equal(t, 12, res.BlamelistLength.Count)
+	assert.Equal(t, 1.0, res.BlamelistLength.Max)
+	assert.Equal(t, 0.0, res.QueueLatency.Max)
+	assert.Equal(t, 12, res.JobLatency.Count)
+	assert.Equal(t, 0, res.UnfinishedJobs)
+	// Only one of the two bots can run the task, and it is busy half of
+	// the time.
+	assert.InDelta(t, 0.25, res.BotUtilization, 0.001)
+
+	// Tasks are slower than commits, so blamelists get longer and not
+	// every commit is tested.
+	params.DefaultTaskDuration = 25 * time.Minute
+	res, err = Simulate(context.Background(), snapshot, params)
+	require.NoError(t, err)
+	assert.True(t, res.TasksTriggered < 12)
+	assert.True(t, res.BlamelistLength.Max > 1)
+	assert.True(t, res.UnfinishedJobs > 0)
+	assert.InDelta(t, 0.5, res.BotUtilization, 0.001)
+}
+
+func TestSimulateBotEvents(t *testing.T) {
+	unittest.MediumTest(t)
+
+	// The only bot which can run the task is quarantined for the first
+	// hour, and the Mac bot dies after the first hour.
+	snapshot := makeSimulatorSnapshot(12)
+	snapshot.Bots[0].IsQuarantined = true
+	snapshot.BotEvents = []*SimulatorBotEvent{
+		{
+			Time: snapshot.Start.Add(time.Hour),
+			Bot:  &types.Machine{ID: "bot2", Dimensions: []string{"pool:Skia", "os:Mac"}, IsDead: true},
+		},
+		{
+			Time: snapshot.Start.Add(time.Hour),
+			Bot:  &types.Machine{ID: "bot1", Dimensions: []string{"pool:Skia", "os:Linux"}},
+		},
+	}
+	params := DefaultSimulatorParams()
+	params.DefaultTaskDuration = 5 * time.Minute
+	res, err := Simulate(context.Background(), snapshot, params)
+	require.NoError(t, err)
+	// Nothing runs during the first hour, so the first task covers the
+	// commits which landed in the meantime, and the tasks which bisect it
+	// wait even longer.
+	assert.True(t, res.QueueLatency.Max >= time.Hour.Seconds())
+	assert.Equal(t, 7.0, res.BlamelistLength.Max)
+	// Each of the bots is available for one hour.
+	busy := float64(res.TasksTriggered) * float64(params.DefaultTaskDuration)
+	assert.InDelta(t, busy/float64(2*time.Hour), res.BotUtilization, 0.001)
+}
+
+func TestSimulatorParamsValidate(t *testing.T) {
+	unittest.SmallTest(t)
+
+	p := DefaultSimulatorParams()
+	require.NoError(t, p.Validate())
+	p.TimeDecayAmt24Hr = 1.5
+	require.EqualError(t, p.Validate(), "TimeDecayAmt24Hr must be in [0, 1].")
+	p = DefaultSimulatorParams()
+	p.JobPriorities = map[string]float64{"Build": 0}
+	require.EqualError(t, p.Validate(), "Priority for job \"Build\" must be in (0, 1].")
+}
+
+func TestMakeSimulatorStats(t *testing.T) {
+	unittest.SmallTest(t)
+
+	assert.Equal(t, &SimulatorStats{}, makeSimulatorStats(nil))
+	vals := make([]float64, 0, 100)
+	for i := 100; i > 0; i-- {
+		vals = append(vals, float64(i))
+	}
+	assert.Equal(t, &SimulatorStats{
+		Count: 100,
+		Mean:  50.5,
+		P50:   50,
+		P90:   90,
+		P99:   99,
+		Max:   100,
+	}, makeSimulatorStats(vals))
+}
@@ -2,16 +2,16 @@ package scheduling
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
-	"go.skia.org/infra/go/common"
-	"go.skia.org/infra/go/isolate"
 	"go.skia.org/infra/go/swarming"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/db/cache"
@@ -33,6 +33,7 @@ type taskCandidate struct {
 	Jobs           []*types.Job `json:"jobs"`
 	ParentTaskIds  []string     `json:"parentTaskIds"`
 	RetryOf        string       `json:"retryOf"`
+	ReuseKey       string       `json:"reuseKey"`
 	Score          float64      `json:"score"`
 	StealingFromId string       `json:"stealingFromId"`
 	types.TaskKey
@@ -54,6 +55,7 @@ func (c *taskCandidate) CopyNoDiagnostics() *taskCandidate {
 		Jobs:               jobs,
 		ParentTaskIds:      util.CopyStringSlice(c.ParentTaskIds),
 		RetryOf:            c.RetryOf,
+		ReuseKey:           c.ReuseKey,
 		Score:              c.Score,
 		StealingFromId:     c.StealingFromId,
 		TaskKey:            c.TaskKey.Copy(),
@@ -151,6 +153,7 @@ func (c *taskCandidate) MakeTask() *types.Task {
 		MaxAttempts:   maxAttempts,
 		ParentTaskIds: parentTaskIds,
 		RetryOf:       c.RetryOf,
+		ReuseKey:      c.ReuseKey,
 		TaskKey:       c.TaskKey.Copy(),
 	}
 }
@@ -163,6 +166,21 @@ func getPatchStorage(server string) string {
 	return "gerrit"
 }
 
+// downstreamJob returns the Job which was triggered by another Job and for
+// which this candidate would run, if any. Downstream Jobs have their own Tasks
+// (see types.Job.MakeTaskKey), so there is at most one.
+func (c *taskCandidate) downstreamJob() *types.Job {
+	if !c.IsForceRun() {
+		return nil
+	}
+	for _, j := range c.Jobs {
+		if j.Id == c.ForcedJobId && j.IsDownstream() {
+			return j
+		}
+	}
+	return nil
+}
+
 // replaceVars replaces variable names with their values in a given string.
 func replaceVars(c *taskCandidate, s, taskId string) string {
 	issueShort := ""
@@ -179,6 +197,14 @@ func replaceVars(c *taskCandidate, s, taskId string) string {
 	if patchsetInt == "" {
 		patchsetInt = "0"
 	}
+	upstreamJobId := ""
+	upstreamRepo := ""
+	upstreamRevision := ""
+	if j := c.downstreamJob(); j != nil {
+		upstreamJobId = j.UpstreamJobId
+		upstreamRepo = j.UpstreamRepo
+		upstreamRevision = j.UpstreamRevision
+	}
 	replacements := map[string]string{
 		specs.VARIABLE_BUILDBUCKET_BUILD_ID: strconv.FormatInt(c.BuildbucketBuildId, 10),
 		specs.VARIABLE_CODEREVIEW_SERVER:    c.Server,
@@ -194,6 +220,9 @@ func replaceVars(c *taskCandidate, s, taskId string) string {
 		specs.VARIABLE_REVISION:             c.Revision,
 		specs.VARIABLE_TASK_ID:              taskId,
 		specs.VARIABLE_TASK_NAME:            c.Name,
+		specs.VARIABLE_UPSTREAM_JOB_ID:      upstreamJobId,
+		specs.VARIABLE_UPSTREAM_REPO:        upstreamRepo,
+		specs.VARIABLE_UPSTREAM_REVISION:    upstreamRevision,
 	}
 	for k, v := range replacements {
 		s = strings.Replace(s, fmt.Sprintf(specs.VARIABLE_SYNTAX, k), v, -1)
@@ -201,65 +230,34 @@ func replaceVars(c *taskCandidate, s, taskId string) string {
 	return s
 }
 
-// MakeTaskRequest creates a SwarmingRpcsNewTaskRequest object from the taskCandidate.
-func (c *taskCandidate) MakeTaskRequest(id, isolateServer, pubSubTopic string) (*swarming_api.SwarmingRpcsNewTaskRequest, error) {
-	var caches []*swarming_api.SwarmingRpcsCacheEntry
+// MakeTaskRequest creates a TaskRequest object from the taskCandidate.
+func (c *taskCandidate) MakeTaskRequest(id string) (*types.TaskRequest, error) {
+	var caches []*types.CacheRequest
 	if len(c.TaskSpec.Caches) > 0 {
-		caches = make([]*swarming_api.SwarmingRpcsCacheEntry, 0, len(c.TaskSpec.Caches))
+		caches = make([]*types.CacheRequest, 0, len(c.TaskSpec.Caches))
 		for _, cache := range c.TaskSpec.Caches {
-			caches = append(caches, &swarming_api.SwarmingRpcsCacheEntry{
+			caches = append(caches, &types.CacheRequest{
 				Name: cache.Name,
 				Path: cache.Path,
 			})
 		}
 	}
-	var cipdInput *swarming_api.SwarmingRpcsCipdInput
+	var cipdPackages []*types.CipdPackage
 	if len(c.TaskSpec.CipdPackages) > 0 {
-		cipdInput = &swarming_api.SwarmingRpcsCipdInput{
-			Packages: make([]*swarming_api.SwarmingRpcsCipdPackage, 0, len(c.TaskSpec.CipdPackages)),
-		}
+		cipdPackages = make([]*types.CipdPackage, 0, len(c.TaskSpec.CipdPackages))
 		for _, p := range c.TaskSpec.CipdPackages {
-			cipdInput.Packages = append(cipdInput.Packages, &swarming_api.SwarmingRpcsCipdPackage{
-				PackageName: p.Name,
-				Path:        p.Path,
-				Version:     p.Version,
+			cipdPackages = append(cipdPackages, &types.CipdPackage{
+				Name:    p.Name,
+				Path:    p.Path,
+				Version: p.Version,
 			})
 		}
 	}
 
-	dims := make([]*swarming_api.SwarmingRpcsStringPair, 0, len(c.TaskSpec.Dimensions))
 	dimsMap := make(map[string]string, len(c.TaskSpec.Dimensions))
 	for _, d := range c.TaskSpec.Dimensions {
 		split := strings.SplitN(d, ":", 2)
-		key := split[0]
-		val := split[1]
-		dims = append(dims, &swarming_api.SwarmingRpcsStringPair{
-			Key:   key,
-			Value: val,
-		})
-		dimsMap[key] = val
-	}
-
-	var env []*swarming_api.SwarmingRpcsStringPair
-	if len(c.TaskSpec.Environment) > 0 {
-		env = make([]*swarming_api.SwarmingRpcsStringPair, 0, len(c.TaskSpec.Environment))
-		for k, v := range c.TaskSpec.Environment {
-			env = append(env, &swarming_api.SwarmingRpcsStringPair{
-				Key:   k,
-				Value: v,
-			})
-		}
-	}
-
-	var envPrefixes []*swarming_api.SwarmingRpcsStringListPair
-	if len(c.TaskSpec.EnvPrefixes) > 0 {
-		envPrefixes = make([]*swarming_api.SwarmingRpcsStringListPair, 0, len(c.TaskSpec.EnvPrefixes))
-		for k, v := range c.TaskSpec.EnvPrefixes {
-			envPrefixes = append(envPrefixes, &swarming_api.SwarmingRpcsStringListPair{
-				Key:   k,
-				Value: util.CopyStringSlice(v),
-			})
-		}
+		dimsMap[split[0]] = split[1]
 	}
 
 	cmd := make([]string, 0, len(c.TaskSpec.Command))
@@ -277,17 +275,17 @@ func (c *taskCandidate) MakeTaskRequest(id, isolateServer, pubSubTopic string) (
 		extraTags[k] = replaceVars(c, v, id)
 	}
 
-	expirationSecs := int64(c.TaskSpec.Expiration.Seconds())
-	if expirationSecs == int64(0) {
-		expirationSecs = int64(swarming.RECOMMENDED_EXPIRATION.Seconds())
+	expiration := c.TaskSpec.Expiration
+	if expiration == 0 {
+		expiration = swarming.RECOMMENDED_EXPIRATION
 	}
-	executionTimeoutSecs := int64(c.TaskSpec.ExecutionTimeout.Seconds())
-	if executionTimeoutSecs == int64(0) {
-		executionTimeoutSecs = int64(swarming.RECOMMENDED_HARD_TIMEOUT.Seconds())
+	executionTimeout := c.TaskSpec.ExecutionTimeout
+	if executionTimeout == 0 {
+		executionTimeout = swarming.RECOMMENDED_HARD_TIMEOUT
 	}
-	ioTimeoutSecs := int64(c.TaskSpec.IoTimeout.Seconds())
-	if ioTimeoutSecs == int64(0) {
-		ioTimeoutSecs = int64(swarming.RECOMMENDED_IO_TIMEOUT.Seconds())
+	ioTimeout := c.TaskSpec.IoTimeout
+	if ioTimeout == 0 {
+		ioTimeout = swarming.RECOMMENDED_IO_TIMEOUT
 	}
 	outputs := util.CopyStringSlice(c.TaskSpec.Outputs)
 	idempotent := c.TaskSpec.Idempotent
@@ -295,36 +293,103 @@ func (c *taskCandidate) MakeTaskRequest(id, isolateServer, pubSubTopic string) (
 		// Don't allow deduplication for forced jobs.
 		idempotent = false
 	}
-	return &swarming_api.SwarmingRpcsNewTaskRequest{
-		ExpirationSecs: expirationSecs,
-		Name:           c.Name,
-		Priority:       swarming.RECOMMENDED_PRIORITY,
-		Properties: &swarming_api.SwarmingRpcsTaskProperties{
-			Caches:               caches,
-			CipdInput:            cipdInput,
-			Command:              cmd,
-			Dimensions:           dims,
-			Env:                  env,
-			EnvPrefixes:          envPrefixes,
-			ExecutionTimeoutSecs: executionTimeoutSecs,
-			ExtraArgs:            extraArgs,
-			Idempotent:           idempotent,
-			InputsRef: &swarming_api.SwarmingRpcsFilesRef{
-				Isolated:       c.IsolatedInput,
-				Isolatedserver: isolateServer,
-				Namespace:      isolate.DEFAULT_NAMESPACE,
-			},
-			IoTimeoutSecs: ioTimeoutSecs,
-			Outputs:       outputs,
-		},
-		PubsubTopic:    fmt.Sprintf(swarming.PUBSUB_FULLY_QUALIFIED_TOPIC_TMPL, common.PROJECT_ID, pubSubTopic),
-		PubsubUserdata: id,
-		ServiceAccount: c.TaskSpec.ServiceAccount,
-		Tags:           types.TagsForTask(c.Name, id, c.Attempt, c.RepoState, c.RetryOf, dimsMap, c.ForcedJobId, c.ParentTaskIds, extraTags),
-		User:           "skiabot@google.com",
+	var envPrefixes map[string][]string
+	if len(c.TaskSpec.EnvPrefixes) > 0 {
+		envPrefixes = make(map[string][]string, len(c.TaskSpec.EnvPrefixes))
+		for k, v := range c.TaskSpec.EnvPrefixes {
+			envPrefixes[k] = util.CopyStringSlice(v)
+		}
+	}
+	return &types.TaskRequest{
+		Caches:              caches,
+		CipdPackages:        cipdPackages,
+		Command:             cmd,
+		Dimensions:          util.CopyStringSlice(c.TaskSpec.Dimensions),
+		Env:                 util.CopyStringMap(c.TaskSpec.Environment),
+		EnvPrefixes:         envPrefixes,
+		ExecutionTimeout:    executionTimeout,
+		Expiration:          expiration,
+		ExtraArgs:           extraArgs,
+		Idempotent:          idempotent,
+		IoTimeout:           ioTimeout,
+		Isolated:            c.IsolatedInput,
+		Name:                c.Name,
+		Outputs:             outputs,
+		ServiceAccount:      c.TaskSpec.ServiceAccount,
+		Tags:                types.TagsForTask(c.Name, id, c.Attempt, c.RepoState, c.RetryOf, dimsMap, c.ForcedJobId, c.ParentTaskIds, extraTags),
+		TaskSchedulerTaskID: id,
 	}, nil
 }
 
+// reuseKeyInputs contains the inputs of a task which determine its result.
+type reuseKeyInputs struct {
+	Repo             string                `json:"repo"`
+	Name             string                `json:"name"`
+	Caches           []*types.CacheRequest `json:"caches"`
+	CipdPackages     []*types.CipdPackage  `json:"cipdPackages"`
+	Command          []string              `json:"command"`
+	Dimensions       []string              `json:"dimensions"`
+	Env              map[string]string     `json:"env"`
+	EnvPrefixes      map[string][]string   `json:"envPrefixes"`
+	ExecutionTimeout time.Duration         `json:"executionTimeout"`
+	ExtraArgs        []string              `json:"extraArgs"`
+	IoTimeout        time.Duration         `json:"ioTimeout"`
+	Isolated         string                `json:"isolated"`
+	Outputs          []string              `json:"outputs"`
+	ServiceAccount   string                `json:"serviceAccount"`
+}
+
+// mayReuse returns true if the task may reuse the result of another task, ie.
+// its TaskSpec is idempotent, it is not forced, and its command does not
+// depend on its own ID.
+func (c *taskCandidate) mayReuse() bool {
+	if !c.TaskSpec.Idempotent || c.IsForceRun() {
+		return false
+	}
+	taskIdVar := fmt.Sprintf(specs.VARIABLE_SYNTAX, specs.VARIABLE_TASK_ID)
+	for _, arg := range append(util.CopyStringSlice(c.TaskSpec.Command), c.TaskSpec.ExtraArgs...) {
+		if strings.Contains(arg, taskIdVar) {
+			return false
+		}
+	}
+	return true
+}
+
+// MakeReuseKey returns a key which identifies the inputs of the task, ie. the
+// given digest of its isolated inputs along with every part of its
+// TaskRequest which may affect its result. Tasks with the same key are
+// expected to produce the same result. Returns the empty string if the task
+// may not reuse the result of another task or if the digest is empty.
+func (c *taskCandidate) MakeReuseKey(isolatedDigest string) (string, error) {
+	if isolatedDigest == "" || !c.mayReuse() {
+		return "", nil
+	}
+	req, err := c.MakeTaskRequest("")
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(&reuseKeyInputs{
+		Repo:             c.Repo,
+		Name:             c.Name,
+		Caches:           req.Caches,
+		CipdPackages:     req.CipdPackages,
+		Command:          req.Command,
+		Dimensions:       req.Dimensions,
+		Env:              req.Env,
+		EnvPrefixes:      req.EnvPrefixes,
+		ExecutionTimeout: req.ExecutionTimeout,
+		ExtraArgs:        req.ExtraArgs,
+		IoTimeout:        req.IoTimeout,
+		Isolated:         isolatedDigest,
+		Outputs:          req.Outputs,
+		ServiceAccount:   req.ServiceAccount,
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
 // allDepsMet determines whether all dependencies for the given task candidate
 // have been satisfied, and if so, returns a map of whose keys are task IDs and
 // values are their isolated outputs.
@@ -405,6 +470,8 @@ type taskCandidateFilteringDiagnostics struct {
 	SupersededByTask string `json:"supersededByTask,omitempty"`
 	// TaskIds of previous attempts; set when max attempts have been reached.
 	PreviousAttempts []string `json:"previousAttempts,omitempty"`
+	// True if this task's TaskSpec is quarantined and a previous attempt failed.
+	Quarantined bool `json:"quarantined,omitempty"`
 	// Names of TaskSpec dependencies that have not completed.
 	UnmetDependencies []string `json:"unmetDependencies,omitempty"`
 }
@@ -426,6 +493,9 @@ type taskCandidateScoringDiagnostics struct {
 	TestednessIncrease float64 `json:"testednessIncrease,omitempty"`
 	// Multiplier to prioritize newer commits. Not set for forced or try jobs.
 	TimeDecay float64 `json:"timeDecay,omitempty"`
+	// Multiplier to enforce the FairnessConfig. Not set if the candidate's pool is not subject to
+	// fairness.
+	FairnessMultiplier float64 `json:"fairnessMultiplier,omitempty"`
 }
 
 // taskCandidateSchedulingDiagnostics contains information about matching tasks with bots.
@@ -466,6 +536,9 @@ type taskCandidateTriggeringDiagnostics struct {
 	IsolateError string `json:"isolateError,omitempty"`
 	// Error message from triggering the task.
 	TriggerError string `json:"triggerError,omitempty"`
+	// ID of the earlier task with identical inputs whose result was reused instead of triggering a
+	// new task, if any.
+	ReusedTaskId string `json:"reusedTaskId,omitempty"`
 	// Task Scheduler ID of the triggered task. If an error occurs after assigning an ID, the Task may
 	// not exist in the Task Scheduler DB.
 	TaskId string `json:"taskId,omitempty"`
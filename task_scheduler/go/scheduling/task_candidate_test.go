@@ -116,6 +116,60 @@ func TestReplaceVar(t *testing.T) {
 	require.Equal(t, "refs/changes/45/12345/3", replaceVars(c, "<(PATCH_REF)", dummyId))
 }
 
+func TestMakeReuseKey(t *testing.T) {
+	unittest.SmallTest(t)
+	makeCandidate := func(revision string) *taskCandidate {
+		c := makeTaskCandidate("Test", []string{"pool:Skia", "os:Linux"})
+		c.Repo = "my-repo"
+		c.Revision = revision
+		c.TaskSpec.Idempotent = true
+		c.TaskSpec.Command = []string{"run", "--name", "<(TASK_NAME)"}
+		return c
+	}
+	reuseKey := func(c *taskCandidate) string {
+		key, err := c.MakeReuseKey("isolated-digest")
+		require.NoError(t, err)
+		return key
+	}
+
+	// Identical inputs at different commits have the same key.
+	c1 := makeCandidate("abc123")
+	c2 := makeCandidate("def456")
+	key := reuseKey(c1)
+	require.NotEqual(t, "", key)
+	require.Equal(t, key, reuseKey(c2))
+
+	// The key changes with the inputs.
+	otherKey, err := c2.MakeReuseKey("other-digest")
+	require.NoError(t, err)
+	require.NotEqual(t, key, otherKey)
+	c2 = makeCandidate("def456")
+	c2.TaskSpec.Dimensions = []string{"pool:Skia", "os:Mac"}
+	require.NotEqual(t, key, reuseKey(c2))
+	c2 = makeCandidate("def456")
+	c2.TaskSpec.Environment = map[string]string{"K": "V"}
+	require.NotEqual(t, key, reuseKey(c2))
+	c2 = makeCandidate("def456")
+	c2.TaskSpec.Command = []string{"run", "--revision", "<(REVISION)"}
+	c1.TaskSpec.Command = c2.TaskSpec.Command
+	require.NotEqual(t, reuseKey(c1), reuseKey(c2))
+
+	// Tasks which aren't eligible have no key.
+	c1 = makeCandidate("abc123")
+	c1.TaskSpec.Idempotent = false
+	require.Equal(t, "", reuseKey(c1))
+	c1 = makeCandidate("abc123")
+	c1.ForcedJobId = "forced"
+	require.Equal(t, "", reuseKey(c1))
+	c1 = makeCandidate("abc123")
+	emptyKey, err := c1.MakeReuseKey("")
+	require.NoError(t, err)
+	require.Equal(t, "", emptyKey)
+	c1 = makeCandidate("abc123")
+	c1.TaskSpec.ExtraArgs = []string{"--id", "<(TASK_ID)"}
+	require.Equal(t, "", reuseKey(c1))
+}
+
 func TestTaskCandidateJobs(t *testing.T) {
 	unittest.SmallTest(t)
 
@@ -2,6 +2,7 @@ package scheduling
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,7 +17,6 @@ import (
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
-	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
 	"go.chromium.org/luci/common/isolated"
 	"go.skia.org/infra/go/cleanup"
 	"go.skia.org/infra/go/common"
@@ -33,9 +33,12 @@ import (
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/blacklist"
 	"go.skia.org/infra/task_scheduler/go/cacher"
+	"go.skia.org/infra/task_scheduler/go/cron_triggers"
 	"go.skia.org/infra/task_scheduler/go/db"
 	"go.skia.org/infra/task_scheduler/go/db/cache"
+	"go.skia.org/infra/task_scheduler/go/flakes"
 	"go.skia.org/infra/task_scheduler/go/isolate_cache"
+	"go.skia.org/infra/task_scheduler/go/quarantine"
 	"go.skia.org/infra/task_scheduler/go/specs"
 	"go.skia.org/infra/task_scheduler/go/syncer"
 	"go.skia.org/infra/task_scheduler/go/task_cfg_cache"
@@ -75,6 +78,9 @@ const (
 	// Measurement name for task candidate counts by dimension set.
 	MEASUREMENT_TASK_CANDIDATE_COUNT = "task_candidate_count"
 
+	// Measurement name for TaskSpec flake rates.
+	MEASUREMENT_FLAKE_RATE = "task_flake_rate"
+
 	NUM_TOP_CANDIDATES = 50
 
 	// To avoid errors resulting from DB transaction size limits, we
@@ -86,6 +92,22 @@ const (
 
 	GCS_MAIN_LOOP_DIAGNOSTICS_DIR = "MainLoop"
 	GCS_DIAGNOSTICS_WRITE_TIMEOUT = 60 * time.Second
+
+	// TaskSpecs which have at least FLAKE_RATE_MIN_TASKS finished tasks
+	// within FLAKE_RATE_WINDOW, of which at least FLAKE_RATE_THRESHOLD are
+	// flaky, are considered suspected flakes and receive
+	// FLAKE_EXTRA_ATTEMPTS more attempts than their MaxAttempts. TaskSpecs
+	// which explicitly set MaxAttempts to 1 have opted out of retries and
+	// never receive extra attempts.
+	FLAKE_RATE_WINDOW    = 24 * time.Hour
+	FLAKE_RATE_MIN_TASKS = 10
+	FLAKE_RATE_THRESHOLD = 0.1
+	FLAKE_EXTRA_ATTEMPTS = 1
+
+	// Maximum number of Jobs in a chain of downstream Jobs. Chains within
+	// a repo are checked for cycles, but chains across repos are not, so
+	// this prevents Jobs from being triggered indefinitely.
+	MAX_JOB_CHAIN_DEPTH = 10
 )
 
 var (
@@ -108,6 +130,18 @@ var (
 	ERR_BLAMELIST_DONE = errors.New("ERR_BLAMELIST_DONE")
 )
 
+// taskCfgProvider is the subset of task_cfg_cache.TaskCfgCache used by the
+// TaskScheduler. It allows the simulator to supply TaskSpecs without BigTable.
+type taskCfgProvider interface {
+	Cleanup(ctx context.Context, period time.Duration) error
+	Close() error
+	Get(ctx context.Context, rs types.RepoState) (*specs.TasksCfg, error)
+	GetChangedFiles(ctx context.Context, rs types.RepoState) ([]string, error)
+	GetAddedTaskSpecsForRepoStates(ctx context.Context, rss []types.RepoState) (map[types.RepoState]util.StringSet, error)
+	GetTaskSpec(ctx context.Context, rs types.RepoState, name string) (*specs.TaskSpec, error)
+	MakeJob(ctx context.Context, rs types.RepoState, name string) (*types.Job, error)
+}
+
 // TaskScheduler is a struct used for scheduling tasks on bots.
 type TaskScheduler struct {
 	bl                  *blacklist.Blacklist
@@ -115,13 +149,20 @@ type TaskScheduler struct {
 	cacher              *cacher.Cacher
 	candidateMetrics    map[string]metrics2.Int64Metric
 	candidateMetricsMtx sync.Mutex
+	cronFirings         cron_triggers.DB
 	db                  db.DB
 	depotToolsDir       string
 	diagClient          gcs.GCSClient
 	diagInstance        string
+	fairness            *fairness
+	flakeRates          map[string]map[string]*flakes.FlakeRate // protected by flakeRatesMtx.
+	flakeRateMetrics    map[string]metrics2.Float64Metric       // protected by flakeRatesMtx.
+	flakeRatesMtx       sync.RWMutex
 	isolateCache        *isolate_cache.Cache
 	isolateClient       *isolate.Client
 	jCache              cache.JobCache
+	jobTriggers         map[string]jobTrigger // Cached trigger types of Jobs, by ID; protected by jobTriggersMtx.
+	jobTriggersMtx      sync.Mutex
 	lastScheduled       time.Time // protected by queueMtx.
 	lvUpdateRepos       metrics2.Liveness
 
@@ -134,13 +175,14 @@ type TaskScheduler struct {
 
 	pools        []string
 	pubsubCount  metrics2.Counter
-	pubsubTopic  string
 	queue        []*taskCandidate // protected by queueMtx.
 	queueMtx     sync.RWMutex
+	quarantine   *quarantine.Quarantine
 	repos        repograph.Map
-	swarming     swarming.ApiClient
+	reusedCount  metrics2.Counter
 	syncer       *syncer.Syncer
-	taskCfgCache *task_cfg_cache.TaskCfgCache
+	taskCfgCache taskCfgProvider
+	taskExecutor types.TaskExecutor
 	tCache       cache.TaskCache
 	// testWaitGroup keeps track of any goroutines the TaskScheduler methods
 	// create so that tests can ensure all goroutines finish before asserting.
@@ -153,7 +195,7 @@ type TaskScheduler struct {
 	workdir               string
 }
 
-func NewTaskScheduler(ctx context.Context, d db.DB, bl *blacklist.Blacklist, period time.Duration, numCommits int, workdir, host string, repos repograph.Map, isolateClient *isolate.Client, swarmingClient swarming.ApiClient, c *http.Client, timeDecayAmt24Hr float64, buildbucketApiUrl, trybotBucket string, projectRepoMapping map[string]string, pools []string, pubsubTopic, depotTools string, gerrit gerrit.GerritInterface, btProject, btInstance string, ts oauth2.TokenSource, diagClient gcs.GCSClient, diagInstance string) (*TaskScheduler, error) {
+func NewTaskScheduler(ctx context.Context, d db.DB, bl *blacklist.Blacklist, q *quarantine.Quarantine, cronFirings cron_triggers.DB, fairnessCfg *FairnessConfig, period time.Duration, numCommits int, workdir, host string, repos repograph.Map, isolateClient *isolate.Client, taskExecutor types.TaskExecutor, c *http.Client, timeDecayAmt24Hr float64, buildbucketApiUrl, trybotBucket string, projectRepoMapping map[string]string, pools []string, depotTools string, gerrit gerrit.GerritInterface, btProject, btInstance string, ts oauth2.TokenSource, diagClient gcs.GCSClient, diagInstance string) (*TaskScheduler, error) {
 	// Repos must be updated before window is initialized; otherwise the repos may be uninitialized,
 	// resulting in the window being too short, causing the caches to be loaded with incomplete data.
 	for _, r := range repos {
@@ -165,6 +207,10 @@ func NewTaskScheduler(ctx context.Context, d db.DB, bl *blacklist.Blacklist, per
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create window: %s", err)
 	}
+	f, err := newFairness(fairnessCfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid fairness config: %s", err)
+	}
 
 	// Create caches.
 	tCache, err := cache.NewTaskCache(ctx, d, w, nil)
@@ -197,26 +243,31 @@ func NewTaskScheduler(ctx context.Context, d db.DB, bl *blacklist.Blacklist, per
 		busyBots:              newBusyBots(),
 		cacher:                chr,
 		candidateMetrics:      map[string]metrics2.Int64Metric{},
+		flakeRateMetrics:      map[string]metrics2.Float64Metric{},
+		cronFirings:           cronFirings,
 		db:                    d,
 		depotToolsDir:         depotTools,
 		diagClient:            diagClient,
 		diagInstance:          diagInstance,
+		fairness:              f,
 		isolateCache:          isolateCache,
 		isolateClient:         isolateClient,
 		jCache:                jCache,
+		jobTriggers:           map[string]jobTrigger{},
 		lvUpdateRepos:         metrics2.NewLiveness("last_successful_repo_update"),
 		newTasks:              map[types.RepoState]util.StringSet{},
 		newTasksMtx:           sync.RWMutex{},
 		pendingInsert:         map[string]bool{},
 		pools:                 pools,
 		pubsubCount:           metrics2.GetCounter("task_scheduler_pubsub_handler"),
-		pubsubTopic:           pubsubTopic,
 		queue:                 []*taskCandidate{},
 		queueMtx:              sync.RWMutex{},
+		quarantine:            q,
 		repos:                 repos,
-		swarming:              swarmingClient,
+		reusedCount:           metrics2.GetCounter("task_scheduler_reused_count"),
 		syncer:                sc,
 		taskCfgCache:          taskCfgCache,
+		taskExecutor:          taskExecutor,
 		tCache:                tCache,
 		timeDecayAmt24Hr:      timeDecayAmt24Hr,
 		triggeredCount:        metrics2.GetCounter("task_scheduler_triggered_count"),
@@ -266,12 +317,20 @@ func (s *TaskScheduler) Start(ctx context.Context, enableTryjobs bool, beforeMai
 	}, nil)
 	lvUpdateUnfinishedTasks := metrics2.NewLiveness("last_successful_tasks_update")
 	go util.RepeatCtx(5*time.Minute, ctx, func(ctx context.Context) {
-		if err := s.updateUnfinishedTasks(); err != nil {
+		if err := s.updateUnfinishedTasks(ctx); err != nil {
 			sklog.Errorf("Failed to run periodic tasks update: %s", err)
 		} else {
 			lvUpdateUnfinishedTasks.Reset()
 		}
 	})
+	lvCronTriggers := metrics2.NewLiveness("last_successful_cron_triggers")
+	go util.RepeatCtx(time.Minute, ctx, func(ctx context.Context) {
+		if err := s.triggerCronJobs(ctx, time.Now()); err != nil {
+			sklog.Errorf("Failed to trigger cron jobs: %s", err)
+		} else {
+			lvCronTriggers.Reset()
+		}
+	})
 }
 
 // initCaches ensures that all of the RepoStates we care about are present
@@ -541,6 +600,76 @@ func (s *TaskScheduler) MaybeTriggerPeriodicJobs(ctx context.Context, triggerNam
 	return nil
 }
 
+// triggerCronJobs triggers Jobs at the head of the master branch for any
+// JobSpecs whose cron triggers have fired since they were last evaluated, and
+// records each Firing.
+func (s *TaskScheduler) triggerCronJobs(ctx context.Context, now time.Time) error {
+	if s.cronFirings == nil {
+		return nil
+	}
+	var errs *multierror.Error
+	for repoUrl, repo := range s.repos {
+		master := repo.Get("master")
+		if master == nil {
+			errs = multierror.Append(errs, fmt.Errorf("Failed to retrieve branch 'master' for %s", repoUrl))
+			continue
+		}
+		rs := types.RepoState{
+			Repo:     repoUrl,
+			Revision: master.Hash,
+		}
+		cfg, err := s.taskCfgCache.Get(ctx, rs)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("Failed to retrieve TaskCfg from %s: %s", repoUrl, err))
+			continue
+		}
+		for name, js := range cfg.Jobs {
+			if js.Cron == nil {
+				continue
+			}
+			if err := s.maybeTriggerCronJob(ctx, rs, name, js.Cron, now); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("Failed to process cron trigger for %s in %s: %s", name, repoUrl, err))
+			}
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// maybeTriggerCronJob evaluates the given cron trigger for the given JobSpec,
+// triggers a Job at the given RepoState if a firing is due, and records the
+// Firing.
+func (s *TaskScheduler) maybeTriggerCronJob(ctx context.Context, rs types.RepoState, name string, trigger *specs.CronTrigger, now time.Time) error {
+	prev, err := s.cronFirings.GetLastFiring(rs.Repo, name)
+	if err != nil {
+		return err
+	}
+	f, err := cron_triggers.Evaluate(rs.Repo, name, trigger, prev, now)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return nil
+	}
+	f.Processed = now
+	if !f.Skipped {
+		job, err := s.taskCfgCache.MakeJob(ctx, rs, name)
+		if err != nil {
+			return fmt.Errorf("Failed to create job: %s", err)
+		}
+		job.Requested = job.Created
+		if err := s.putJobsInChunks([]*types.Job{job}); err != nil {
+			return fmt.Errorf("Failed to insert job: %s", err)
+		}
+		f.JobId = job.Id
+		sklog.Infof("Triggered cron job %s (%s) for firing at %s (missed: %d, caught up: %t)", name, job.Id, f.Scheduled, f.Missed, f.CaughtUp)
+	} else {
+		sklog.Warningf("Skipped cron firing of %s at %s: %s", name, f.Scheduled, f.Reason)
+	}
+	// If this fails after we've inserted the Job, we'll trigger a
+	// duplicate Job next time.
+	return s.cronFirings.PutFiring(f)
+}
+
 // ComputeBlamelist computes the blamelist for a new task, specified by name,
 // repo, and revision. Returns the list of commits covered by the task, and any
 // previous task which part or all of the blamelist was "stolen" from (see
@@ -651,16 +780,16 @@ func ComputeBlamelist(ctx context.Context, cache cache.TaskCache, repo *repograp
 }
 
 type taskSchedulerMainLoopDiagnostics struct {
-	StartTime  time.Time                           `json:"startTime"`
-	EndTime    time.Time                           `json:"endTime"`
-	Error      string                              `json:"error,omitEmpty"`
-	Candidates []*taskCandidate                    `json:"candidates"`
-	FreeBots   []*swarming_api.SwarmingRpcsBotInfo `json:"freeBots"`
+	StartTime  time.Time        `json:"startTime"`
+	EndTime    time.Time        `json:"endTime"`
+	Error      string           `json:"error,omitEmpty"`
+	Candidates []*taskCandidate `json:"candidates"`
+	FreeBots   []*types.Machine `json:"freeBots"`
 }
 
 // writeMainLoopDiagnosticsToGCS writes JSON containing allCandidates and
 // freeBots to GCS. If called in a goroutine, the arguments may not be modified.
-func writeMainLoopDiagnosticsToGCS(ctx context.Context, start time.Time, end time.Time, diagClient gcs.GCSClient, diagInstance string, allCandidates map[types.TaskKey]*taskCandidate, freeBots []*swarming_api.SwarmingRpcsBotInfo, scheduleErr error) error {
+func writeMainLoopDiagnosticsToGCS(ctx context.Context, start time.Time, end time.Time, diagClient gcs.GCSClient, diagInstance string, allCandidates map[types.TaskKey]*taskCandidate, freeBots []*types.Machine, scheduleErr error) error {
 	defer metrics2.FuncTimer().Stop()
 	candidateSlice := make([]*taskCandidate, 0, len(allCandidates))
 	for _, c := range allCandidates {
@@ -738,15 +867,20 @@ func (s *TaskScheduler) findTaskCandidatesForJobs(ctx context.Context, unfinishe
 
 // filterTaskCandidates reduces the set of taskCandidates to the ones we might
 // actually want to run and organizes them by repo and TaskSpec name.
-func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[types.TaskKey]*taskCandidate) (map[string]map[string][]*taskCandidate, error) {
+func (s *TaskScheduler) filterTaskCandidates(ctx context.Context, preFilterCandidates map[types.TaskKey]*taskCandidate) (map[string]map[string][]*taskCandidate, error) {
 	defer metrics2.FuncTimer().Stop()
 
 	candidatesBySpec := map[string]map[string][]*taskCandidate{}
 	total := 0
 	skippedByBlacklist := map[string]int{}
+	needChangedFiles := s.bl.NeedsChangedFiles()
 	for _, c := range preFilterCandidates {
 		// Reject blacklisted tasks.
-		if rule := s.bl.MatchRule(c.Name, c.Revision); rule != "" {
+		blc, err := s.makeBlacklistCandidate(ctx, c, needChangedFiles)
+		if err != nil {
+			return nil, err
+		}
+		if rule := s.bl.MatchCandidate(blc); rule != "" {
 			skippedByBlacklist[rule]++
 			c.GetDiagnostics().Filtering = &taskCandidateFilteringDiagnostics{BlacklistedByRule: rule}
 			continue
@@ -782,6 +916,12 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[types.TaskK
 				c.GetDiagnostics().Filtering = &taskCandidateFilteringDiagnostics{SupersededByTask: previous.Id}
 				continue
 			}
+			// Don't retry quarantined TaskSpecs; their failures
+			// don't affect the Jobs which depend on them.
+			if s.quarantine.IsQuarantined(c.Repo, c.Name) {
+				c.GetDiagnostics().Filtering = &taskCandidateFilteringDiagnostics{Quarantined: true}
+				continue
+			}
 			// The attempt counts are only valid if the previous
 			// attempt we're looking at is the last attempt for this
 			// TaskSpec. Fortunately, TaskCache.GetTasksByKey sorts
@@ -791,6 +931,16 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[types.TaskK
 			if maxAttempts == 0 {
 				maxAttempts = specs.DEFAULT_TASK_SPEC_MAX_ATTEMPTS
 			}
+			// Suspected flakes get extra attempts, unless the
+			// TaskSpec has opted out of retries. Once a task has
+			// been given extra attempts, its retries keep them,
+			// even if the flake rate has since dropped.
+			if c.TaskSpec.MaxAttempts != 1 && s.isSuspectedFlake(c.Repo, c.Name) {
+				maxAttempts += FLAKE_EXTRA_ATTEMPTS
+			}
+			if previous.MaxAttempts > maxAttempts {
+				maxAttempts = previous.MaxAttempts
+			}
 			// Special case for tasks created before arbitrary
 			// numbers of attempts were possible.
 			previousAttempt := previous.Attempt
@@ -807,6 +957,13 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[types.TaskK
 			}
 			c.Attempt = previousAttempt + 1
 			c.RetryOf = previous.Id
+			if maxAttempts != c.TaskSpec.MaxAttempts {
+				// Record the extended number of attempts on
+				// the retry. Copy the TaskSpec, since it may
+				// be shared with other candidates.
+				c.TaskSpec = c.TaskSpec.Copy()
+				c.TaskSpec.MaxAttempts = maxAttempts
+			}
 		}
 
 		// Don't consider candidates whose dependencies are not met.
@@ -824,6 +981,13 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[types.TaskK
 			hashes = append(hashes, hash)
 			parentTaskIds = append(parentTaskIds, id)
 		}
+		if len(c.TaskSpec.Dependencies) == 0 {
+			// Tasks with no dependencies of their own receive the
+			// outputs of the upstream Job, if any.
+			if j := c.downstreamJob(); j != nil {
+				hashes = append(hashes, j.UpstreamOutputs...)
+			}
+		}
 		c.IsolatedHashes = hashes
 		sort.Strings(parentTaskIds)
 		c.ParentTaskIds = parentTaskIds
@@ -844,6 +1008,32 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[types.TaskK
 	return candidatesBySpec, nil
 }
 
+// makeBlacklistCandidate returns a blacklist.Candidate describing the given
+// taskCandidate. The files changed by the commit are only included if
+// needChangedFiles is true.
+func (s *TaskScheduler) makeBlacklistCandidate(ctx context.Context, c *taskCandidate, needChangedFiles bool) (*blacklist.Candidate, error) {
+	rv := &blacklist.Candidate{
+		Commit:   c.Revision,
+		TaskSpec: c.Name,
+		Trigger:  s.getTriggerType(ctx, c.TaskKey, c.Jobs),
+	}
+	if repo, ok := s.repos[c.Repo]; ok {
+		if commit := repo.Get(c.Revision); commit != nil {
+			rv.Author = commit.Author
+		}
+	}
+	if needChangedFiles {
+		// Don't ignore rules which match on paths because we failed to
+		// obtain the changed files.
+		changedFiles, err := s.taskCfgCache.GetChangedFiles(ctx, c.RepoState)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to obtain changed files for %s: %s", c.RepoState.RowKey(), err)
+		}
+		rv.ChangedFiles = changedFiles
+	}
+	return rv, nil
+}
+
 // processTaskCandidate computes the remaining information about the task
 // candidate, eg. blamelists and scoring.
 func (s *TaskScheduler) processTaskCandidate(ctx context.Context, c *taskCandidate, now time.Time, cache *cacheWrapper, commitsBuf []*repograph.Commit, diag *taskCandidateScoringDiagnostics) error {
@@ -982,6 +1172,7 @@ func (s *TaskScheduler) processTaskCandidates(ctx context.Context, candidates ma
 							errs <- err
 							return
 						}
+						s.applyFairness(c, diag)
 						if best == nil || c.Score > best.Score {
 							orig = candidate
 							best = c
@@ -1140,7 +1331,7 @@ func (s *TaskScheduler) regenerateTaskQueue(ctx context.Context, now time.Time)
 	}
 
 	// Filter task candidates.
-	candidates, err := s.filterTaskCandidates(preFilterCandidates)
+	candidates, err := s.filterTaskCandidates(ctx, preFilterCandidates)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1148,6 +1339,11 @@ func (s *TaskScheduler) regenerateTaskQueue(ctx context.Context, now time.Time)
 	// Record the number of task candidates per dimension set.
 	s.recordCandidateMetrics(candidates)
 
+	// Compute the fairness multipliers for the task candidates.
+	if err := s.updateFairness(ctx, candidates, now); err != nil {
+		return nil, nil, err
+	}
+
 	// Process the remaining task candidates.
 	queue, err := s.processTaskCandidates(ctx, candidates, now)
 	if err != nil {
@@ -1157,22 +1353,20 @@ func (s *TaskScheduler) regenerateTaskQueue(ctx context.Context, now time.Time)
 	return queue, preFilterCandidates, nil
 }
 
-// getCandidatesToSchedule matches the list of free Swarming bots to task
-// candidates in the queue and returns the candidates which should be run.
-// Assumes that the tasks are sorted in decreasing order by score.
-func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*taskCandidate) []*taskCandidate {
+// getCandidatesToSchedule matches the list of free bots to task candidates in
+// the queue and returns the candidates which should be run, along with the ID
+// of the bot chosen for each of them, keyed by TaskKey. Assumes that the tasks
+// are sorted in decreasing order by score.
+func getCandidatesToSchedule(bots []*types.Machine, tasks []*taskCandidate) ([]*taskCandidate, map[types.TaskKey]string) {
 	defer metrics2.FuncTimer().Stop()
-	// Create a bots-by-swarming-dimension mapping.
+	// Create a bots-by-dimension mapping.
 	botsByDim := map[string]util.StringSet{}
 	for _, b := range bots {
-		for _, dim := range b.Dimensions {
-			for _, val := range dim.Value {
-				d := fmt.Sprintf("%s:%s", dim.Key, val)
-				if _, ok := botsByDim[d]; !ok {
-					botsByDim[d] = util.StringSet{}
-				}
-				botsByDim[d][b.BotId] = true
+		for _, d := range b.Dimensions {
+			if _, ok := botsByDim[d]; !ok {
+				botsByDim[d] = util.StringSet{}
 			}
+			botsByDim[d][b.ID] = true
 		}
 	}
 	// BotIds that have been used by previous candidates.
@@ -1187,6 +1381,7 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 	// match so that less-specialized tasks don't "steal" more-specialized
 	// bots which they don't actually need.
 	rv := make([]*taskCandidate, 0, len(bots))
+	assignments := make(map[types.TaskKey]string, len(bots))
 	countByTaskSpec := make(map[string]int, len(bots))
 	for _, c := range tasks {
 		diag := &taskCandidateSchedulingDiagnostics{}
@@ -1261,6 +1456,7 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 			// We're going to run this task.
 			diag.Selected = true
 			usedBots[chosenBot] = true
+			assignments[c.TaskKey] = chosenBot
 
 			// Add the task to the scheduling list.
 			rv = append(rv, c)
@@ -1268,7 +1464,98 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 		}
 	}
 	sort.Sort(taskCandidateSlice(rv))
-	return rv
+	return rv, assignments
+}
+
+// getIsolatedFile returns the isolated file for the given taskCandidate,
+// including the outputs of its dependencies.
+func (s *TaskScheduler) getIsolatedFile(ctx context.Context, c *taskCandidate) (*isolated.Isolated, error) {
+	isolatedFile, err := s.isolateCache.Get(ctx, c.RepoState, c.TaskSpec.Isolate)
+	if err != nil {
+		return nil, err
+	}
+	for _, inc := range c.IsolatedHashes {
+		isolatedFile.Includes = append(isolatedFile.Includes, isolated.HexDigest(inc))
+	}
+	return isolatedFile, nil
+}
+
+// isolatedFileDigest returns a digest of the contents of the given isolated
+// file. Unlike the hash assigned by the Isolate server, it does not require
+// uploading the file.
+func isolatedFileDigest(isolatedFile *isolated.Isolated) (string, error) {
+	b, err := json.Marshal(isolatedFile)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// reuseCandidates finds the candidates in the queue which may reuse the
+// result of an earlier successful task with identical inputs. This happens
+// before bots are matched to candidates, so that reused candidates don't
+// consume bots. Returns the new Tasks for the reused candidates and the
+// remaining candidates, whose ReuseKey is set if they are eligible for reuse
+// by later candidates, along with any error which occurred. Candidates for
+// which an error occurred are scheduled normally.
+func (s *TaskScheduler) reuseCandidates(ctx context.Context, queue []*taskCandidate) ([]*types.Task, []*taskCandidate, error) {
+	defer metrics2.FuncTimer().Stop()
+	reused := []*types.Task{}
+	remaining := make([]*taskCandidate, 0, len(queue))
+	var errs *multierror.Error
+	now := time.Now()
+	for _, c := range queue {
+		if c.Score <= 0.0 || !c.mayReuse() {
+			remaining = append(remaining, c)
+			continue
+		}
+		isolatedFile, err := s.getIsolatedFile(ctx, c)
+		if err != nil {
+			remaining = append(remaining, c)
+			errs = multierror.Append(errs, fmt.Errorf("Failed to obtain cached isolate: %s", err))
+			continue
+		}
+		digest, err := isolatedFileDigest(isolatedFile)
+		if err != nil {
+			remaining = append(remaining, c)
+			errs = multierror.Append(errs, fmt.Errorf("Failed to compute isolated digest: %s", err))
+			continue
+		}
+		reuseKey, err := c.MakeReuseKey(digest)
+		if err != nil {
+			remaining = append(remaining, c)
+			errs = multierror.Append(errs, fmt.Errorf("Failed to make reuse key: %s", err))
+			continue
+		}
+		c.ReuseKey = reuseKey
+		prev, err := s.tCache.GetTaskForReuseKey(reuseKey)
+		if err != nil {
+			remaining = append(remaining, c)
+			errs = multierror.Append(errs, fmt.Errorf("Failed to search for reusable task: %s", err))
+			continue
+		}
+		if prev == nil {
+			remaining = append(remaining, c)
+			continue
+		}
+		// An earlier task had identical inputs and succeeded; reuse its
+		// result rather than running the task again.
+		t := c.MakeTask()
+		if err := s.db.AssignId(t); err != nil {
+			remaining = append(remaining, c)
+			errs = multierror.Append(errs, fmt.Errorf("Failed to assign id: %s", err))
+			continue
+		}
+		reuseTaskResult(t, prev, now)
+		c.GetDiagnostics().Triggering = &taskCandidateTriggeringDiagnostics{
+			ReusedTaskId: t.ReusedFrom,
+			TaskId:       t.Id,
+		}
+		s.reusedCount.Inc(1)
+		sklog.Infof("Reusing result of task %s for %s @ %s", t.ReusedFrom, t.Name, t.Revision)
+		reused = append(reused, t)
+	}
+	return reused, remaining, errs.ErrorOrNil()
 }
 
 // isolateCandidates uploads inputs for the taskCandidates to the Isolate
@@ -1283,16 +1570,13 @@ func (s *TaskScheduler) isolateCandidates(ctx context.Context, candidates []*tas
 	isolatedFiles := make([]*isolated.Isolated, 0, len(candidates))
 	var errs *multierror.Error
 	for _, c := range candidates {
-		isolatedFile, err := s.isolateCache.Get(ctx, c.RepoState, c.TaskSpec.Isolate)
+		isolatedFile, err := s.getIsolatedFile(ctx, c)
 		if err != nil {
 			errStr := err.Error()
 			c.GetDiagnostics().Triggering = &taskCandidateTriggeringDiagnostics{IsolateError: errStr}
 			errs = multierror.Append(errs, fmt.Errorf("Failed to obtain cached isolate: %s", errStr))
 			continue
 		}
-		for _, inc := range c.IsolatedHashes {
-			isolatedFile.Includes = append(isolatedFile.Includes, isolated.HexDigest(inc))
-		}
 		isolatedFiles = append(isolatedFiles, isolatedFile)
 		isolatedCandidates = append(isolatedCandidates, c)
 	}
@@ -1310,10 +1594,10 @@ func (s *TaskScheduler) isolateCandidates(ctx context.Context, candidates []*tas
 	return isolatedCandidates, errs.ErrorOrNil()
 }
 
-// triggerTasks triggers the given slice of tasks to run on Swarming and returns
+// triggerTasks triggers the given slice of tasks to run and returns
 // a channel of the successfully-triggered tasks which is closed after all tasks
 // have been triggered or failed. Each failure is sent to errCh.
-func (s *TaskScheduler) triggerTasks(candidates []*taskCandidate, errCh chan<- error) <-chan *types.Task {
+func (s *TaskScheduler) triggerTasks(ctx context.Context, candidates []*taskCandidate, errCh chan<- error) <-chan *types.Task {
 	defer metrics2.FuncTimer().Stop()
 	triggered := make(chan *types.Task)
 	var wg sync.WaitGroup
@@ -1334,7 +1618,7 @@ func (s *TaskScheduler) triggerTasks(candidates []*taskCandidate, errCh chan<- e
 				return
 			}
 			diag.TaskId = t.Id
-			req, err := candidate.MakeTaskRequest(t.Id, s.isolateClient.ServerURL(), s.pubsubTopic)
+			req, err := candidate.MakeTaskRequest(t.Id)
 			if err != nil {
 				recordErr("Failed to make task request", err)
 				return
@@ -1342,10 +1626,10 @@ func (s *TaskScheduler) triggerTasks(candidates []*taskCandidate, errCh chan<- e
 			s.pendingInsertMtx.Lock()
 			s.pendingInsert[t.Id] = true
 			s.pendingInsertMtx.Unlock()
-			var resp *swarming_api.SwarmingRpcsTaskRequestMetadata
+			var resp *types.TaskResult
 			if err := timeout.Run(func() error {
 				var err error
-				resp, err = s.swarming.TriggerTask(req)
+				resp, err = s.taskExecutor.TriggerTask(ctx, req)
 				return err
 			}, time.Minute); err != nil {
 				s.pendingInsertMtx.Lock()
@@ -1358,16 +1642,11 @@ func (s *TaskScheduler) triggerTasks(candidates []*taskCandidate, errCh chan<- e
 				recordErr("Failed to trigger task", skerr.Wrapf(err, "%q needed for jobs: %+v", candidate.Name, jobIds))
 				return
 			}
-			created, err := swarming.ParseTimestamp(resp.Request.CreatedTs)
-			if err != nil {
-				recordErr("Failed to parse Swarming timestamp", err)
-				return
-			}
-			t.Created = created
-			t.SwarmingTaskId = resp.TaskId
+			t.Created = resp.Created
+			t.SwarmingTaskId = resp.ID
 			// The task may have been de-duplicated.
-			if resp.TaskResult != nil && resp.TaskResult.State == swarming.TASK_STATE_COMPLETED {
-				if _, err := t.UpdateFromSwarming(resp.TaskResult); err != nil {
+			if resp.Status == types.TASK_STATUS_SUCCESS || resp.Status == types.TASK_STATUS_FAILURE {
+				if _, err := t.UpdateFromTaskResult(resp); err != nil {
 					recordErr("Failed to update de-duplicated task", err)
 					return
 				}
@@ -1391,21 +1670,43 @@ func (s *TaskScheduler) triggerTasks(candidates []*taskCandidate, errCh chan<- e
 	return triggered
 }
 
-// scheduleTasks queries for free Swarming bots and triggers tasks according
-// to relative priorities in the queue.
-func (s *TaskScheduler) scheduleTasks(ctx context.Context, bots []*swarming_api.SwarmingRpcsBotInfo, queue []*taskCandidate) error {
+// reuseTaskResult fills in the result of the given new Task from the given
+// earlier successful Task with identical inputs.
+func reuseTaskResult(t, prev *types.Task, now time.Time) {
+	t.ReusedFrom = prev.Id
+	if prev.ReusedFrom != "" {
+		t.ReusedFrom = prev.ReusedFrom
+	}
+	t.IsolatedOutput = prev.IsolatedOutput
+	t.Status = types.TASK_STATUS_SUCCESS
+	// The task did not run, so make it appear that it took no time, as we
+	// do for tasks which are de-duplicated by the TaskExecutor.
+	t.Created = now
+	t.Started = now
+	t.Finished = now
+}
+
+// scheduleTasks matches free bots with tasks and triggers tasks according to
+// relative priorities in the queue.
+func (s *TaskScheduler) scheduleTasks(ctx context.Context, bots []*types.Machine, queue []*taskCandidate) error {
 	defer metrics2.FuncTimer().Stop()
+	// Reuse the results of earlier tasks where possible.
+	reused, remaining, reuseErr := s.reuseCandidates(ctx, queue)
+
 	// Match free bots with tasks.
-	candidates := getCandidatesToSchedule(bots, queue)
+	candidates, _ := getCandidatesToSchedule(bots, remaining)
 
 	// Isolate the tasks.
 	isolated, isolateErr := s.isolateCandidates(ctx, candidates)
-	if isolateErr != nil && len(isolated) == 0 {
+	if isolateErr != nil && len(isolated) == 0 && len(reused) == 0 {
 		return isolateErr
 	}
 
 	// Setup the error channel.
 	errs := []error{}
+	if reuseErr != nil {
+		errs = append(errs, reuseErr)
+	}
 	if isolateErr != nil {
 		errs = append(errs, isolateErr)
 	}
@@ -1420,12 +1721,12 @@ func (s *TaskScheduler) scheduleTasks(ctx context.Context, bots []*swarming_api.
 	}()
 
 	// Trigger Swarming tasks.
-	triggered := s.triggerTasks(isolated, errCh)
+	triggered := s.triggerTasks(ctx, isolated, errCh)
 
-	// Collect the tasks we triggered.
+	// Collect the tasks we triggered, along with the reused tasks.
 	numTriggered := 0
 	insert := map[string]map[string][]*types.Task{}
-	for t := range triggered {
+	addTask := func(t *types.Task) {
 		byRepo, ok := insert[t.Repo]
 		if !ok {
 			byRepo = map[string][]*types.Task{}
@@ -1434,6 +1735,12 @@ func (s *TaskScheduler) scheduleTasks(ctx context.Context, bots []*swarming_api.
 		byRepo[t.Name] = append(byRepo[t.Name], t)
 		numTriggered++
 	}
+	for _, t := range reused {
+		addTask(t)
+	}
+	for t := range triggered {
+		addTask(t)
+	}
 	close(errCh)
 	errWg.Wait()
 
@@ -1571,10 +1878,13 @@ func (s *TaskScheduler) gatherNewJobs(ctx context.Context, repoUrl string, repo
 			}
 			return err
 		}
+		// The files changed by this commit, if any JobSpec needs them.
+		var changedFiles []string
+		loadedChangedFiles := false
 		alreadyScheduledAllJobs := true
 		for name, spec := range cfg.Jobs {
 			shouldRun := false
-			if !util.In(spec.Trigger, specs.PERIODIC_TRIGGERS) {
+			if !spec.IsPeriodic() {
 				if spec.Trigger == specs.TRIGGER_ANY_BRANCH {
 					shouldRun = true
 				} else if spec.Trigger == specs.TRIGGER_MASTER_ONLY {
@@ -1621,6 +1931,25 @@ func (s *TaskScheduler) gatherNewJobs(ctx context.Context, repoUrl string, repo
 						sklog.Errorf("Job created time %s is before requested time %s! Setting equal.", j.Created, j.Requested)
 						j.Requested = j.Created.Add(-firestore.TS_RESOLUTION)
 					}
+					// Record Jobs which don't apply to the files
+					// changed by this commit as skipped, so that we
+					// don't try to schedule them again.
+					if spec.HasPathFilters() {
+						if !loadedChangedFiles {
+							changedFiles, err = s.taskCfgCache.GetChangedFiles(ctx, rs)
+							if err != nil {
+								return err
+							}
+							loadedChangedFiles = true
+						}
+						if changedFiles != nil {
+							if reason := spec.PathFilterSkipReason(changedFiles); reason != "" {
+								j.Status = types.JOB_STATUS_SKIPPED
+								j.StatusDetails = reason
+								j.Finished = j.Created
+							}
+						}
+					}
 					newJobs = append(newJobs, j)
 				}
 			}
@@ -1677,6 +2006,117 @@ func (s *TaskScheduler) updateAddedTaskSpecs(ctx context.Context) error {
 	return nil
 }
 
+// updateFlakeRates recomputes the flake rates of all TaskSpecs over the
+// FLAKE_RATE_WINDOW preceding the given time.
+func (s *TaskScheduler) updateFlakeRates(now time.Time) {
+	tasks, err := s.tCache.GetTasksFromDateRange(now.Add(-FLAKE_RATE_WINDOW), now)
+	if err != nil {
+		// Not fatal; we'll just use the previous flake rates.
+		sklog.Errorf("Failed to retrieve tasks to compute flake rates: %s", err)
+		return
+	}
+	rates := flakes.FindFlakeRates(tasks)
+	s.flakeRatesMtx.Lock()
+	defer s.flakeRatesMtx.Unlock()
+	s.flakeRates = rates
+
+	// Report the flake rates of TaskSpecs which have run often enough for
+	// the rate to be meaningful.
+	reported := map[string]bool{}
+	for _, byName := range rates {
+		for _, r := range byName {
+			if r.Total < FLAKE_RATE_MIN_TASKS {
+				continue
+			}
+			if r.Rate() >= FLAKE_RATE_THRESHOLD {
+				sklog.Infof("Suspected flake: %s in %s (%d of %d tasks flaky)", r.Name, r.Repo, r.Flaky, r.Total)
+			}
+			k := r.Repo + "|" + r.Name
+			metric, ok := s.flakeRateMetrics[k]
+			if !ok {
+				metric = metrics2.GetFloat64Metric(MEASUREMENT_FLAKE_RATE, map[string]string{
+					"repo":      r.Repo,
+					"task_spec": r.Name,
+				})
+				s.flakeRateMetrics[k] = metric
+			}
+			metric.Update(r.Rate())
+			reported[k] = true
+		}
+	}
+	for k, metric := range s.flakeRateMetrics {
+		if !reported[k] {
+			metric.Update(0)
+			delete(s.flakeRateMetrics, k)
+		}
+	}
+}
+
+// isSuspectedFlake returns true iff the given TaskSpec has been flaky often
+// enough recently that its tasks should receive extra attempts.
+func (s *TaskScheduler) isSuspectedFlake(repo, name string) bool {
+	s.flakeRatesMtx.RLock()
+	defer s.flakeRatesMtx.RUnlock()
+	r, ok := s.flakeRates[repo][name]
+	return ok && r.Total >= FLAKE_RATE_MIN_TASKS && r.Rate() >= FLAKE_RATE_THRESHOLD
+}
+
+// jobTrigger is a cached trigger type of a Job.
+type jobTrigger struct {
+	created time.Time
+	trigger string
+}
+
+// getJobTriggerType returns the trigger type of the given Job.
+func (s *TaskScheduler) getJobTriggerType(ctx context.Context, j *types.Job) string {
+	s.jobTriggersMtx.Lock()
+	defer s.jobTriggersMtx.Unlock()
+	if cached, ok := s.jobTriggers[j.Id]; ok {
+		return cached.trigger
+	}
+	isPeriodic := false
+	if !j.IsTryJob() && !j.IsForce && !j.IsDownstream() {
+		cfg, err := s.taskCfgCache.Get(ctx, j.RepoState)
+		if err != nil {
+			// Don't cache the result, so that we try again next time.
+			sklog.Warningf("Failed to obtain TasksCfg for job %s; assuming it was triggered by a commit: %s", j.Id, err)
+			return j.TriggerType(false)
+		} else if spec, ok := cfg.Jobs[j.Name]; ok {
+			isPeriodic = spec.IsPeriodic()
+		}
+	}
+	trigger := j.TriggerType(isPeriodic)
+	if s.jobTriggers == nil {
+		s.jobTriggers = map[string]jobTrigger{}
+	}
+	s.jobTriggers[j.Id] = jobTrigger{
+		created: j.Created,
+		trigger: trigger,
+	}
+	return trigger
+}
+
+// cleanupJobTriggers removes the cached trigger types of Jobs which were
+// created before the given time.
+func (s *TaskScheduler) cleanupJobTriggers(start time.Time) {
+	s.jobTriggersMtx.Lock()
+	defer s.jobTriggersMtx.Unlock()
+	for id, cached := range s.jobTriggers {
+		if cached.created.Before(start) {
+			delete(s.jobTriggers, id)
+		}
+	}
+}
+
+// getTriggerType returns the trigger type of a task or candidate with the given
+// TaskKey which is needed by the given Jobs. A task is only considered periodic
+// if all of its Jobs are periodic.
+func (s *TaskScheduler) getTriggerType(ctx context.Context, k types.TaskKey, jobs []*types.Job) string {
+	return types.TaskTriggerType(k, jobs, func(j *types.Job) string {
+		return s.getJobTriggerType(ctx, j)
+	})
+}
+
 // MainLoop runs a single end-to-end task scheduling loop.
 func (s *TaskScheduler) MainLoop(ctx context.Context) error {
 	defer metrics2.FuncTimer().Stop()
@@ -1687,13 +2127,13 @@ func (s *TaskScheduler) MainLoop(ctx context.Context) error {
 	var getSwarmingBotsErr error
 	var wg sync.WaitGroup
 
-	var bots []*swarming_api.SwarmingRpcsBotInfo
+	var bots []*types.Machine
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
 		var err error
-		bots, err = getFreeSwarmingBots(s.swarming, s.busyBots, s.pools)
+		bots, err = getFreeMachines(ctx, s.taskExecutor, s.busyBots, s.pools)
 		if err != nil {
 			getSwarmingBotsErr = err
 			return
@@ -1709,7 +2149,13 @@ func (s *TaskScheduler) MainLoop(ctx context.Context) error {
 		return fmt.Errorf("Failed to update job cache: %s", err)
 	}
 
-	if err := s.updateUnfinishedJobs(); err != nil {
+	if err := s.quarantine.Update(); err != nil {
+		return fmt.Errorf("Failed to update quarantine: %s", err)
+	}
+
+	s.updateFlakeRates(start)
+
+	if err := s.updateUnfinishedJobs(ctx); err != nil {
 		return fmt.Errorf("Failed to update unfinished jobs: %s", err)
 	}
 
@@ -1779,6 +2225,7 @@ func (s *TaskScheduler) HandleRepoUpdate(ctx context.Context, repoUrl string, g
 	if err := s.taskCfgCache.Cleanup(ctx, time.Now().Sub(s.window.EarliestStart())); err != nil {
 		return skerr.Wrapf(err, "failed to Cleanup TaskCfgCache")
 	}
+	s.cleanupJobTriggers(s.window.EarliestStart())
 	s.lvUpdateRepos.Reset()
 	return nil
 }
@@ -1873,23 +2320,22 @@ func testednessIncrease(blamelistLength, stoleFromBlamelistLength int) float64 {
 	}
 }
 
-// getFreeSwarmingBots returns a slice of free swarming bots.
-func getFreeSwarmingBots(s swarming.ApiClient, busy *busyBots, pools []string) ([]*swarming_api.SwarmingRpcsBotInfo, error) {
+// getFreeMachines returns a slice of free machines.
+func getFreeMachines(ctx context.Context, taskExec types.TaskExecutor, busy *busyBots, pools []string) ([]*types.Machine, error) {
 	defer metrics2.FuncTimer().Stop()
 
-	// Query for free Swarming bots and pending Swarming tasks in all pools.
+	// Query for free machines and pending tasks in all pools.
 	var wg sync.WaitGroup
-	bots := []*swarming_api.SwarmingRpcsBotInfo{}
-	pending := []*swarming_api.SwarmingRpcsTaskResult{}
+	bots := []*types.Machine{}
+	pending := []*types.TaskResult{}
 	errs := []error{}
 	var mtx sync.Mutex
-	t := time.Time{}
 	for _, pool := range pools {
 		// Free bots.
 		wg.Add(1)
 		go func(pool string) {
 			defer wg.Done()
-			b, err := s.ListFreeBots(pool)
+			b, err := taskExec.GetFreeMachines(ctx, pool)
 			mtx.Lock()
 			defer mtx.Unlock()
 			if err != nil {
@@ -1903,7 +2349,7 @@ func getFreeSwarmingBots(s swarming.ApiClient, busy *busyBots, pools []string) (
 		wg.Add(1)
 		go func(pool string) {
 			defer wg.Done()
-			t, err := s.ListTaskResults(t, t, []string{fmt.Sprintf("pool:%s", pool)}, "PENDING", false)
+			t, err := taskExec.GetPendingTasks(ctx, pool)
 			mtx.Lock()
 			defer mtx.Unlock()
 			if err != nil {
@@ -1916,18 +2362,18 @@ func getFreeSwarmingBots(s swarming.ApiClient, busy *busyBots, pools []string) (
 
 	wg.Wait()
 	if len(errs) > 0 {
-		return nil, fmt.Errorf("Got errors loading bots and tasks from Swarming: %v", errs)
+		return nil, fmt.Errorf("Got errors loading bots and tasks: %v", errs)
 	}
 
-	rv := make([]*swarming_api.SwarmingRpcsBotInfo, 0, len(bots))
+	rv := make([]*types.Machine, 0, len(bots))
 	for _, bot := range bots {
 		if bot.IsDead {
 			continue
 		}
-		if bot.Quarantined {
+		if bot.IsQuarantined {
 			continue
 		}
-		if bot.TaskId != "" {
+		if bot.CurrentTaskID != "" {
 			continue
 		}
 		rv = append(rv, bot)
@@ -1936,9 +2382,9 @@ func getFreeSwarmingBots(s swarming.ApiClient, busy *busyBots, pools []string) (
 	return busy.Filter(rv), nil
 }
 
-// updateUnfinishedTasks queries Swarming for all unfinished tasks and updates
-// their status in the DB.
-func (s *TaskScheduler) updateUnfinishedTasks() error {
+// updateUnfinishedTasks queries the TaskExecutor for all unfinished tasks and
+// updates their status in the DB.
+func (s *TaskScheduler) updateUnfinishedTasks(ctx context.Context) error {
 	defer metrics2.FuncTimer().Stop()
 	// Update the TaskCache.
 	if err := s.tCache.Update(); err != nil {
@@ -1951,20 +2397,19 @@ func (s *TaskScheduler) updateUnfinishedTasks() error {
 	}
 	sort.Sort(types.TaskSlice(tasks))
 
-	// Query Swarming for all unfinished tasks.
+	// Query the TaskExecutor for all unfinished tasks.
 	sklog.Infof("Querying states of %d unfinished tasks.", len(tasks))
 	ids := make([]string, 0, len(tasks))
 	for _, t := range tasks {
 		ids = append(ids, t.SwarmingTaskId)
 	}
-	states, err := s.swarming.GetStates(ids)
+	finishedStates, err := s.taskExecutor.GetTaskCompletionStatuses(ctx, ids)
 	if err != nil {
 		return err
 	}
-	finished := make([]*types.Task, 0, len(states))
+	finished := make([]*types.Task, 0, len(finishedStates))
 	for idx, task := range tasks {
-		state := states[idx]
-		if state != swarming.TASK_STATE_PENDING && state != swarming.TASK_STATE_RUNNING {
+		if finishedStates[idx] {
 			finished = append(finished, task)
 		}
 	}
@@ -1978,12 +2423,12 @@ func (s *TaskScheduler) updateUnfinishedTasks() error {
 			wg.Add(1)
 			go func(idx int, t *types.Task) {
 				defer wg.Done()
-				swarmTask, err := s.swarming.GetTask(t.SwarmingTaskId, false)
+				res, err := s.taskExecutor.GetTaskResult(ctx, t.SwarmingTaskId)
 				if err != nil {
-					errs[idx] = fmt.Errorf("Failed to update unfinished task; failed to get updated task from swarming: %s", err)
+					errs[idx] = fmt.Errorf("Failed to update unfinished task; failed to get updated task from the TaskExecutor: %s", err)
 					return
 				}
-				modified, err := db.UpdateDBFromSwarmingTask(s.db, swarmTask)
+				modified, err := db.UpdateDBFromTaskResult(s.db, res)
 				if err != nil {
 					errs[idx] = fmt.Errorf("Failed to update unfinished task: %s", err)
 					return
@@ -2004,8 +2449,8 @@ func (s *TaskScheduler) updateUnfinishedTasks() error {
 }
 
 // updateUnfinishedJobs updates all not-yet-finished Jobs to determine if their
-// state has changed.
-func (s *TaskScheduler) updateUnfinishedJobs() error {
+// state has changed, and triggers any downstream Jobs of those which succeeded.
+func (s *TaskScheduler) updateUnfinishedJobs(ctx context.Context) error {
 	defer metrics2.FuncTimer().Stop()
 	jobs, err := s.jCache.UnfinishedJobs()
 	if err != nil {
@@ -2014,6 +2459,7 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 
 	modifiedJobs := make([]*types.Job, 0, len(jobs))
 	modifiedTasks := make(map[string]*types.Task, len(jobs))
+	newJobs := []*types.Job{}
 	for _, j := range jobs {
 		tasks, err := s.getTasksForJob(j)
 		if err != nil {
@@ -2038,13 +2484,33 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 		}
 		if !reflect.DeepEqual(summaries, j.Tasks) {
 			j.Tasks = summaries
-			j.Status = j.DeriveStatus()
+			j.Status = j.DeriveStatusWithQuarantine(func(name string) bool {
+				return s.quarantine.IsQuarantined(j.Repo, name)
+			})
 			if j.Done() {
 				j.Finished = time.Now()
+				if j.Status == types.JOB_STATUS_SUCCESS {
+					downstream, failures, err := s.makeDownstreamJobs(ctx, j, tasks)
+					if err != nil {
+						// Leave the Job unfinished, so that we
+						// try again on the next cycle.
+						sklog.Errorf("Failed to trigger downstream jobs of %s (%s); will retry: %s", j.Name, j.Id, err)
+						continue
+					}
+					if len(failures) > 0 {
+						sklog.Errorf("Failed to trigger some downstream jobs of %s (%s): %s", j.Name, j.Id, strings.Join(failures, "; "))
+						j.StatusDetails = fmt.Sprintf("Failed to trigger downstream jobs: %s", strings.Join(failures, "; "))
+					}
+					// Insert the downstream Jobs along with the
+					// upstream Job, so that we don't mark it
+					// finished without triggering them.
+					newJobs = append(newJobs, downstream...)
+				}
 			}
 			modifiedJobs = append(modifiedJobs, j)
 		}
 	}
+	modifiedJobs = append(modifiedJobs, newJobs...)
 	if len(modifiedTasks) > 0 {
 		tasks := make([]*types.Task, 0, len(modifiedTasks))
 		for _, t := range modifiedTasks {
@@ -2062,6 +2528,107 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 	return nil
 }
 
+// makeDownstreamJobs creates the Jobs which should be triggered by the success
+// of the given Job, according to the OnSuccess of its JobSpec. Downstream Jobs
+// in the same repo run at the same RepoState as the upstream Job, while those
+// in other repos run at the head of the master branch. Try jobs do not trigger
+// downstream Jobs.
+//
+// Returns an error if the downstream Jobs cannot be created right now, eg. the
+// TasksCfg of another repo could not be loaded; the caller should try again
+// later. Problems with individual DownstreamJobs which won't be fixed by
+// retrying, eg. unknown repos or Jobs, are returned as messages and don't
+// prevent the other DownstreamJobs from being triggered.
+func (s *TaskScheduler) makeDownstreamJobs(ctx context.Context, j *types.Job, tasks map[string][]*types.Task) ([]*types.Job, []string, error) {
+	if j.IsTryJob() {
+		return nil, nil, nil
+	}
+	cfg, err := s.taskCfgCache.Get(ctx, j.RepoState)
+	if err != nil {
+		return nil, nil, err
+	}
+	spec, ok := cfg.Jobs[j.Name]
+	if !ok || len(spec.OnSuccess) == 0 {
+		return nil, nil, nil
+	}
+	if j.ChainDepth+1 >= MAX_JOB_CHAIN_DEPTH {
+		return nil, []string{fmt.Sprintf("Job chain exceeds the maximum length of %d", MAX_JOB_CHAIN_DEPTH)}, nil
+	}
+	outputs := getJobOutputs(j, tasks)
+	rv := make([]*types.Job, 0, len(spec.OnSuccess))
+	var failures []string
+	for _, d := range spec.OnSuccess {
+		rs := j.RepoState.Copy()
+		if d.Repo != "" && d.Repo != j.Repo {
+			repo, ok := s.repos[d.Repo]
+			if !ok {
+				failures = append(failures, fmt.Sprintf("Unknown repo %q for downstream job %q", d.Repo, d.Job))
+				continue
+			}
+			master := repo.Get("master")
+			if master == nil {
+				failures = append(failures, fmt.Sprintf("Failed to retrieve branch 'master' for %s", d.Repo))
+				continue
+			}
+			rs = types.RepoState{
+				Repo:     d.Repo,
+				Revision: master.Hash,
+			}
+			// The head of the other repo may not have been cached yet.
+			if _, err := s.cacher.GetOrCacheRepoState(ctx, rs); err != nil {
+				if !specs.ErrorIsPermanent(err) {
+					return nil, nil, fmt.Errorf("Failed to load tasks cfg for downstream job %q in %s: %s", d.Job, d.Repo, err)
+				}
+				failures = append(failures, fmt.Sprintf("Invalid tasks cfg for downstream job %q in %s: %s", d.Job, d.Repo, err))
+				continue
+			}
+		}
+		downstream, err := s.taskCfgCache.MakeJob(ctx, rs, d.Job)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Failed to create downstream job %q: %s", d.Job, err))
+			continue
+		}
+		downstream.Requested = downstream.Created
+		downstream.ChainDepth = j.ChainDepth + 1
+		downstream.UpstreamJobId = j.Id
+		downstream.UpstreamOutputs = util.CopyStringSlice(outputs)
+		downstream.UpstreamRepo = j.Repo
+		downstream.UpstreamRevision = j.Revision
+		sklog.Infof("Triggering downstream job %s in %s for %s (%s)", d.Job, rs.Repo, j.Name, j.Id)
+		rv = append(rv, downstream)
+	}
+	return rv, failures, nil
+}
+
+// getJobOutputs returns the isolated outputs of the successful Tasks for the
+// Job's top-level TaskSpecs, ie. those upon which no other TaskSpec in the Job
+// depends.
+func getJobOutputs(j *types.Job, tasks map[string][]*types.Task) []string {
+	isDep := map[string]bool{}
+	for _, deps := range j.Dependencies {
+		for _, d := range deps {
+			isDep[d] = true
+		}
+	}
+	outputs := util.StringSet{}
+	for name := range j.Dependencies {
+		if isDep[name] {
+			continue
+		}
+		for _, t := range tasks[name] {
+			if t.Success() && t.IsolatedOutput != "" {
+				outputs[t.IsolatedOutput] = true
+			}
+		}
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+	rv := outputs.Keys()
+	sort.Strings(rv)
+	return rv
+}
+
 // getTasksForJob finds all Tasks for the given Job. It returns the Tasks
 // in a map keyed by name.
 func (s *TaskScheduler) getTasksForJob(j *types.Job) (map[string][]*types.Task, error) {
@@ -2246,30 +2813,31 @@ func (s *TaskScheduler) HandleSwarmingPubSub(msg *swarming.PubSubTaskMessage) bo
 	}
 
 	// Obtain the Swarming task data.
-	res, err := s.swarming.GetTask(msg.SwarmingTaskId, false)
+	res, err := s.taskExecutor.GetTaskResult(context.TODO(), msg.SwarmingTaskId)
 	if err != nil {
 		sklog.Errorf("pubsub: Failed to retrieve task from Swarming: %s", err)
 		return true
 	}
 	// Skip unfinished tasks.
-	if res.CompletedTs == "" {
+	if util.TimeIsZero(res.Finished) {
 		return true
 	}
 	// Update the task in the DB.
-	if _, err := db.UpdateDBFromSwarmingTask(s.db, res); err != nil {
+	if _, err := db.UpdateDBFromTaskResult(s.db, res); err != nil {
 		// TODO(borenet): Some of these cases should never be hit, after all tasks
 		// start supplying the ID in msg.UserData. We should be able to remove the logic.
+		getID := func() string {
+			if ids := res.Tags[types.SWARMING_TAG_ID]; len(ids) == 1 {
+				return ids[0]
+			}
+			return ""
+		}
 		if err == db.ErrNotFound {
-			id, err := swarming.GetTagValue(res, types.SWARMING_TAG_ID)
-			if err != nil {
+			id := getID()
+			if id == "" {
 				id = "<MISSING ID TAG>"
 			}
-			created, err := swarming.ParseTimestamp(res.CreatedTs)
-			if err != nil {
-				sklog.Errorf("Failed to parse timestamp: %s; %s", res.CreatedTs, err)
-				return true
-			}
-			if time.Now().Sub(created) < 2*time.Minute {
+			if time.Now().Sub(res.Created) < 2*time.Minute {
 				sklog.Infof("Failed to update task %q: No such task ID: %q. Less than two minutes old; try again later.", msg.SwarmingTaskId, id)
 				return false
 			}
@@ -2277,8 +2845,8 @@ func (s *TaskScheduler) HandleSwarmingPubSub(msg *swarming.PubSubTaskMessage) bo
 			return true
 		} else if err == db.ErrUnknownId {
 			expectedSwarmingTaskId := "<unknown>"
-			id, err := swarming.GetTagValue(res, types.SWARMING_TAG_ID)
-			if err != nil {
+			id := getID()
+			if id == "" {
 				id = "<MISSING ID TAG>"
 			} else {
 				t, err := s.db.GetTaskById(id)
@@ -26,17 +26,21 @@ import (
 	"go.skia.org/infra/go/git/repograph"
 	git_testutils "go.skia.org/infra/go/git/testutils"
 	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/mockhttpclient"
 	"go.skia.org/infra/go/swarming"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/testutils/unittest"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/blacklist"
+	"go.skia.org/infra/task_scheduler/go/cron_triggers"
 	"go.skia.org/infra/task_scheduler/go/db"
 	"go.skia.org/infra/task_scheduler/go/db/cache"
 	"go.skia.org/infra/task_scheduler/go/db/memory"
+	"go.skia.org/infra/task_scheduler/go/flakes"
 	"go.skia.org/infra/task_scheduler/go/isolate_cache"
 	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/swarming_executor"
 	"go.skia.org/infra/task_scheduler/go/task_cfg_cache"
 	tcc_testutils "go.skia.org/infra/task_scheduler/go/task_cfg_cache/testutils"
 	swarming_testutils "go.skia.org/infra/task_scheduler/go/testutils"
@@ -217,7 +221,7 @@ func setup(t *testing.T) (context.Context, *git_testutils.GitBuilder, *memory.In
 	require.NoError(t, err)
 	btProject, btInstance, btCleanup := tcc_testutils.SetupBigTable(t)
 	btCleanupIsolate := isolate_cache.SetupSharedBigTable(t, btProject, btInstance)
-	s, err := NewTaskScheduler(ctx, d, nil, time.Duration(math.MaxInt64), 0, tmp, "fake.server", repos, isolateClient, swarmingClient, urlMock.Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, "", depotTools, g, btProject, btInstance, nil, test_gcsclient.NewMemoryClient("diag_unit_tests"), btInstance)
+	s, err := NewTaskScheduler(ctx, d, nil, nil, nil, nil, time.Duration(math.MaxInt64), 0, tmp, "fake.server", repos, isolateClient, swarming_executor.NewSwarmingTaskExecutor(swarmingClient, isolateClient.ServerURL(), ""), urlMock.Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, depotTools, g, btProject, btInstance, nil, test_gcsclient.NewMemoryClient("diag_unit_tests"), btInstance)
 	require.NoError(t, err)
 	return ctx, gb, d, swarmingClient, s, urlMock, func() {
 		testutils.AssertCloses(t, s)
@@ -540,7 +544,7 @@ func TestFilterTaskCandidates(t *testing.T) {
 
 	// Check the initial set of task candidates. The two Build tasks
 	// should be the only ones available.
-	c, err := s.filterTaskCandidates(candidates)
+	c, err := s.filterTaskCandidates(ctx, candidates)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(c))
 	require.Equal(t, 1, len(c[gb.RepoUrl()]))
@@ -581,7 +585,7 @@ func TestFilterTaskCandidates(t *testing.T) {
 		t1.Status = status
 		require.NoError(t, s.putTask(t1))
 
-		c, err = s.filterTaskCandidates(candidates)
+		c, err = s.filterTaskCandidates(ctx, candidates)
 		require.NoError(t, err)
 		require.Equal(t, 1, len(c))
 		for _, byRepo := range c {
@@ -612,7 +616,7 @@ func TestFilterTaskCandidates(t *testing.T) {
 	t1.Status = types.TASK_STATUS_FAILURE
 	require.NoError(t, s.putTask(t1))
 
-	c, err = s.filterTaskCandidates(candidates)
+	c, err = s.filterTaskCandidates(ctx, candidates)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(c))
 	for _, byRepo := range c {
@@ -640,7 +644,7 @@ func TestFilterTaskCandidates(t *testing.T) {
 	t1.IsolatedOutput = "fake isolated hash"
 	require.NoError(t, s.putTask(t1))
 
-	c, err = s.filterTaskCandidates(candidates)
+	c, err = s.filterTaskCandidates(ctx, candidates)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(c))
 	for _, byRepo := range c {
@@ -674,7 +678,7 @@ func TestFilterTaskCandidates(t *testing.T) {
 	require.NoError(t, s.putTask(t2))
 
 	// All test and perf tasks are now candidates, no build tasks.
-	c, err = s.filterTaskCandidates(candidates)
+	c, err = s.filterTaskCandidates(ctx, candidates)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(c))
 	require.Equal(t, 2, len(c[gb.RepoUrl()][tcc_testutils.TestTaskName]))
@@ -703,7 +707,7 @@ func TestFilterTaskCandidates(t *testing.T) {
 			Dependencies: []string{tcc_testutils.BuildTaskName},
 		},
 	}
-	c, err = s.filterTaskCandidates(candidates)
+	c, err = s.filterTaskCandidates(ctx, candidates)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(c))
 	require.Equal(t, 2, len(c[gb.RepoUrl()][tcc_testutils.TestTaskName]))
@@ -1763,36 +1767,29 @@ func makeTaskCandidate(name string, dims []string) *taskCandidate {
 	}
 }
 
-func makeSwarmingBot(id string, dims []string) *swarming_api.SwarmingRpcsBotInfo {
-	d := make([]*swarming_api.SwarmingRpcsStringListPair, 0, len(dims))
-	for _, s := range dims {
-		split := strings.SplitN(s, ":", 2)
-		d = append(d, &swarming_api.SwarmingRpcsStringListPair{
-			Key:   split[0],
-			Value: []string{split[1]},
-		})
-	}
-	return &swarming_api.SwarmingRpcsBotInfo{
-		BotId:      id,
-		Dimensions: d,
+func makeMachine(id string, dims []string) *types.Machine {
+	return &types.Machine{
+		ID:         id,
+		Dimensions: dims,
 	}
 }
 
 func TestGetCandidatesToSchedule(t *testing.T) {
 	unittest.MediumTest(t)
 	// Empty lists.
-	rv := getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{})
+	rv, assignments := getCandidatesToSchedule([]*types.Machine{}, []*taskCandidate{})
+	require.Equal(t, 0, len(assignments))
 	require.Equal(t, 0, len(rv))
 
 	// checkDiags takes a list of bots with the same dimensions and a list of
 	// ordered candidates that match those bots and checks the Diagnostics for
 	// candidates.
-	checkDiags := func(bots []*swarming_api.SwarmingRpcsBotInfo, candidates []*taskCandidate) {
+	checkDiags := func(bots []*types.Machine, candidates []*taskCandidate) {
 		var expectedBots []string
 		if len(bots) > 0 {
 			expectedBots = make([]string, len(bots), len(bots))
 			for i, b := range bots {
-				expectedBots[i] = b.BotId
+				expectedBots[i] = b.ID
 			}
 		}
 		for i, c := range candidates {
@@ -1819,56 +1816,56 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	}
 
 	t1 := makeTaskCandidate("task1", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{}, []*taskCandidate{t1})
 	require.Equal(t, 0, len(rv))
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1})
+	checkDiags([]*types.Machine{}, []*taskCandidate{t1})
 
-	b1 := makeSwarmingBot("bot1", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{})
+	b1 := makeMachine("bot1", []string{"k:v"})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{})
 	require.Equal(t, 0, len(rv))
 
 	// Single match.
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{t1})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1})
+	checkDiags([]*types.Machine{b1}, []*taskCandidate{t1})
 
 	// No match.
 	t1.TaskSpec.Dimensions[0] = "k:v2"
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{t1})
 	require.Equal(t, 0, len(rv))
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1})
+	checkDiags([]*types.Machine{}, []*taskCandidate{t1})
 
 	// Add a task candidate to match b1.
 	t1 = makeTaskCandidate("task1", []string{"k:v2"})
 	t2 := makeTaskCandidate("task2", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{t1, t2})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t2}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1})
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2})
+	checkDiags([]*types.Machine{}, []*taskCandidate{t1})
+	checkDiags([]*types.Machine{b1}, []*taskCandidate{t2})
 
 	// Switch the task order.
 	t1 = makeTaskCandidate("task1", []string{"k:v2"})
 	t2 = makeTaskCandidate("task2", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{t2, t1})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t2}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1})
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2})
+	checkDiags([]*types.Machine{}, []*taskCandidate{t1})
+	checkDiags([]*types.Machine{b1}, []*taskCandidate{t2})
 
 	// Make both tasks match the bot, ensure that we pick the first one.
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{t1, t2})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1})
+	checkDiags([]*types.Machine{b1}, []*taskCandidate{t1, t2})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1}, []*taskCandidate{t2, t1})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t2}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1})
+	checkDiags([]*types.Machine{b1}, []*taskCandidate{t2, t1})
 
 	// Multiple dimensions. Ensure that different permutations of the bots
 	// and tasks lists give us the expected results.
 	dims := []string{"k:v", "k2:v2", "k3:v3"}
-	b1 = makeSwarmingBot("bot1", dims)
-	b2 := makeSwarmingBot("bot2", t1.TaskSpec.Dimensions)
+	b1 = makeMachine("bot1", dims)
+	b2 := makeMachine("bot2", t1.TaskSpec.Dimensions)
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
 	// In the first two cases, the task with fewer dimensions has the
@@ -1876,15 +1873,15 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	// is first in sorted order. The second task does not get scheduled
 	// because there is no bot available which can run it.
 	// TODO(borenet): Use a more optimal solution to avoid this case.
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1, b2}, []*taskCandidate{t1, t2})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
 	// Can't use checkDiags for these cases.
-	require.Equal(t, []string{b1.BotId, b2.BotId}, t1.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID, b2.ID}, t1.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 0, t1.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Nil(t, t1.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.True(t, t1.Diagnostics.Scheduling.Selected)
 	t1.Diagnostics = nil
-	require.Equal(t, []string{b1.BotId}, t2.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID}, t2.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 1, t2.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Equal(t, &t1.TaskKey, t2.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.False(t, t2.Diagnostics.Scheduling.Selected)
@@ -1892,14 +1889,14 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t1, t2})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b2, b1}, []*taskCandidate{t1, t2})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
-	require.Equal(t, []string{b1.BotId, b2.BotId}, t1.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID, b2.ID}, t1.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 0, t1.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Nil(t, t1.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.True(t, t1.Diagnostics.Scheduling.Selected)
 	t1.Diagnostics = nil
-	require.Equal(t, []string{b1.BotId}, t2.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID}, t2.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 1, t2.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Equal(t, &t1.TaskKey, t2.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.False(t, t2.Diagnostics.Scheduling.Selected)
@@ -1909,14 +1906,18 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	// priority. Both tasks get scheduled.
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t2, t1})
+	rv, assignments = getCandidatesToSchedule([]*types.Machine{b1, b2}, []*taskCandidate{t2, t1})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t2, t1}, rv)
-	require.Equal(t, []string{b1.BotId, b2.BotId}, t1.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, map[types.TaskKey]string{
+		t2.TaskKey: b1.ID,
+		t1.TaskKey: b2.ID,
+	}, assignments)
+	require.Equal(t, []string{b1.ID, b2.ID}, t1.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 1, t1.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Equal(t, &t2.TaskKey, t1.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.True(t, t1.Diagnostics.Scheduling.Selected)
 	t1.Diagnostics = nil
-	require.Equal(t, []string{b1.BotId}, t2.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID}, t2.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 0, t2.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Nil(t, t2.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.True(t, t2.Diagnostics.Scheduling.Selected)
@@ -1924,36 +1925,40 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t2, t1})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b2, b1}, []*taskCandidate{t2, t1})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t2, t1}, rv)
-	require.Equal(t, []string{b1.BotId, b2.BotId}, t1.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID, b2.ID}, t1.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 1, t1.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Equal(t, &t2.TaskKey, t1.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.True(t, t1.Diagnostics.Scheduling.Selected)
 	t1.Diagnostics = nil
-	require.Equal(t, []string{b1.BotId}, t2.Diagnostics.Scheduling.MatchingBots)
+	require.Equal(t, []string{b1.ID}, t2.Diagnostics.Scheduling.MatchingBots)
 	require.Equal(t, 0, t2.Diagnostics.Scheduling.NumHigherScoreSimilarCandidates)
 	require.Nil(t, t2.Diagnostics.Scheduling.LastSimilarCandidate)
 	require.True(t, t2.Diagnostics.Scheduling.Selected)
 	t2.Diagnostics = nil
 
 	// Matching dimensions. More bots than tasks.
-	b2 = makeSwarmingBot("bot2", dims)
-	b3 := makeSwarmingBot("bot3", dims)
+	b2 = makeMachine("bot2", dims)
+	b3 := makeMachine("bot3", dims)
 	t1 = makeTaskCandidate("task1", dims)
 	t2 = makeTaskCandidate("task2", dims)
 	t3 := makeTaskCandidate("task3", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2, b3}, []*taskCandidate{t1, t2})
+	rv, _ = getCandidatesToSchedule([]*types.Machine{b1, b2, b3}, []*taskCandidate{t1, t2})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1, b2, b3}, []*taskCandidate{t1, t2})
+	checkDiags([]*types.Machine{b1, b2, b3}, []*taskCandidate{t1, t2})
 
 	// More tasks than bots.
 	t1 = makeTaskCandidate("task1", dims)
 	t2 = makeTaskCandidate("task2", dims)
 	t3 = makeTaskCandidate("task3", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2, t3})
+	rv, assignments = getCandidatesToSchedule([]*types.Machine{b1, b2}, []*taskCandidate{t1, t2, t3})
 	deepequal.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
-	checkDiags([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2, t3})
+	require.Equal(t, map[types.TaskKey]string{
+		t1.TaskKey: b1.ID,
+		t2.TaskKey: b2.ID,
+	}, assignments)
+	checkDiags([]*types.Machine{b1, b2}, []*taskCandidate{t1, t2, t3})
 }
 
 func makeBot(id string, dims map[string]string) *swarming_api.SwarmingRpcsBotInfo {
@@ -2110,7 +2115,7 @@ func TestSchedulingE2E(t *testing.T) {
 		makeSwarmingRpcsTaskRequestMetadata(t, t4, linuxTaskDims),
 	}
 	swarmingClient.MockTasks(mockTasks)
-	require.NoError(t, s.updateUnfinishedTasks())
+	require.NoError(t, s.updateUnfinishedTasks(ctx))
 	runMainLoop(t, s, ctx)
 	require.NoError(t, s.tCache.Update())
 	expectLen = 1 // Test task from c1
@@ -2154,7 +2159,7 @@ func TestSchedulingE2E(t *testing.T) {
 	}
 	swarmingClient.MockTasks(mockTasks)
 	swarmingClient.MockBots([]*swarming_api.SwarmingRpcsBotInfo{bot1, bot2, bot3, bot4})
-	require.NoError(t, s.updateUnfinishedTasks())
+	require.NoError(t, s.updateUnfinishedTasks(ctx))
 	runMainLoop(t, s, ctx)
 	require.Equal(t, 0, len(s.queue))
 }
@@ -2375,7 +2380,7 @@ func testMultipleCandidatesBackfillingEachOtherSetup(t *testing.T) (context.Cont
 
 	btProject, btInstance, btCleanup := tcc_testutils.SetupBigTable(t)
 	btCleanupIsolate := isolate_cache.SetupSharedBigTable(t, btProject, btInstance)
-	s, err := NewTaskScheduler(ctx, d, nil, time.Duration(math.MaxInt64), 0, workdir, "fake.server", repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, "", depotTools, g, btProject, btInstance, nil, test_gcsclient.NewMemoryClient("diag_unit_tests"), btInstance)
+	s, err := NewTaskScheduler(ctx, d, nil, nil, nil, nil, time.Duration(math.MaxInt64), 0, workdir, "fake.server", repos, isolateClient, swarming_executor.NewSwarmingTaskExecutor(swarmingClient, isolateClient.ServerURL(), ""), mockhttpclient.NewURLMock().Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, depotTools, g, btProject, btInstance, nil, test_gcsclient.NewMemoryClient("diag_unit_tests"), btInstance)
 	require.NoError(t, err)
 
 	mockTasks := []*swarming_api.SwarmingRpcsTaskRequestMetadata{}
@@ -3034,8 +3039,452 @@ func TestPeriodicJobs(t *testing.T) {
 	require.Equal(t, weeklyName, jobs[weeklyName][0].Name)
 }
 
+func TestCronJobs(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+	firings := cron_triggers.NewInMemoryDB()
+	s.cronFirings = firings
+
+	// Rewrite tasks.json with a cron job.
+	jobName := "Cron-Job"
+	taskName := "Cron-Task"
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			jobName: {
+				Cron: &specs.CronTrigger{
+					Schedule: "0 3 * * *",
+				},
+				Priority:  1.0,
+				TaskSpecs: []string{taskName},
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			taskName: {
+				CipdPackages: []*specs.CipdPackage{},
+				Dependencies: []string{},
+				Dimensions: []string{
+					"pool:Skia",
+					"os:Mac",
+					"gpu:my-gpu",
+				},
+				ExecutionTimeout: 40 * time.Minute,
+				Expiration:       2 * time.Hour,
+				IoTimeout:        3 * time.Minute,
+				Isolate:          "compile_skia.isolate",
+				Priority:         1.0,
+			},
+		},
+	}
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	gb.Commit(ctx)
+	updateRepos(t, ctx, s)
+	runMainLoop(t, s, ctx)
+
+	// The cron job isn't triggered for the new commit.
+	start := time.Now().Add(-10 * time.Minute)
+	end := time.Now().Add(10 * time.Minute)
+	getJobs := func() []*types.Job {
+		require.NoError(t, s.jCache.Update())
+		jobs, err := s.jCache.GetMatchingJobsFromDateRange([]string{jobName}, start, end)
+		require.NoError(t, err)
+		return jobs[jobName]
+	}
+	require.Equal(t, 0, len(getJobs()))
+
+	// The first evaluation records a skipped firing.
+	day := time.Date(2019, time.October, 24, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, s.triggerCronJobs(ctx, day.Add(10*time.Hour)))
+	require.Equal(t, 0, len(getJobs()))
+	f, err := firings.GetLastFiring(gb.RepoUrl(), jobName)
+	require.NoError(t, err)
+	require.True(t, f.Skipped)
+	require.Equal(t, day.Add(3*time.Hour), f.Scheduled)
+
+	// Not due yet.
+	require.NoError(t, s.triggerCronJobs(ctx, day.Add(26*time.Hour)))
+	require.Equal(t, 0, len(getJobs()))
+
+	// Due.
+	require.NoError(t, s.triggerCronJobs(ctx, day.Add(27*time.Hour+time.Minute)))
+	jobs := getJobs()
+	require.Equal(t, 1, len(jobs))
+	f, err = firings.GetLastFiring(gb.RepoUrl(), jobName)
+	require.NoError(t, err)
+	require.False(t, f.Skipped)
+	require.Equal(t, jobs[0].Id, f.JobId)
+
+	// Don't trigger again.
+	require.NoError(t, s.triggerCronJobs(ctx, day.Add(27*time.Hour+2*time.Minute)))
+	require.Equal(t, 1, len(getJobs()))
+
+	// Missed firings are skipped.
+	require.NoError(t, s.triggerCronJobs(ctx, day.Add(80*time.Hour)))
+	require.Equal(t, 1, len(getJobs()))
+	f, err = firings.GetLastFiring(gb.RepoUrl(), jobName)
+	require.NoError(t, err)
+	require.True(t, f.Skipped)
+	require.Equal(t, 1, f.Missed)
+}
+
+func TestGatherNewJobsPathFilters(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// Rewrite tasks.json with Jobs which only run for some files.
+	srcJob := "Src-Job"
+	notDocsJob := "NotDocs-Job"
+	taskName := "Build-Task"
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			srcJob: {
+				IncludePaths: []string{"src/**"},
+				Priority:     1.0,
+				TaskSpecs:    []string{taskName},
+			},
+			notDocsJob: {
+				ExcludePaths: []string{"docs/**"},
+				Priority:     1.0,
+				TaskSpecs:    []string{taskName},
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			taskName: {
+				CipdPackages: []*specs.CipdPackage{},
+				Dependencies: []string{},
+				Dimensions:   []string{"pool:Skia", "os:Ubuntu"},
+				Isolate:      "compile_skia.isolate",
+				Priority:     1.0,
+			},
+		},
+	}
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	cfgCommit := gb.Commit(ctx)
+	gb.Add(ctx, "src/foo.cc", "int main() {}")
+	srcCommit := gb.Commit(ctx)
+	gb.Add(ctx, "docs/README.md", "docs")
+	docsCommit := gb.Commit(ctx)
+	updateRepos(t, ctx, s)
+
+	start := time.Now().Add(-10 * time.Minute)
+	end := time.Now().Add(10 * time.Minute)
+	require.NoError(t, s.jCache.Update())
+	jobs, err := s.jCache.GetMatchingJobsFromDateRange([]string{srcJob, notDocsJob}, start, end)
+	require.NoError(t, err)
+	check := func(name, revision string, skipped bool) {
+		var job *types.Job
+		for _, j := range jobs[name] {
+			if j.Revision == revision {
+				require.Nil(t, job, "Multiple %s jobs at %s", name, revision)
+				job = j
+			}
+		}
+		require.NotNil(t, job, "No %s job at %s", name, revision)
+		if skipped {
+			require.Equal(t, types.JOB_STATUS_SKIPPED, job.Status)
+			require.NotEqual(t, "", job.StatusDetails)
+			require.True(t, job.Done())
+		} else {
+			require.Equal(t, types.JOB_STATUS_IN_PROGRESS, job.Status)
+		}
+	}
+
+	// The commit which changed only tasks.json matches neither
+	// include_paths nor exclude_paths.
+	check(srcJob, cfgCommit, true)
+	check(notDocsJob, cfgCommit, false)
+	// The commit which changed src matches include_paths.
+	check(srcJob, srcCommit, false)
+	check(notDocsJob, srcCommit, false)
+	// The commit which changed docs matches exclude_paths and not
+	// include_paths.
+	check(srcJob, docsCommit, true)
+	check(notDocsJob, docsCommit, true)
+
+	// Skipped Jobs aren't scheduled again.
+	updateRepos(t, ctx, s)
+	require.NoError(t, s.jCache.Update())
+	jobs, err = s.jCache.GetMatchingJobsFromDateRange([]string{srcJob, notDocsJob}, start, end)
+	require.NoError(t, err)
+	check(srcJob, docsCommit, true)
+	check(notDocsJob, docsCommit, true)
+}
+
+func TestDownstreamJobs(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// Rewrite tasks.json with a chain of jobs.
+	buildJob := "Build-Job"
+	deployJob := "Deploy-Job"
+	buildTask := "Build-Task"
+	deployTask := "Deploy-Task"
+	makeTaskSpec := func() *specs.TaskSpec {
+		return &specs.TaskSpec{
+			CipdPackages: []*specs.CipdPackage{},
+			Dependencies: []string{},
+			Dimensions:   []string{"pool:Skia", "os:Ubuntu"},
+			Isolate:      "compile_skia.isolate",
+			Priority:     1.0,
+		}
+	}
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			buildJob: {
+				OnSuccess: []*specs.DownstreamJob{{Job: deployJob}},
+				Priority:  1.0,
+				TaskSpecs: []string{buildTask},
+			},
+			deployJob: {
+				Priority:  1.0,
+				TaskSpecs: []string{deployTask},
+				Trigger:   specs.TRIGGER_ON_DEMAND,
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			buildTask:  makeTaskSpec(),
+			deployTask: makeTaskSpec(),
+		},
+	}
+	cfg.Tasks[deployTask].Command = []string{"deploy", specs.PLACEHOLDER_UPSTREAM_JOB_ID}
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	gb.Commit(ctx)
+	updateRepos(t, ctx, s)
+
+	start := time.Now().Add(-10 * time.Minute)
+	end := time.Now().Add(10 * time.Minute)
+	getJobs := func(name string) []*types.Job {
+		require.NoError(t, s.jCache.Update())
+		jobs, err := s.jCache.GetMatchingJobsFromDateRange([]string{name}, start, end)
+		require.NoError(t, err)
+		return jobs[name]
+	}
+	builds := getJobs(buildJob)
+	require.Equal(t, 1, len(builds))
+	build := builds[0]
+	require.Equal(t, 0, len(getJobs(deployJob)))
+
+	// The build succeeds, which triggers the deploy job.
+	task := makeTask(buildTask, build.Repo, build.Revision)
+	task.Status = types.TASK_STATUS_SUCCESS
+	task.IsolatedOutput = "build-output"
+	require.NoError(t, s.putTask(task))
+	require.NoError(t, s.tCache.Update())
+	require.NoError(t, s.updateUnfinishedJobs(ctx))
+	deploys := getJobs(deployJob)
+	require.Equal(t, 1, len(deploys))
+	deploy := deploys[0]
+	require.Equal(t, build.RepoState, deploy.RepoState)
+	require.Equal(t, 1, deploy.ChainDepth)
+	require.Equal(t, build.Id, deploy.UpstreamJobId)
+	require.Equal(t, []string{"build-output"}, deploy.UpstreamOutputs)
+	require.Equal(t, build.Repo, deploy.UpstreamRepo)
+	require.Equal(t, build.Revision, deploy.UpstreamRevision)
+	require.Equal(t, types.TRIGGER_TYPE_UPSTREAM, s.getJobTriggerType(ctx, deploy))
+
+	// The deploy job's task receives the build outputs.
+	preFilter, err := s.findTaskCandidatesForJobs(ctx, []*types.Job{deploy})
+	require.NoError(t, err)
+	filtered, err := s.filterTaskCandidates(ctx, preFilter)
+	require.NoError(t, err)
+	candidates := filtered[deploy.Repo][deployTask]
+	require.Equal(t, 1, len(candidates))
+	c := candidates[0]
+	require.Equal(t, deploy.Id, c.ForcedJobId)
+	require.Equal(t, []string{"build-output"}, c.IsolatedHashes)
+	require.Equal(t, types.TRIGGER_TYPE_UPSTREAM, s.getTriggerType(ctx, c.TaskKey, c.Jobs))
+	req, err := c.MakeTaskRequest("fake-task-id")
+	require.NoError(t, err)
+	require.Equal(t, []string{"deploy", build.Id}, req.Command)
+
+	// The build job is finished, so the deploy job isn't triggered again.
+	require.NoError(t, s.updateUnfinishedJobs(ctx))
+	require.Equal(t, 1, len(getJobs(deployJob)))
+}
+
+func TestDownstreamJobsFailures(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// One of the DownstreamJobs is invalid; the other should still be
+	// triggered.
+	buildJob := "Build-Job"
+	deployJob := "Deploy-Job"
+	buildTask := "Build-Task"
+	deployTask := "Deploy-Task"
+	makeTaskSpec := func() *specs.TaskSpec {
+		return &specs.TaskSpec{
+			CipdPackages: []*specs.CipdPackage{},
+			Dependencies: []string{},
+			Dimensions:   []string{"pool:Skia", "os:Ubuntu"},
+			Isolate:      "compile_skia.isolate",
+			Priority:     1.0,
+		}
+	}
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			buildJob: {
+				OnSuccess: []*specs.DownstreamJob{
+					{Job: deployJob, Repo: "https://unknown.repo.git"},
+					{Job: deployJob},
+				},
+				Priority:  1.0,
+				TaskSpecs: []string{buildTask},
+			},
+			deployJob: {
+				Priority:  1.0,
+				TaskSpecs: []string{deployTask},
+				Trigger:   specs.TRIGGER_ON_DEMAND,
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			buildTask:  makeTaskSpec(),
+			deployTask: makeTaskSpec(),
+		},
+	}
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	gb.Commit(ctx)
+	updateRepos(t, ctx, s)
+
+	start := time.Now().Add(-10 * time.Minute)
+	end := time.Now().Add(10 * time.Minute)
+	getJobs := func(name string) []*types.Job {
+		require.NoError(t, s.jCache.Update())
+		jobs, err := s.jCache.GetMatchingJobsFromDateRange([]string{name}, start, end)
+		require.NoError(t, err)
+		return jobs[name]
+	}
+	builds := getJobs(buildJob)
+	require.Equal(t, 1, len(builds))
+	build := builds[0]
+
+	task := makeTask(buildTask, build.Repo, build.Revision)
+	task.Status = types.TASK_STATUS_SUCCESS
+	require.NoError(t, s.putTask(task))
+	require.NoError(t, s.tCache.Update())
+	require.NoError(t, s.updateUnfinishedJobs(ctx))
+
+	// The valid downstream job was triggered, and the failures were
+	// recorded on the upstream job, which is finished.
+	require.Equal(t, 1, len(getJobs(deployJob)))
+	build, err := s.jCache.GetJob(build.Id)
+	require.NoError(t, err)
+	require.True(t, build.Done())
+	require.Equal(t, types.JOB_STATUS_SUCCESS, build.Status)
+	require.Equal(t, "Failed to trigger downstream jobs: Unknown repo \"https://unknown.repo.git\" for downstream job \"Deploy-Job\"", build.StatusDetails)
+}
+
+func TestMakeDownstreamJobsChainDepth(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// A Job at the maximum chain depth doesn't trigger anything else.
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			"Build-Job": {
+				OnSuccess: []*specs.DownstreamJob{{Job: "Deploy-Job"}},
+				Priority:  1.0,
+				TaskSpecs: []string{"Build-Task"},
+			},
+			"Deploy-Job": {
+				Priority:  1.0,
+				TaskSpecs: []string{"Build-Task"},
+				Trigger:   specs.TRIGGER_ON_DEMAND,
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			"Build-Task": {
+				CipdPackages: []*specs.CipdPackage{},
+				Dependencies: []string{},
+				Dimensions:   []string{"pool:Skia", "os:Ubuntu"},
+				Isolate:      "compile_skia.isolate",
+				Priority:     1.0,
+			},
+		},
+	}
+	gb.Add(ctx, specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	c := gb.Commit(ctx)
+	updateRepos(t, ctx, s)
+
+	j, err := s.taskCfgCache.MakeJob(ctx, types.RepoState{Repo: gb.RepoUrl(), Revision: c}, "Build-Job")
+	require.NoError(t, err)
+	j.ChainDepth = MAX_JOB_CHAIN_DEPTH - 2
+	downstream, failures, err := s.makeDownstreamJobs(ctx, j, nil)
+	require.NoError(t, err)
+	require.Empty(t, failures)
+	require.Equal(t, 1, len(downstream))
+
+	j.ChainDepth = MAX_JOB_CHAIN_DEPTH - 1
+	downstream, failures, err = s.makeDownstreamJobs(ctx, j, nil)
+	require.NoError(t, err)
+	require.Empty(t, downstream)
+	require.Equal(t, []string{fmt.Sprintf("Job chain exceeds the maximum length of %d", MAX_JOB_CHAIN_DEPTH)}, failures)
+}
+
+// countingTaskCfgProvider counts the calls to Get.
+type countingTaskCfgProvider struct {
+	simTaskCfgProvider
+	gets int
+}
+
+func (p *countingTaskCfgProvider) Get(ctx context.Context, rs types.RepoState) (*specs.TasksCfg, error) {
+	p.gets++
+	return p.simTaskCfgProvider.Get(ctx, rs)
+}
+
+func TestGetJobTriggerTypeCached(t *testing.T) {
+	unittest.SmallTest(t)
+
+	tcc := &countingTaskCfgProvider{}
+	s := &TaskScheduler{taskCfgCache: tcc}
+	ctx := context.Background()
+	now := time.Now()
+	j1 := &types.Job{Id: "j1", Name: "Job", Created: now.Add(-time.Hour)}
+	j2 := &types.Job{Id: "j2", Name: "Job", Created: now}
+
+	// The TasksCfg is only loaded once per Job.
+	for i := 0; i < 3; i++ {
+		require.Equal(t, types.TRIGGER_TYPE_COMMIT, s.getJobTriggerType(ctx, j1))
+		require.Equal(t, types.TRIGGER_TYPE_COMMIT, s.getJobTriggerType(ctx, j2))
+	}
+	require.Equal(t, 2, tcc.gets)
+
+	// Jobs which are outside of the window are removed from the cache.
+	s.cleanupJobTriggers(now.Add(-time.Minute))
+	require.Equal(t, types.TRIGGER_TYPE_COMMIT, s.getJobTriggerType(ctx, j2))
+	require.Equal(t, 2, tcc.gets)
+	require.Equal(t, types.TRIGGER_TYPE_COMMIT, s.getJobTriggerType(ctx, j1))
+	require.Equal(t, 3, tcc.gets)
+}
+
+func TestGetJobOutputs(t *testing.T) {
+	unittest.SmallTest(t)
+	j := &types.Job{
+		Dependencies: map[string][]string{
+			"Build": {},
+			"Test":  {"Build"},
+			"Perf":  {"Build"},
+		},
+	}
+	makeTask := func(output string, status types.TaskStatus) *types.Task {
+		return &types.Task{
+			IsolatedOutput: output,
+			Status:         status,
+		}
+	}
+	tasks := map[string][]*types.Task{
+		"Build": {makeTask("build", types.TASK_STATUS_SUCCESS)},
+		"Test": {
+			makeTask("test-failed", types.TASK_STATUS_FAILURE),
+			makeTask("test", types.TASK_STATUS_SUCCESS),
+		},
+		"Perf": {makeTask("perf", types.TASK_STATUS_SUCCESS)},
+	}
+	require.Equal(t, []string{"perf", "test"}, getJobOutputs(j, tasks))
+	require.Nil(t, getJobOutputs(j, map[string][]*types.Task{}))
+}
+
 func TestUpdateUnfinishedTasks(t *testing.T) {
-	_, _, _, swarmingClient, s, _, cleanup := setup(t)
+	ctx, _, _, swarmingClient, s, _, cleanup := setup(t)
 	defer cleanup()
 
 	// Create a few tasks.
@@ -3085,7 +3534,7 @@ func TestUpdateUnfinishedTasks(t *testing.T) {
 	deepequal.AssertDeepEqual(t, []*swarming_api.SwarmingRpcsTaskRequestMetadata{m1, m2}, got)
 
 	// Ensure that we update the tasks as expected.
-	require.NoError(t, s.updateUnfinishedTasks())
+	require.NoError(t, s.updateUnfinishedTasks(ctx))
 	for _, task := range tasks {
 		got, err := s.db.GetTaskById(task.Id)
 		require.NoError(t, err)
@@ -3803,3 +4252,165 @@ func TestTriggerTaskDeduped(t *testing.T) {
 	require.Equal(t, types.TASK_STATUS_SUCCESS, t2.Status)
 	require.Equal(t, types.TASK_STATUS_PENDING, t3.Status)
 }
+
+func TestReuseTaskResult(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Unix(1572000000, 0).UTC()
+	prev := types.MakeTestTask(now.Add(-time.Hour), []string{"a"})
+	prev.Id = "prev"
+	prev.IsolatedOutput = "outputs"
+	prev.Started = now.Add(-50 * time.Minute)
+	prev.Finished = now.Add(-40 * time.Minute)
+	prev.Status = types.TASK_STATUS_SUCCESS
+	prev.SwarmingBotId = "bot1"
+
+	task := &types.Task{
+		Commits: []string{"b"},
+		TaskKey: prev.TaskKey.Copy(),
+	}
+	task.Revision = "b"
+	reuseTaskResult(task, prev, now)
+	require.Equal(t, &types.Task{
+		Commits:        []string{"b"},
+		Created:        now,
+		Finished:       now,
+		IsolatedOutput: "outputs",
+		ReusedFrom:     "prev",
+		Started:        now,
+		Status:         types.TASK_STATUS_SUCCESS,
+		TaskKey:        task.TaskKey,
+	}, task)
+	require.NoError(t, task.Validate())
+
+	// Chains of reused results point to the task which actually ran.
+	task.Id = "reused"
+	next := &types.Task{
+		TaskKey: task.TaskKey.Copy(),
+	}
+	reuseTaskResult(next, task, now.Add(time.Minute))
+	require.Equal(t, "prev", next.ReusedFrom)
+}
+
+func TestIsSuspectedFlake(t *testing.T) {
+	unittest.SmallTest(t)
+
+	s := &TaskScheduler{}
+	require.False(t, s.isSuspectedFlake("fake.git", "Test"))
+	s.flakeRates = map[string]map[string]*flakes.FlakeRate{
+		"fake.git": {
+			// Flaky often enough.
+			"Test-Flaky": {Flaky: 2, Total: FLAKE_RATE_MIN_TASKS},
+			// Not flaky often enough.
+			"Test-Stable": {Flaky: 0, Total: FLAKE_RATE_MIN_TASKS},
+			// Not enough tasks to tell.
+			"Test-Rare": {Flaky: 1, Total: FLAKE_RATE_MIN_TASKS - 1},
+		},
+	}
+	require.True(t, s.isSuspectedFlake("fake.git", "Test-Flaky"))
+	require.False(t, s.isSuspectedFlake("fake.git", "Test-Stable"))
+	require.False(t, s.isSuspectedFlake("fake.git", "Test-Rare"))
+	require.False(t, s.isSuspectedFlake("other.git", "Test-Flaky"))
+}
+
+func TestUpdateFlakeRates(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	now := time.Now()
+	d := memory.NewInMemoryDB()
+	tasks := []*types.Task{}
+	addTasks := func(name string, n int, status types.TaskStatus) {
+		for i := 0; i < n; i++ {
+			task := makeTask(name, "fake.git", fmt.Sprintf("abc%d", i))
+			task.Created = now.Add(-time.Hour)
+			task.Status = status
+			tasks = append(tasks, task)
+		}
+	}
+	addTasks("Test-Flaky", FLAKE_RATE_MIN_TASKS-2, types.TASK_STATUS_SUCCESS)
+	addTasks("Test-Flaky", 2, types.TASK_STATUS_MISHAP)
+	addTasks("Test-Stable", FLAKE_RATE_MIN_TASKS, types.TASK_STATUS_SUCCESS)
+	addTasks("Test-Rare", 1, types.TASK_STATUS_MISHAP)
+	require.NoError(t, d.PutTasks(tasks))
+
+	w, err := window.New(FLAKE_RATE_WINDOW, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.UpdateWithTime(now))
+	tCache, err := cache.NewTaskCache(ctx, d, w, nil)
+	require.NoError(t, err)
+	s := &TaskScheduler{
+		flakeRateMetrics: map[string]metrics2.Float64Metric{},
+		tCache:           tCache,
+	}
+
+	s.updateFlakeRates(now)
+	require.True(t, s.isSuspectedFlake("fake.git", "Test-Flaky"))
+	require.False(t, s.isSuspectedFlake("fake.git", "Test-Stable"))
+	require.False(t, s.isSuspectedFlake("fake.git", "Test-Rare"))
+
+	// Only TaskSpecs with enough tasks are reported.
+	require.Len(t, s.flakeRateMetrics, 2)
+	flakyMetric := s.flakeRateMetrics["fake.git|Test-Flaky"]
+	require.Equal(t, 0.2, flakyMetric.Get())
+	require.Equal(t, 0.0, s.flakeRateMetrics["fake.git|Test-Stable"].Get())
+
+	// Once the tasks fall out of the window, the metrics are reset and
+	// removed.
+	s.updateFlakeRates(now.Add(2 * FLAKE_RATE_WINDOW))
+	require.False(t, s.isSuspectedFlake("fake.git", "Test-Flaky"))
+	require.Len(t, s.flakeRateMetrics, 0)
+	require.Equal(t, 0.0, flakyMetric.Get())
+}
+
+func TestFilterTaskCandidatesSuspectedFlake(t *testing.T) {
+	ctx, gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	rs1 := getRS1(t, ctx, gb)
+	k := types.TaskKey{
+		RepoState: rs1,
+		Name:      tcc_testutils.BuildTaskName,
+	}
+	s.flakeRates = map[string]map[string]*flakes.FlakeRate{
+		gb.RepoUrl(): {
+			tcc_testutils.BuildTaskName: {Flaky: FLAKE_RATE_MIN_TASKS, Total: FLAKE_RATE_MIN_TASKS},
+		},
+	}
+
+	// The last of the default attempts failed. Since the TaskSpec is a
+	// suspected flake, it gets an extra attempt.
+	prev := makeTask(k.Name, k.Repo, k.Revision)
+	prev.Attempt = 1
+	prev.RetryOf = "first-attempt"
+	prev.Status = types.TASK_STATUS_FAILURE
+	require.NoError(t, s.putTask(prev))
+	candidate := &taskCandidate{
+		TaskKey:  k,
+		TaskSpec: &specs.TaskSpec{},
+	}
+	c, err := s.filterTaskCandidates(ctx, map[types.TaskKey]*taskCandidate{k: candidate})
+	require.NoError(t, err)
+	require.Len(t, c[k.Repo][k.Name], 1)
+	require.Equal(t, 2, candidate.Attempt)
+	require.Equal(t, prev.Id, candidate.RetryOf)
+	require.Equal(t, specs.DEFAULT_TASK_SPEC_MAX_ATTEMPTS+FLAKE_EXTRA_ATTEMPTS, candidate.TaskSpec.MaxAttempts)
+
+	// TaskSpecs which disallow retries don't get extra attempts, even if
+	// they're suspected flakes.
+	first := prev
+	prev = makeTask(k.Name, k.Repo, k.Revision)
+	prev.MaxAttempts = 1
+	prev.Status = types.TASK_STATUS_FAILURE
+	require.NoError(t, s.putTask(prev))
+	candidate = &taskCandidate{
+		TaskKey: k,
+		TaskSpec: &specs.TaskSpec{
+			MaxAttempts: 1,
+		},
+	}
+	c, err = s.filterTaskCandidates(ctx, map[types.TaskKey]*taskCandidate{k: candidate})
+	require.NoError(t, err)
+	require.Len(t, c, 0)
+	require.Equal(t, []string{first.Id, prev.Id}, candidate.Diagnostics.Filtering.PreviousAttempts)
+}
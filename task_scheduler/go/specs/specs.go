@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"go.skia.org/infra/go/cipd"
+	"go.skia.org/infra/go/cron"
 	"go.skia.org/infra/go/periodic"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/types"
@@ -56,6 +57,9 @@ const (
 	VARIABLE_REVISION             = "REVISION"
 	VARIABLE_TASK_ID              = "TASK_ID"
 	VARIABLE_TASK_NAME            = "TASK_NAME"
+	VARIABLE_UPSTREAM_JOB_ID      = "UPSTREAM_JOB_ID"
+	VARIABLE_UPSTREAM_REPO        = "UPSTREAM_REPO"
+	VARIABLE_UPSTREAM_REVISION    = "UPSTREAM_REVISION"
 )
 
 var (
@@ -88,6 +92,9 @@ var (
 	PLACEHOLDER_REVISION             = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_REVISION)
 	PLACEHOLDER_TASK_ID              = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_TASK_ID)
 	PLACEHOLDER_TASK_NAME            = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_TASK_NAME)
+	PLACEHOLDER_UPSTREAM_JOB_ID      = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_UPSTREAM_JOB_ID)
+	PLACEHOLDER_UPSTREAM_REPO        = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_UPSTREAM_REPO)
+	PLACEHOLDER_UPSTREAM_REVISION    = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_UPSTREAM_REVISION)
 	PLACEHOLDER_ISOLATED_OUTDIR      = "${ISOLATED_OUTDIR}"
 
 	PERIODIC_TRIGGERS = []string{TRIGGER_NIGHTLY, TRIGGER_WEEKLY}
@@ -183,11 +190,20 @@ func (c *TasksCfg) Validate() error {
 			return fmt.Errorf("Invalid TasksCfg: %s", err)
 		}
 	}
+	for name, j := range c.Jobs {
+		if err := j.Validate(); err != nil {
+			return fmt.Errorf("Invalid TasksCfg: Job %q: %s", name, err)
+		}
+	}
 
 	if err := findCycles(c.Tasks, c.Jobs); err != nil {
 		return fmt.Errorf("Invalid TasksCfg: %s", err)
 	}
 
+	if err := findJobChainCycles(c.Jobs); err != nil {
+		return fmt.Errorf("Invalid TasksCfg: %s", err)
+	}
+
 	return nil
 }
 
@@ -356,9 +372,95 @@ type Cache struct {
 // type here?
 type CipdPackage = cipd.Package
 
+// CronTrigger indicates that a Job should be triggered at the head of the
+// master branch on a schedule.
+type CronTrigger struct {
+	// CatchUp indicates what happens to firings which were missed, eg.
+	// because the Task Scheduler was down. If true, a single Job is
+	// triggered as soon as possible to cover them. Otherwise, they are
+	// recorded as skipped.
+	CatchUp bool `json:"catch_up,omitempty"`
+	// Schedule is a cron expression, eg. "0 3 * * 1-5" for 3 AM on
+	// weekdays. See go.skia.org/infra/go/cron for the supported syntax.
+	Schedule string `json:"schedule"`
+	// Timezone is the IANA name of the timezone in which the Schedule is
+	// evaluated, eg. "America/New_York". Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// DownstreamJob indicates a Job which should be triggered when another Job
+// succeeds.
+type DownstreamJob struct {
+	// Job is the name of the JobSpec to trigger.
+	Job string `json:"job"`
+	// Repo is the URL of the repo containing the JobSpec. If empty, the
+	// JobSpec is in the same repo as the upstream Job and is triggered at
+	// the same RepoState. Otherwise, it is triggered at the head of the
+	// master branch of Repo.
+	Repo string `json:"repo,omitempty"`
+}
+
+// Copy returns a copy of the DownstreamJob.
+func (d *DownstreamJob) Copy() *DownstreamJob {
+	return &DownstreamJob{
+		Job:  d.Job,
+		Repo: d.Repo,
+	}
+}
+
+// Copy returns a copy of the CronTrigger.
+func (c *CronTrigger) Copy() *CronTrigger {
+	if c == nil {
+		return nil
+	}
+	return &CronTrigger{
+		CatchUp:  c.CatchUp,
+		Schedule: c.Schedule,
+		Timezone: c.Timezone,
+	}
+}
+
+// Parse returns the parsed Schedule and the Location in which it should be
+// evaluated.
+func (c *CronTrigger) Parse() (*cron.Schedule, *time.Location, error) {
+	sched, err := cron.Parse(c.Schedule)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.UTC
+	if c.Timezone != "" {
+		loc, err = time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid timezone %q: %s", c.Timezone, err)
+		}
+	}
+	return sched, loc, nil
+}
+
 // JobSpec is a struct which describes a set of TaskSpecs to run as part of a
 // larger effort.
 type JobSpec struct {
+	// Cron indicates that the Job should be triggered on a schedule,
+	// rather than for each commit. Mutually exclusive with Trigger.
+	Cron *CronTrigger `json:"cron,omitempty"`
+	// ExcludePaths are glob patterns, relative to the root of the repo,
+	// for files which should be ignored when deciding whether to run the
+	// Job; if all of the files changed by a commit or patch match one of
+	// these patterns, the Job is skipped. "**" matches any number of
+	// directories, eg. "site/**".
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+	// OnSuccess lists Jobs which should be triggered when a Job for this
+	// JobSpec succeeds, eg. to run "test" after "build" and "deploy" after
+	// "test". Downstream Jobs may be in other repos. Tasks of downstream
+	// Jobs receive the isolated outputs of the upstream Job's tasks as
+	// inputs and may refer to the upstream Job using the UPSTREAM_*
+	// variables. Try jobs do not trigger downstream Jobs.
+	OnSuccess []*DownstreamJob `json:"on_success,omitempty"`
+	// IncludePaths are glob patterns, relative to the root of the repo,
+	// for files which must be changed by a commit or patch in order for
+	// the Job to run, eg. "src/gpu/**". If unspecified, any change which
+	// is not excluded by ExcludePaths causes the Job to run.
+	IncludePaths []string `json:"include_paths,omitempty"`
 	// Priority indicates the relative priority of the job, with 0 < p <= 1,
 	// where higher values result in scheduling the job's tasks sooner. If
 	// unspecified or outside this range, DEFAULT_JOB_SPEC_PRIORITY is used.
@@ -385,11 +487,134 @@ func (j *JobSpec) Copy() *JobSpec {
 		taskSpecs = make([]string, len(j.TaskSpecs))
 		copy(taskSpecs, j.TaskSpecs)
 	}
+	var onSuccess []*DownstreamJob
+	if j.OnSuccess != nil {
+		onSuccess = make([]*DownstreamJob, 0, len(j.OnSuccess))
+		for _, d := range j.OnSuccess {
+			onSuccess = append(onSuccess, d.Copy())
+		}
+	}
 	return &JobSpec{
-		Priority:  j.Priority,
-		TaskSpecs: taskSpecs,
-		Trigger:   j.Trigger,
+		Cron:         j.Cron.Copy(),
+		ExcludePaths: util.CopyStringSlice(j.ExcludePaths),
+		IncludePaths: util.CopyStringSlice(j.IncludePaths),
+		OnSuccess:    onSuccess,
+		Priority:     j.Priority,
+		TaskSpecs:    taskSpecs,
+		Trigger:      j.Trigger,
+	}
+}
+
+// Validate returns an error if the JobSpec is not valid.
+func (j *JobSpec) Validate() error {
+	for _, patterns := range [][]string{j.IncludePaths, j.ExcludePaths} {
+		for _, pattern := range patterns {
+			if _, err := matchPath(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid path pattern %q: %s", pattern, err)
+			}
+		}
+	}
+	if j.Cron != nil {
+		if j.Trigger != TRIGGER_ANY_BRANCH {
+			return fmt.Errorf("Jobs with a cron schedule may not also specify trigger %q", j.Trigger)
+		}
+		if _, _, err := j.Cron.Parse(); err != nil {
+			return fmt.Errorf("Invalid cron schedule: %s", err)
+		}
 	}
+	for _, d := range j.OnSuccess {
+		if d.Job == "" {
+			return fmt.Errorf("on_success entries must specify a job")
+		}
+	}
+	return nil
+}
+
+// IsPeriodic returns true iff the Job is triggered periodically, either via
+// one of the PERIODIC_TRIGGERS or a cron schedule, rather than for each
+// commit.
+func (j *JobSpec) IsPeriodic() bool {
+	return j.Cron != nil || util.In(j.Trigger, PERIODIC_TRIGGERS)
+}
+
+// HasPathFilters returns true iff the JobSpec restricts the files for which
+// it should run via IncludePaths or ExcludePaths.
+func (j *JobSpec) HasPathFilters() bool {
+	return len(j.IncludePaths) > 0 || len(j.ExcludePaths) > 0
+}
+
+// PathFilterSkipReason returns a human-readable reason why the JobSpec should
+// not run for a commit or patch which changed the given files, or the empty
+// string if it should run.
+func (j *JobSpec) PathFilterSkipReason(changedFiles []string) string {
+	if !j.HasPathFilters() {
+		return ""
+	}
+	included := 0
+	for _, f := range changedFiles {
+		if matchAnyPath(j.ExcludePaths, f) {
+			continue
+		}
+		if len(j.IncludePaths) == 0 || matchAnyPath(j.IncludePaths, f) {
+			included++
+		}
+	}
+	if included > 0 {
+		return ""
+	}
+	if len(j.IncludePaths) == 0 {
+		return fmt.Sprintf("All changed files match exclude_paths %v", j.ExcludePaths)
+	}
+	if len(j.ExcludePaths) == 0 {
+		return fmt.Sprintf("No changed files match include_paths %v", j.IncludePaths)
+	}
+	return fmt.Sprintf("No changed files match include_paths %v and not exclude_paths %v", j.IncludePaths, j.ExcludePaths)
+}
+
+// matchAnyPath returns true iff the given file matches any of the given
+// patterns. The patterns are assumed to be valid.
+func matchAnyPath(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := matchPath(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath returns true iff the given file matches the given glob pattern.
+// Patterns use the syntax of path.Match for each path element, with the
+// addition that a "**" element matches zero or more path elements. The
+// pattern is validated in its entirety, regardless of the file.
+func matchPath(pattern, file string) (bool, error) {
+	patternElems := strings.Split(pattern, "/")
+	for _, elem := range patternElems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return false, err
+		}
+	}
+	var match func([]string, []string) bool
+	match = func(patternElems, fileElems []string) bool {
+		if len(patternElems) == 0 {
+			return len(fileElems) == 0
+		}
+		if patternElems[0] == "**" {
+			for i := 0; i <= len(fileElems); i++ {
+				if match(patternElems[1:], fileElems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(fileElems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(patternElems[0], fileElems[0]); !ok {
+			return false
+		}
+		return match(patternElems[1:], fileElems[1:])
+	}
+	return match(patternElems, strings.Split(file, "/")), nil
 }
 
 // GetTaskSpecDAG returns a map describing all of the dependencies of the
@@ -494,3 +719,41 @@ func findCycles(tasks map[string]*TaskSpec, jobs map[string]*JobSpec) error {
 	}
 	return nil
 }
+
+// findJobChainCycles ensures that all downstream Jobs within the same repo
+// exist and that they do not form a cycle, which would cause Jobs to be
+// triggered indefinitely. Downstream Jobs in other repos can't be checked
+// here; the Task Scheduler limits the length of Job chains instead.
+func findJobChainCycles(jobs map[string]*JobSpec) error {
+	// 0: not visited, 1: active, 2: done.
+	state := make(map[string]int, len(jobs))
+	var visit func(string) error
+	visit = func(name string) error {
+		state[name] = 1
+		for _, d := range jobs[name].OnSuccess {
+			if d.Repo != "" {
+				continue
+			}
+			if _, ok := jobs[d.Job]; !ok {
+				return fmt.Errorf("Job %q has unknown job %q in on_success.", name, d.Job)
+			}
+			if state[d.Job] == 1 {
+				return fmt.Errorf("Found a circular on_success chain involving %q and %q", name, d.Job)
+			} else if state[d.Job] == 0 {
+				if err := visit(d.Job); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for name := range jobs {
+		if state[name] == 0 {
+			if err := visit(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -55,6 +55,19 @@ func TestCopyTaskSpec(t *testing.T) {
 func TestCopyJobSpec(t *testing.T) {
 	unittest.SmallTest(t)
 	v := &JobSpec{
+		Cron: &CronTrigger{
+			CatchUp:  true,
+			Schedule: "0 3 * * *",
+			Timezone: "America/New_York",
+		},
+		ExcludePaths: []string{"site/**"},
+		IncludePaths: []string{"src/**"},
+		OnSuccess: []*DownstreamJob{
+			{
+				Job:  "Deploy",
+				Repo: "other.git",
+			},
+		},
 		TaskSpecs: []string{"Build", "Test"},
 		Trigger:   "trigger-name",
 		Priority:  753,
@@ -62,6 +75,124 @@ func TestCopyJobSpec(t *testing.T) {
 	deepequal.AssertCopy(t, v, v.Copy())
 }
 
+func TestMatchPath(t *testing.T) {
+	unittest.SmallTest(t)
+	test := func(pattern, file string, expect bool) {
+		ok, err := matchPath(pattern, file)
+		require.NoError(t, err)
+		require.Equal(t, expect, ok, "%s vs %s", pattern, file)
+	}
+	test("DEPS", "DEPS", true)
+	test("DEPS", "src/DEPS", false)
+	test("*.md", "README.md", true)
+	test("*.md", "site/README.md", false)
+	test("src/gpu/*", "src/gpu/GrContext.cpp", true)
+	test("src/gpu/*", "src/gpu/gl/GrGLGpu.cpp", false)
+	test("src/gpu/**", "src/gpu/GrContext.cpp", true)
+	test("src/gpu/**", "src/gpu/gl/GrGLGpu.cpp", true)
+	test("src/gpu/**", "src/core/SkCanvas.cpp", false)
+	test("**/BUILD.gn", "BUILD.gn", true)
+	test("**/BUILD.gn", "src/gpu/BUILD.gn", true)
+	test("**/*.md", "site/dev/README.md", true)
+	test("src/**/gl/*", "src/gpu/gl/GrGLGpu.cpp", true)
+	test("src/**/gl/*", "src/gl/GrGLGpu.cpp", true)
+
+	_, err := matchPath("src/[gpu", "src/gpu/file")
+	require.Error(t, err)
+}
+
+func TestPathFilterSkipReason(t *testing.T) {
+	unittest.SmallTest(t)
+
+	// No filters; always run.
+	j := &JobSpec{}
+	require.False(t, j.HasPathFilters())
+	require.Equal(t, "", j.PathFilterSkipReason(nil))
+	require.Equal(t, "", j.PathFilterSkipReason([]string{"README.md"}))
+
+	// Include only.
+	j.IncludePaths = []string{"src/gpu/**", "DEPS"}
+	require.True(t, j.HasPathFilters())
+	require.Equal(t, "", j.PathFilterSkipReason([]string{"README.md", "src/gpu/gl/GrGLGpu.cpp"}))
+	require.Equal(t, "", j.PathFilterSkipReason([]string{"DEPS"}))
+	require.Equal(t, "No changed files match include_paths [src/gpu/** DEPS]", j.PathFilterSkipReason([]string{"README.md", "src/core/SkCanvas.cpp"}))
+	require.Equal(t, "No changed files match include_paths [src/gpu/** DEPS]", j.PathFilterSkipReason([]string{}))
+
+	// Include and exclude.
+	j.ExcludePaths = []string{"**/*.md"}
+	require.Equal(t, "", j.PathFilterSkipReason([]string{"src/gpu/README.md", "src/gpu/GrContext.cpp"}))
+	require.Equal(t, "No changed files match include_paths [src/gpu/** DEPS] and not exclude_paths [**/*.md]", j.PathFilterSkipReason([]string{"src/gpu/README.md"}))
+
+	// Exclude only.
+	j.IncludePaths = nil
+	require.Equal(t, "", j.PathFilterSkipReason([]string{"README.md", "src/core/SkCanvas.cpp"}))
+	require.Equal(t, "All changed files match exclude_paths [**/*.md]", j.PathFilterSkipReason([]string{"README.md", "site/index.md"}))
+}
+
+func TestJobSpecValidatePaths(t *testing.T) {
+	unittest.SmallTest(t)
+	j := &JobSpec{
+		IncludePaths: []string{"src/**"},
+		ExcludePaths: []string{"site/**"},
+	}
+	require.NoError(t, j.Validate())
+	j.ExcludePaths = append(j.ExcludePaths, "[")
+	require.EqualError(t, j.Validate(), "Invalid path pattern \"[\": syntax error in pattern")
+}
+
+func TestJobSpecValidateCron(t *testing.T) {
+	unittest.SmallTest(t)
+	j := &JobSpec{
+		Cron: &CronTrigger{
+			Schedule: "0 3 * * 1-5",
+			Timezone: "America/New_York",
+		},
+	}
+	require.NoError(t, j.Validate())
+	require.True(t, j.IsPeriodic())
+	j.Trigger = TRIGGER_MASTER_ONLY
+	require.EqualError(t, j.Validate(), "Jobs with a cron schedule may not also specify trigger \"master\"")
+	j.Trigger = TRIGGER_ANY_BRANCH
+	j.Cron.Schedule = "0 3 * *"
+	require.EqualError(t, j.Validate(), "Invalid cron schedule: Expected 5 fields in cron expression \"0 3 * *\" but got 4")
+	j.Cron.Schedule = "0 3 * * 1-5"
+	j.Cron.Timezone = "Nowhere/Special"
+	require.EqualError(t, j.Validate(), "Invalid cron schedule: Invalid timezone \"Nowhere/Special\": unknown time zone Nowhere/Special")
+
+	j = &JobSpec{Trigger: TRIGGER_NIGHTLY}
+	require.True(t, j.IsPeriodic())
+	j.Trigger = TRIGGER_MASTER_ONLY
+	require.False(t, j.IsPeriodic())
+}
+
+func TestJobChainCycles(t *testing.T) {
+	unittest.SmallTest(t)
+	jobs := map[string]*JobSpec{
+		"Build": {
+			OnSuccess: []*DownstreamJob{{Job: "Test"}},
+		},
+		"Test": {
+			OnSuccess: []*DownstreamJob{
+				{Job: "Deploy"},
+				{Job: "Test", Repo: "other.git"},
+			},
+		},
+		"Deploy": {},
+	}
+	require.NoError(t, findJobChainCycles(jobs))
+
+	jobs["Deploy"].OnSuccess = []*DownstreamJob{{Job: "Bogus"}}
+	require.EqualError(t, findJobChainCycles(jobs), "Job \"Deploy\" has unknown job \"Bogus\" in on_success.")
+
+	jobs["Deploy"].OnSuccess = []*DownstreamJob{{Job: "Build"}}
+	err := findJobChainCycles(jobs)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Found a circular on_success chain")
+
+	jobs["Deploy"].OnSuccess = []*DownstreamJob{{Job: ""}}
+	require.EqualError(t, jobs["Deploy"].Validate(), "on_success entries must specify a job")
+}
+
 // makeTasksCfg generates a JSON representation of a TasksCfg based on the given
 // tasks and jobs.
 func makeTasksCfg(t *testing.T, tasks, jobs map[string][]string) string {
@@ -0,0 +1,230 @@
+// Package swarming_executor provides an implementation of types.TaskExecutor
+// which runs tasks on Swarming.
+package swarming_executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+// SwarmingTaskExecutor implements types.TaskExecutor using Swarming.
+type SwarmingTaskExecutor struct {
+	isolateServer string
+	pubSubTopic   string
+	swarming      swarming.ApiClient
+}
+
+// NewSwarmingTaskExecutor returns a SwarmingTaskExecutor which triggers tasks
+// using the given Swarming client. Task inputs are read from the given
+// Isolate server and Swarming sends notifications about tasks to the given
+// PubSub topic.
+func NewSwarmingTaskExecutor(s swarming.ApiClient, isolateServer, pubSubTopic string) *SwarmingTaskExecutor {
+	return &SwarmingTaskExecutor{
+		isolateServer: isolateServer,
+		pubSubTopic:   pubSubTopic,
+		swarming:      s,
+	}
+}
+
+// GetFreeMachines implements types.TaskExecutor.
+func (s *SwarmingTaskExecutor) GetFreeMachines(ctx context.Context, pool string) ([]*types.Machine, error) {
+	bots, err := s.swarming.ListFreeBots(pool)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]*types.Machine, 0, len(bots))
+	for _, bot := range bots {
+		rv = append(rv, convertMachine(bot))
+	}
+	return rv, nil
+}
+
+// GetPendingTasks implements types.TaskExecutor.
+func (s *SwarmingTaskExecutor) GetPendingTasks(ctx context.Context, pool string) ([]*types.TaskResult, error) {
+	var t time.Time
+	tasks, err := s.swarming.ListTaskResults(t, t, []string{fmt.Sprintf("%s:%s", swarming.DIMENSION_POOL_KEY, pool)}, swarming.TASK_STATE_PENDING, false)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]*types.TaskResult, 0, len(tasks))
+	for _, task := range tasks {
+		res, err := types.SwarmingTaskResult(task)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, res)
+	}
+	return rv, nil
+}
+
+// GetTaskResult implements types.TaskExecutor.
+func (s *SwarmingTaskExecutor) GetTaskResult(ctx context.Context, taskID string) (*types.TaskResult, error) {
+	res, err := s.swarming.GetTask(taskID, false)
+	if err != nil {
+		return nil, err
+	}
+	return types.SwarmingTaskResult(res)
+}
+
+// GetTaskCompletionStatuses implements types.TaskExecutor.
+func (s *SwarmingTaskExecutor) GetTaskCompletionStatuses(ctx context.Context, taskIDs []string) ([]bool, error) {
+	states, err := s.swarming.GetStates(taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(states) != len(taskIDs) {
+		return nil, fmt.Errorf("GetStates returned %d states but wanted %d", len(states), len(taskIDs))
+	}
+	rv := make([]bool, 0, len(states))
+	for _, state := range states {
+		rv = append(rv, state != swarming.TASK_STATE_PENDING && state != swarming.TASK_STATE_RUNNING)
+	}
+	return rv, nil
+}
+
+// TriggerTask implements types.TaskExecutor.
+func (s *SwarmingTaskExecutor) TriggerTask(ctx context.Context, req *types.TaskRequest) (*types.TaskResult, error) {
+	resp, err := s.swarming.TriggerTask(s.makeSwarmingRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	created, err := swarming.ParseTimestamp(resp.Request.CreatedTs)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse Swarming timestamp: %s", err)
+	}
+	// The task may have been de-duplicated, in which case the result is
+	// already complete.
+	if resp.TaskResult != nil && resp.TaskResult.State == swarming.TASK_STATE_COMPLETED {
+		rv, err := types.SwarmingTaskResult(resp.TaskResult)
+		if err != nil {
+			return nil, err
+		}
+		rv.Created = created
+		return rv, nil
+	}
+	tags, err := swarming.ParseTags(resp.Request.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &types.TaskResult{
+		ID:      resp.TaskId,
+		Created: created,
+		Status:  types.TASK_STATUS_PENDING,
+		Tags:    tags,
+	}, nil
+}
+
+// CancelTask implements types.TaskExecutor.
+func (s *SwarmingTaskExecutor) CancelTask(ctx context.Context, taskID string, killRunning bool) error {
+	return s.swarming.CancelTask(taskID, killRunning)
+}
+
+// makeSwarmingRequest converts the TaskRequest to a Swarming request.
+func (s *SwarmingTaskExecutor) makeSwarmingRequest(req *types.TaskRequest) *swarming_api.SwarmingRpcsNewTaskRequest {
+	var caches []*swarming_api.SwarmingRpcsCacheEntry
+	if len(req.Caches) > 0 {
+		caches = make([]*swarming_api.SwarmingRpcsCacheEntry, 0, len(req.Caches))
+		for _, cache := range req.Caches {
+			caches = append(caches, &swarming_api.SwarmingRpcsCacheEntry{
+				Name: cache.Name,
+				Path: cache.Path,
+			})
+		}
+	}
+	var cipdInput *swarming_api.SwarmingRpcsCipdInput
+	if len(req.CipdPackages) > 0 {
+		cipdInput = &swarming_api.SwarmingRpcsCipdInput{
+			Packages: make([]*swarming_api.SwarmingRpcsCipdPackage, 0, len(req.CipdPackages)),
+		}
+		for _, p := range req.CipdPackages {
+			cipdInput.Packages = append(cipdInput.Packages, &swarming_api.SwarmingRpcsCipdPackage{
+				PackageName: p.Name,
+				Path:        p.Path,
+				Version:     p.Version,
+			})
+		}
+	}
+
+	dims := make([]*swarming_api.SwarmingRpcsStringPair, 0, len(req.Dimensions))
+	for _, d := range req.Dimensions {
+		split := strings.SplitN(d, ":", 2)
+		dims = append(dims, &swarming_api.SwarmingRpcsStringPair{
+			Key:   split[0],
+			Value: split[1],
+		})
+	}
+
+	var env []*swarming_api.SwarmingRpcsStringPair
+	if len(req.Env) > 0 {
+		env = make([]*swarming_api.SwarmingRpcsStringPair, 0, len(req.Env))
+		for k, v := range req.Env {
+			env = append(env, &swarming_api.SwarmingRpcsStringPair{
+				Key:   k,
+				Value: v,
+			})
+		}
+	}
+
+	var envPrefixes []*swarming_api.SwarmingRpcsStringListPair
+	if len(req.EnvPrefixes) > 0 {
+		envPrefixes = make([]*swarming_api.SwarmingRpcsStringListPair, 0, len(req.EnvPrefixes))
+		for k, v := range req.EnvPrefixes {
+			envPrefixes = append(envPrefixes, &swarming_api.SwarmingRpcsStringListPair{
+				Key:   k,
+				Value: util.CopyStringSlice(v),
+			})
+		}
+	}
+
+	return &swarming_api.SwarmingRpcsNewTaskRequest{
+		ExpirationSecs: int64(req.Expiration.Seconds()),
+		Name:           req.Name,
+		Priority:       swarming.RECOMMENDED_PRIORITY,
+		Properties: &swarming_api.SwarmingRpcsTaskProperties{
+			Caches:               caches,
+			CipdInput:            cipdInput,
+			Command:              req.Command,
+			Dimensions:           dims,
+			Env:                  env,
+			EnvPrefixes:          envPrefixes,
+			ExecutionTimeoutSecs: int64(req.ExecutionTimeout.Seconds()),
+			ExtraArgs:            req.ExtraArgs,
+			Idempotent:           req.Idempotent,
+			InputsRef: &swarming_api.SwarmingRpcsFilesRef{
+				Isolated:       req.Isolated,
+				Isolatedserver: s.isolateServer,
+				Namespace:      isolate.DEFAULT_NAMESPACE,
+			},
+			IoTimeoutSecs: int64(req.IoTimeout.Seconds()),
+			Outputs:       req.Outputs,
+		},
+		PubsubTopic:    fmt.Sprintf(swarming.PUBSUB_FULLY_QUALIFIED_TOPIC_TMPL, common.PROJECT_ID, s.pubSubTopic),
+		PubsubUserdata: req.TaskSchedulerTaskID,
+		ServiceAccount: req.ServiceAccount,
+		Tags:           req.Tags,
+		User:           "skiabot@google.com",
+	}
+}
+
+// convertMachine converts a Swarming bot to a types.Machine.
+func convertMachine(bot *swarming_api.SwarmingRpcsBotInfo) *types.Machine {
+	return &types.Machine{
+		ID:            bot.BotId,
+		Dimensions:    swarming.BotDimensionsToStringSlice(bot.Dimensions),
+		IsDead:        bot.IsDead,
+		IsQuarantined: bot.Quarantined,
+		CurrentTaskID: bot.TaskId,
+	}
+}
+
+// Make sure SwarmingTaskExecutor fulfills the types.TaskExecutor interface.
+var _ types.TaskExecutor = &SwarmingTaskExecutor{}
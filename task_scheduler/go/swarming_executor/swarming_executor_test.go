@@ -0,0 +1,83 @@
+package swarming_executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	swarming_api "go.chromium.org/luci/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+func TestTriggerTask(t *testing.T) {
+	unittest.SmallTest(t)
+
+	ctx := context.Background()
+	c := testutils.NewTestClient()
+	e := NewSwarmingTaskExecutor(c, "fake-isolate", "fake-topic")
+
+	res, err := e.TriggerTask(ctx, &types.TaskRequest{
+		Command:             []string{"run", "it"},
+		Dimensions:          []string{"pool:Skia", "os:Linux"},
+		Env:                 map[string]string{"K": "V"},
+		ExecutionTimeout:    time.Hour,
+		Expiration:          2 * time.Hour,
+		Isolated:            "abc123",
+		Name:                "my-task",
+		Tags:                []string{"sk_id:task1", "sk_dim_pool:Skia"},
+		TaskSchedulerTaskID: "task1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, types.TASK_STATUS_PENDING, res.Status)
+	assert.False(t, res.Created.IsZero())
+	assert.Equal(t, []string{"task1"}, res.Tags["sk_id"])
+	assert.Equal(t, []string{"pool:Skia"}, res.Dimensions())
+
+	md, err := c.GetTaskMetadata(res.ID)
+	require.NoError(t, err)
+	req := md.Request
+	assert.Equal(t, "my-task", req.Name)
+	assert.Equal(t, int64(7200), req.ExpirationSecs)
+	assert.Equal(t, []string{"run", "it"}, req.Properties.Command)
+	assert.Equal(t, int64(3600), req.Properties.ExecutionTimeoutSecs)
+	assert.Equal(t, []*swarming_api.SwarmingRpcsStringPair{
+		{Key: "pool", Value: "Skia"},
+		{Key: "os", Value: "Linux"},
+	}, req.Properties.Dimensions)
+	assert.Equal(t, []*swarming_api.SwarmingRpcsStringPair{{Key: "K", Value: "V"}}, req.Properties.Env)
+	assert.Equal(t, &swarming_api.SwarmingRpcsFilesRef{
+		Isolated:       "abc123",
+		Isolatedserver: "fake-isolate",
+		Namespace:      isolate.DEFAULT_NAMESPACE,
+	}, req.Properties.InputsRef)
+}
+
+func TestGetFreeMachines(t *testing.T) {
+	unittest.SmallTest(t)
+
+	c := testutils.NewTestClient()
+	c.MockBots([]*swarming_api.SwarmingRpcsBotInfo{
+		{
+			BotId: "bot1",
+			Dimensions: swarming.StringMapToBotDimensions(map[string][]string{
+				"pool": {"Skia"},
+				"os":   {"Linux", "Debian"},
+			}),
+		},
+	})
+	e := NewSwarmingTaskExecutor(c, "fake-isolate", "fake-topic")
+	machines, err := e.GetFreeMachines(context.Background(), "Skia")
+	require.NoError(t, err)
+	assert.Equal(t, []*types.Machine{
+		{
+			ID:         "bot1",
+			Dimensions: []string{"os:Debian", "os:Linux", "pool:Skia"},
+		},
+	}, machines)
+}
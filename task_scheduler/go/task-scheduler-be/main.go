@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -31,9 +33,15 @@ import (
 	"go.skia.org/infra/go/swarming"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/blacklist"
+	"go.skia.org/infra/task_scheduler/go/cron_triggers"
 	"go.skia.org/infra/task_scheduler/go/db/firestore"
+	"go.skia.org/infra/task_scheduler/go/events"
+	"go.skia.org/infra/task_scheduler/go/local_executor"
+	"go.skia.org/infra/task_scheduler/go/quarantine"
 	"go.skia.org/infra/task_scheduler/go/scheduling"
+	"go.skia.org/infra/task_scheduler/go/swarming_executor"
 	"go.skia.org/infra/task_scheduler/go/tryjobs"
+	"go.skia.org/infra/task_scheduler/go/types"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 )
@@ -47,6 +55,10 @@ const (
 
 	// PubSub subscriber ID used for GitStore.
 	GITSTORE_SUBSCRIBER_ID = APP_NAME
+
+	// File within the workdir in which the progress of the event publisher
+	// is stored.
+	EVENT_WATERMARKS_FILE = "event_watermarks.json"
 )
 
 var (
@@ -56,6 +68,8 @@ var (
 	host              = flag.String("host", "localhost", "HTTP service host")
 	port              = flag.String("port", ":8000", "HTTP service port for the web server (e.g., ':8000')")
 	disableTryjobs    = flag.Bool("disable_try_jobs", false, "If set, no try jobs will be picked up.")
+	eventSink         = flag.String("event_sink", "", "If set, publish an event for each task and job state change to this sink: \"pubsub://<project>/<topic>\", an http(s) webhook URL, or \"file://<path>\" for newline-delimited JSON.")
+	fairnessConfig    = flag.String("fairness_config", "", "If set, share bot time among repos and trigger types according to the given JSON file.")
 	firestoreInstance = flag.String("firestore_instance", "", "Firestore instance to use, eg. \"production\"")
 	gitstoreTable     = flag.String("gitstore_bt_table", "git-repos2", "BigTable table used for GitStore.")
 	isolateServer     = flag.String("isolate_server", isolate.ISOLATE_SERVER_URL, "Which Isolate server to use.")
@@ -68,6 +82,7 @@ var (
 	timePeriod        = flag.String("timeWindow", "4d", "Time period to use.")
 	tryJobBucket      = flag.String("tryjob_bucket", tryjobs.BUCKET_PRIMARY, "Which Buildbucket bucket to use for try jobs.")
 	commitWindow      = flag.Int("commitWindow", 10, "Minimum number of recent commits to keep in the timeWindow.")
+	localExecutor     = flag.String("local_executor_config", "", "If set, run tasks on this host using the local task executor, configured by the given JSON file, instead of on Swarming.")
 	diagnosticsBucket = flag.String("diagnostics_bucket", "skia-task-scheduler-diagnostics", "Name of Google Cloud Storage bucket to use for diagnostics data.")
 	workdir           = flag.String("workdir", "workdir", "Working directory to use.")
 	promPort          = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
@@ -146,6 +161,28 @@ func main() {
 		sklog.Fatal(err)
 	}
 
+	// Quarantine DB.
+	q, err := quarantine.NewWithParams(ctx, firestore.FIRESTORE_PROJECT, *firestoreInstance, tokenSource)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	q.AutoUpdate(ctx)
+
+	// Cron trigger firings DB.
+	cronFirings, err := cron_triggers.NewFirestoreDBWithParams(ctx, firestore.FIRESTORE_PROJECT, *firestoreInstance, tokenSource)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+
+	// Fairness config.
+	var fairnessCfg *scheduling.FairnessConfig
+	if *fairnessConfig != "" {
+		fairnessCfg, err = scheduling.ReadFairnessConfig(*fairnessConfig)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+	}
+
 	// Git repos.
 	if *repoUrls == nil {
 		sklog.Fatal("--repo is required.")
@@ -170,6 +207,23 @@ func main() {
 		sklog.Fatal(err)
 	}
 
+	// Initialize the task executor.
+	var taskExec types.TaskExecutor
+	if *localExecutor != "" {
+		var localCfg local_executor.Config
+		if err := util.WithReadFile(*localExecutor, func(f io.Reader) error {
+			return json.NewDecoder(f).Decode(&localCfg)
+		}); err != nil {
+			sklog.Fatalf("Failed to read local executor config: %s", err)
+		}
+		taskExec, err = local_executor.NewLocalTaskExecutor(ctx, &localCfg, isolateClient, httpClient)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+	} else {
+		taskExec = swarming_executor.NewSwarmingTaskExecutor(swarm, isolateClient.ServerURL(), *pubsubTopicName)
+	}
+
 	storageClient, err := storage.NewClient(ctx, option.WithTokenSource(tokenSource))
 	if err != nil {
 		sklog.Fatal(err)
@@ -193,9 +247,23 @@ func main() {
 		sklog.Fatal(err)
 	}
 
+	// Publish task and job events.
+	if *eventSink != "" {
+		sink, err := events.NewSink(ctx, *eventSink, httputils.NewTimeoutClient(), tokenSource)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		cleanup.AtExit(func() {
+			util.Close(sink)
+		})
+		if err := events.NewPublisher(sink, period, events.NewFileWatermarkStore(filepath.Join(wdAbs, EVENT_WATERMARKS_FILE))).Start(ctx, tsDb); err != nil {
+			sklog.Fatal(err)
+		}
+	}
+
 	// Create and start the task scheduler.
 	sklog.Infof("Creating task scheduler.")
-	ts, err := scheduling.NewTaskScheduler(ctx, tsDb, bl, period, *commitWindow, wdAbs, serverURL, repos, isolateClient, swarm, httpClient, *scoreDecay24Hr, tryjobs.API_URL_PROD, *tryJobBucket, common.PROJECT_REPO_MAPPING, *swarmingPools, *pubsubTopicName, depotTools, gerrit, *btProject, *btInstance, tokenSource, diagClient, diagInstance)
+	ts, err := scheduling.NewTaskScheduler(ctx, tsDb, bl, q, cronFirings, fairnessCfg, period, *commitWindow, wdAbs, serverURL, repos, isolateClient, taskExec, httpClient, *scoreDecay24Hr, tryjobs.API_URL_PROD, *tryJobBucket, common.PROJECT_REPO_MAPPING, *swarmingPools, depotTools, gerrit, *btProject, *btInstance, tokenSource, diagClient, diagInstance)
 	if err != nil {
 		sklog.Fatal(err)
 	}
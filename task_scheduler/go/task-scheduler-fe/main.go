@@ -34,6 +34,8 @@ import (
 	"go.skia.org/infra/task_scheduler/go/blacklist"
 	"go.skia.org/infra/task_scheduler/go/db"
 	"go.skia.org/infra/task_scheduler/go/db/firestore"
+	"go.skia.org/infra/task_scheduler/go/job_analysis"
+	"go.skia.org/infra/task_scheduler/go/quarantine"
 	"go.skia.org/infra/task_scheduler/go/task_cfg_cache"
 	"go.skia.org/infra/task_scheduler/go/types"
 )
@@ -44,6 +46,10 @@ const (
 
 	// PubSub subscriber ID used for GitStore.
 	GITSTORE_SUBSCRIBER_ID = APP_NAME
+
+	// Blacklist dry runs consider unfinished Jobs created within this
+	// period.
+	BLACKLIST_DRY_RUN_PERIOD = 4 * 24 * time.Hour
 )
 
 var (
@@ -53,6 +59,9 @@ var (
 	// Task Scheduler blacklist.
 	bl *blacklist.Blacklist
 
+	// Quarantined TaskSpecs.
+	q *quarantine.Quarantine
+
 	// Git repo objects.
 	repos repograph.Map
 
@@ -68,6 +77,7 @@ var (
 	jobSearchTemplate   *template.Template = nil
 	jobTimelineTemplate *template.Template = nil
 	mainTemplate        *template.Template = nil
+	quarantineTemplate  *template.Template = nil
 	taskTemplate        *template.Template = nil
 	triggerTemplate     *template.Template = nil
 
@@ -117,6 +127,11 @@ func reloadTemplates() {
 		filepath.Join(*resourcesDir, "templates/header.html"),
 		filepath.Join(*resourcesDir, "templates/footer.html"),
 	))
+	quarantineTemplate = template.Must(template.ParseFiles(
+		filepath.Join(*resourcesDir, "templates/quarantine.html"),
+		filepath.Join(*resourcesDir, "templates/header.html"),
+		filepath.Join(*resourcesDir, "templates/footer.html"),
+	))
 	taskTemplate = template.Must(template.ParseFiles(
 		filepath.Join(*resourcesDir, "templates/task.html"),
 		filepath.Join(*resourcesDir, "templates/header.html"),
@@ -174,6 +189,32 @@ func blacklistHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func quarantineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	// Don't use cached templates in testing mode.
+	if *local {
+		reloadTemplates()
+	}
+	enc, err := json.Marshal(&struct {
+		Entries []*quarantine.Entry `json:"entries"`
+	}{
+		Entries: q.GetEntries(),
+	})
+	if err != nil {
+		httputils.ReportError(w, err, "Failed to encode JSON.", http.StatusInternalServerError)
+		return
+	}
+	if err := quarantineTemplate.Execute(w, struct {
+		Data string
+	}{
+		Data: string(enc),
+	}); err != nil {
+		httputils.ReportError(w, err, "Failed to execute template.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func triggerHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
@@ -188,6 +229,153 @@ func triggerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// decodeRule decodes a blacklist.Rule from the request body, expanding commit
+// ranges as needed.
+func decodeRule(r *http.Request) (*blacklist.Rule, error) {
+	var rule blacklist.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		return nil, fmt.Errorf("Failed to decode request body: %s", err)
+	}
+	defer util.Close(r.Body)
+	rule.AddedBy = login.LoggedInAs(r)
+	if len(rule.Commits) == 2 {
+		rangeRule, err := blacklist.NewCommitRangeRule(context.Background(), rule.Name, rule.AddedBy, rule.Description, rule.TaskSpecPatterns, rule.Commits[0], rule.Commits[1], repos)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create commit range rule: %s", err)
+		}
+		rangeRule.AuthorPatterns = rule.AuthorPatterns
+		rangeRule.Expires = rule.Expires
+		rangeRule.PathPatterns = rule.PathPatterns
+		rangeRule.Triggers = rule.Triggers
+		return rangeRule, nil
+	}
+	return &rule, nil
+}
+
+// blacklistDryRunMatch is a task which would be blacklisted by a Rule.
+type blacklistDryRunMatch struct {
+	types.TaskKey
+	Jobs []string `json:"jobs"`
+}
+
+// blacklistDryRun returns the tasks needed by recent unfinished Jobs which have
+// not yet been triggered and which would be blacklisted by the given Rule.
+func blacklistDryRun(ctx context.Context, rule *blacklist.Rule) ([]*blacklistDryRunMatch, error) {
+	now := time.Now()
+	jobs, err := tsDb.GetJobsFromDateRange(now.Add(-BLACKLIST_DRY_RUN_PERIOD), now, "")
+	if err != nil {
+		return nil, err
+	}
+	// Find the tasks which have not yet been triggered, along with the
+	// Jobs which need them.
+	jobsByKey := map[types.TaskKey][]*types.Job{}
+	keys := []types.TaskKey{}
+	for _, j := range jobs {
+		if j.Done() {
+			continue
+		}
+		for name := range j.Dependencies {
+			// Tasks which have already been triggered are not
+			// affected by the blacklist.
+			triggered := false
+			for _, ts := range j.Tasks[name] {
+				if ts.Status != types.TASK_STATUS_FAILURE && ts.Status != types.TASK_STATUS_MISHAP {
+					triggered = true
+					break
+				}
+			}
+			if triggered {
+				continue
+			}
+			key := j.MakeTaskKey(name)
+			if _, ok := jobsByKey[key]; !ok {
+				keys = append(keys, key)
+			}
+			jobsByKey[key] = append(jobsByKey[key], j)
+		}
+	}
+
+	// Determine the trigger type of each task in the same way as the
+	// scheduler, ie. a task is only periodic if all of its Jobs are.
+	jobTriggers := map[string]string{}
+	jobTriggerType := func(j *types.Job) string {
+		if trigger, ok := jobTriggers[j.Id]; ok {
+			return trigger
+		}
+		isPeriodic := false
+		if cfg, err := taskCfgCache.Get(ctx, j.RepoState); err == nil {
+			if spec, ok := cfg.Jobs[j.Name]; ok {
+				isPeriodic = spec.IsPeriodic()
+			}
+		}
+		jobTriggers[j.Id] = j.TriggerType(isPeriodic)
+		return jobTriggers[j.Id]
+	}
+
+	changedFilesByRepoState := map[types.RepoState][]string{}
+	rv := []*blacklistDryRunMatch{}
+	for _, key := range keys {
+		keyJobs := jobsByKey[key]
+		c := &blacklist.Candidate{
+			Commit:   key.Revision,
+			TaskSpec: key.Name,
+			Trigger:  types.TaskTriggerType(key, keyJobs, jobTriggerType),
+		}
+		if repo, ok := repos[key.Repo]; ok {
+			if commit := repo.Get(key.Revision); commit != nil {
+				c.Author = commit.Author
+			}
+		}
+		if len(rule.PathPatterns) > 0 {
+			changedFiles, ok := changedFilesByRepoState[key.RepoState]
+			if !ok {
+				changedFiles, err = taskCfgCache.GetChangedFiles(ctx, key.RepoState)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to obtain changed files for %s: %s", key.RepoState.RowKey(), err)
+				}
+				changedFilesByRepoState[key.RepoState] = changedFiles
+			}
+			c.ChangedFiles = changedFiles
+		}
+		if !rule.MatchCandidate(c, now) {
+			continue
+		}
+		m := &blacklistDryRunMatch{TaskKey: key}
+		for _, j := range keyJobs {
+			m.Jobs = append(m.Jobs, j.Id)
+		}
+		rv = append(rv, m)
+	}
+	return rv, nil
+}
+
+func jsonBlacklistDryRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	rule, err := decodeRule(r)
+	if err != nil {
+		httputils.ReportError(w, err, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := blacklist.ValidateRule(rule, repos); err != nil {
+		httputils.ReportError(w, err, fmt.Sprintf("Invalid blacklist rule: %s", err), http.StatusBadRequest)
+		return
+	}
+	matches, err := blacklistDryRun(r.Context(), rule)
+	if err != nil {
+		httputils.ReportError(w, err, fmt.Sprintf("Failed to perform dry run: %s", err), http.StatusInternalServerError)
+		return
+	}
+	resp := &struct {
+		Matches []*blacklistDryRunMatch `json:"matches"`
+	}{
+		Matches: matches,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		httputils.ReportError(w, err, fmt.Sprintf("Failed to encode response: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
 func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method == http.MethodDelete {
@@ -204,22 +392,12 @@ func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else if r.Method == http.MethodPost {
-		var rule blacklist.Rule
-		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
-			httputils.ReportError(w, err, fmt.Sprintf("Failed to decode request body: %s", err), http.StatusInternalServerError)
+		rule, err := decodeRule(r)
+		if err != nil {
+			httputils.ReportError(w, err, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer util.Close(r.Body)
-		rule.AddedBy = login.LoggedInAs(r)
-		if len(rule.Commits) == 2 {
-			rangeRule, err := blacklist.NewCommitRangeRule(context.Background(), rule.Name, rule.AddedBy, rule.Description, rule.TaskSpecPatterns, rule.Commits[0], rule.Commits[1], repos)
-			if err != nil {
-				httputils.ReportError(w, err, fmt.Sprintf("Failed to create commit range rule: %s", err), http.StatusInternalServerError)
-				return
-			}
-			rule = *rangeRule
-		}
-		if err := bl.AddRule(&rule, repos); err != nil {
+		if err := bl.AddRule(rule, repos); err != nil {
 			httputils.ReportError(w, err, fmt.Sprintf("Failed to add blacklist rule: %s", err), http.StatusInternalServerError)
 			return
 		}
@@ -235,6 +413,52 @@ func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func jsonQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		var msg struct {
+			Name string `json:"name"`
+			Repo string `json:"repo"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			httputils.ReportError(w, err, fmt.Sprintf("Failed to decode request body: %s", err), http.StatusInternalServerError)
+			return
+		}
+		defer util.Close(r.Body)
+		if err := q.RemoveEntry(msg.Repo, msg.Name); err != nil {
+			httputils.ReportError(w, err, fmt.Sprintf("Failed to remove quarantine entry: %s", err), http.StatusInternalServerError)
+			return
+		}
+	} else if r.Method == http.MethodPost {
+		var entry quarantine.Entry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			httputils.ReportError(w, err, fmt.Sprintf("Failed to decode request body: %s", err), http.StatusInternalServerError)
+			return
+		}
+		defer util.Close(r.Body)
+		if _, ok := repos[entry.Repo]; !ok {
+			err := fmt.Errorf("Unknown repo %q", entry.Repo)
+			httputils.ReportError(w, err, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.Added = time.Now().UTC()
+		entry.AddedBy = login.LoggedInAs(r)
+		if err := q.AddEntry(&entry); err != nil {
+			httputils.ReportError(w, err, fmt.Sprintf("Failed to add quarantine entry: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	resp := &struct {
+		Entries []*quarantine.Entry `json:"entries"`
+	}{
+		Entries: q.GetEntries(),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		httputils.ReportError(w, err, fmt.Sprintf("Failed to encode response: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
 // makeJob creates a Job for the given repo, revision, and name.
 func makeJob(ctx context.Context, repo, revision, jobName string) (*types.Job, error) {
 	j, err := taskCfgCache.MakeJob(ctx, types.RepoState{
@@ -456,7 +680,20 @@ func jobTimelineHandler(w http.ResponseWriter, r *http.Request) {
 				httputils.ReportError(w, err, "Failed to retrieve Task.", http.StatusInternalServerError)
 				return
 			}
-			swarmingTask, err := swarm.GetTask(task.SwarmingTaskId, true)
+			// Tasks whose results were reused did not run; display
+			// the Swarming task which produced the results.
+			swarmingTaskId := task.SwarmingTaskId
+			if task.ReusedFrom != "" {
+				orig, err := tsDb.GetTaskById(task.ReusedFrom)
+				if err != nil {
+					httputils.ReportError(w, err, "Failed to retrieve reused Task.", http.StatusInternalServerError)
+					return
+				}
+				if orig != nil {
+					swarmingTaskId = orig.SwarmingTaskId
+				}
+			}
+			swarmingTask, err := swarm.GetTask(swarmingTaskId, true)
 			if err != nil {
 				httputils.ReportError(w, err, "Failed to retrieve Swarming task.", http.StatusInternalServerError)
 				return
@@ -490,6 +727,67 @@ func jobTimelineHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// jsonJobAnalysisHandler returns the critical path and the time spent on each
+// TaskSpec for a Job.
+func jsonJobAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		httputils.ReportError(w, nil, "Job ID is required.", http.StatusInternalServerError)
+		return
+	}
+	analysis, err := job_analysis.AnalyzeJobById(tsDb, id, time.Now())
+	if err == db.ErrNotFound {
+		http.Error(w, "Unknown Job", 404)
+		return
+	} else if err != nil {
+		httputils.ReportError(w, err, "Failed to analyze Job.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(analysis); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
+// jsonJobSpecAnalysisHandler returns aggregate timing information for the
+// Jobs of a JobSpec within a time range, which defaults to the last 24 hours
+// and may not exceed job_analysis.MAX_TIME_RANGE.
+func jsonJobSpecAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Repo      string    `json:"repo"`
+		Name      string    `json:"name"`
+		TimeStart time.Time `json:"time_start"`
+		TimeEnd   time.Time `json:"time_end"`
+	}
+	if err := httputils.ParseFormValues(r, &params); err != nil {
+		httputils.ReportError(w, err, "Failed to parse request parameters.", http.StatusInternalServerError)
+		return
+	}
+	if params.Repo == "" || params.Name == "" {
+		http.Error(w, "repo and name are required.", http.StatusBadRequest)
+		return
+	}
+	if util.TimeIsZero(params.TimeStart) || util.TimeIsZero(params.TimeEnd) {
+		params.TimeEnd = time.Now()
+		params.TimeStart = params.TimeEnd.Add(-24 * time.Hour)
+	}
+	if err := job_analysis.ValidateTimeRange(params.TimeStart, params.TimeEnd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	agg, _, err := job_analysis.AnalyzeJobSpec(tsDb, params.Repo, params.Name, params.TimeStart, params.TimeEnd)
+	if err != nil {
+		httputils.ReportError(w, err, "Failed to analyze Jobs.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(agg); err != nil {
+		httputils.ReportError(w, err, "Failed to encode response.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func taskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
@@ -609,12 +907,18 @@ func runServer(serverURL string) {
 	r.HandleFunc("/job/{id}", jobHandler)
 	r.HandleFunc("/job/{id}/timeline", jobTimelineHandler)
 	r.HandleFunc("/jobs/search", jobSearchHandler)
+	r.HandleFunc("/quarantine", quarantineHandler)
 	r.HandleFunc("/task/{id}", taskHandler)
 	r.HandleFunc("/trigger", triggerHandler)
 	r.HandleFunc("/json/blacklist", login.RestrictEditorFn(jsonBlacklistHandler)).Methods(http.MethodPost, http.MethodDelete)
+	r.HandleFunc("/json/blacklist/dry_run", login.RestrictEditorFn(jsonBlacklistDryRunHandler)).Methods(http.MethodPost)
 	r.HandleFunc("/json/job/{id}", jsonJobHandler)
+	r.HandleFunc("/json/job/{id}/analysis", login.RestrictViewerFn(jsonJobAnalysisHandler))
 	r.HandleFunc("/json/job/{id}/cancel", login.RestrictEditorFn(jsonCancelJobHandler)).Methods(http.MethodPost)
+	r.HandleFunc("/json/jobs/analysis", login.RestrictViewerFn(jsonJobSpecAnalysisHandler))
 	r.HandleFunc("/json/jobs/search", jsonJobSearchHandler)
+	r.HandleFunc("/json/quarantine", jsonQuarantineHandler).Methods(http.MethodGet)
+	r.HandleFunc("/json/quarantine", login.RestrictEditorFn(jsonQuarantineHandler)).Methods(http.MethodPost, http.MethodDelete)
 	r.HandleFunc("/json/task/{id}", jsonGetTaskHandler)
 	// TODO(borenet): Re-enable this if/when candidates have their own DB.
 	//r.HandleFunc("/json/taskCandidates/search", jsonTaskCandidateSearchHandler)
@@ -682,6 +986,13 @@ func main() {
 	}
 	bl.AutoUpdate(ctx)
 
+	// Quarantined TaskSpecs.
+	q, err = quarantine.NewWithParams(ctx, firestore.FIRESTORE_PROJECT, *firestoreInstance, tokenSource)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	q.AutoUpdate(ctx)
+
 	// Git repos.
 	if *repoUrls == nil {
 		sklog.Fatal("--repo is required.")
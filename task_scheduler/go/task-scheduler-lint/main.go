@@ -0,0 +1,107 @@
+package main
+
+/*
+	Check a tasks.json file for problems, eg. in a presubmit. Exits with a
+	non-zero status if any errors (or, with --werror, any warnings) are found.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"go.skia.org/infra/go/auth"
+	"go.skia.org/infra/go/cipd"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/task_cfg_lint"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+var (
+	bots                = flag.String("bots", "", "Optional JSON file containing a list of bots, each with \"id\" and \"dimensions\" in \"key:value\" format. If provided, report tasks whose dimensions match no bot.")
+	cfgFile             = flag.String("cfg_file", specs.TASKS_CFG_FILE, "Config file to check.")
+	checkCipdVersions   = flag.Bool("check_cipd_versions", false, "If set, look up each CIPD package version and report those which do not exist. Requires authentication.")
+	jsonOutput          = flag.Bool("json", false, "Write the findings as a JSON list rather than one per line.")
+	local               = flag.Bool("local", true, "True if running locally, ie. not on a bot. Only used with --check_cipd_versions.")
+	maxExecutionTimeout = flag.Duration("max_execution_timeout", task_cfg_lint.DEFAULT_MAX_EXECUTION_TIMEOUT, "Report tasks whose execution timeout exceeds this value.")
+	maxExpiration       = flag.Duration("max_expiration", task_cfg_lint.DEFAULT_MAX_EXPIRATION, "Report tasks whose expiration exceeds this value.")
+	maxIoTimeout        = flag.Duration("max_io_timeout", task_cfg_lint.DEFAULT_MAX_IO_TIMEOUT, "Report tasks whose IO timeout exceeds this value.")
+	werror              = flag.Bool("werror", false, "Exit with a non-zero status if any warnings are found.")
+)
+
+func main() {
+	common.Init()
+
+	b, err := ioutil.ReadFile(*cfgFile)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	// Don't use specs.ParseTasksCfg, which stops at the first problem.
+	var cfg specs.TasksCfg
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		sklog.Fatalf("Failed to parse %s: %s", *cfgFile, err)
+	}
+	lintCfg := &task_cfg_lint.Config{
+		MaxExecutionTimeout: *maxExecutionTimeout,
+		MaxExpiration:       *maxExpiration,
+		MaxIoTimeout:        *maxIoTimeout,
+	}
+	if *bots != "" {
+		b, err := ioutil.ReadFile(*bots)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		var machines []*types.Machine
+		if err := json.Unmarshal(b, &machines); err != nil {
+			sklog.Fatalf("Failed to parse %s: %s", *bots, err)
+		}
+		lintCfg.Bots = machines
+	}
+
+	ctx := context.Background()
+	tmp := ""
+	if *checkCipdVersions {
+		ts, err := auth.NewDefaultTokenSource(*local, auth.SCOPE_USERINFO_EMAIL)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		// The client's root dir is only used to install packages, which
+		// we don't do.
+		tmp, err = ioutil.TempDir("", "task-scheduler-lint")
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		c, err := cipd.NewClient(httputils.DefaultClientConfig().WithTokenSource(ts).With2xxOnly().Client(), tmp)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		lintCfg.Cipd = c
+	}
+
+	findings := task_cfg_lint.Lint(ctx, &cfg, lintCfg)
+	if tmp != "" {
+		util.RemoveAll(tmp)
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			sklog.Fatal(err)
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f.String())
+		}
+	}
+	if task_cfg_lint.HasErrors(findings) || (*werror && len(findings) > 0) {
+		os.Exit(1)
+	}
+}
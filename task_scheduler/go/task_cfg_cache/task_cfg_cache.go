@@ -72,6 +72,11 @@ type CachedValue struct {
 	Cfg *specs.TasksCfg
 	// Err stores a permanent error. Mutually-exclusive with Cfg.
 	Err string
+	// ChangedFiles are the paths of the files changed by the commit
+	// associated with this RepoState, relative to the repo root. It is nil
+	// if unknown, eg. for try jobs or entries cached before the field was
+	// added.
+	ChangedFiles []string
 }
 
 // See documentation for atomic_miss_cache.ICache interface.
@@ -179,6 +184,17 @@ func (c *TaskCfgCache) Get(ctx context.Context, rs types.RepoState) (*specs.Task
 	return cv.Cfg, nil
 }
 
+// GetChangedFiles returns the files changed by the commit associated with the
+// given RepoState, or nil if they are unknown. If no entry exists for the given
+// RepoState, returns ErrNoSuchEntry.
+func (c *TaskCfgCache) GetChangedFiles(ctx context.Context, rs types.RepoState) ([]string, error) {
+	val, err := c.cache.Get(ctx, rs.RowKey())
+	if err != nil {
+		return nil, err
+	}
+	return util.CopyStringSlice(val.(*CachedValue).ChangedFiles), nil
+}
+
 // Sets the TasksCfg (or error) for the given RepoState in the cache.
 func (c *TaskCfgCache) Set(ctx context.Context, rs types.RepoState, cfg *specs.TasksCfg, storedErr error) error {
 	errString := ""
@@ -0,0 +1,553 @@
+package task_cfg_lint
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.chromium.org/luci/cipd/common"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+const (
+	// Severities of Findings. Errors indicate problems which prevent the
+	// Task Scheduler from using the config, or which prevent tasks from
+	// running. Warnings indicate likely mistakes.
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+
+	// Checks which produce Findings.
+	CHECK_CONFLICTING_CACHES       = "conflicting_caches"
+	CHECK_CONFLICTING_CIPD_PACKAGE = "conflicting_cipd_package"
+	CHECK_DEPENDENCY_CYCLE         = "dependency_cycle"
+	CHECK_DUPLICATE_JOB            = "duplicate_job"
+	CHECK_EXCESSIVE_TIMEOUT        = "excessive_timeout"
+	CHECK_INVALID_CIPD_PACKAGE     = "invalid_cipd_package"
+	CHECK_UNKNOWN_CIPD_VERSION     = "unknown_cipd_version"
+	CHECK_INVALID_JOB              = "invalid_job"
+	CHECK_INVALID_TASK             = "invalid_task"
+	CHECK_NO_MATCHING_BOT          = "no_matching_bot"
+	CHECK_UNKNOWN_DEPENDENCY       = "unknown_dependency"
+	CHECK_UNREACHABLE_TASK         = "unreachable_task"
+	CHECK_UNUSED_JOB               = "unused_job"
+
+	// Default limits for Config.
+	DEFAULT_MAX_EXECUTION_TIMEOUT = 4 * time.Hour
+	DEFAULT_MAX_EXPIRATION        = 24 * time.Hour
+	DEFAULT_MAX_IO_TIMEOUT        = time.Hour
+)
+
+var (
+	// Triggers which cause Jobs to run. See specs.JobSpec.Trigger.
+	VALID_TRIGGERS = []string{
+		specs.TRIGGER_ANY_BRANCH,
+		specs.TRIGGER_MASTER_ONLY,
+		specs.TRIGGER_NIGHTLY,
+		specs.TRIGGER_ON_DEMAND,
+		specs.TRIGGER_WEEKLY,
+	}
+)
+
+// CipdResolver resolves CIPD package versions. It is satisfied by
+// cipd.Client.
+type CipdResolver interface {
+	ResolveVersion(ctx context.Context, packageName, version string) (common.Pin, error)
+}
+
+// Config provides optional inputs to Lint.
+type Config struct {
+	// Bots is a snapshot of the available bots. If provided, Lint reports
+	// TaskSpecs whose dimensions match none of them.
+	Bots []*types.Machine `json:"bots"`
+
+	// Cipd is used to look up CIPD packages. If provided, Lint reports
+	// package versions which do not exist.
+	Cipd CipdResolver `json:"-"`
+
+	// Maximum values for TaskSpec timeouts. Zero values use the defaults.
+	MaxExecutionTimeout time.Duration `json:"max_execution_timeout"`
+	MaxExpiration       time.Duration `json:"max_expiration"`
+	MaxIoTimeout        time.Duration `json:"max_io_timeout"`
+}
+
+// Finding describes a single problem with a TasksCfg.
+type Finding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	JobSpec  string `json:"job_spec,omitempty"`
+	TaskSpec string `json:"task_spec,omitempty"`
+	Message  string `json:"message"`
+}
+
+// String returns a human-readable representation of the Finding.
+func (f *Finding) String() string {
+	subject := ""
+	if f.TaskSpec != "" {
+		subject = fmt.Sprintf("task %q: ", f.TaskSpec)
+	} else if f.JobSpec != "" {
+		subject = fmt.Sprintf("job %q: ", f.JobSpec)
+	}
+	return fmt.Sprintf("%s [%s] %s%s", f.Severity, f.Check, subject, f.Message)
+}
+
+// linter accumulates Findings.
+type linter struct {
+	cfg      *specs.TasksCfg
+	findings []*Finding
+}
+
+// task records a Finding for the given TaskSpec.
+func (l *linter) task(severity, check, name, format string, args ...interface{}) {
+	l.findings = append(l.findings, &Finding{
+		Check:    check,
+		Severity: severity,
+		TaskSpec: name,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// job records a Finding for the given JobSpec.
+func (l *linter) job(severity, check, name, format string, args ...interface{}) {
+	l.findings = append(l.findings, &Finding{
+		Check:    check,
+		Severity: severity,
+		JobSpec:  name,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// sortedTaskNames returns the names of the TaskSpecs in sorted order, so that
+// Findings are deterministic.
+func (l *linter) sortedTaskNames() []string {
+	rv := make([]string, 0, len(l.cfg.Tasks))
+	for name := range l.cfg.Tasks {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// sortedJobNames returns the names of the JobSpecs in sorted order.
+func (l *linter) sortedJobNames() []string {
+	rv := make([]string, 0, len(l.cfg.Jobs))
+	for name := range l.cfg.Jobs {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Lint checks the given TasksCfg for problems. Unlike TasksCfg.Validate, it
+// reports all of the problems it finds rather than stopping at the first. The
+// TasksCfg need not be valid.
+func Lint(ctx context.Context, cfg *specs.TasksCfg, lintCfg *Config) []*Finding {
+	if lintCfg == nil {
+		lintCfg = &Config{}
+	}
+	l := &linter{
+		findings: []*Finding{},
+	}
+	l.checkNil(cfg)
+	l.checkValid()
+	l.checkGraph()
+	l.checkJobs()
+	l.checkCipdPackages()
+	if lintCfg.Cipd != nil {
+		l.checkCipdVersions(ctx, lintCfg.Cipd)
+	}
+	l.checkCaches()
+	l.checkTimeouts(lintCfg)
+	if len(lintCfg.Bots) > 0 {
+		l.checkBots(lintCfg.Bots)
+	}
+	return l.findings
+}
+
+// HasErrors returns true iff any of the given Findings has SEVERITY_ERROR.
+func HasErrors(findings []*Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNil reports TaskSpecs and JobSpecs which are null, as well as null
+// CIPD packages and caches within TaskSpecs. It sets the linter's TasksCfg to
+// a copy of the given TasksCfg without them, so that the other checks need not
+// handle them.
+func (l *linter) checkNil(cfg *specs.TasksCfg) {
+	l.cfg = &specs.TasksCfg{
+		Jobs:  make(map[string]*specs.JobSpec, len(cfg.Jobs)),
+		Tasks: make(map[string]*specs.TaskSpec, len(cfg.Tasks)),
+	}
+	taskNames := make([]string, 0, len(cfg.Tasks))
+	for name := range cfg.Tasks {
+		taskNames = append(taskNames, name)
+	}
+	sort.Strings(taskNames)
+	for _, name := range taskNames {
+		t := cfg.Tasks[name]
+		if t == nil {
+			l.task(SEVERITY_ERROR, CHECK_INVALID_TASK, name, "Task is null.")
+			continue
+		}
+		pkgs := make([]*specs.CipdPackage, 0, len(t.CipdPackages))
+		for _, p := range t.CipdPackages {
+			if p == nil {
+				l.task(SEVERITY_ERROR, CHECK_INVALID_CIPD_PACKAGE, name, "CIPD package is null.")
+				continue
+			}
+			pkgs = append(pkgs, p)
+		}
+		caches := make([]*specs.Cache, 0, len(t.Caches))
+		for _, c := range t.Caches {
+			if c == nil {
+				l.task(SEVERITY_ERROR, CHECK_INVALID_TASK, name, "Cache is null.")
+				continue
+			}
+			caches = append(caches, c)
+		}
+		if len(pkgs) != len(t.CipdPackages) || len(caches) != len(t.Caches) {
+			cpy := *t
+			cpy.CipdPackages = pkgs
+			cpy.Caches = caches
+			t = &cpy
+		}
+		l.cfg.Tasks[name] = t
+	}
+	jobNames := make([]string, 0, len(cfg.Jobs))
+	for name := range cfg.Jobs {
+		jobNames = append(jobNames, name)
+	}
+	sort.Strings(jobNames)
+	for _, name := range jobNames {
+		j := cfg.Jobs[name]
+		if j == nil {
+			l.job(SEVERITY_ERROR, CHECK_INVALID_JOB, name, "Job is null.")
+			continue
+		}
+		l.cfg.Jobs[name] = j
+	}
+}
+
+// checkValid runs the validation performed by the Task Scheduler on each
+// TaskSpec and JobSpec.
+func (l *linter) checkValid() {
+	for _, name := range l.sortedTaskNames() {
+		if err := l.cfg.Tasks[name].Validate(l.cfg); err != nil {
+			l.task(SEVERITY_ERROR, CHECK_INVALID_TASK, name, "%s", err)
+		}
+	}
+	for _, name := range l.sortedJobNames() {
+		if err := l.cfg.Jobs[name].Validate(); err != nil {
+			l.job(SEVERITY_ERROR, CHECK_INVALID_JOB, name, "%s", err)
+		}
+	}
+}
+
+// checkGraph reports unknown dependencies, dependency cycles, on_success chain
+// problems, and TaskSpecs which are not reachable from any JobSpec.
+func (l *linter) checkGraph() {
+	for _, name := range l.sortedJobNames() {
+		for _, dep := range l.cfg.Jobs[name].TaskSpecs {
+			if _, ok := l.cfg.Tasks[dep]; !ok {
+				l.job(SEVERITY_ERROR, CHECK_UNKNOWN_DEPENDENCY, name, "Unknown task %q.", dep)
+			}
+		}
+	}
+	for _, name := range l.sortedTaskNames() {
+		for _, dep := range l.cfg.Tasks[name].Dependencies {
+			if _, ok := l.cfg.Tasks[dep]; !ok {
+				l.task(SEVERITY_ERROR, CHECK_UNKNOWN_DEPENDENCY, name, "Unknown task %q.", dep)
+			}
+		}
+	}
+
+	// Find cycles among TaskSpecs.
+	deps := func(name string) []string {
+		rv := []string{}
+		for _, dep := range l.cfg.Tasks[name].Dependencies {
+			if _, ok := l.cfg.Tasks[dep]; ok {
+				rv = append(rv, dep)
+			}
+		}
+		return rv
+	}
+	for _, cycle := range findCycles(l.sortedTaskNames(), deps) {
+		l.task(SEVERITY_ERROR, CHECK_DEPENDENCY_CYCLE, cycle[len(cycle)-2], "Circular dependency: %s", strings.Join(cycle, " -> "))
+	}
+
+	// Downstream JobSpecs in the same repo must exist and must not form a
+	// cycle, or Jobs would be triggered indefinitely.
+	onSuccess := func(name string) []string {
+		rv := []string{}
+		for _, d := range l.cfg.Jobs[name].OnSuccess {
+			if d.Repo == "" && d.Job != "" {
+				if _, ok := l.cfg.Jobs[d.Job]; ok {
+					rv = append(rv, d.Job)
+				}
+			}
+		}
+		return rv
+	}
+	for _, name := range l.sortedJobNames() {
+		for _, d := range l.cfg.Jobs[name].OnSuccess {
+			if d.Repo != "" || d.Job == "" {
+				continue
+			}
+			if _, ok := l.cfg.Jobs[d.Job]; !ok {
+				l.job(SEVERITY_ERROR, CHECK_UNKNOWN_DEPENDENCY, name, "Unknown job %q in on_success.", d.Job)
+			}
+		}
+	}
+	for _, cycle := range findCycles(l.sortedJobNames(), onSuccess) {
+		l.job(SEVERITY_ERROR, CHECK_DEPENDENCY_CYCLE, cycle[len(cycle)-2], "Circular on_success chain: %s", strings.Join(cycle, " -> "))
+	}
+
+	// Find unreachable TaskSpecs.
+	reachable := map[string]bool{}
+	var mark func(string)
+	mark = func(name string) {
+		if reachable[name] {
+			return
+		}
+		t, ok := l.cfg.Tasks[name]
+		if !ok {
+			return
+		}
+		reachable[name] = true
+		for _, dep := range t.Dependencies {
+			mark(dep)
+		}
+	}
+	for _, j := range l.cfg.Jobs {
+		for _, name := range j.TaskSpecs {
+			mark(name)
+		}
+	}
+	for _, name := range l.sortedTaskNames() {
+		if !reachable[name] {
+			l.task(SEVERITY_ERROR, CHECK_UNREACHABLE_TASK, name, "Task is not reachable by any job.")
+		}
+	}
+}
+
+// findCycles performs a depth-first search of the graph with the given nodes,
+// visited in order, and edges, which must only refer to the given nodes. It
+// returns each cycle found as a path which starts and ends at the same node.
+func findCycles(nodes []string, edges func(string) []string) [][]string {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[string]int, len(nodes))
+	stack := []string{}
+	rv := [][]string{}
+	var visit func(string)
+	visit = func(name string) {
+		state[name] = active
+		stack = append(stack, name)
+		for _, next := range edges(name) {
+			if state[next] == active {
+				idx := util.Index(next, stack)
+				rv = append(rv, append(util.CopyStringSlice(stack[idx:]), next))
+			} else if state[next] == unvisited {
+				visit(next)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+	}
+	for _, name := range nodes {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return rv
+}
+
+// checkJobs reports JobSpecs which will never run and JobSpecs which duplicate
+// others.
+func (l *linter) checkJobs() {
+	seen := map[string]string{}
+	for _, name := range l.sortedJobNames() {
+		j := l.cfg.Jobs[name]
+		if len(j.TaskSpecs) == 0 {
+			l.job(SEVERITY_WARNING, CHECK_UNUSED_JOB, name, "Job has no tasks.")
+			continue
+		}
+		if j.Cron == nil && !util.In(j.Trigger, VALID_TRIGGERS) {
+			l.job(SEVERITY_WARNING, CHECK_UNUSED_JOB, name, "Job has unknown trigger %q and will never run automatically.", j.Trigger)
+		}
+		tasks := util.NewStringSet(j.TaskSpecs).Keys()
+		sort.Strings(tasks)
+		cron := ""
+		if j.Cron != nil {
+			cron = j.Cron.Schedule + " " + j.Cron.Timezone
+		}
+		key := strings.Join([]string{strings.Join(tasks, ","), j.Trigger, cron, strings.Join(j.IncludePaths, ","), strings.Join(j.ExcludePaths, ",")}, "|")
+		if other, ok := seen[key]; ok {
+			l.job(SEVERITY_WARNING, CHECK_DUPLICATE_JOB, name, "Job has the same tasks and triggers as %q.", other)
+		} else {
+			seen[key] = name
+		}
+	}
+}
+
+// checkCipdPackages reports CIPD packages with no version and packages which
+// conflict with each other.
+func (l *linter) checkCipdPackages() {
+	for _, name := range l.sortedTaskNames() {
+		byPath := map[string]map[string]string{}
+		for _, p := range l.cfg.Tasks[name].CipdPackages {
+			// Missing names and paths are reported by checkValid.
+			if p.Name == "" || p.Path == "" {
+				continue
+			}
+			if p.Version == "" {
+				l.task(SEVERITY_ERROR, CHECK_INVALID_CIPD_PACKAGE, name, "CIPD package %q at %q has no version.", p.Name, p.Path)
+				continue
+			}
+			pkgs, ok := byPath[p.Path]
+			if !ok {
+				pkgs = map[string]string{}
+				byPath[p.Path] = pkgs
+			}
+			if version, ok := pkgs[p.Name]; ok && version != p.Version {
+				l.task(SEVERITY_ERROR, CHECK_CONFLICTING_CIPD_PACKAGE, name, "CIPD package %q is installed at %q with versions %q and %q.", p.Name, p.Path, version, p.Version)
+			}
+			pkgs[p.Name] = p.Version
+		}
+	}
+}
+
+// checkCipdVersions reports CIPD package versions which cannot be resolved.
+func (l *linter) checkCipdVersions(ctx context.Context, cipd CipdResolver) {
+	// Many TaskSpecs use the same packages; only resolve each once.
+	resolved := map[string]error{}
+	for _, name := range l.sortedTaskNames() {
+		for _, p := range l.cfg.Tasks[name].CipdPackages {
+			// Missing names and versions are reported elsewhere.
+			if p.Name == "" || p.Version == "" {
+				continue
+			}
+			key := p.Name + "@" + p.Version
+			err, ok := resolved[key]
+			if !ok {
+				_, err = cipd.ResolveVersion(ctx, p.Name, p.Version)
+				resolved[key] = err
+			}
+			if err != nil {
+				l.task(SEVERITY_ERROR, CHECK_UNKNOWN_CIPD_VERSION, name, "Failed to resolve version %q of CIPD package %q: %s", p.Version, p.Name, err)
+			}
+		}
+	}
+}
+
+// checkCaches reports caches which conflict with each other.
+func (l *linter) checkCaches() {
+	pathsByCache := map[string]map[string]bool{}
+	for _, name := range l.sortedTaskNames() {
+		byName := map[string]string{}
+		byPath := map[string]string{}
+		for _, c := range l.cfg.Tasks[name].Caches {
+			if path, ok := byName[c.Name]; ok && path != c.Path {
+				l.task(SEVERITY_ERROR, CHECK_CONFLICTING_CACHES, name, "Cache %q is mounted at both %q and %q.", c.Name, path, c.Path)
+			}
+			if other, ok := byPath[c.Path]; ok && other != c.Name {
+				l.task(SEVERITY_ERROR, CHECK_CONFLICTING_CACHES, name, "Caches %q and %q are both mounted at %q.", other, c.Name, c.Path)
+			}
+			byName[c.Name] = c.Path
+			byPath[c.Path] = c.Name
+			if _, ok := pathsByCache[c.Name]; !ok {
+				pathsByCache[c.Name] = map[string]bool{}
+			}
+			pathsByCache[c.Name][c.Path] = true
+		}
+	}
+	names := make([]string, 0, len(pathsByCache))
+	for name := range pathsByCache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(pathsByCache[name]) > 1 {
+			paths := make([]string, 0, len(pathsByCache[name]))
+			for path := range pathsByCache[name] {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			l.findings = append(l.findings, &Finding{
+				Check:    CHECK_CONFLICTING_CACHES,
+				Severity: SEVERITY_WARNING,
+				Message:  fmt.Sprintf("Cache %q is mounted at different paths by different tasks: %v", name, paths),
+			})
+		}
+	}
+}
+
+// checkTimeouts reports TaskSpecs whose timeouts exceed the configured limits.
+func (l *linter) checkTimeouts(cfg *Config) {
+	maxExecution := cfg.MaxExecutionTimeout
+	if maxExecution == 0 {
+		maxExecution = DEFAULT_MAX_EXECUTION_TIMEOUT
+	}
+	maxExpiration := cfg.MaxExpiration
+	if maxExpiration == 0 {
+		maxExpiration = DEFAULT_MAX_EXPIRATION
+	}
+	maxIo := cfg.MaxIoTimeout
+	if maxIo == 0 {
+		maxIo = DEFAULT_MAX_IO_TIMEOUT
+	}
+	for _, name := range l.sortedTaskNames() {
+		t := l.cfg.Tasks[name]
+		if t.ExecutionTimeout > maxExecution {
+			l.task(SEVERITY_WARNING, CHECK_EXCESSIVE_TIMEOUT, name, "Execution timeout %s exceeds %s.", t.ExecutionTimeout, maxExecution)
+		}
+		if t.Expiration > maxExpiration {
+			l.task(SEVERITY_WARNING, CHECK_EXCESSIVE_TIMEOUT, name, "Expiration %s exceeds %s.", t.Expiration, maxExpiration)
+		}
+		if t.IoTimeout > maxIo {
+			l.task(SEVERITY_WARNING, CHECK_EXCESSIVE_TIMEOUT, name, "IO timeout %s exceeds %s.", t.IoTimeout, maxIo)
+		}
+		if t.ExecutionTimeout != 0 && t.IoTimeout > t.ExecutionTimeout {
+			l.task(SEVERITY_WARNING, CHECK_EXCESSIVE_TIMEOUT, name, "IO timeout %s exceeds execution timeout %s.", t.IoTimeout, t.ExecutionTimeout)
+		}
+	}
+}
+
+// checkBots reports TaskSpecs whose dimensions match none of the given bots.
+func (l *linter) checkBots(bots []*types.Machine) {
+	botDims := make([]util.StringSet, 0, len(bots))
+	for _, b := range bots {
+		botDims = append(botDims, util.NewStringSet(b.Dimensions))
+	}
+	for _, name := range l.sortedTaskNames() {
+		t := l.cfg.Tasks[name]
+		found := false
+		for _, dims := range botDims {
+			match := true
+			for _, d := range t.Dimensions {
+				if !dims[d] {
+					match = false
+					break
+				}
+			}
+			if match {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l.task(SEVERITY_ERROR, CHECK_NO_MATCHING_BOT, name, "No bot matches dimensions %v.", t.Dimensions)
+		}
+	}
+}
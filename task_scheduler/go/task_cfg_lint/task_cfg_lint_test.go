@@ -0,0 +1,284 @@
+package task_cfg_lint
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.chromium.org/luci/cipd/common"
+	"go.skia.org/infra/go/testutils/unittest"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/types"
+)
+
+// task returns a valid TaskSpec with the given dependencies.
+func task(deps ...string) *specs.TaskSpec {
+	return &specs.TaskSpec{
+		Dependencies: deps,
+		Dimensions:   []string{"os:Linux", "pool:Skia"},
+		Isolate:      "compile.isolate",
+	}
+}
+
+// assertFindings asserts that the given Findings have the expected checks and
+// subjects, in order.
+func assertFindings(t *testing.T, findings []*Finding, expect ...string) {
+	actual := make([]string, 0, len(findings))
+	for _, f := range findings {
+		actual = append(actual, f.Check+" "+f.TaskSpec+f.JobSpec)
+	}
+	require.Equal(t, expect, actual)
+}
+
+func TestLintValid(t *testing.T) {
+	unittest.SmallTest(t)
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"Build": task(),
+			"Test":  task("Build"),
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Test": {TaskSpecs: []string{"Test"}},
+		},
+	}
+	findings := Lint(context.Background(), cfg, &Config{
+		Bots: []*types.Machine{
+			{ID: "bot1", Dimensions: []string{"os:Linux", "os:Ubuntu", "pool:Skia"}},
+		},
+	})
+	require.Empty(t, findings)
+	require.False(t, HasErrors(findings))
+}
+
+func TestLintGraph(t *testing.T) {
+	unittest.SmallTest(t)
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A":      task("C"),
+			"B":      task("A"),
+			"C":      task("B", "Missing"),
+			"Orphan": task(),
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Job":   {TaskSpecs: []string{"A"}},
+			"Other": {TaskSpecs: []string{"Unknown"}},
+		},
+	}
+	findings := Lint(context.Background(), cfg, nil)
+	assertFindings(t, findings,
+		"unknown_dependency Other",
+		"unknown_dependency C",
+		"dependency_cycle B",
+		"unreachable_task Orphan",
+	)
+	require.Equal(t, "Circular dependency: A -> C -> B -> A", findings[2].Message)
+	require.True(t, HasErrors(findings))
+}
+
+func TestLintJobs(t *testing.T) {
+	unittest.SmallTest(t)
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A": task(),
+			"B": task(),
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Empty":     {},
+			"Job":       {TaskSpecs: []string{"A", "B"}},
+			"Job2":      {TaskSpecs: []string{"B", "A"}},
+			"Nightly":   {TaskSpecs: []string{"A", "B"}, Trigger: specs.TRIGGER_NIGHTLY},
+			"Typo":      {TaskSpecs: []string{"A"}, Trigger: "nightlly"},
+			"BadCron":   {TaskSpecs: []string{"A"}, Cron: &specs.CronTrigger{Schedule: "bogus"}},
+			"GoodCron":  {TaskSpecs: []string{"A"}, Cron: &specs.CronTrigger{Schedule: "0 3 * * *"}},
+			"GoodCron2": {TaskSpecs: []string{"A"}, Cron: &specs.CronTrigger{Schedule: "0 4 * * *"}},
+		},
+	}
+	findings := Lint(context.Background(), cfg, nil)
+	assertFindings(t, findings,
+		"invalid_job BadCron",
+		"unused_job Empty",
+		"duplicate_job Job2",
+		"unused_job Typo",
+	)
+	require.False(t, HasErrors(findings[1:]))
+}
+
+func TestLintCipdPackagesAndCaches(t *testing.T) {
+	unittest.SmallTest(t)
+	a := task()
+	a.CipdPackages = []*specs.CipdPackage{
+		{Name: "go", Path: "go", Version: "1"},
+		{Name: "go", Path: "go", Version: "2"},
+		{Name: "git", Path: "git"},
+		{Name: "go", Path: "other_go", Version: "2"},
+	}
+	a.Caches = []*specs.Cache{
+		{Name: "git", Path: "cache/git"},
+		{Name: "work", Path: "cache/git"},
+		{Name: "vpython", Path: "cache/vpython"},
+	}
+	b := task()
+	b.Caches = []*specs.Cache{
+		{Name: "vpython", Path: "cache/py"},
+		{Name: "vpython", Path: "cache/vpython"},
+	}
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A": a,
+			"B": b,
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Job": {TaskSpecs: []string{"A", "B"}},
+		},
+	}
+	findings := Lint(context.Background(), cfg, nil)
+	assertFindings(t, findings,
+		"conflicting_cipd_package A",
+		"invalid_cipd_package A",
+		"conflicting_caches A",
+		"conflicting_caches B",
+		"conflicting_caches ",
+	)
+	require.Equal(t, SEVERITY_WARNING, findings[4].Severity)
+	require.Equal(t, `Cache "vpython" is mounted at different paths by different tasks: [cache/py cache/vpython]`, findings[4].Message)
+}
+
+func TestLintTimeoutsAndBots(t *testing.T) {
+	unittest.SmallTest(t)
+	a := task()
+	a.ExecutionTimeout = 5 * time.Hour
+	a.Expiration = 48 * time.Hour
+	b := task()
+	b.ExecutionTimeout = 10 * time.Minute
+	b.IoTimeout = 20 * time.Minute
+	b.Dimensions = []string{"os:Mac"}
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A": a,
+			"B": b,
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Job": {TaskSpecs: []string{"A", "B"}},
+		},
+	}
+	bots := []*types.Machine{
+		{ID: "bot1", Dimensions: []string{"os:Linux", "pool:Skia"}},
+		{ID: "bot2", Dimensions: []string{"os:Mac", "pool:Other"}},
+	}
+	findings := Lint(context.Background(), cfg, &Config{Bots: bots})
+	assertFindings(t, findings,
+		"excessive_timeout A",
+		"excessive_timeout A",
+		"excessive_timeout B",
+	)
+
+	// Custom limits.
+	b.Dimensions = []string{"os:Mac", "pool:Skia"}
+	findings = Lint(context.Background(), cfg, &Config{
+		Bots:                bots,
+		MaxExecutionTimeout: 6 * time.Hour,
+		MaxExpiration:       72 * time.Hour,
+		MaxIoTimeout:        10 * time.Minute,
+	})
+	assertFindings(t, findings,
+		"excessive_timeout B",
+		"excessive_timeout B",
+		"no_matching_bot B",
+	)
+	require.Equal(t, "No bot matches dimensions [os:Mac pool:Skia].", findings[2].Message)
+}
+
+func TestLintJobChains(t *testing.T) {
+	unittest.SmallTest(t)
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A": task(),
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Build": {TaskSpecs: []string{"A"}, OnSuccess: []*specs.DownstreamJob{{Job: "Test"}, {Job: "Deploy", Repo: "https://other.git"}}},
+			"Test":  {TaskSpecs: []string{"A"}, Trigger: specs.TRIGGER_ON_DEMAND, OnSuccess: []*specs.DownstreamJob{{Job: "Build"}, {Job: "Missing"}}},
+		},
+	}
+	findings := Lint(context.Background(), cfg, nil)
+	assertFindings(t, findings,
+		"unknown_dependency Test",
+		"dependency_cycle Test",
+	)
+	require.Equal(t, "Circular on_success chain: Build -> Test -> Build", findings[1].Message)
+}
+
+func TestLintNull(t *testing.T) {
+	unittest.SmallTest(t)
+	a := task()
+	a.CipdPackages = []*specs.CipdPackage{nil, {Name: "pkg", Path: "pkg", Version: "version:1"}}
+	a.Caches = []*specs.Cache{nil}
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A":    a,
+			"Null": nil,
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Job":  {TaskSpecs: []string{"A", "Null"}},
+			"Null": nil,
+		},
+	}
+	findings := Lint(context.Background(), cfg, nil)
+	assertFindings(t, findings,
+		"invalid_cipd_package A",
+		"invalid_task A",
+		"invalid_task Null",
+		"invalid_job Null",
+		"unknown_dependency Job",
+	)
+	// The given TasksCfg is not modified.
+	require.Len(t, cfg.Tasks["A"].CipdPackages, 2)
+	require.Len(t, cfg.Tasks["A"].Caches, 1)
+}
+
+// fakeCipd is a CipdResolver which knows about a fixed set of package
+// versions and records the lookups.
+type fakeCipd struct {
+	known   map[string]bool
+	lookups []string
+}
+
+func (c *fakeCipd) ResolveVersion(_ context.Context, pkg, version string) (common.Pin, error) {
+	key := pkg + "@" + version
+	c.lookups = append(c.lookups, key)
+	if !c.known[key] {
+		return common.Pin{}, errors.New("no such ref")
+	}
+	return common.Pin{PackageName: pkg, InstanceID: "abc123"}, nil
+}
+
+func TestLintCipdVersions(t *testing.T) {
+	unittest.SmallTest(t)
+	a := task()
+	a.CipdPackages = []*specs.CipdPackage{
+		{Name: "go", Path: "go", Version: "version:1"},
+		{Name: "git", Path: "git", Version: "version:bogus"},
+	}
+	b := task()
+	b.CipdPackages = []*specs.CipdPackage{
+		{Name: "go", Path: "go", Version: "version:1"},
+	}
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			"A": a,
+			"B": b,
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"Job": {TaskSpecs: []string{"A", "B"}},
+		},
+	}
+	c := &fakeCipd{
+		known: map[string]bool{"go@version:1": true},
+	}
+	findings := Lint(context.Background(), cfg, &Config{Cipd: c})
+	assertFindings(t, findings, "unknown_cipd_version A")
+	require.Equal(t, "Failed to resolve version \"version:bogus\" of CIPD package \"git\": no such ref", findings[0].Message)
+	// Each package version is only resolved once.
+	require.Equal(t, []string{"go@version:1", "git@version:bogus"}, c.lookups)
+}
@@ -144,6 +144,10 @@ func (c *TestClient) ListTasks(start, end time.Time, tags []string, state string
 	return rv, nil
 }
 
+func (c *TestClient) ListBotEvents(botID string, start, end time.Time) ([]*swarming_api.SwarmingRpcsBotEvent, error) {
+	return nil, nil
+}
+
 func (c *TestClient) ListBotTasks(botID string, limit int) ([]*swarming_api.SwarmingRpcsTaskResult, error) {
 	// For now, just return all tasks in the list.  This could probably be better.
 	c.taskListMtx.RLock()
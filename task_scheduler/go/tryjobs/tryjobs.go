@@ -403,6 +403,10 @@ func (t *TryJobIntegrator) insertNewJob(ctx context.Context, buildId int64) erro
 	if err != nil {
 		return t.remoteCancelBuild(buildId, fmt.Sprintf("Failed to create Job from JobSpec: %s @ %+v: %s", build.Builder.Builder, rs, err))
 	}
+	skipReason, err := t.getSkipReason(ctx, rs, j.Name, gerritChange.Change)
+	if err != nil {
+		return err
+	}
 	requested, err := ptypes.Timestamp(build.CreateTime)
 	if err != nil {
 		return t.remoteCancelBuild(buildId, fmt.Sprintf("Failed to convert timestamp for %d: %s", build.Id, err))
@@ -433,9 +437,17 @@ func (t *TryJobIntegrator) insertNewJob(ctx context.Context, buildId int64) erro
 		return err
 	}
 
-	// Update the job and insert into the DB.
+	// Update the job and insert into the DB. If the Job doesn't apply to
+	// the files changed in the patch, insert it as already finished; we'll
+	// report it to Buildbucket along with the other finished Jobs.
 	j.BuildbucketBuildId = buildId
 	j.BuildbucketLeaseKey = leaseKey
+	if skipReason != "" {
+		sklog.Infof("Skipping try job %s for build %d: %s", j.Name, buildId, skipReason)
+		j.Status = types.JOB_STATUS_SKIPPED
+		j.StatusDetails = skipReason
+		j.Finished = j.Created
+	}
 	if err := t.db.PutJob(j); err != nil {
 		return t.remoteCancelBuild(buildId, fmt.Sprintf("Failed to insert Job into the DB: %s", err))
 	}
@@ -457,6 +469,35 @@ func (t *TryJobIntegrator) insertNewJob(ctx context.Context, buildId int64) erro
 	return nil
 }
 
+// getSkipReason returns the reason why the given Job should not run for the
+// patch in the given RepoState, or the empty string if it should run.
+func (t *TryJobIntegrator) getSkipReason(ctx context.Context, rs types.RepoState, jobName string, issue int64) (string, error) {
+	cfg, err := t.taskCfgCache.Get(ctx, rs)
+	if err != nil {
+		return "", err
+	}
+	spec, ok := cfg.Jobs[jobName]
+	if !ok {
+		return "", fmt.Errorf("No such job: %s", jobName)
+	}
+	if !spec.HasPathFilters() {
+		return "", nil
+	}
+	files, err := t.gerrit.GetFileNames(ctx, issue, rs.Patchset)
+	if err != nil {
+		return "", fmt.Errorf("Failed to obtain changed files for %s: %s", rs, err)
+	}
+	// Gerrit includes "magic" files like /COMMIT_MSG which don't exist in
+	// the repo.
+	changedFiles := make([]string, 0, len(files))
+	for _, f := range files {
+		if !strings.HasPrefix(f, "/") {
+			changedFiles = append(changedFiles, f)
+		}
+	}
+	return spec.PathFilterSkipReason(changedFiles), nil
+}
+
 func (t *TryJobIntegrator) Poll(ctx context.Context) error {
 	if err := t.jCache.Update(); err != nil {
 		return err
@@ -536,7 +577,7 @@ func (t *TryJobIntegrator) jobFinished(j *types.Job) error {
 	if err != nil {
 		return err
 	}
-	if j.Status == types.JOB_STATUS_SUCCESS {
+	if j.Status == types.JOB_STATUS_SUCCESS || j.Status == types.JOB_STATUS_SKIPPED {
 		resp, err := t.bb.Succeed(j.BuildbucketBuildId, &buildbucket_api.LegacyApiSucceedRequestBodyMessage{
 			LeaseKey:          j.BuildbucketLeaseKey,
 			ResultDetailsJson: string(b),
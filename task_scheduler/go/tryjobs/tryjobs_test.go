@@ -17,6 +17,7 @@ import (
 	"go.skia.org/infra/go/mockhttpclient"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/specs"
 	"go.skia.org/infra/task_scheduler/go/types"
 )
 
@@ -377,6 +378,77 @@ func TestInsertNewJob(t *testing.T) {
 	require.True(t, mock.Empty())
 }
 
+func mockGetFiles(t *testing.T, mock *mockhttpclient.URLMock, files ...string) {
+	fileInfos := make(map[string]*gerrit.FileInfo, len(files))
+	for _, f := range files {
+		fileInfos[f] = &gerrit.FileInfo{}
+	}
+	b, err := json.Marshal(fileInfos)
+	require.NoError(t, err)
+	b = append([]byte("XSS\n"), b...)
+	mock.Mock(fmt.Sprintf("%s/a/changes/%d/revisions/%d/files", fakeGerritUrl, gerritIssue, gerritPatchset), mockhttpclient.MockGetDialogue(b))
+}
+
+func TestGetSkipReason(t *testing.T) {
+	ctx, trybots, gb, mock, _, cleanup := setup(t)
+	defer cleanup()
+
+	rs := types.RepoState{
+		Patch:    gerritPatch,
+		Repo:     gb.RepoUrl(),
+		Revision: trybots.rm[gb.RepoUrl()].Get("master").Hash,
+	}
+	rs.Patch.PatchRepo = rs.Repo
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			"no-filters": {
+				TaskSpecs: []string{"fake-task"},
+			},
+			"src-only": {
+				IncludePaths: []string{"src/**"},
+				TaskSpecs:    []string{"fake-task"},
+			},
+			"not-docs": {
+				ExcludePaths: []string{"docs/**"},
+				TaskSpecs:    []string{"fake-task"},
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			"fake-task": {
+				Dimensions: []string{"pool:Skia"},
+				Isolate:    "fake1.isolate",
+			},
+		},
+	}
+	require.NoError(t, trybots.taskCfgCache.Set(ctx, rs, cfg, nil))
+
+	test := func(job string, files []string, expect string) {
+		if files != nil {
+			mockGetFiles(t, mock, files...)
+		}
+		reason, err := trybots.getSkipReason(ctx, rs, job, gerritIssue)
+		require.NoError(t, err)
+		require.Equal(t, expect, reason)
+		require.True(t, mock.Empty())
+	}
+
+	// Jobs without path filters don't need the changed files.
+	test("no-filters", nil, "")
+
+	// The patch changes a file matching include_paths. Gerrit's magic
+	// files are ignored.
+	test("src-only", []string{"/COMMIT_MSG", "src/foo/bar.cc"}, "")
+	test("not-docs", []string{"/COMMIT_MSG", "src/foo/bar.cc"}, "")
+
+	// The patch changes only files matching exclude_paths.
+	test("src-only", []string{"/COMMIT_MSG", "docs/README.md"}, "No changed files match include_paths [src/**]")
+	test("not-docs", []string{"/COMMIT_MSG", "docs/README.md"}, "All changed files match exclude_paths [docs/**]")
+
+	// Unknown Job.
+	_, err := trybots.getSkipReason(ctx, rs, "bogus-job", gerritIssue)
+	require.EqualError(t, err, "No such job: bogus-job")
+}
+
 func mockGetChangeInfo(t *testing.T, mock *mockhttpclient.URLMock, id int, project, branch string) {
 	issueBytes, err := json.Marshal(&gerrit.ChangeInfo{
 		Id:      strconv.FormatInt(gerritIssue, 10),
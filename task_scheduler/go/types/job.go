@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
 )
 
 const (
@@ -29,17 +30,31 @@ const (
 	// JOB_STATUS_CANCELED indicates that the Job has been canceled.
 	JOB_STATUS_CANCELED JobStatus = "CANCELED"
 
+	// JOB_STATUS_SKIPPED indicates that the Job was not run because its
+	// JobSpec does not apply to the commit or patch, eg. because none of
+	// the changed files match its path filters. The Job's StatusDetails
+	// field contains the reason.
+	JOB_STATUS_SKIPPED JobStatus = "SKIPPED"
+
 	// JOB_URL_TMPL is a template for Job URLs.
 	JOB_URL_TMPL = "%s/job/%s"
 
 	// DEFAULT_MAX_TASK_ATTEMPTS is the maximum number of attempts we'll
 	// make of each TaskSpec in a Job.
 	DEFAULT_MAX_TASK_ATTEMPTS = 2
+
+	// Trigger types describe why a Job was created. See Job.TriggerType.
+	TRIGGER_TYPE_COMMIT   = "commit"
+	TRIGGER_TYPE_FORCED   = "forced"
+	TRIGGER_TYPE_PERIODIC = "periodic"
+	TRIGGER_TYPE_TRYJOB   = "tryjob"
+	TRIGGER_TYPE_UPSTREAM = "upstream"
 )
 
 var (
 	JOB_STATUS_BADNESS = map[JobStatus]int{
 		JOB_STATUS_SUCCESS:     0,
+		JOB_STATUS_SKIPPED:     0,
 		JOB_STATUS_IN_PROGRESS: 1,
 		JOB_STATUS_CANCELED:    2,
 		JOB_STATUS_FAILURE:     3,
@@ -51,6 +66,14 @@ var (
 		JOB_STATUS_FAILURE,
 		JOB_STATUS_MISHAP,
 		JOB_STATUS_CANCELED,
+		JOB_STATUS_SKIPPED,
+	}
+	TRIGGER_TYPES = []string{
+		TRIGGER_TYPE_COMMIT,
+		TRIGGER_TYPE_FORCED,
+		TRIGGER_TYPE_PERIODIC,
+		TRIGGER_TYPE_TRYJOB,
+		TRIGGER_TYPE_UPSTREAM,
 	}
 )
 
@@ -103,6 +126,10 @@ type Job struct {
 	// TODO(borenet): Maybe this doesn't belong in the DB.
 	BuildbucketLeaseKey int64 `json:"buildbucketLeaseKey"`
 
+	// ChainDepth is the number of upstream Jobs which led to this Job
+	// being triggered, or zero if it was not triggered by another Job.
+	ChainDepth int `json:"chainDepth,omitempty"`
+
 	// Created is the creation timestamp. This property should never change
 	// for a given Job instance.
 	Created time.Time `json:"created"`
@@ -149,10 +176,27 @@ type Job struct {
 	// Status is the current Job status, default JOB_STATUS_IN_PROGRESS.
 	Status JobStatus `json:"status"`
 
+	// StatusDetails provides additional information about the Status, eg.
+	// the reason why the Job was skipped.
+	StatusDetails string `json:"statusDetails,omitempty"`
+
 	// Tasks are the Task instances which satisfied the dependencies of
 	// the Job. Keys are TaskSpec names and values are slices of TaskSummary
 	// instances describing the Tasks.
 	Tasks map[string][]*TaskSummary `json:"tasks"`
+
+	// UpstreamJobId is the ID of the Job whose success triggered this Job,
+	// if any. See specs.JobSpec.OnSuccess.
+	UpstreamJobId string `json:"upstreamJobId,omitempty"`
+
+	// UpstreamOutputs are the isolated outputs of the upstream Job's
+	// Tasks, which are passed as inputs to this Job's Tasks.
+	UpstreamOutputs []string `json:"upstreamOutputs,omitempty"`
+
+	// UpstreamRepo and UpstreamRevision describe the RepoState of the
+	// upstream Job, which may be in a different repo.
+	UpstreamRepo     string `json:"upstreamRepo,omitempty"`
+	UpstreamRevision string `json:"upstreamRevision,omitempty"`
 }
 
 // Copy returns a copy of the Job.
@@ -180,6 +224,7 @@ func (j *Job) Copy() *Job {
 	return &Job{
 		BuildbucketBuildId:  j.BuildbucketBuildId,
 		BuildbucketLeaseKey: j.BuildbucketLeaseKey,
+		ChainDepth:          j.ChainDepth,
 		Created:             j.Created,
 		DbModified:          j.DbModified,
 		Dependencies:        deps,
@@ -191,26 +236,82 @@ func (j *Job) Copy() *Job {
 		RepoState:           j.RepoState.Copy(),
 		Requested:           j.Requested,
 		Status:              j.Status,
+		StatusDetails:       j.StatusDetails,
 		Tasks:               tasks,
+		UpstreamJobId:       j.UpstreamJobId,
+		UpstreamOutputs:     util.CopyStringSlice(j.UpstreamOutputs),
+		UpstreamRepo:        j.UpstreamRepo,
+		UpstreamRevision:    j.UpstreamRevision,
 	}
 }
 
+// IsDownstream returns true iff the Job was triggered by the success of
+// another Job.
+func (j *Job) IsDownstream() bool {
+	return j.UpstreamJobId != ""
+}
+
 func (j *Job) Done() bool {
 	return j.Status != JOB_STATUS_IN_PROGRESS
 }
 
-// MakeTaskKey returns a TaskKey for the given Task name.
+// MakeTaskKey returns a TaskKey for the given Task name. Like forced Jobs,
+// downstream Jobs have their own Tasks, since they receive inputs from the
+// upstream Job.
 func (j *Job) MakeTaskKey(taskName string) TaskKey {
 	rv := TaskKey{
 		RepoState: j.RepoState.Copy(),
 		Name:      taskName,
 	}
-	if j.IsForce {
+	if j.IsForce || j.IsDownstream() {
 		rv.ForcedJobId = j.Id
 	}
 	return rv
 }
 
+// TriggerType returns the trigger type of the Job. The Job does not record
+// whether its JobSpec is periodic, so the caller must provide that.
+func (j *Job) TriggerType(isPeriodic bool) string {
+	if j.IsTryJob() {
+		return TRIGGER_TYPE_TRYJOB
+	} else if j.IsForce {
+		return TRIGGER_TYPE_FORCED
+	} else if j.IsDownstream() {
+		return TRIGGER_TYPE_UPSTREAM
+	} else if isPeriodic {
+		return TRIGGER_TYPE_PERIODIC
+	}
+	return TRIGGER_TYPE_COMMIT
+}
+
+// TaskTriggerType returns the trigger type of a task with the given TaskKey
+// which is needed by the given Jobs. The trigger types of the Jobs are obtained
+// using the given function. A task is only considered periodic if all of its
+// Jobs are periodic.
+func TaskTriggerType(k TaskKey, jobs []*Job, jobTriggerType func(*Job) string) string {
+	if k.IsTryJob() {
+		return TRIGGER_TYPE_TRYJOB
+	}
+	if k.IsForceRun() {
+		// Downstream Jobs have their own Tasks, like forced Jobs.
+		for _, j := range jobs {
+			if j.Id == k.ForcedJobId && j.IsDownstream() {
+				return TRIGGER_TYPE_UPSTREAM
+			}
+		}
+		return TRIGGER_TYPE_FORCED
+	}
+	if len(jobs) == 0 {
+		return TRIGGER_TYPE_COMMIT
+	}
+	for _, j := range jobs {
+		if jobTriggerType(j) != TRIGGER_TYPE_PERIODIC {
+			return TRIGGER_TYPE_COMMIT
+		}
+	}
+	return TRIGGER_TYPE_PERIODIC
+}
+
 // URL returns a URL for the Job.
 func (j *Job) URL(taskSchedulerHost string) string {
 	return fmt.Sprintf(JOB_URL_TMPL, taskSchedulerHost, j.Id)
@@ -248,22 +349,46 @@ func (j *Job) TraverseDependencies(fn func(string) error) error {
 // DeriveStatus derives a JobStatus based on the TaskStatuses in the Job's
 // dependency tree.
 func (j *Job) DeriveStatus() JobStatus {
+	return j.DeriveStatusWithQuarantine(nil)
+}
+
+// DeriveStatusWithQuarantine derives a JobStatus based on the TaskStatuses in
+// the Job's dependency tree. If isQuarantined is not nil, failures of TaskSpecs
+// for which it returns true do not cause the Job to fail, and TaskSpecs which
+// depend on them are not required to run.
+func (j *Job) DeriveStatusWithQuarantine(isQuarantined func(string) bool) JobStatus {
 	if len(j.Tasks) == 0 {
 		return JOB_STATUS_IN_PROGRESS
 	}
 	worstStatus := JOB_STATUS_SUCCESS
+	// TaskSpecs which cannot run because a quarantined dependency failed.
+	blocked := map[string]bool{}
 	if err := j.TraverseDependencies(func(name string) error {
+		for _, d := range j.Dependencies[name] {
+			if blocked[d] {
+				blocked[name] = true
+			}
+		}
 		tasks, ok := j.Tasks[name]
 		if !ok || len(tasks) == 0 {
-			worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_IN_PROGRESS)
+			if !blocked[name] {
+				worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_IN_PROGRESS)
+			}
 			return nil
 		}
 
 		// We may have more than one Task for this spec, due to
 		// retrying of failed Tasks. We should not return a "failed"
 		// result if we still have retry attempts remaining or if we've
-		// already retried and succeeded.
-		maxAttempts := tasks[0].MaxAttempts
+		// already retried and succeeded. Suspected flakes may be
+		// given extra attempts, so use the largest MaxAttempts of any
+		// of the Tasks.
+		maxAttempts := 0
+		for _, t := range tasks {
+			if t.MaxAttempts > maxAttempts {
+				maxAttempts = t.MaxAttempts
+			}
+		}
 		if maxAttempts == 0 {
 			maxAttempts = DEFAULT_MAX_TASK_ATTEMPTS
 		}
@@ -277,6 +402,10 @@ func (j *Job) DeriveStatus() JobStatus {
 		}
 		if bestStatus == JOB_STATUS_SUCCESS || bestStatus == JOB_STATUS_IN_PROGRESS {
 			worstStatus = WorseJobStatus(worstStatus, bestStatus)
+		} else if isQuarantined != nil && isQuarantined(name) {
+			// Quarantined TaskSpecs are not retried, and their
+			// failures don't count against the Job.
+			blocked[name] = true
 		} else if canRetry {
 			worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_IN_PROGRESS)
 		} else {
@@ -106,3 +106,115 @@ func TestJobDeriveStatus(t *testing.T) {
 	t3.Status = TASK_STATUS_SUCCESS
 	require.Equal(t, j1.DeriveStatus(), JOB_STATUS_SUCCESS)
 }
+
+func TestJobDeriveStatusExtraAttempts(t *testing.T) {
+	unittest.SmallTest(t)
+	j := &Job{
+		Dependencies: map[string][]string{"build": {}},
+		Name:         "j",
+		Tasks: map[string][]*TaskSummary{
+			"build": {
+				{Status: TASK_STATUS_FAILURE, MaxAttempts: 2},
+				{Status: TASK_STATUS_FAILURE, MaxAttempts: 2},
+			},
+		},
+	}
+	require.Equal(t, JOB_STATUS_FAILURE, j.DeriveStatus())
+
+	// The retry was given an extra attempt because the TaskSpec is a
+	// suspected flake.
+	j.Tasks["build"][1].MaxAttempts = 3
+	require.Equal(t, JOB_STATUS_IN_PROGRESS, j.DeriveStatus())
+	j.Tasks["build"] = append(j.Tasks["build"], &TaskSummary{Status: TASK_STATUS_SUCCESS, MaxAttempts: 3})
+	require.Equal(t, JOB_STATUS_SUCCESS, j.DeriveStatus())
+}
+
+func TestJobDeriveStatusWithQuarantine(t *testing.T) {
+	unittest.SmallTest(t)
+	j := &Job{
+		Dependencies: map[string][]string{
+			"build":  {},
+			"test":   {"build"},
+			"perf":   {"build"},
+			"upload": {"perf"},
+		},
+		Name: "j",
+		Tasks: map[string][]*TaskSummary{
+			"build":  {{Status: TASK_STATUS_SUCCESS}},
+			"test":   {{Status: TASK_STATUS_FAILURE, MaxAttempts: 1}},
+			"perf":   {{Status: TASK_STATUS_SUCCESS}},
+			"upload": {{Status: TASK_STATUS_SUCCESS}},
+		},
+	}
+	quarantined := map[string]bool{}
+	isQuarantined := func(name string) bool {
+		return quarantined[name]
+	}
+	require.Equal(t, JOB_STATUS_FAILURE, j.DeriveStatusWithQuarantine(isQuarantined))
+
+	// Failures of quarantined TaskSpecs don't fail the Job.
+	quarantined["test"] = true
+	require.Equal(t, JOB_STATUS_SUCCESS, j.DeriveStatusWithQuarantine(isQuarantined))
+
+	// Quarantined TaskSpecs are not retried.
+	j.Tasks["test"][0].MaxAttempts = 2
+	require.Equal(t, JOB_STATUS_SUCCESS, j.DeriveStatusWithQuarantine(isQuarantined))
+
+	// Tasks which depend on a failed, quarantined TaskSpec can't run, so
+	// the Job shouldn't wait for them.
+	quarantined["perf"] = true
+	j.Tasks["perf"][0].Status = TASK_STATUS_MISHAP
+	j.Tasks["perf"][0].MaxAttempts = 1
+	delete(j.Tasks, "upload")
+	require.Equal(t, JOB_STATUS_SUCCESS, j.DeriveStatusWithQuarantine(isQuarantined))
+
+	// Quarantined TaskSpecs which are still running hold up the Job.
+	j.Tasks["perf"][0].Status = TASK_STATUS_RUNNING
+	require.Equal(t, JOB_STATUS_IN_PROGRESS, j.DeriveStatusWithQuarantine(isQuarantined))
+
+	// Without the quarantine, the Job fails.
+	j.Tasks["perf"][0].Status = TASK_STATUS_MISHAP
+	require.Equal(t, JOB_STATUS_MISHAP, j.DeriveStatus())
+}
+
+func TestTaskTriggerType(t *testing.T) {
+	unittest.SmallTest(t)
+
+	now := time.Now()
+	periodic := map[string]bool{}
+	jobTriggerType := func(j *Job) string {
+		return j.TriggerType(periodic[j.Id])
+	}
+	j1 := MakeTestJob(now)
+	j1.Id = "j1"
+	j1.Revision = "abc123"
+	j2 := MakeTestJob(now)
+	j2.Id = "j2"
+	j2.Revision = "abc123"
+	k := j1.MakeTaskKey("task")
+
+	require.Equal(t, TRIGGER_TYPE_COMMIT, TaskTriggerType(k, nil, jobTriggerType))
+	require.Equal(t, TRIGGER_TYPE_COMMIT, TaskTriggerType(k, []*Job{j1, j2}, jobTriggerType))
+
+	// A task is only periodic if all of its Jobs are periodic.
+	periodic[j1.Id] = true
+	require.Equal(t, TRIGGER_TYPE_COMMIT, TaskTriggerType(k, []*Job{j1, j2}, jobTriggerType))
+	periodic[j2.Id] = true
+	require.Equal(t, TRIGGER_TYPE_PERIODIC, TaskTriggerType(k, []*Job{j1, j2}, jobTriggerType))
+
+	// Forced and downstream Jobs have their own tasks.
+	j1.IsForce = true
+	k = j1.MakeTaskKey("task")
+	require.Equal(t, TRIGGER_TYPE_FORCED, TaskTriggerType(k, []*Job{j1}, jobTriggerType))
+	j1.IsForce = false
+	j1.UpstreamJobId = "upstream"
+	k = j1.MakeTaskKey("task")
+	require.Equal(t, TRIGGER_TYPE_UPSTREAM, TaskTriggerType(k, []*Job{j1}, jobTriggerType))
+
+	// Try jobs.
+	k = j2.MakeTaskKey("task")
+	k.Server = "https://skia-review.googlesource.com"
+	k.Issue = "12345"
+	k.Patchset = "1"
+	require.Equal(t, TRIGGER_TYPE_TRYJOB, TaskTriggerType(k, []*Job{j2}, jobTriggerType))
+}
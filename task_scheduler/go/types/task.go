@@ -143,6 +143,16 @@ type Task struct {
 	// RetryOf is the ID of the task which this task is a retry of, if any.
 	RetryOf string `json:"retryOf"`
 
+	// ReuseKey identifies the inputs of this Task, if it may be satisfied
+	// by the result of an earlier successful Task with identical inputs.
+	// Empty if the Task is not eligible for result reuse.
+	ReuseKey string `json:"reuseKey"`
+
+	// ReusedFrom is the ID of the earlier Task whose result was reused to
+	// satisfy this Task, if any. Tasks whose results were reused did not
+	// run on a bot and have no SwarmingTaskId.
+	ReusedFrom string `json:"reusedFrom"`
+
 	// Started is the time the task started running, or zero if the task is
 	// pending, or the same as Finished if the task never ran.
 	Started time.Time `json:"started"`
@@ -165,31 +175,107 @@ type Task struct {
 	TaskKey
 }
 
-// UpdateFromSwarming sets or initializes t from data in s. If any changes were
-// made to t, returns true.
+// SwarmingTaskResult converts a Swarming task result into a TaskResult.
+func SwarmingTaskResult(s *swarming_api.SwarmingRpcsTaskResult) (*TaskResult, error) {
+	if s == nil {
+		return nil, fmt.Errorf("Missing TaskResult. %v", s)
+	}
+	tags, err := swarming.ParseTags(s.Tags)
+	if err != nil {
+		return nil, err
+	}
+	rv := &TaskResult{
+		ID:        s.TaskId,
+		MachineID: s.BotId,
+		Tags:      tags,
+	}
+	if s.OutputsRef != nil {
+		rv.IsolatedOutput = s.OutputsRef.Isolated
+	}
+
+	// CreatedTs should always be present.
+	if rv.Created, err = swarming.ParseTimestamp(s.CreatedTs); err != nil {
+		return nil, fmt.Errorf("Unable to parse task creation time for task %s. %v %v", s.TaskId, err, s)
+	}
+
+	// Status.
+	switch s.State {
+	case swarming.TASK_STATE_BOT_DIED, swarming.TASK_STATE_CANCELED, swarming.TASK_STATE_EXPIRED, swarming.TASK_STATE_NO_RESOURCE, swarming.TASK_STATE_TIMED_OUT, swarming.TASK_STATE_KILLED:
+		rv.Status = TASK_STATUS_MISHAP
+	case swarming.TASK_STATE_PENDING:
+		rv.Status = TASK_STATUS_PENDING
+	case swarming.TASK_STATE_RUNNING:
+		rv.Status = TASK_STATUS_RUNNING
+	case swarming.TASK_STATE_COMPLETED:
+		if s.Failure {
+			// TODO(benjaminwagner): Choose FAILURE or MISHAP depending on ExitCode?
+			rv.Status = TASK_STATUS_FAILURE
+		} else {
+			rv.Status = TASK_STATUS_SUCCESS
+		}
+	default:
+		return nil, fmt.Errorf("Unknown Swarming State %v in %v", s.State, s)
+	}
+
+	// Timestamps.
+	maybeParseTime := func(ts string, field *time.Time, name string) error {
+		if ts == "" {
+			return nil
+		}
+		t, err := swarming.ParseTimestamp(ts)
+		if err != nil {
+			return fmt.Errorf("Unable to parse %s for task %s. %v %v", name, s.TaskId, err, s)
+		}
+		*field = t
+		return nil
+	}
+	if err := maybeParseTime(s.StartedTs, &rv.Started, "StartedTs"); err != nil {
+		return nil, err
+	}
+	if err := maybeParseTime(s.CompletedTs, &rv.Finished, "CompletedTs"); err != nil {
+		return nil, err
+	}
+	if s.CompletedTs == "" && rv.Status == TASK_STATUS_MISHAP {
+		if err := maybeParseTime(s.AbandonedTs, &rv.Finished, "AbandonedTs"); err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+// UpdateFromSwarming sets or initializes t from data in s. See
+// UpdateFromTaskResult for details.
+func (orig *Task) UpdateFromSwarming(s *swarming_api.SwarmingRpcsTaskResult) (bool, error) {
+	res, err := SwarmingTaskResult(s)
+	if err != nil {
+		return false, err
+	}
+	return orig.UpdateFromTaskResult(res)
+}
+
+// UpdateFromTaskResult sets or initializes t from data in res. If any changes
+// were made to t, returns true.
 //
 // Returns ErrUnknownId if the SwarmingTaskId does not match.
 //
-// If empty, sets t.Id, t.Name, t.Repo, and t.Revision from s's tags named
+// If empty, sets t.Id, t.Name, t.Repo, and t.Revision from res's tags named
 // SWARMING_TAG_ID, SWARMING_TAG_NAME, SWARMING_TAG_REPO, and
-// SWARMING_TAG_REVISION, and sets t.Created from s.CreatedTs. If these fields
+// SWARMING_TAG_REVISION, and sets t.Created from res.Created. If these fields
 // are non-empty, returns an error if they do not match.
 //
-// Always sets t.Status, t.Started, t.Finished, and t.IsolatedOutput based on s.
-func (orig *Task) UpdateFromSwarming(s *swarming_api.SwarmingRpcsTaskResult) (bool, error) {
-	if s == nil {
-		return false, fmt.Errorf("Missing TaskResult. %v", s)
+// Always sets t.Status, t.Started, t.Finished, and t.IsolatedOutput based on
+// res.
+func (orig *Task) UpdateFromTaskResult(res *TaskResult) (bool, error) {
+	if res == nil {
+		return false, fmt.Errorf("Missing TaskResult. %v", res)
 	}
 
 	// Swarming TaskId.
-	if orig.SwarmingTaskId != s.TaskId {
+	if orig.SwarmingTaskId != res.ID {
 		return false, ErrUnknownId
 	}
 
-	tags, err := swarming.ParseTags(s.Tags)
-	if err != nil {
-		return false, err
-	}
+	tags := res.Tags
 
 	copy := orig.Copy()
 	if !reflect.DeepEqual(orig, copy) {
@@ -205,7 +291,7 @@ func (orig *Task) UpdateFromSwarming(s *swarming_api.SwarmingRpcsTaskResult) (bo
 			if *field == "" {
 				*field = tagValue[0]
 			} else if *field != tagValue[0] {
-				return fmt.Errorf("%s does not match for task %s. Was %s, now %s. %v %v", fieldName, orig.Id, *field, tagValue, orig, s)
+				return fmt.Errorf("%s does not match for task %s. Was %s, now %s. %v %v", fieldName, orig.Id, *field, tagValue, orig, res)
 			}
 		}
 		return nil
@@ -238,7 +324,7 @@ func (orig *Task) UpdateFromSwarming(s *swarming_api.SwarmingRpcsTaskResult) (bo
 	}
 	copy.Attempt = int(attemptInt)
 	if orig.Attempt != 0 && copy.Attempt != orig.Attempt {
-		return false, fmt.Errorf("Attempt does not match for task %s. Was %d now %d. %v %v", orig.Id, orig.Attempt, copy.Attempt, orig, s)
+		return false, fmt.Errorf("Attempt does not match for task %s. Was %d now %d. %v %v", orig.Id, orig.Attempt, copy.Attempt, orig, res)
 	}
 
 	// Optional try job tags.
@@ -253,73 +339,29 @@ func (orig *Task) UpdateFromSwarming(s *swarming_api.SwarmingRpcsTaskResult) (bo
 	}
 
 	// Set ParentTaskIds.
-	parentTaskIds := tags[SWARMING_TAG_PARENT_TASK_ID]
+	parentTaskIds := util.CopyStringSlice(tags[SWARMING_TAG_PARENT_TASK_ID])
 	sort.Strings(parentTaskIds)
 	copy.ParentTaskIds = parentTaskIds
 
-	// CreatedTs should always be present.
-	if sCreated, err := swarming.ParseTimestamp(s.CreatedTs); err == nil {
-		if util.TimeIsZero(copy.Created) {
-			copy.Created = sCreated
-		} else if copy.Created != sCreated {
-			return false, fmt.Errorf("Creation time has changed for task %s. Was %s, now %s. %v", orig.Id, orig.Created, sCreated, orig)
-		}
-	} else {
-		return false, fmt.Errorf("Unable to parse task creation time for task %s. %v %v", orig.Id, err, orig)
-	}
-
-	// Status.
-	switch s.State {
-	case swarming.TASK_STATE_BOT_DIED, swarming.TASK_STATE_CANCELED, swarming.TASK_STATE_EXPIRED, swarming.TASK_STATE_NO_RESOURCE, swarming.TASK_STATE_TIMED_OUT, swarming.TASK_STATE_KILLED:
-		copy.Status = TASK_STATUS_MISHAP
-	case swarming.TASK_STATE_PENDING:
-		copy.Status = TASK_STATUS_PENDING
-	case swarming.TASK_STATE_RUNNING:
-		copy.Status = TASK_STATUS_RUNNING
-	case swarming.TASK_STATE_COMPLETED:
-		if s.Failure {
-			// TODO(benjaminwagner): Choose FAILURE or MISHAP depending on ExitCode?
-			copy.Status = TASK_STATUS_FAILURE
-		} else {
-			copy.Status = TASK_STATUS_SUCCESS
-		}
-	default:
-		return false, fmt.Errorf("Unknown Swarming State %v in %v", s.State, s)
-	}
-
-	// Isolated output.
-	if s.OutputsRef == nil {
-		copy.IsolatedOutput = ""
-	} else {
-		copy.IsolatedOutput = s.OutputsRef.Isolated
+	// Created should always be present.
+	if util.TimeIsZero(res.Created) {
+		return false, fmt.Errorf("Missing task creation time for task %s. %v", orig.Id, orig)
+	} else if util.TimeIsZero(copy.Created) {
+		copy.Created = res.Created
+	} else if copy.Created != res.Created {
+		return false, fmt.Errorf("Creation time has changed for task %s. Was %s, now %s. %v", orig.Id, orig.Created, res.Created, orig)
 	}
 
-	// Bot.
-	copy.SwarmingBotId = s.BotId
+	copy.Status = res.Status
+	copy.IsolatedOutput = res.IsolatedOutput
+	copy.SwarmingBotId = res.MachineID
 
 	// Timestamps.
-	maybeUpdateTime := func(newTimeStr string, field *time.Time, name string) error {
-		if newTimeStr == "" {
-			return nil
-		}
-		newTime, err := swarming.ParseTimestamp(newTimeStr)
-		if err != nil {
-			return fmt.Errorf("Unable to parse %s for task %s. %v %v", name, orig.Id, err, s)
-		}
-		*field = newTime
-		return nil
-	}
-
-	if err := maybeUpdateTime(s.StartedTs, &copy.Started, "StartedTs"); err != nil {
-		return false, err
+	if !util.TimeIsZero(res.Started) {
+		copy.Started = res.Started
 	}
-	if err := maybeUpdateTime(s.CompletedTs, &copy.Finished, "CompletedTs"); err != nil {
-		return false, err
-	}
-	if s.CompletedTs == "" && copy.Status == TASK_STATUS_MISHAP {
-		if err := maybeUpdateTime(s.AbandonedTs, &copy.Finished, "AbandonedTs"); err != nil {
-			return false, err
-		}
+	if !util.TimeIsZero(res.Finished) {
+		copy.Finished = res.Finished
 	}
 	if copy.Done() && util.TimeIsZero(copy.Started) {
 		copy.Started = copy.Finished
@@ -364,6 +406,8 @@ func (t *Task) Copy() *Task {
 		ParentTaskIds:  util.CopyStringSlice(t.ParentTaskIds),
 		Properties:     util.CopyStringMap(t.Properties),
 		RetryOf:        t.RetryOf,
+		ReuseKey:       t.ReuseKey,
+		ReusedFrom:     t.ReusedFrom,
 		Started:        t.Started,
 		Status:         t.Status,
 		SwarmingBotId:  t.SwarmingBotId,
@@ -377,7 +421,11 @@ func (task *Task) Validate() error {
 	if !task.TaskKey.Valid() {
 		return fmt.Errorf("TaskKey is not valid.")
 	}
-	if task.Fake() && !(task.IsolatedOutput == "" && task.SwarmingBotId == "" && task.SwarmingTaskId == "") {
+	if task.Fake() && !(task.SwarmingBotId == "" && task.SwarmingTaskId == "") {
+		return fmt.Errorf("Can not specify Swarming info for a fake task.")
+	}
+	// Tasks whose results were reused have the outputs of the earlier task.
+	if task.Fake() && task.ReusedFrom == "" && task.IsolatedOutput != "" {
 		return fmt.Errorf("Can not specify Swarming info for a fake task.")
 	}
 	for key, value := range task.Properties {
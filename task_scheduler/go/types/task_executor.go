@@ -0,0 +1,132 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskExecutor is a backend which runs tasks on machines, eg. Swarming. The
+// Task Scheduler decides which tasks to run and when; the TaskExecutor is
+// responsible for running them and reporting their results.
+type TaskExecutor interface {
+	// GetFreeMachines returns all machines in the given pool which are not
+	// currently running a task. The Task Scheduler filters out machines
+	// which are dead or quarantined.
+	GetFreeMachines(ctx context.Context, pool string) ([]*Machine, error)
+	// GetPendingTasks returns all tasks in the given pool which have been
+	// triggered but have not yet started.
+	GetPendingTasks(ctx context.Context, pool string) ([]*TaskResult, error)
+	// GetTaskResult returns the current result of the given task.
+	GetTaskResult(ctx context.Context, taskID string) (*TaskResult, error)
+	// GetTaskCompletionStatuses returns a slice of bools indicating whether
+	// each of the given tasks has finished, in the same order as taskIDs.
+	GetTaskCompletionStatuses(ctx context.Context, taskIDs []string) ([]bool, error)
+	// TriggerTask triggers a new task. The returned TaskResult may indicate
+	// that the task has already finished, eg. if the TaskExecutor
+	// de-duplicated it against a previous task with identical inputs.
+	TriggerTask(ctx context.Context, req *TaskRequest) (*TaskResult, error)
+	// CancelTask cancels the given task. If killRunning is true, the task is
+	// killed if it is already running; otherwise only pending tasks are
+	// canceled.
+	CancelTask(ctx context.Context, taskID string, killRunning bool) error
+}
+
+// Machine describes a machine (or bot) which is able to run tasks.
+type Machine struct {
+	ID string `json:"id"`
+	// Dimensions of the machine, in "key:value" format. Keys may appear more
+	// than once.
+	Dimensions    []string `json:"dimensions"`
+	IsDead        bool     `json:"isDead"`
+	IsQuarantined bool     `json:"isQuarantined"`
+	// CurrentTaskID is the ID of the task the machine is running, if any.
+	CurrentTaskID string `json:"currentTask"`
+}
+
+// CacheRequest describes a named cache which should be mounted for a task.
+type CacheRequest struct {
+	Name string
+	Path string
+}
+
+// CipdPackage describes a CIPD package which should be installed for a task.
+type CipdPackage struct {
+	Name    string
+	Path    string
+	Version string
+}
+
+// TaskRequest contains everything a TaskExecutor needs to run a task.
+type TaskRequest struct {
+	Caches       []*CacheRequest
+	CipdPackages []*CipdPackage
+	Command      []string
+	// Dimensions which a machine must have in order to run the task, in
+	// "key:value" format.
+	Dimensions  []string
+	Env         map[string]string
+	EnvPrefixes map[string][]string
+	// ExecutionTimeout is the maximum amount of time the task may run.
+	ExecutionTimeout time.Duration
+	// Expiration is the maximum amount of time the task may wait for a
+	// machine.
+	Expiration time.Duration
+	ExtraArgs  []string
+	// Idempotent indicates that the task may be de-duplicated against a
+	// previous task with identical inputs.
+	Idempotent bool
+	// IoTimeout is the maximum amount of time the task may run without
+	// producing output.
+	IoTimeout time.Duration
+	// Isolated is the hash of the isolated inputs of the task.
+	Isolated       string
+	Name           string
+	Outputs        []string
+	ServiceAccount string
+	// Tags are "key:value" pairs which are attached to the task and
+	// returned in its TaskResult.
+	Tags []string
+	// TaskSchedulerTaskID is the ID of the Task in the Task Scheduler DB.
+	TaskSchedulerTaskID string
+}
+
+// TaskResult describes the state of a task as reported by a TaskExecutor.
+type TaskResult struct {
+	// ID is the ID of the task in the TaskExecutor. It is stored in
+	// Task.SwarmingTaskId.
+	ID       string
+	Created  time.Time
+	Started  time.Time
+	Finished time.Time
+	// IsolatedOutput is the hash of the isolated outputs of the task, if
+	// any.
+	IsolatedOutput string
+	// MachineID is the ID of the machine which ran the task, if any.
+	MachineID string
+	Status    TaskStatus
+	// Tags attached to the task, as passed in via TaskRequest.Tags.
+	Tags map[string][]string
+}
+
+// Done returns true iff the task has finished.
+func (r *TaskResult) Done() bool {
+	return r.Status != TASK_STATUS_PENDING && r.Status != TASK_STATUS_RUNNING
+}
+
+// Dimensions returns the dimensions which were requested for the task, in
+// sorted "key:value" format, as obtained from its tags.
+func (r *TaskResult) Dimensions() []string {
+	rv := []string{}
+	for k, vals := range r.Tags {
+		if strings.HasPrefix(k, SWARMING_TAG_DIMENSION_PREFIX) {
+			for _, v := range vals {
+				rv = append(rv, fmt.Sprintf("%s:%s", k[len(SWARMING_TAG_DIMENSION_PREFIX):], v))
+			}
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
@@ -461,6 +461,8 @@ func TestCopyTask(t *testing.T) {
 			"awesome": "true",
 		},
 		RetryOf:        "41",
+		ReuseKey:       "fedcba",
+		ReusedFrom:     "40",
 		Started:        now.Add(time.Minute),
 		Status:         TASK_STATUS_MISHAP,
 		SwarmingBotId:  "ENIAC",
@@ -503,6 +505,14 @@ func TestValidateTask(t *testing.T) {
 		require.NoError(t, err)
 		require.True(t, tmpl.Valid())
 	}
+	{
+		// Tasks whose results were reused have outputs but no
+		// Swarming task.
+		task := tmpl.Copy()
+		task.ReusedFrom = "earlier"
+		task.IsolatedOutput = "reused-outputs"
+		require.NoError(t, task.Validate())
+	}
 	// Test invalid cases.
 	{
 		task := tmpl.Copy()
@@ -519,6 +529,12 @@ func TestValidateTask(t *testing.T) {
 		task.SwarmingBotId = "skynet"
 		test(task, "Can not specify Swarming info")
 	}
+	{
+		task := tmpl.Copy()
+		task.ReusedFrom = "earlier"
+		task.SwarmingBotId = "skynet"
+		test(task, "Can not specify Swarming info")
+	}
 	{
 		task := tmpl.Copy()
 		task.Properties = map[string]string{
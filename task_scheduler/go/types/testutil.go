@@ -42,6 +42,7 @@ func MakeFullJob(now time.Time) *Job {
 	return &Job{
 		BuildbucketBuildId:  12345,
 		BuildbucketLeaseKey: 987,
+		ChainDepth:          2,
 		Created:             now.Add(time.Nanosecond),
 		DbModified:          now.Add(time.Millisecond),
 		Dependencies:        map[string][]string{"A": {"B"}, "B": {}},
@@ -53,8 +54,9 @@ func MakeFullJob(now time.Time) *Job {
 		RepoState: RepoState{
 			Repo: DEFAULT_TEST_REPO,
 		},
-		Requested: now,
-		Status:    JOB_STATUS_SUCCESS,
+		Requested:     now,
+		Status:        JOB_STATUS_SUCCESS,
+		StatusDetails: "details",
 		Tasks: map[string][]*TaskSummary{
 			"task-name": {&TaskSummary{
 				Id:             "12345",
@@ -62,6 +64,10 @@ func MakeFullJob(now time.Time) *Job {
 				SwarmingTaskId: "abc123",
 			}},
 		},
+		UpstreamJobId:    "def456",
+		UpstreamOutputs:  []string{"outputhash"},
+		UpstreamRepo:     "upstream.git",
+		UpstreamRevision: "upstream-revision",
 	}
 }
 